@@ -24,7 +24,7 @@ func main() {
 	if err != nil {
 		fmt.Println("Failed to load .env file")
 	}
-	logger := lib.Logger(c.LogFilePath)
+	logger := lib.Logger(c.LogFilePath, c.LogFormat)
 	startDate, endDate, err := loadStartAndEndIdFromEnv()
 	if err != nil {
 		logger.Fatalf("Could not load start and end id from env %v", err)
@@ -35,7 +35,7 @@ func main() {
 	}
 
 	// Setup logging to STDOUT or a configrued log file
-	logger := lib.Logger(c.LogFilePath)
+	logger := lib.Logger(c.LogFilePath, c.LogFormat)
 
 	// Open a DB connection based on the configured DATABASE_URI
 	dbConn, err := db.Open(c)
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/getAlby/lndhub.go/lnd"
@@ -19,6 +20,7 @@ import (
 	"github.com/getAlby/lndhub.go/db/migrations"
 	"github.com/getAlby/lndhub.go/docs"
 	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/pricing"
 	"github.com/getAlby/lndhub.go/lib/service"
 	"github.com/getAlby/lndhub.go/lib/tokens"
 	"github.com/getAlby/lndhub.go/lib/transport"
@@ -26,6 +28,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"github.com/uptrace/bun/migrate"
 )
@@ -61,7 +64,7 @@ func main() {
 	}
 
 	// Setup logging to STDOUT or a configrued log file
-	logger := lib.Logger(c.LogFilePath)
+	logger := lib.Logger(c.LogFilePath, c.LogFormat)
 
 	// Open a DB connection based on the configured DATABASE_URI
 	dbConn, err := db.Open(c)
@@ -132,6 +135,20 @@ func main() {
 		defer rabbitmqClient.Close()
 	}
 
+	priceProvider, err := pricing.NewProvider(c.PriceProvider)
+	if err != nil {
+		logger.Fatalf("Error initializing the price provider: %v", err)
+	}
+	var priceService *pricing.PriceService
+	if priceProvider != nil {
+		priceService = pricing.NewPriceService(priceProvider, time.Duration(c.PriceCacheTTL)*time.Second)
+	}
+
+	outboundClient, err := service.NewOutboundClient(c)
+	if err != nil {
+		logger.Fatalf("Error initializing the outbound client: %v", err)
+	}
+
 	svc := &service.LndhubService{
 		Config:         c,
 		DB:             dbConn,
@@ -139,6 +156,8 @@ func main() {
 		Logger:         logger,
 		InvoicePubSub:  service.NewPubsub(),
 		RabbitMQClient: rabbitmqClient,
+		PriceService:   priceService,
+		OutboundClient: outboundClient,
 	}
 
 	//init echo server
@@ -153,15 +172,17 @@ func main() {
 	logMw := transport.CreateLoggingMiddleware(logger)
 	// strict rate limit for requests for sending payments
 	strictRateLimitMiddleware := transport.CreateRateLimitMiddleware(c.StrictRateLimit, c.BurstRateLimit)
-	secured := e.Group("", tokens.Middleware(c.JWTSecret), logMw)
+	// rate limit per authenticated user
+	userRateLimitMiddleware := transport.CreateUserRateLimitMiddleware(c)
+	secured := e.Group("", svc.ApiKeyMiddleware(), tokens.Middleware(c.JWTSecret), svc.TokenRevocationMiddleware(), svc.SuspensionMiddleware(), userRateLimitMiddleware, logMw)
 
 	// Appying the custom middleware to a Group
 	validateNostrPayload := e.Group("", svc.ValidateNosTREventPayload(), logMw)
 
-	securedWithStrictRateLimit := e.Group("", tokens.Middleware(c.JWTSecret), strictRateLimitMiddleware, logMw)
+	securedWithStrictRateLimit := e.Group("", svc.ApiKeyMiddleware(), tokens.Middleware(c.JWTSecret), svc.TokenRevocationMiddleware(), svc.SuspensionMiddleware(), userRateLimitMiddleware, strictRateLimitMiddleware, logMw)
 
-	transport.RegisterLegacyEndpoints(svc, e, secured, securedWithStrictRateLimit, strictRateLimitMiddleware, tokens.AdminTokenMiddleware(c.AdminToken), logMw)
-	transport.RegisterV2Endpoints(svc, e, secured, validateNostrPayload, securedWithStrictRateLimit, strictRateLimitMiddleware, tokens.AdminTokenMiddleware(c.AdminToken), logMw)
+	transport.RegisterLegacyEndpoints(svc, e, secured, securedWithStrictRateLimit, strictRateLimitMiddleware, tokens.NamedAdminTokenMiddleware(c.AdminToken, c.AdminTokens), logMw)
+	transport.RegisterV2Endpoints(svc, e, secured, validateNostrPayload, securedWithStrictRateLimit, strictRateLimitMiddleware, tokens.NamedAdminTokenMiddleware(c.AdminToken, c.AdminTokens), logMw)
 
 
 
@@ -170,7 +191,7 @@ func main() {
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
 	var backgroundWg sync.WaitGroup
-	backGroundCtx, _ := signal.NotifyContext(context.Background(), os.Interrupt)
+	backGroundCtx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	// Subscribe to LND invoice updates in the background
 	backgroundWg.Add(1)
 	go func() {
@@ -198,6 +219,72 @@ func main() {
 		backgroundWg.Done()
 	}()
 
+	// Look up the final state of payments that are left pending
+	if svc.Config.PendingPaymentReconcileInterval > 0 {
+		backgroundWg.Add(1)
+		go func() {
+			err = svc.StartPendingPaymentReconciliation(backGroundCtx)
+			if err != nil {
+				sentry.CaptureException(err)
+				svc.Logger.Error(err)
+			}
+			svc.Logger.Info("Pending payment reconciliation routine done")
+			backgroundWg.Done()
+		}()
+	}
+
+	// Record the balances of all users for the balance history
+	if svc.Config.BalanceSnapshotInterval > 0 {
+		backgroundWg.Add(1)
+		go func() {
+			err = svc.StartBalanceSnapshotRoutine(backGroundCtx)
+			if err != nil {
+				sentry.CaptureException(err)
+				svc.Logger.Error(err)
+			}
+			svc.Logger.Info("Balance snapshot routine done")
+			backgroundWg.Done()
+		}()
+	}
+
+	// Mark the incoming invoices that expired without being paid
+	if svc.Config.InvoiceExpirySweepInterval > 0 {
+		backgroundWg.Add(1)
+		go func() {
+			err = svc.StartInvoiceExpiryRoutine(backGroundCtx)
+			if err != nil {
+				sentry.CaptureException(err)
+				svc.Logger.Error(err)
+			}
+			svc.Logger.Info("Invoice expiry routine done")
+			backgroundWg.Done()
+		}()
+	}
+
+	// Keep the cached bitcoin prices up to date
+	if svc.PriceService != nil {
+		backgroundWg.Add(1)
+		go func() {
+			svc.StartPriceRefreshRoutine(backGroundCtx)
+			svc.Logger.Info("Price refresh routine done")
+			backgroundWg.Done()
+		}()
+	}
+
+	// Credit the on-chain deposits of the users
+	if svc.Config.EnableOnchainDeposits {
+		backgroundWg.Add(1)
+		go func() {
+			err = svc.StartOnchainDepositRoutine(backGroundCtx)
+			if err != nil {
+				sentry.CaptureException(err)
+				svc.Logger.Error(err)
+			}
+			svc.Logger.Info("On-chain deposit routine done")
+			backgroundWg.Done()
+		}()
+	}
+
 	//Start webhook subscription
 	if svc.Config.WebhookUrl != "" {
 		backgroundWg.Add(1)
@@ -207,6 +294,23 @@ func main() {
 			backgroundWg.Done()
 		}()
 	}
+	//Start delivering events to the webhooks of users
+	backgroundWg.Add(1)
+	go func() {
+		err = svc.StartUserWebhookDeliveries(backGroundCtx)
+		if err != nil {
+			sentry.CaptureException(err)
+			svc.Logger.Error(err)
+		}
+		svc.Logger.Info("User webhook routine done")
+		backgroundWg.Done()
+	}()
+	// the zap receipts are signed on settlement
+	if svc.ZapsEnabled() {
+		if _, err := svc.NostrPublicKey(); err != nil {
+			logger.Fatalf("Invalid NOSTR_PRIVATE_KEY: %v", err)
+		}
+	}
 	//Start rabbit publisher
 	if svc.RabbitMQClient != nil {
 		backgroundWg.Add(1)
@@ -228,6 +332,9 @@ func main() {
 	//Start Prometheus server if necessary
 	var echoPrometheus *echo.Echo
 	if svc.Config.EnablePrometheus {
+		if err := svc.InitMetrics(prometheus.DefaultRegisterer); err != nil {
+			logger.Fatalf("Error registering the metrics: %v", err)
+		}
 		go transport.StartPrometheusEcho(logger, svc, e)
 	}
 
@@ -239,10 +346,14 @@ func main() {
 	}()
 
 	<-backGroundCtx.Done()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// stop accepting requests and wait for the in-flight payments to reach a terminal state
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.ShutdownGrace)*time.Second)
 	defer cancel()
 	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+		e.Logger.Error(err)
+	}
+	if pending := svc.WaitForInFlightPayments(ctx); pending > 0 {
+		svc.Logger.Errorf("Shutdown grace period expired with %d payments still in flight", pending)
 	}
 	if echoPrometheus != nil {
 		if err := echoPrometheus.Shutdown(ctx); err != nil {
@@ -10,11 +10,43 @@ const (
 	InvoiceStateInitialized = "initialized"
 	InvoiceStateOpen        = "open"
 	InvoiceStateError       = "error"
+	InvoiceStatePending     = "pending"
+	InvoiceStateHeld        = "held"
+	InvoiceStateCanceled    = "canceled"
+	InvoiceStateExpired     = "expired"
+	// an outgoing payment that was rejected before it was sent, e.g. for not enough balance
+	InvoiceStateAborted = "aborted"
 
 	AccountTypeIncoming = "incoming"
 	AccountTypeCurrent  = "current"
 	AccountTypeOutgoing = "outgoing"
 	AccountTypeFees     = "fees"
+	// the counterpart of balance adjustments made by admins, it is not checked by the balance trigger
+	AccountTypeAdjustments = "adjustments"
 
 	DestinationPubkeyHexSize = 66
+
+	WebhookEventInvoiceSettled = "invoice.settled"
+	WebhookEventPaymentSent    = "payment.sent"
+	WebhookEventPaymentFailed  = "payment.failed"
+	WebhookEventInvoiceExpired = "invoice.expired"
+
+	EventBalanceChanged = "balance.changed"
+
+	ApiKeyPrefix = "tahub_"
+
+	ScopeRead    = "read"
+	ScopeInvoice = "invoice"
+	ScopePay     = "pay"
+
+	SuspendModeFull     = "full"
+	SuspendModeSendOnly = "send_only"
+
+	// bolt11 confirmations are also used for bolt12 offers and lightning addresses
+	PaymentConfirmationTypeBolt11       = "bolt11"
+	PaymentConfirmationTypeKeysend      = "keysend"
+	PaymentConfirmationTypeMultiKeysend = "keysend_multi"
+	PaymentConfirmationTypeOnchain      = "onchain"
+
+	TenantHeader = "X-Tenant-ID"
 )
@@ -2,11 +2,13 @@ package controllers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
+	"github.com/lightningnetwork/lnd/lnrpc"
 )
 
 // AddInvoiceController : Add invoice controller struct
@@ -19,15 +21,32 @@ func NewAddInvoiceController(svc *service.LndhubService) *AddInvoiceController {
 }
 
 type AddInvoiceRequestBody struct {
-	Amount          interface{} `json:"amt"` // amount in Satoshi
+	Amount          interface{} `json:"amt"`         // amount in Satoshi
+	AmountMsat      interface{} `json:"amount_msat"` // takes precedence over amt
 	Memo            string      `json:"memo"`
 	DescriptionHash string      `json:"description_hash" validate:"omitempty,hexadecimal,len=64"`
+	Expiry          int64       `json:"expiry" validate:"omitempty,gte=60,lte=31536000"` // in seconds
 }
 
 type AddInvoiceResponseBody struct {
-	RHash          string `json:"r_hash"`
-	PaymentRequest string `json:"payment_request"`
-	PayReq         string `json:"pay_req"`
+	RHash           string      `json:"r_hash"`
+	PaymentRequest  string      `json:"payment_request"`
+	PayReq          string      `json:"pay_req"`
+	ExpiresAt       time.Time   `json:"expires_at"`
+	DescriptionHash string      `json:"description_hash,omitempty"`
+	RouteHints      []RouteHint `json:"route_hints,omitempty"`
+}
+
+type RouteHint struct {
+	HopHints []HopHint `json:"hop_hints"`
+}
+
+type HopHint struct {
+	NodeId                    string `json:"node_id"`
+	ChanId                    uint64 `json:"chan_id"`
+	FeeBaseMsat               uint32 `json:"fee_base_msat"`
+	FeeProportionalMillionths uint32 `json:"fee_proportional_millionths"`
+	CltvExpiryDelta           uint32 `json:"cltv_expiry_delta"`
 }
 
 func (controller *AddInvoiceController) AddInvoice(c echo.Context) error {
@@ -48,7 +67,13 @@ func AddInvoice(c echo.Context, svc *service.LndhubService, userID int64) error
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
 
-	amount, err := svc.ParseInt(body.Amount)
+	var amount int64
+	var err error
+	if body.AmountMsat != nil {
+		amount, err = svc.ParseMsatAmount(body.AmountMsat)
+	} else {
+		amount, err = svc.ParseInt(body.Amount)
+	}
 	if err != nil || amount < 0 {
 		c.Logger().Errorj(
 			log.JSON{
@@ -72,7 +97,7 @@ func AddInvoice(c echo.Context, svc *service.LndhubService, userID int64) error
 
 	c.Logger().Infof("Adding invoice: user_id:%v memo:%s value:%v description_hash:%s", userID, body.Memo, amount, body.DescriptionHash)
 
-	invoice, errResp := svc.AddIncomingInvoice(c.Request().Context(), userID, amount, body.Memo, body.DescriptionHash)
+	invoice, errResp := svc.AddIncomingInvoice(c.Request().Context(), userID, amount, body.Memo, body.DescriptionHash, body.Expiry, "", true)
 	if errResp != nil {
 		return c.JSON(errResp.HttpStatusCode, errResp)
 	}
@@ -80,6 +105,34 @@ func AddInvoice(c echo.Context, svc *service.LndhubService, userID int64) error
 	responseBody.RHash = invoice.RHash
 	responseBody.PaymentRequest = invoice.PaymentRequest
 	responseBody.PayReq = invoice.PaymentRequest
+	responseBody.ExpiresAt = invoice.ExpiresAt.Time
+	responseBody.DescriptionHash = invoice.DescriptionHash
+
+	// the route hints are informational, don't fail the request if the invoice can't be decoded
+	decodedPaymentRequest, err := svc.DecodePaymentRequest(c.Request().Context(), invoice.PaymentRequest)
+	if err != nil {
+		c.Logger().Errorf("Failed to decode invoice user_id:%v payment_hash:%s error: %v", userID, invoice.RHash, err)
+	} else {
+		responseBody.RouteHints = convertRouteHints(decodedPaymentRequest.RouteHints)
+	}
 
 	return c.JSON(http.StatusOK, &responseBody)
 }
+
+func convertRouteHints(routeHints []*lnrpc.RouteHint) []RouteHint {
+	result := []RouteHint{}
+	for _, routeHint := range routeHints {
+		hopHints := []HopHint{}
+		for _, hopHint := range routeHint.HopHints {
+			hopHints = append(hopHints, HopHint{
+				NodeId:                    hopHint.NodeId,
+				ChanId:                    hopHint.ChanId,
+				FeeBaseMsat:               hopHint.FeeBaseMsat,
+				FeeProportionalMillionths: hopHint.FeeProportionalMillionths,
+				CltvExpiryDelta:           hopHint.CltvExpiryDelta,
+			})
+		}
+		result = append(result, RouteHint{HopHints: hopHints})
+	}
+	return result
+}
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
@@ -21,18 +23,21 @@ func NewAuthController(svc *service.LndhubService) *AuthController {
 }
 
 type AuthRequestBody struct {
-	Login        string `json:"login"`
-	Password     string `json:"password"`
-	RefreshToken string `json:"refresh_token"`
+	Login        string   `json:"login"`
+	Password     string   `json:"password"`
+	RefreshToken string   `json:"refresh_token"`
+	Scopes       []string `json:"scopes" validate:"omitempty,dive,oneof=read invoice pay"`
 }
 type AuthResponseBody struct {
-	RefreshToken string `json:"refresh_token"`
-	AccessToken  string `json:"access_token"`
+	RefreshToken          string    `json:"refresh_token"`
+	AccessToken           string    `json:"access_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
 }
 
 // Auth godoc
 // @Summary      Authenticate
-// @Description  Exchanges a login + password for a token
+// @Description  Exchanges a login + password or a refresh token for a new access and refresh token. Every refresh token can only be used once. The tokens can be limited to the scopes read, invoice and pay.
 // @Accept       json
 // @Produce      json
 // @Tags         Account
@@ -79,7 +84,7 @@ func (controller *AuthController) Auth(c echo.Context) error {
 		}
 	}
 
-	accessToken, refreshToken, err := controller.svc.GenerateToken(c.Request().Context(), body.Login, body.Password, body.RefreshToken)
+	accessToken, refreshToken, err := controller.svc.GenerateScopedToken(c.Request().Context(), body.Login, body.Password, body.RefreshToken, body.Scopes)
 	if err != nil {
 		if err.Error() == responses.AccountDeactivatedError.Message {
 			c.Logger().Errorj(
@@ -100,8 +105,111 @@ func (controller *AuthController) Auth(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, responses.BadAuthError)
 	}
 
+	now := time.Now()
 	return c.JSON(http.StatusOK, &AuthResponseBody{
-		RefreshToken: refreshToken,
-		AccessToken:  accessToken,
+		RefreshToken:          refreshToken,
+		AccessToken:           accessToken,
+		RefreshTokenExpiresAt: now.Add(time.Duration(controller.svc.Config.JWTRefreshTokenExpiry) * time.Second),
+		AccessTokenExpiresAt:  now.Add(time.Duration(controller.svc.Config.JWTAccessTokenExpiry) * time.Second),
+	})
+}
+
+// Revoke godoc
+// @Summary      Revoke the token
+// @Description  Revokes the token used for this request, it is rejected from now on
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Success      204
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /auth/revoke [post]
+// @Security     OAuth2Password
+func (controller *AuthController) Revoke(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	jti, _ := c.Get("TokenID").(string)
+	expiresAt, _ := c.Get("TokenExpiresAt").(int64)
+	if jti == "" {
+		// tokens issued before the revocation list was introduced can only be revoked with /auth/revoke-all
+		c.Logger().Errorf("Token without id can't be revoked user_id:%v", userID)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	err := controller.svc.RevokeToken(c.Request().Context(), userID, jti, expiresAt)
+	if err != nil {
+		c.Logger().Errorf("Failed to revoke token user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeAll godoc
+// @Summary      Revoke all tokens
+// @Description  Revokes all access and refresh tokens issued to the user so far and all API keys, e.g. if the credentials are compromised
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Success      204
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /auth/revoke-all [post]
+// @Security     OAuth2Password
+func (controller *AuthController) RevokeAll(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	err := controller.svc.RevokeAllTokens(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("Failed to revoke all tokens user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type RotateCredentialsRequestBody struct {
+	Login    string `json:"login" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RotateCredentialsResponseBody struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// RotateCredentials godoc
+// @Summary      Rotate the login and password
+// @Description  Replaces the login and password with new random ones and revokes all tokens issued so far. The old credentials and the API keys stop working right away and the new password is only returned once. Invoices for /invoice/{user_login} need the new login.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        RotateCredentialsRequestBody  body      RotateCredentialsRequestBody  true  "Current login and password"
+// @Success      200                           {object}  RotateCredentialsResponseBody
+// @Failure      400                           {object}  responses.ErrorResponse
+// @Failure      401                           {object}  responses.ErrorResponse
+// @Failure      500                           {object}  responses.ErrorResponse
+// @Router       /auth/rotate [post]
+func (controller *AuthController) RotateCredentials(c echo.Context) error {
+	var body RotateCredentialsRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load rotate credentials request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid rotate credentials request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	login, password, err := controller.svc.RotateCredentials(c.Request().Context(), body.Login, body.Password)
+	if errors.Is(err, service.ErrAccountDeactivated) {
+		c.Logger().Errorf("Credentials of deactivated account not rotated user_login:%v", body.Login)
+		return c.JSON(http.StatusUnauthorized, responses.AccountDeactivatedError)
+	}
+	if errors.Is(err, service.ErrBadCredentials) {
+		c.Logger().Errorf("Credentials not rotated, bad auth user_login:%v", body.Login)
+		return c.JSON(http.StatusUnauthorized, responses.BadAuthError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to rotate credentials user_login:%v error: %v", body.Login, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &RotateCredentialsResponseBody{
+		Login:    login,
+		Password: password,
 	})
 }
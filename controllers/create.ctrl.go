@@ -26,6 +26,7 @@ type CreateUserRequestBody struct {
 	Password    string `json:"password"`
 	PartnerID   string `json:"partnerid"`
 	AccountType string `json:"accounttype"`
+	InviteCode  string `json:"invite_code"`
 }
 
 func (controller *CreateUserController) CreateUser(c echo.Context) error {
@@ -36,7 +37,11 @@ func (controller *CreateUserController) CreateUser(c echo.Context) error {
 		c.Logger().Errorf("Failed to load create user request body: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
-	user, err := controller.svc.CreateUser(c.Request().Context(), body.Login, body.Password)
+	user, err := controller.svc.RegisterUser(c.Request().Context(), "", body.Login, body.Password, body.InviteCode)
+	if errResp := service.InviteCodeError(err); errResp != nil {
+		c.Logger().Errorf("Invite code rejected: %v", err)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
 	if err != nil {
 		c.Logger().Errorf("Failed to create user: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
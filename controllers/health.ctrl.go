@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// HealthController : HealthController struct
+type HealthController struct {
+	svc *service.LndhubService
+}
+
+func NewHealthController(svc *service.LndhubService) *HealthController {
+	return &HealthController{svc: svc}
+}
+
+type HealthResponseBody struct {
+	Status string   `json:"status"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+// Healthz godoc
+// @Summary      Liveness probe
+// @Description  Returns 200 while the process is running
+// @Produce      json
+// @Tags         Health
+// @Success      200  {object}  HealthResponseBody
+// @Router       /healthz [get]
+func (controller *HealthController) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, &HealthResponseBody{Status: "ok"})
+}
+
+// Readyz godoc
+// @Summary      Readiness probe
+// @Description  Checks the database and the lightning node, the failed dependencies are returned with a 503
+// @Produce      json
+// @Tags         Health
+// @Success      200  {object}  HealthResponseBody
+// @Failure      503  {object}  HealthResponseBody
+// @Router       /readyz [get]
+func (controller *HealthController) Readyz(c echo.Context) error {
+	failed := controller.svc.CheckReadiness(c.Request().Context())
+	if len(failed) > 0 {
+		return c.JSON(http.StatusServiceUnavailable, &HealthResponseBody{Status: "unavailable", Failed: failed})
+	}
+	return c.JSON(http.StatusOK, &HealthResponseBody{Status: "ok"})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -66,15 +67,22 @@ func (controller *KeySendController) KeySend(c echo.Context) error {
 		Keysend: true,
 	}
 
-	if controller.svc.LndClient.IsIdentityPubkey(reqBody.Destination) && reqBody.CustomRecords[strconv.Itoa(service.TLV_WALLET_ID)] == "" {
+	if controller.svc.Config.DisableKeysendReceive && controller.svc.LndClient.IsIdentityPubkey(reqBody.Destination) {
+		return c.JSON(http.StatusBadRequest, &responses.KeysendReceiveDisabledError)
+	}
+	if controller.svc.LndClient.IsIdentityPubkey(reqBody.Destination) && reqBody.CustomRecords[strconv.Itoa(service.TLV_WALLET_ID)] == "" && reqBody.CustomRecords[strconv.Itoa(service.TLV_KEYSEND_ALIAS)] == "" {
 		return c.JSON(http.StatusBadRequest, &responses.ErrorResponse{
 			Error:          true,
 			Code:           8,
-			Message:        fmt.Sprintf("Internal keysend payments require the custom record %d to be present.", service.TLV_WALLET_ID),
+			Message:        fmt.Sprintf("Internal keysend payments require the custom record %d or %d to be present.", service.TLV_WALLET_ID, service.TLV_KEYSEND_ALIAS),
 			HttpStatusCode: 400,
 		})
 	}
 
+	if errResp := controller.svc.CheckPaymentAmount(lnPayReq.PayReq.NumSatoshis); errResp != nil {
+		c.Logger().Errorf("Invalid keysend amount user_id:%v amount:%v error: %v", userID, lnPayReq.PayReq.NumSatoshis, errResp.Message)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
 	resp, err := controller.svc.CheckOutgoingPaymentAllowed(c, lnPayReq, userID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
@@ -107,6 +115,9 @@ func (controller *KeySendController) KeySend(c echo.Context) error {
 		invoice.DestinationCustomRecords[uint64(intKey)] = []byte(value)
 	}
 	sendPaymentResponse, err := controller.svc.PayInvoice(c.Request().Context(), invoice)
+	if errors.Is(err, service.ErrDailyLimitExceeded) {
+		return c.JSON(responses.DailyLimitExceededError.HttpStatusCode, responses.DailyLimitExceededError)
+	}
 	if err != nil {
 		c.Logger().Errorf("Payment failed: user_id:%v error: %v", userID, err)
 		sentry.CaptureException(err)
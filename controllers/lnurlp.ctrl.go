@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// LNURLPayController : LNURL-pay controller struct
+type LNURLPayController struct {
+	svc *service.LndhubService
+}
+
+func NewLNURLPayController(svc *service.LndhubService) *LNURLPayController {
+	return &LNURLPayController{svc: svc}
+}
+
+type LNURLPayResponseBody struct {
+	Callback    string `json:"callback"`
+	MinSendable int64  `json:"minSendable"`
+	MaxSendable int64  `json:"maxSendable"`
+	Metadata    string `json:"metadata"`
+	Tag         string `json:"tag"`
+	// NIP-57 zaps
+	AllowsNostr bool   `json:"allowsNostr,omitempty"`
+	NostrPubkey string `json:"nostrPubkey,omitempty"`
+}
+
+type LNURLPayCallbackResponseBody struct {
+	PaymentRequest string        `json:"pr"`
+	Routes         []interface{} `json:"routes"`
+}
+
+// LNURL status and errors use their own format, see LUD-03 and LUD-06
+type LNURLStatusResponseBody struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func lnurlError(c echo.Context, status int, reason string) error {
+	return c.JSON(status, &LNURLStatusResponseBody{
+		Status: "ERROR",
+		Reason: reason,
+	})
+}
+
+func (controller *LNURLPayController) LNURLPay(c echo.Context) error {
+	user, err := controller.svc.FindUserByLogin(c.Request().Context(), c.Param("user"))
+	if err != nil {
+		c.Logger().Errorf("Failed to find user by login: login %v error %v", c.Param("user"), err)
+		return lnurlError(c, http.StatusNotFound, "user not found")
+	}
+	return LNURLPay(c, controller.svc, user, lnurlPayCallbackURL(c, user))
+}
+
+func (controller *LNURLPayController) LNURLPayCallback(c echo.Context) error {
+	user, err := controller.svc.FindUserByLogin(c.Request().Context(), c.Param("user"))
+	if err != nil {
+		c.Logger().Errorf("Failed to find user by login: login %v error %v", c.Param("user"), err)
+		return lnurlError(c, http.StatusNotFound, "user not found")
+	}
+	return LNURLPayCallback(c, controller.svc, user)
+}
+
+// lnurlDomain is the domain the endpoints are served on, which is also the domain of the lightning addresses
+func lnurlDomain(c echo.Context) string {
+	host, _, err := net.SplitHostPort(c.Request().Host)
+	if err != nil {
+		return c.Request().Host
+	}
+	return host
+}
+
+// LightningAddress resolves the username of a lightning address to the LNURL-pay metadata of the user
+func (controller *LNURLPayController) LightningAddress(c echo.Context) error {
+	user, err := controller.svc.GetUserByLightningAddress(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		c.Logger().Errorf("Failed to find user by lightning address: username %v error %v", c.Param("username"), err)
+		return lnurlError(c, http.StatusNotFound, "user not found")
+	}
+	return LNURLPay(c, controller.svc, user, lnurlPayCallbackURL(c, user))
+}
+
+// LightningAddressCallback is the callback of the LNURL-pay metadata of a lightning address
+func (controller *LNURLPayController) LightningAddressCallback(c echo.Context) error {
+	user, err := controller.svc.GetUserByLightningAddress(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		c.Logger().Errorf("Failed to find user by lightning address: username %v error %v", c.Param("username"), err)
+		return lnurlError(c, http.StatusNotFound, "user not found")
+	}
+	return LNURLPayCallback(c, controller.svc, user)
+}
+
+// lnurlPayCallbackURL is the callback of a user, the login is a credential and only used for users without a lightning
+// address, who are only found by their login
+func lnurlPayCallbackURL(c echo.Context, user *models.User) string {
+	if user.LightningAddress.Valid {
+		return fmt.Sprintf("%s://%s/.well-known/lnurlp/%s/callback", c.Scheme(), c.Request().Host, user.LightningAddress.String)
+	}
+	return fmt.Sprintf("%s://%s/lnurlp/%s/callback", c.Scheme(), c.Request().Host, user.Login)
+}
+
+// LNURLPay serves the LNURL-pay metadata of a user
+func LNURLPay(c echo.Context, svc *service.LndhubService, user *models.User, callback string) error {
+	responseBody := &LNURLPayResponseBody{
+		Callback:    callback,
+		MinSendable: svc.LNURLPayMinSendable(),
+		MaxSendable: svc.LNURLPayMaxSendable(svc.GetLimits(c)),
+		Metadata:    svc.LNURLPayMetadata(user, lnurlDomain(c)),
+		Tag:         service.LNURLPayTag,
+	}
+	if svc.ZapsEnabled() {
+		nostrPubkey, err := svc.NostrPublicKey()
+		if err != nil {
+			c.Logger().Errorf("Invalid nostr private key: %v", err)
+			return lnurlError(c, http.StatusInternalServerError, "internal server error")
+		}
+		responseBody.AllowsNostr = true
+		responseBody.NostrPubkey = nostrPubkey
+	}
+	return c.JSON(http.StatusOK, responseBody)
+}
+
+// LNURLPayCallback creates an invoice for the requested amount which commits to the metadata of the user
+func LNURLPayCallback(c echo.Context, svc *service.LndhubService, user *models.User) error {
+	amountMsat, err := strconv.ParseInt(c.QueryParam("amount"), 10, 64)
+	if err != nil {
+		c.Logger().Errorf("Invalid lnurl-pay amount: user_id:%v amount:%v", user.ID, c.QueryParam("amount"))
+		return lnurlError(c, http.StatusBadRequest, "invalid amount")
+	}
+	if amountMsat < svc.LNURLPayMinSendable() || amountMsat > svc.LNURLPayMaxSendable(svc.GetLimits(c)) {
+		c.Logger().Errorf("Lnurl-pay amount out of range: user_id:%v amount:%v", user.ID, amountMsat)
+		return lnurlError(c, http.StatusBadRequest, "amount is out of range")
+	}
+	// invoices are created in satoshi
+	if amountMsat%1000 != 0 {
+		c.Logger().Errorf("Lnurl-pay amount is not a whole satoshi amount: user_id:%v amount:%v", user.ID, amountMsat)
+		return lnurlError(c, http.StatusBadRequest, "amount must be a whole satoshi amount")
+	}
+	amount := amountMsat / 1000
+
+	resp, err := svc.CheckIncomingPaymentAllowed(c, amount, user.ID)
+	if err != nil {
+		return lnurlError(c, http.StatusInternalServerError, "internal server error")
+	}
+	if resp != nil {
+		c.Logger().Errorf("Error: %v user_id:%v amount:%v", resp.Message, user.ID, amount)
+		return lnurlError(c, resp.HttpStatusCode, resp.Message)
+	}
+
+	var invoice *models.Invoice
+	var errResp *responses.ErrorResponse
+	// the invoice of a zap commits to the zap request instead of the metadata
+	if zapRequest := c.QueryParam("nostr"); zapRequest != "" && svc.ZapsEnabled() {
+		if _, err := service.ParseZapRequest(zapRequest, amountMsat); err != nil {
+			c.Logger().Errorf("Invalid zap request: user_id:%v error: %v", user.ID, err)
+			return lnurlError(c, http.StatusBadRequest, "invalid zap request")
+		}
+		invoice, errResp = svc.AddZapInvoice(c.Request().Context(), user.ID, amount, "", zapRequest, 0, "", true)
+	} else {
+		descriptionHash := service.LNURLPayDescriptionHash(svc.LNURLPayMetadata(user, lnurlDomain(c)))
+		invoice, errResp = svc.AddIncomingInvoice(c.Request().Context(), user.ID, amount, "", descriptionHash, 0, "", true)
+	}
+	if errResp != nil {
+		return lnurlError(c, errResp.HttpStatusCode, errResp.Message)
+	}
+	return c.JSON(http.StatusOK, &LNURLPayCallbackResponseBody{
+		PaymentRequest: invoice.PaymentRequest,
+		Routes:         []interface{}{},
+	})
+}
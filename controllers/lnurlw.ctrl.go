@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/labstack/echo/v4"
+)
+
+// LNURLWithdrawController : LNURL-withdraw controller struct
+type LNURLWithdrawController struct {
+	svc *service.LndhubService
+}
+
+func NewLNURLWithdrawController(svc *service.LndhubService) *LNURLWithdrawController {
+	return &LNURLWithdrawController{svc: svc}
+}
+
+type LNURLWithdrawResponseBody struct {
+	Callback           string `json:"callback"`
+	K1                 string `json:"k1"`
+	MinWithdrawable    int64  `json:"minWithdrawable"`
+	MaxWithdrawable    int64  `json:"maxWithdrawable"`
+	DefaultDescription string `json:"defaultDescription"`
+	Tag                string `json:"tag"`
+}
+
+func (controller *LNURLWithdrawController) LNURLWithdraw(c echo.Context) error {
+	withdrawToken, err := controller.svc.FindUnusedWithdrawToken(c.Request().Context(), c.Param("token"))
+	if err != nil {
+		c.Logger().Errorf("Failed to find withdraw token: error %v", err)
+		return lnurlError(c, http.StatusNotFound, "withdraw link not found or already used")
+	}
+	return c.JSON(http.StatusOK, &LNURLWithdrawResponseBody{
+		Callback:           fmt.Sprintf("%s://%s/lnurlw/%s/callback", c.Scheme(), c.Request().Host, withdrawToken.Token),
+		K1:                 withdrawToken.Token,
+		MinWithdrawable:    service.LNURLMinWithdrawable,
+		MaxWithdrawable:    withdrawToken.MaxAmount * 1000,
+		DefaultDescription: "Withdrawal",
+		Tag:                service.LNURLWithdrawTag,
+	})
+}
+
+// LNURLWithdrawCallback pays the invoice of the wallet that redeems the withdraw link
+func (controller *LNURLWithdrawController) LNURLWithdrawCallback(c echo.Context) error {
+	ctx := c.Request().Context()
+	withdrawToken, err := controller.svc.FindUnusedWithdrawToken(ctx, c.Param("token"))
+	if err != nil {
+		c.Logger().Errorf("Failed to find withdraw token: error %v", err)
+		return lnurlError(c, http.StatusNotFound, "withdraw link not found or already used")
+	}
+	userID := withdrawToken.UserID
+
+	paymentRequest := strings.ToLower(c.QueryParam("pr"))
+	decodedPaymentRequest, err := controller.svc.DecodePaymentRequest(ctx, paymentRequest)
+	if err != nil {
+		c.Logger().Errorf("Invalid payment request user_id:%v error: %v", userID, err)
+		return lnurlError(c, http.StatusBadRequest, "invalid payment request")
+	}
+	if controller.svc.PaymentRequestExpired(decodedPaymentRequest) {
+		c.Logger().Errorf("Payment request expired")
+		return lnurlError(c, http.StatusBadRequest, "payment request expired")
+	}
+	if decodedPaymentRequest.NumSatoshis <= 0 || decodedPaymentRequest.NumSatoshis > withdrawToken.MaxAmount {
+		c.Logger().Errorf("Withdraw amount out of range user_id:%v amount:%v", userID, decodedPaymentRequest.NumSatoshis)
+		return lnurlError(c, http.StatusBadRequest, "amount is out of range")
+	}
+	if errResp := controller.svc.CheckPaymentAmount(decodedPaymentRequest.NumSatoshis); errResp != nil {
+		c.Logger().Errorf("Invalid withdraw amount user_id:%v amount:%v error: %v", userID, decodedPaymentRequest.NumSatoshis, errResp.Message)
+		return lnurlError(c, errResp.HttpStatusCode, errResp.Message)
+	}
+
+	lnPayReq := &lnd.LNPayReq{
+		PayReq:  decodedPaymentRequest,
+		Keysend: false,
+	}
+	resp, err := controller.svc.CheckOutgoingPaymentAllowed(c, lnPayReq, userID)
+	if err != nil {
+		return lnurlError(c, http.StatusInternalServerError, "internal server error")
+	}
+	if resp != nil {
+		c.Logger().Errorf("Error: %v user_id:%v amount:%v", resp.Message, userID, lnPayReq.PayReq.NumSatoshis)
+		return lnurlError(c, resp.HttpStatusCode, resp.Message)
+	}
+
+	// claim the token before paying so that it can only be used once
+	err = controller.svc.ClaimWithdrawToken(ctx, withdrawToken)
+	if errors.Is(err, service.WithdrawTokenUsedError) {
+		return lnurlError(c, http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to claim withdraw token user_id:%v error: %v", userID, err)
+		return lnurlError(c, http.StatusInternalServerError, "internal server error")
+	}
+
+	invoice, errResp := controller.svc.AddOutgoingInvoice(ctx, userID, paymentRequest, lnPayReq)
+	if errResp != nil {
+		controller.releaseWithdrawToken(c, withdrawToken)
+		return lnurlError(c, errResp.HttpStatusCode, errResp.Message)
+	}
+	_, err = controller.svc.PayInvoice(ctx, invoice)
+	if err != nil && service.PaymentRejected(err) {
+		// nothing was sent, the withdraw link can be used again
+		controller.releaseWithdrawToken(c, withdrawToken)
+	}
+	if errors.Is(err, service.ErrDailyLimitExceeded) {
+		return lnurlError(c, responses.DailyLimitExceededError.HttpStatusCode, responses.DailyLimitExceededError.Message)
+	}
+	if err != nil {
+		c.Logger().Errorf("Withdraw payment failed invoice_id:%v user_id:%v error: %v", invoice.ID, userID, err)
+		return lnurlError(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, &LNURLStatusResponseBody{
+		Status: "OK",
+	})
+}
+
+// the withdraw link can be used again if nothing was paid, it must only be released if the payment was not sent
+func (controller *LNURLWithdrawController) releaseWithdrawToken(c echo.Context, withdrawToken *models.WithdrawToken) {
+	err := controller.svc.ReleaseWithdrawToken(context.Background(), withdrawToken)
+	if err != nil {
+		c.Logger().Errorf("Failed to release withdraw token user_id:%v error: %v", withdrawToken.UserID, err)
+	}
+}
@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -26,8 +28,9 @@ func NewPayInvoiceController(svc *service.LndhubService) *PayInvoiceController {
 }
 
 type PayInvoiceRequestBody struct {
-	Invoice string      `json:"invoice" validate:"required"`
-	Amount  interface{} `json:"amount" validate:"omitempty"`
+	Invoice    string      `json:"invoice" validate:"required"`
+	Amount     interface{} `json:"amount" validate:"omitempty"`
+	AmountMsat interface{} `json:"amount_msat" validate:"omitempty"` // takes precedence over amount
 }
 type PayInvoiceResponseBody struct {
 	RHash              *lib.JavaScriptBuffer `json:"payment_hash,omitempty"`
@@ -39,6 +42,7 @@ type PayInvoiceResponseBody struct {
 	PaymentError       string                `json:"payment_error"`
 	PaymentPreimage    *lib.JavaScriptBuffer `json:"payment_preimage,omitempty"`
 	PaymentRoute       *service.Route        `json:"payment_route,omitempty"`
+	IsInternal         bool                  `json:"is_internal"`
 }
 
 func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
@@ -58,7 +62,7 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 	paymentRequest = strings.ToLower(paymentRequest)
 	decodedPaymentRequest, err := controller.svc.DecodePaymentRequest(c.Request().Context(), paymentRequest)
 	if err != nil {
-		if strings.Contains(err.Error(), "invoice not for current active network") {
+		if errors.Is(err, service.ErrPaymentRequestWrongNetwork) || strings.Contains(err.Error(), "invoice not for current active network") {
 			c.Logger().Errorf("Incorrect network user_id:%v error: %v", userID, err)
 			return c.JSON(http.StatusBadRequest, responses.IncorrectNetworkError)
 		}
@@ -70,13 +74,22 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 		PayReq:  decodedPaymentRequest,
 		Keysend: false,
 	}
-	if (decodedPaymentRequest.Timestamp + decodedPaymentRequest.Expiry) < time.Now().Unix() {
+	if controller.svc.PaymentRequestExpired(decodedPaymentRequest) {
 		c.Logger().Errorf("Payment request expired")
 		return c.JSON(http.StatusBadRequest, responses.InvoiceExpiredError)
 	}
 
+	// the balances can't represent fractions of a satoshi
+	if decodedPaymentRequest.NumMsat%1000 != 0 {
+		c.Logger().Errorf("Payment request amount is not a whole number of satoshis user_id:%v amount_msat:%v", userID, decodedPaymentRequest.NumMsat)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
 	if decodedPaymentRequest.NumSatoshis == 0 {
 		amt, err := controller.svc.ParseInt(reqBody.Amount)
+		if reqBody.AmountMsat != nil {
+			amt, err = controller.svc.ParseMsatAmount(reqBody.AmountMsat)
+		}
 		if err != nil || amt <= 0 {
 			c.Logger().Errorj(
 				log.JSON{
@@ -88,8 +101,13 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 		}
 		lnPayReq.PayReq.NumSatoshis = amt
+		lnPayReq.PayReq.NumMsat = amt * 1000
 	}
 
+	if errResp := controller.svc.CheckPaymentAmount(lnPayReq.PayReq.NumSatoshis); errResp != nil {
+		c.Logger().Errorf("Invalid payment amount user_id:%v amount:%v error: %v", userID, lnPayReq.PayReq.NumSatoshis, errResp.Message)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
 	resp, err := controller.svc.CheckOutgoingPaymentAllowed(c, lnPayReq, userID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
@@ -98,19 +116,63 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 		c.Logger().Errorf("Error: %v user_id:%v amount:%v", resp.Message, userID, lnPayReq.PayReq.NumSatoshis)
 		return c.JSON(http.StatusBadRequest, resp)
 	}
+	resp, err = controller.svc.CheckDailyOutboundLimit(c.Request().Context(), lnPayReq.PayReq.NumSatoshis, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	if resp != nil {
+		return c.JSON(resp.HttpStatusCode, resp)
+	}
 
 	invoice, errResp := controller.svc.AddOutgoingInvoice(c.Request().Context(), userID, paymentRequest, lnPayReq)
 	if errResp != nil {
 		return c.JSON(errResp.HttpStatusCode, errResp)
 	}
-	sendPaymentResponse, err := controller.svc.PayInvoice(c.Request().Context(), invoice)
+	payCtx := c.Request().Context()
+	if controller.svc.Config.DefaultPaymentTimeout > 0 {
+		var cancel context.CancelFunc
+		payCtx, cancel = context.WithTimeout(payCtx, time.Duration(controller.svc.Config.DefaultPaymentTimeout)*time.Second)
+		defer cancel()
+	}
+	sendPaymentResponse, err := controller.svc.PayInvoice(payCtx, invoice)
+	if errors.Is(err, service.PaymentTimeoutError) {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":         "payment timed out",
+				"user_id":         userID,
+				"invoice_id":      invoice.ID,
+				"payment_hash":    invoice.RHash,
+				"payment_request": controller.svc.RedactPaymentRequest(invoice.PaymentRequest),
+			},
+		)
+		return c.JSON(responses.PaymentTimeoutError.HttpStatusCode, responses.PaymentTimeoutError)
+	}
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		c.Logger().Errorf("Not enough balance for payment user_id:%v invoice_id:%v", userID, invoice.ID)
+		return c.JSON(responses.NotEnoughBalanceError.HttpStatusCode, responses.NotEnoughBalanceError)
+	}
+	if errors.Is(err, service.ErrDailyLimitExceeded) {
+		return c.JSON(responses.DailyLimitExceededError.HttpStatusCode, responses.DailyLimitExceededError)
+	}
+	if errors.Is(err, service.ErrInsufficientNodeLiquidity) {
+		return c.JSON(responses.InsufficientNodeLiquidityError.HttpStatusCode, responses.InsufficientNodeLiquidityError)
+	}
 	if err != nil {
-		c.Logger().Errorf("Payment failed invoice_id:%v user_id:%v error: %v", invoice.ID, userID, err)
+		c.Logger().Errorj(
+			log.JSON{
+				"message":         "payment failed",
+				"error":           err,
+				"user_id":         userID,
+				"invoice_id":      invoice.ID,
+				"payment_hash":    invoice.RHash,
+				"payment_request": controller.svc.RedactPaymentRequest(invoice.PaymentRequest),
+			},
+		)
 		if hub := sentryecho.GetHubFromContext(c); hub != nil {
 			hub.WithScope(func(scope *sentry.Scope) {
 				scope.SetExtra("invoice_id", invoice.ID)
 				scope.SetExtra("destination_pubkey_hex", invoice.DestinationPubkeyHex)
-				scope.SetExtra("payment_request", invoice.PaymentRequest)
+				scope.SetExtra("payment_request", controller.svc.RedactPaymentRequest(invoice.PaymentRequest))
 				hub.CaptureException(err)
 			})
 		}
@@ -130,6 +192,7 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 	responseBody.PaymentError = sendPaymentResponse.PaymentError
 	responseBody.PaymentPreimage = &lib.JavaScriptBuffer{Data: sendPaymentResponse.PaymentPreimage}
 	responseBody.PaymentRoute = sendPaymentResponse.PaymentRoute
+	responseBody.IsInternal = sendPaymentResponse.Internal
 
 	return c.JSON(http.StatusOK, responseBody)
 }
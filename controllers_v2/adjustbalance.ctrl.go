@@ -0,0 +1,101 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/labstack/echo/v4"
+)
+
+// AdjustBalanceController : Adjust balance controller struct
+type AdjustBalanceController struct {
+	svc *service.LndhubService
+}
+
+func NewAdjustBalanceController(svc *service.LndhubService) *AdjustBalanceController {
+	return &AdjustBalanceController{svc: svc}
+}
+
+type AdjustBalanceRequestBody struct {
+	// in sats, negative amounts debit the user
+	Amount int64  `json:"amount" validate:"required"`
+	Reason string `json:"reason" validate:"required,max=255"`
+	// allows debits that make the balance negative
+	Force bool `json:"force"`
+}
+
+type AdjustBalanceResponseBody struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Amount    int64     `json:"amount"`
+	Reason    string    `json:"reason"`
+	Admin     string    `json:"admin"`
+	Force     bool      `json:"force"`
+	Balance   int64     `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AdjustBalance godoc
+// @Summary      Credit or debit the balance of an account
+// @Description  Credits the amount to the account, negative amounts debit it. The adjustment is stored with the reason and the name of the admin token for auditing. Debits that exceed the balance are rejected unless force is set. Requires Authorization header with admin token.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        id      path      int                       true  "User id"
+// @Param        adjust  body      AdjustBalanceRequestBody  true  "Amount and reason"
+// @Success      200     {object}  AdjustBalanceResponseBody
+// @Failure      400     {object}  responses.ErrorResponse
+// @Failure      500     {object}  responses.ErrorResponse
+// @Router       /v2/admin/users/{id}/adjust [post]
+func (controller *AdjustBalanceController) AdjustBalance(c echo.Context) error {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Logger().Errorf("Invalid user id %v: %v", c.Param("id"), err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	var body AdjustBalanceRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load adjust balance request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid adjust balance request body error: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	ctx := c.Request().Context()
+	if _, err := controller.svc.FindUser(ctx, userId); err != nil {
+		c.Logger().Errorf("Failed to find user user_id:%v: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	// the admin is the one who authenticated the request, so the audit trail can't be forged
+	admin, _ := c.Get(tokens.AdminNameKey).(string)
+	adjustment, err := controller.svc.AdjustBalance(ctx, userId, body.Amount, body.Reason, admin, body.Force)
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		c.Logger().Errorf("Balance adjustment exceeds the balance user_id:%v amount:%v", userId, body.Amount)
+		return c.JSON(responses.NotEnoughBalanceError.HttpStatusCode, responses.NotEnoughBalanceError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to adjust balance user_id:%v amount:%v: %v", userId, body.Amount, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	balance, err := controller.svc.CurrentUserBalance(ctx, userId)
+	if err != nil {
+		c.Logger().Errorf("Failed to get balance user_id:%v: %v", userId, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &AdjustBalanceResponseBody{
+		ID:        adjustment.ID,
+		UserID:    adjustment.UserID,
+		Amount:    adjustment.Amount,
+		Reason:    adjustment.Reason,
+		Admin:     adjustment.Admin,
+		Force:     adjustment.Force,
+		Balance:   balance,
+		CreatedAt: adjustment.CreatedAt,
+	})
+}
@@ -0,0 +1,160 @@
+package v2controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/labstack/echo/v4"
+)
+
+// ApiKeyController : API key controller struct
+type ApiKeyController struct {
+	svc *service.LndhubService
+}
+
+func NewApiKeyController(svc *service.LndhubService) *ApiKeyController {
+	return &ApiKeyController{svc: svc}
+}
+
+type CreateApiKeyRequestBody struct {
+	Name   string   `json:"name" validate:"required,max=255"`
+	Scopes []string `json:"scopes" validate:"omitempty,dive,oneof=read invoice pay"`
+}
+
+type ApiKey struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	Key        string    `json:"key,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateApiKey godoc
+// @Summary      Create an API key
+// @Description  Creates a long-lived API key for server-to-server integrations, used as `Authorization: Bearer tahub_...`. The key is only returned once. A key without scopes has full access.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        apikey  body      CreateApiKeyRequestBody  True  "API key"
+// @Success      200     {object}  ApiKey
+// @Failure      400     {object}  responses.ErrorResponse
+// @Failure      403     {object}  responses.ErrorResponse
+// @Failure      500     {object}  responses.ErrorResponse
+// @Router       /v2/apikeys [post]
+// @Security     OAuth2Password
+func (controller *ApiKeyController) CreateApiKey(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	var body CreateApiKeyRequestBody
+
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load create api key request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid create api key request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	// a key can not be granted more than the token that creates it
+	callerScopes, _ := c.Get("Scopes").([]string)
+	if !scopesWithin(body.Scopes, callerScopes) {
+		c.Logger().Errorf("API key scopes %v exceed the token scopes %v user_id:%v", body.Scopes, callerScopes, userID)
+		return c.JSON(http.StatusForbidden, responses.InsufficientScopeError)
+	}
+
+	apiKey, key, err := controller.svc.CreateApiKey(c.Request().Context(), userID, body.Name, body.Scopes)
+	if err != nil {
+		c.Logger().Errorf("Failed to create api key user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response := convertApiKey(apiKey)
+	response.Key = key
+	return c.JSON(http.StatusOK, response)
+}
+
+// ListApiKeys godoc
+// @Summary      List API keys
+// @Description  Returns the API keys of the user that are not revoked
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Success      200  {object}  []ApiKey
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/apikeys [get]
+// @Security     OAuth2Password
+func (controller *ApiKeyController) ListApiKeys(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+
+	apiKeys, err := controller.svc.FindApiKeys(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("Failed to load api keys user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response := []ApiKey{}
+	for i := range apiKeys {
+		response = append(response, *convertApiKey(&apiKeys[i]))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// RevokeApiKey godoc
+// @Summary      Revoke an API key
+// @Description  Revokes an API key of the user, it is rejected from now on
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        id   path  int  true  "API key id"
+// @Success      204
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/apikeys/{id} [delete]
+// @Security     OAuth2Password
+func (controller *ApiKeyController) RevokeApiKey(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Logger().Errorf("Invalid api key id user_id:%v id:%s", userID, c.Param("id"))
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	err = controller.svc.RevokeApiKey(c.Request().Context(), userID, id)
+	if err != nil {
+		c.Logger().Errorf("Failed to revoke api key user_id:%v id:%v error: %v", userID, id, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func convertApiKey(apiKey *models.ApiKey) *ApiKey {
+	return &ApiKey{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Scopes:     apiKey.Scopes,
+		LastUsedAt: apiKey.LastUsedAt.Time,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+// scopesWithin checks that every requested scope is granted to the caller, no scopes means full access
+func scopesWithin(requested, granted []string) bool {
+	if len(granted) == 0 {
+		return true
+	}
+	if len(requested) == 0 {
+		return false
+	}
+	for _, scope := range requested {
+		if !tokens.HasScope(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
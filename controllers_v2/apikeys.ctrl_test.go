@@ -0,0 +1,57 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// these requests are rejected before the database is used, so no database is needed
+func TestCreateApiKeyBeyondCallerScopes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "full access", body: `{"name":"key"}`},
+		{name: "other scope", body: `{"name":"key","scopes":["pay"]}`},
+		{name: "additional scope", body: `{"name":"key","scopes":["read","pay"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewApiKeyController(&service.LndhubService{Config: &service.Config{}})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, "/v2/apikeys", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+			c.Set("Scopes", []string{"read", "invoice"})
+
+			assert.NoError(t, controller.CreateApiKey(c))
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.Equal(t, responses.InsufficientScopeError.Code, errorResponse.Code)
+		})
+	}
+}
+
+func TestScopesWithin(t *testing.T) {
+	assert.True(t, scopesWithin(nil, nil))
+	assert.True(t, scopesWithin([]string{"pay"}, nil))
+	assert.True(t, scopesWithin([]string{"read"}, []string{"read", "invoice"}))
+	assert.False(t, scopesWithin(nil, []string{"read"}))
+	assert.False(t, scopesWithin([]string{"read", "pay"}, []string{"read"}))
+}
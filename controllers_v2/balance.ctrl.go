@@ -1,8 +1,12 @@
 package v2controllers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/getAlby/lndhub.go/lib/pricing"
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
 	"github.com/labstack/echo/v4"
@@ -18,25 +22,62 @@ func NewBalanceController(svc *service.LndhubService) *BalanceController {
 	return &BalanceController{svc: svc}
 }
 
+type BalanceRequestParams struct {
+	Currency string `query:"currency"`
+}
+
 type BalanceResponse struct {
-	Balance  int64  `json:"balance"`
-	Currency string `json:"currency"`
-	Unit     string `json:"unit"`
+	Balance  int64      `json:"balance"`
+	Currency string     `json:"currency"`
+	Unit     string     `json:"unit"`
+	Fiat     *FiatValue `json:"fiat,omitempty"`
+}
+
+// FiatValue is the balance converted with the bitcoin price of the price provider
+type FiatValue struct {
+	Currency string  `json:"currency"`
+	Value    float64 `json:"value"`
+	Rate     float64 `json:"rate"`
 }
 
 // Balance godoc
 // @Summary      Retrieve balance
-// @Description  Current user's balance in satoshi
+// @Description  Current user's balance in satoshi, optionally converted to a fiat currency
 // @Accept       json
 // @Produce      json
 // @Tags         Account
-// @Success      200  {object}  BalanceResponse
-// @Failure      400  {object}  responses.ErrorResponse
-// @Failure      500  {object}  responses.ErrorResponse
+// @Param        currency  query     string  false  "Fiat currency code, e.g. USD"
+// @Success      200       {object}  BalanceResponse
+// @Failure      400       {object}  responses.ErrorResponse
+// @Failure      500       {object}  responses.ErrorResponse
 // @Router       /v2/balance [get]
 // @Security     OAuth2Password
 func (controller *BalanceController) Balance(c echo.Context) error {
 	userId := c.Get("UserID").(int64)
+	params := BalanceRequestParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load balance request params: user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	// the price is fetched first so that unknown currencies are rejected without a balance query
+	var btcPrice float64
+	currency := strings.ToUpper(params.Currency)
+	if currency != "" {
+		if controller.svc.PriceService == nil {
+			c.Logger().Errorf("Fiat balance requested but no price service is configured user_id:%v", userId)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		price, err := controller.svc.PriceService.BTCPrice(c.Request().Context(), currency)
+		if errors.Is(err, pricing.ErrUnknownCurrency) {
+			c.Logger().Errorf("Unknown fiat currency user_id:%v currency:%v", userId, currency)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		if err != nil {
+			c.Logger().Errorf("Failed to fetch the bitcoin price currency:%v error: %v", currency, err)
+			return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+		}
+		btcPrice = price
+	}
 	balance, err := controller.svc.CurrentUserBalance(c.Request().Context(), userId)
 	if err != nil {
 		c.Logger().Errorj(
@@ -48,9 +89,136 @@ func (controller *BalanceController) Balance(c echo.Context) error {
 		)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
-	return c.JSON(http.StatusOK, &BalanceResponse{
+	response := &BalanceResponse{
 		Balance:  balance,
 		Currency: "BTC",
 		Unit:     "sat",
+	}
+	if currency != "" {
+		response.Fiat = &FiatValue{
+			Currency: currency,
+			Value:    pricing.SatsToFiat(balance, btcPrice),
+			Rate:     btcPrice,
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+type BalanceHistoryRequestParams struct {
+	From time.Time `query:"from"`
+	To   time.Time `query:"to"`
+}
+
+type BalanceSnapshot struct {
+	Balance   int64     `json:"balance"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type BalanceHistoryResponse struct {
+	Snapshots []BalanceSnapshot `json:"snapshots"`
+	Currency  string            `json:"currency"`
+	Unit      string            `json:"unit"`
+}
+
+// BalanceHistory godoc
+// @Summary      Retrieve balance history
+// @Description  Recorded balances of the current user in satoshi, oldest first
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        from  query     string  false  "RFC3339 timestamp"
+// @Param        to    query     string  false  "RFC3339 timestamp"
+// @Success      200          {object}  BalanceHistoryResponse
+// @Failure      400          {object}  responses.ErrorResponse
+// @Failure      500          {object}  responses.ErrorResponse
+// @Router       /v2/balance/history [get]
+// @Security     OAuth2Password
+func (controller *BalanceController) BalanceHistory(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	params := BalanceHistoryRequestParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load balance history request params: user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if !params.From.IsZero() && !params.To.IsZero() && params.From.After(params.To) {
+		c.Logger().Errorf("Invalid balance history date range user_id:%v from:%v to:%v", userId, params.From, params.To)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	snapshots, err := controller.svc.GetBalanceSnapshots(c.Request().Context(), userId, params.From, params.To)
+	if err != nil {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "failed to retrieve balance history",
+				"lndhub_user_id": userId,
+				"error":          err,
+			},
+		)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response := &BalanceHistoryResponse{
+		Snapshots: make([]BalanceSnapshot, len(snapshots)),
+		Currency:  "BTC",
+		Unit:      "sat",
+	}
+	for i, snapshot := range snapshots {
+		response.Snapshots[i] = BalanceSnapshot{
+			Balance:   snapshot.Balance,
+			Timestamp: snapshot.Timestamp,
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+type BatchBalanceRequestBody struct {
+	UserIds []int64 `json:"user_ids" validate:"required,min=1,dive,gte=1"`
+}
+
+type BatchBalanceResponseBody struct {
+	Balances map[int64]int64 `json:"balances"`
+	Currency string          `json:"currency"`
+	Unit     string          `json:"unit"`
+}
+
+// BatchBalances godoc
+// @Summary      Retrieve the balances of multiple accounts
+// @Description  Returns the balances in satoshi of the given user ids, ids of users that don't exist are missing. At most MAX_BATCH_BALANCE_IDS ids can be requested at once. Requires Authorization header with admin token.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        body         body      BatchBalanceRequestBody  True   "User ids"
+// @Param        X-Tenant-ID  header    string                   false  "Only return the balances of users of the tenant"
+// @Success      200          {object}  BatchBalanceResponseBody
+// @Failure      400          {object}  responses.ErrorResponse
+// @Failure      500          {object}  responses.ErrorResponse
+// @Router       /v2/balances/batch [post]
+func (controller *BalanceController) BatchBalances(c echo.Context) error {
+	var body BatchBalanceRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load batch balance request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid batch balance request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if len(body.UserIds) > controller.svc.Config.MaxBatchBalanceIds {
+		c.Logger().Errorf("Too many ids in batch balance request: %v max: %v", len(body.UserIds), controller.svc.Config.MaxBatchBalanceIds)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	tenantID, err := service.AdminTenant(c)
+	if err != nil {
+		c.Logger().Errorf("Invalid batch balance tenant: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	balances, err := controller.svc.UserBalances(c.Request().Context(), tenantID, body.UserIds)
+	if err != nil {
+		c.Logger().Errorf("Failed to retrieve batch balances: %v", err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &BatchBalanceResponseBody{
+		Balances: balances,
+		Currency: "BTC",
+		Unit:     "sat",
 	})
 }
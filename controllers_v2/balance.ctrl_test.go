@@ -0,0 +1,78 @@
+package v2controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib/pricing"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingPriceProvider struct{}
+
+func (failingPriceProvider) BTCPrice(ctx context.Context, currency string) (float64, error) {
+	return 0, errors.New("rate limited")
+}
+
+// these requests are rejected before the balance is read, so no database is needed
+func TestBalanceRejectedCurrencies(t *testing.T) {
+	tests := []struct {
+		name           string
+		provider       pricing.Provider
+		currency       string
+		expectedStatus int
+		expectedError  responses.ErrorResponse
+	}{
+		{
+			name:           "no price provider",
+			currency:       "USD",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  responses.BadArgumentsError,
+		},
+		{
+			name:           "unknown currency",
+			provider:       pricing.Fixed{"USD": 30000},
+			currency:       "XYZ",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  responses.BadArgumentsError,
+		},
+		{
+			name:           "price provider error",
+			provider:       failingPriceProvider{},
+			currency:       "USD",
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  responses.GeneralServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service.LndhubService{Config: &service.Config{}}
+			if tt.provider != nil {
+				svc.PriceService = pricing.NewPriceService(tt.provider, time.Minute)
+			}
+			controller := NewBalanceController(svc)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/v2/balance?currency="+tt.currency, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.Balance(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.Equal(t, tt.expectedError.Code, errorResponse.Code)
+			assert.Equal(t, tt.expectedError.Message, errorResponse.Message)
+		})
+	}
+}
@@ -21,10 +21,13 @@ type CreateUserResponseBody struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 	ID       int64  `json:"id"`
+	TenantID string `json:"tenant_id,omitempty"`
 }
 type CreateUserRequestBody struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	// required if REQUIRE_INVITE_CODE is set
+	InviteCode string `json:"invite_code"`
 }
 
 // CreateUser godoc
@@ -33,10 +36,11 @@ type CreateUserRequestBody struct {
 // @Accept       json
 // @Produce      json
 // @Tags         Account
-// @Param        account  body      CreateUserRequestBody  false  "Create User"
-// @Success      200      {object}  CreateUserResponseBody
-// @Failure      400      {object}  responses.ErrorResponse
-// @Failure      500      {object}  responses.ErrorResponse
+// @Param        account      body      CreateUserRequestBody  false  "Create User"
+// @Param        X-Tenant-ID  header    string                 false  "Tenant of the account"
+// @Success      200          {object}  CreateUserResponseBody
+// @Failure      400          {object}  responses.ErrorResponse
+// @Failure      500          {object}  responses.ErrorResponse
 // @Router       /v2/users [post]
 func (controller *CreateUserController) CreateUser(c echo.Context) error {
 
@@ -46,7 +50,16 @@ func (controller *CreateUserController) CreateUser(c echo.Context) error {
 		c.Logger().Errorf("Failed to load create user request body: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
-	user, err := controller.svc.CreateUser(c.Request().Context(), body.Login, body.Password)
+	tenantID, err := service.AdminTenant(c)
+	if err != nil {
+		c.Logger().Errorf("Invalid create user tenant: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	user, err := controller.svc.RegisterUser(c.Request().Context(), tenantID, body.Login, body.Password, body.InviteCode)
+	if errResp := service.InviteCodeError(err); errResp != nil {
+		c.Logger().Errorf("Invite code rejected: %v", err)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
 	if err != nil {
 		c.Logger().Errorf("Failed to create user: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
@@ -56,6 +69,7 @@ func (controller *CreateUserController) CreateUser(c echo.Context) error {
 	ResponseBody.Login = user.Login
 	ResponseBody.Password = user.Password
 	ResponseBody.ID = user.ID
+	ResponseBody.TenantID = user.TenantID
 
 	return c.JSON(http.StatusOK, &ResponseBody)
 }
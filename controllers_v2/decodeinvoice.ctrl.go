@@ -0,0 +1,83 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// DecodeInvoiceController : Decode invoice controller struct
+type DecodeInvoiceController struct {
+	svc *service.LndhubService
+}
+
+func NewDecodeInvoiceController(svc *service.LndhubService) *DecodeInvoiceController {
+	return &DecodeInvoiceController{svc: svc}
+}
+
+type DecodeInvoiceRequestParams struct {
+	Invoice string `query:"invoice" validate:"required"`
+}
+
+type DecodeInvoiceResponseBody struct {
+	Amount          int64  `json:"amount"`
+	Description     string `json:"description"`
+	DescriptionHash string `json:"description_hash"`
+	Destination     string `json:"destination"`
+	PaymentHash     string `json:"payment_hash"`
+	Timestamp       int64  `json:"timestamp"`
+	Expiry          int64  `json:"expiry"`
+	IsExpired       bool   `json:"is_expired"`
+}
+
+// DecodeInvoice godoc
+// @Summary      Decode an invoice
+// @Description  Decode a bolt11 invoice without paying it
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        invoice  query     string  true  "Bolt11 invoice"
+// @Success      200      {object}  DecodeInvoiceResponseBody
+// @Failure      400      {object}  responses.ErrorResponse
+// @Failure      500      {object}  responses.ErrorResponse
+// @Router       /v2/payments/decode [get]
+// @Security     OAuth2Password
+func (controller *DecodeInvoiceController) DecodeInvoice(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	params := DecodeInvoiceRequestParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load decode invoice request params: user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&params); err != nil {
+		c.Logger().Errorf("Invalid decode invoice request params user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	paymentRequest := strings.ToLower(params.Invoice)
+	decodedPaymentRequest, err := controller.svc.DecodePaymentRequest(c.Request().Context(), paymentRequest)
+	if err != nil {
+		if errors.Is(err, service.ErrPaymentRequestWrongNetwork) || strings.Contains(err.Error(), "invoice not for current active network") {
+			c.Logger().Errorf("Incorrect network user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusBadRequest, responses.IncorrectNetworkError)
+		}
+		c.Logger().Errorf("Invalid payment request user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	return c.JSON(http.StatusOK, &DecodeInvoiceResponseBody{
+		Amount:          decodedPaymentRequest.NumSatoshis,
+		Description:     decodedPaymentRequest.Description,
+		DescriptionHash: decodedPaymentRequest.DescriptionHash,
+		Destination:     decodedPaymentRequest.Destination,
+		PaymentHash:     decodedPaymentRequest.PaymentHash,
+		Timestamp:       decodedPaymentRequest.Timestamp,
+		Expiry:          decodedPaymentRequest.Expiry,
+		IsExpired:       controller.svc.PaymentRequestExpired(decodedPaymentRequest),
+	})
+}
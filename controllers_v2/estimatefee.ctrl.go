@@ -0,0 +1,116 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// EstimateFeeController : Estimate fee controller struct
+type EstimateFeeController struct {
+	svc *service.LndhubService
+}
+
+func NewEstimateFeeController(svc *service.LndhubService) *EstimateFeeController {
+	return &EstimateFeeController{svc: svc}
+}
+
+type EstimateFeeRequestBody struct {
+	Invoice string `json:"invoice" validate:"required"`
+	Amount  int64  `json:"amount" validate:"omitempty,gte=0"`
+}
+
+type EstimateFeeResponseBody struct {
+	Amount      int64  `json:"amount"`
+	FeeEstimate int64  `json:"fee_estimate"`
+	FeeReserve  int64  `json:"fee_reserve,omitempty"`
+	Destination string `json:"destination"`
+	NumSatoshis int64  `json:"num_satoshis"`
+}
+
+// EstimateFee godoc
+// @Summary      Estimate the fee of a payment
+// @Description  Estimate the routing fee of a bolt11 invoice without paying it
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        EstimateFeeRequest  body      EstimateFeeRequestBody  True  "Invoice to estimate"
+// @Success      200                 {object}  EstimateFeeResponseBody
+// @Failure      400                 {object}  responses.ErrorResponse
+// @Failure      500                 {object}  responses.ErrorResponse
+// @Router       /v2/payments/bolt11/estimate [post]
+// @Security     OAuth2Password
+func (controller *EstimateFeeController) EstimateFee(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	reqBody := EstimateFeeRequestBody{}
+	if err := c.Bind(&reqBody); err != nil {
+		c.Logger().Errorf("Failed to load estimate fee request body: user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&reqBody); err != nil {
+		c.Logger().Errorf("Invalid estimate fee request body user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	paymentRequest := strings.ToLower(reqBody.Invoice)
+	decodedPaymentRequest, err := controller.svc.DecodePaymentRequest(c.Request().Context(), paymentRequest)
+	if err != nil {
+		if errors.Is(err, service.ErrPaymentRequestWrongNetwork) || strings.Contains(err.Error(), "invoice not for current active network") {
+			c.Logger().Errorf("Incorrect network user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusBadRequest, responses.IncorrectNetworkError)
+		}
+		c.Logger().Errorf("Invalid payment request user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if controller.svc.PaymentRequestExpired(decodedPaymentRequest) {
+		c.Logger().Errorf("Payment request expired")
+		return c.JSON(http.StatusBadRequest, responses.InvoiceExpiredError)
+	}
+
+	amount := decodedPaymentRequest.NumSatoshis
+	if amount == 0 {
+		amt, err := controller.svc.ParseInt(reqBody.Amount)
+		if err != nil || amt <= 0 {
+			c.Logger().Errorj(
+				log.JSON{
+					"message":        "invalid amount",
+					"error":          err,
+					"lndhub_user_id": userID,
+				},
+			)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		amount = amt
+	}
+
+	feeEstimate, err := controller.svc.EstimateFee(c.Request().Context(), decodedPaymentRequest.Destination, amount)
+	if err != nil {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "failed to estimate fee",
+				"error":          err,
+				"lndhub_user_id": userID,
+				"destination":    decodedPaymentRequest.Destination,
+			},
+		)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	responseBody := &EstimateFeeResponseBody{
+		Amount:      amount,
+		FeeEstimate: feeEstimate,
+		Destination: decodedPaymentRequest.Destination,
+		NumSatoshis: decodedPaymentRequest.NumSatoshis,
+	}
+	// this is the amount that has to be available on top of the payment amount
+	if controller.svc.Config.FeeReserve {
+		responseBody.FeeReserve = controller.svc.CalcFeeLimit(decodedPaymentRequest.Destination, amount)
+	}
+
+	return c.JSON(http.StatusOK, responseBody)
+}
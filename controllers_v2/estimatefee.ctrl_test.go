@@ -0,0 +1,80 @@
+package v2controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// the estimate uses the same expiry check as the payment, so invoices within INVOICE_EXPIRY_GRACE can be estimated
+func TestEstimateFeeExpiryGrace(t *testing.T) {
+	tests := []struct {
+		name           string
+		expiredFor     time.Duration
+		grace          int64
+		expectedStatus int
+	}{
+		{"not expired", -time.Minute, 0, http.StatusOK},
+		{"expired", 30 * time.Second, 0, http.StatusBadRequest},
+		{"expired within the clock skew grace", 30 * time.Second, 60, http.StatusOK},
+		{"expired beyond the clock skew grace", 2 * time.Minute, 60, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &testutils.MockLightningClient{
+				Pubkey: "03ournode",
+				DecodeBolt11Func: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+					return &lnrpc.PayReq{
+						NumSatoshis: 1000,
+						NumMsat:     1000000,
+						Destination: "02abcdef",
+						Timestamp:   time.Now().Add(-time.Hour - tt.expiredFor).Unix(),
+						Expiry:      3600,
+					}, nil
+				},
+				EstimateRouteFeeFunc: func(ctx context.Context, req *routerrpc.RouteFeeRequest) (*routerrpc.RouteFeeResponse, error) {
+					return &routerrpc.RouteFeeResponse{RoutingFeeMsat: 2000}, nil
+				},
+			}
+			controller := NewEstimateFeeController(&service.LndhubService{
+				Config:    &service.Config{InvoiceExpiryGrace: tt.grace, MaxFeeAmount: 1000},
+				LndClient: mock,
+			})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11/estimate", strings.NewReader(`{"invoice":"lnbc1"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.EstimateFee(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				responseBody := &EstimateFeeResponseBody{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(responseBody))
+				assert.Equal(t, int64(2), responseBody.FeeEstimate)
+			} else {
+				errorResponse := &responses.ErrorResponse{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+				assert.Equal(t, responses.InvoiceExpiredError.Message, errorResponse.Message)
+				assert.Zero(t, mock.Calls("EstimateRouteFee"))
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package v2controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// GetInfoController : GetInfoController struct
+type GetInfoController struct {
+	svc *service.LndhubService
+}
+
+func NewGetInfoController(svc *service.LndhubService) *GetInfoController {
+	return &GetInfoController{svc: svc}
+}
+
+type GetInfoResponseBody struct {
+	Alias          string `json:"alias"`
+	IdentityPubkey string `json:"identity_pubkey"`
+	// mainnet, testnet, signet or regtest
+	Network     string `json:"network"`
+	BlockHeight uint32 `json:"block_height"`
+	Synced      bool   `json:"synced"`
+	// version of lndhub
+	Version string `json:"version"`
+}
+
+// GetInfo godoc
+// @Summary      Retrieve node info
+// @Description  Returns the alias, pubkey and network of the lightning node
+// @Accept       json
+// @Produce      json
+// @Tags         Info
+// @Success      200  {object}  GetInfoResponseBody
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/getinfo [get]
+// @Security     OAuth2Password
+func (controller *GetInfoController) GetInfo(c echo.Context) error {
+	info, err := controller.svc.CachedGetInfo(c.Request().Context())
+	if err != nil {
+		c.Logger().Errorf("Failed to retrieve node info: %v", err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	responseBody := &GetInfoResponseBody{
+		Alias:          info.Alias,
+		IdentityPubkey: info.IdentityPubkey,
+		BlockHeight:    info.BlockHeight,
+		Synced:         info.SyncedToChain,
+		Version:        lib.Version,
+	}
+	if controller.svc.Config.CustomName != "" {
+		responseBody.Alias = controller.svc.Config.CustomName
+	}
+	if len(info.Chains) > 0 {
+		responseBody.Network = info.Chains[0].Network
+	}
+	return c.JSON(http.StatusOK, responseBody)
+}
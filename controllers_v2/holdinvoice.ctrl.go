@@ -0,0 +1,162 @@
+package v2controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/labstack/echo/v4"
+)
+
+type AddHoldInvoiceRequestBody struct {
+	Amount      int64  `json:"amount" validate:"gt=0"`
+	Description string `json:"description"`
+	Hash        string `json:"hash" validate:"required,hexadecimal,len=64"`
+}
+
+type SettleHoldInvoiceRequestBody struct {
+	Preimage string `json:"preimage" validate:"required,hexadecimal,len=64"`
+}
+
+// AddHoldInvoice godoc
+// @Summary      Generate a new hold invoice
+// @Description  Returns a new bolt11 invoice for a payment hash of the caller. Payments are held until the invoice is settled with the preimage or canceled.
+// @Accept       json
+// @Produce      json
+// @Tags         Invoice
+// @Param        invoice  body      AddHoldInvoiceRequestBody  True  "Add Hold Invoice"
+// @Success      200      {object}  AddInvoiceResponseBody
+// @Failure      400      {object}  responses.ErrorResponse
+// @Failure      500      {object}  responses.ErrorResponse
+// @Router       /v2/invoices/hold [post]
+// @Security     OAuth2Password
+func (controller *InvoiceController) AddHoldInvoice(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	var body AddHoldInvoiceRequestBody
+
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load add hold invoice request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid add hold invoice request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	resp, err := controller.svc.CheckIncomingPaymentAllowed(c, body.Amount, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	if resp != nil {
+		c.Logger().Errorf("Error: %v user_id:%v amount:%v", resp.Message, userID, body.Amount)
+		return c.JSON(resp.HttpStatusCode, resp)
+	}
+
+	c.Logger().Infof("Adding hold invoice: user_id:%v memo:%s value:%v hash:%s", userID, body.Description, body.Amount, body.Hash)
+
+	invoice, errResp := controller.svc.AddHoldInvoice(c.Request().Context(), userID, body.Amount, body.Description, body.Hash)
+	if errResp != nil {
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+	responseBody := AddInvoiceResponseBody{
+		PaymentHash:    invoice.RHash,
+		PaymentRequest: invoice.PaymentRequest,
+		ExpiresAt:      invoice.ExpiresAt.Time,
+		CreatedAt:      invoice.CreatedAt,
+	}
+
+	return c.JSON(http.StatusOK, &responseBody)
+}
+
+// SettleHoldInvoice godoc
+// @Summary      Settle a hold invoice
+// @Description  Settles a held payment of a hold invoice with the preimage of the payment hash. The amount is credited once the settlement is confirmed by the node.
+// @Accept       json
+// @Produce      json
+// @Tags         Invoice
+// @Param        payment_hash  path      string                        true  "Payment hash"
+// @Param        settle        body      SettleHoldInvoiceRequestBody  True  "Preimage"
+// @Success      200           {object}  Invoice
+// @Failure      400           {object}  responses.ErrorResponse
+// @Failure      500           {object}  responses.ErrorResponse
+// @Router       /v2/invoices/{payment_hash}/settle [post]
+// @Security     OAuth2Password
+func (controller *InvoiceController) SettleHoldInvoice(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	rHash := c.Param("payment_hash")
+	var body SettleHoldInvoiceRequestBody
+
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load settle hold invoice request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid settle hold invoice request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	invoice, err := controller.svc.FindHoldInvoiceByPaymentHash(c.Request().Context(), userID, rHash)
+	if err != nil {
+		c.Logger().Errorf("Invalid settle hold invoice request user_id:%v payment_hash:%s", userID, rHash)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	errResp := controller.svc.SettleHoldInvoice(c.Request().Context(), invoice, body.Preimage)
+	if errResp != nil {
+		c.Logger().Errorf("Failed to settle hold invoice user_id:%v payment_hash:%s error: %v", userID, rHash, errResp.Message)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+	return c.JSON(http.StatusOK, holdInvoiceResponse(invoice))
+}
+
+// CancelHoldInvoice godoc
+// @Summary      Cancel a hold invoice
+// @Description  Cancels a hold invoice, a held payment is returned to the payer
+// @Accept       json
+// @Produce      json
+// @Tags         Invoice
+// @Param        payment_hash  path      string  true  "Payment hash"
+// @Success      200           {object}  Invoice
+// @Failure      400           {object}  responses.ErrorResponse
+// @Failure      500           {object}  responses.ErrorResponse
+// @Router       /v2/invoices/{payment_hash}/cancel [post]
+// @Security     OAuth2Password
+func (controller *InvoiceController) CancelHoldInvoice(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	rHash := c.Param("payment_hash")
+
+	invoice, err := controller.svc.FindHoldInvoiceByPaymentHash(c.Request().Context(), userID, rHash)
+	if err != nil {
+		c.Logger().Errorf("Invalid cancel hold invoice request user_id:%v payment_hash:%s", userID, rHash)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	errResp := controller.svc.CancelHoldInvoice(c.Request().Context(), invoice)
+	if errResp != nil {
+		c.Logger().Errorf("Failed to cancel hold invoice user_id:%v payment_hash:%s error: %v", userID, rHash, errResp.Message)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+	return c.JSON(http.StatusOK, holdInvoiceResponse(invoice))
+}
+
+func holdInvoiceResponse(invoice *models.Invoice) *Invoice {
+	return &Invoice{
+		PaymentHash:     invoice.RHash,
+		PaymentRequest:  invoice.PaymentRequest,
+		Description:     invoice.Memo,
+		DescriptionHash: invoice.DescriptionHash,
+		PaymentPreimage: invoice.Preimage,
+		Destination:     invoice.DestinationPubkeyHex,
+		Amount:          invoice.Amount,
+		Fee:             invoice.Fee,
+		Status:          invoice.State,
+		Type:            invoice.Type,
+		ErrorMessage:    invoice.ErrorMessage,
+		SettledAt:       invoice.SettledAt.Time,
+		ExpiresAt:       invoice.ExpiresAt.Time,
+		IsPaid:          invoice.State == common.InvoiceStateSettled,
+		Keysend:         invoice.Keysend,
+		CustomRecords:   invoice.DestinationCustomRecords,
+	}
+}
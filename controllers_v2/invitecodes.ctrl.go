@@ -0,0 +1,80 @@
+package v2controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// InviteCodeController : Invite code controller struct
+type InviteCodeController struct {
+	svc *service.LndhubService
+}
+
+func NewInviteCodeController(svc *service.LndhubService) *InviteCodeController {
+	return &InviteCodeController{svc: svc}
+}
+
+type CreateInviteCodeRequestBody struct {
+	// number of accounts that can be created with the code
+	MaxUses int64 `json:"max_uses" validate:"required,gte=1"`
+	// the code never expires if it is not set
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type InviteCodeResponseBody struct {
+	Code      string     `json:"code"`
+	MaxUses   int64      `json:"max_uses"`
+	Uses      int64      `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreateInviteCode godoc
+// @Summary      Create an invite code
+// @Description  Creates a code for creating accounts, it is required by the account creation endpoints if REQUIRE_INVITE_CODE is set. Requires Authorization header with admin token.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        invite  body      CreateInviteCodeRequestBody  true  "Uses and expiry"
+// @Success      200     {object}  InviteCodeResponseBody
+// @Failure      400     {object}  responses.ErrorResponse
+// @Failure      500     {object}  responses.ErrorResponse
+// @Router       /v2/admin/invitecodes [post]
+func (controller *InviteCodeController) CreateInviteCode(c echo.Context) error {
+	var body CreateInviteCodeRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load create invite code request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid create invite code request body error: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	var expiresAt time.Time
+	if body.ExpiresAt != nil {
+		if !body.ExpiresAt.After(time.Now()) {
+			c.Logger().Errorf("Invite code expiry is in the past: %v", body.ExpiresAt)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		expiresAt = *body.ExpiresAt
+	}
+	inviteCode, err := controller.svc.CreateInviteCode(c.Request().Context(), body.MaxUses, expiresAt)
+	if err != nil {
+		c.Logger().Errorf("Failed to create invite code: %v", err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response := &InviteCodeResponseBody{
+		Code:      inviteCode.Code,
+		MaxUses:   inviteCode.MaxUses,
+		Uses:      inviteCode.Uses,
+		CreatedAt: inviteCode.CreatedAt,
+	}
+	if !inviteCode.ExpiresAt.IsZero() {
+		response.ExpiresAt = &inviteCode.ExpiresAt.Time
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -1,10 +1,14 @@
 package v2controllers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/pricing"
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
 	"github.com/labstack/echo/v4"
@@ -30,15 +34,30 @@ type Invoice struct {
 	Amount          int64             `json:"amount"`
 	Fee             int64             `json:"fee"`
 	Status          string            `json:"status"`
+	State           string            `json:"state"`
 	Type            string            `json:"type"`
 	ErrorMessage    string            `json:"error_message,omitempty"`
+	SettledAmount   int64             `json:"settled_amount"`
 	SettledAt       time.Time         `json:"settled_at"`
 	ExpiresAt       time.Time         `json:"expires_at"`
 	IsPaid          bool              `json:"is_paid"`
 	Keysend         bool              `json:"keysend"`
 	CustomRecords   map[uint64][]byte `json:"custom_records,omitempty"`
+	Label           string            `json:"label,omitempty"`
+	Fiat            *FiatAmount       `json:"fiat,omitempty"`
 }
 
+// the explicit state of an invoice, the status is the state that is stored in the database
+const (
+	InvoiceStateCreated  = "created"
+	InvoiceStateAccepted = "accepted"
+	InvoiceStatePending  = "pending"
+	InvoiceStateSettled  = "settled"
+	InvoiceStateExpired  = "expired"
+	InvoiceStateCanceled = "canceled"
+	InvoiceStateFailed   = "failed"
+)
+
 // GetOutgoingInvoices godoc
 // @Summary      Retrieve outgoing payments
 // @Description  Returns a list of outgoing payments for a user
@@ -84,6 +103,7 @@ func (controller *InvoiceController) GetOutgoingInvoices(c echo.Context) error {
 			IsPaid:          invoice.State == common.InvoiceStateSettled,
 			Keysend:         invoice.Keysend,
 			CustomRecords:   invoice.DestinationCustomRecords,
+			Label:           invoice.Label,
 		}
 	}
 	return c.JSON(http.StatusOK, &response)
@@ -140,15 +160,44 @@ func (controller *InvoiceController) GetIncomingInvoices(c echo.Context) error {
 
 type AddInvoiceRequestBody struct {
 	Amount          int64  `json:"amount" validate:"gte=0"`
+	AmountMsat      int64  `json:"amount_msat" validate:"gte=0"` // takes precedence over amount
 	Description     string `json:"description"`
 	DescriptionHash string `json:"description_hash" validate:"omitempty,hexadecimal,len=64"`
+	Expiry          int64  `json:"expiry" validate:"omitempty,gte=60,lte=31536000"` // in seconds
+	// the zap request event (kind 9734) of a Nostr zap, the invoice commits to its hash
+	Nostr      string `json:"nostr" validate:"required_if=ZapRequest true,excluded_with=DescriptionHash"`
+	ZapRequest bool   `json:"zap_request" validate:"required_with=Nostr"`
+	// the invoice is created for the fiat amount, converted with the current bitcoin price
+	Currency   string  `json:"currency" validate:"required_with=FiatAmount,omitempty,alpha,len=3"`
+	FiatAmount float64 `json:"fiat_amount" validate:"required_with=Currency,excluded_with=Amount AmountMsat ZapRequest,omitempty,gt=0"`
+	// unique per user, a retried request with the same id returns the invoice of the first request
+	ClientInvoiceID string `json:"client_invoice_id" validate:"omitempty,max=255"`
+	// route hints for the private channels of the node, defaults to true. They are needed to receive
+	// if the node only has private channels, but reveal these channels to everyone who sees the invoice
+	IncludePrivateHints *bool `json:"include_private_hints"`
+}
+
+// includePrivateHints returns if the invoice gets route hints for private channels
+func (body *AddInvoiceRequestBody) includePrivateHints() bool {
+	return body.IncludePrivateHints == nil || *body.IncludePrivateHints
+}
+
+// FiatAmount is the fiat amount of an invoice and the price of one bitcoin it was converted with
+type FiatAmount struct {
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount"`
+	Rate     float64 `json:"rate"`
 }
 
 type AddInvoiceResponseBody struct {
-	PaymentHash    string    `json:"payment_hash"`
-	PaymentRequest string    `json:"payment_request"`
-	ExpiresAt      time.Time `json:"expires_at"`
-	CreatedAt      time.Time `json:"created_at"`
+	PaymentHash     string      `json:"payment_hash"`
+	PaymentRequest  string      `json:"payment_request"`
+	DescriptionHash string      `json:"description_hash,omitempty"`
+	Amount          int64       `json:"amount"`
+	Fiat            *FiatAmount `json:"fiat,omitempty"`
+	ClientInvoiceID string      `json:"client_invoice_id,omitempty"`
+	ExpiresAt       time.Time   `json:"expires_at"`
+	CreatedAt       time.Time   `json:"created_at"`
 }
 
 // AddInvoice godoc
@@ -160,6 +209,7 @@ type AddInvoiceResponseBody struct {
 // @Param        invoice  body      AddInvoiceRequestBody  True  "Add Invoice"
 // @Success      200      {object}  AddInvoiceResponseBody
 // @Failure      400      {object}  responses.ErrorResponse
+// @Failure      409      {object}  responses.ErrorResponse
 // @Failure      500      {object}  responses.ErrorResponse
 // @Router       /v2/invoices [post]
 // @Security     OAuth2Password
@@ -177,6 +227,26 @@ func (controller *InvoiceController) AddInvoice(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
 
+	if body.AmountMsat > 0 {
+		amount, err := controller.svc.ParseMsatAmount(body.AmountMsat)
+		if err != nil {
+			c.Logger().Errorf("Invalid add invoice amount_msat user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		body.Amount = amount
+	}
+
+	var fiatRate pricing.Rate
+	if body.FiatAmount > 0 {
+		amount, rate, errResp := controller.svc.ConvertFiatAmount(body.Currency, body.FiatAmount)
+		if errResp != nil {
+			c.Logger().Errorf("Failed to convert the fiat amount user_id:%v currency:%v fiat_amount:%v error: %v", userID, body.Currency, body.FiatAmount, errResp.Message)
+			return c.JSON(errResp.HttpStatusCode, errResp)
+		}
+		body.Amount = amount
+		fiatRate = rate
+	}
+
 	resp, err := controller.svc.CheckIncomingPaymentAllowed(c, body.Amount, userID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
@@ -186,17 +256,40 @@ func (controller *InvoiceController) AddInvoice(c echo.Context) error {
 		return c.JSON(resp.HttpStatusCode, resp)
 	}
 
-	c.Logger().Infof("Adding invoice: user_id:%v memo:%s value:%v description_hash:%s", userID, body.Description, body.Amount, body.DescriptionHash)
+	if body.ZapRequest {
+		if !controller.svc.ZapsEnabled() {
+			c.Logger().Errorf("Zap invoice requested but zaps are not enabled user_id:%v", userID)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		if _, err := service.ParseZapRequest(body.Nostr, body.Amount*1000); err != nil {
+			c.Logger().Errorf("Invalid zap request user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+	}
+
+	c.Logger().Infof("Adding invoice: user_id:%v memo:%s value:%v description_hash:%s zap:%v", userID, body.Description, body.Amount, body.DescriptionHash, body.ZapRequest)
 
-	invoice, errResp := controller.svc.AddIncomingInvoice(c.Request().Context(), userID, body.Amount, body.Description, body.DescriptionHash)
+	var invoice *models.Invoice
+	var errResp *responses.ErrorResponse
+	if body.ZapRequest {
+		invoice, errResp = controller.svc.AddZapInvoice(c.Request().Context(), userID, body.Amount, body.Description, body.Nostr, body.Expiry, body.ClientInvoiceID, body.includePrivateHints())
+	} else if body.FiatAmount > 0 {
+		invoice, errResp = controller.svc.AddFiatInvoice(c.Request().Context(), userID, body.Amount, body.FiatAmount, fiatRate, body.Description, body.DescriptionHash, body.Expiry, body.ClientInvoiceID, body.includePrivateHints())
+	} else {
+		invoice, errResp = controller.svc.AddIncomingInvoice(c.Request().Context(), userID, body.Amount, body.Description, body.DescriptionHash, body.Expiry, body.ClientInvoiceID, body.includePrivateHints())
+	}
 	if errResp != nil {
 		return c.JSON(errResp.HttpStatusCode, errResp)
 	}
 	responseBody := AddInvoiceResponseBody{
-		PaymentHash:    invoice.RHash,
-		PaymentRequest: invoice.PaymentRequest,
-		ExpiresAt:      invoice.ExpiresAt.Time,
-		CreatedAt:      invoice.CreatedAt,
+		PaymentHash:     invoice.RHash,
+		PaymentRequest:  invoice.PaymentRequest,
+		DescriptionHash: invoice.DescriptionHash,
+		Amount:          invoice.Amount,
+		Fiat:            convertFiatAmount(invoice),
+		ClientInvoiceID: invoice.ClientInvoiceID,
+		ExpiresAt:       invoice.ExpiresAt.Time,
+		CreatedAt:       invoice.CreatedAt,
 	}
 
 	return c.JSON(http.StatusOK, &responseBody)
@@ -204,13 +297,13 @@ func (controller *InvoiceController) AddInvoice(c echo.Context) error {
 
 // GetInvoice godoc
 // @Summary      Get a specific invoice
-// @Description  Retrieve information about a specific invoice by payment hash
+// @Description  Retrieve the state of an incoming or outgoing invoice of the user by payment hash
 // @Accept       json
 // @Produce      json
 // @Tags         Invoice
 // @Param        payment_hash  path      string  true  "Payment hash"
 // @Success      200  {object}  Invoice
-// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      404  {object}  responses.ErrorResponse
 // @Failure      500  {object}  responses.ErrorResponse
 // @Router       /v2/invoices/{payment_hash} [get]
 // @Security     OAuth2Password
@@ -218,21 +311,28 @@ func (controller *InvoiceController) GetInvoice(c echo.Context) error {
 	userID := c.Get("UserID").(int64)
 	rHash := c.Param("payment_hash")
 	invoice, err := controller.svc.FindInvoiceByPaymentHash(c.Request().Context(), userID, rHash)
-	// Probably we did not find the invoice
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, responses.InvoiceNotFoundError)
+	}
 	if err != nil {
-		c.Logger().Errorf("Invalid checkpayment request user_id:%v payment_hash:%s", userID, rHash)
-		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		c.Logger().Errorf("Failed to load invoice user_id:%v payment_hash:%s error: %v", userID, rHash, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
 	}
-	responseBody := Invoice{
+	responseBody := convertInvoice(invoice)
+	return c.JSON(http.StatusOK, &responseBody)
+}
+
+func convertInvoice(invoice *models.Invoice) Invoice {
+	result := Invoice{
 		PaymentHash:     invoice.RHash,
 		PaymentRequest:  invoice.PaymentRequest,
 		Description:     invoice.Memo,
 		DescriptionHash: invoice.DescriptionHash,
-		PaymentPreimage: invoice.Preimage,
 		Destination:     invoice.DestinationPubkeyHex,
 		Amount:          invoice.Amount,
 		Fee:             invoice.Fee,
 		Status:          invoice.State,
+		State:           invoiceState(invoice),
 		Type:            invoice.Type,
 		ErrorMessage:    invoice.ErrorMessage,
 		SettledAt:       invoice.SettledAt.Time,
@@ -240,6 +340,46 @@ func (controller *InvoiceController) GetInvoice(c echo.Context) error {
 		IsPaid:          invoice.State == common.InvoiceStateSettled,
 		Keysend:         invoice.Keysend,
 		CustomRecords:   invoice.DestinationCustomRecords,
+		Label:           invoice.Label,
+		Fiat:            convertFiatAmount(invoice),
 	}
-	return c.JSON(http.StatusOK, &responseBody)
+	// the preimage of an incoming invoice is known before it is paid
+	if result.IsPaid {
+		result.PaymentPreimage = invoice.Preimage
+		result.SettledAmount = invoice.Amount
+	}
+	return result
+}
+
+// convertFiatAmount returns the fiat amount of invoices that were created for a fiat amount
+func convertFiatAmount(invoice *models.Invoice) *FiatAmount {
+	if invoice.FiatCurrency == "" {
+		return nil
+	}
+	return &FiatAmount{
+		Currency: invoice.FiatCurrency,
+		Amount:   invoice.FiatAmount,
+		Rate:     invoice.FiatRate,
+	}
+}
+
+func invoiceState(invoice *models.Invoice) string {
+	switch invoice.State {
+	case common.InvoiceStateSettled:
+		return InvoiceStateSettled
+	case common.InvoiceStateCanceled:
+		return InvoiceStateCanceled
+	case common.InvoiceStateExpired:
+		return InvoiceStateExpired
+	case common.InvoiceStateError, common.InvoiceStateAborted:
+		return InvoiceStateFailed
+	case common.InvoiceStateHeld:
+		return InvoiceStateAccepted
+	case common.InvoiceStatePending:
+		return InvoiceStatePending
+	}
+	if invoice.Type == common.InvoiceTypeIncoming && !invoice.ExpiresAt.IsZero() && !invoice.ExpiresAt.Time.After(time.Now()) {
+		return InvoiceStateExpired
+	}
+	return InvoiceStateCreated
 }
@@ -0,0 +1,110 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/pricing"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestConvertInvoiceState(t *testing.T) {
+	future := bun.NullTime{Time: time.Now().Add(time.Hour)}
+	past := bun.NullTime{Time: time.Now().Add(-time.Hour)}
+	tests := []struct {
+		name          string
+		invoice       models.Invoice
+		expectedState string
+	}{
+		{"open incoming", models.Invoice{Type: common.InvoiceTypeIncoming, State: common.InvoiceStateOpen, ExpiresAt: future}, InvoiceStateCreated},
+		{"expired incoming", models.Invoice{Type: common.InvoiceTypeIncoming, State: common.InvoiceStateOpen, ExpiresAt: past}, InvoiceStateExpired},
+		{"expired incoming marked by the sweep", models.Invoice{Type: common.InvoiceTypeIncoming, State: common.InvoiceStateExpired, ExpiresAt: past}, InvoiceStateExpired},
+		{"held incoming", models.Invoice{Type: common.InvoiceTypeIncoming, State: common.InvoiceStateHeld, ExpiresAt: future}, InvoiceStateAccepted},
+		{"settled incoming after the expiry", models.Invoice{Type: common.InvoiceTypeIncoming, State: common.InvoiceStateSettled, ExpiresAt: past}, InvoiceStateSettled},
+		{"canceled incoming", models.Invoice{Type: common.InvoiceTypeIncoming, State: common.InvoiceStateCanceled, ExpiresAt: future}, InvoiceStateCanceled},
+		{"initialized outgoing", models.Invoice{Type: common.InvoiceTypeOutgoing, State: common.InvoiceStateInitialized}, InvoiceStateCreated},
+		{"pending outgoing", models.Invoice{Type: common.InvoiceTypeOutgoing, State: common.InvoiceStatePending}, InvoiceStatePending},
+		{"failed outgoing", models.Invoice{Type: common.InvoiceTypeOutgoing, State: common.InvoiceStateError}, InvoiceStateFailed},
+		{"aborted outgoing", models.Invoice{Type: common.InvoiceTypeOutgoing, State: common.InvoiceStateAborted}, InvoiceStateFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := convertInvoice(&tt.invoice)
+			assert.Equal(t, tt.expectedState, invoice.State)
+			assert.Equal(t, tt.invoice.State, invoice.Status)
+		})
+	}
+}
+
+func TestConvertInvoicePreimage(t *testing.T) {
+	invoice := models.Invoice{Type: common.InvoiceTypeIncoming, State: common.InvoiceStateOpen, Amount: 1000, Preimage: "preimage"}
+	result := convertInvoice(&invoice)
+	assert.Empty(t, result.PaymentPreimage)
+	assert.Zero(t, result.SettledAmount)
+
+	invoice.State = common.InvoiceStateSettled
+	invoice.SettledAt = bun.NullTime{Time: time.Now()}
+	result = convertInvoice(&invoice)
+	assert.Equal(t, "preimage", result.PaymentPreimage)
+	assert.Equal(t, int64(1000), result.SettledAmount)
+	assert.Equal(t, invoice.SettledAt.Time, result.SettledAt)
+}
+
+// these requests are rejected before the database is used
+func TestAddFiatInvoiceRejectedRequests(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		maxPriceAge    int64
+		noPriceService bool
+		expectedStatus int
+		expectedError  responses.ErrorResponse
+	}{
+		{"currency without fiat amount", `{"currency":"USD"}`, 300, false, http.StatusBadRequest, responses.BadArgumentsError},
+		{"fiat amount without currency", `{"fiat_amount":3}`, 300, false, http.StatusBadRequest, responses.BadArgumentsError},
+		{"fiat amount and sat amount", `{"currency":"USD","fiat_amount":3,"amount":100}`, 300, false, http.StatusBadRequest, responses.BadArgumentsError},
+		{"negative fiat amount", `{"currency":"USD","fiat_amount":-3}`, 300, false, http.StatusBadRequest, responses.BadArgumentsError},
+		{"unknown currency", `{"currency":"XYZ","fiat_amount":3}`, 300, false, http.StatusBadRequest, responses.BadArgumentsError},
+		{"amount below one sat", `{"currency":"USD","fiat_amount":0.0001}`, 300, false, http.StatusBadRequest, responses.BadArgumentsError},
+		{"no price service", `{"currency":"USD","fiat_amount":3}`, 300, true, http.StatusBadRequest, responses.BadArgumentsError},
+		{"outdated price", `{"currency":"USD","fiat_amount":3}`, -1, false, http.StatusServiceUnavailable, responses.PriceUnavailableError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service.LndhubService{Config: &service.Config{MaxPriceAge: tt.maxPriceAge}, Logger: lecho.New(io.Discard)}
+			if !tt.noPriceService {
+				svc.PriceService = pricing.NewPriceService(pricing.Fixed{"USD": 30000}, time.Minute)
+			}
+			controller := NewInvoiceController(svc)
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, "/v2/invoices", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.AddInvoice(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.Equal(t, tt.expectedError.Code, errorResponse.Code)
+			assert.Equal(t, tt.expectedError.Message, errorResponse.Message)
+		})
+	}
+}
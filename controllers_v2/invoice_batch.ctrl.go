@@ -0,0 +1,115 @@
+package v2controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/labstack/echo/v4"
+)
+
+type AddInvoiceBatchRequestBody struct {
+	Invoices []BatchInvoiceRequestBody `json:"invoices" validate:"required,min=1,dive"`
+}
+
+type BatchInvoiceRequestBody struct {
+	Amount int64  `json:"amount" validate:"gte=0"`
+	Memo   string `json:"memo"`
+	Expiry int64  `json:"expiry" validate:"omitempty,gte=60,lte=31536000"` // in seconds
+}
+
+type AddInvoiceBatchResponseBody struct {
+	Invoices []BatchInvoiceResult `json:"invoices"`
+}
+
+// BatchInvoiceResult is the outcome of an invoice of the batch, in the order of the request
+type BatchInvoiceResult struct {
+	// created or failed
+	Status  string                   `json:"status"`
+	Invoice *AddInvoiceResponseBody  `json:"invoice,omitempty"`
+	Error   *responses.ErrorResponse `json:"error,omitempty"`
+}
+
+const (
+	BatchInvoiceStatusCreated = "created"
+	BatchInvoiceStatusFailed  = "failed"
+)
+
+// AddInvoiceBatch godoc
+// @Summary      Generate multiple invoices
+// @Description  Returns new bolt11 invoices, an invoice that can't be created is reported as failed without failing the others
+// @Accept       json
+// @Produce      json
+// @Tags         Invoice
+// @Param        invoices  body      AddInvoiceBatchRequestBody  True  "Add Invoices"
+// @Success      200       {object}  AddInvoiceBatchResponseBody
+// @Failure      400       {object}  responses.ErrorResponse
+// @Failure      429       {object}  responses.ErrorResponse
+// @Failure      500       {object}  responses.ErrorResponse
+// @Router       /v2/invoices/batch [post]
+// @Security     OAuth2Password
+func (controller *InvoiceController) AddInvoiceBatch(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	var body AddInvoiceBatchRequestBody
+
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load addinvoice batch request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid addinvoice batch request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	// rejected before the amounts of the invoices are checked
+	if errResp := controller.svc.CheckInvoiceBatchSize(len(body.Invoices)); errResp != nil {
+		c.Logger().Errorf("Invoice batch too large user_id:%v count:%v", userID, len(body.Invoices))
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+
+	results := make([]BatchInvoiceResult, len(body.Invoices))
+	invoices := []models.Invoice{}
+	// the position of the invoices that are created in the results
+	positions := []int{}
+	for i, entry := range body.Invoices {
+		resp, err := controller.svc.CheckIncomingPaymentAllowed(c, entry.Amount, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+		}
+		if resp != nil {
+			c.Logger().Errorf("Error: %v user_id:%v amount:%v", resp.Message, userID, entry.Amount)
+			results[i] = BatchInvoiceResult{Status: BatchInvoiceStatusFailed, Error: resp}
+			continue
+		}
+		invoices = append(invoices, models.Invoice{
+			Amount:            entry.Amount,
+			Memo:              entry.Memo,
+			Expiry:            entry.Expiry,
+			PrivateRouteHints: true,
+		})
+		positions = append(positions, i)
+	}
+
+	c.Logger().Infof("Adding invoice batch: user_id:%v count:%v", userID, len(invoices))
+	created, errResp := controller.svc.AddIncomingInvoiceBatch(c.Request().Context(), userID, invoices)
+	if errResp != nil {
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+	for j, result := range created {
+		if result.Error != nil {
+			results[positions[j]] = BatchInvoiceResult{Status: BatchInvoiceStatusFailed, Error: result.Error}
+			continue
+		}
+		results[positions[j]] = BatchInvoiceResult{
+			Status: BatchInvoiceStatusCreated,
+			Invoice: &AddInvoiceResponseBody{
+				PaymentHash:    result.Invoice.RHash,
+				PaymentRequest: result.Invoice.PaymentRequest,
+				Amount:         result.Invoice.Amount,
+				ExpiresAt:      result.Invoice.ExpiresAt.Time,
+				CreatedAt:      result.Invoice.CreatedAt,
+			},
+		}
+	}
+	return c.JSON(http.StatusOK, &AddInvoiceBatchResponseBody{Invoices: results})
+}
@@ -0,0 +1,75 @@
+package v2controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+)
+
+func addInvoiceBatch(t *testing.T, mock *testutils.MockLightningClient, body string) *httptest.ResponseRecorder {
+	controller := NewInvoiceController(&service.LndhubService{
+		Config:    &service.Config{MaxInvoiceBatchSize: 2},
+		LndClient: mock,
+		Logger:    lecho.New(io.Discard),
+	})
+	e := echo.New()
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	req := httptest.NewRequest(http.MethodPost, "/v2/invoices/batch", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("UserID", int64(1))
+	assert.NoError(t, controller.AddInvoiceBatch(c))
+	return rec
+}
+
+func TestAddInvoiceBatchSizeCap(t *testing.T) {
+	mock := &testutils.MockLightningClient{}
+	rec := addInvoiceBatch(t, mock, `{"invoices":[{"amount":1},{"amount":2},{"amount":3}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(t, "a batch can have at most 2 invoices", errorResponse.Message)
+	assert.Zero(t, mock.Calls("AddInvoice"))
+
+	rec = addInvoiceBatch(t, mock, `{"invoices":[]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// no invoice is stored when none of them could be created, so no database is needed
+func TestAddInvoiceBatchEntryFailures(t *testing.T) {
+	mock := &testutils.MockLightningClient{
+		AddInvoiceFunc: func(ctx context.Context, req *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error) {
+			return nil, errors.New("node is offline")
+		},
+	}
+	rec := addInvoiceBatch(t, mock, `{"invoices":[{"amount":1,"memo":"a"},{"amount":2,"memo":"`+"\\u0007"+`"}]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	response := &AddInvoiceBatchResponseBody{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(response))
+	assert.Len(t, response.Invoices, 2)
+	for _, result := range response.Invoices {
+		assert.Equal(t, BatchInvoiceStatusFailed, result.Status)
+		assert.Nil(t, result.Invoice)
+		assert.NotNil(t, result.Error)
+	}
+	assert.Equal(t, responses.GeneralServerError.Message, response.Invoices[0].Error.Message)
+	// the invalid memo is rejected before the node is asked
+	assert.Equal(t, responses.BadArgumentsError.Code, response.Invoices[1].Error.Code)
+	assert.Equal(t, 1, mock.Calls("AddInvoice"))
+}
@@ -0,0 +1,74 @@
+package v2controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/labstack/echo/v4"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRCodeSize = 256
+	minQRCodeSize     = 128
+	maxQRCodeSize     = 1024
+)
+
+// GetInvoiceQR godoc
+// @Summary      Get the QR code of an invoice
+// @Description  Renders the payment request of an invoice of the user as a PNG QR code, the image is larger than the size if the QR code doesn't fit
+// @Produce      png
+// @Tags         Invoice
+// @Param        payment_hash  path      string   true   "Payment hash"
+// @Param        size          query     integer  false  "Width and height in pixels, between 128 and 1024 (default 256)"
+// @Success      200  {file}    binary
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      404  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/invoices/{payment_hash}/qr.png [get]
+// @Security     OAuth2Password
+func (controller *InvoiceController) GetInvoiceQR(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	rHash := c.Param("payment_hash")
+	size := defaultQRCodeSize
+	if sizeParam := c.QueryParam("size"); sizeParam != "" {
+		var err error
+		size, err = strconv.Atoi(sizeParam)
+		if err != nil || size < minQRCodeSize || size > maxQRCodeSize {
+			c.Logger().Errorf("Invalid QR code size user_id:%v size:%s", userID, sizeParam)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+	}
+
+	invoice, err := controller.svc.FindInvoiceByPaymentHash(c.Request().Context(), userID, rHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, responses.InvoiceNotFoundError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to load invoice user_id:%v payment_hash:%s error: %v", userID, rHash, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	// keysend payments and invoices that were not created on the node have nothing to scan
+	if invoice.PaymentRequest == "" {
+		return c.JSON(http.StatusNotFound, responses.InvoiceNotFoundError)
+	}
+
+	png, err := invoiceQRCode(invoice.PaymentRequest, size)
+	if err != nil {
+		c.Logger().Errorf("Error encoding QR user_id:%v payment_hash:%s error: %v", userID, rHash, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	// the payment request of an invoice never changes
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, max-age=86400, immutable")
+	return c.Blob(http.StatusOK, "image/png", png)
+}
+
+// invoiceQRCode renders the payment request as a lightning URI, in upper case the QR code can use the more compact
+// alphanumeric mode
+func invoiceQRCode(paymentRequest string, size int) ([]byte, error) {
+	return qrcode.Encode(strings.ToUpper("lightning:"+paymentRequest), qrcode.Medium, size)
+}
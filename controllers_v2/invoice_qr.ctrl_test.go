@@ -0,0 +1,41 @@
+package v2controllers
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvoiceQRCode(t *testing.T) {
+	// as long as an invoice with a memo and a route hint
+	paymentRequest := "lnbcrt10u1pj" + strings.Repeat("q8w3x5z7", 60)
+	for _, size := range []int{minQRCodeSize, defaultQRCodeSize, maxQRCodeSize} {
+		qr, err := invoiceQRCode(paymentRequest, size)
+		assert.NoError(t, err)
+		image, err := png.Decode(bytes.NewReader(qr))
+		assert.NoError(t, err)
+		assert.Equal(t, size, image.Bounds().Dx())
+		assert.Equal(t, size, image.Bounds().Dy())
+	}
+}
+
+// invalid sizes are rejected before the invoice is looked up, so no database is needed
+func TestGetInvoiceQRInvalidSize(t *testing.T) {
+	controller := NewInvoiceController(&service.LndhubService{Config: &service.Config{}})
+	e := echo.New()
+	for _, size := range []string{"abc", "10", "5000", "-256"} {
+		req := httptest.NewRequest(http.MethodGet, "/v2/invoices/abcd/qr.png?size="+size, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("UserID", int64(1))
+		assert.NoError(t, controller.GetInvoiceQR(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, size)
+	}
+}
@@ -0,0 +1,117 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// a comment is sent regularly so that proxies don't close an idle stream
+const invoiceStreamKeepAlive = 30 * time.Second
+
+// StreamInvoice godoc
+// @Summary      Stream the status of an invoice
+// @Description  Server-Sent Events stream of the state of an incoming invoice. The current state is sent first, the stream is closed once the invoice is settled, canceled or expired.
+// @Produce      text/event-stream
+// @Tags         Invoice
+// @Param        payment_hash  path      string  true  "Payment hash"
+// @Success      200  {object}  Invoice
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/invoices/{payment_hash}/stream [get]
+// @Security     OAuth2Password
+func (controller *InvoiceController) StreamInvoice(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	rHash := c.Param("payment_hash")
+	ctx := c.Request().Context()
+	invoice, err := controller.svc.FindInvoiceByPaymentHash(ctx, userID, rHash)
+	if err != nil || invoice.Type != common.InvoiceTypeIncoming {
+		c.Logger().Errorf("Invalid invoice stream request user_id:%v payment_hash:%s", userID, rHash)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	// subscribe before reading the current status again, so a settlement in between is not missed
+	invoices, unsubscribe, err := controller.svc.SubscribeAccountEvents(userID)
+	if err != nil {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "failed to subscribe to account events",
+				"lndhub_user_id": userID,
+				"error":          err,
+			},
+		)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	defer unsubscribe()
+	invoice, err = controller.svc.FindInvoiceByPaymentHash(ctx, userID, rHash)
+	if err != nil {
+		c.Logger().Errorf("Failed to load invoice user_id:%v payment_hash:%s error: %v", userID, rHash, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// disable the response buffering of nginx
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	if done, err := writeInvoiceEvent(res, invoice); done || err != nil {
+		return nil
+	}
+	var expired <-chan time.Time
+	if !invoice.ExpiresAt.IsZero() {
+		expiryTimer := time.NewTimer(time.Until(invoice.ExpiresAt.Time))
+		defer expiryTimer.Stop()
+		expired = expiryTimer.C
+	}
+	keepAlive := time.NewTicker(invoiceStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-expired:
+			writeInvoiceEvent(res, invoice)
+			return nil
+		case update := <-invoices:
+			if update.RHash != rHash || update.Type != common.InvoiceTypeIncoming {
+				continue
+			}
+			invoice = &update
+			if done, err := writeInvoiceEvent(res, invoice); done || err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// writeInvoiceEvent sends the state of the invoice, it returns true if the state is final
+func writeInvoiceEvent(res *echo.Response, invoice *models.Invoice) (done bool, err error) {
+	body := convertInvoice(invoice)
+	switch body.State {
+	case InvoiceStateSettled, InvoiceStateCanceled, InvoiceStateExpired:
+		done = true
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return done, err
+	}
+	if _, err = fmt.Fprintf(res, "event: %s\ndata: %s\n\n", body.State, data); err != nil {
+		return done, err
+	}
+	res.Flush()
+	return done, nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/record"
 )
 
 // KeySendController : Key send controller struct
@@ -59,12 +60,13 @@ type KeySendResponseBody struct {
 
 // // KeySend godoc
 // @Summary      Make a keysend payment
-// @Description  Pay a node without an invoice using it's public key
+// @Description  Pay a node without an invoice using it's public key, payments above CONFIRMATION_THRESHOLD_SATS return a confirmation token and are sent by /v2/payments/confirm
 // @Accept       json
 // @Produce      json
 // @Tags         Payment
 // @Param        KeySendRequestBody  body      KeySendRequestBody  True  "Invoice to pay"
 // @Success      200                 {object}  KeySendResponseBody
+// @Success      202                 {object}  PaymentConfirmationResponseBody
 // @Failure      400                 {object}  responses.ErrorResponse
 // @Failure      500                 {object}  responses.ErrorResponse
 // @Router       /v2/payments/keysend [post]
@@ -81,12 +83,30 @@ func (controller *KeySendController) KeySend(c echo.Context) error {
 		c.Logger().Errorf("Invalid keysend request body: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
+	return controller.keySend(c, userID, &reqBody, false)
+}
+
+// keySend checks the limits of the user and sends the keysend payment.
+// Payments above the confirmation threshold are only sent if they are confirmed, otherwise a confirmation is created.
+func (controller *KeySendController) keySend(c echo.Context, userID int64, reqBody *KeySendRequestBody, confirmed bool) error {
+	if errResp := controller.svc.CheckPaymentAmount(reqBody.Amount); errResp != nil {
+		c.Logger().Errorf("Invalid keysend amount user_id:%v amount:%v error: %v", userID, reqBody.Amount, errResp.Message)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
 	errResp := controller.checkKeysendPaymentAllowed(c, reqBody.Amount, userID)
 	if errResp != nil {
 		c.Logger().Errorf("Failed to send keysend: %s", errResp.Message)
 		return c.JSON(errResp.HttpStatusCode, errResp)
 	}
-	result, errResp := controller.SingleKeySend(c.Request().Context(), &reqBody, userID)
+	if !confirmed && controller.svc.NeedsPaymentConfirmation(reqBody.Amount) {
+		return requestBodyConfirmation(c, controller.svc, userID, common.PaymentConfirmationTypeKeysend, reqBody, controller.keysendReserve(reqBody), &PaymentConfirmationResponseBody{
+			Amount:      reqBody.Amount,
+			Description: reqBody.Memo,
+			Destination: reqBody.Destination,
+			FeeLimit:    controller.svc.CalcFeeLimit(reqBody.Destination, reqBody.Amount),
+		})
+	}
+	result, errResp := controller.SingleKeySend(c.Request().Context(), reqBody, userID)
 	if errResp != nil {
 		c.Logger().Errorf("Failed to send keysend: %s", errResp.Message)
 		return c.JSON(errResp.HttpStatusCode, errResp)
@@ -96,12 +116,13 @@ func (controller *KeySendController) KeySend(c echo.Context) error {
 
 // // MultiKeySend godoc
 // @Summary      Make multiple keysend payments
-// @Description  Pay multiple nodes without an invoice using their public key
+// @Description  Pay multiple nodes without an invoice using their public key, payments with a total above CONFIRMATION_THRESHOLD_SATS return a confirmation token and are sent by /v2/payments/confirm
 // @Accept       json
 // @Produce      json
 // @Tags         Payment
 // @Param        MultiKeySendRequestBody  body      MultiKeySendRequestBody  True  "Invoice to pay"
 // @Success      200                 {object}  MultiKeySendResponseBody
+// @Success      202                 {object}  PaymentConfirmationResponseBody
 // @Failure      400                 {object}  responses.ErrorResponse
 // @Failure      500                 {object}  responses.ErrorResponse
 // @Router       /v2/payments/keysend/multi [post]
@@ -117,11 +138,21 @@ func (controller *KeySendController) MultiKeySend(c echo.Context) error {
 		c.Logger().Errorf("Invalid keysend request body: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
+	return controller.multiKeySend(c, userID, &reqBody, false)
+}
+
+// multiKeySend checks the limits of the user and sends the keysend payments, they are confirmed together if their total is above the confirmation threshold
+func (controller *KeySendController) multiKeySend(c echo.Context, userID int64, reqBody *MultiKeySendRequestBody, confirmed bool) error {
 	for _, split := range reqBody.Keysends {
 		if err := c.Validate(&split); err != nil {
 			c.Logger().Errorf("Invalid keysend request body: %v", err)
 			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 		}
+		// the limits apply to every single payment
+		if errResp := controller.svc.CheckPaymentAmount(split.Amount); errResp != nil {
+			c.Logger().Errorf("Invalid keysend amount user_id:%v amount:%v error: %v", userID, split.Amount, errResp.Message)
+			return c.JSON(errResp.HttpStatusCode, errResp)
+		}
 	}
 	var totalAmount int64
 	for _, keysend := range reqBody.Keysends {
@@ -132,6 +163,21 @@ func (controller *KeySendController) MultiKeySend(c echo.Context) error {
 		c.Logger().Errorf("Failed to make keysend split payments: %s", errResp.Message)
 		return c.JSON(errResp.HttpStatusCode, errResp)
 	}
+	errResp = controller.checkMultiKeysendFeeReserve(c, reqBody.Keysends, totalAmount, userID)
+	if errResp != nil {
+		c.Logger().Errorf("Failed to make keysend split payments: %s", errResp.Message)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+	if !confirmed && controller.svc.NeedsPaymentConfirmation(totalAmount) {
+		var reserve int64
+		for _, keysend := range reqBody.Keysends {
+			keysend := keysend
+			reserve += controller.keysendReserve(&keysend)
+		}
+		return requestBodyConfirmation(c, controller.svc, userID, common.PaymentConfirmationTypeMultiKeysend, reqBody, reserve, &PaymentConfirmationResponseBody{
+			Amount: totalAmount,
+		})
+	}
 	result := &MultiKeySendResponseBody{
 		Keysends: []KeySendResult{},
 	}
@@ -141,12 +187,16 @@ func (controller *KeySendController) MultiKeySend(c echo.Context) error {
 		res, err := controller.SingleKeySend(context.Background(), &keysend, userID)
 		if err != nil {
 			controller.svc.Logger.Errorf("Error making keysend split payment %v %s", keysend, err.Message)
-			result.Keysends = append(result.Keysends, KeySendResult{
-				Keysend: &KeySendResponseBody{
+			// the payment hash is known if the payment was attempted
+			if res == nil {
+				res = &KeySendResponseBody{
 					Destination:   keysend.Destination,
 					CustomRecords: keysend.CustomRecords,
-				},
-				Error: err,
+				}
+			}
+			result.Keysends = append(result.Keysends, KeySendResult{
+				Keysend: res,
+				Error:   err,
 			})
 			continue
 		}
@@ -162,6 +212,11 @@ func (controller *KeySendController) MultiKeySend(c echo.Context) error {
 	return c.JSON(status, result)
 }
 
+// keysendReserve is the balance that is reserved for a keysend payment waiting for its confirmation
+func (controller *KeySendController) keysendReserve(reqBody *KeySendRequestBody) int64 {
+	return controller.svc.PaymentReserve(reqBody.Destination, reqBody.Amount, controller.svc.CalcFeeLimit(reqBody.Destination, reqBody.Amount))
+}
+
 func (controller *KeySendController) checkKeysendPaymentAllowed(c echo.Context, amount, userID int64) (resp *responses.ErrorResponse) {
 	syntheticPayReq := &lnd.LNPayReq{
 		PayReq: &lnrpc.PayReq{
@@ -180,6 +235,30 @@ func (controller *KeySendController) checkKeysendPaymentAllowed(c echo.Context,
 	return nil
 }
 
+// checkMultiKeysendFeeReserve makes sure the balance also covers the fee reserve and the service fee of every single payment,
+// so that the batch is rejected before anything is sent
+func (controller *KeySendController) checkMultiKeysendFeeReserve(c echo.Context, keysends []KeySendRequestBody, totalAmount, userID int64) (resp *responses.ErrorResponse) {
+	minimumBalance := totalAmount
+	for _, keysend := range keysends {
+		if controller.svc.Config.FeeReserve {
+			minimumBalance += controller.svc.CalcFeeLimit(keysend.Destination, keysend.Amount)
+		}
+		minimumBalance += controller.svc.CalcServiceFee(keysend.Destination, keysend.Amount)
+	}
+	if minimumBalance == totalAmount {
+		return nil
+	}
+	currentBalance, err := controller.svc.CurrentUserBalance(c.Request().Context(), userID)
+	if err != nil {
+		controller.svc.Logger.Errorf("Error checking balance user_id:%v error: %v", userID, err)
+		return &responses.GeneralServerError
+	}
+	if currentBalance < minimumBalance {
+		return &responses.NotEnoughBalanceError
+	}
+	return nil
+}
+
 func (controller *KeySendController) SingleKeySend(ctx context.Context, reqBody *KeySendRequestBody, userID int64) (result *KeySendResponseBody, resp *responses.ErrorResponse) {
 	lnPayReq := &lnd.LNPayReq{
 		PayReq: &lnrpc.PayReq{
@@ -195,26 +274,24 @@ func (controller *KeySendController) SingleKeySend(ctx context.Context, reqBody
 	if reqBody.CustomRecords != nil {
 		customRecords = reqBody.CustomRecords
 	}
-	if controller.svc.LndClient.IsIdentityPubkey(reqBody.Destination) && customRecords[strconv.Itoa(service.TLV_WALLET_ID)] == "" {
+	if controller.svc.Config.DisableKeysendReceive && controller.svc.LndClient.IsIdentityPubkey(reqBody.Destination) {
+		return nil, &responses.KeysendReceiveDisabledError
+	}
+	if controller.svc.LndClient.IsIdentityPubkey(reqBody.Destination) && customRecords[strconv.Itoa(service.TLV_WALLET_ID)] == "" && customRecords[strconv.Itoa(service.TLV_KEYSEND_ALIAS)] == "" {
 		return nil, &responses.ErrorResponse{
 			Error:          true,
 			Code:           8,
-			Message:        fmt.Sprintf("Internal keysend payments require the custom record %d to be present.", service.TLV_WALLET_ID),
+			Message:        fmt.Sprintf("Internal keysend payments require the custom record %d or %d to be present.", service.TLV_WALLET_ID, service.TLV_KEYSEND_ALIAS),
 			HttpStatusCode: 400,
 		}
 	}
-	invoice, errResp := controller.svc.AddOutgoingInvoice(ctx, userID, "", lnPayReq)
-	if errResp != nil {
-		return nil, errResp
-	}
-	if _, err := hex.DecodeString(invoice.DestinationPubkeyHex); err != nil || len(invoice.DestinationPubkeyHex) != common.DestinationPubkeyHexSize {
-		controller.svc.Logger.Errorf("Invalid destination pubkey hex user_id:%v pubkey:%v", userID, len(invoice.DestinationPubkeyHex))
+	if _, err := hex.DecodeString(reqBody.Destination); err != nil || len(reqBody.Destination) != common.DestinationPubkeyHexSize {
+		controller.svc.Logger.Errorf("Invalid destination pubkey hex user_id:%v pubkey:%v", userID, len(reqBody.Destination))
 		return nil, &responses.InvalidDestinationError
 	}
-	invoice.DestinationCustomRecords = map[uint64][]byte{}
-
+	destinationCustomRecords := map[uint64][]byte{}
 	for key, value := range customRecords {
-		intKey, err := strconv.Atoi(key)
+		intKey, err := strconv.ParseUint(key, 10, 64)
 		if err != nil {
 			controller.svc.Logger.Errorj(
 				log.JSON{
@@ -225,17 +302,34 @@ func (controller *KeySendController) SingleKeySend(ctx context.Context, reqBody
 			)
 			return nil, &responses.BadArgumentsError
 		}
-		invoice.DestinationCustomRecords[uint64(intKey)] = []byte(value)
+		// lnd only accepts records in the custom range, the keysend preimage record is set by us.
+		// even records must be understood by the receiver, so payments with them can fail
+		if intKey < record.CustomTypeStart || intKey%2 == 0 || intKey == service.KEYSEND_CUSTOM_RECORD {
+			controller.svc.Logger.Errorf("Invalid custom record key user_id:%v key:%v", userID, intKey)
+			return nil, &responses.InvalidCustomRecordError
+		}
+		decodedValue, err := hex.DecodeString(value)
+		if err != nil {
+			controller.svc.Logger.Errorf("Invalid custom record value user_id:%v key:%v", userID, intKey)
+			return nil, &responses.InvalidCustomRecordValueError
+		}
+		destinationCustomRecords[intKey] = decodedValue
 	}
+	invoice, errResp := controller.svc.AddOutgoingInvoice(ctx, userID, "", lnPayReq)
+	if errResp != nil {
+		return nil, errResp
+	}
+	invoice.DestinationCustomRecords = destinationCustomRecords
 	sendPaymentResponse, err := controller.svc.PayInvoice(ctx, invoice)
 	if err != nil {
 		controller.svc.Logger.Errorf("Payment failed: user_id:%v error: %v", userID, err)
 		sentry.CaptureException(err)
-		return nil, &responses.ErrorResponse{
-			Error:   true,
-			Code:    10,
-			Message: err.Error(),
+		failedPayment := &KeySendResponseBody{
+			Destination:   reqBody.Destination,
+			CustomRecords: customRecords,
+			PaymentHash:   invoice.RHash,
 		}
+		return failedPayment, service.PaymentFailedError(err)
 	}
 
 	responseBody := &KeySendResponseBody{
@@ -0,0 +1,71 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// the amount limits are checked before the database is used, so no node and no database are needed
+func TestKeySendAmountLimits(t *testing.T) {
+	destination := strings.Repeat("02", 33)
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		message string
+	}{
+		{
+			name:    "below the minimum",
+			path:    "/v2/payments/keysend",
+			body:    `{"amount":5,"destination":"` + destination + `"}`,
+			message: "payment amount is below the minimum of 10 sats",
+		},
+		{
+			name:    "above the maximum",
+			path:    "/v2/payments/keysend",
+			body:    `{"amount":2000,"destination":"` + destination + `"}`,
+			message: "payment amount is above the maximum of 1000 sats",
+		},
+		{
+			name:    "one payment of a batch above the maximum",
+			path:    "/v2/payments/keysend/multi",
+			body:    `{"keysends":[{"amount":100,"destination":"` + destination + `"},{"amount":2000,"destination":"` + destination + `"}]}`,
+			message: "payment amount is above the maximum of 1000 sats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewKeySendController(&service.LndhubService{Config: &service.Config{MinPaymentSats: 10, MaxPaymentSats: 1000}})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			if tt.path == "/v2/payments/keysend/multi" {
+				assert.NoError(t, controller.MultiKeySend(c))
+			} else {
+				assert.NoError(t, controller.KeySend(c))
+			}
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.Equal(t, responses.BadArgumentsError.Code, errorResponse.Code)
+			assert.Equal(t, tt.message, errorResponse.Message)
+		})
+	}
+}
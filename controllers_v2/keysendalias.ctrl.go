@@ -0,0 +1,72 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// KeysendAliasController : KeysendAliasController struct
+type KeysendAliasController struct {
+	svc *service.LndhubService
+}
+
+func NewKeysendAliasController(svc *service.LndhubService) *KeysendAliasController {
+	return &KeysendAliasController{svc: svc}
+}
+
+type SetKeysendAliasRequestBody struct {
+	// an empty alias removes it
+	KeysendAlias string `json:"keysend_alias" validate:"max=32"`
+}
+
+type KeysendAliasResponseBody struct {
+	KeysendAlias string `json:"keysend_alias"`
+	// keysend payments to this node with the alias in the custom record are credited to the user
+	Pubkey       string `json:"pubkey"`
+	CustomRecord uint64 `json:"custom_record"`
+}
+
+// SetKeysendAlias godoc
+// @Summary      Set the keysend alias
+// @Description  Sets or changes the keysend alias of the user. Keysend payments to the node with the alias in the custom record 696971 are credited to the user.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        alias  body      SetKeysendAliasRequestBody  True  "Keysend alias"
+// @Success      200    {object}  KeysendAliasResponseBody
+// @Failure      400    {object}  responses.ErrorResponse
+// @Failure      500    {object}  responses.ErrorResponse
+// @Router       /v2/keysend/alias [put]
+// @Security     OAuth2Password
+func (controller *KeysendAliasController) SetKeysendAlias(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	var body SetKeysendAliasRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load keysend alias request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid keysend alias request body error: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	user, err := controller.svc.SetKeysendAlias(c.Request().Context(), userId, body.KeysendAlias)
+	if errors.Is(err, service.ErrInvalidKeysendAlias) {
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if errors.Is(err, service.ErrKeysendAliasTaken) {
+		return c.JSON(http.StatusBadRequest, responses.KeysendAliasTakenError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to set keysend alias user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &KeysendAliasResponseBody{
+		KeysendAlias: user.KeysendAlias.String,
+		Pubkey:       controller.svc.LndClient.GetMainPubkey(),
+		CustomRecord: service.TLV_KEYSEND_ALIAS,
+	})
+}
@@ -0,0 +1,49 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// these requests are rejected before the database is used, so no database is needed
+func TestSetKeysendAliasRejectedRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "invalid body", body: `{"keysend_alias":1}`},
+		{name: "alias too long", body: `{"keysend_alias":"` + strings.Repeat("a", 33) + `"}`},
+		{name: "invalid characters", body: `{"keysend_alias":"alice bob"}`},
+		{name: "lightning address", body: `{"keysend_alias":"alice@example.com"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewKeysendAliasController(&service.LndhubService{Config: &service.Config{}})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPut, "/v2/keysend/alias", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.SetKeysendAlias(c))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.Equal(t, responses.BadArgumentsError.Code, errorResponse.Code)
+		})
+	}
+}
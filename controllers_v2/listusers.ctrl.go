@@ -0,0 +1,92 @@
+package v2controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+const DefaultUsersLimit = 25
+
+// ListUsersController : List users controller struct
+type ListUsersController struct {
+	svc *service.LndhubService
+}
+
+func NewListUsersController(svc *service.LndhubService) *ListUsersController {
+	return &ListUsersController{svc: svc}
+}
+
+type ListUsersRequestParams struct {
+	Limit  int   `query:"limit" validate:"omitempty,gte=1,lte=100"`
+	Cursor int64 `query:"cursor" validate:"omitempty,gte=1"`
+}
+
+type UserWithBalance struct {
+	ID        int64     `json:"id"`
+	Login     string    `json:"login"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Balance   int64     `json:"balance"`
+}
+
+type ListUsersResponseBody struct {
+	Users      []UserWithBalance `json:"users"`
+	NextCursor int64             `json:"next_cursor,omitempty"`
+}
+
+// ListUsers godoc
+// @Summary      List accounts
+// @Description  Returns a page of accounts with their current balance, newest first. Pass next_cursor as cursor to get the next page. Requires Authorization header with admin token.
+// @Produce      json
+// @Tags         Account
+// @Param        limit        query     int     false  "Page size, defaults to 25 and at most 100"
+// @Param        cursor       query     int     false  "Cursor returned as next_cursor by the previous page"
+// @Param        X-Tenant-ID  header    string  false  "Only list the accounts of the tenant"
+// @Success      200          {object}  ListUsersResponseBody
+// @Failure      400          {object}  responses.ErrorResponse
+// @Failure      500          {object}  responses.ErrorResponse
+// @Router       /v2/admin/users [get]
+func (controller *ListUsersController) ListUsers(c echo.Context) error {
+	params := ListUsersRequestParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load list users request params: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&params); err != nil {
+		c.Logger().Errorf("Invalid list users request params error: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultUsersLimit
+	}
+	tenantID, err := service.AdminTenant(c)
+	if err != nil {
+		c.Logger().Errorf("Invalid list users tenant: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	users, nextCursor, err := controller.svc.GetUsersWithBalances(c.Request().Context(), tenantID, params.Limit, params.Cursor)
+	if err != nil {
+		c.Logger().Errorf("Failed to list users: %v", err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+
+	response := &ListUsersResponseBody{
+		Users:      make([]UserWithBalance, len(users)),
+		NextCursor: nextCursor,
+	}
+	for i, user := range users {
+		response.Users[i] = UserWithBalance{
+			ID:        user.ID,
+			Login:     user.Login,
+			TenantID:  user.TenantID,
+			CreatedAt: user.CreatedAt,
+			Balance:   user.Balance,
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,73 @@
+package v2controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// LNURLWithdrawController : LNURL-withdraw controller struct
+type LNURLWithdrawController struct {
+	svc *service.LndhubService
+}
+
+func NewLNURLWithdrawController(svc *service.LndhubService) *LNURLWithdrawController {
+	return &LNURLWithdrawController{svc: svc}
+}
+
+type CreateWithdrawLinkRequestBody struct {
+	MaxAmount int64 `json:"max_amount" validate:"required,gt=0"`
+}
+
+type CreateWithdrawLinkResponseBody struct {
+	Token string `json:"token"`
+	Url   string `json:"url"`
+	LNURL string `json:"lnurl"`
+}
+
+// CreateWithdrawLink godoc
+// @Summary      Create a withdraw link
+// @Description  Create a single-use LNURL-withdraw link that can be redeemed by another wallet for up to max_amount
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        CreateWithdrawLinkRequest  body      CreateWithdrawLinkRequestBody  True  "Maximum amount in satoshi"
+// @Success      200                        {object}  CreateWithdrawLinkResponseBody
+// @Failure      400                        {object}  responses.ErrorResponse
+// @Failure      500                        {object}  responses.ErrorResponse
+// @Router       /v2/lnurlw [post]
+// @Security     OAuth2Password
+func (controller *LNURLWithdrawController) CreateWithdrawLink(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	reqBody := CreateWithdrawLinkRequestBody{}
+	if err := c.Bind(&reqBody); err != nil {
+		c.Logger().Errorf("Failed to load create withdraw link request body: user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&reqBody); err != nil {
+		c.Logger().Errorf("Invalid create withdraw link request body user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	withdrawToken, err := controller.svc.CreateWithdrawToken(c.Request().Context(), userID, reqBody.MaxAmount)
+	if err != nil {
+		c.Logger().Errorf("Failed to create withdraw token user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	url := fmt.Sprintf("%s://%s/lnurlw/%s", c.Scheme(), c.Request().Host, withdrawToken.Token)
+	lnurl, err := service.EncodeLNURL(url)
+	if err != nil {
+		c.Logger().Errorf("Failed to encode lnurl user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+
+	return c.JSON(http.StatusOK, &CreateWithdrawLinkResponseBody{
+		Token: withdrawToken.Token,
+		Url:   url,
+		LNURL: lnurl,
+	})
+}
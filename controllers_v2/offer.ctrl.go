@@ -0,0 +1,46 @@
+package v2controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// OfferController : OfferController struct
+type OfferController struct {
+	svc *service.LndhubService
+}
+
+func NewOfferController(svc *service.LndhubService) *OfferController {
+	return &OfferController{svc: svc}
+}
+
+type OfferResponseBody struct {
+	OfferID string `json:"offer_id"`
+	Bolt12  string `json:"bolt12"`
+}
+
+// Offer godoc
+// @Summary      Retrieve a bolt12 offer
+// @Description  Returns the reusable bolt12 offer of the user. The offer can be paid any number of times with any amount, every payment is credited to the user.
+// @Accept       json
+// @Produce      json
+// @Tags         Invoice
+// @Success      200  {object}  OfferResponseBody
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/offers [get]
+// @Security     OAuth2Password
+func (controller *OfferController) Offer(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	offer, err := controller.svc.UserOffer(c.Request().Context(), userId)
+	if err != nil {
+		c.Logger().Errorf("Failed to get offer user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &OfferResponseBody{
+		OfferID: offer.OfferID,
+		Bolt12:  offer.Bolt12,
+	})
+}
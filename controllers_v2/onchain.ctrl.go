@@ -0,0 +1,171 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// OnchainController : OnchainController struct
+type OnchainController struct {
+	svc *service.LndhubService
+}
+
+func NewOnchainController(svc *service.LndhubService) *OnchainController {
+	return &OnchainController{svc: svc}
+}
+
+type OnchainAddressResponseBody struct {
+	Address string `json:"address"`
+	// deposits are credited after this number of confirmations
+	MinConfirmations int32 `json:"min_confirmations"`
+	// in sats, subtracted from every deposit
+	DepositFee int64 `json:"deposit_fee"`
+}
+
+// Address godoc
+// @Summary      Retrieve an on-chain deposit address
+// @Description  Returns an on-chain address of the user. Deposits are credited after ONCHAIN_MIN_CONFIRMATIONS confirmations minus the deposit fee. The same address is returned until it receives a deposit.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Success      200  {object}  OnchainAddressResponseBody
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/onchain/address [get]
+// @Security     OAuth2Password
+func (controller *OnchainController) Address(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	address, err := controller.svc.OnchainAddress(c.Request().Context(), userId)
+	if err != nil {
+		c.Logger().Errorf("Failed to get on-chain address user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &OnchainAddressResponseBody{
+		Address:          address.Address,
+		MinConfirmations: controller.svc.Config.OnchainMinConfirmations,
+		DepositFee:       controller.svc.Config.OnchainDepositFee,
+	})
+}
+
+type OnchainWithdrawRequestBody struct {
+	Address string `json:"address" validate:"required"`
+	Amount  int64  `json:"amount" validate:"required,gt=0"`
+	// overrides the estimated fee rate
+	SatPerVbyte uint64 `json:"sat_per_vbyte" validate:"omitempty,gt=0"`
+}
+
+type OnchainWithdrawResponseBody struct {
+	Txid    string `json:"txid"`
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+	// in sats, the fee of the published transaction
+	Fee         int64  `json:"fee"`
+	SatPerVbyte uint64 `json:"sat_per_vbyte"`
+}
+
+// Withdraw godoc
+// @Summary      Withdraw to an on-chain address
+// @Description  Sends the amount to an on-chain address of the network of the node. The fee of the transaction is paid by the user, the fee rate is estimated for ONCHAIN_WITHDRAWAL_TARGET_CONF blocks unless sat_per_vbyte is given. Withdrawals above CONFIRMATION_THRESHOLD_SATS return a confirmation token and are sent by /v2/payments/confirm.
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        OnchainWithdrawRequest  body      OnchainWithdrawRequestBody  True  "Address and amount"
+// @Success      200                     {object}  OnchainWithdrawResponseBody
+// @Success      202                     {object}  PaymentConfirmationResponseBody
+// @Failure      400                     {object}  responses.ErrorResponse
+// @Failure      500                     {object}  responses.ErrorResponse
+// @Router       /v2/onchain/withdraw [post]
+// @Security     OAuth2Password
+func (controller *OnchainController) Withdraw(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	reqBody := OnchainWithdrawRequestBody{}
+	if err := c.Bind(&reqBody); err != nil {
+		c.Logger().Errorf("Failed to load on-chain withdraw request body: user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&reqBody); err != nil {
+		c.Logger().Errorf("Invalid on-chain withdraw request body user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	return controller.withdraw(c, userId, &reqBody, false)
+}
+
+// withdraw checks the limits of the user and sends the withdrawal.
+// Withdrawals above the confirmation threshold are only sent if they are confirmed, otherwise a confirmation is created.
+func (controller *OnchainController) withdraw(c echo.Context, userId int64, reqBody *OnchainWithdrawRequestBody, confirmed bool) error {
+	if controller.svc.Config.MaxOnchainWithdrawal > 0 && reqBody.Amount > controller.svc.Config.MaxOnchainWithdrawal {
+		c.Logger().Errorf("Max on-chain withdrawal exceeded user_id:%v amount:%v", userId, reqBody.Amount)
+		return c.JSON(responses.OnchainWithdrawalExceededError.HttpStatusCode, responses.OnchainWithdrawalExceededError)
+	}
+
+	ctx := c.Request().Context()
+	err := controller.svc.ValidateOnchainAddress(ctx, reqBody.Address)
+	switch {
+	case errors.Is(err, service.ErrOnchainAddressWrongNetwork):
+		c.Logger().Errorf("Incorrect network user_id:%v address:%s", userId, reqBody.Address)
+		return c.JSON(http.StatusBadRequest, responses.IncorrectNetworkError)
+	case errors.Is(err, service.ErrInvalidOnchainAddress):
+		c.Logger().Errorf("Invalid on-chain address user_id:%v address:%s", userId, reqBody.Address)
+		return c.JSON(http.StatusBadRequest, responses.InvalidOnchainAddressError)
+	case err != nil:
+		c.Logger().Errorf("Failed to validate on-chain address user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+
+	fee, satPerVbyte, err := controller.svc.EstimateOnchainWithdrawalFee(ctx, reqBody.Address, reqBody.Amount, reqBody.SatPerVbyte)
+	if err != nil {
+		c.Logger().Errorf("Failed to estimate on-chain fee user_id:%v amount:%v error: %v", userId, reqBody.Amount, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	// the limits and the balance are checked like for a lightning payment of the amount and the fee
+	lnPayReq := &lnd.LNPayReq{PayReq: &lnrpc.PayReq{NumSatoshis: reqBody.Amount + fee}}
+	resp, err := controller.svc.CheckOutgoingPaymentAllowed(c, lnPayReq, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	if resp != nil {
+		c.Logger().Errorf("Error: %v user_id:%v amount:%v fee:%v", resp.Message, userId, reqBody.Amount, fee)
+		return c.JSON(resp.HttpStatusCode, resp)
+	}
+	resp, err = controller.svc.CheckDailyOutboundLimit(ctx, reqBody.Amount+fee, userId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	if resp != nil {
+		return c.JSON(resp.HttpStatusCode, resp)
+	}
+	// the fee is estimated again when the withdrawal is confirmed
+	if !confirmed && controller.svc.NeedsPaymentConfirmation(reqBody.Amount) {
+		return requestBodyConfirmation(c, controller.svc, userId, common.PaymentConfirmationTypeOnchain, reqBody, reqBody.Amount+fee, &PaymentConfirmationResponseBody{
+			Amount:      reqBody.Amount,
+			Destination: reqBody.Address,
+			FeeLimit:    fee,
+		})
+	}
+
+	withdrawal, err := controller.svc.WithdrawOnchain(ctx, userId, reqBody.Address, reqBody.Amount, fee, satPerVbyte)
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		c.Logger().Errorf("Not enough balance for on-chain withdrawal user_id:%v amount:%v fee:%v", userId, reqBody.Amount, fee)
+		return c.JSON(responses.NotEnoughBalanceError.HttpStatusCode, responses.NotEnoughBalanceError)
+	}
+	if errors.Is(err, service.ErrDailyLimitExceeded) {
+		return c.JSON(responses.DailyLimitExceededError.HttpStatusCode, responses.DailyLimitExceededError)
+	}
+	if err != nil {
+		c.Logger().Errorf("On-chain withdrawal failed user_id:%v amount:%v error: %v", userId, reqBody.Amount, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &OnchainWithdrawResponseBody{
+		Txid:        withdrawal.TxHash,
+		Address:     withdrawal.Address,
+		Amount:      withdrawal.Amount,
+		Fee:         withdrawal.Fee,
+		SatPerVbyte: satPerVbyte,
+	})
+}
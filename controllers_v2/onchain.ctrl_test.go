@@ -0,0 +1,107 @@
+package v2controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// these requests are rejected before the database is used, so no node and no database are needed
+func TestOnchainWithdrawRejectedRequests(t *testing.T) {
+	const regtestAddress = "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"
+	const mainnetAddress = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	tests := []struct {
+		name           string
+		body           string
+		config         service.Config
+		expectedStatus int
+		expectedError  *responses.ErrorResponse
+	}{
+		{
+			name:           "missing address",
+			body:           `{"amount":1000}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "missing amount",
+			body:           `{"address":"` + regtestAddress + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "negative amount",
+			body:           `{"address":"` + regtestAddress + `","amount":-1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "negative fee rate",
+			body:           `{"address":"` + regtestAddress + `","amount":1000,"sat_per_vbyte":-1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "amount above the maximum",
+			body:           `{"address":"` + regtestAddress + `","amount":100001}`,
+			config:         service.Config{MaxOnchainWithdrawal: 100000},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.OnchainWithdrawalExceededError,
+		},
+		{
+			name:           "invalid address",
+			body:           `{"address":"bcrt1qinvalid","amount":1000}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.InvalidOnchainAddressError,
+		},
+		{
+			name:           "address of another network",
+			body:           `{"address":"` + mainnetAddress + `","amount":1000}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.IncorrectNetworkError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &testutils.MockLightningClient{
+				Pubkey: "03ournode",
+				GetInfoFunc: func(ctx context.Context, req *lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+					return &lnrpc.GetInfoResponse{Chains: []*lnrpc.Chain{{Chain: "bitcoin", Network: "regtest"}}}, nil
+				},
+			}
+			config := tt.config
+			controller := NewOnchainController(&service.LndhubService{Config: &config, LndClient: mock})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, "/v2/onchain/withdraw", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.Withdraw(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.True(t, errorResponse.Error)
+			assert.Equal(t, tt.expectedError.Code, errorResponse.Code)
+			assert.Equal(t, tt.expectedError.Message, errorResponse.Message)
+			assert.Zero(t, mock.Calls("EstimateFee"))
+			assert.Zero(t, mock.Calls("SendCoins"))
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package v2controllers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
 	"github.com/getAlby/lndhub.go/lnd"
@@ -23,30 +30,64 @@ func NewPayInvoiceController(svc *service.LndhubService) *PayInvoiceController {
 	return &PayInvoiceController{svc: svc}
 }
 
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type PayInvoiceRequestBody struct {
-	Invoice string `json:"invoice" validate:"required"`
-	Amount  int64  `json:"amount" validate:"omitempty,gte=0"`
+	Invoice        string `json:"invoice" validate:"required"`
+	Amount         int64  `json:"amount" validate:"omitempty,gte=0"`
+	AmountMsat     int64  `json:"amount_msat" validate:"omitempty,gte=0"` // takes precedence over amount
+	TimeoutSeconds int64  `json:"timeout_seconds" validate:"omitempty,gt=0"`
+	MaxParts       uint32 `json:"max_parts" validate:"omitempty,gte=1,lte=16"`
+	// caps the routing fee, the server's fee limit is used if it is lower
+	FeeLimitSat     int64   `json:"fee_limit_sat" validate:"omitempty,gt=0"`
+	FeeLimitPercent float64 `json:"fee_limit_percent" validate:"omitempty,gt=0,lte=100"`
+	// stored with the payment to find it in the transactions, it is not sent to the destination
+	Label string `json:"label" validate:"omitempty,max=256"`
+	// required for accounts with two-factor authentication, a TOTP code or a backup code
+	TotpCode string `json:"totp_code"`
+	// only check the payment and estimate the fee, nothing is debited or sent
+	DryRun bool `json:"dry_run"`
 }
 type PayInvoiceResponseBody struct {
-	PaymentRequest  string `json:"payment_request,omitempty"`
-	Amount          int64  `json:"amount,omitempty"`
+	PaymentRequest string `json:"payment_request,omitempty"`
+	Amount         int64  `json:"amount,omitempty"`
+	// the routing fee and the service fee
 	Fee             int64  `json:"fee"`
+	RoutingFee      int64  `json:"routing_fee"`
+	ServiceFee      int64  `json:"service_fee"`
 	Description     string `json:"description,omitempty"`
 	DescriptionHash string `json:"description_hash,omitempty"`
 	Destination     string `json:"destination,omitempty"`
 	PaymentPreimage string `json:"payment_preimage,omitempty"`
 	PaymentHash     string `json:"payment_hash,omitempty"`
+	NumParts        int    `json:"num_parts"`
+	// how often the payment was sent to the node, failed payments can be retried on another route
+	PaymentAttempts int   `json:"payment_attempts"`
+	IsInternal      bool  `json:"is_internal"`
+	FeeLimit        int64 `json:"fee_limit,omitempty"`
+	// the amount of the invoice or the amount set by the client for a zero-amount invoice
+	RequestedAmount int64 `json:"requested_amount"`
+	// the amount received by the destination, the sum of the settled HTLCs without fees
+	SettledAmount int64  `json:"settled_amount"`
+	Label         string `json:"label,omitempty"`
+	// the payment was not sent, the fee is an estimate
+	DryRun bool `json:"dry_run,omitempty"`
+	// the estimated routing fee of a dry run is above the fee limit, the payment would likely fail
+	ExceedsFeeLimit bool `json:"exceeds_fee_limit,omitempty"`
 }
 
 // PayInvoice godoc
 // @Summary      Pay an invoice
-// @Description  Pay a bolt11 invoice
+// @Description  Pay a bolt11 invoice, payments above CONFIRMATION_THRESHOLD_SATS return a confirmation token and are sent by /v2/payments/confirm. With dry_run the payment is only checked and its fee estimated.
 // @Accept       json
 // @Produce      json
 // @Tags         Payment
 // @Param        PayInvoiceRequest  body      PayInvoiceRequestBody  True  "Invoice to pay"
+// @Param        Idempotency-Key    header    string                 False  "Key to safely retry the payment"
 // @Success      200                {object}  PayInvoiceResponseBody
+// @Success      202                {object}  PaymentConfirmationResponseBody
 // @Failure      400                {object}  responses.ErrorResponse
+// @Failure      409                {object}  responses.ErrorResponse
 // @Failure      500                {object}  responses.ErrorResponse
 // @Router       /v2/payments/bolt11 [post]
 // @Security     OAuth2Password
@@ -63,11 +104,33 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
 
+	idempotencyKey := c.Request().Header.Get(IdempotencyKeyHeader)
+	// a dry run doesn't use the key, the payment can be made with it afterwards
+	if reqBody.DryRun {
+		idempotencyKey = ""
+	}
+	requestHash := ""
+	if idempotencyKey != "" {
+		if len(idempotencyKey) > 255 {
+			c.Logger().Errorf("Invalid idempotency key user_id:%v", userID)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		requestHash = hashRequestBody(&reqBody)
+		existingInvoice, err := controller.svc.FindInvoiceByIdempotencyKey(c.Request().Context(), userID, idempotencyKey)
+		if err != nil {
+			c.Logger().Errorf("Failed to look up idempotency key user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+		}
+		if existingInvoice != nil {
+			return controller.replayPayment(c, existingInvoice, requestHash)
+		}
+	}
+
 	paymentRequest := reqBody.Invoice
 	paymentRequest = strings.ToLower(paymentRequest)
 	decodedPaymentRequest, err := controller.svc.DecodePaymentRequest(c.Request().Context(), paymentRequest)
 	if err != nil {
-		if strings.Contains(err.Error(), "invoice not for current active network") {
+		if errors.Is(err, service.ErrPaymentRequestWrongNetwork) || strings.Contains(err.Error(), "invoice not for current active network") {
 			c.Logger().Errorf("Incorrect network user_id:%v error: %v", userID, err)
 			return c.JSON(http.StatusBadRequest, responses.IncorrectNetworkError)
 		}
@@ -79,13 +142,22 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 		PayReq:  decodedPaymentRequest,
 		Keysend: false,
 	}
-	if (decodedPaymentRequest.Timestamp + decodedPaymentRequest.Expiry) < time.Now().Unix() {
+	if controller.svc.PaymentRequestExpired(decodedPaymentRequest) {
 		c.Logger().Errorf("Payment request expired")
 		return c.JSON(http.StatusBadRequest, responses.InvoiceExpiredError)
 	}
 
+	// the balances can't represent fractions of a satoshi
+	if decodedPaymentRequest.NumMsat%1000 != 0 {
+		c.Logger().Errorf("Payment request amount is not a whole number of satoshis user_id:%v amount_msat:%v", userID, decodedPaymentRequest.NumMsat)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
 	if decodedPaymentRequest.NumSatoshis == 0 {
 		amt, err := controller.svc.ParseInt(reqBody.Amount)
+		if reqBody.AmountMsat > 0 {
+			amt, err = controller.svc.ParseMsatAmount(reqBody.AmountMsat)
+		}
 		if err != nil || amt <= 0 {
 			c.Logger().Errorj(
 				log.JSON{
@@ -97,6 +169,27 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 		}
 		lnPayReq.PayReq.NumSatoshis = amt
+		lnPayReq.PayReq.NumMsat = amt * 1000
+	}
+	return controller.pay(c, userID, paymentRequest, lnPayReq, &reqBody, idempotencyKey, requestHash, false)
+}
+
+// pay checks the limits of the user, debits the balance and sends the payment of a decoded bolt11 or bolt12 invoice.
+// Payments above the confirmation threshold are only sent if they are confirmed, otherwise a confirmation is created.
+func (controller *PayInvoiceController) pay(c echo.Context, userID int64, paymentRequest string, lnPayReq *lnd.LNPayReq, reqBody *PayInvoiceRequestBody, idempotencyKey, requestHash string, confirmed bool) error {
+	if errResp := controller.svc.CheckPaymentAmount(lnPayReq.PayReq.NumSatoshis); errResp != nil {
+		c.Logger().Errorf("Invalid payment amount user_id:%v amount:%v error: %v", userID, lnPayReq.PayReq.NumSatoshis, errResp.Message)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+	feeLimit := controller.svc.CalcFeeLimit(lnPayReq.PayReq.Destination, lnPayReq.PayReq.NumSatoshis)
+	clientFeeLimit := reqBody.FeeLimitSat > 0 || reqBody.FeeLimitPercent > 0
+	if clientFeeLimit {
+		feeLimit = controller.svc.CalcClientFeeLimit(lnPayReq.PayReq.Destination, lnPayReq.PayReq.NumSatoshis, reqBody.FeeLimitSat, reqBody.FeeLimitPercent)
+		// payments to our own node and zero fee destinations don't need a fee
+		if feeLimit <= 0 && !controller.svc.IsZeroFeeDestination(lnPayReq.PayReq.Destination) {
+			c.Logger().Errorf("Fee limit is too low user_id:%v amount:%v fee_limit:%v", userID, lnPayReq.PayReq.NumSatoshis, feeLimit)
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
 	}
 	resp, err := controller.svc.CheckOutgoingPaymentAllowed(c, lnPayReq, userID)
 	if err != nil {
@@ -106,37 +199,228 @@ func (controller *PayInvoiceController) PayInvoice(c echo.Context) error {
 		c.Logger().Errorf("Error: %v user_id:%v amount:%v", resp.Message, userID, lnPayReq.PayReq.NumSatoshis)
 		return c.JSON(resp.HttpStatusCode, resp)
 	}
-	invoice, errResp := controller.svc.AddOutgoingInvoice(c.Request().Context(), userID, paymentRequest, lnPayReq)
-	if errResp != nil {
-		return c.JSON(errResp.HttpStatusCode, errResp)
+	resp, err = controller.svc.CheckDailyOutboundLimit(c.Request().Context(), lnPayReq.PayReq.NumSatoshis, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	if resp != nil {
+		return c.JSON(resp.HttpStatusCode, resp)
+	}
+	// the bolt11 endpoint checks the code here, after the idempotency lookup, so that a retry doesn't use up another code
+	if checked, _ := c.Get(service.TOTPCheckedKey).(bool); !checked && !confirmed {
+		if err := controller.svc.CheckTOTP(c.Request().Context(), userID, reqBody.TotpCode); err != nil {
+			return service.RespondTOTPError(c, userID, err)
+		}
+	}
+	if reqBody.DryRun {
+		return controller.dryRun(c, userID, paymentRequest, lnPayReq, reqBody, feeLimit, clientFeeLimit)
+	}
+	if !confirmed && controller.svc.NeedsPaymentConfirmation(lnPayReq.PayReq.NumSatoshis) {
+		return controller.requestConfirmation(c, userID, paymentRequest, lnPayReq, reqBody, feeLimit)
+	}
+	var invoice *models.Invoice
+	if idempotencyKey != "" {
+		// stored before the payment so that a retry finds the key, also if the payment is rejected
+		var errResp *responses.ErrorResponse
+		invoice, errResp = controller.svc.AddIdempotentOutgoingInvoice(c.Request().Context(), userID, paymentRequest, lnPayReq, idempotencyKey, requestHash, reqBody.Label)
+		if errResp != nil {
+			// a concurrent request with the same key stored its invoice first, it is answered with the outcome of that payment
+			existingInvoice, err := controller.svc.FindInvoiceByIdempotencyKey(c.Request().Context(), userID, idempotencyKey)
+			if err == nil && existingInvoice != nil {
+				return controller.replayPayment(c, existingInvoice, requestHash)
+			}
+			return c.JSON(errResp.HttpStatusCode, errResp)
+		}
+	} else {
+		// stored by PayInvoice together with the debit
+		invoice, err = controller.svc.NewOutgoingInvoice(userID, paymentRequest, lnPayReq, reqBody.Label)
+		if err != nil {
+			c.Logger().Errorf("Failed to create outgoing invoice user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+		}
+	}
+	invoice.MaxParts = 1
+	if reqBody.MaxParts > 0 {
+		invoice.MaxParts = reqBody.MaxParts
+	}
+	if clientFeeLimit {
+		invoice.FeeLimit = feeLimit
+	}
+	payCtx := c.Request().Context()
+	timeout := controller.svc.Config.DefaultPaymentTimeout
+	if reqBody.TimeoutSeconds > 0 {
+		timeout = reqBody.TimeoutSeconds
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		payCtx, cancel = context.WithTimeout(payCtx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	sendPaymentResponse, err := controller.svc.PayInvoice(payCtx, invoice)
+	if errors.Is(err, service.PaymentTimeoutError) {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":         "payment timed out",
+				"user_id":         userID,
+				"invoice_id":      invoice.ID,
+				"payment_hash":    invoice.RHash,
+				"payment_request": controller.svc.RedactPaymentRequest(invoice.PaymentRequest),
+				"timeout":         timeout,
+			},
+		)
+		return c.JSON(responses.PaymentTimeoutError.HttpStatusCode, responses.PaymentTimeoutError)
+	}
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		c.Logger().Errorf("Not enough balance for payment user_id:%v invoice_id:%v", userID, invoice.ID)
+		return c.JSON(responses.NotEnoughBalanceError.HttpStatusCode, responses.NotEnoughBalanceError)
+	}
+	if errors.Is(err, service.ErrDailyLimitExceeded) {
+		return c.JSON(responses.DailyLimitExceededError.HttpStatusCode, responses.DailyLimitExceededError)
 	}
-	sendPaymentResponse, err := controller.svc.PayInvoice(c.Request().Context(), invoice)
 	if err != nil {
-		c.Logger().Errorf("Payment failed invoice_id:%v user_id:%v error: %v", invoice.ID, userID, err)
+		c.Logger().Errorj(
+			log.JSON{
+				"message":         "payment failed",
+				"error":           err,
+				"user_id":         userID,
+				"invoice_id":      invoice.ID,
+				"payment_hash":    invoice.RHash,
+				"payment_request": controller.svc.RedactPaymentRequest(invoice.PaymentRequest),
+			},
+		)
 		if hub := sentryecho.GetHubFromContext(c); hub != nil {
 			hub.WithScope(func(scope *sentry.Scope) {
 				scope.SetExtra("invoice_id", invoice.ID)
 				scope.SetExtra("destination_pubkey_hex", invoice.DestinationPubkeyHex)
-				scope.SetExtra("payment_request", invoice.PaymentRequest)
+				scope.SetExtra("payment_request", controller.svc.RedactPaymentRequest(invoice.PaymentRequest))
 				hub.CaptureException(err)
 			})
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   true,
-			"code":    10,
-			"message": err.Error(),
-		})
+		errResp := service.PaymentFailedError(err)
+		return c.JSON(errResp.HttpStatusCode, errResp)
 	}
 	responseBody := &PayInvoiceResponseBody{
 		PaymentRequest:  paymentRequest,
 		Amount:          sendPaymentResponse.PaymentRoute.TotalAmt,
-		Fee:             sendPaymentResponse.PaymentRoute.TotalFees,
+		Fee:             sendPaymentResponse.PaymentRoute.TotalFees + invoice.ServiceFee,
+		RoutingFee:      sendPaymentResponse.PaymentRoute.TotalFees,
+		ServiceFee:      invoice.ServiceFee,
 		Description:     invoice.Memo,
 		DescriptionHash: invoice.DescriptionHash,
 		Destination:     invoice.DestinationPubkeyHex,
 		PaymentPreimage: sendPaymentResponse.PaymentPreimageStr,
 		PaymentHash:     sendPaymentResponse.PaymentHashStr,
+		NumParts:        sendPaymentResponse.NumParts,
+		PaymentAttempts: invoice.PaymentAttempts,
+		IsInternal:      sendPaymentResponse.Internal,
+		FeeLimit:        feeLimit,
+		RequestedAmount: invoice.Amount,
+		SettledAmount:   sendPaymentResponse.SettledAmount,
+		Label:           invoice.Label,
 	}
 
 	return c.JSON(http.StatusOK, responseBody)
 }
+
+// dryRun answers with the response of the payment without storing the invoice, debiting the user or sending it
+func (controller *PayInvoiceController) dryRun(c echo.Context, userID int64, paymentRequest string, lnPayReq *lnd.LNPayReq, reqBody *PayInvoiceRequestBody, feeLimit int64, clientFeeLimit bool) error {
+	invoice, err := controller.svc.NewOutgoingInvoice(userID, paymentRequest, lnPayReq, reqBody.Label)
+	if err != nil {
+		c.Logger().Errorf("Failed to create outgoing invoice user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	if clientFeeLimit {
+		invoice.FeeLimit = feeLimit
+	}
+	dryRunResponse, err := controller.svc.DryRunPayment(c.Request().Context(), invoice)
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		c.Logger().Errorf("Not enough balance for dry run user_id:%v amount:%v", userID, invoice.Amount)
+		return c.JSON(responses.NotEnoughBalanceError.HttpStatusCode, responses.NotEnoughBalanceError)
+	}
+	if errors.Is(err, service.ErrInsufficientNodeLiquidity) {
+		errResp := service.PaymentFailedError(err)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	}
+	if err != nil {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "dry run failed",
+				"error":          err,
+				"lndhub_user_id": userID,
+				"destination":    invoice.DestinationPubkeyHex,
+			},
+		)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &PayInvoiceResponseBody{
+		PaymentRequest:  paymentRequest,
+		Amount:          invoice.Amount + dryRunResponse.RoutingFee,
+		Fee:             dryRunResponse.RoutingFee + dryRunResponse.ServiceFee,
+		RoutingFee:      dryRunResponse.RoutingFee,
+		ServiceFee:      dryRunResponse.ServiceFee,
+		Description:     invoice.Memo,
+		DescriptionHash: invoice.DescriptionHash,
+		Destination:     invoice.DestinationPubkeyHex,
+		PaymentHash:     invoice.RHash,
+		IsInternal:      dryRunResponse.Internal,
+		FeeLimit:        dryRunResponse.FeeLimit,
+		RequestedAmount: invoice.Amount,
+		Label:           invoice.Label,
+		DryRun:          true,
+		ExceedsFeeLimit: dryRunResponse.ExceedsFeeLimit,
+	})
+}
+
+// replayPayment answers a retried request with the outcome of the payment that was made for the idempotency key,
+// a payment that is still in progress is waited for up to IDEMPOTENCY_WAIT_TIMEOUT
+func (controller *PayInvoiceController) replayPayment(c echo.Context, invoice *models.Invoice, requestHash string) error {
+	if invoice.IdempotencyHash != requestHash {
+		c.Logger().Errorf("Idempotency key reused with a different request invoice_id:%v user_id:%v", invoice.ID, invoice.UserID)
+		return c.JSON(responses.IdempotencyKeyConflictError.HttpStatusCode, responses.IdempotencyKeyConflictError)
+	}
+	invoice, err := controller.svc.WaitForIdempotentPayment(c.Request().Context(), invoice)
+	if err != nil {
+		c.Logger().Errorf("Failed to wait for the payment of the idempotency key invoice_id:%v user_id:%v error: %v", invoice.ID, invoice.UserID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	switch invoice.State {
+	case common.InvoiceStateSettled:
+		return c.JSON(http.StatusOK, &PayInvoiceResponseBody{
+			PaymentRequest:  invoice.PaymentRequest,
+			Amount:          invoice.Amount + invoice.Fee,
+			Fee:             invoice.Fee + invoice.ServiceFee,
+			RoutingFee:      invoice.Fee,
+			ServiceFee:      invoice.ServiceFee,
+			Description:     invoice.Memo,
+			DescriptionHash: invoice.DescriptionHash,
+			Destination:     invoice.DestinationPubkeyHex,
+			PaymentPreimage: invoice.Preimage,
+			PaymentHash:     invoice.RHash,
+			IsInternal:      invoice.Internal,
+			PaymentAttempts: invoice.PaymentAttempts,
+			RequestedAmount: invoice.Amount,
+			SettledAmount:   invoice.Amount,
+			Label:           invoice.Label,
+		})
+	case common.InvoiceStateError, common.InvoiceStateAborted:
+		// the same response as for the first request
+		err := service.StoredPaymentError(invoice.ErrorMessage)
+		if errors.Is(err, service.ErrNotEnoughBalance) {
+			return c.JSON(responses.NotEnoughBalanceError.HttpStatusCode, responses.NotEnoughBalanceError)
+		}
+		errResp := service.PaymentFailedError(err)
+		return c.JSON(errResp.HttpStatusCode, errResp)
+	default:
+		return c.JSON(responses.IdempotencyKeyInProgressError.HttpStatusCode, responses.IdempotencyKeyInProgressError)
+	}
+}
+
+// hashRequestBody identifies the payment of a request, the totp code differs between retries and is left out
+func hashRequestBody(reqBody *PayInvoiceRequestBody) string {
+	hashed := *reqBody
+	hashed.TotpCode = ""
+	hashed.DryRun = false
+	body, _ := json.Marshal(&hashed)
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
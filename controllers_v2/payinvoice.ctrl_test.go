@@ -0,0 +1,232 @@
+package v2controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// these requests are rejected before the database is used, so no node and no database are needed
+func TestPayInvoiceRejectedRequests(t *testing.T) {
+	validPayReq := func() *lnrpc.PayReq {
+		return &lnrpc.PayReq{
+			NumSatoshis: 100,
+			NumMsat:     100000,
+			Destination: "02destination",
+			Timestamp:   time.Now().Unix(),
+			Expiry:      3600,
+		}
+	}
+	tests := []struct {
+		name           string
+		body           string
+		config         service.Config
+		network        string
+		decode         func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error)
+		expectedStatus int
+		expectedError  *responses.ErrorResponse
+	}{
+		{
+			name:           "missing invoice",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name: "invalid invoice",
+			body: `{"invoice":"lnbcinvalid"}`,
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				return nil, errors.New("invalid payment request")
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name: "invoice of another network",
+			body: `{"invoice":"lntb1"}`,
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				return nil, errors.New("invoice not for current active network 'mainnet'")
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.IncorrectNetworkError,
+		},
+		{
+			name:           "testnet invoice on a mainnet node",
+			body:           `{"invoice":"lntb10u1pjexample"}`,
+			network:        "mainnet",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.IncorrectNetworkError,
+		},
+		{
+			name:           "mainnet invoice on a regtest node",
+			body:           `{"invoice":"LNBC10U1PJEXAMPLE"}`,
+			network:        "regtest",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.IncorrectNetworkError,
+		},
+		{
+			name: "expired invoice",
+			body: `{"invoice":"lnbc1"}`,
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				payReq := validPayReq()
+				payReq.Timestamp = time.Now().Add(-2 * time.Hour).Unix()
+				return payReq, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.InvoiceExpiredError,
+		},
+		{
+			name:   "expired invoice beyond the clock skew grace",
+			body:   `{"invoice":"lnbc1"}`,
+			config: service.Config{InvoiceExpiryGrace: 60},
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				payReq := validPayReq()
+				payReq.Timestamp = time.Now().Add(-2 * time.Hour).Unix()
+				return payReq, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.InvoiceExpiredError,
+		},
+		{
+			// not rejected as expired, but for the amount which is checked next
+			name:   "expired invoice within the clock skew grace",
+			body:   `{"invoice":"lnbc1"}`,
+			config: service.Config{InvoiceExpiryGrace: 60, MinPaymentSats: 1000},
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				payReq := validPayReq()
+				payReq.Timestamp = time.Now().Add(-3600*time.Second - 30*time.Second).Unix()
+				return payReq, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError: &responses.ErrorResponse{
+				Code:    responses.BadArgumentsError.Code,
+				Message: "payment amount is below the minimum of 1000 sats",
+			},
+		},
+		{
+			name: "fractional satoshi amount",
+			body: `{"invoice":"lnbc1"}`,
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				payReq := validPayReq()
+				payReq.NumMsat = 100500
+				return payReq, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name: "zero amount invoice without amount",
+			body: `{"invoice":"lnbc1"}`,
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				payReq := validPayReq()
+				payReq.NumSatoshis = 0
+				payReq.NumMsat = 0
+				return payReq, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:   "amount below the minimum",
+			body:   `{"invoice":"lnbc1"}`,
+			config: service.Config{MinPaymentSats: 1000},
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				return validPayReq(), nil
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "client fee limit below one sat",
+			body:   `{"invoice":"lnbc1","fee_limit_percent":0.5}`,
+			config: service.Config{MaxFeeAmount: 1000},
+			decode: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				return validPayReq(), nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "label too long",
+			body:           `{"invoice":"lnbc1","label":"` + strings.Repeat("a", 257) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "truncated body",
+			body:           `{"invoice":"lnbc1`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "invoice too long",
+			body:           `{"invoice":"lnbc1` + strings.Repeat("q", service.MaxPaymentRequestLength) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "negative client fee limit",
+			body:           `{"invoice":"lnbc1","fee_limit_sat":-1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &testutils.MockLightningClient{Pubkey: "03ournode", DecodeBolt11Func: tt.decode}
+			if tt.network != "" {
+				mock.GetInfoFunc = func(ctx context.Context, req *lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+					return &lnrpc.GetInfoResponse{Chains: []*lnrpc.Chain{{Chain: "bitcoin", Network: tt.network}}}, nil
+				}
+			}
+			config := tt.config
+			controller := NewPayInvoiceController(&service.LndhubService{Config: &config, LndClient: mock})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.PayInvoice(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.True(t, errorResponse.Error)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError.Code, errorResponse.Code)
+				assert.Equal(t, tt.expectedError.Message, errorResponse.Message)
+			}
+			if tt.decode == nil {
+				// rejected before the node is asked to decode the invoice
+				assert.Zero(t, mock.Calls("DecodeBolt11"))
+			}
+			assert.Zero(t, mock.Calls("SendPaymentSync"))
+			assert.Zero(t, mock.Calls("SendPaymentV2"))
+		})
+	}
+}
+
+func TestHashRequestBodyWithoutTOTPCode(t *testing.T) {
+	reqBody := &PayInvoiceRequestBody{Invoice: "lnbc1", TotpCode: "123456"}
+	retried := &PayInvoiceRequestBody{Invoice: "lnbc1", TotpCode: "654321"}
+	assert.Equal(t, hashRequestBody(reqBody), hashRequestBody(retried))
+	assert.NotEqual(t, hashRequestBody(reqBody), hashRequestBody(&PayInvoiceRequestBody{Invoice: "lnbc2", TotpCode: "123456"}))
+	assert.Equal(t, "123456", reqBody.TotpCode)
+}
@@ -0,0 +1,75 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/labstack/echo/v4"
+)
+
+type PayLightningAddressRequestBody struct {
+	Address string `json:"address" validate:"required,max=320"`
+	Amount  int64  `json:"amount" validate:"required,gt=0"`
+	// sent to the recipient, the length is limited by the recipient
+	Comment         string  `json:"comment" validate:"omitempty,max=2000"`
+	TimeoutSeconds  int64   `json:"timeout_seconds" validate:"omitempty,gt=0"`
+	FeeLimitSat     int64   `json:"fee_limit_sat" validate:"omitempty,gt=0"`
+	FeeLimitPercent float64 `json:"fee_limit_percent" validate:"omitempty,gt=0,lte=100"`
+	Label           string  `json:"label" validate:"omitempty,max=256"`
+}
+
+// PayLightningAddress godoc
+// @Summary      Pay a lightning address
+// @Description  Request an invoice from the LNURL-pay endpoint of a lightning address and pay it. Failures to get the invoice have the error code 17.
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        PayLightningAddressRequest  body      PayLightningAddressRequestBody  True  "Lightning address to pay"
+// @Success      200                         {object}  PayInvoiceResponseBody
+// @Success      202                         {object}  PaymentConfirmationResponseBody
+// @Failure      400                         {object}  responses.ErrorResponse
+// @Failure      500                         {object}  responses.ErrorResponse
+// @Router       /v2/payments/lnaddress [post]
+// @Security     OAuth2Password
+func (controller *PayInvoiceController) PayLightningAddress(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	reqBody := PayLightningAddressRequestBody{}
+	if err := c.Bind(&reqBody); err != nil {
+		c.Logger().Errorf("Failed to load paylnaddress request body: user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&reqBody); err != nil {
+		c.Logger().Errorf("Invalid paylnaddress request body user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	paymentRequest, payReq, err := controller.svc.ResolveLightningAddress(c.Request().Context(), reqBody.Address, reqBody.Amount*1000, reqBody.Comment)
+	if err != nil {
+		c.Logger().Errorf("Failed to resolve lightning address user_id:%v address:%s error: %v", userID, reqBody.Address, err)
+		if errors.Is(err, service.ErrPaymentRequestWrongNetwork) {
+			return c.JSON(http.StatusBadRequest, responses.IncorrectNetworkError)
+		}
+		return c.JSON(responses.LightningAddressResolutionError.HttpStatusCode, responses.ErrorResponse{
+			Error:   true,
+			Code:    responses.LightningAddressResolutionError.Code,
+			Message: err.Error(),
+		})
+	}
+
+	if controller.svc.PaymentRequestExpired(payReq) {
+		c.Logger().Errorf("Payment request of lightning address expired user_id:%v address:%s", userID, reqBody.Address)
+		return c.JSON(http.StatusBadRequest, responses.InvoiceExpiredError)
+	}
+	lnPayReq := &lnd.LNPayReq{
+		PayReq: payReq,
+	}
+	return controller.pay(c, userID, paymentRequest, lnPayReq, &PayInvoiceRequestBody{
+		TimeoutSeconds:  reqBody.TimeoutSeconds,
+		FeeLimitSat:     reqBody.FeeLimitSat,
+		FeeLimitPercent: reqBody.FeeLimitPercent,
+		Label:           reqBody.Label,
+	}, "", "", false)
+}
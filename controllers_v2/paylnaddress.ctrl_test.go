@@ -0,0 +1,44 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// failures to resolve the address have their own error code, so they can be told apart from failed payments
+func TestPayLightningAddressResolutionError(t *testing.T) {
+	mock := &testutils.MockLightningClient{}
+	controller := NewPayInvoiceController(&service.LndhubService{Config: &service.Config{}, LndClient: mock})
+	e := echo.New()
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+
+	for body, expectedCode := range map[string]int{
+		`{"address":"alice@example.com"}`:                 responses.BadArgumentsError.Code,
+		`{"address":"not an address","amount":21}`:        responses.LightningAddressResolutionError.Code,
+		`{"address":"alice@example.com/path","amount":1}`: responses.LightningAddressResolutionError.Code,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v2/payments/lnaddress", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("UserID", int64(1))
+		assert.NoError(t, controller.PayLightningAddress(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		errorResponse := &responses.ErrorResponse{}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+		assert.Equal(t, expectedCode, errorResponse.Code, body)
+	}
+	assert.Zero(t, mock.Calls("DecodeBolt11"))
+	assert.Zero(t, mock.Calls("SendPaymentSync"))
+}
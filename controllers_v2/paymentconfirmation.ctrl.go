@@ -0,0 +1,176 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// PaymentConfirmationResponseBody is returned instead of sending payments above the confirmation threshold
+type PaymentConfirmationResponseBody struct {
+	ConfirmationToken string    `json:"confirmation_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	// bolt11, keysend, keysend_multi or onchain
+	PaymentType     string `json:"payment_type"`
+	PaymentRequest  string `json:"payment_request,omitempty"`
+	PaymentHash     string `json:"payment_hash,omitempty"`
+	Amount          int64  `json:"amount"`
+	Description     string `json:"description,omitempty"`
+	DescriptionHash string `json:"description_hash,omitempty"`
+	// the node of a payment or the address of an on-chain withdrawal
+	Destination string `json:"destination,omitempty"`
+	// the routing fee limit of a lightning payment or the estimated fee of an on-chain withdrawal
+	FeeLimit int64 `json:"fee_limit,omitempty"`
+	// the balance that is reserved for the payment until it is confirmed or the token expired
+	ReservedAmount int64 `json:"reserved_amount"`
+}
+
+type ConfirmPaymentRequestBody struct {
+	ConfirmationToken string `json:"confirmation_token" validate:"required"`
+}
+
+// requestConfirmation stores the payment and returns its details with the token to confirm it
+func (controller *PayInvoiceController) requestConfirmation(c echo.Context, userID int64, paymentRequest string, lnPayReq *lnd.LNPayReq, reqBody *PayInvoiceRequestBody, feeLimit int64) error {
+	confirmation := &models.PaymentConfirmation{
+		UserID:          userID,
+		PaymentType:     common.PaymentConfirmationTypeBolt11,
+		PaymentRequest:  paymentRequest,
+		MaxParts:        reqBody.MaxParts,
+		FeeLimitSat:     reqBody.FeeLimitSat,
+		FeeLimitPercent: reqBody.FeeLimitPercent,
+		TimeoutSeconds:  reqBody.TimeoutSeconds,
+		Label:           reqBody.Label,
+		Amount:          controller.svc.PaymentReserve(lnPayReq.PayReq.Destination, lnPayReq.PayReq.NumSatoshis, feeLimit),
+	}
+	return createConfirmation(c, controller.svc, confirmation, lnPayReq, &PaymentConfirmationResponseBody{
+		PaymentRequest:  paymentRequest,
+		PaymentHash:     lnPayReq.PayReq.PaymentHash,
+		Amount:          lnPayReq.PayReq.NumSatoshis,
+		Description:     lnPayReq.PayReq.Description,
+		DescriptionHash: lnPayReq.PayReq.DescriptionHash,
+		Destination:     lnPayReq.PayReq.Destination,
+		FeeLimit:        feeLimit,
+	})
+}
+
+// createConfirmation reserves the amount of the confirmation and answers with the details of the payment
+// and the token to confirm it. Keysend payments and on-chain withdrawals store their request body to send
+// them the same way once they are confirmed.
+func createConfirmation(c echo.Context, svc *service.LndhubService, confirmation *models.PaymentConfirmation, lnPayReq *lnd.LNPayReq, response *PaymentConfirmationResponseBody) error {
+	err := svc.CreatePaymentConfirmation(c.Request().Context(), confirmation, lnPayReq)
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		return c.JSON(responses.NotEnoughBalanceError.HttpStatusCode, responses.NotEnoughBalanceError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to create payment confirmation user_id:%v error: %v", confirmation.UserID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response.ConfirmationToken = confirmation.Token
+	response.ExpiresAt = confirmation.ExpiresAt
+	response.PaymentType = confirmation.PaymentType
+	response.ReservedAmount = confirmation.Amount
+	return c.JSON(http.StatusAccepted, response)
+}
+
+// requestBodyConfirmation stores a keysend payment or an on-chain withdrawal with its request body
+func requestBodyConfirmation(c echo.Context, svc *service.LndhubService, userID int64, paymentType string, reqBody interface{}, reservedAmount int64, response *PaymentConfirmationResponseBody) error {
+	request, err := json.Marshal(reqBody)
+	if err != nil {
+		c.Logger().Errorf("Failed to store payment confirmation request user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	confirmation := &models.PaymentConfirmation{
+		UserID:      userID,
+		PaymentType: paymentType,
+		Request:     request,
+		Amount:      reservedAmount,
+	}
+	lnPayReq := &lnd.LNPayReq{
+		PayReq:  &lnrpc.PayReq{Destination: response.Destination, NumSatoshis: response.Amount},
+		Keysend: paymentType != common.PaymentConfirmationTypeOnchain,
+	}
+	return createConfirmation(c, svc, confirmation, lnPayReq, response)
+}
+
+// ConfirmPayment godoc
+// @Summary      Confirm a payment
+// @Description  Sends a payment above CONFIRMATION_THRESHOLD_SATS with the token returned by the payment endpoint, the token is valid for CONFIRMATION_TIMEOUT seconds. Keysend payments return the keysend response and on-chain withdrawals the withdrawal response.
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        ConfirmPaymentRequest  body      ConfirmPaymentRequestBody  True  "Confirmation token"
+// @Success      200                    {object}  PayInvoiceResponseBody
+// @Failure      400                    {object}  responses.ErrorResponse
+// @Failure      404                    {object}  responses.ErrorResponse
+// @Failure      500                    {object}  responses.ErrorResponse
+// @Router       /v2/payments/confirm [post]
+// @Security     OAuth2Password
+func (controller *PayInvoiceController) ConfirmPayment(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	reqBody := ConfirmPaymentRequestBody{}
+	if err := c.Bind(&reqBody); err != nil {
+		c.Logger().Errorf("Failed to load confirm payment request body: user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&reqBody); err != nil {
+		c.Logger().Errorf("Invalid confirm payment request body user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	confirmation, lnPayReq, err := controller.svc.ClaimPaymentConfirmation(c.Request().Context(), userID, reqBody.ConfirmationToken)
+	if errors.Is(err, service.ErrPaymentConfirmationNotFound) {
+		return c.JSON(responses.PaymentConfirmationNotFoundError.HttpStatusCode, responses.PaymentConfirmationNotFoundError)
+	}
+	if errors.Is(err, service.ErrPaymentConfirmationExpired) {
+		c.Logger().Errorf("Payment confirmation expired user_id:%v", userID)
+		return c.JSON(responses.PaymentConfirmationExpiredError.HttpStatusCode, responses.PaymentConfirmationExpiredError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to claim payment confirmation user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	// the limits and the balance are checked again, they could have changed since the payment was requested
+	switch confirmation.PaymentType {
+	case common.PaymentConfirmationTypeKeysend:
+		reqBody := KeySendRequestBody{}
+		if err := json.Unmarshal(confirmation.Request, &reqBody); err != nil {
+			c.Logger().Errorf("Failed to load confirmed keysend user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+		}
+		return NewKeySendController(controller.svc).keySend(c, userID, &reqBody, true)
+	case common.PaymentConfirmationTypeMultiKeysend:
+		reqBody := MultiKeySendRequestBody{}
+		if err := json.Unmarshal(confirmation.Request, &reqBody); err != nil {
+			c.Logger().Errorf("Failed to load confirmed keysend user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+		}
+		return NewKeySendController(controller.svc).multiKeySend(c, userID, &reqBody, true)
+	case common.PaymentConfirmationTypeOnchain:
+		reqBody := OnchainWithdrawRequestBody{}
+		if err := json.Unmarshal(confirmation.Request, &reqBody); err != nil {
+			c.Logger().Errorf("Failed to load confirmed on-chain withdrawal user_id:%v error: %v", userID, err)
+			return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+		}
+		return NewOnchainController(controller.svc).withdraw(c, userID, &reqBody, true)
+	}
+	if controller.svc.PaymentRequestExpired(lnPayReq.PayReq) {
+		c.Logger().Errorf("Payment request of confirmed payment expired user_id:%v", userID)
+		return c.JSON(http.StatusBadRequest, responses.InvoiceExpiredError)
+	}
+	return controller.pay(c, userID, confirmation.PaymentRequest, lnPayReq, &PayInvoiceRequestBody{
+		MaxParts:        confirmation.MaxParts,
+		TimeoutSeconds:  confirmation.TimeoutSeconds,
+		FeeLimitSat:     confirmation.FeeLimitSat,
+		FeeLimitPercent: confirmation.FeeLimitPercent,
+		Label:           confirmation.Label,
+	}, "", "", true)
+}
@@ -0,0 +1,124 @@
+package v2controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// PaymentRouteController : Payment route controller struct
+type PaymentRouteController struct {
+	svc *service.LndhubService
+}
+
+func NewPaymentRouteController(svc *service.LndhubService) *PaymentRouteController {
+	return &PaymentRouteController{svc: svc}
+}
+
+type PaymentRouteResponseBody struct {
+	PaymentHash string `json:"payment_hash"`
+	// the state of the payment on the node: in_flight, succeeded or failed
+	Status        string                `json:"status"`
+	FailureReason string                `json:"failure_reason,omitempty"`
+	Attempts      []PaymentRouteAttempt `json:"attempts"`
+}
+
+// PaymentRouteAttempt is a part of the payment that was sent along a route
+type PaymentRouteAttempt struct {
+	// in_flight, succeeded or failed
+	Status        string             `json:"status"`
+	TotalAmtMsat  int64              `json:"total_amt_msat"`
+	TotalFeesMsat int64              `json:"total_fees_msat"`
+	Hops          []PaymentRouteHop  `json:"hops"`
+	Failure       *PaymentHopFailure `json:"failure,omitempty"`
+}
+
+type PaymentRouteHop struct {
+	Pubkey string `json:"pubkey"`
+	// the short channel id as a decimal string, it does not fit into a JavaScript number
+	ChanId           string `json:"chan_id"`
+	AmtToForwardMsat int64  `json:"amt_to_forward_msat"`
+	FeeMsat          int64  `json:"fee_msat"`
+}
+
+// PaymentHopFailure is the error that was returned for a failed attempt
+type PaymentHopFailure struct {
+	Code string `json:"code"`
+	// the position of the node in the route that returned the error, 0 is our node
+	SourceIndex uint32 `json:"source_index"`
+}
+
+// PaymentRoute godoc
+// @Summary      Get the routes of a payment
+// @Description  Returns the routes the node attempted for an outgoing payment of the user, to find out why a payment failed or why its fee was high
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        payment_hash  path      string  true  "Payment hash"
+// @Success      200  {object}  PaymentRouteResponseBody
+// @Failure      404  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/payments/{payment_hash}/route [get]
+// @Security     OAuth2Password
+func (controller *PaymentRouteController) PaymentRoute(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	rHash := c.Param("payment_hash")
+	payment, attempts, err := controller.svc.PaymentRoutes(c.Request().Context(), userID, rHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, responses.InvoiceNotFoundError)
+	}
+	if errors.Is(err, service.ErrPaymentRouteNotFound) {
+		return c.JSON(http.StatusNotFound, responses.ErrorResponse{
+			Error:   true,
+			Code:    responses.InvoiceNotFoundError.Code,
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to look up payment route user_id:%v payment_hash:%s error: %v", userID, rHash, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, convertPaymentRoute(rHash, payment, attempts))
+}
+
+func convertPaymentRoute(rHash string, payment *lnrpc.Payment, attempts []*lnrpc.HTLCAttempt) *PaymentRouteResponseBody {
+	responseBody := &PaymentRouteResponseBody{
+		PaymentHash: rHash,
+		Status:      strings.ToLower(payment.Status.String()),
+		Attempts:    make([]PaymentRouteAttempt, len(attempts)),
+	}
+	if payment.FailureReason != lnrpc.PaymentFailureReason_FAILURE_REASON_NONE {
+		responseBody.FailureReason = payment.FailureReason.String()
+	}
+	for i, attempt := range attempts {
+		result := PaymentRouteAttempt{
+			Status:        strings.ToLower(attempt.Status.String()),
+			TotalAmtMsat:  attempt.Route.TotalAmtMsat,
+			TotalFeesMsat: attempt.Route.TotalFeesMsat,
+			Hops:          make([]PaymentRouteHop, len(attempt.Route.Hops)),
+		}
+		for j, hop := range attempt.Route.Hops {
+			result.Hops[j] = PaymentRouteHop{
+				Pubkey:           hop.PubKey,
+				ChanId:           strconv.FormatUint(hop.ChanId, 10),
+				AmtToForwardMsat: hop.AmtToForwardMsat,
+				FeeMsat:          hop.FeeMsat,
+			}
+		}
+		if attempt.Failure != nil {
+			result.Failure = &PaymentHopFailure{
+				Code:        attempt.Failure.Code.String(),
+				SourceIndex: attempt.Failure.FailureSourceIndex,
+			}
+		}
+		responseBody.Attempts[i] = result
+	}
+	return responseBody
+}
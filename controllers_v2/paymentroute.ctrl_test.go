@@ -0,0 +1,40 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertPaymentRoute(t *testing.T) {
+	payment := &lnrpc.Payment{Status: lnrpc.Payment_SUCCEEDED}
+	attempts := []*lnrpc.HTLCAttempt{
+		{
+			Status:  lnrpc.HTLCAttempt_FAILED,
+			Route:   &lnrpc.Route{TotalAmtMsat: 102000, TotalFeesMsat: 2000, Hops: []*lnrpc.Hop{{PubKey: "02aa", ChanId: 863134082372763649, AmtToForwardMsat: 100000, FeeMsat: 2000}, {PubKey: "03bb", ChanId: 1, AmtToForwardMsat: 100000}}},
+			Failure: &lnrpc.Failure{Code: lnrpc.Failure_FEE_INSUFFICIENT, FailureSourceIndex: 1},
+		},
+		{
+			Status: lnrpc.HTLCAttempt_SUCCEEDED,
+			Route:  &lnrpc.Route{TotalAmtMsat: 100500, TotalFeesMsat: 500, Hops: []*lnrpc.Hop{{PubKey: "02cc", ChanId: 2, AmtToForwardMsat: 100000, FeeMsat: 500}}},
+		},
+	}
+	body := convertPaymentRoute("abcd", payment, attempts)
+	assert.Equal(t, "succeeded", body.Status)
+	assert.Empty(t, body.FailureReason)
+	assert.Len(t, body.Attempts, 2)
+	assert.Equal(t, "failed", body.Attempts[0].Status)
+	assert.Equal(t, &PaymentHopFailure{Code: "FEE_INSUFFICIENT", SourceIndex: 1}, body.Attempts[0].Failure)
+	assert.Equal(t, PaymentRouteHop{Pubkey: "02aa", ChanId: "863134082372763649", AmtToForwardMsat: 100000, FeeMsat: 2000}, body.Attempts[0].Hops[0])
+	assert.Nil(t, body.Attempts[1].Failure)
+	assert.Equal(t, int64(500), body.Attempts[1].TotalFeesMsat)
+
+	encoded, err := json.Marshal(body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(encoded), `"chan_id":"863134082372763649"`)
+
+	body = convertPaymentRoute("abcd", &lnrpc.Payment{Status: lnrpc.Payment_FAILED, FailureReason: lnrpc.PaymentFailureReason_FAILURE_REASON_TIMEOUT}, attempts[:1])
+	assert.Equal(t, "FAILURE_REASON_TIMEOUT", body.FailureReason)
+}
@@ -0,0 +1,82 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/labstack/echo/v4"
+)
+
+type PayOfferRequestBody struct {
+	Offer string `json:"offer" validate:"required"`
+	// required for offers without an amount, for other offers it has to match the amount of the offer
+	Amount          int64   `json:"amount" validate:"omitempty,gte=0"`
+	AmountMsat      int64   `json:"amount_msat" validate:"omitempty,gte=0"` // takes precedence over amount
+	TimeoutSeconds  int64   `json:"timeout_seconds" validate:"omitempty,gt=0"`
+	FeeLimitSat     int64   `json:"fee_limit_sat" validate:"omitempty,gt=0"`
+	FeeLimitPercent float64 `json:"fee_limit_percent" validate:"omitempty,gt=0,lte=100"`
+	Label           string  `json:"label" validate:"omitempty,max=256"`
+}
+
+// PayOffer godoc
+// @Summary      Pay an offer
+// @Description  Fetch an invoice from a bolt12 offer and pay it
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        PayOfferRequest  body      PayOfferRequestBody  True  "Offer to pay"
+// @Success      200              {object}  PayInvoiceResponseBody
+// @Success      202              {object}  PaymentConfirmationResponseBody
+// @Failure      400              {object}  responses.ErrorResponse
+// @Failure      500              {object}  responses.ErrorResponse
+// @Router       /v2/payments/bolt12 [post]
+// @Security     OAuth2Password
+func (controller *PayInvoiceController) PayOffer(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	reqBody := PayOfferRequestBody{}
+	if err := c.Bind(&reqBody); err != nil {
+		c.Logger().Errorf("Failed to load payoffer request body: user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&reqBody); err != nil {
+		c.Logger().Errorf("Invalid payoffer request body user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	offer := strings.ToLower(reqBody.Offer)
+	amountMsat := reqBody.Amount * 1000
+	if reqBody.AmountMsat > 0 {
+		amountMsat = reqBody.AmountMsat
+	}
+	offerInvoice, err := controller.svc.FetchOfferInvoice(c.Request().Context(), offer, amountMsat)
+	if err != nil {
+		c.Logger().Errorf("Failed to fetch invoice of offer user_id:%v amount_msat:%v error: %v", userID, amountMsat, err)
+		if errors.Is(err, lnd.ErrOffersNotSupported) {
+			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{
+				Error:   true,
+				Code:    responses.BadArgumentsError.Code,
+				Message: err.Error(),
+			})
+		}
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	// the balances can't represent fractions of a satoshi
+	if offerInvoice.PayReq.NumMsat%1000 != 0 || offerInvoice.PayReq.NumSatoshis <= 0 {
+		c.Logger().Errorf("Offer invoice amount is not a whole number of satoshis user_id:%v amount_msat:%v", userID, offerInvoice.PayReq.NumMsat)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	lnPayReq := &lnd.LNPayReq{
+		PayReq: offerInvoice.PayReq,
+		Offer:  offer,
+	}
+	return controller.pay(c, userID, offerInvoice.PaymentRequest, lnPayReq, &PayInvoiceRequestBody{
+		TimeoutSeconds:  reqBody.TimeoutSeconds,
+		FeeLimitSat:     reqBody.FeeLimitSat,
+		FeeLimitPercent: reqBody.FeeLimitPercent,
+		Label:           reqBody.Label,
+	}, "", "", false)
+}
@@ -0,0 +1,110 @@
+package v2controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// these requests are rejected before the database is used, so no node and no database are needed
+func TestPayOfferRejectedRequests(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		fetch              func(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error)
+		expectedAmountMsat int64
+		expectedMessage    string
+	}{
+		{
+			name: "missing offer",
+			body: `{}`,
+		},
+		{
+			name: "bolt11 invoice",
+			body: `{"offer":"lnbc1"}`,
+		},
+		{
+			name: "offer without amount",
+			body: `{"offer":"lno1any"}`,
+			fetch: func(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+				return nil, lnd.ErrOfferAmountRequired
+			},
+		},
+		{
+			name: "amount differs from the offer",
+			body: `{"offer":"LNO1FIXED","amount":10}`,
+			fetch: func(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+				assert.Equal(t, "lno1fixed", offer)
+				return nil, lnd.ErrOfferAmountMismatch
+			},
+			expectedAmountMsat: 10000,
+		},
+		{
+			name: "offers not supported by the node",
+			body: `{"offer":"lno1any","amount_msat":21000}`,
+			fetch: func(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+				return nil, lnd.ErrOffersNotSupported
+			},
+			expectedAmountMsat: 21000,
+			expectedMessage:    lnd.ErrOffersNotSupported.Error(),
+		},
+		{
+			name: "fractional satoshi amount",
+			body: `{"offer":"lno1fixed"}`,
+			fetch: func(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+				return &lnd.OfferInvoice{
+					PaymentRequest: "lni1",
+					PayReq:         &lnrpc.PayReq{NumSatoshis: 21, NumMsat: 21500},
+				}, nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &testutils.MockLightningClient{}
+			if tt.fetch != nil {
+				mock.FetchOfferInvoiceFunc = func(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+					assert.Equal(t, tt.expectedAmountMsat, amountMsat)
+					return tt.fetch(ctx, offer, amountMsat)
+				}
+			}
+			controller := NewPayInvoiceController(&service.LndhubService{Config: &service.Config{}, LndClient: mock})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt12", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.PayOffer(c))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			errorResponse := &responses.ErrorResponse{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+			assert.True(t, errorResponse.Error)
+			assert.Equal(t, responses.BadArgumentsError.Code, errorResponse.Code)
+			if tt.expectedMessage != "" {
+				assert.Equal(t, tt.expectedMessage, errorResponse.Message)
+			}
+			if tt.fetch == nil {
+				assert.Zero(t, mock.Calls("FetchOfferInvoice"))
+			}
+			assert.Zero(t, mock.Calls("SendPaymentSync"))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package v2controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// PendingPaymentsController : Pending payments controller struct
+type PendingPaymentsController struct {
+	svc *service.LndhubService
+}
+
+func NewPendingPaymentsController(svc *service.LndhubService) *PendingPaymentsController {
+	return &PendingPaymentsController{svc: svc}
+}
+
+type PendingPaymentsResponseBody struct {
+	Count int `json:"count"`
+}
+
+// PendingPayments godoc
+// @Summary      Count pending payments
+// @Description  Returns the number of outgoing payments of the user whose outcome is not known yet
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Success      200  {object}  PendingPaymentsResponseBody
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/payments/pending [get]
+// @Security     OAuth2Password
+func (controller *PendingPaymentsController) PendingPayments(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	count, err := controller.svc.CountPendingPayments(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("Failed to count pending payments user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &PendingPaymentsResponseBody{
+		Count: count,
+	})
+}
+
+type OutgoingPaymentsRequestParams struct {
+	State  string `query:"state" validate:"omitempty,oneof=pending settled failed"`
+	Limit  int    `query:"limit" validate:"omitempty,gte=1,lte=100"`
+	Cursor int64  `query:"cursor" validate:"omitempty,gte=1"`
+}
+
+type OutgoingPaymentsResponseBody struct {
+	Payments   []Invoice `json:"payments"`
+	NextCursor int64     `json:"next_cursor,omitempty"`
+}
+
+// OutgoingPayments godoc
+// @Summary      Retrieve outgoing payments by state
+// @Description  Returns a page of outgoing payments of the user, newest first. Pending payments include the ones whose outcome is still looked up. Pass next_cursor as cursor to get the next page.
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        state   query     string  false  "pending, settled or failed"
+// @Param        limit   query     int     false  "Page size, defaults to 25 and at most 100"
+// @Param        cursor  query     int     false  "Cursor returned as next_cursor by the previous page"
+// @Success      200     {object}  OutgoingPaymentsResponseBody
+// @Failure      400     {object}  responses.ErrorResponse
+// @Failure      500     {object}  responses.ErrorResponse
+// @Router       /v2/payments/outgoing [get]
+// @Security     OAuth2Password
+func (controller *PendingPaymentsController) OutgoingPayments(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	params := OutgoingPaymentsRequestParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load outgoing payments request params: user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&params); err != nil {
+		c.Logger().Errorf("Invalid outgoing payments request params user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultTransactionsLimit
+	}
+	payments, nextCursor, err := controller.svc.GetOutgoingPaymentsPaged(c.Request().Context(), userID, params.State, params.Limit, params.Cursor)
+	if err != nil {
+		c.Logger().Errorf("Failed to get outgoing payments user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response := &OutgoingPaymentsResponseBody{
+		Payments:   make([]Invoice, len(payments)),
+		NextCursor: nextCursor,
+	}
+	for i := range payments {
+		response.Payments[i] = convertInvoice(&payments[i])
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,41 @@
+package v2controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// these requests are rejected before the database is used
+func TestOutgoingPaymentsRejectedRequests(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unknown state", "state=open"},
+		{"limit too large", "limit=101"},
+		{"negative cursor", "cursor=-1"},
+		{"invalid cursor", "cursor=abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewPendingPaymentsController(&service.LndhubService{Config: &service.Config{}})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodGet, "/v2/payments/outgoing?"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.OutgoingPayments(c))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib/pricing"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// PriceController : PriceController struct
+type PriceController struct {
+	svc *service.LndhubService
+}
+
+func NewPriceController(svc *service.LndhubService) *PriceController {
+	return &PriceController{svc: svc}
+}
+
+type PriceRequestParams struct {
+	Currency string `query:"currency" validate:"required"`
+}
+
+type PriceResponseBody struct {
+	Currency string `json:"currency"`
+	// price of one bitcoin
+	Rate      float64   `json:"rate"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// seconds since the rate was fetched
+	Age int64 `json:"age"`
+	// the price provider could not be reached for longer than PRICE_CACHE_TTL
+	Stale bool `json:"stale"`
+}
+
+// Price godoc
+// @Summary      Retrieve the bitcoin price
+// @Description  Returns the cached price of one bitcoin in the given fiat currency and its age
+// @Accept       json
+// @Produce      json
+// @Tags         Info
+// @Param        currency  query     string  true  "Fiat currency code, e.g. USD"
+// @Success      200       {object}  PriceResponseBody
+// @Failure      400       {object}  responses.ErrorResponse
+// @Failure      500       {object}  responses.ErrorResponse
+// @Router       /v2/prices [get]
+// @Security     OAuth2Password
+func (controller *PriceController) Price(c echo.Context) error {
+	params := PriceRequestParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load price request params: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&params); err != nil {
+		c.Logger().Errorf("Invalid price request params: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if controller.svc.PriceService == nil {
+		c.Logger().Errorf("Price requested but no price service is configured")
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	currency := strings.ToUpper(params.Currency)
+	rate, err := controller.svc.PriceService.Rate(currency)
+	if errors.Is(err, pricing.ErrUnknownCurrency) {
+		c.Logger().Errorf("Unknown fiat currency currency:%v", currency)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to fetch the bitcoin price currency:%v error: %v", currency, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &PriceResponseBody{
+		Currency:  rate.Currency,
+		Rate:      rate.Price,
+		FetchedAt: rate.FetchedAt,
+		Age:       int64(rate.Age().Seconds()),
+		Stale:     rate.Stale,
+	})
+}
@@ -0,0 +1,81 @@
+package v2controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/pricing"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrice(t *testing.T) {
+	priceService := pricing.NewPriceService(pricing.Fixed{"USD": 30000}, time.Minute)
+	tests := []struct {
+		name           string
+		priceService   *pricing.PriceService
+		query          string
+		expectedStatus int
+		expectedRate   float64
+	}{
+		{
+			name:           "cached rate",
+			priceService:   priceService,
+			query:          "?currency=usd",
+			expectedStatus: http.StatusOK,
+			expectedRate:   30000,
+		},
+		{
+			name:           "missing currency",
+			priceService:   priceService,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown currency",
+			priceService:   priceService,
+			query:          "?currency=XYZ",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "no price service",
+			query:          "?currency=USD",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewPriceController(&service.LndhubService{Config: &service.Config{}, PriceService: tt.priceService})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodGet, "/v2/prices"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.Price(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				errorResponse := &responses.ErrorResponse{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+				assert.Equal(t, responses.BadArgumentsError.Code, errorResponse.Code)
+				return
+			}
+			response := &PriceResponseBody{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(response))
+			assert.Equal(t, "USD", response.Currency)
+			assert.Equal(t, tt.expectedRate, response.Rate)
+			assert.False(t, response.Stale)
+			assert.Zero(t, response.Age)
+			assert.WithinDuration(t, time.Now(), response.FetchedAt, time.Minute)
+		})
+	}
+}
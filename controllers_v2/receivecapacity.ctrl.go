@@ -0,0 +1,50 @@
+package v2controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// ReceiveCapacityController : Receive capacity controller struct
+type ReceiveCapacityController struct {
+	svc *service.LndhubService
+}
+
+func NewReceiveCapacityController(svc *service.LndhubService) *ReceiveCapacityController {
+	return &ReceiveCapacityController{svc: svc}
+}
+
+type ReceiveCapacityResponseBody struct {
+	// sum of the remote balances of the active channels of the node
+	InboundSat int64 `json:"inbound_sat"`
+	// payers that can't split payments can't pay more than this
+	LargestChannelInboundSat int64 `json:"largest_channel_inbound_sat"`
+	// invoices above the inbound liquidity are rejected
+	Enforced bool `json:"enforced"`
+}
+
+// ReceiveCapacity godoc
+// @Summary      Get the receive capacity
+// @Description  Returns the inbound liquidity of the node, invoices above it can't be paid from other nodes. It is updated every few seconds.
+// @Accept       json
+// @Produce      json
+// @Tags         Info
+// @Success      200  {object}  ReceiveCapacityResponseBody
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/receive-capacity [get]
+// @Security     OAuth2Password
+func (controller *ReceiveCapacityController) ReceiveCapacity(c echo.Context) error {
+	capacity, err := controller.svc.ReceiveCapacity(c.Request().Context())
+	if err != nil {
+		c.Logger().Errorf("Failed to get the receive capacity: %v", err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &ReceiveCapacityResponseBody{
+		InboundSat:               capacity.InboundSat,
+		LargestChannelInboundSat: capacity.LargestChannelInboundSat,
+		Enforced:                 controller.svc.Config.EnforceInboundLiquidity,
+	})
+}
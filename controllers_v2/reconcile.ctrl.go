@@ -0,0 +1,51 @@
+package v2controllers
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// ReconcileController : Reconcile controller struct
+type ReconcileController struct {
+	svc *service.LndhubService
+}
+
+func NewReconcileController(svc *service.LndhubService) *ReconcileController {
+	return &ReconcileController{svc: svc}
+}
+
+type ReconcileResponseBody struct {
+	TotalUserBalance  int64 `json:"total_user_balance"`
+	ChannelBalance    int64 `json:"channel_balance"`
+	OnchainBalance    int64 `json:"onchain_balance"`
+	NodeBalance       int64 `json:"node_balance"`
+	Difference        int64 `json:"difference"`
+	FractionalReserve bool  `json:"fractional_reserve"`
+}
+
+// Reconcile godoc
+// @Summary      Reconcile the reserves
+// @Description  Compares the sum of all user balances to the channel and on-chain balance of the node. fractional_reserve is true if the node balance is below the user balances. Requires Authorization header with admin token.
+// @Produce      json
+// @Tags         Info
+// @Success      200  {object}  ReconcileResponseBody
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/admin/reconcile [get]
+func (controller *ReconcileController) Reconcile(c echo.Context) error {
+	reserves, err := controller.svc.GetReserves(c.Request().Context())
+	if err != nil {
+		c.Logger().Errorf("Failed to reconcile the reserves: %v", err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &ReconcileResponseBody{
+		TotalUserBalance:  reserves.TotalUserBalance,
+		ChannelBalance:    reserves.ChannelBalance,
+		OnchainBalance:    reserves.OnchainBalance,
+		NodeBalance:       reserves.NodeBalance,
+		Difference:        reserves.Difference,
+		FractionalReserve: reserves.FractionalReserve,
+	})
+}
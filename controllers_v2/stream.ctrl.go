@@ -0,0 +1,154 @@
+package v2controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	streamWriteWait = 10 * time.Second
+	// the client has to answer a ping within this time
+	streamPongWait   = 60 * time.Second
+	streamPingPeriod = streamPongWait * 9 / 10
+)
+
+// the connections are authenticated with the Authorization header and not with cookies,
+// so requests from other origins are allowed
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// StreamController : StreamController struct
+type StreamController struct {
+	svc *service.LndhubService
+}
+
+func NewStreamController(svc *service.LndhubService) *StreamController {
+	return &StreamController{svc: svc}
+}
+
+type BalanceChangedEvent struct {
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      BalanceResponse `json:"data"`
+}
+
+// StreamEvents godoc
+// @Summary      Stream account events
+// @Description  Upgrades to a WebSocket connection that receives the invoice.settled, payment.sent, payment.failed and balance.changed events of the user
+// @Tags         Account
+// @Success      101
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      429  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/ws [get]
+// @Security     OAuth2Password
+func (controller *StreamController) StreamEvents(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	if !controller.svc.AcquireStreamConnection(userId) {
+		return c.JSON(http.StatusTooManyRequests, responses.TooManyConnectionsError)
+	}
+	defer controller.svc.ReleaseStreamConnection(userId)
+
+	ctx := c.Request().Context()
+	user, err := controller.svc.FindUser(ctx, userId)
+	if err != nil {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "failed to find user",
+				"lndhub_user_id": userId,
+				"error":          err,
+			},
+		)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	invoices, unsubscribe, err := controller.svc.SubscribeAccountEvents(userId)
+	if err != nil {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "failed to subscribe to account events",
+				"lndhub_user_id": userId,
+				"error":          err,
+			},
+		)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	defer unsubscribe()
+
+	ws, err := streamUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader already responded with an error
+		return nil
+	}
+	defer ws.Close()
+
+	// the client doesn't send anything but the pongs, reading stops once the connection is gone
+	closed := make(chan struct{})
+	ws.SetReadLimit(512)
+	ws.SetReadDeadline(time.Now().Add(streamPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return nil
+		case <-ticker.C:
+			ws.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return nil
+			}
+		case invoice := <-invoices:
+			if err := controller.writeEvents(ctx, ws, user, invoice); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// writeEvents sends the event of the invoice followed by the new balance of the user
+func (controller *StreamController) writeEvents(ctx context.Context, ws *websocket.Conn, user *models.User, invoice models.Invoice) error {
+	ws.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	err := ws.WriteJSON(service.UserWebhookEvent{
+		Event:     service.AccountEventName(invoice),
+		CreatedAt: time.Now(),
+		Data:      service.ConvertPayload(invoice, user),
+	})
+	if err != nil {
+		return err
+	}
+	balance, err := controller.svc.CurrentUserBalance(ctx, user.ID)
+	if err != nil {
+		controller.svc.Logger.Errorf("Could not fetch user balance user_id:%v invoice_id:%v error %v", user.ID, invoice.ID, err)
+		return nil
+	}
+	return ws.WriteJSON(BalanceChangedEvent{
+		Event:     common.EventBalanceChanged,
+		CreatedAt: time.Now(),
+		Data: BalanceResponse{
+			Balance:  balance,
+			Currency: "BTC",
+			Unit:     "sat",
+		},
+	})
+}
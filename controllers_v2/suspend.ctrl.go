@@ -0,0 +1,104 @@
+package v2controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// SuspendUserController : Suspend user controller struct
+type SuspendUserController struct {
+	svc *service.LndhubService
+}
+
+func NewSuspendUserController(svc *service.LndhubService) *SuspendUserController {
+	return &SuspendUserController{svc: svc}
+}
+
+type SuspendUserRequestBody struct {
+	// full rejects all requests of the user, send_only only rejects payments
+	Mode string `json:"mode" validate:"omitempty,oneof=full send_only"`
+}
+
+type SuspendUserResponseBody struct {
+	ID          int64  `json:"id"`
+	Login       string `json:"login"`
+	Suspended   bool   `json:"suspended"`
+	SuspendMode string `json:"suspend_mode,omitempty"`
+}
+
+// SuspendUser godoc
+// @Summary      Suspend an account
+// @Description  Suspend an account, in full mode all requests of the user are rejected, in send_only mode the user can't send payments but can still receive. Requires Authorization header with admin token.
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        id       path      int                     true   "User id"
+// @Param        suspend  body      SuspendUserRequestBody  false  "Suspension mode, defaults to full"
+// @Success      200      {object}  SuspendUserResponseBody
+// @Failure      400      {object}  responses.ErrorResponse
+// @Failure      500      {object}  responses.ErrorResponse
+// @Router       /v2/admin/users/{id}/suspend [post]
+func (controller *SuspendUserController) SuspendUser(c echo.Context) error {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Logger().Errorf("Invalid user id %v: %v", c.Param("id"), err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	var body SuspendUserRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load suspend user request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid suspend user request body error: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if body.Mode == "" {
+		body.Mode = common.SuspendModeFull
+	}
+	user, err := controller.svc.SuspendUser(c.Request().Context(), userId, body.Mode)
+	if err != nil {
+		c.Logger().Errorf("Failed to suspend user user_id:%v: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	return c.JSON(http.StatusOK, &SuspendUserResponseBody{
+		ID:          user.ID,
+		Login:       user.Login,
+		Suspended:   user.Suspended,
+		SuspendMode: user.SuspendMode,
+	})
+}
+
+// UnsuspendUser godoc
+// @Summary      Lift the suspension of an account
+// @Description  Lift the suspension of an account. Requires Authorization header with admin token.
+// @Produce      json
+// @Tags         Account
+// @Param        id   path      int  true  "User id"
+// @Success      200  {object}  SuspendUserResponseBody
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/admin/users/{id}/unsuspend [post]
+func (controller *SuspendUserController) UnsuspendUser(c echo.Context) error {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Logger().Errorf("Invalid user id %v: %v", c.Param("id"), err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	user, err := controller.svc.UnsuspendUser(c.Request().Context(), userId)
+	if err != nil {
+		c.Logger().Errorf("Failed to unsuspend user user_id:%v: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	return c.JSON(http.StatusOK, &SuspendUserResponseBody{
+		ID:          user.ID,
+		Login:       user.Login,
+		Suspended:   user.Suspended,
+		SuspendMode: user.SuspendMode,
+	})
+}
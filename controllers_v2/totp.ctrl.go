@@ -0,0 +1,100 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// TOTPController : Two-factor authentication controller struct
+type TOTPController struct {
+	svc *service.LndhubService
+}
+
+func NewTOTPController(svc *service.LndhubService) *TOTPController {
+	return &TOTPController{svc: svc}
+}
+
+type EnrollTOTPResponseBody struct {
+	Secret string `json:"secret"`
+	// otpauth:// URI for the QR code of authenticator apps
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type VerifyTOTPRequestBody struct {
+	TotpCode string `json:"totp_code" validate:"required"`
+}
+
+type VerifyTOTPResponseBody struct {
+	// every code can be used once instead of a TOTP code, they are not shown again
+	BackupCodes []string `json:"backup_codes"`
+}
+
+// Enroll godoc
+// @Summary      Enroll in two-factor authentication
+// @Description  Creates a TOTP secret for the user, payments only require a code once the secret is verified
+// @Produce      json
+// @Tags         Account
+// @Success      200  {object}  EnrollTOTPResponseBody
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/totp/enroll [post]
+// @Security     OAuth2Password
+func (controller *TOTPController) Enroll(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	secret, uri, err := controller.svc.EnrollTOTP(c.Request().Context(), userID)
+	if errors.Is(err, service.ErrTOTPAlreadyEnabled) {
+		return c.JSON(http.StatusBadRequest, responses.TOTPAlreadyEnabledError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to enroll totp user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &EnrollTOTPResponseBody{
+		Secret:          secret,
+		ProvisioningURI: uri,
+	})
+}
+
+// Verify godoc
+// @Summary      Enable two-factor authentication
+// @Description  Verifies a code of the enrolled TOTP secret and enables two-factor authentication for payments, returns the backup codes
+// @Accept       json
+// @Produce      json
+// @Tags         Account
+// @Param        totp  body      VerifyTOTPRequestBody  true  "TOTP code"
+// @Success      200   {object}  VerifyTOTPResponseBody
+// @Failure      400   {object}  responses.ErrorResponse
+// @Failure      403   {object}  responses.ErrorResponse
+// @Failure      500   {object}  responses.ErrorResponse
+// @Router       /v2/totp/verify [post]
+// @Security     OAuth2Password
+func (controller *TOTPController) Verify(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	var body VerifyTOTPRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load verify totp request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid verify totp request body error: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	backupCodes, err := controller.svc.VerifyTOTP(c.Request().Context(), userID, body.TotpCode)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, &VerifyTOTPResponseBody{BackupCodes: backupCodes})
+	case errors.Is(err, service.ErrTOTPAlreadyEnabled):
+		return c.JSON(http.StatusBadRequest, responses.TOTPAlreadyEnabledError)
+	case errors.Is(err, service.ErrTOTPNotEnrolled):
+		return c.JSON(http.StatusBadRequest, responses.TOTPNotEnrolledError)
+	case errors.Is(err, service.ErrInvalidTOTPCode):
+		return c.JSON(responses.InvalidTOTPCodeError.HttpStatusCode, responses.InvalidTOTPCodeError)
+	default:
+		c.Logger().Errorf("Failed to verify totp user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+}
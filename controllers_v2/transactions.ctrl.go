@@ -0,0 +1,234 @@
+package v2controllers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const DefaultTransactionsLimit = 25
+
+// TransactionsController : Transactions controller struct
+type TransactionsController struct {
+	svc *service.LndhubService
+}
+
+func NewTransactionsController(svc *service.LndhubService) *TransactionsController {
+	return &TransactionsController{svc: svc}
+}
+
+type TransactionsFilterParams struct {
+	Type  string    `query:"type" validate:"omitempty,oneof=incoming outgoing"`
+	State string    `query:"state" validate:"omitempty,oneof=settled pending failed"`
+	From  time.Time `query:"from"`
+	To    time.Time `query:"to"`
+	Label string    `query:"label" validate:"omitempty,max=256"`
+	// payments that were rejected before they were sent
+	IncludeAborted bool `query:"include_aborted"`
+}
+
+func (params *TransactionsFilterParams) Filter() service.TransactionsFilter {
+	return service.TransactionsFilter{
+		Type:           params.Type,
+		State:          params.State,
+		From:           params.From,
+		To:             params.To,
+		Label:          params.Label,
+		IncludeAborted: params.IncludeAborted,
+	}
+}
+
+func (params *TransactionsFilterParams) ValidDateRange() bool {
+	return params.From.IsZero() || params.To.IsZero() || !params.From.After(params.To)
+}
+
+type GetTransactionsRequestParams struct {
+	TransactionsFilterParams
+	Limit  int   `query:"limit" validate:"omitempty,gte=1,lte=100"`
+	Cursor int64 `query:"cursor" validate:"omitempty,gte=1"`
+}
+
+type GetTransactionsResponseBody struct {
+	Transactions []Invoice `json:"transactions"`
+	NextCursor   int64     `json:"next_cursor,omitempty"`
+}
+
+// GetTransactions godoc
+// @Summary      Retrieve transactions
+// @Description  Returns a page of incoming and outgoing transactions for a user, newest first. Pass next_cursor as cursor to get the next page.
+// @Accept       json
+// @Produce      json
+// @Tags         Invoice
+// @Param        limit   query     int     false  "Page size, defaults to 25 and at most 100"
+// @Param        cursor  query     int     false  "Cursor returned as next_cursor by the previous page"
+// @Param        type    query     string  false  "incoming or outgoing"
+// @Param        state   query     string  false  "settled, pending or failed"
+// @Param        from    query     string  false  "RFC3339 timestamp, compared to the settled date of settled transactions and the creation date otherwise"
+// @Param        to      query     string  false  "RFC3339 timestamp, compared to the settled date of settled transactions and the creation date otherwise"
+// @Param        label   query     string  false  "Label set when paying"
+// @Param        include_aborted  query  bool  false  "Also return payments that were rejected before they were sent, e.g. for not enough balance"
+// @Success      200     {object}  GetTransactionsResponseBody
+// @Failure      400     {object}  responses.ErrorResponse
+// @Failure      500     {object}  responses.ErrorResponse
+// @Router       /v2/transactions [get]
+// @Security     OAuth2Password
+func (controller *TransactionsController) GetTransactions(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	params := GetTransactionsRequestParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load transactions request params: user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&params); err != nil {
+		c.Logger().Errorf("Invalid transactions request params user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if !params.ValidDateRange() {
+		c.Logger().Errorf("Invalid transactions date range user_id:%v from:%v to:%v", userId, params.From, params.To)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultTransactionsLimit
+	}
+
+	invoices, nextCursor, err := controller.svc.GetTransactionsPaged(c.Request().Context(), userId, params.Filter(), params.Limit, params.Cursor)
+	if err != nil {
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "failed to get transactions",
+				"error":          err,
+				"lndhub_user_id": userId,
+			},
+		)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+
+	response := &GetTransactionsResponseBody{
+		Transactions: make([]Invoice, len(invoices)),
+		NextCursor:   nextCursor,
+	}
+	for i, invoice := range invoices {
+		invoiceType := common.InvoiceTypeUser
+		if invoice.Type == common.InvoiceTypeOutgoing {
+			invoiceType = common.InvoiceTypePaid
+		}
+		response.Transactions[i] = Invoice{
+			PaymentHash:     invoice.RHash,
+			PaymentRequest:  invoice.PaymentRequest,
+			Description:     invoice.Memo,
+			DescriptionHash: invoice.DescriptionHash,
+			Destination:     invoice.DestinationPubkeyHex,
+			Amount:          invoice.Amount,
+			Fee:             invoice.Fee,
+			Status:          invoice.State,
+			Type:            invoiceType,
+			ErrorMessage:    invoice.ErrorMessage,
+			SettledAt:       invoice.SettledAt.Time,
+			ExpiresAt:       invoice.ExpiresAt.Time,
+			IsPaid:          invoice.State == common.InvoiceStateSettled,
+			Keysend:         invoice.Keysend,
+			CustomRecords:   invoice.DestinationCustomRecords,
+			Label:           invoice.Label,
+		}
+		// the preimage of incoming invoices is only revealed to the payer
+		if invoice.Type == common.InvoiceTypeOutgoing {
+			response.Transactions[i].PaymentPreimage = invoice.Preimage
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// ExportTransactions godoc
+// @Summary      Export transactions
+// @Description  Returns all transactions of a user matching the filters as CSV, newest first. Amounts and fees are in satoshi.
+// @Produce      text/csv
+// @Tags         Invoice
+// @Param        type   query     string  false  "incoming or outgoing"
+// @Param        state  query     string  false  "settled, pending or failed"
+// @Param        from   query     string  false  "RFC3339 timestamp, compared to the settled date of settled transactions and the creation date otherwise"
+// @Param        to     query     string  false  "RFC3339 timestamp, compared to the settled date of settled transactions and the creation date otherwise"
+// @Param        label  query     string  false  "Label set when paying"
+// @Param        include_aborted  query  bool  false  "Also return payments that were rejected before they were sent, e.g. for not enough balance"
+// @Success      200    {string}  string
+// @Failure      400    {object}  responses.ErrorResponse
+// @Failure      500    {object}  responses.ErrorResponse
+// @Router       /v2/transactions/export.csv [get]
+// @Security     OAuth2Password
+func (controller *TransactionsController) ExportTransactions(c echo.Context) error {
+	userId := c.Get("UserID").(int64)
+	params := TransactionsFilterParams{}
+	if err := c.Bind(&params); err != nil {
+		c.Logger().Errorf("Failed to load transactions export request params: user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&params); err != nil {
+		c.Logger().Errorf("Invalid transactions export request params user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if !params.ValidDateRange() {
+		c.Logger().Errorf("Invalid transactions date range user_id:%v from:%v to:%v", userId, params.From, params.To)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="transactions.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+	w := csv.NewWriter(c.Response())
+	err := w.Write([]string{"date", "type", "amount", "fee", "memo", "payment_hash", "state"})
+	if err != nil {
+		return err
+	}
+	err = controller.svc.StreamTransactions(c.Request().Context(), userId, params.Filter(), func(invoice *models.Invoice) error {
+		date := invoice.CreatedAt
+		if invoice.State == common.InvoiceStateSettled {
+			date = invoice.SettledAt.Time
+		}
+		err := w.Write([]string{
+			date.UTC().Format(time.RFC3339),
+			invoice.Type,
+			strconv.FormatInt(invoice.Amount, 10),
+			strconv.FormatInt(invoice.Fee, 10),
+			csvSafe(invoice.Memo),
+			invoice.RHash,
+			invoice.State,
+		})
+		if err != nil {
+			return err
+		}
+		// stream the rows instead of buffering the whole export
+		w.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		// the status has already been sent, all we can do is to stop the export
+		c.Logger().Errorj(
+			log.JSON{
+				"message":        "failed to export transactions",
+				"error":          err,
+				"lndhub_user_id": userId,
+			},
+		)
+		return nil
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvSafe keeps spreadsheet applications from evaluating user supplied cells as formulas
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
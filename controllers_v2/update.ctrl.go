@@ -18,20 +18,25 @@ func NewUpdateUserController(svc *service.LndhubService) *UpdateUserController {
 }
 
 type UpdateUserResponseBody struct {
-	Login       string `json:"login"`
-	Deactivated bool   `json:"deactivated"`
-	ID          int64  `json:"id"`
+	Login                string `json:"login"`
+	Deactivated          bool   `json:"deactivated"`
+	LightningAddress     string `json:"lightning_address,omitempty"`
+	MaxDailyOutboundSats *int64 `json:"max_daily_outbound_sats,omitempty"`
+	ID                   int64  `json:"id"`
 }
 type UpdateUserRequestBody struct {
-	Login       *string `json:"login,omitempty"`
-	Password    *string `json:"password,omitempty"`
-	Deactivated *bool   `json:"deactivated,omitempty"`
-	ID          int64   `json:"id" validate:"required"`
+	Login            *string `json:"login,omitempty"`
+	Password         *string `json:"password,omitempty"`
+	Deactivated      *bool   `json:"deactivated,omitempty"`
+	LightningAddress *string `json:"lightning_address,omitempty"`
+	// a negative limit removes the override of the configured daily sending limit
+	MaxDailyOutboundSats *int64 `json:"max_daily_outbound_sats,omitempty"`
+	ID                   int64  `json:"id" validate:"required"`
 }
 
 // UpdateUser godoc
 // @Summary      Update an account
-// @Description  Update an account with a new a login, password and activation status. Requires Authorization header with admin token.
+// @Description  Update an account with a new a login, password, activation status, lightning address and daily sending limit. Requires Authorization header with admin token.
 // @Accept       json
 // @Produce      json
 // @Tags         Account
@@ -52,7 +57,7 @@ func (controller *UpdateUserController) UpdateUser(c echo.Context) error {
 		c.Logger().Errorf("Invalid update user request body error: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
 	}
-	user, err := controller.svc.UpdateUser(c.Request().Context(), body.ID, body.Login, body.Password, body.Deactivated)
+	user, err := controller.svc.UpdateUser(c.Request().Context(), body.ID, body.Login, body.Password, body.Deactivated, body.LightningAddress, body.MaxDailyOutboundSats)
 	if err != nil {
 		c.Logger().Errorf("Failed to update user: %v", err)
 		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
@@ -61,6 +66,10 @@ func (controller *UpdateUserController) UpdateUser(c echo.Context) error {
 	var ResponseBody UpdateUserResponseBody
 	ResponseBody.Login = user.Login
 	ResponseBody.Deactivated = user.Deactivated
+	ResponseBody.LightningAddress = user.LightningAddress.String
+	if user.MaxDailyOutboundSats.Valid {
+		ResponseBody.MaxDailyOutboundSats = &user.MaxDailyOutboundSats.Int64
+	}
 	ResponseBody.ID = user.ID
 
 	return c.JSON(http.StatusOK, &ResponseBody)
@@ -0,0 +1,64 @@
+package v2controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// VerifyPaymentController : VerifyPaymentController struct
+type VerifyPaymentController struct {
+	svc *service.LndhubService
+}
+
+func NewVerifyPaymentController(svc *service.LndhubService) *VerifyPaymentController {
+	return &VerifyPaymentController{svc: svc}
+}
+
+type VerifyPaymentRequestBody struct {
+	PaymentHash string `json:"payment_hash" validate:"required,hexadecimal,len=64"`
+	Preimage    string `json:"preimage" validate:"required,hexadecimal,len=64"`
+}
+
+type VerifyPaymentResponseBody struct {
+	Valid bool `json:"valid"`
+}
+
+// VerifyPayment godoc
+// @Summary      Verify the preimage of a payment
+// @Description  Checks that the preimage hashes to the payment hash of a settled outgoing payment of the user, which proves that the payment was made
+// @Accept       json
+// @Produce      json
+// @Tags         Payment
+// @Param        proof  body      VerifyPaymentRequestBody  True  "Payment hash and preimage"
+// @Success      200    {object}  VerifyPaymentResponseBody
+// @Failure      400    {object}  responses.ErrorResponse
+// @Failure      404    {object}  responses.ErrorResponse
+// @Failure      500    {object}  responses.ErrorResponse
+// @Router       /v2/payments/verify [post]
+// @Security     OAuth2Password
+func (controller *VerifyPaymentController) VerifyPayment(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	var body VerifyPaymentRequestBody
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load verify payment request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid verify payment request body error: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	valid, err := controller.svc.VerifyPaymentPreimage(c.Request().Context(), userID, body.PaymentHash, body.Preimage)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, responses.PaymentNotFoundError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to verify payment user_id:%v payment_hash:%s error: %v", userID, body.PaymentHash, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	return c.JSON(http.StatusOK, &VerifyPaymentResponseBody{Valid: valid})
+}
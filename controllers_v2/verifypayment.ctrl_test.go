@@ -0,0 +1,44 @@
+package v2controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// these requests are rejected before the database is used
+func TestVerifyPaymentRejectedRequests(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing preimage", `{"payment_hash":"` + hash + `"}`},
+		{"missing payment hash", `{"preimage":"` + hash + `"}`},
+		{"short preimage", `{"payment_hash":"` + hash + `","preimage":"abcd"}`},
+		{"preimage not hex", `{"payment_hash":"` + hash + `","preimage":"` + strings.Repeat("zz", 32) + `"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewVerifyPaymentController(&service.LndhubService{Config: &service.Config{}})
+
+			e := echo.New()
+			e.Validator = &lib.CustomValidator{Validator: validator.New()}
+			req := httptest.NewRequest(http.MethodPost, "/v2/payments/verify", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("UserID", int64(1))
+
+			assert.NoError(t, controller.VerifyPayment(c))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package v2controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// WebhookController : Webhook controller struct
+type WebhookController struct {
+	svc *service.LndhubService
+}
+
+func NewWebhookController(svc *service.LndhubService) *WebhookController {
+	return &WebhookController{svc: svc}
+}
+
+type CreateWebhookRequestBody struct {
+	Url    string   `json:"url" validate:"required,http_url"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=invoice.settled payment.sent payment.failed invoice.expired"`
+}
+
+type Webhook struct {
+	ID                 int64     `json:"id"`
+	Url                string    `json:"url"`
+	Events             []string  `json:"events"`
+	Secret             string    `json:"secret,omitempty"`
+	LastDeliveryStatus int       `json:"last_delivery_status,omitempty"`
+	LastDeliveryError  string    `json:"last_delivery_error,omitempty"`
+	LastDeliveryAt     time.Time `json:"last_delivery_at"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// CreateWebhook godoc
+// @Summary      Subscribe a webhook
+// @Description  Subscribes a webhook to payment events of the user. The returned secret is used to sign the events and is only returned once.
+// @Accept       json
+// @Produce      json
+// @Tags         Webhook
+// @Param        webhook  body      CreateWebhookRequestBody  True  "Webhook"
+// @Success      200      {object}  Webhook
+// @Failure      400      {object}  responses.ErrorResponse
+// @Failure      500      {object}  responses.ErrorResponse
+// @Router       /v2/webhooks [post]
+// @Security     OAuth2Password
+func (controller *WebhookController) CreateWebhook(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	var body CreateWebhookRequestBody
+
+	if err := c.Bind(&body); err != nil {
+		c.Logger().Errorf("Failed to load create webhook request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	if err := c.Validate(&body); err != nil {
+		c.Logger().Errorf("Invalid create webhook request body: %v", err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	webhook, err := controller.svc.CreateUserWebhook(c.Request().Context(), userID, body.Url, body.Events)
+	if errors.Is(err, service.ErrInvalidOutboundURL) || errors.Is(err, service.ErrOutboundHostBlocked) {
+		c.Logger().Errorf("Webhook url rejected user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	if err != nil {
+		c.Logger().Errorf("Failed to create webhook user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response := convertWebhook(webhook)
+	response.Secret = webhook.Secret
+	return c.JSON(http.StatusOK, response)
+}
+
+// ListWebhooks godoc
+// @Summary      List webhooks
+// @Description  Returns the webhooks of the user
+// @Accept       json
+// @Produce      json
+// @Tags         Webhook
+// @Success      200  {object}  []Webhook
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/webhooks [get]
+// @Security     OAuth2Password
+func (controller *WebhookController) ListWebhooks(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+
+	webhooks, err := controller.svc.FindUserWebhooks(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Errorf("Failed to load webhooks user_id:%v error: %v", userID, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+	response := []Webhook{}
+	for i := range webhooks {
+		response = append(response, *convertWebhook(&webhooks[i]))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// DeleteWebhook godoc
+// @Summary      Delete a webhook
+// @Description  Unsubscribes a webhook of the user
+// @Accept       json
+// @Produce      json
+// @Tags         Webhook
+// @Param        id   path  int  true  "Webhook id"
+// @Success      204
+// @Failure      400  {object}  responses.ErrorResponse
+// @Failure      500  {object}  responses.ErrorResponse
+// @Router       /v2/webhooks/{id} [delete]
+// @Security     OAuth2Password
+func (controller *WebhookController) DeleteWebhook(c echo.Context) error {
+	userID := c.Get("UserID").(int64)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Logger().Errorf("Invalid webhook id user_id:%v id:%s", userID, c.Param("id"))
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+
+	err = controller.svc.DeleteUserWebhook(c.Request().Context(), userID, id)
+	if err != nil {
+		c.Logger().Errorf("Failed to delete webhook user_id:%v id:%v error: %v", userID, id, err)
+		return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func convertWebhook(webhook *models.Webhook) *Webhook {
+	return &Webhook{
+		ID:                 webhook.ID,
+		Url:                webhook.Url,
+		Events:             webhook.Events,
+		LastDeliveryStatus: webhook.LastDeliveryStatus,
+		LastDeliveryError:  webhook.LastDeliveryError,
+		LastDeliveryAt:     webhook.LastDeliveryAt.Time,
+		CreatedAt:          webhook.CreatedAt,
+	}
+}
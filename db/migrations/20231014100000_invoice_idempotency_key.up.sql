@@ -0,0 +1,5 @@
+alter table invoices add column idempotency_key character varying;
+alter table invoices add column idempotency_hash character varying;
+create unique index if not exists index_invoices_on_user_id_idempotency_key
+  on invoices(user_id, idempotency_key)
+  where idempotency_key is not null;
@@ -0,0 +1 @@
+alter table users add column lightning_address character varying unique;
@@ -0,0 +1,12 @@
+CREATE TABLE withdraw_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token character varying NOT NULL UNIQUE,
+    max_amount bigint NOT NULL,
+    used_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
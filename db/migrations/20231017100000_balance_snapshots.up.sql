@@ -0,0 +1,11 @@
+CREATE TABLE balance_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    balance bigint NOT NULL,
+    "timestamp" timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_balance_snapshots_on_user_id_timestamp ON balance_snapshots(user_id, "timestamp");
@@ -0,0 +1 @@
+alter table invoices add column is_hold boolean default false;
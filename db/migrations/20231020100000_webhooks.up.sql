@@ -0,0 +1,16 @@
+CREATE TABLE webhooks (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    url text NOT NULL,
+    secret character varying NOT NULL,
+    events text[] NOT NULL,
+    last_delivery_status integer,
+    last_delivery_error text,
+    last_delivery_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_webhooks_on_user_id ON webhooks(user_id);
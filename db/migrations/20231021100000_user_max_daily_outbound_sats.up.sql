@@ -0,0 +1 @@
+alter table users add column max_daily_outbound_sats bigint;
@@ -0,0 +1,12 @@
+alter table users add column token_epoch bigint NOT NULL DEFAULT 0;
+CREATE TABLE revoked_tokens (
+    jti character varying PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_revoked_tokens_on_expires_at ON revoked_tokens(expires_at);
@@ -0,0 +1,17 @@
+CREATE TABLE refresh_tokens (
+    jti character varying PRIMARY KEY,
+    user_id bigint NOT NULL,
+    family_id character varying NOT NULL,
+    access_token_jti character varying NOT NULL,
+    access_token_expires_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_refresh_tokens_on_user_id ON refresh_tokens(user_id);
+CREATE INDEX IF NOT EXISTS index_refresh_tokens_on_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,15 @@
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    name character varying NOT NULL,
+    key_hash character varying NOT NULL UNIQUE,
+    scopes text[] NOT NULL DEFAULT '{}',
+    last_used_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_api_keys_on_user_id ON api_keys(user_id);
@@ -0,0 +1,2 @@
+alter table users add column suspended boolean NOT NULL DEFAULT false;
+alter table users add column suspend_mode character varying;
@@ -0,0 +1,2 @@
+alter table invoices add column label character varying;
+CREATE INDEX IF NOT EXISTS index_invoices_on_user_id_label ON invoices(user_id, label) WHERE label IS NOT NULL;
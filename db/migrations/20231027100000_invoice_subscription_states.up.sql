@@ -0,0 +1,5 @@
+CREATE TABLE invoice_subscription_states (
+    pubkey character varying PRIMARY KEY,
+    settle_index bigint NOT NULL DEFAULT 0,
+    updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
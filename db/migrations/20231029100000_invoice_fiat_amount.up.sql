@@ -0,0 +1,3 @@
+alter table invoices add column fiat_currency text;
+alter table invoices add column fiat_amount numeric;
+alter table invoices add column fiat_rate numeric;
@@ -0,0 +1,33 @@
+CREATE TABLE onchain_addresses (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    address character varying NOT NULL UNIQUE,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_onchain_addresses_on_user_id ON onchain_addresses(user_id);
+
+CREATE TABLE onchain_deposits (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    address character varying NOT NULL,
+    tx_hash character varying NOT NULL,
+    output_index bigint NOT NULL,
+    amount bigint NOT NULL,
+    fee bigint NOT NULL,
+    confirmations integer NOT NULL,
+    block_height integer,
+    state character varying NOT NULL,
+    invoice_id bigint,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    credited_at timestamp with time zone,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    CONSTRAINT unique_onchain_deposit_output UNIQUE (tx_hash, output_index)
+);
+CREATE INDEX IF NOT EXISTS index_onchain_deposits_on_state ON onchain_deposits(state);
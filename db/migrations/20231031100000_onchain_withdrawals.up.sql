@@ -0,0 +1,16 @@
+CREATE TABLE onchain_withdrawals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    invoice_id bigint NOT NULL,
+    address character varying NOT NULL,
+    amount bigint NOT NULL,
+    fee bigint NOT NULL,
+    sat_per_vbyte bigint NOT NULL,
+    tx_hash character varying NOT NULL UNIQUE,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_onchain_withdrawals_on_user_id ON onchain_withdrawals(user_id);
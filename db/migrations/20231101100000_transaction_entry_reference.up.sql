@@ -0,0 +1 @@
+alter table transaction_entries add column reference text;
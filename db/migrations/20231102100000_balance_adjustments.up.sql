@@ -0,0 +1,15 @@
+CREATE TABLE balance_adjustments (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    invoice_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    reason character varying NOT NULL,
+    admin character varying NOT NULL,
+    force boolean NOT NULL DEFAULT false,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_balance_adjustments_on_user_id ON balance_adjustments(user_id);
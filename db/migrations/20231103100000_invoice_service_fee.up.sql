@@ -0,0 +1 @@
+alter table invoices add column service_fee bigint;
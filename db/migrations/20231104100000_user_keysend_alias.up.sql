@@ -0,0 +1 @@
+alter table users add column keysend_alias character varying unique;
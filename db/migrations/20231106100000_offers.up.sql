@@ -0,0 +1,12 @@
+CREATE TABLE offers (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    offer_id character varying NOT NULL UNIQUE,
+    bolt12 text NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_offers_on_user_id ON offers(user_id);
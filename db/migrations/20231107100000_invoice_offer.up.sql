@@ -0,0 +1 @@
+alter table invoices add column offer text;
@@ -0,0 +1,4 @@
+alter table invoices add column client_invoice_id character varying;
+create unique index if not exists index_invoices_on_user_id_client_invoice_id
+  on invoices(user_id, client_invoice_id)
+  where client_invoice_id is not null;
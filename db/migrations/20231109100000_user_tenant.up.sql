@@ -0,0 +1,2 @@
+alter table users add column tenant_id character varying;
+create index if not exists index_users_on_tenant_id on users(tenant_id);
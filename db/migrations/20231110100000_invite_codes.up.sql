@@ -0,0 +1,9 @@
+CREATE TABLE invite_codes (
+    id BIGSERIAL PRIMARY KEY,
+    code character varying NOT NULL UNIQUE,
+    max_uses bigint NOT NULL,
+    uses bigint NOT NULL DEFAULT 0,
+    expires_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT invite_code_uses CHECK (uses <= max_uses)
+);
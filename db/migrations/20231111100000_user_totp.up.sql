@@ -0,0 +1,16 @@
+alter table users add column totp_secret character varying;
+alter table users add column totp_enabled boolean not null default false;
+alter table users add column totp_last_step bigint not null default 0;
+
+CREATE TABLE totp_backup_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    code_hash character varying NOT NULL,
+    used_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS index_totp_backup_codes_on_user_id ON totp_backup_codes(user_id);
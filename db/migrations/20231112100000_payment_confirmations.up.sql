@@ -0,0 +1,20 @@
+CREATE TABLE payment_confirmations (
+    id BIGSERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token character varying NOT NULL UNIQUE,
+    payment_request character varying NOT NULL,
+    offer character varying,
+    pay_req jsonb NOT NULL,
+    max_parts bigint NOT NULL DEFAULT 0,
+    fee_limit_sat bigint NOT NULL DEFAULT 0,
+    fee_limit_percent double precision NOT NULL DEFAULT 0,
+    timeout_seconds bigint NOT NULL DEFAULT 0,
+    label character varying,
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY(user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		// every user gets an adjustments account, the counterpart of the balance adjustments made by admins
+		accountsSql := `
+			INSERT INTO accounts (user_id, type)
+			SELECT users.id, 'adjustments' FROM users
+			WHERE NOT EXISTS (SELECT 1 FROM accounts WHERE accounts.user_id = users.id AND accounts.type = 'adjustments');
+		`
+		if _, err := db.Exec(accountsSql); err != nil {
+			return err
+		}
+
+		if db.Dialect().Name().String() != "pg" {
+			fmt.Printf("\033[1;31m%s\033[0m", "You are not using PostgreSQL. DB level checks can not be enabled!\n")
+			return nil
+		}
+		sql := `
+			-- make sure that account balances >= 0 (except for incoming, fees and adjustments accounts)
+				CREATE OR REPLACE FUNCTION check_balance()
+					RETURNS TRIGGER AS $$
+				DECLARE
+					sum BIGINT;
+					debit_account_type VARCHAR;
+					credit_account_type VARCHAR;
+				BEGIN
+
+					-- LOCK the account if the transaction is not from an incoming or adjustments account
+					--  This makes sure we always check the balance of the account before commiting a transaction
+					--  (incoming and adjustments accounts can be negative, so we do not care about those)
+					SELECT INTO debit_account_type type
+					FROM accounts
+					WHERE id = NEW.debit_account_id AND type NOT IN ('incoming', 'adjustments')
+					FOR UPDATE;
+
+					-- check if credit_account type is fees or adjustments, then we don't check for negative balance constraint.
+					--  Forced balance adjustments of admins can make the balance negative, the balance of other adjustments
+					--  is checked by the service
+					SELECT INTO credit_account_type type
+					FROM accounts
+					WHERE id = NEW.credit_account_id AND type NOT IN ('fees', 'adjustments')
+					FOR UPDATE;
+
+					-- If it is an debit incoming or adjustments account or a fees or adjustments credit account return; otherwise check the balance
+					IF debit_account_type IS NULL OR credit_account_type IS NULL
+					THEN
+						RETURN NEW;
+					END IF;
+
+					-- Calculate the account balance
+					SELECT INTO sum SUM(amount)
+					FROM account_ledgers
+					WHERE account_ledgers.account_id = NEW.debit_account_id;
+
+					-- IF the account would go negative raise an exception
+					IF sum < 0
+					THEN
+						RAISE EXCEPTION 'invalid balance [user_id:%] [debit_account_id:%] balance [%]',
+						NEW.user_id,
+						NEW.debit_account_id,
+						sum;
+					END IF;
+					RETURN NEW;
+				END;
+				$$ LANGUAGE plpgsql;
+		`
+		if _, err := db.Exec(sql); err != nil {
+			return err
+		}
+		return nil
+	}, nil)
+}
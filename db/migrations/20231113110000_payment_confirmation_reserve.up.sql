@@ -0,0 +1,4 @@
+alter table payment_confirmations add column payment_type character varying not null default 'bolt11';
+alter table payment_confirmations add column request jsonb;
+alter table payment_confirmations add column amount bigint not null default 0;
+CREATE INDEX IF NOT EXISTS index_payment_confirmations_on_user_id ON payment_confirmations(user_id) WHERE used_at IS NULL;
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ApiKey : long-lived key of a user, only the hash of the key is stored
+type ApiKey struct {
+	ID         int64        `bun:",pk,autoincrement"`
+	UserID     int64        `bun:",notnull"`
+	User       *User        `bun:"rel:belongs-to,join:user_id=id"`
+	Name       string       `bun:",notnull"`
+	KeyHash    string       `bun:",notnull"`
+	Scopes     []string     `bun:",array"`
+	LastUsedAt bun.NullTime `bun:",nullzero"`
+	RevokedAt  bun.NullTime `bun:",nullzero"`
+	CreatedAt  time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+}
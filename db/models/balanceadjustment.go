@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// BalanceAdjustment : audit record of a balance change made by an admin, positive amounts credit the user
+type BalanceAdjustment struct {
+	ID        int64     `bun:",pk,autoincrement"`
+	UserID    int64     `bun:",notnull"`
+	User      *User     `bun:"rel:belongs-to,join:user_id=id"`
+	InvoiceID int64     `bun:",notnull"`
+	Amount    int64     `bun:",notnull"`
+	Reason    string    `bun:",notnull"`
+	Admin     string    `bun:",notnull"`
+	Force     bool      `bun:",notnull"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// BalanceSnapshot : balance of a user at a point in time
+type BalanceSnapshot struct {
+	ID        int64     `bun:",pk,autoincrement"`
+	UserID    int64     `bun:",notnull"`
+	User      *User     `bun:"rel:belongs-to,join:user_id=id"`
+	Balance   int64     `bun:",notnull"`
+	Timestamp time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// InviteCode : code for creating accounts, it can be used MaxUses times until it expires
+type InviteCode struct {
+	ID        int64        `bun:",pk,autoincrement"`
+	Code      string       `bun:",unique,notnull"`
+	MaxUses   int64        `bun:",notnull"`
+	Uses      int64        `bun:",notnull,default:0"`
+	ExpiresAt bun.NullTime `bun:",nullzero"`
+	CreatedAt time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+}
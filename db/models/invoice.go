@@ -9,28 +9,50 @@ import (
 
 // Invoice : Invoice Model
 type Invoice struct {
-	ID                       int64             `json:"id" bun:",pk,autoincrement"`
-	Type                     string            `json:"type" validate:"required"`
-	UserID                   int64             `json:"user_id" validate:"required"`
-	User                     *User             `json:"-" bun:"rel:belongs-to,join:user_id=id"`
-	Amount                   int64             `json:"amount" validate:"gte=0"`
-	Fee                      int64             `json:"fee" bun:",nullzero"`
+	ID         int64  `json:"id" bun:",pk,autoincrement"`
+	Type       string `json:"type" validate:"required"`
+	UserID     int64  `json:"user_id" validate:"required"`
+	User       *User  `json:"-" bun:"rel:belongs-to,join:user_id=id"`
+	Amount     int64  `json:"amount" validate:"gte=0"`
+	Fee        int64  `json:"fee" bun:",nullzero"`
+	ServiceFee int64  `json:"service_fee,omitempty" bun:",nullzero"`
+	// the number of times an outgoing payment was sent to the node, see PAYMENT_MAX_RETRIES
+	PaymentAttempts          int               `json:"payment_attempts,omitempty" bun:",nullzero"`
 	Memo                     string            `json:"memo" bun:",nullzero"`
+	Label                    string            `json:"label,omitempty" bun:",nullzero"`
 	DescriptionHash          string            `json:"description_hash,omitempty" bun:",nullzero"`
+	ZapRequest               string            `json:"zap_request,omitempty" bun:",nullzero"`
+	FiatCurrency             string            `json:"fiat_currency,omitempty" bun:",nullzero"`
+	FiatAmount               float64           `json:"fiat_amount,omitempty" bun:",nullzero"`
+	FiatRate                 float64           `json:"fiat_rate,omitempty" bun:",nullzero"` // price of one bitcoin when the invoice was created
 	PaymentRequest           string            `json:"payment_request" bun:",nullzero"`
+	Offer                    string            `json:"offer,omitempty" bun:",nullzero"` // the bolt12 offer an outgoing payment was made to
 	DestinationPubkeyHex     string            `json:"destination_pubkey_hex" bun:",notnull"`
 	DestinationCustomRecords map[uint64][]byte `json:"custom_records,omitempty"`
 	RHash                    string            `json:"r_hash"`
 	Preimage                 string            `json:"preimage" bun:",nullzero"`
 	Internal                 bool              `json:"-" bun:",nullzero"`
 	Keysend                  bool              `json:"keysend" bun:",nullzero"`
+	IsHold                   bool              `json:"is_hold" bun:",nullzero"`
 	State                    string            `json:"state" bun:",default:'initialized'"`
 	ErrorMessage             string            `json:"error_message,omitempty" bun:",nullzero"`
 	AddIndex                 uint64            `json:"-" bun:",nullzero"`
+	IdempotencyKey           string            `json:"-" bun:",nullzero"`
+	IdempotencyHash          string            `json:"-" bun:",nullzero"`
+	ClientInvoiceID          string            `json:"client_invoice_id,omitempty" bun:",nullzero"`
+	Expiry                   int64             `json:"expiry" bun:",nullzero"` // in seconds
 	CreatedAt                time.Time         `json:"created_at" bun:",nullzero,notnull,default:current_timestamp"`
 	ExpiresAt                bun.NullTime      `json:"expires_at" bun:",nullzero"`
 	UpdatedAt                bun.NullTime      `json:"updated_at"`
 	SettledAt                bun.NullTime      `json:"settled_at"`
+	// MaxParts is only used when sending the payment and is not persisted
+	MaxParts uint32 `json:"-" bun:"-"`
+	// FeeLimit is the fee limit requested by the client, 0 uses the fee limit of the server.
+	// It is only used when sending the payment and is not persisted
+	FeeLimit int64 `json:"-" bun:"-"`
+	// PrivateRouteHints adds route hints for the private channels of the node to the payment request.
+	// It is only used when the invoice is created on the node and is not persisted
+	PrivateRouteHints bool `json:"-" bun:"-"`
 }
 
 func (i *Invoice) BeforeAppendModel(ctx context.Context, query bun.Query) error {
@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+// InvoiceSubscriptionState : last settle index of a node that was processed by the invoice subscription
+type InvoiceSubscriptionState struct {
+	Pubkey      string    `bun:",pk"`
+	SettleIndex uint64    `bun:",notnull"`
+	UpdatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
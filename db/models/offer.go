@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// Offer : reusable bolt12 offer of the node that belongs to a user, the payments to it are credited to the user
+type Offer struct {
+	ID        int64     `bun:",pk,autoincrement"`
+	UserID    int64     `bun:",notnull"`
+	User      *User     `bun:"rel:belongs-to,join:user_id=id"`
+	OfferID   string    `bun:",unique,notnull"`
+	Bolt12    string    `bun:",notnull"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
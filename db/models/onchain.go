@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	OnchainDepositStatePending  = "pending"
+	OnchainDepositStateCredited = "credited"
+	// the amount did not cover the deposit fee, nothing was credited
+	OnchainDepositStateBelowFee = "below_fee"
+)
+
+// OnchainAddress : on-chain address of the node that belongs to a user
+type OnchainAddress struct {
+	ID        int64     `bun:",pk,autoincrement"`
+	UserID    int64     `bun:",notnull"`
+	User      *User     `bun:"rel:belongs-to,join:user_id=id"`
+	Address   string    `bun:",unique,notnull"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// OnchainDeposit : output of a wallet transaction that pays to a deposit address,
+// identified by tx_hash and output_index
+type OnchainDeposit struct {
+	ID            int64        `bun:",pk,autoincrement"`
+	UserID        int64        `bun:",notnull"`
+	User          *User        `bun:"rel:belongs-to,join:user_id=id"`
+	Address       string       `bun:",notnull"`
+	TxHash        string       `bun:",notnull"`
+	OutputIndex   int64        `bun:",notnull"`
+	Amount        int64        `bun:",notnull"`
+	Fee           int64        `bun:",notnull"`
+	Confirmations int32        `bun:",notnull"`
+	BlockHeight   int32        `bun:",nullzero"`
+	State         string       `bun:",notnull"`
+	InvoiceID     int64        `bun:",nullzero"`
+	CreatedAt     time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+	CreditedAt    bun.NullTime `bun:",nullzero"`
+}
+
+// OnchainWithdrawal : on-chain payment of a user, the amount and the fee are booked on the outgoing invoice
+type OnchainWithdrawal struct {
+	ID          int64     `bun:",pk,autoincrement"`
+	UserID      int64     `bun:",notnull"`
+	User        *User     `bun:"rel:belongs-to,join:user_id=id"`
+	InvoiceID   int64     `bun:",notnull"`
+	Address     string    `bun:",notnull"`
+	Amount      int64     `bun:",notnull"`
+	Fee         int64     `bun:",notnull"`
+	SatPerVbyte int64     `bun:",notnull"`
+	TxHash      string    `bun:",unique,notnull"`
+	CreatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
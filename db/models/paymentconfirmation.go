@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// PaymentConfirmation : payment above the confirmation threshold that is only sent once the token is posted back
+type PaymentConfirmation struct {
+	ID             int64  `bun:",pk,autoincrement"`
+	UserID         int64  `bun:",notnull"`
+	User           *User  `bun:"rel:belongs-to,join:user_id=id"`
+	Token          string `bun:",unique,notnull"`
+	PaymentType    string `bun:",notnull,default:'bolt11'"`
+	PaymentRequest string `bun:",notnull"`
+	Offer          string `bun:",nullzero"`
+	// PayReq is the decoded payment request including the amount chosen for zero-amount invoices
+	PayReq json.RawMessage `bun:"type:jsonb,notnull"`
+	// Request is the request body of keysend payments and on-chain withdrawals
+	Request json.RawMessage `bun:"type:jsonb,nullzero"`
+	// Amount is the balance that is reserved for the payment and its fees until it is confirmed or expired
+	Amount          int64        `bun:",notnull,default:0"`
+	MaxParts        uint32       `bun:",notnull,default:0"`
+	FeeLimitSat     int64        `bun:",notnull,default:0"`
+	FeeLimitPercent float64      `bun:",notnull,default:0"`
+	TimeoutSeconds  int64        `bun:",notnull,default:0"`
+	Label           string       `bun:",nullzero"`
+	ExpiresAt       time.Time    `bun:",notnull"`
+	UsedAt          bun.NullTime `bun:",nullzero"`
+	CreatedAt       time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+}
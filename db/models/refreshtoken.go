@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// RefreshToken : issued refresh token, every use of a refresh token issues a new one of the same family
+type RefreshToken struct {
+	JTI                  string       `bun:"jti,pk"`
+	UserID               int64        `bun:",notnull"`
+	User                 *User        `bun:"rel:belongs-to,join:user_id=id"`
+	FamilyID             string       `bun:",notnull"`
+	AccessTokenJTI       string       `bun:"access_token_jti,notnull"`
+	AccessTokenExpiresAt time.Time    `bun:",notnull"`
+	ExpiresAt            time.Time    `bun:",notnull"`
+	UsedAt               bun.NullTime `bun:",nullzero"`
+	RevokedAt            bun.NullTime `bun:",nullzero"`
+	CreatedAt            time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+}
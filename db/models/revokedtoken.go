@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken : JWT that was revoked before its expiry
+type RevokedToken struct {
+	JTI       string    `bun:"jti,pk"`
+	UserID    int64     `bun:",notnull"`
+	User      *User     `bun:"rel:belongs-to,join:user_id=id"`
+	ExpiresAt time.Time `bun:",notnull"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// TotpBackupCode : single use code that replaces a TOTP code, e.g. if the authenticator is lost
+type TotpBackupCode struct {
+	ID        int64        `bun:",pk,autoincrement"`
+	UserID    int64        `bun:",notnull"`
+	CodeHash  string       `bun:",notnull"`
+	UsedAt    bun.NullTime `bun:",nullzero"`
+	CreatedAt time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+}
@@ -11,6 +11,10 @@ const (
 	EntryTypeFeeReserve         = "fee_reserve"
 	EntryTypeFeeReserveReversal = "fee_reserve_reversal"
 	EntryTypeOutgoingReversal   = "outgoing_reversal"
+	EntryTypeAdminAdjustment    = "admin_adjustment"
+	EntryTypeServiceFee         = "service_fee"
+	EntryTypeReceiveFee         = "receive_fee"
+	EntryTypeBelowMinReceive    = "below_min_receive"
 )
 
 // TransactionEntry : Transaction Entries Model
@@ -30,4 +34,6 @@ type TransactionEntry struct {
 	Amount          int64             `bun:",notnull"`
 	CreatedAt       time.Time         `bun:",nullzero,notnull,default:current_timestamp"`
 	EntryType       string
+	// identifies the transaction outside of the ledger if there is no payment hash, e.g. the on-chain txid
+	Reference string `bun:",nullzero"`
 }
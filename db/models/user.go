@@ -19,6 +19,24 @@ type User struct {
 	Invoices    []*Invoice `bun:"rel:has-many,join:id=user_id"`
 	Accounts    []*Account `bun:"rel:has-many,join:id=user_id"`
 	Deactivated bool
+	// LightningAddress is the lowercased username of the user's lightning address
+	LightningAddress sql.NullString `bun:",unique"`
+	// MaxDailyOutboundSats overrides the configured daily sending limit of the user, 0 means unlimited
+	MaxDailyOutboundSats sql.NullInt64
+	// TokenEpoch is increased to revoke all tokens issued to the user before
+	TokenEpoch int64 `bun:",notnull,default:0"`
+	// Suspended users can't use the API, or only can't send when SuspendMode is send_only
+	Suspended   bool   `bun:",notnull,default:false"`
+	SuspendMode string `bun:",nullzero"`
+	// KeysendAlias identifies the user in keysend payments to the node, in the custom record 696971
+	KeysendAlias sql.NullString `bun:",unique"`
+	// TenantID is the brand the user belongs to, empty for the default tenant. It can't be changed
+	TenantID string `bun:",nullzero"`
+	// payments need a TOTP or backup code once TotpEnabled is set, the secret is stored when the user enrolls
+	TotpSecret  string `bun:",nullzero"`
+	TotpEnabled bool   `bun:",notnull,default:false"`
+	// TotpLastStep is the time step of the last accepted code, codes can't be used twice
+	TotpLastStep int64 `bun:",notnull,default:0"`
 }
 
 func (u *User) BeforeAppendModel(ctx context.Context, query bun.Query) error {
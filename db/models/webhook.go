@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Webhook : subscription of a user to payment events
+type Webhook struct {
+	ID                 int64        `bun:",pk,autoincrement"`
+	UserID             int64        `bun:",notnull"`
+	User               *User        `bun:"rel:belongs-to,join:user_id=id"`
+	Url                string       `bun:",notnull"`
+	Secret             string       `bun:",notnull"`
+	Events             []string     `bun:",array"`
+	LastDeliveryStatus int          `bun:",nullzero"`
+	LastDeliveryError  string       `bun:",nullzero"`
+	LastDeliveryAt     bun.NullTime `bun:",nullzero"`
+	CreatedAt          time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+}
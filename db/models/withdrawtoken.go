@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// WithdrawToken : single-use LNURL-withdraw token
+type WithdrawToken struct {
+	ID        int64        `bun:",pk,autoincrement"`
+	UserID    int64        `bun:",notnull"`
+	User      *User        `bun:"rel:belongs-to,join:user_id=id"`
+	Token     string       `bun:",unique,notnull"`
+	MaxAmount int64        `bun:",notnull"`
+	UsedAt    bun.NullTime `bun:",nullzero"`
+	CreatedAt time.Time    `bun:",nullzero,notnull,default:current_timestamp"`
+}
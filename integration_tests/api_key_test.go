@@ -0,0 +1,168 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ApiKeyTestSuite struct {
+	TestSuite
+	service   *service.LndhubService
+	userToken string
+}
+
+func (suite *ApiKeyTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	secured := suite.echo.Group("", suite.service.ApiKeyMiddleware(), tokens.Middleware(suite.service.Config.JWTSecret), suite.service.TokenRevocationMiddleware())
+	apiKeyCtrl := v2controllers.NewApiKeyController(suite.service)
+	secured.POST("/v2/apikeys", apiKeyCtrl.CreateApiKey)
+	secured.GET("/v2/apikeys", apiKeyCtrl.ListApiKeys)
+	secured.DELETE("/v2/apikeys/:id", apiKeyCtrl.RevokeApiKey)
+	secured.GET("/balance", controllers.NewBalanceController(suite.service).Balance)
+	secured.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	secured.POST("/auth/revoke-all", controllers.NewAuthController(suite.service).RevokeAll)
+	secured.POST("/v2/invoices/batch", v2controllers.NewInvoiceController(suite.service).AddInvoiceBatch, tokens.RequireScope(common.ScopeInvoice))
+}
+
+func (suite *ApiKeyTestSuite) TearDownSuite() {
+	clearTable(suite.service, "api_keys")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ApiKeyTestSuite) TestApiKey() {
+	readKey := suite.createApiKey("read only", []string{common.ScopeRead})
+	assert.True(suite.T(), strings.HasPrefix(readKey.Key, common.ApiKeyPrefix))
+
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", readKey.Key, nil).Code)
+	// the read scope does not allow to create invoices
+	rec := suite.request(http.MethodPost, "/addinvoice", readKey.Key, &ExpectedAddInvoiceRequestBody{Amount: 100})
+	assert.Equal(suite.T(), http.StatusForbidden, rec.Code)
+	// keys with scopes can't manage API keys
+	rec = suite.request(http.MethodPost, "/v2/apikeys", readKey.Key, &v2controllers.CreateApiKeyRequestBody{Name: "other"})
+	assert.Equal(suite.T(), http.StatusForbidden, rec.Code)
+
+	invoiceKey := suite.createApiKey("invoices", []string{common.ScopeInvoice})
+	rec = suite.request(http.MethodPost, "/addinvoice", invoiceKey.Key, &ExpectedAddInvoiceRequestBody{Amount: 100})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	// the secret is only returned once and the last use is tracked
+	rec = suite.request(http.MethodGet, "/v2/apikeys", suite.userToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	apiKeys := []v2controllers.ApiKey{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(&apiKeys))
+	assert.Equal(suite.T(), 2, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		assert.Empty(suite.T(), apiKey.Key)
+		assert.False(suite.T(), apiKey.LastUsedAt.IsZero())
+	}
+
+	// revoked keys are rejected
+	rec = suite.request(http.MethodDelete, fmt.Sprintf("/v2/apikeys/%d", readKey.ID), suite.userToken, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, rec.Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", readKey.Key, nil).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", common.ApiKeyPrefix+"unknown", nil).Code)
+
+	// JWTs still work
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", suite.userToken, nil).Code)
+}
+
+func (suite *ApiKeyTestSuite) TestApiKeyInvoiceBatch() {
+	batch := &v2controllers.AddInvoiceBatchRequestBody{
+		Invoices: []v2controllers.BatchInvoiceRequestBody{{Amount: 100}, {Amount: 200}},
+	}
+	readKey := suite.createApiKey("read only batch", []string{common.ScopeRead})
+	assert.Equal(suite.T(), http.StatusForbidden, suite.request(http.MethodPost, "/v2/invoices/batch", readKey.Key, batch).Code)
+
+	invoiceKey := suite.createApiKey("invoices batch", []string{common.ScopeInvoice})
+	rec := suite.request(http.MethodPost, "/v2/invoices/batch", invoiceKey.Key, batch)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.AddInvoiceBatchResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), 2, len(response.Invoices))
+	for _, result := range response.Invoices {
+		assert.Equal(suite.T(), v2controllers.BatchInvoiceStatusCreated, result.Status)
+	}
+}
+
+func (suite *ApiKeyTestSuite) TestApiKeyRevokeAll() {
+	// another user, so the token of the suite stays valid
+	_, userTokens, err := createUsers(suite.service, 1)
+	assert.NoError(suite.T(), err)
+	userId := getUserIdFromToken(userTokens[0])
+	_, key, err := suite.service.CreateApiKey(context.Background(), userId, "compromised", []string{common.ScopeRead})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", key, nil).Code)
+
+	assert.Equal(suite.T(), http.StatusNoContent, suite.request(http.MethodPost, "/auth/revoke-all", userTokens[0], nil).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", key, nil).Code)
+	apiKeys, err := suite.service.FindApiKeys(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), apiKeys)
+	// the keys of other users are not revoked
+	apiKeys, err = suite.service.FindApiKeys(context.Background(), getUserIdFromToken(suite.userToken))
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), apiKeys)
+}
+
+func (suite *ApiKeyTestSuite) createApiKey(name string, scopes []string) *v2controllers.ApiKey {
+	rec := suite.request(http.MethodPost, "/v2/apikeys", suite.userToken, &v2controllers.CreateApiKeyRequestBody{
+		Name:   name,
+		Scopes: scopes,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	apiKey := &v2controllers.ApiKey{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(apiKey))
+	return apiKey
+}
+
+func (suite *ApiKeyTestSuite) request(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	if body != nil {
+		assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestApiKeyTestSuite(t *testing.T) {
+	suite.Run(t, new(ApiKeyTestSuite))
+}
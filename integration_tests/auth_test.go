@@ -20,6 +20,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type UserAuthTestSuite struct {
@@ -89,6 +90,85 @@ func (suite *UserAuthTestSuite) TestAuth() {
 	fmt.Printf("Succesfully got a token using refresh token only: %s\n", responseBody.AccessToken)
 }
 
+func (suite *UserAuthTestSuite) TestAuthRefreshTokenRotation() {
+	rec := suite.auth(&ExpectedAuthRequestBody{
+		Login:    suite.userLogin.Login,
+		Password: suite.userLogin.Password,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	responseBody := &ExpectedAuthResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(responseBody))
+	assert.WithinDuration(suite.T(), time.Now().Add(time.Duration(suite.Service.Config.JWTAccessTokenExpiry)*time.Second), responseBody.AccessTokenExpiresAt, time.Minute)
+	assert.WithinDuration(suite.T(), time.Now().Add(time.Duration(suite.Service.Config.JWTRefreshTokenExpiry)*time.Second), responseBody.RefreshTokenExpiresAt, time.Minute)
+
+	// every use of a refresh token issues a new one
+	refreshToken := responseBody.RefreshToken
+	for i := 0; i < 3; i++ {
+		rec = suite.auth(&ExpectedAuthRequestBody{
+			RefreshToken: refreshToken,
+		})
+		assert.Equal(suite.T(), http.StatusOK, rec.Code)
+		responseBody = &ExpectedAuthResponseBody{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(responseBody))
+		assert.NotEmpty(suite.T(), responseBody.AccessToken)
+		assert.NotEqual(suite.T(), refreshToken, responseBody.RefreshToken)
+		refreshToken = responseBody.RefreshToken
+	}
+}
+
+func (suite *UserAuthTestSuite) TestAuthRefreshTokenReuse() {
+	rec := suite.auth(&ExpectedAuthRequestBody{
+		Login:    suite.userLogin.Login,
+		Password: suite.userLogin.Password,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	loginResponse := &ExpectedAuthResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(loginResponse))
+
+	rec = suite.auth(&ExpectedAuthRequestBody{
+		RefreshToken: loginResponse.RefreshToken,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rotatedResponse := &ExpectedAuthResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(rotatedResponse))
+
+	// the old refresh token is used again, e.g. because it was stolen
+	rec = suite.auth(&ExpectedAuthRequestBody{
+		RefreshToken: loginResponse.RefreshToken,
+	})
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+
+	// the whole chain is revoked, including the refresh and access token issued last
+	rec = suite.auth(&ExpectedAuthRequestBody{
+		RefreshToken: rotatedResponse.RefreshToken,
+	})
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+	userId := getUserIdFromToken(rotatedResponse.AccessToken)
+	jti, epoch, err := tokens.ParseRevocationClaims(suite.Service.Config.JWTSecret, rotatedResponse.AccessToken)
+	assert.NoError(suite.T(), err)
+	revoked, err := suite.Service.IsTokenRevoked(context.Background(), userId, jti, epoch)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), revoked)
+
+	// the user can log in again
+	rec = suite.auth(&ExpectedAuthRequestBody{
+		Login:    suite.userLogin.Login,
+		Password: suite.userLogin.Password,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+}
+
+func (suite *UserAuthTestSuite) auth(body *ExpectedAuthRequestBody) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	req := httptest.NewRequest(http.MethodPost, "/auth", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := suite.echo.NewContext(req, rec)
+	assert.NoError(suite.T(), controllers.NewAuthController(suite.Service).Auth(c))
+	return rec
+}
+
 func (suite *UserAuthTestSuite) TestAuthWithExpiredRefreshToken() {
 	// log in with login and password
 	var buf bytes.Buffer
@@ -111,7 +191,7 @@ func (suite *UserAuthTestSuite) TestAuthWithExpiredRefreshToken() {
 	user, _ := suite.Service.FindUser(context.Background(), userId)
 
 	// expire in 0 seconds, with correct secret and user
-	expiredRefreshToken, _ := tokens.GenerateRefreshToken(suite.Service.Config.JWTSecret, 0, user)
+	expiredRefreshToken, _, _ := tokens.GenerateRefreshToken(suite.Service.Config.JWTSecret, 0, user, nil)
 
 	// login again with only expired refresh token
 	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedAuthRequestBody{
@@ -157,7 +237,7 @@ func (suite *UserAuthTestSuite) TestAuthWithInvalidSecretRefreshToken() {
 	user, _ := suite.Service.FindUser(context.Background(), userId)
 
 	// only secret is invalid here
-	expiredRefreshToken, _ := tokens.GenerateRefreshToken([]byte("INVALID SECRET"), suite.Service.Config.JWTRefreshTokenExpiry, user)
+	expiredRefreshToken, _, _ := tokens.GenerateRefreshToken([]byte("INVALID SECRET"), suite.Service.Config.JWTRefreshTokenExpiry, user, nil)
 
 	// login again with only refresh token
 	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedAuthRequestBody{
@@ -199,7 +279,7 @@ func (suite *UserAuthTestSuite) TestAuthWithInvalidUserIdRefreshToken() {
 	userId := getUserIdFromToken(responseBody.AccessToken)
 	user, _ := suite.Service.FindUser(context.Background(), userId+1)
 
-	expiredRefreshToken, _ := tokens.GenerateRefreshToken(suite.Service.Config.JWTSecret, suite.Service.Config.JWTRefreshTokenExpiry, user)
+	expiredRefreshToken, _, _ := tokens.GenerateRefreshToken(suite.Service.Config.JWTSecret, suite.Service.Config.JWTRefreshTokenExpiry, user, nil)
 
 	// login again with only refresh token
 	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedAuthRequestBody{
@@ -277,6 +357,38 @@ func (suite *UserAuthTestSuite) TestAuthWithNotParseableRefreshToken() {
 	assert.Equal(suite.T(), responses.BadAuthError.Error, errorResponse.Error)
 }
 
+func (suite *UserAuthTestSuite) TestAuthRehashesPassword() {
+	suite.Service.Config.PasswordHashCost = service.PasswordHashCost(bcrypt.MinCost)
+	user, err := suite.Service.CreateUser(context.Background(), "", "")
+	assert.NoError(suite.T(), err)
+	// logins after the cost was raised rehash the password
+	suite.Service.Config.PasswordHashCost = service.PasswordHashCost(bcrypt.MinCost + 1)
+	defer func() { suite.Service.Config.PasswordHashCost = 0 }()
+
+	storedCost := func() int {
+		stored, err := suite.Service.FindUser(context.Background(), user.ID)
+		assert.NoError(suite.T(), err)
+		cost, err := bcrypt.Cost([]byte(stored.Password))
+		assert.NoError(suite.T(), err)
+		assert.NoError(suite.T(), bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte(user.Password)))
+		return cost
+	}
+	assert.Equal(suite.T(), bcrypt.MinCost, storedCost())
+
+	// a failed login doesn't change the hash
+	rec := suite.auth(&ExpectedAuthRequestBody{Login: user.Login, Password: "wrong password"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+	assert.Equal(suite.T(), bcrypt.MinCost, storedCost())
+
+	rec = suite.auth(&ExpectedAuthRequestBody{Login: user.Login, Password: user.Password})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Equal(suite.T(), bcrypt.MinCost+1, storedCost())
+
+	// the new hash verifies
+	rec = suite.auth(&ExpectedAuthRequestBody{Login: user.Login, Password: user.Password})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+}
+
 func TestUserAuthTestSuite(t *testing.T) {
 	suite.Run(t, new(UserAuthTestSuite))
 }
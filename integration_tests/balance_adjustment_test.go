@@ -0,0 +1,152 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const adjustmentTestAdminToken = "admin_token"
+
+var adjustmentTestNamedAdminTokens = map[string]string{"alice": "alice_token", "bob": "bob_token"}
+
+type BalanceAdjustmentTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+	userId  int64
+}
+
+func (suite *BalanceAdjustmentTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	users, _, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	user, err := svc.FindUserByLogin(context.Background(), users[0].Login)
+	if err != nil {
+		log.Fatalf("Error finding test user: %v", err)
+	}
+	suite.service = svc
+	suite.userId = user.ID
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/v2/admin/users/:id/adjust", v2controllers.NewAdjustBalanceController(svc).AdjustBalance, tokens.NamedAdminTokenMiddleware(adjustmentTestAdminToken, adjustmentTestNamedAdminTokens))
+}
+
+func (suite *BalanceAdjustmentTestSuite) TearDownSuite() {
+	clearTable(suite.service, "balance_adjustments")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *BalanceAdjustmentTestSuite) adjust(userId int64, body string, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v2/admin/users/%d/adjust", userId), bytes.NewBufferString(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *BalanceAdjustmentTestSuite) TestAdjustBalance() {
+	ctx := context.Background()
+	alice, bob := adjustmentTestNamedAdminTokens["alice"], adjustmentTestNamedAdminTokens["bob"]
+	// the admin in the body is ignored, the adjustment is attributed to the token
+	rec := suite.adjust(suite.userId, `{"amount":1000,"reason":"refund of a failed order","admin":"mallory"}`, alice)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.AdjustBalanceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), int64(1000), response.Amount)
+	assert.Equal(suite.T(), int64(1000), response.Balance)
+	assert.Equal(suite.T(), "alice", response.Admin)
+
+	// debits are rejected if they exceed the balance
+	rec = suite.adjust(suite.userId, `{"amount":-1500,"reason":"chargeback"}`, alice)
+	assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, checkErrResponse(&suite.TestSuite, rec).Message)
+	balance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+
+	rec = suite.adjust(suite.userId, `{"amount":-400,"reason":"promotion ended"}`, bob)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), int64(600), response.Balance)
+
+	// unless they are forced
+	rec = suite.adjust(suite.userId, `{"amount":-1000,"reason":"chargeback","force":true}`, adjustmentTestAdminToken)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), int64(-400), response.Balance)
+	balance, err = suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(-400), balance)
+
+	adjustments := []models.BalanceAdjustment{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(&adjustments).Where("user_id = ?", suite.userId).OrderExpr("id ASC").Scan(ctx))
+	assert.Equal(suite.T(), 3, len(adjustments))
+	assert.Equal(suite.T(), "refund of a failed order", adjustments[0].Reason)
+	assert.Equal(suite.T(), "alice", adjustments[0].Admin)
+	assert.Equal(suite.T(), "bob", adjustments[1].Admin)
+	assert.Equal(suite.T(), tokens.DefaultAdminName, adjustments[2].Admin)
+	assert.Equal(suite.T(), int64(-1000), adjustments[2].Amount)
+	assert.True(suite.T(), adjustments[2].Force)
+	assert.False(suite.T(), adjustments[2].CreatedAt.IsZero())
+
+	entries := []models.TransactionEntry{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(&entries).Where("user_id = ? AND entry_type = ?", suite.userId, models.EntryTypeAdminAdjustment).Scan(ctx))
+	assert.Equal(suite.T(), 3, len(entries))
+	// adjustments are booked to the adjustments account, they are neither incoming payments nor fee revenue
+	adjustmentAccount, err := suite.service.AccountFor(ctx, common.AccountTypeAdjustments, suite.userId)
+	assert.NoError(suite.T(), err)
+	for _, entry := range entries {
+		assert.True(suite.T(), entry.DebitAccountID == adjustmentAccount.ID || entry.CreditAccountID == adjustmentAccount.ID)
+	}
+	feeAccount, err := suite.service.AccountFor(ctx, common.AccountTypeFees, suite.userId)
+	assert.NoError(suite.T(), err)
+	feeEntries, err := suite.service.DB.NewSelect().Model((*models.TransactionEntry)(nil)).Where("credit_account_id = ? OR debit_account_id = ?", feeAccount.ID, feeAccount.ID).Count(ctx)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, feeEntries)
+	invoice := &models.Invoice{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(invoice).Where("id = ?", adjustments[0].InvoiceID).Scan(ctx))
+	assert.Equal(suite.T(), common.InvoiceTypeIncoming, invoice.Type)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, invoice.State)
+	suite.assertLedgerMatchesInvoices(suite.service, suite.userId)
+}
+
+func (suite *BalanceAdjustmentTestSuite) TestAdjustBalanceRejected() {
+	rec := suite.adjust(suite.userId, `{"amount":1000,"reason":"refund"}`, "wrong token")
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+	rec = suite.adjust(suite.userId+1000, `{"amount":1000,"reason":"refund"}`, adjustmentTestAdminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	rec = suite.adjust(suite.userId, `{"amount":1000}`, adjustmentTestAdminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func TestBalanceAdjustmentTestSuite(t *testing.T) {
+	suite.Run(t, new(BalanceAdjustmentTestSuite))
+}
@@ -0,0 +1,126 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type BalanceSnapshotTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	service                  *service.LndhubService
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *BalanceSnapshotTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 3)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.mlnd = mlnd
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.GET("/v2/balance/history", v2controllers.NewBalanceController(suite.service).BalanceHistory)
+}
+
+func (suite *BalanceSnapshotTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "balance_snapshots")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *BalanceSnapshotTestSuite) TestBalanceSnapshots() {
+	// fund the first user
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test balance snapshots", suite.userTokens[0])
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	// deactivated users are skipped
+	deactivated := true
+	_, err = suite.service.UpdateUser(context.Background(), getUserIdFromToken(suite.userTokens[2]), nil, nil, &deactivated, nil, nil)
+	assert.NoError(suite.T(), err)
+
+	start := time.Now().Add(-time.Second)
+	assert.NoError(suite.T(), suite.service.CreateBalanceSnapshots(context.Background()))
+
+	snapshots, err := suite.service.GetBalanceSnapshots(context.Background(), getUserIdFromToken(suite.userTokens[0]), time.Time{}, time.Time{})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(snapshots))
+	assert.Equal(suite.T(), int64(1000), snapshots[0].Balance)
+	snapshots, err = suite.service.GetBalanceSnapshots(context.Background(), getUserIdFromToken(suite.userTokens[1]), time.Time{}, time.Time{})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(snapshots))
+	assert.Equal(suite.T(), int64(0), snapshots[0].Balance)
+	snapshots, err = suite.service.GetBalanceSnapshots(context.Background(), getUserIdFromToken(suite.userTokens[2]), time.Time{}, time.Time{})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(snapshots))
+
+	rec := suite.getBalanceHistory(suite.userTokens[0], fmt.Sprintf("?from=%s", start.UTC().Format(time.RFC3339)))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	history := &v2controllers.BalanceHistoryResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(history))
+	assert.Equal(suite.T(), 1, len(history.Snapshots))
+	assert.Equal(suite.T(), int64(1000), history.Snapshots[0].Balance)
+
+	rec = suite.getBalanceHistory(suite.userTokens[0], fmt.Sprintf("?to=%s", start.Add(-time.Hour).UTC().Format(time.RFC3339)))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	history = &v2controllers.BalanceHistoryResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(history))
+	assert.Equal(suite.T(), 0, len(history.Snapshots))
+
+	rec = suite.getBalanceHistory(suite.userTokens[0], "?from=2021-01-01T00:00:00Z&to=2020-01-01T00:00:00Z")
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *BalanceSnapshotTestSuite) getBalanceHistory(token, query string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/balance/history"+query, nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBalanceSnapshotTestSuite(t *testing.T) {
+	suite.Run(t, new(BalanceSnapshotTestSuite))
+}
@@ -0,0 +1,127 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const batchBalanceTestAdminToken = "admin_token"
+
+type BatchBalanceTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userLogins               []ExpectedCreateUserResponseBody
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *BatchBalanceTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.MaxBatchBalanceIds = 5
+	userLogins, userTokens, err := createUsers(svc, 3)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userLogins = userLogins
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/v2/balances/batch", v2controllers.NewBalanceController(suite.service).BatchBalances, tokens.AdminTokenMiddleware(batchBalanceTestAdminToken))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *BatchBalanceTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *BatchBalanceTestSuite) batchBalances(userIds []int64, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.BatchBalanceRequestBody{UserIds: userIds}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/balances/batch", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *BatchBalanceTestSuite) TestBatchBalances() {
+	// fund the first two users, the last one has no transactions
+	for i, amount := range []int{1000, 250} {
+		invoiceResponse := suite.createAddInvoiceReq(amount, "integration test batch balances", suite.userTokens[i])
+		assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil))
+	}
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+
+	userIds := []int64{}
+	for _, login := range suite.userLogins {
+		user, err := suite.service.FindUserByLogin(context.Background(), login.Login)
+		assert.NoError(suite.T(), err)
+		userIds = append(userIds, user.ID)
+	}
+	// an id without a user is missing in the result
+	rec := suite.batchBalances(append(userIds, 999999), batchBalanceTestAdminToken)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.BatchBalanceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), len(userIds), len(response.Balances))
+	for _, userId := range userIds {
+		balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), balance, response.Balances[userId])
+	}
+	assert.Equal(suite.T(), int64(1000), response.Balances[userIds[0]])
+	assert.Equal(suite.T(), int64(250), response.Balances[userIds[1]])
+	assert.Equal(suite.T(), int64(0), response.Balances[userIds[2]])
+}
+
+func (suite *BatchBalanceTestSuite) TestBatchBalancesInvalid() {
+	for _, userIds := range [][]int64{nil, {}, {0}, {1, 2, 3, 4, 5, 6}} {
+		rec := suite.batchBalances(userIds, batchBalanceTestAdminToken)
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code, userIds)
+	}
+	rec := suite.batchBalances([]int64{1}, suite.userTokens[0])
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+}
+
+func TestBatchBalanceTestSuite(t *testing.T) {
+	suite.Run(t, new(BatchBalanceTestSuite))
+}
@@ -0,0 +1,139 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+)
+
+type ClientInvoiceIdTestSuite struct {
+	TestSuite
+	service    *service.LndhubService
+	mlnd       *MockLND
+	userTokens []string
+}
+
+// offlineAddInvoiceLND fails to create invoices
+type offlineAddInvoiceLND struct {
+	*MockLND
+}
+
+func (mlnd offlineAddInvoiceLND) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	return nil, errors.New("node is offline")
+}
+
+func (suite *ClientInvoiceIdTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/v2/invoices", v2controllers.NewInvoiceController(svc).AddInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *ClientInvoiceIdTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ClientInvoiceIdTestSuite) addInvoice(token string, body *v2controllers.AddInvoiceRequestBody) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/invoices", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *ClientInvoiceIdTestSuite) TestRepeatedClientInvoiceId() {
+	body := &v2controllers.AddInvoiceRequestBody{Amount: 100, Description: "integration test client invoice id", ClientInvoiceID: "order-1"}
+	rec := suite.addInvoice(suite.userTokens[0], body)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	first := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(first))
+	assert.Equal(suite.T(), "order-1", first.ClientInvoiceID)
+
+	// the retry returns the same invoice
+	rec = suite.addInvoice(suite.userTokens[0], body)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	repeated := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(repeated))
+	assert.Equal(suite.T(), first.PaymentHash, repeated.PaymentHash)
+	assert.Equal(suite.T(), first.PaymentRequest, repeated.PaymentRequest)
+
+	userId := getUserIdFromToken(suite.userTokens[0])
+	count, err := suite.service.PendingInvoiceCount(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+
+	// the id can't be used for a different invoice
+	for _, conflicting := range []*v2controllers.AddInvoiceRequestBody{
+		{Amount: 200, Description: body.Description, ClientInvoiceID: body.ClientInvoiceID},
+		{Amount: 100, Description: "another memo", ClientInvoiceID: body.ClientInvoiceID},
+	} {
+		rec = suite.addInvoice(suite.userTokens[0], conflicting)
+		assert.Equal(suite.T(), http.StatusConflict, rec.Code)
+		errorResponse := &responses.ErrorResponse{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+		assert.Equal(suite.T(), responses.ClientInvoiceIdConflictError.Message, errorResponse.Message)
+	}
+
+	// the ids are unique per user
+	rec = suite.addInvoice(suite.userTokens[1], body)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	other := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(other))
+	assert.NotEqual(suite.T(), first.PaymentHash, other.PaymentHash)
+}
+
+func (suite *ClientInvoiceIdTestSuite) TestClientInvoiceIdReleasedAfterNodeFailure() {
+	body := &v2controllers.AddInvoiceRequestBody{Amount: 300, Description: "integration test node failure", ClientInvoiceID: "order-2"}
+	suite.service.LndClient = offlineAddInvoiceLND{suite.mlnd}
+	rec := suite.addInvoice(suite.userTokens[1], body)
+	suite.service.LndClient = suite.mlnd
+	assert.Equal(suite.T(), http.StatusInternalServerError, rec.Code)
+
+	// the client can retry with the same id once the node is back
+	rec = suite.addInvoice(suite.userTokens[1], body)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.NotEmpty(suite.T(), response.PaymentRequest)
+}
+
+func TestClientInvoiceIdTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientInvoiceIdTestSuite))
+}
@@ -0,0 +1,105 @@
+package integration_tests
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConcurrentPaymentTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+	mlnd    *MockLND
+	userId  int64
+}
+
+func (suite *ConcurrentPaymentTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	mlnd.fee = 1
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.OnchainMinConfirmations = 1
+	svc.Config.OnchainDepositFee = 0
+	users, _, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	user, err := svc.FindUserByLogin(context.Background(), users[0].Login)
+	if err != nil {
+		log.Fatalf("Error finding test user: %v", err)
+	}
+	suite.service = svc
+	suite.userId = user.ID
+}
+
+func (suite *ConcurrentPaymentTestSuite) TearDownSuite() {
+	clearTable(suite.service, "onchain_deposits")
+	clearTable(suite.service, "onchain_addresses")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ConcurrentPaymentTestSuite) TestParallelPaymentsDoNotOverdraw() {
+	ctx := context.Background()
+	const funding = 1000
+	const amount = 300
+	const payments = 10
+	address, err := suite.service.OnchainAddress(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(ctx, depositTransaction("concurrentfundingtx", 1, 100, depositOutput(address.Address, 0, funding))))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < payments; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lnPayReq := &lnd.LNPayReq{
+				PayReq: &lnrpc.PayReq{
+					Destination: "0242898f86064c2fd72de22059c947a83ba23e9d97aedeae7b6dba647123f1d71b",
+					NumSatoshis: amount,
+				},
+				Keysend: true,
+			}
+			invoice, errResp := suite.service.AddOutgoingInvoice(ctx, suite.userId, "", lnPayReq)
+			if !assert.Nil(suite.T(), errResp) {
+				return
+			}
+			invoice.DestinationCustomRecords = map[uint64][]byte{}
+			_, err := suite.service.PayInvoice(ctx, invoice)
+			if err != nil {
+				assert.True(suite.T(), errors.Is(err, service.ErrNotEnoughBalance), "unexpected payment error: %v", err)
+				return
+			}
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	balance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.GreaterOrEqual(suite.T(), balance, int64(0))
+	assert.Equal(suite.T(), funding/(amount+1), succeeded)
+	assert.Equal(suite.T(), int64(funding-succeeded*(amount+int(suite.mlnd.fee))), balance)
+	suite.assertLedgerMatchesInvoices(suite.service, suite.userId)
+}
+
+func TestConcurrentPaymentTestSuite(t *testing.T) {
+	suite.Run(t, new(ConcurrentPaymentTestSuite))
+}
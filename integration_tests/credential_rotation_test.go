@@ -0,0 +1,129 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CredentialRotationTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+	logins  []ExpectedCreateUserResponseBody
+}
+
+func (suite *CredentialRotationTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	logins, _, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.logins = logins
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	authCtrl := controllers.NewAuthController(suite.service)
+	suite.echo.POST("/auth", authCtrl.Auth)
+	suite.echo.POST("/auth/rotate", authCtrl.RotateCredentials)
+	secured := suite.echo.Group("", suite.service.ApiKeyMiddleware(), tokens.Middleware(suite.service.Config.JWTSecret), suite.service.TokenRevocationMiddleware())
+	secured.GET("/balance", controllers.NewBalanceController(suite.service).Balance)
+}
+
+func (suite *CredentialRotationTestSuite) TearDownSuite() {
+	clearTable(suite.service, "refresh_tokens")
+	clearTable(suite.service, "api_keys")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *CredentialRotationTestSuite) post(path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *CredentialRotationTestSuite) auth(login, password string) *httptest.ResponseRecorder {
+	return suite.post("/auth", &controllers.AuthRequestBody{Login: login, Password: password})
+}
+
+func (suite *CredentialRotationTestSuite) balance(accessToken string) int {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/balance", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func (suite *CredentialRotationTestSuite) TestRotateCredentials() {
+	login := suite.logins[0]
+	rec := suite.auth(login.Login, login.Password)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	authTokens := &controllers.AuthResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(authTokens))
+	_, apiKey, err := suite.service.CreateApiKey(context.Background(), getUserIdFromToken(authTokens.AccessToken), "rotated", []string{common.ScopeRead})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.balance(apiKey))
+
+	rec = suite.post("/auth/rotate", &controllers.RotateCredentialsRequestBody{Login: login.Login, Password: login.Password})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rotated := &controllers.RotateCredentialsResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(rotated))
+	assert.NotEqual(suite.T(), login.Login, rotated.Login)
+	assert.NotEqual(suite.T(), login.Password, rotated.Password)
+
+	// the old credentials and tokens stop working right away
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.auth(login.Login, login.Password).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.balance(authTokens.AccessToken))
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.balance(apiKey))
+	rec = suite.post("/auth", &controllers.AuthRequestBody{RefreshToken: authTokens.RefreshToken})
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+	rec = suite.post("/auth/rotate", &controllers.RotateCredentialsRequestBody{Login: login.Login, Password: login.Password})
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+
+	rec = suite.auth(rotated.Login, rotated.Password)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	newTokens := &controllers.AuthResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(newTokens))
+	assert.Equal(suite.T(), http.StatusOK, suite.balance(newTokens.AccessToken))
+}
+
+func (suite *CredentialRotationTestSuite) TestRotateCredentialsBadAuth() {
+	login := suite.logins[1]
+	rec := suite.post("/auth/rotate", &controllers.RotateCredentialsRequestBody{Login: login.Login, Password: "wrong password"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+	rec = suite.post("/auth/rotate", &controllers.RotateCredentialsRequestBody{Login: login.Login})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+
+	// the credentials are unchanged
+	assert.Equal(suite.T(), http.StatusOK, suite.auth(login.Login, login.Password).Code)
+}
+
+func TestCredentialRotationTestSuite(t *testing.T) {
+	suite.Run(t, new(CredentialRotationTestSuite))
+}
@@ -0,0 +1,162 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DailyLimitTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *DailyLimitTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.mlnd = mlnd
+	suite.externalLND = externalLND
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.MaxDailyOutboundSats = 1000
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice)
+	suite.echo.POST("/keysend", controllers.NewKeySendController(suite.service).KeySend)
+}
+
+func (suite *DailyLimitTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *DailyLimitTestSuite) TestDailyOutboundLimit() {
+	userId := getUserIdFromToken(suite.userToken)
+	//fund user account
+	invoiceResponse := suite.createAddInvoiceReq(5000, "integration test daily limit", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	//wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.payExternalInvoice(600).Code)
+	volume, err := suite.service.OutboundVolumeSince(context.Background(), userId, time.Now().Add(-time.Hour))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(600), volume)
+
+	// the second payment would exceed the limit of the last 24 hours
+	rec := suite.payExternalInvoice(600)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.DailyLimitExceededError.Message, errorResponse.Message)
+
+	// admins can raise the limit of the user
+	limit := int64(2000)
+	_, err = suite.service.UpdateUser(context.Background(), userId, nil, nil, nil, nil, &limit)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.payExternalInvoice(600).Code)
+
+	// or disable it
+	limit = 0
+	_, err = suite.service.UpdateUser(context.Background(), userId, nil, nil, nil, nil, &limit)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.payExternalInvoice(1000).Code)
+
+	// removing the override applies the configured limit again
+	limit = -1
+	_, err = suite.service.UpdateUser(context.Background(), userId, nil, nil, nil, nil, &limit)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, suite.payExternalInvoice(100).Code)
+}
+
+// runs after TestDailyOutboundLimit, which used up the limit
+func (suite *DailyLimitTestSuite) TestDailyOutboundLimitKeysend() {
+	userId := getUserIdFromToken(suite.userToken)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedKeySendRequestBody{
+		Amount:      100,
+		Destination: "123456789012345678901234567890123456789012345678901234567890abcdef",
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/keysend", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, rec.Code)
+
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balance, userBalance)
+}
+
+func (suite *DailyLimitTestSuite) payExternalInvoice(amount int64) *httptest.ResponseRecorder {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: daily limit",
+		Value: amount,
+	})
+	assert.NoError(suite.T(), err)
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedPayInvoiceRequestBody{
+		Invoice: invoice.PaymentRequest,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/payinvoice", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDailyLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(DailyLimitTestSuite))
+}
@@ -0,0 +1,122 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DecodeInvoiceTestSuite struct {
+	TestSuite
+	externalLND *MockLND
+	service     *service.LndhubService
+	userToken   string
+}
+
+func (suite *DecodeInvoiceTestSuite) SetupSuite() {
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.GET("/v2/payments/decode", v2controllers.NewDecodeInvoiceController(suite.service).DecodeInvoice)
+}
+
+func (suite *DecodeInvoiceTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *DecodeInvoiceTestSuite) TestDecodeInvoice() {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:   "integration tests: decode invoice",
+		Value:  500,
+		Expiry: 3600,
+	})
+	assert.NoError(suite.T(), err)
+	// the invoice is lowercased before decoding
+	rec := suite.decodeInvoice(strings.ToUpper(invoice.PaymentRequest))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	decoded := &v2controllers.DecodeInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(decoded))
+	assert.Equal(suite.T(), int64(500), decoded.Amount)
+	assert.Equal(suite.T(), "integration tests: decode invoice", decoded.Description)
+	assert.Equal(suite.T(), suite.externalLND.GetMainPubkey(), decoded.Destination)
+	assert.Equal(suite.T(), fmt.Sprintf("%x", invoice.RHash), decoded.PaymentHash)
+	assert.Equal(suite.T(), int64(3600), decoded.Expiry)
+	assert.False(suite.T(), decoded.IsExpired)
+
+	// decoding does not create any invoices
+	count, err := suite.service.DB.NewSelect().TableExpr("invoices").Count(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+}
+
+func (suite *DecodeInvoiceTestSuite) TestDecodeExpiredInvoice() {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:   "integration tests: decode expired invoice",
+		Value:  500,
+		Expiry: 1,
+	})
+	assert.NoError(suite.T(), err)
+	time.Sleep(2 * time.Second)
+	rec := suite.decodeInvoice(invoice.PaymentRequest)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	decoded := &v2controllers.DecodeInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(decoded))
+	assert.True(suite.T(), decoded.IsExpired)
+}
+
+func (suite *DecodeInvoiceTestSuite) TestDecodeMalformedInvoice() {
+	rec := suite.decodeInvoice("lnbcrt1notaninvoice")
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	rec = suite.decodeInvoice("")
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *DecodeInvoiceTestSuite) decodeInvoice(invoice string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/payments/decode?invoice="+url.QueryEscape(invoice), nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDecodeInvoiceTestSuite(t *testing.T) {
+	suite.Run(t, new(DecodeInvoiceTestSuite))
+}
@@ -0,0 +1,154 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DryRunTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *DryRunTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *DryRunTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *DryRunTestSuite) TestDryRun() {
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test dry run", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+	userId := getUserIdFromToken(suite.userToken)
+	ctx := context.Background()
+
+	paymentRequest := suite.externalInvoice(500, "preimage1")
+	rec := suite.payInvoice(&v2controllers.PayInvoiceRequestBody{Invoice: paymentRequest, DryRun: true})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.True(suite.T(), response.DryRun)
+	assert.Equal(suite.T(), int64(500), response.RequestedAmount)
+	assert.Empty(suite.T(), response.PaymentPreimage)
+
+	// the balance is unchanged and no outgoing invoice was stored, in any state
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+	invoiceCount, err := suite.service.DB.NewSelect().Model((*models.Invoice)(nil)).
+		Where("user_id = ? AND type = ?", userId, common.InvoiceTypeOutgoing).Count(ctx)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, invoiceCount)
+
+	// the balance check of the payment applies
+	rec = suite.payInvoice(&v2controllers.PayInvoiceRequestBody{Invoice: suite.externalInvoice(2000, "preimage2"), DryRun: true})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, errorResponse.Message)
+
+	// an estimate above the fee limit is returned as it is and flagged
+	suite.mlnd.fee = 5
+	rec = suite.payInvoice(&v2controllers.PayInvoiceRequestBody{Invoice: paymentRequest, DryRun: true, FeeLimitSat: 1})
+	suite.mlnd.fee = 0
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response = &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), int64(5), response.RoutingFee)
+	assert.Equal(suite.T(), int64(1), response.FeeLimit)
+	assert.True(suite.T(), response.ExceedsFeeLimit)
+
+	// the checked invoice can be paid afterwards
+	rec = suite.payInvoice(&v2controllers.PayInvoiceRequestBody{Invoice: paymentRequest})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(500), balance)
+}
+
+func (suite *DryRunTestSuite) externalInvoice(amount int64, preimage string) string {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: dry run",
+		Value:     amount,
+		RPreimage: []byte(preimage),
+	})
+	assert.NoError(suite.T(), err)
+	return invoice.PaymentRequest
+}
+
+func (suite *DryRunTestSuite) payInvoice(body *v2controllers.PayInvoiceRequestBody) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDryRunTestSuite(t *testing.T) {
+	suite.Run(t, new(DryRunTestSuite))
+}
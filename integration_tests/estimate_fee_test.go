@@ -0,0 +1,146 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EstimateFeeTestSuite struct {
+	TestSuite
+	mlnd        *MockLND
+	externalLND *MockLND
+	service     *service.LndhubService
+	userToken   string
+}
+
+func (suite *EstimateFeeTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	mlnd.fee = 5
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.FeeReserve = true
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	assert.Equal(suite.T(), 1, len(users))
+	assert.Equal(suite.T(), 1, len(userTokens))
+	suite.userToken = userTokens[0]
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11/estimate", v2controllers.NewEstimateFeeController(suite.service).EstimateFee)
+}
+
+func (suite *EstimateFeeTestSuite) TestEstimateFee() {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: estimate fee",
+		Value: 500,
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendEstimateFeeReq(&v2controllers.EstimateFeeRequestBody{
+		Invoice: invoice.PaymentRequest,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	estimate := &v2controllers.EstimateFeeResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(estimate))
+	assert.Equal(suite.T(), int64(500), estimate.Amount)
+	assert.Equal(suite.T(), int64(500), estimate.NumSatoshis)
+	assert.Equal(suite.T(), suite.mlnd.fee, estimate.FeeEstimate)
+	assert.Equal(suite.T(), suite.service.CalcFeeLimit(suite.externalLND.GetMainPubkey(), 500), estimate.FeeReserve)
+	assert.Equal(suite.T(), suite.externalLND.GetMainPubkey(), estimate.Destination)
+
+	// no outgoing invoice is created
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), getUserIdFromToken(suite.userToken), common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(outgoingInvoices))
+}
+
+func (suite *EstimateFeeTestSuite) TestEstimateFeeZeroAmountInvoice() {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo: "integration tests: estimate fee zero amount",
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendEstimateFeeReq(&v2controllers.EstimateFeeRequestBody{
+		Invoice: invoice.PaymentRequest,
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+
+	rec = suite.sendEstimateFeeReq(&v2controllers.EstimateFeeRequestBody{
+		Invoice: invoice.PaymentRequest,
+		Amount:  100,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	estimate := &v2controllers.EstimateFeeResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(estimate))
+	assert.Equal(suite.T(), int64(100), estimate.Amount)
+	assert.Equal(suite.T(), int64(0), estimate.NumSatoshis)
+	assert.Equal(suite.T(), suite.mlnd.fee, estimate.FeeEstimate)
+}
+
+func (suite *EstimateFeeTestSuite) TestEstimateFeeInternalInvoice() {
+	invoiceResponse := suite.createAddInvoiceReq(100, "integration test estimate fee internal", suite.userToken)
+	rec := suite.sendEstimateFeeReq(&v2controllers.EstimateFeeRequestBody{
+		Invoice: invoiceResponse.PayReq,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	estimate := &v2controllers.EstimateFeeResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(estimate))
+	assert.Equal(suite.T(), int64(0), estimate.FeeEstimate)
+	assert.Equal(suite.T(), int64(0), estimate.FeeReserve)
+}
+
+func (suite *EstimateFeeTestSuite) sendEstimateFeeReq(reqBody *v2controllers.EstimateFeeRequestBody) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(reqBody))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11/estimate", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *EstimateFeeTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func TestEstimateFeeTestSuite(t *testing.T) {
+	suite.Run(t, new(EstimateFeeTestSuite))
+}
@@ -1,6 +1,8 @@
 package integration_tests
 
 import (
+	"time"
+
 	"github.com/getAlby/lndhub.go/lib"
 	"github.com/getAlby/lndhub.go/lib/service"
 )
@@ -27,17 +29,23 @@ type ExpectedAddInvoiceRequestBody struct {
 	Amount          interface{} `json:"amt"` // amount in Satoshi
 	Memo            string      `json:"memo"`
 	DescriptionHash string      `json:"description_hash" validate:"omitempty,hexadecimal,len=64"`
+	Expiry          int64       `json:"expiry,omitempty"`
 }
 type ExpectedV2AddInvoiceRequestBody struct {
-	Amount          int64  `json:"amount"` // amount in Satoshi
-	Memo            string `json:"description"`
-	DescriptionHash string `json:"description_hash,omitempty" validate:"omitempty,hexadecimal,len=64"`
+	Amount          int64   `json:"amount"` // amount in Satoshi
+	AmountMsat      int64   `json:"amount_msat,omitempty"`
+	Memo            string  `json:"description"`
+	DescriptionHash string  `json:"description_hash,omitempty" validate:"omitempty,hexadecimal,len=64"`
+	Expiry          int64   `json:"expiry,omitempty"`
+	Currency        string  `json:"currency,omitempty"`
+	FiatAmount      float64 `json:"fiat_amount,omitempty"`
 }
 
 type ExpectedAddInvoiceResponseBody struct {
-	RHash          string `json:"r_hash"`
-	PaymentRequest string `json:"payment_request"`
-	PayReq         string `json:"pay_req"`
+	RHash          string    `json:"r_hash"`
+	PaymentRequest string    `json:"payment_request"`
+	PayReq         string    `json:"pay_req"`
+	ExpiresAt      time.Time `json:"expires_at"`
 }
 
 type ExpectedAuthRequestBody struct {
@@ -47,8 +55,10 @@ type ExpectedAuthRequestBody struct {
 }
 
 type ExpectedAuthResponseBody struct {
-	RefreshToken string `json:"refresh_token"`
-	AccessToken  string `json:"access_token"`
+	RefreshToken          string    `json:"refresh_token"`
+	AccessToken           string    `json:"access_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
 }
 
 type ExpectedBalanceResponse struct {
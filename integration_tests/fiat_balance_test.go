@@ -0,0 +1,110 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/pricing"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FiatBalanceTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *FiatBalanceTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.PriceService = pricing.NewPriceService(pricing.Fixed{"USD": 30000, "EUR": 28000}, time.Minute)
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.GET("/v2/balance", v2controllers.NewBalanceController(suite.service).Balance)
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+}
+
+func (suite *FiatBalanceTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *FiatBalanceTestSuite) getBalance(query string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/balance"+query, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *FiatBalanceTestSuite) TestFiatBalance() {
+	invoiceResponse := suite.createAddInvoiceReq(100000, "integration test fiat balance", suite.userToken)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil))
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+
+	rec := suite.getBalance("?currency=usd")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.BalanceResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), int64(100000), response.Balance)
+	assert.Equal(suite.T(), "sat", response.Unit)
+	assert.NotNil(suite.T(), response.Fiat)
+	assert.Equal(suite.T(), "USD", response.Fiat.Currency)
+	assert.Equal(suite.T(), 30000.0, response.Fiat.Rate)
+	assert.Equal(suite.T(), 30.0, response.Fiat.Value)
+
+	// without a currency only the sat balance is returned
+	rec = suite.getBalance("")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response = &v2controllers.BalanceResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), int64(100000), response.Balance)
+	assert.Nil(suite.T(), response.Fiat)
+
+	rec = suite.getBalance("?currency=XYZ")
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func TestFiatBalanceTestSuite(t *testing.T) {
+	suite.Run(t, new(FiatBalanceTestSuite))
+}
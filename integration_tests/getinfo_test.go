@@ -1,7 +1,9 @@
 package integration_tests
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
 	"github.com/getAlby/lndhub.go/lib"
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
@@ -23,12 +26,14 @@ import (
 type GetInfoTestSuite struct {
 	TestSuite
 	service   *service.LndhubService
+	mlnd      *MockLND
 	userLogin ExpectedCreateUserResponseBody
 	userToken string
 }
 
 func (suite *GetInfoTestSuite) SetupSuite() {
-	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	suite.mlnd = newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(suite.mlnd)
 	if err != nil {
 		log.Fatalf("Error initializing test service: %v", err)
 	}
@@ -49,6 +54,7 @@ func (suite *GetInfoTestSuite) SetupSuite() {
 	suite.userToken = userTokens[0]
 	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
 	suite.echo.GET("/getinfo", controllers.NewGetInfoController(svc).GetInfo)
+	suite.echo.GET("/v2/getinfo", v2controllers.NewGetInfoController(svc).GetInfo)
 }
 
 func (suite *GetInfoTestSuite) TestGetInfoWithDefaultAlias() {
@@ -76,6 +82,38 @@ func (suite *GetInfoTestSuite) TestGetInfoWithGivenAlias() {
 	assert.Equal(suite.T(), suite.service.Config.CustomName, getInfoResponse.Alias)
 }
 
+func (suite *GetInfoTestSuite) TestV2GetInfo() {
+	suite.service.Config.CustomName = ""
+	rec := suite.getV2Info()
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	// connection details of the node are not exposed
+	assert.NotContains(suite.T(), rec.Body.String(), "uris")
+	getInfoResponse := &v2controllers.GetInfoResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(getInfoResponse))
+	assert.Equal(suite.T(), "Mocky McMockface", getInfoResponse.Alias)
+	assert.Equal(suite.T(), hex.EncodeToString(suite.mlnd.pubKey.SerializeCompressed()), getInfoResponse.IdentityPubkey)
+	assert.Equal(suite.T(), "regtest", getInfoResponse.Network)
+	assert.Equal(suite.T(), uint32(1000), getInfoResponse.BlockHeight)
+	assert.True(suite.T(), getInfoResponse.Synced)
+	assert.Equal(suite.T(), lib.Version, getInfoResponse.Version)
+
+	// the info is cached for a few seconds
+	suite.mlnd.GetInfoError = errors.New("node is down")
+	defer func() {
+		suite.mlnd.GetInfoError = nil
+	}()
+	rec = suite.getV2Info()
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+}
+
+func (suite *GetInfoTestSuite) getV2Info() *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/v2/getinfo", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
 func (suite *GetInfoTestSuite) TearDownSuite() {}
 
 func TestGetInfoSuite(t *testing.T) {
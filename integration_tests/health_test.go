@@ -0,0 +1,86 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type HealthTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+	mlnd    *MockLND
+}
+
+func (suite *HealthTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.service = svc
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	healthCtrl := controllers.NewHealthController(suite.service)
+	suite.echo.GET("/healthz", healthCtrl.Healthz)
+	suite.echo.GET("/readyz", healthCtrl.Readyz)
+}
+
+func (suite *HealthTestSuite) TearDownSuite() {
+	suite.mlnd.GetInfoError = nil
+}
+
+func (suite *HealthTestSuite) getHealth(path string) (int, *controllers.HealthResponseBody) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	body := &controllers.HealthResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(body))
+	return rec.Code, body
+}
+
+func (suite *HealthTestSuite) TestHealthAndReadiness() {
+	code, body := suite.getHealth("/healthz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+	assert.Equal(suite.T(), "ok", body.Status)
+
+	code, body = suite.getHealth("/readyz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+	assert.Equal(suite.T(), "ok", body.Status)
+
+	// the result is cached for a short while
+	suite.mlnd.GetInfoError = errors.New("node is down")
+	code, _ = suite.getHealth("/readyz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+
+	time.Sleep(2100 * time.Millisecond)
+	code, body = suite.getHealth("/readyz")
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, code)
+	assert.Equal(suite.T(), "unavailable", body.Status)
+	assert.Equal(suite.T(), []string{service.DependencyLightning}, body.Failed)
+
+	// liveness does not depend on the node
+	code, _ = suite.getHealth("/healthz")
+	assert.Equal(suite.T(), http.StatusOK, code)
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
@@ -0,0 +1,244 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type IdempotencyTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *IdempotencyTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.IdempotencyKeyTTL = 3600
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	assert.Equal(suite.T(), 1, len(users))
+	assert.Equal(suite.T(), 1, len(userTokens))
+	suite.userToken = userTokens[0]
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *IdempotencyTestSuite) TestIdempotentPayment() {
+	userFundingSats := int64(1000)
+	// fund user account
+	invoiceResponse := suite.createAddInvoiceReq(int(userFundingSats), "integration test idempotent payment", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: idempotent payment",
+		Value:     100,
+		RPreimage: []byte("preimage1"),
+	})
+	assert.NoError(suite.T(), err)
+	reqBody := &v2controllers.PayInvoiceRequestBody{
+		Invoice: invoice.PaymentRequest,
+	}
+	rec := suite.sendPayInvoiceReq(reqBody, "key-1")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	firstResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(firstResponse))
+
+	// retrying returns the original response without paying again
+	rec = suite.sendPayInvoiceReq(reqBody, "key-1")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	retryResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(retryResponse))
+	assert.Equal(suite.T(), firstResponse.PaymentPreimage, retryResponse.PaymentPreimage)
+	assert.Equal(suite.T(), firstResponse.Amount, retryResponse.Amount)
+	assert.Equal(suite.T(), firstResponse.Fee, retryResponse.Fee)
+	assert.Equal(suite.T(), firstResponse.PaymentRequest, retryResponse.PaymentRequest)
+
+	userId := getUserIdFromToken(suite.userToken)
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(outgoingInvoices))
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), userFundingSats-100, userBalance)
+
+	// the same key with a different request is rejected
+	otherInvoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: idempotent payment conflict",
+		Value:     200,
+		RPreimage: []byte("preimage2"),
+	})
+	assert.NoError(suite.T(), err)
+	otherReqBody := &v2controllers.PayInvoiceRequestBody{
+		Invoice: otherInvoice.PaymentRequest,
+	}
+	rec = suite.sendPayInvoiceReq(otherReqBody, "key-1")
+	assert.Equal(suite.T(), http.StatusConflict, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.IdempotencyKeyConflictError.Message, errorResponse.Message)
+
+	// once the key expired it can be used again
+	suite.service.Config.IdempotencyKeyTTL = 0
+	rec = suite.sendPayInvoiceReq(otherReqBody, "key-1")
+	suite.service.Config.IdempotencyKeyTTL = 3600
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	outgoingInvoices, err = suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, len(outgoingInvoices))
+	userBalance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), userFundingSats-300, userBalance)
+}
+
+func (suite *IdempotencyTestSuite) TestIdempotentPaymentConcurrent() {
+	userId := getUserIdFromToken(suite.userToken)
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test concurrent idempotent payment", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	invoicesBefore, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: concurrent idempotent payment",
+		Value:     100,
+		RPreimage: []byte("preimage3"),
+	})
+	assert.NoError(suite.T(), err)
+	reqBody := &v2controllers.PayInvoiceRequestBody{
+		Invoice: invoice.PaymentRequest,
+	}
+	// both requests get the outcome of the one payment
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 2)
+	for i := range recs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recs[i] = suite.sendPayInvoiceReq(reqBody, "key-2")
+		}(i)
+	}
+	wg.Wait()
+	payResponses := make([]*v2controllers.PayInvoiceResponseBody, len(recs))
+	for i, rec := range recs {
+		assert.Equal(suite.T(), http.StatusOK, rec.Code)
+		payResponses[i] = &v2controllers.PayInvoiceResponseBody{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payResponses[i]))
+	}
+	assert.Equal(suite.T(), payResponses[0].PaymentPreimage, payResponses[1].PaymentPreimage)
+
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), len(invoicesBefore)+1, len(outgoingInvoices))
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore-100, balance)
+}
+
+func (suite *IdempotencyTestSuite) TestIdempotentPaymentNotEnoughBalance() {
+	userId := getUserIdFromToken(suite.userToken)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: idempotent payment without balance",
+		Value:     balance + 1000,
+		RPreimage: []byte("preimage4"),
+	})
+	assert.NoError(suite.T(), err)
+	reqBody := &v2controllers.PayInvoiceRequestBody{
+		Invoice: invoice.PaymentRequest,
+	}
+
+	// the replay of a rejected payment gets the same response as the first request
+	for i := 0; i < 2; i++ {
+		rec := suite.sendPayInvoiceReq(reqBody, "key-3")
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+		errorResponse := &responses.ErrorResponse{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+		assert.Equal(suite.T(), responses.NotEnoughBalanceError.Code, errorResponse.Code)
+		assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, errorResponse.Message)
+	}
+	storedInvoice, err := suite.service.FindInvoiceByIdempotencyKey(context.Background(), userId, "key-3")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateAborted, storedInvoice.State)
+}
+
+func (suite *IdempotencyTestSuite) sendPayInvoiceReq(reqBody *v2controllers.PayInvoiceRequestBody, idempotencyKey string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(reqBody))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(v2controllers.IdempotencyKeyHeader, idempotencyKey)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *IdempotencyTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func TestIdempotencyTestSuite(t *testing.T) {
+	suite.Run(t, new(IdempotencyTestSuite))
+}
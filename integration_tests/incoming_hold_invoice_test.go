@@ -0,0 +1,188 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type IncomingHoldInvoiceTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *IncomingHoldInvoiceTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.mlnd = mlnd
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	invoiceCtrl := v2controllers.NewInvoiceController(suite.service)
+	suite.echo.POST("/v2/invoices/hold", invoiceCtrl.AddHoldInvoice)
+	suite.echo.POST("/v2/invoices/:payment_hash/settle", invoiceCtrl.SettleHoldInvoice)
+	suite.echo.POST("/v2/invoices/:payment_hash/cancel", invoiceCtrl.CancelHoldInvoice)
+}
+
+func (suite *IncomingHoldInvoiceTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *IncomingHoldInvoiceTestSuite) TestSettleHoldInvoice() {
+	userId := getUserIdFromToken(suite.userToken)
+	preimage, rHash := suite.makePreimage()
+	rec := suite.postJSON("/v2/invoices/hold", &v2controllers.AddHoldInvoiceRequestBody{
+		Amount:      500,
+		Description: "integration test hold invoice",
+		Hash:        rHash,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	addInvoiceResponse := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(addInvoiceResponse))
+	assert.Equal(suite.T(), rHash, addInvoiceResponse.PaymentHash)
+	assert.NotEmpty(suite.T(), addInvoiceResponse.PaymentRequest)
+
+	// the invoice can only be settled once a payment is held
+	rec = suite.postJSON(fmt.Sprintf("/v2/invoices/%s/settle", rHash), &v2controllers.SettleHoldInvoiceRequestBody{Preimage: preimage})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+
+	rHashBytes, _ := hex.DecodeString(rHash)
+	assert.NoError(suite.T(), suite.mlnd.mockHoldInvoiceUpdate(rHashBytes, lnrpc.Invoice_ACCEPTED, nil))
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	invoice, err := suite.service.FindHoldInvoiceByPaymentHash(context.Background(), userId, rHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateHeld, invoice.State)
+	// held payments are not credited
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(0), balance)
+
+	wrongPreimage, _ := suite.makePreimage()
+	rec = suite.postJSON(fmt.Sprintf("/v2/invoices/%s/settle", rHash), &v2controllers.SettleHoldInvoiceRequestBody{Preimage: wrongPreimage})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+
+	rec = suite.postJSON(fmt.Sprintf("/v2/invoices/%s/settle", rHash), &v2controllers.SettleHoldInvoiceRequestBody{Preimage: preimage})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	invoice, err = suite.service.FindHoldInvoiceByPaymentHash(context.Background(), userId, rHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, invoice.State)
+	assert.Equal(suite.T(), preimage, invoice.Preimage)
+	balance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(500), balance)
+}
+
+func (suite *IncomingHoldInvoiceTestSuite) TestCancelHoldInvoice() {
+	userId := getUserIdFromToken(suite.userToken)
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	preimage, rHash := suite.makePreimage()
+	rec := suite.postJSON("/v2/invoices/hold", &v2controllers.AddHoldInvoiceRequestBody{
+		Amount: 300,
+		Hash:   rHash,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rHashBytes, _ := hex.DecodeString(rHash)
+	assert.NoError(suite.T(), suite.mlnd.mockHoldInvoiceUpdate(rHashBytes, lnrpc.Invoice_ACCEPTED, nil))
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	rec = suite.postJSON(fmt.Sprintf("/v2/invoices/%s/cancel", rHash), nil)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse := &v2controllers.Invoice{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	assert.Equal(suite.T(), common.InvoiceStateCanceled, invoiceResponse.Status)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	// canceled invoices can't be settled
+	rec = suite.postJSON(fmt.Sprintf("/v2/invoices/%s/settle", rHash), &v2controllers.SettleHoldInvoiceRequestBody{Preimage: preimage})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore, balance)
+}
+
+func (suite *IncomingHoldInvoiceTestSuite) TestAddHoldInvoiceInvalidHash() {
+	rec := suite.postJSON("/v2/invoices/hold", &v2controllers.AddHoldInvoiceRequestBody{
+		Amount: 300,
+		Hash:   "not a hash",
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *IncomingHoldInvoiceTestSuite) makePreimage() (preimage, rHash string) {
+	preimageBytes, err := makePreimageHex()
+	assert.NoError(suite.T(), err)
+	// makePreimageHex returns hex characters, use them as the preimage bytes
+	hash := sha256.Sum256(preimageBytes)
+	return hex.EncodeToString(preimageBytes), hex.EncodeToString(hash[:])
+}
+
+func (suite *IncomingHoldInvoiceTestSuite) postJSON(path string, body interface{}) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIncomingHoldInvoiceTestSuite(t *testing.T) {
+	suite.Run(t, new(IncomingHoldInvoiceTestSuite))
+}
@@ -0,0 +1,157 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type InternalFastPathTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *InternalFastPathTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.mlnd = mlnd
+	suite.externalLND = externalLND
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *InternalFastPathTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *InternalFastPathTestSuite) TestInternalFastPath() {
+	senderId := getUserIdFromToken(suite.userTokens[0])
+	receiverId := getUserIdFromToken(suite.userTokens[1])
+	//fund sender account
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test internal fast path", suite.userTokens[0])
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	//wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	// an invoice of the receiver is settled on the ledger
+	receiverInvoice := suite.createAddInvoiceReq(300, "integration test internal fast path receiver", suite.userTokens[1])
+	localInvoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), receiverId, receiverInvoice.RHash)
+	assert.NoError(suite.T(), err)
+	payResponse := suite.payInvoice(receiverInvoice.PayReq)
+	assert.True(suite.T(), payResponse.IsInternal)
+	assert.Equal(suite.T(), int64(0), payResponse.Fee)
+	assert.Equal(suite.T(), localInvoice.Preimage, payResponse.PaymentPreimage)
+
+	senderBalance, err := suite.service.CurrentUserBalance(context.Background(), senderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(700), senderBalance)
+	receiverBalance, err := suite.service.CurrentUserBalance(context.Background(), receiverId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(300), receiverBalance)
+	localInvoice, err = suite.service.FindInvoiceByPaymentHash(context.Background(), receiverId, receiverInvoice.RHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, localInvoice.State)
+
+	// the invoice can't be credited twice
+	rec := suite.payInvoiceRequest(receiverInvoice.PayReq)
+	assert.NotEqual(suite.T(), http.StatusOK, rec.Code)
+	receiverBalance, err = suite.service.CurrentUserBalance(context.Background(), receiverId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(300), receiverBalance)
+
+	// an invoice of another node is paid over lightning, also if a local invoice has its payment hash
+	externalInvoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration test internal fast path external",
+		Value: 200,
+	})
+	assert.NoError(suite.T(), err)
+	_, errResp := suite.service.AddHoldInvoice(context.Background(), receiverId, 200, "", hex.EncodeToString(externalInvoice.RHash))
+	assert.Nil(suite.T(), errResp)
+	payResponse = suite.payInvoice(externalInvoice.PaymentRequest)
+	assert.False(suite.T(), payResponse.IsInternal)
+	senderBalance, err = suite.service.CurrentUserBalance(context.Background(), senderId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(500), senderBalance)
+	receiverBalance, err = suite.service.CurrentUserBalance(context.Background(), receiverId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(300), receiverBalance)
+}
+
+func (suite *InternalFastPathTestSuite) payInvoice(paymentRequest string) *v2controllers.PayInvoiceResponseBody {
+	rec := suite.payInvoiceRequest(paymentRequest)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	payResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payResponse))
+	return payResponse
+}
+
+func (suite *InternalFastPathTestSuite) payInvoiceRequest(paymentRequest string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.PayInvoiceRequestBody{
+		Invoice: paymentRequest,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userTokens[0]))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestInternalFastPathTestSuite(t *testing.T) {
+	suite.Run(t, new(InternalFastPathTestSuite))
+}
@@ -368,6 +368,8 @@ func (suite *PaymentTestSuite) TestInternalPayment() {
 	//assert bob was credited the correct amount
 	bobBalance, _ = suite.service.CurrentUserBalance(context.Background(), bobId)
 	assert.Equal(suite.T(), int64(bobSatRequested+toPayForZeroAmt), bobBalance)
+	suite.assertLedgerMatchesInvoices(suite.service, aliceId)
+	suite.assertLedgerMatchesInvoices(suite.service, bobId)
 }
 
 func (suite *PaymentTestSuite) TestInternalPaymentFail() {
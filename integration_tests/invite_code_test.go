@@ -0,0 +1,137 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const inviteCodeTestAdminToken = "admin_token"
+
+type InviteCodeTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+}
+
+func (suite *InviteCodeTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.RequireInviteCode = true
+	suite.service = svc
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/create", controllers.NewCreateUserController(svc).CreateUser)
+	suite.echo.POST("/v2/users", v2controllers.NewCreateUserController(svc).CreateUser)
+	suite.echo.POST("/v2/admin/invitecodes", v2controllers.NewInviteCodeController(svc).CreateInviteCode, tokens.AdminTokenMiddleware(inviteCodeTestAdminToken))
+}
+
+func (suite *InviteCodeTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invite_codes")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *InviteCodeTestSuite) post(path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *InviteCodeTestSuite) assertRejected(rec *httptest.ResponseRecorder, expected responses.ErrorResponse) {
+	assert.Equal(suite.T(), expected.HttpStatusCode, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), expected.Message, errorResponse.Message)
+}
+
+func (suite *InviteCodeTestSuite) TestValidAndExhaustedInviteCode() {
+	rec := suite.post("/v2/admin/invitecodes", inviteCodeTestAdminToken, &v2controllers.CreateInviteCodeRequestBody{MaxUses: 2})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	inviteCode := &v2controllers.InviteCodeResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(inviteCode))
+	assert.NotEmpty(suite.T(), inviteCode.Code)
+	assert.Equal(suite.T(), int64(2), inviteCode.MaxUses)
+	assert.Nil(suite.T(), inviteCode.ExpiresAt)
+
+	rec = suite.post("/v2/users", "", &v2controllers.CreateUserRequestBody{InviteCode: inviteCode.Code})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	user := &v2controllers.CreateUserResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(user))
+
+	// an account that can't be created doesn't use up the code
+	rec = suite.post("/v2/users", "", &v2controllers.CreateUserRequestBody{Login: user.Login, InviteCode: inviteCode.Code})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+
+	rec = suite.post("/create", "", &controllers.CreateUserRequestBody{InviteCode: inviteCode.Code})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	rec = suite.post("/v2/users", "", &v2controllers.CreateUserRequestBody{InviteCode: inviteCode.Code})
+	suite.assertRejected(rec, responses.InviteCodeExhaustedError)
+
+	stored := &models.InviteCode{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(stored).Where("code = ?", inviteCode.Code).Scan(context.Background()))
+	assert.Equal(suite.T(), int64(2), stored.Uses)
+}
+
+func (suite *InviteCodeTestSuite) TestExpiredInviteCode() {
+	inviteCode, err := suite.service.CreateInviteCode(context.Background(), 5, time.Now().Add(time.Hour))
+	assert.NoError(suite.T(), err)
+	_, err = suite.service.DB.NewUpdate().Model(inviteCode).Set("expires_at = ?", time.Now().Add(-time.Minute)).WherePK().Exec(context.Background())
+	assert.NoError(suite.T(), err)
+
+	rec := suite.post("/v2/users", "", &v2controllers.CreateUserRequestBody{InviteCode: inviteCode.Code})
+	suite.assertRejected(rec, responses.InviteCodeExpiredError)
+
+	// codes can't be created already expired
+	expiresAt := time.Now().Add(-time.Minute)
+	rec = suite.post("/v2/admin/invitecodes", inviteCodeTestAdminToken, &v2controllers.CreateInviteCodeRequestBody{MaxUses: 1, ExpiresAt: &expiresAt})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *InviteCodeTestSuite) TestMissingAndInvalidInviteCode() {
+	rec := suite.post("/v2/users", "", &v2controllers.CreateUserRequestBody{})
+	suite.assertRejected(rec, responses.InviteCodeRequiredError)
+	rec = suite.post("/create", "", &controllers.CreateUserRequestBody{})
+	suite.assertRejected(rec, responses.InviteCodeRequiredError)
+
+	rec = suite.post("/v2/users", "", &v2controllers.CreateUserRequestBody{InviteCode: "does-not-exist"})
+	suite.assertRejected(rec, responses.InvalidInviteCodeError)
+
+	// only admins can create codes
+	rec = suite.post("/v2/admin/invitecodes", "wrong_token", &v2controllers.CreateInviteCodeRequestBody{MaxUses: 1})
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+}
+
+func TestInviteCodeTestSuite(t *testing.T) {
+	suite.Run(t, new(InviteCodeTestSuite))
+}
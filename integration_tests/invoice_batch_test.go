@@ -0,0 +1,115 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type InvoiceBatchTestSuite struct {
+	TestSuite
+	service   *service.LndhubService
+	mlnd      *MockLND
+	userToken string
+}
+
+func (suite *InvoiceBatchTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.MaxInvoiceBatchSize = 20
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/v2/invoices/batch", v2controllers.NewInvoiceController(svc).AddInvoiceBatch, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *InvoiceBatchTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *InvoiceBatchTestSuite) addInvoiceBatch(size int) *httptest.ResponseRecorder {
+	body := v2controllers.AddInvoiceBatchRequestBody{}
+	for i := 0; i < size; i++ {
+		body.Invoices = append(body.Invoices, v2controllers.BatchInvoiceRequestBody{
+			Amount: int64(100 + i),
+			Memo:   fmt.Sprintf("integration test batch %d", i),
+			Expiry: 600,
+		})
+	}
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&body))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/invoices/batch", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *InvoiceBatchTestSuite) TestAddInvoiceBatch() {
+	userId := getUserIdFromToken(suite.userToken)
+	rec := suite.addInvoiceBatch(suite.service.Config.MaxInvoiceBatchSize)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.AddInvoiceBatchResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Len(suite.T(), response.Invoices, 20)
+	for i, result := range response.Invoices {
+		assert.Equal(suite.T(), v2controllers.BatchInvoiceStatusCreated, result.Status)
+		assert.Nil(suite.T(), result.Error)
+		// the results are in the order of the request
+		assert.Equal(suite.T(), int64(100+i), result.Invoice.Amount)
+		assert.NotEmpty(suite.T(), result.Invoice.PaymentRequest)
+
+		invoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), userId, result.Invoice.PaymentHash)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), common.InvoiceTypeIncoming, invoice.Type)
+		assert.Equal(suite.T(), common.InvoiceStateOpen, invoice.State)
+		assert.Equal(suite.T(), fmt.Sprintf("integration test batch %d", i), invoice.Memo)
+		assert.Equal(suite.T(), int64(600), invoice.Expiry)
+	}
+	count, err := suite.service.PendingInvoiceCount(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 20, count)
+
+	// larger batches are rejected without creating any invoice
+	rec = suite.addInvoiceBatch(suite.service.Config.MaxInvoiceBatchSize + 1)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	count, err = suite.service.PendingInvoiceCount(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 20, count)
+}
+
+func TestInvoiceBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(InvoiceBatchTestSuite))
+}
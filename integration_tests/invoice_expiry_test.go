@@ -0,0 +1,149 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type InvoiceExpiryTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userId                   int64
+	userToken                string
+	webhookServer            *httptest.Server
+	events                   chan service.UserWebhookEvent
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *InvoiceExpiryTestSuite) SetupSuite() {
+	suite.events = make(chan service.UserWebhookEvent, 10)
+	suite.webhookServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := service.UserWebhookEvent{}
+		err := json.NewDecoder(r.Body).Decode(&event)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		suite.events <- event
+	}))
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	// the webhook server is on a private address
+	svc.Config.OutboundAllowedHosts = []string{"127.0.0.1"}
+	svc.OutboundClient, err = service.NewOutboundClient(svc.Config)
+	if err != nil {
+		log.Fatalf("Error initializing outbound client: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.userToken = userTokens[0]
+	suite.userId = getUserIdFromToken(suite.userToken)
+	_, err = svc.CreateUserWebhook(context.Background(), suite.userId, suite.webhookServer.URL, []string{common.WebhookEventInvoiceExpired})
+	if err != nil {
+		log.Fatalf("Error creating test webhook: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.mlnd = mlnd
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+}
+
+func (suite *InvoiceExpiryTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	suite.webhookServer.Close()
+	clearTable(suite.service, "webhooks")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *InvoiceExpiryTestSuite) TestExpireInvoices() {
+	unpaid := suite.createAddInvoiceReq(1000, "integration test invoice expiry unpaid", suite.userToken)
+	paid := suite.createAddInvoiceReq(1000, "integration test invoice expiry paid", suite.userToken)
+	notExpired := suite.createAddInvoiceReq(1000, "integration test invoice expiry not expired", suite.userToken)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(paid, 0, false, nil))
+	time.Sleep(100 * time.Millisecond)
+	suite.setExpiresAt(unpaid.RHash, time.Now().Add(-time.Hour))
+	suite.setExpiresAt(paid.RHash, time.Now().Add(-time.Hour))
+
+	expired, err := suite.service.ExpireInvoices(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(expired))
+	assert.Equal(suite.T(), unpaid.RHash, expired[0].RHash)
+
+	select {
+	case event := <-suite.events:
+		assert.Equal(suite.T(), common.WebhookEventInvoiceExpired, event.Event)
+		assert.Equal(suite.T(), unpaid.RHash, event.Data.RHash)
+		assert.Equal(suite.T(), common.InvoiceStateExpired, event.Data.State)
+	case <-time.After(5 * time.Second):
+		suite.T().Fatal("webhook was not delivered")
+	}
+
+	suite.assertInvoiceState(unpaid.RHash, common.InvoiceStateExpired)
+	// the settled invoice is not expired
+	suite.assertInvoiceState(paid.RHash, common.InvoiceStateSettled)
+	suite.assertInvoiceState(notExpired.RHash, common.InvoiceStateOpen)
+
+	// expired invoices are only notified once
+	expired, err = suite.service.ExpireInvoices(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), expired)
+
+	// a settlement that arrives after the sweep is still credited
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(unpaid, 0, false, nil))
+	time.Sleep(100 * time.Millisecond)
+	suite.assertInvoiceState(unpaid.RHash, common.InvoiceStateSettled)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(2000), balance)
+}
+
+func (suite *InvoiceExpiryTestSuite) setExpiresAt(rHash string, expiresAt time.Time) {
+	_, err := suite.service.DB.NewUpdate().Model((*models.Invoice)(nil)).Set("expires_at = ?", expiresAt).Where("r_hash = ?", rHash).Exec(context.Background())
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *InvoiceExpiryTestSuite) assertInvoiceState(rHash, state string) {
+	invoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), suite.userId, rHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), state, invoice.State)
+}
+
+func TestInvoiceExpiryTestSuite(t *testing.T) {
+	suite.Run(t, new(InvoiceExpiryTestSuite))
+}
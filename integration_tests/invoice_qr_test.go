@@ -0,0 +1,92 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type InvoiceQRTestSuite struct {
+	TestSuite
+	service    *service.LndhubService
+	userTokens []string
+}
+
+func (suite *InvoiceQRTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.GET("/v2/invoices/:payment_hash/qr.png", v2controllers.NewInvoiceController(svc).GetInvoiceQR, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *InvoiceQRTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *InvoiceQRTestSuite) getQR(token, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *InvoiceQRTestSuite) TestInvoiceQR() {
+	userId := getUserIdFromToken(suite.userTokens[0])
+	invoice, errResp := suite.service.AddIncomingInvoice(context.Background(), userId, 100, "integration test qr code", "", 0, "", true)
+	assert.Nil(suite.T(), errResp)
+
+	rec := suite.getQR(suite.userTokens[0], fmt.Sprintf("/v2/invoices/%s/qr.png?size=512", invoice.RHash))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Equal(suite.T(), "image/png", rec.Header().Get(echo.HeaderContentType))
+	assert.NotEmpty(suite.T(), rec.Header().Get(echo.HeaderCacheControl))
+	image, err := png.Decode(rec.Body)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 512, image.Bounds().Dx())
+	assert.Equal(suite.T(), 512, image.Bounds().Dy())
+
+	// the default size
+	rec = suite.getQR(suite.userTokens[0], fmt.Sprintf("/v2/invoices/%s/qr.png", invoice.RHash))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	image, err = png.Decode(rec.Body)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 256, image.Bounds().Dx())
+
+	// invoices of other users are not found
+	rec = suite.getQR(suite.userTokens[1], fmt.Sprintf("/v2/invoices/%s/qr.png", invoice.RHash))
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+	rec = suite.getQR(suite.userTokens[0], "/v2/invoices/0000000000000000000000000000000000000000000000000000000000000000/qr.png")
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+}
+
+func TestInvoiceQRTestSuite(t *testing.T) {
+	suite.Run(t, new(InvoiceQRTestSuite))
+}
@@ -0,0 +1,161 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type InvoiceSubscriptionTestSuite struct {
+	TestSuite
+	service   *service.LndhubService
+	userToken string
+}
+
+func (suite *InvoiceSubscriptionTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userToken = userTokens[0]
+}
+
+func (suite *InvoiceSubscriptionTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoice_subscription_states")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *InvoiceSubscriptionTestSuite) TestReconnectReplaysSettledInvoices() {
+	userId := getUserIdFromToken(suite.userToken)
+	invoice, errResp := suite.service.AddIncomingInvoice(context.Background(), userId, 100, "integration test invoice subscription", "", 0, "", true)
+	assert.Nil(suite.T(), errResp)
+	rHash, err := hex.DecodeString(invoice.RHash)
+	assert.NoError(suite.T(), err)
+	settledInvoice := &lnrpc.Invoice{
+		RHash:       rHash,
+		State:       lnrpc.Invoice_SETTLED,
+		Settled:     true,
+		SettleDate:  time.Now().Unix(),
+		AmtPaidSat:  100,
+		AddIndex:    invoice.AddIndex,
+		SettleIndex: 7,
+	}
+
+	requests := make(chan *lnrpc.InvoiceSubscription, 3)
+	calls := 0
+	lndClient := &testutils.MockLightningClient{
+		Pubkey: "03invoicesubscription",
+		SubscribeInvoicesFunc: func(ctx context.Context, req *lnrpc.InvoiceSubscription) (lnd.SubscribeInvoicesWrapper, error) {
+			requests <- req
+			calls++
+			switch calls - 1 {
+			case 0:
+				// the node restarts before the invoice is settled
+				return &testutils.MockInvoiceStream{Err: errors.New("node restarted")}, nil
+			case 1:
+				// the settlement is replayed after reconnecting
+				return &testutils.MockInvoiceStream{Invoices: []*lnrpc.Invoice{settledInvoice}, Err: errors.New("node restarted")}, nil
+			default:
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+		},
+	}
+	originalClient := suite.service.LndClient
+	suite.service.LndClient = lndClient
+	defer func() {
+		suite.service.LndClient = originalClient
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- suite.service.InvoiceUpdateSubscription(ctx)
+	}()
+
+	assert.Equal(suite.T(), uint64(0), (<-requests).SettleIndex)
+	assert.Equal(suite.T(), uint64(0), (<-requests).SettleIndex)
+	// the processed settle index is used for the next connection
+	select {
+	case req := <-requests:
+		assert.Equal(suite.T(), uint64(7), req.SettleIndex)
+	case <-time.After(10 * time.Second):
+		suite.T().Fatal("subscription was not reconnected")
+	}
+	cancel()
+	assert.ErrorIs(suite.T(), <-done, context.Canceled)
+
+	settleIndex, err := suite.service.InvoiceSettleIndex(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), uint64(7), settleIndex)
+	updatedInvoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), userId, invoice.RHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, updatedInvoice.State)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(100), balance)
+}
+
+func (suite *InvoiceSubscriptionTestSuite) TestDuplicateSettlement() {
+	userId := getUserIdFromToken(suite.userToken)
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	invoice, errResp := suite.service.AddIncomingInvoice(context.Background(), userId, 50, "integration test duplicate settlement", "", 0, "", true)
+	assert.Nil(suite.T(), errResp)
+	rHash, err := hex.DecodeString(invoice.RHash)
+	assert.NoError(suite.T(), err)
+	settledInvoice := &lnrpc.Invoice{
+		RHash:      rHash,
+		State:      lnrpc.Invoice_SETTLED,
+		Settled:    true,
+		SettleDate: time.Now().Unix(),
+		AmtPaidSat: 50,
+	}
+
+	// the same event delivered at the same time and again later
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(suite.T(), suite.service.ProcessInvoiceUpdate(context.Background(), settledInvoice))
+		}()
+	}
+	wg.Wait()
+	assert.NoError(suite.T(), suite.service.ProcessInvoiceUpdate(context.Background(), settledInvoice))
+
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore+50, balance)
+	entries, err := suite.service.DB.NewSelect().Model(&models.TransactionEntry{}).
+		Where("invoice_id = ? AND entry_type = ?", invoice.ID, models.EntryTypeIncoming).
+		Count(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, entries)
+}
+
+func TestInvoiceSubscriptionTestSuite(t *testing.T) {
+	suite.Run(t, new(InvoiceSubscriptionTestSuite))
+}
@@ -3,6 +3,7 @@ package integration_tests
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -10,11 +11,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/getAlby/lndhub.go/common"
 	"github.com/getAlby/lndhub.go/controllers"
 	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
 	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/pricing"
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
 	"github.com/getAlby/lndhub.go/lib/tokens"
@@ -36,6 +39,7 @@ func (suite *InvoiceTestSuite) SetupSuite() {
 	if err != nil {
 		log.Fatalf("Error initializing test service: %v", err)
 	}
+	svc.PriceService = pricing.NewPriceService(pricing.Fixed{"USD": 30000}, time.Minute)
 	suite.service = svc
 	users, userTokens, err := createUsers(svc, 1)
 	if err != nil {
@@ -52,6 +56,7 @@ func (suite *InvoiceTestSuite) SetupSuite() {
 	suite.aliceToken = userTokens[0]
 	suite.echo.POST("/invoice/:user_login", controllers.NewInvoiceController(svc).Invoice)
 	suite.echo.POST("/v2/invoices", v2controllers.NewInvoiceController(svc).AddInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.GET("/v2/invoices/:payment_hash", v2controllers.NewInvoiceController(svc).GetInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
 }
 
 func (suite *InvoiceTestSuite) TearDownTest() {
@@ -72,6 +77,145 @@ func (suite *InvoiceTestSuite) TestZeroAmtTestSuite() {
 	assert.Equal(suite.T(), http.StatusOK, rec.Code)
 }
 
+func (suite *InvoiceTestSuite) TestAddInvoiceExpiry() {
+	// without an expiry the configured default is used
+	rec := suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, Memo: "test default expiry"})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	assert.WithinDuration(suite.T(), time.Now().Add(time.Duration(suite.service.Config.DefaultInvoiceExpiry)*time.Second), invoiceResponse.ExpiresAt, time.Minute)
+
+	rec = suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, Memo: "test custom expiry", Expiry: 3600})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse = &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	assert.WithinDuration(suite.T(), time.Now().Add(time.Hour), invoiceResponse.ExpiresAt, time.Minute)
+	invoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), getUserIdFromToken(suite.aliceToken), invoiceResponse.PaymentHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(3600), invoice.Expiry)
+
+	for _, expiry := range []int64{10, 31536001} {
+		rec = suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, Memo: "test invalid expiry", Expiry: expiry})
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	}
+}
+
+func (suite *InvoiceTestSuite) TestAddInvoiceAmountMsat() {
+	rec := suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, AmountMsat: 21000, Memo: "test amount msat"})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	invoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), getUserIdFromToken(suite.aliceToken), invoiceResponse.PaymentHash)
+	assert.NoError(suite.T(), err)
+	// amount_msat takes precedence
+	assert.Equal(suite.T(), int64(21), invoice.Amount)
+	decoded, err := suite.service.DecodePaymentRequest(context.Background(), invoiceResponse.PaymentRequest)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(21000), decoded.NumMsat)
+
+	// fractions of a satoshi can't be credited
+	rec = suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{AmountMsat: 21500, Memo: "test fractional amount msat"})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *InvoiceTestSuite) TestAddInvoiceDescriptionHash() {
+	descriptionHash := sha256.Sum256([]byte(`[["text/plain","test description hash"]]`))
+	descriptionHashHex := hex.EncodeToString(descriptionHash[:])
+	rec := suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, Memo: "test description hash", DescriptionHash: descriptionHashHex})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	assert.Equal(suite.T(), descriptionHashHex, invoiceResponse.DescriptionHash)
+	// the invoice commits to the hash instead of the memo
+	decoded, err := suite.service.DecodePaymentRequest(context.Background(), invoiceResponse.PaymentRequest)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), descriptionHashHex, decoded.DescriptionHash)
+	assert.Empty(suite.T(), decoded.Description)
+
+	// the hash must be 32 bytes hex
+	for _, invalidHash := range []string{"abcd", descriptionHashHex + "00", "zz" + descriptionHashHex[2:]} {
+		rec = suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, DescriptionHash: invalidHash})
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code, invalidHash)
+	}
+}
+
+func (suite *InvoiceTestSuite) TestGetInvoiceState() {
+	rec := suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, Memo: "test invoice state"})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+
+	rec = suite.getV2Invoice(invoiceResponse.PaymentHash)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoice := &v2controllers.Invoice{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoice))
+	assert.Equal(suite.T(), v2controllers.InvoiceStateCreated, invoice.State)
+	assert.Equal(suite.T(), common.InvoiceTypeIncoming, invoice.Type)
+	assert.Equal(suite.T(), int64(10), invoice.Amount)
+	assert.Zero(suite.T(), invoice.SettledAmount)
+	assert.Empty(suite.T(), invoice.PaymentPreimage)
+
+	// unknown hashes and hashes of other users are not found
+	rec = suite.getV2Invoice(hex.EncodeToString(make([]byte, 32)))
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.InvoiceNotFoundError.Message, errorResponse.Message)
+}
+
+func (suite *InvoiceTestSuite) TestAddFiatInvoice() {
+	rec := suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Currency: "usd", FiatAmount: 3, Memo: "test fiat invoice"})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	assert.Equal(suite.T(), int64(10000), invoiceResponse.Amount)
+	assert.Equal(suite.T(), &v2controllers.FiatAmount{Currency: "USD", Amount: 3, Rate: 30000}, invoiceResponse.Fiat)
+
+	// the rate snapshot is stored with the invoice
+	invoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), getUserIdFromToken(suite.aliceToken), invoiceResponse.PaymentHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(10000), invoice.Amount)
+	assert.Equal(suite.T(), "USD", invoice.FiatCurrency)
+	assert.Equal(suite.T(), 3.0, invoice.FiatAmount)
+	assert.Equal(suite.T(), 30000.0, invoice.FiatRate)
+	decoded, err := suite.service.DecodePaymentRequest(context.Background(), invoiceResponse.PaymentRequest)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(10000), decoded.NumSatoshis)
+
+	rec = suite.getV2Invoice(invoiceResponse.PaymentHash)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	v2Invoice := &v2controllers.Invoice{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(v2Invoice))
+	assert.Equal(suite.T(), invoiceResponse.Fiat, v2Invoice.Fiat)
+
+	// invoices without a fiat amount don't return one
+	rec = suite.addV2Invoice(&ExpectedV2AddInvoiceRequestBody{Amount: 10, Memo: "test sat invoice"})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse = &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	assert.Equal(suite.T(), int64(10), invoiceResponse.Amount)
+	assert.Nil(suite.T(), invoiceResponse.Fiat)
+}
+
+func (suite *InvoiceTestSuite) getV2Invoice(rHash string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/invoices/"+rHash, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.aliceToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *InvoiceTestSuite) addV2Invoice(body *ExpectedV2AddInvoiceRequestBody) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	req := httptest.NewRequest(http.MethodPost, "/v2/invoices", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.aliceToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
 func (suite *InvoiceTestSuite) TestAddInvoiceWithoutToken() {
 	user, _ := suite.service.FindUserByLogin(context.Background(), suite.aliceLogin.Login)
 	invoicesBefore, _ := suite.service.InvoicesFor(context.Background(), user.ID, common.InvoiceTypeIncoming)
@@ -84,6 +228,25 @@ func (suite *InvoiceTestSuite) TestAddInvoiceWithoutToken() {
 	assert.Equal(suite.T(), 1, len(invoicesAfter))
 }
 
+func (suite *InvoiceTestSuite) TestAddInvoiceResponse() {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedAddInvoiceRequestBody{
+		Amount: 10,
+		Memo:   "test add invoice response",
+		Expiry: 600,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/invoice/"+suite.aliceLogin.Login, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceResponse := &controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoiceResponse))
+	assert.WithinDuration(suite.T(), time.Now().Add(10*time.Minute), invoiceResponse.ExpiresAt, time.Minute)
+	// the mock node does not add route hints
+	assert.Empty(suite.T(), invoiceResponse.RouteHints)
+}
+
 func (suite *InvoiceTestSuite) TestAddInvoiceForNonExistingUser() {
 	nonExistingLogin := suite.aliceLogin.Login + "abc"
 	suite.createInvoiceReqError(10, "test invoice without token", nonExistingLogin)
@@ -92,7 +255,7 @@ func (suite *InvoiceTestSuite) TestPreimageEntropy() {
 	user, _ := suite.service.FindUserByLogin(context.Background(), suite.aliceLogin.Login)
 	preimageChars := map[byte]int{}
 	for i := 0; i < 1000; i++ {
-		inv, errResp := suite.service.AddIncomingInvoice(context.Background(), user.ID, 10, "test entropy", "")
+		inv, errResp := suite.service.AddIncomingInvoice(context.Background(), user.ID, 10, "test entropy", "", 0, "", true)
 		assert.Nil(suite.T(), errResp)
 		primgBytes, _ := hex.DecodeString(inv.Preimage)
 		for _, char := range primgBytes {
@@ -0,0 +1,149 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type KeysendAliasTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	service                  *service.LndhubService
+	userLogins               []ExpectedCreateUserResponseBody
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *KeysendAliasTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	users, userTokens, err := createUsers(svc, 3)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.mlnd = mlnd
+	suite.service = svc
+	suite.userLogins = users
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.PUT("/v2/keysend/alias", v2controllers.NewKeysendAliasController(suite.service).SetKeysendAlias)
+}
+
+func (suite *KeysendAliasTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *KeysendAliasTestSuite) setKeysendAlias(alias, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.SetKeysendAliasRequestBody{KeysendAlias: alias}))
+	req := httptest.NewRequest(http.MethodPut, "/v2/keysend/alias", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *KeysendAliasTestSuite) receiveKeysend(amount int64, alias string) {
+	preimage, err := makePreimageHex()
+	assert.NoError(suite.T(), err)
+	err = suite.mlnd.mockPaidInvoice(nil, amount, true, &lnrpc.InvoiceHTLC{
+		CustomRecords: map[uint64][]byte{
+			service.TLV_KEYSEND_ALIAS:     []byte(alias),
+			service.KEYSEND_CUSTOM_RECORD: preimage,
+		},
+	})
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+}
+
+func (suite *KeysendAliasTestSuite) balance(token string) int64 {
+	balance, err := suite.service.CurrentUserBalance(context.Background(), getUserIdFromToken(token))
+	assert.NoError(suite.T(), err)
+	return balance
+}
+
+func (suite *KeysendAliasTestSuite) TestKeysendAlias() {
+	ctx := context.Background()
+	alice, bob, fallback := suite.userTokens[0], suite.userTokens[1], suite.userTokens[2]
+
+	rec := suite.setKeysendAlias("Alice", alice)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.KeysendAliasResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), "alice", response.KeysendAlias)
+	assert.Equal(suite.T(), suite.service.LndClient.GetMainPubkey(), response.Pubkey)
+	assert.Equal(suite.T(), uint64(service.TLV_KEYSEND_ALIAS), response.CustomRecord)
+
+	// aliases are unique
+	rec = suite.setKeysendAlias("alice", bob)
+	assert.Equal(suite.T(), responses.KeysendAliasTakenError.Message, checkErrResponse(&suite.TestSuite, rec).Message)
+	rec = suite.setKeysendAlias("bob", bob)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	// the alias in the custom record decides who is credited
+	suite.receiveKeysend(100, "alice")
+	suite.receiveKeysend(200, "bob")
+	assert.Equal(suite.T(), int64(100), suite.balance(alice))
+	assert.Equal(suite.T(), int64(200), suite.balance(bob))
+	invoices, err := suite.service.InvoicesFor(ctx, getUserIdFromToken(alice), "incoming")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(invoices))
+	assert.Equal(suite.T(), "alice", string(invoices[0].DestinationCustomRecords[service.TLV_KEYSEND_ALIAS]))
+
+	// payments to unknown aliases are dropped
+	suite.receiveKeysend(300, "carol")
+	assert.Equal(suite.T(), int64(0), suite.balance(fallback))
+	// or credited to the fallback user
+	suite.service.Config.KeysendAliasFallbackLogin = suite.userLogins[2].Login
+	defer func() { suite.service.Config.KeysendAliasFallbackLogin = "" }()
+	suite.receiveKeysend(300, "carol")
+	assert.Equal(suite.T(), int64(300), suite.balance(fallback))
+
+	// a changed alias is not paid anymore
+	rec = suite.setKeysendAlias("alice2", alice)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	suite.receiveKeysend(400, "alice")
+	assert.Equal(suite.T(), int64(100), suite.balance(alice))
+	assert.Equal(suite.T(), int64(700), suite.balance(fallback))
+	for _, token := range suite.userTokens {
+		suite.assertLedgerMatchesInvoices(suite.service, getUserIdFromToken(token))
+	}
+}
+
+func TestKeysendAliasTestSuite(t *testing.T) {
+	suite.Run(t, new(KeysendAliasTestSuite))
+}
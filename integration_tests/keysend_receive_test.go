@@ -0,0 +1,107 @@
+package integration_tests
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type KeysendReceiveTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	service                  *service.LndhubService
+	userLogin                ExpectedCreateUserResponseBody
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *KeysendReceiveTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.DisableKeysendReceive = true
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.mlnd = mlnd
+	suite.service = svc
+	suite.userLogin = users[0]
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/keysend", controllers.NewKeySendController(suite.service).KeySend)
+}
+
+func (suite *KeysendReceiveTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *KeysendReceiveTestSuite) TestKeysendReceiveDisabled() {
+	ctx := context.Background()
+	userId := getUserIdFromToken(suite.userToken)
+	// fund account
+	invoice := suite.createAddInvoiceReq(1000, "integration test keysend receive", suite.userToken)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoice, 0, false, nil))
+	time.Sleep(10 * time.Millisecond)
+
+	// keysend payments from other nodes are not credited
+	preimage, err := makePreimageHex()
+	assert.NoError(suite.T(), err)
+	err = suite.mlnd.mockPaidInvoice(nil, 100, true, &lnrpc.InvoiceHTLC{
+		CustomRecords: map[uint64][]byte{
+			service.TLV_WALLET_ID:         []byte(suite.userLogin.Login),
+			service.KEYSEND_CUSTOM_RECORD: preimage,
+		},
+	})
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+	count, err := suite.service.DB.NewSelect().Model((*models.Invoice)(nil)).
+		Where("user_id = ? AND type = ? AND keysend = true", userId, common.InvoiceTypeIncoming).
+		Count(ctx)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), count)
+
+	// and users can't send keysend payments to our node
+	errorResponse := suite.createKeySendReqError(100, "integration test keysend receive", suite.service.LndClient.GetMainPubkey(), suite.userToken)
+	assert.Equal(suite.T(), responses.KeysendReceiveDisabledError.Message, errorResponse.Message)
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+	suite.assertLedgerMatchesInvoices(suite.service, userId)
+}
+
+func TestKeysendReceiveTestSuite(t *testing.T) {
+	suite.Run(t, new(KeysendReceiveTestSuite))
+}
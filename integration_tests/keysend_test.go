@@ -3,6 +3,7 @@ package integration_tests
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -11,8 +12,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/getAlby/lndhub.go/common"
 	"github.com/getAlby/lndhub.go/controllers"
 	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
 	"github.com/getAlby/lndhub.go/lib"
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/service"
@@ -65,6 +68,7 @@ func (suite *KeySendTestSuite) SetupSuite() {
 	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
 	suite.echo.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice)
 	suite.echo.POST("/keysend", controllers.NewKeySendController(suite.service).KeySend)
+	suite.echo.POST("/v2/payments/keysend", v2controllers.NewKeySendController(suite.service).KeySend)
 	suite.echo.POST("/v2/payments/keysend/multi", v2controllers.NewKeySendController(suite.service).MultiKeySend)
 }
 
@@ -98,6 +102,40 @@ func (suite *KeySendTestSuite) TestKeysendPayment() {
 	assert.Equal(suite.T(), int64(aliceFundingSats)-int64(externalSatRequested+int(suite.mlnd.fee)), aliceBalance)
 }
 
+func (suite *KeySendTestSuite) TestKeysendZeroFeeDestination() {
+	destination := "123456789012345678901234567890123456789012345678901234567890abcdef"
+	aliceFundingSats := 1000
+	invoiceResponse := suite.createAddInvoiceReq(aliceFundingSats, "integration test zero fee destination", suite.aliceToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+
+	fee := suite.mlnd.fee
+	suite.service.Config.FeeReserve = true
+	suite.mlnd.fee = 0
+	defer func() {
+		suite.service.Config.FeeReserve = false
+		suite.service.Config.ZeroFeeDestinations = nil
+		suite.mlnd.fee = fee
+	}()
+	// the fee reserve doesn't fit into the balance
+	errResponse := suite.createKeySendReqError(int64(aliceFundingSats), "zero fee destination", destination, suite.aliceToken)
+	assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, errResponse.Message)
+
+	// allowlisted destinations don't need a fee reserve
+	suite.service.Config.ZeroFeeDestinations = []string{destination}
+	suite.createKeySendReq(int64(aliceFundingSats), "zero fee destination", destination, suite.aliceToken)
+	userId := getUserIdFromToken(suite.aliceToken)
+	aliceBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(0), aliceBalance)
+	feeReserves, err := suite.service.DB.NewSelect().Model(&models.TransactionEntry{}).
+		Where("user_id = ? AND entry_type = ?", userId, models.EntryTypeFeeReserve).
+		Count(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, feeReserves)
+}
+
 func (suite *KeySendTestSuite) TestKeysendPaymentNonExistentDestination() {
 	aliceFundingSats := 1000
 	externalSatRequested := 500
@@ -150,6 +188,10 @@ func (suite *KeySendTestSuite) TestMultiKeysend() {
 	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(keySendResponse))
 	//check response
 	assert.Equal(suite.T(), len(keySendResponse.Keysends), 3)
+	for _, keysend := range keySendResponse.Keysends {
+		assert.Nil(suite.T(), keysend.Error)
+		assert.NotEmpty(suite.T(), keysend.Keysend.PaymentHash)
+	}
 	//check that balance was reduced appropriately
 	userId := getUserIdFromToken(suite.aliceToken)
 	aliceBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
@@ -159,6 +201,159 @@ func (suite *KeySendTestSuite) TestMultiKeysend() {
 	assert.Equal(suite.T(), int64(aliceFundingSats)-300-3*suite.mlnd.fee, aliceBalance)
 }
 
+func (suite *KeySendTestSuite) TestMultiKeysendNotEnoughBalanceForFeeReserves() {
+	aliceFundingSats := 1000
+	//fund alice account
+	invoiceResponse := suite.createAddInvoiceReq(aliceFundingSats, "integration test external payment alice", suite.aliceToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+
+	// the total amount is covered, but not the fee reserves of all payments
+	suite.service.Config.FeeReserve = true
+	defer func() {
+		suite.service.Config.FeeReserve = false
+	}()
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(v2controllers.MultiKeySendRequestBody{
+		Keysends: []v2controllers.KeySendRequestBody{
+			{
+				Amount:      330,
+				Destination: "123456789012345678901234567890123456789012345678901234567890abcdef",
+			},
+			{
+				Amount:      330,
+				Destination: "123456789012345678901234567890123456789012345678901234567890abcdef",
+			},
+			{
+				Amount:      330,
+				Destination: "123456789012345678901234567890123456789012345678901234567890abcdef",
+			},
+		},
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/keysend/multi", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.aliceToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, errorResponse.Message)
+
+	// nothing was sent
+	userId := getUserIdFromToken(suite.aliceToken)
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(outgoingInvoices))
+	aliceBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(aliceFundingSats), aliceBalance)
+}
+
+func (suite *KeySendTestSuite) TestV2KeysendCustomRecords() {
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test external payment alice", suite.aliceToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+
+	messageRecord := fmt.Sprint(service.TLV_WHATSAT_MESSAGE + 1)
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(v2controllers.KeySendRequestBody{
+		Amount:        100,
+		Destination:   "123456789012345678901234567890123456789012345678901234567890abcdef",
+		CustomRecords: map[string]string{messageRecord: hex.EncodeToString([]byte("hello"))},
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/keysend", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.aliceToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	// the hex encoded value is decoded before it is sent
+	assert.Equal(suite.T(), []byte("hello"), suite.mlnd.LastSendRequest.DestCustomRecords[service.TLV_WHATSAT_MESSAGE+1])
+	keySendResponse := &v2controllers.KeySendResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(keySendResponse))
+	assert.Equal(suite.T(), hex.EncodeToString([]byte("hello")), keySendResponse.CustomRecords[messageRecord])
+}
+
+func (suite *KeySendTestSuite) TestV2KeysendPaymentInvalidRequest() {
+	aliceFundingSats := 1000
+	//fund alice account
+	invoiceResponse := suite.createAddInvoiceReq(aliceFundingSats, "integration test external payment alice", suite.aliceToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+
+	for _, tc := range []struct {
+		reqBody         v2controllers.KeySendRequestBody
+		expectedMessage string
+	}{
+		{
+			reqBody: v2controllers.KeySendRequestBody{
+				Amount:      100,
+				Destination: "12345",
+			},
+			expectedMessage: responses.InvalidDestinationError.Message,
+		},
+		{
+			reqBody: v2controllers.KeySendRequestBody{
+				Amount:        100,
+				Destination:   "123456789012345678901234567890123456789012345678901234567890abcdef",
+				CustomRecords: map[string]string{"1234": "value"},
+			},
+			expectedMessage: responses.InvalidCustomRecordError.Message,
+		},
+		{
+			reqBody: v2controllers.KeySendRequestBody{
+				Amount:        100,
+				Destination:   "123456789012345678901234567890123456789012345678901234567890abcdef",
+				CustomRecords: map[string]string{fmt.Sprint(service.KEYSEND_CUSTOM_RECORD): "76616c7565"},
+			},
+			expectedMessage: responses.InvalidCustomRecordError.Message,
+		},
+		{
+			// even records must be understood by the receiver
+			reqBody: v2controllers.KeySendRequestBody{
+				Amount:        100,
+				Destination:   "123456789012345678901234567890123456789012345678901234567890abcdef",
+				CustomRecords: map[string]string{"696970": "76616c7565"},
+			},
+			expectedMessage: responses.InvalidCustomRecordError.Message,
+		},
+		{
+			reqBody: v2controllers.KeySendRequestBody{
+				Amount:        100,
+				Destination:   "123456789012345678901234567890123456789012345678901234567890abcdef",
+				CustomRecords: map[string]string{fmt.Sprint(service.TLV_WHATSAT_MESSAGE + 1): "value"},
+			},
+			expectedMessage: responses.InvalidCustomRecordValueError.Message,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		var buf bytes.Buffer
+		assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(tc.reqBody))
+		req := httptest.NewRequest(http.MethodPost, "/v2/payments/keysend", &buf)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.aliceToken))
+		suite.echo.ServeHTTP(rec, req)
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+		errorResponse := &responses.ErrorResponse{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+		assert.Equal(suite.T(), tc.expectedMessage, errorResponse.Message)
+	}
+
+	// no outgoing invoice was created for the invalid requests
+	userId := getUserIdFromToken(suite.aliceToken)
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(outgoingInvoices))
+}
+
 func TestKeySendTestSuite(t *testing.T) {
 	suite.Run(t, new(KeySendTestSuite))
 }
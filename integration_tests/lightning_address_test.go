@@ -0,0 +1,120 @@
+package integration_tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LightningAddressTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+	userIds []int64
+}
+
+func (suite *LightningAddressTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.LNURLMinSendable = 1000
+	svc.Config.LNURLMaxSendable = 100000000
+	users, _, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	for _, user := range users {
+		dbUser, err := svc.FindUserByLogin(context.Background(), user.Login)
+		if err != nil {
+			log.Fatalf("Error finding test user: %v", err)
+		}
+		suite.userIds = append(suite.userIds, dbUser.ID)
+	}
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.GET("/.well-known/lnurlpay/:username", controllers.NewLNURLPayController(suite.service).LightningAddress)
+	suite.echo.GET("/.well-known/lnurlp/:username/callback", controllers.NewLNURLPayController(suite.service).LightningAddressCallback)
+}
+
+func (suite *LightningAddressTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *LightningAddressTestSuite) TestGetUserByLightningAddress() {
+	_, err := suite.service.GetUserByLightningAddress(context.Background(), "satoshi")
+	assert.ErrorIs(suite.T(), err, sql.ErrNoRows)
+
+	lightningAddress := "Satoshi"
+	_, err = suite.service.UpdateUser(context.Background(), suite.userIds[0], nil, nil, nil, &lightningAddress, nil)
+	assert.NoError(suite.T(), err)
+
+	// usernames are case-insensitive
+	user, err := suite.service.GetUserByLightningAddress(context.Background(), "SATOSHI")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.userIds[0], user.ID)
+	assert.Equal(suite.T(), "satoshi", user.LightningAddress.String)
+
+	// usernames are unique
+	lightningAddress = "satoshi"
+	_, err = suite.service.UpdateUser(context.Background(), suite.userIds[1], nil, nil, nil, &lightningAddress, nil)
+	assert.Error(suite.T(), err)
+
+	lightningAddress = "not a username"
+	_, err = suite.service.UpdateUser(context.Background(), suite.userIds[1], nil, nil, nil, &lightningAddress, nil)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *LightningAddressTestSuite) TestLightningAddressEndpoint() {
+	lightningAddress := "hal"
+	_, err := suite.service.UpdateUser(context.Background(), suite.userIds[1], nil, nil, nil, &lightningAddress, nil)
+	assert.NoError(suite.T(), err)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/lnurlpay/Hal", nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	lnurlPayResponse := &controllers.LNURLPayResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(lnurlPayResponse))
+	assert.Equal(suite.T(), "payRequest", lnurlPayResponse.Tag)
+	metadata := [][]string{}
+	assert.NoError(suite.T(), json.Unmarshal([]byte(lnurlPayResponse.Metadata), &metadata))
+	assert.Contains(suite.T(), metadata, []string{"text/identifier", "hal@example.com"})
+	// the callback doesn't contain the login
+	assert.Equal(suite.T(), "http://example.com/.well-known/lnurlp/hal/callback", lnurlPayResponse.Callback)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/.well-known/lnurlp/hal/callback?amount=21000", nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	callbackResponse := &controllers.LNURLPayCallbackResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(callbackResponse))
+	assert.NotEmpty(suite.T(), callbackResponse.PaymentRequest)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/.well-known/lnurlpay/unknown", nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+}
+
+func TestLightningAddressTestSuite(t *testing.T) {
+	suite.Run(t, new(LightningAddressTestSuite))
+}
@@ -0,0 +1,134 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const listUsersTestAdminToken = "admin_token"
+
+type ListUsersTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userLogins               []ExpectedCreateUserResponseBody
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *ListUsersTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	userLogins, userTokens, err := createUsers(svc, 3)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userLogins = userLogins
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.GET("/v2/admin/users", v2controllers.NewListUsersController(suite.service).ListUsers, tokens.AdminTokenMiddleware(listUsersTestAdminToken))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *ListUsersTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ListUsersTestSuite) TestListUsersWithBalances() {
+	// fund the first two users, the last one has no transactions
+	for i, amount := range []int{1000, 250} {
+		invoiceResponse := suite.createAddInvoiceReq(amount, "integration test list users", suite.userTokens[i])
+		err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+		assert.NoError(suite.T(), err)
+	}
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+
+	rec := suite.listUsers("not_the_admin_token")
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+
+	// the users are returned newest first
+	rec = suite.listUsers(listUsersTestAdminToken, "limit=2")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	firstPage := &v2controllers.ListUsersResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(firstPage))
+	assert.Equal(suite.T(), 2, len(firstPage.Users))
+	assert.NotZero(suite.T(), firstPage.NextCursor)
+	assert.Equal(suite.T(), suite.userLogins[2].Login, firstPage.Users[0].Login)
+	assert.Equal(suite.T(), int64(0), firstPage.Users[0].Balance)
+	assert.Equal(suite.T(), suite.userLogins[1].Login, firstPage.Users[1].Login)
+	assert.Equal(suite.T(), int64(250), firstPage.Users[1].Balance)
+
+	rec = suite.listUsers(listUsersTestAdminToken, "limit=2", fmt.Sprintf("cursor=%d", firstPage.NextCursor))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	secondPage := &v2controllers.ListUsersResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(secondPage))
+	assert.Equal(suite.T(), 1, len(secondPage.Users))
+	assert.Zero(suite.T(), secondPage.NextCursor)
+	assert.Equal(suite.T(), suite.userLogins[0].Login, secondPage.Users[0].Login)
+	assert.Equal(suite.T(), int64(1000), secondPage.Users[0].Balance)
+
+	// the aggregated balances match the balances of the single users
+	for _, user := range append(firstPage.Users, secondPage.Users...) {
+		balance, err := suite.service.CurrentUserBalance(context.Background(), user.ID)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), balance, user.Balance)
+	}
+
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.listUsers(listUsersTestAdminToken, "limit=1000").Code)
+}
+
+func (suite *ListUsersTestSuite) listUsers(adminToken string, query ...string) *httptest.ResponseRecorder {
+	path := "/v2/admin/users"
+	for i, q := range query {
+		if i == 0 {
+			path += "?" + q
+		} else {
+			path += "&" + q
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", adminToken))
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestListUsersTestSuite(t *testing.T) {
+	suite.Run(t, new(ListUsersTestSuite))
+}
@@ -23,7 +23,7 @@ func TestLNDCluster(t *testing.T) {
 		Nodes:               mockClients,
 		ActiveNode:          mockClients[0],
 		ActiveChannelRatio:  0.5,
-		Logger:              lib.Logger(""),
+		Logger:              lib.Logger("", ""),
 		LivenessCheckPeriod: 1,
 	}
 	ctx, cancel := context.WithCancel(context.Background())
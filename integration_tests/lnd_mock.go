@@ -5,8 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	btcec "github.com/btcsuite/btcd/btcec/v2"
@@ -15,6 +18,7 @@ import (
 	"github.com/getAlby/lndhub.go/lnd"
 	"github.com/labstack/gommon/random"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/lightningnetwork/lnd/lnwire"
 	"github.com/lightningnetwork/lnd/zpay32"
@@ -28,6 +32,27 @@ type MockLND struct {
 	pubKey          *btcec.PublicKey
 	addIndexCounter uint64
 	GetInfoError    error
+	// the last request received by SendPaymentV2
+	LastSendPaymentRequest *routerrpc.SendPaymentRequest
+	// the last request received by SendPaymentSync
+	LastSendRequest *lnrpc.SendRequest
+	// hold invoices by payment hash
+	holdInvoices map[string]*invoicesrpc.AddHoldInvoiceRequest
+	// balances returned by ChannelBalance and WalletBalance
+	ChannelBalanceSat int64
+	WalletBalanceSat  int64
+	// wallet transactions returned by GetTransactions, updates are also sent to SubscribeTransactions
+	transactionsMu  sync.Mutex
+	transactions    []*lnrpc.Transaction
+	transactionChan chan *lnrpc.Transaction
+	addressCounter  uint64
+	// error returned by SendCoins and the last request it received
+	SendCoinsError       error
+	LastSendCoinsRequest *lnrpc.SendCoinsRequest
+	// offer ids by the payment hash of the invoices paid to them
+	offersMu      sync.Mutex
+	offerCounter  uint64
+	offerInvoices map[string]string
 }
 
 func NewMockLND(privkey string, fee int64, invoiceChan chan (*lnrpc.Invoice)) (*MockLND, error) {
@@ -44,6 +69,9 @@ func NewMockLND(privkey string, fee int64, invoiceChan chan (*lnrpc.Invoice)) (*
 		privKey:         privKey,
 		pubKey:          pubKey,
 		addIndexCounter: 0,
+		holdInvoices:    map[string]*invoicesrpc.AddHoldInvoiceRequest{},
+		transactionChan: make(chan *lnrpc.Transaction, 10),
+		offerInvoices:   map[string]string{},
 	}, nil
 }
 
@@ -71,6 +99,7 @@ func (mlnd *MockLND) ListChannels(ctx context.Context, req *lnrpc.ListChannelsRe
 }
 
 func (mlnd *MockLND) SendPaymentSync(ctx context.Context, req *lnrpc.SendRequest, options ...grpc.CallOption) (*lnrpc.SendResponse, error) {
+	mlnd.LastSendRequest = req
 	return &lnrpc.SendResponse{
 		PaymentError:    "",
 		PaymentPreimage: []byte("preimage"),
@@ -86,11 +115,63 @@ func (mlnd *MockLND) SendPaymentSync(ctx context.Context, req *lnrpc.SendRequest
 	}, nil
 }
 
+type MockSendPayment struct {
+	payment *lnrpc.Payment
+}
+
+func (mockSend *MockSendPayment) Recv() (*lnrpc.Payment, error) {
+	return mockSend.payment, nil
+}
+
+// SendPaymentV2 settles the payment right away, split into MaxParts HTLCs
+func (mlnd *MockLND) SendPaymentV2(ctx context.Context, req *routerrpc.SendPaymentRequest, options ...grpc.CallOption) (lnd.SubscribePaymentWrapper, error) {
+	mlnd.LastSendPaymentRequest = req
+	payReq, err := mlnd.DecodeBolt11(ctx, req.PaymentRequest)
+	if err != nil {
+		return nil, err
+	}
+	// like the router of LND
+	if req.Amt != 0 && payReq.NumSatoshis != 0 {
+		return nil, fmt.Errorf("amount must not be specified when paying a non-zero amount invoice")
+	}
+	amt := req.Amt
+	if amt == 0 {
+		amt = payReq.NumSatoshis
+	}
+	numParts := int64(req.MaxParts)
+	if numParts == 0 {
+		numParts = 1
+	}
+	htlcs := []*lnrpc.HTLCAttempt{}
+	for i := int64(0); i < numParts; i++ {
+		htlcs = append(htlcs, &lnrpc.HTLCAttempt{
+			Status: lnrpc.HTLCAttempt_SUCCEEDED,
+			Route: &lnrpc.Route{
+				TotalAmt: amt / numParts,
+			},
+		})
+	}
+	return &MockSendPayment{
+		payment: &lnrpc.Payment{
+			PaymentHash:     payReq.PaymentHash,
+			PaymentPreimage: hex.EncodeToString([]byte("preimage")),
+			PaymentRequest:  req.PaymentRequest,
+			ValueSat:        amt,
+			FeeSat:          mlnd.fee,
+			Status:          lnrpc.Payment_SUCCEEDED,
+			Htlcs:           htlcs,
+		},
+	}, nil
+}
+
 func (mlnd *MockLND) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
 	pHash := sha256.New()
 	pHash.Write(req.RPreimage)
 	pHash.Sum(nil)
 	msat := lnwire.MilliSatoshi(1000 * req.Value)
+	if req.ValueMsat != 0 {
+		msat = lnwire.MilliSatoshi(req.ValueMsat)
+	}
 	invoice := &zpay32.Invoice{
 		Net:         &chaincfg.RegressionNetParams,
 		MilliSat:    &msat,
@@ -102,12 +183,14 @@ func (mlnd *MockLND) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options
 		},
 		FallbackAddr: nil,
 	}
-	zpay32.Expiry(time.Duration(req.Expiry))(invoice)
+	if req.Expiry != 0 {
+		zpay32.Expiry(time.Duration(req.Expiry) * time.Second)(invoice)
+	}
 	copy(invoice.PaymentHash[:], pHash.Sum(nil))
 	copy(invoice.PaymentAddr[:], req.PaymentAddr)
 	if len(req.DescriptionHash) != 0 {
 		invoice.DescriptionHash = &[32]byte{}
-		copy(req.DescriptionHash, invoice.DescriptionHash[:])
+		copy(invoice.DescriptionHash[:], req.DescriptionHash)
 	}
 	if req.Memo != "" {
 		invoice.Description = &req.Memo
@@ -118,14 +201,89 @@ func (mlnd *MockLND) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options
 	if err != nil {
 		return nil, err
 	}
-	mlnd.addIndexCounter += 1
+	// invoices of a batch are added concurrently
+	addIndex := atomic.AddUint64(&mlnd.addIndexCounter, 1)
 	return &lnrpc.AddInvoiceResponse{
 		RHash:          invoice.PaymentHash[:],
+		PaymentRequest: pr,
+		AddIndex:       addIndex,
+	}, nil
+}
+
+func (mlnd *MockLND) AddHoldInvoice(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest, options ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	msat := lnwire.MilliSatoshi(1000 * req.Value)
+	invoice := &zpay32.Invoice{
+		Net:         &chaincfg.RegressionNetParams,
+		MilliSat:    &msat,
+		Timestamp:   time.Now(),
+		PaymentHash: &[32]byte{},
+		PaymentAddr: &[32]byte{},
+		Features: &lnwire.FeatureVector{
+			RawFeatureVector: &lnwire.RawFeatureVector{},
+		},
+		Description: &req.Memo,
+	}
+	copy(invoice.PaymentHash[:], req.Hash)
+	pr, err := invoice.Encode(zpay32.MessageSigner{
+		SignCompact: mlnd.signMsg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	mlnd.addIndexCounter += 1
+	mlnd.holdInvoices[hex.EncodeToString(req.Hash)] = req
+	return &invoicesrpc.AddHoldInvoiceResp{
 		PaymentRequest: pr,
 		AddIndex:       mlnd.addIndexCounter,
 	}, nil
 }
 
+// mockHoldInvoiceUpdate sends an update of a hold invoice to the invoice subscription
+func (mlnd *MockLND) mockHoldInvoiceUpdate(rHash []byte, state lnrpc.Invoice_InvoiceState, preimage []byte) error {
+	req, ok := mlnd.holdInvoices[hex.EncodeToString(rHash)]
+	if !ok {
+		return fmt.Errorf("hold invoice not found")
+	}
+	incoming := &lnrpc.Invoice{
+		Memo:         req.Memo,
+		RHash:        rHash,
+		RPreimage:    preimage,
+		Value:        req.Value,
+		ValueMsat:    1000 * req.Value,
+		CreationDate: time.Now().Unix(),
+		State:        state,
+		Htlcs:        []*lnrpc.InvoiceHTLC{},
+	}
+	if state == lnrpc.Invoice_ACCEPTED || state == lnrpc.Invoice_SETTLED {
+		incoming.AmtPaid = req.Value
+		incoming.AmtPaidSat = req.Value
+		incoming.AmtPaidMsat = 1000 * req.Value
+	}
+	if state == lnrpc.Invoice_SETTLED {
+		incoming.Settled = true
+		incoming.SettleDate = time.Now().Unix()
+	}
+	mlnd.Sub.invoiceChan <- incoming
+	return nil
+}
+
+func (mlnd *MockLND) SettleInvoice(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error) {
+	rHash := sha256.Sum256(req.Preimage)
+	err := mlnd.mockHoldInvoiceUpdate(rHash[:], lnrpc.Invoice_SETTLED, req.Preimage)
+	if err != nil {
+		return nil, err
+	}
+	return &invoicesrpc.SettleInvoiceResp{}, nil
+}
+
+func (mlnd *MockLND) CancelInvoice(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error) {
+	err := mlnd.mockHoldInvoiceUpdate(req.PaymentHash, lnrpc.Invoice_CANCELED, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &invoicesrpc.CancelInvoiceResp{}, nil
+}
+
 func (mlnd *MockLND) mockPaidInvoice(added *ExpectedAddInvoiceResponseBody, amtPaid int64, keysend bool, htlc *lnrpc.InvoiceHTLC) error {
 	var incoming *lnrpc.Invoice
 	if !keysend {
@@ -137,6 +295,10 @@ func (mlnd *MockLND) mockPaidInvoice(added *ExpectedAddInvoiceResponseBody, amtP
 		if err != nil {
 			return err
 		}
+		descriptionHash, err := hex.DecodeString(inv.DescriptionHash)
+		if err != nil {
+			return err
+		}
 		incoming = &lnrpc.Invoice{
 			Memo:            inv.Description,
 			RPreimage:       []byte("123preimage"),
@@ -147,7 +309,7 @@ func (mlnd *MockLND) mockPaidInvoice(added *ExpectedAddInvoiceResponseBody, amtP
 			CreationDate:    time.Now().Unix(),
 			SettleDate:      time.Now().Unix(),
 			PaymentRequest:  added.PayReq,
-			DescriptionHash: []byte(inv.DescriptionHash),
+			DescriptionHash: descriptionHash,
 			FallbackAddr:    inv.FallbackAddr,
 			CltvExpiry:      uint64(inv.CltvExpiry),
 			AmtPaid:         inv.NumSatoshis,
@@ -195,6 +357,13 @@ func (mlnd *MockLND) SubscribeInvoices(ctx context.Context, req *lnrpc.InvoiceSu
 	return mlnd.Sub, nil
 }
 
+func (mlnd *MockLND) EstimateRouteFee(ctx context.Context, req *routerrpc.RouteFeeRequest, options ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	return &routerrpc.RouteFeeResponse{
+		RoutingFeeMsat: 1000 * mlnd.fee,
+		TimeLockDelay:  40,
+	}, nil
+}
+
 func (mlnd *MockLND) GetInfo(ctx context.Context, req *lnrpc.GetInfoRequest, options ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
 	if mlnd.GetInfoError != nil {
 		return nil, mlnd.GetInfoError
@@ -224,6 +393,23 @@ func (mlnd *MockLND) GetInfo(ctx context.Context, req *lnrpc.GetInfoRequest, opt
 	}, nil
 }
 
+func (mlnd *MockLND) ChannelBalance(ctx context.Context, req *lnrpc.ChannelBalanceRequest, options ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error) {
+	return &lnrpc.ChannelBalanceResponse{
+		Balance: mlnd.ChannelBalanceSat,
+		LocalBalance: &lnrpc.Amount{
+			Sat:  uint64(mlnd.ChannelBalanceSat),
+			Msat: uint64(mlnd.ChannelBalanceSat * 1000),
+		},
+	}, nil
+}
+
+func (mlnd *MockLND) WalletBalance(ctx context.Context, req *lnrpc.WalletBalanceRequest, options ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
+	return &lnrpc.WalletBalanceResponse{
+		TotalBalance:     mlnd.WalletBalanceSat,
+		ConfirmedBalance: mlnd.WalletBalanceSat,
+	}, nil
+}
+
 func (mlnd *MockLND) TrackPayment(ctx context.Context, hash []byte, options ...grpc.CallOption) (*lnrpc.Payment, error) {
 	return nil, nil
 }
@@ -233,25 +419,205 @@ func (mlnd *MockLND) DecodeBolt11(ctx context.Context, bolt11 string, options ..
 	if err != nil {
 		return nil, err
 	}
+	var amountMsat int64
+	if inv.MilliSat != nil {
+		amountMsat = int64(*inv.MilliSat)
+	}
 	result := &lnrpc.PayReq{
 		Destination: hex.EncodeToString(inv.Destination.SerializeCompressed()),
 		PaymentHash: hex.EncodeToString(inv.PaymentHash[:]),
-		NumSatoshis: int64(*inv.MilliSat) / 1000,
+		NumSatoshis: amountMsat / 1000,
 		Timestamp:   inv.Timestamp.Unix(),
 		Expiry:      int64(inv.Expiry()),
-		Description: *inv.Description,
 		CltvExpiry:  int64(inv.MinFinalCLTVExpiry()),
 		RouteHints:  []*lnrpc.RouteHint{},
 		PaymentAddr: []byte{},
-		NumMsat:     int64(*inv.MilliSat),
+		NumMsat:     amountMsat,
 		Features:    map[uint32]*lnrpc.Feature{},
 	}
+	if inv.Description != nil {
+		result.Description = *inv.Description
+	}
 	if inv.DescriptionHash != nil {
-		result.DescriptionHash = string(inv.DescriptionHash[:])
+		result.DescriptionHash = hex.EncodeToString(inv.DescriptionHash[:])
+	}
+	for _, routeHint := range inv.RouteHints {
+		hopHints := []*lnrpc.HopHint{}
+		for _, hopHint := range routeHint {
+			hopHints = append(hopHints, &lnrpc.HopHint{
+				NodeId:                    hex.EncodeToString(hopHint.NodeID.SerializeCompressed()),
+				ChanId:                    hopHint.ChannelID,
+				FeeBaseMsat:               hopHint.FeeBaseMSat,
+				FeeProportionalMillionths: hopHint.FeeProportionalMillionths,
+				CltvExpiryDelta:           uint32(hopHint.CLTVExpiryDelta),
+			})
+		}
+		result.RouteHints = append(result.RouteHints, &lnrpc.RouteHint{HopHints: hopHints})
 	}
 	return result, nil
 }
 
+func (mlnd *MockLND) NewAddress(ctx context.Context, req *lnrpc.NewAddressRequest, options ...grpc.CallOption) (*lnrpc.NewAddressResponse, error) {
+	mlnd.transactionsMu.Lock()
+	defer mlnd.transactionsMu.Unlock()
+	mlnd.addressCounter++
+	return &lnrpc.NewAddressResponse{
+		Address: fmt.Sprintf("bcrt1qmockaddress%d", mlnd.addressCounter),
+	}, nil
+}
+
+func (mlnd *MockLND) GetTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (*lnrpc.TransactionDetails, error) {
+	mlnd.transactionsMu.Lock()
+	defer mlnd.transactionsMu.Unlock()
+	return &lnrpc.TransactionDetails{
+		Transactions: append([]*lnrpc.Transaction{}, mlnd.transactions...),
+	}, nil
+}
+
+func (mlnd *MockLND) SubscribeTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (lnd.SubscribeTransactionsWrapper, error) {
+	return &MockSubscribeTransactions{ctx: ctx, transactionChan: mlnd.transactionChan}, nil
+}
+
+// mockOnchainTransaction adds or updates a wallet transaction, e.g. to add a confirmation
+func (mlnd *MockLND) mockOnchainTransaction(tx *lnrpc.Transaction) {
+	mlnd.transactionsMu.Lock()
+	replaced := false
+	for i, existing := range mlnd.transactions {
+		if existing.TxHash == tx.TxHash {
+			mlnd.transactions[i] = tx
+			replaced = true
+		}
+	}
+	if !replaced {
+		mlnd.transactions = append(mlnd.transactions, tx)
+	}
+	mlnd.transactionsMu.Unlock()
+	select {
+	case mlnd.transactionChan <- tx:
+	default:
+	}
+}
+
+// the fee estimates and the sent transactions of the mock have this size
+const mockOnchainTxVbytes = 141
+
+func (mlnd *MockLND) EstimateFee(ctx context.Context, req *lnrpc.EstimateFeeRequest, options ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
+	var satPerVbyte uint64 = 10
+	return &lnrpc.EstimateFeeResponse{
+		FeeSat:      int64(satPerVbyte * mockOnchainTxVbytes),
+		SatPerVbyte: satPerVbyte,
+	}, nil
+}
+
+func (mlnd *MockLND) SendCoins(ctx context.Context, req *lnrpc.SendCoinsRequest, options ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
+	mlnd.transactionsMu.Lock()
+	mlnd.LastSendCoinsRequest = req
+	mlnd.transactionsMu.Unlock()
+	if mlnd.SendCoinsError != nil {
+		return nil, mlnd.SendCoinsError
+	}
+	txHash := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", req.Addr, req.Amount, time.Now().UnixNano())))
+	txid := hex.EncodeToString(txHash[:])
+	mlnd.mockOnchainTransaction(&lnrpc.Transaction{
+		TxHash:    txid,
+		Amount:    -req.Amount,
+		TotalFees: int64(req.SatPerVbyte * mockOnchainTxVbytes),
+		OutputDetails: []*lnrpc.OutputDetail{{
+			Address: req.Addr,
+			Amount:  req.Amount,
+		}},
+	})
+	return &lnrpc.SendCoinsResponse{Txid: txid}, nil
+}
+
+type MockSubscribeTransactions struct {
+	ctx             context.Context
+	transactionChan chan *lnrpc.Transaction
+}
+
+func (mockSub *MockSubscribeTransactions) Recv() (*lnrpc.Transaction, error) {
+	select {
+	case tx := <-mockSub.transactionChan:
+		return tx, nil
+	case <-mockSub.ctx.Done():
+		return nil, mockSub.ctx.Err()
+	}
+}
+
+func (mlnd *MockLND) CreateOffer(ctx context.Context, req *lnd.OfferRequest) (*lnd.Offer, error) {
+	mlnd.offersMu.Lock()
+	defer mlnd.offersMu.Unlock()
+	mlnd.offerCounter++
+	offerId := sha256.Sum256([]byte(fmt.Sprintf("offer:%d:%d", mlnd.offerCounter, time.Now().UnixNano())))
+	return &lnd.Offer{
+		OfferID: hex.EncodeToString(offerId[:]),
+		Bolt12:  fmt.Sprintf("lno1mock%d", mlnd.offerCounter),
+	}, nil
+}
+
+func (mlnd *MockLND) LookupInvoiceOffer(ctx context.Context, rHash []byte) (offerId string, err error) {
+	mlnd.offersMu.Lock()
+	defer mlnd.offersMu.Unlock()
+	return mlnd.offerInvoices[hex.EncodeToString(rHash)], nil
+}
+
+// the node of the issuer of the offers that are paid with FetchOfferInvoice
+const mockOfferIssuerPubkey = "02a5f8b4ae3f8cb2a3a0e1c7bd0c93a4e7d5de28ad187b1b68e1d0bb7ab1edd7c3"
+
+// FetchOfferInvoice returns an invoice of an offer without an amount
+func (mlnd *MockLND) FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+	if amountMsat <= 0 {
+		return nil, lnd.ErrOfferAmountRequired
+	}
+	preimage, err := makePreimageHex()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(preimage)
+	return &lnd.OfferInvoice{
+		PaymentRequest: "lni1mock",
+		PayReq: &lnrpc.PayReq{
+			Destination: mockOfferIssuerPubkey,
+			PaymentHash: hex.EncodeToString(hash[:]),
+			NumSatoshis: amountMsat / 1000,
+			NumMsat:     amountMsat,
+			Timestamp:   time.Now().Unix(),
+			Expiry:      7200,
+			Description: "offer",
+		},
+	}, nil
+}
+
+// mockPaidOffer settles a new invoice of the offer like the node does for the invoice request of a payer
+func (mlnd *MockLND) mockPaidOffer(offerId string, amount int64) (rHash string, err error) {
+	preimage, err := makePreimageHex()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(preimage)
+	rHash = hex.EncodeToString(hash[:])
+	mlnd.offersMu.Lock()
+	mlnd.offerInvoices[rHash] = offerId
+	mlnd.offersMu.Unlock()
+	mlnd.Sub.invoiceChan <- &lnrpc.Invoice{
+		Memo:           "lndhub",
+		RPreimage:      preimage,
+		RHash:          hash[:],
+		Value:          amount,
+		ValueMsat:      1000 * amount,
+		Settled:        true,
+		CreationDate:   time.Now().Unix(),
+		SettleDate:     time.Now().Unix(),
+		PaymentRequest: "lni1mock",
+		AmtPaid:        amount,
+		AmtPaidSat:     amount,
+		AmtPaidMsat:    1000 * amount,
+		State:          lnrpc.Invoice_SETTLED,
+		Htlcs:          []*lnrpc.InvoiceHTLC{},
+	}
+	return rHash, nil
+}
+
 func (mlnd *MockLND) IsIdentityPubkey(pubkey string) (isOurPubkey bool) {
 	return pubkey == hex.EncodeToString(mlnd.pubKey.SerializeCompressed())
 }
@@ -56,3 +56,24 @@ func (wrapper *LNDMockHodlWrapperAsync) SettlePayment(payment lnrpc.Payment) {
 
 //write test that completes payment
 //write test that fails payment
+
+// mock where send payment sync blocks until the payment context is done
+// the outcome of the payment can then be sent to the payment tracker
+type LNDMockTimeoutWrapperAsync struct {
+	*LNDMockHodlWrapperAsync
+}
+
+func NewLNDMockTimeoutWrapperAsync(lnd lnd.LightningClientWrapper) (result *LNDMockTimeoutWrapperAsync, err error) {
+	hodlWrapper, err := NewLNDMockHodlWrapperAsync(lnd)
+	if err != nil {
+		return nil, err
+	}
+	return &LNDMockTimeoutWrapperAsync{
+		LNDMockHodlWrapperAsync: hodlWrapper,
+	}, nil
+}
+
+func (wrapper *LNDMockTimeoutWrapperAsync) SendPaymentSync(ctx context.Context, req *lnrpc.SendRequest, options ...grpc.CallOption) (*lnrpc.SendResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
@@ -0,0 +1,117 @@
+package integration_tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LNURLPayTestSuite struct {
+	TestSuite
+	service   *service.LndhubService
+	userLogin ExpectedCreateUserResponseBody
+}
+
+func (suite *LNURLPayTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.LNURLMinSendable = 1000
+	svc.Config.LNURLMaxSendable = 100000000
+	users, _, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userLogin = users[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	lnurlPayCtrl := controllers.NewLNURLPayController(suite.service)
+	suite.echo.GET("/lnurlp/:user", lnurlPayCtrl.LNURLPay)
+	suite.echo.GET("/lnurlp/:user/callback", lnurlPayCtrl.LNURLPayCallback)
+}
+
+func (suite *LNURLPayTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *LNURLPayTestSuite) TestLNURLPay() {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlp/%s", suite.userLogin.Login), nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	lnurlPayResponse := &controllers.LNURLPayResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(lnurlPayResponse))
+	assert.Equal(suite.T(), "payRequest", lnurlPayResponse.Tag)
+	assert.Equal(suite.T(), int64(1000), lnurlPayResponse.MinSendable)
+	assert.Equal(suite.T(), int64(100000000), lnurlPayResponse.MaxSendable)
+	assert.Equal(suite.T(), fmt.Sprintf("http://example.com/lnurlp/%s/callback", suite.userLogin.Login), lnurlPayResponse.Callback)
+	metadata := [][]string{}
+	assert.NoError(suite.T(), json.Unmarshal([]byte(lnurlPayResponse.Metadata), &metadata))
+	assert.Equal(suite.T(), "text/plain", metadata[0][0])
+
+	// the invoice commits to the served metadata
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlp/%s/callback?amount=%d", suite.userLogin.Login, 21000), nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	callbackResponse := &controllers.LNURLPayCallbackResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(callbackResponse))
+	assert.NotEmpty(suite.T(), callbackResponse.PaymentRequest)
+	assert.Equal(suite.T(), 0, len(callbackResponse.Routes))
+
+	user, err := suite.service.FindUserByLogin(context.Background(), suite.userLogin.Login)
+	assert.NoError(suite.T(), err)
+	invoices, err := suite.service.InvoicesFor(context.Background(), user.ID, common.InvoiceTypeIncoming)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(invoices))
+	assert.Equal(suite.T(), int64(21), invoices[0].Amount)
+	assert.Equal(suite.T(), callbackResponse.PaymentRequest, invoices[0].PaymentRequest)
+	metadataHash := sha256.Sum256([]byte(lnurlPayResponse.Metadata))
+	assert.Equal(suite.T(), hex.EncodeToString(metadataHash[:]), invoices[0].DescriptionHash)
+}
+
+func (suite *LNURLPayTestSuite) TestLNURLPayCallbackInvalidAmount() {
+	for _, amount := range []string{"abc", "999", "100000001000", "1500"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlp/%s/callback?amount=%s", suite.userLogin.Login, amount), nil)
+		suite.echo.ServeHTTP(rec, req)
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+		errorResponse := &controllers.LNURLStatusResponseBody{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+		assert.Equal(suite.T(), "ERROR", errorResponse.Status)
+	}
+}
+
+func (suite *LNURLPayTestSuite) TestLNURLPayUnknownUser() {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/lnurlp/unknown", nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+}
+
+func TestLNURLPayTestSuite(t *testing.T) {
+	suite.Run(t, new(LNURLPayTestSuite))
+}
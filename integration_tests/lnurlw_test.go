@@ -0,0 +1,226 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LNURLWithdrawTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *LNURLWithdrawTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	assert.Equal(suite.T(), 1, len(users))
+	assert.Equal(suite.T(), 1, len(userTokens))
+	suite.userToken = userTokens[0]
+	// the withdraw link itself is public
+	lnurlWithdrawCtrl := controllers.NewLNURLWithdrawController(suite.service)
+	suite.echo.GET("/lnurlw/:token", lnurlWithdrawCtrl.LNURLWithdraw)
+	suite.echo.GET("/lnurlw/:token/callback", lnurlWithdrawCtrl.LNURLWithdrawCallback)
+	securedGroup := suite.echo.Group("", tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	securedGroup.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	securedGroup.POST("/v2/lnurlw", v2controllers.NewLNURLWithdrawController(suite.service).CreateWithdrawLink)
+}
+
+func (suite *LNURLWithdrawTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "withdraw_tokens")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *LNURLWithdrawTestSuite) TestLNURLWithdraw() {
+	// fund user account
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test lnurl withdraw", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	withdrawLink := suite.createWithdrawLink(500)
+	assert.True(suite.T(), strings.HasPrefix(withdrawLink.LNURL, "LNURL1"))
+	assert.Equal(suite.T(), fmt.Sprintf("http://example.com/lnurlw/%s", withdrawLink.Token), withdrawLink.Url)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlw/%s", withdrawLink.Token), nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	withdrawResponse := &controllers.LNURLWithdrawResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(withdrawResponse))
+	assert.Equal(suite.T(), "withdrawRequest", withdrawResponse.Tag)
+	assert.Equal(suite.T(), withdrawLink.Token, withdrawResponse.K1)
+	assert.Equal(suite.T(), int64(1000), withdrawResponse.MinWithdrawable)
+	assert.Equal(suite.T(), int64(500000), withdrawResponse.MaxWithdrawable)
+	assert.Equal(suite.T(), fmt.Sprintf("http://example.com/lnurlw/%s/callback", withdrawLink.Token), withdrawResponse.Callback)
+
+	rec = suite.withdraw(withdrawLink.Token, 300)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	statusResponse := &controllers.LNURLStatusResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(statusResponse))
+	assert.Equal(suite.T(), "OK", statusResponse.Status)
+
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), getUserIdFromToken(suite.userToken))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(700), userBalance)
+
+	// withdraw links can only be used once
+	rec = suite.withdraw(withdrawLink.Token, 100)
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+	statusResponse = &controllers.LNURLStatusResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(statusResponse))
+	assert.Equal(suite.T(), "ERROR", statusResponse.Status)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlw/%s", withdrawLink.Token), nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+
+	userBalance, err = suite.service.CurrentUserBalance(context.Background(), getUserIdFromToken(suite.userToken))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(700), userBalance)
+}
+
+func (suite *LNURLWithdrawTestSuite) TestLNURLWithdrawAmountExceedsMaxAmount() {
+	withdrawLink := suite.createWithdrawLink(50)
+	rec := suite.withdraw(withdrawLink.Token, 100)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	statusResponse := &controllers.LNURLStatusResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(statusResponse))
+	assert.Equal(suite.T(), "ERROR", statusResponse.Status)
+	assert.NotEmpty(suite.T(), statusResponse.Reason)
+
+	// the link wasn't used
+	token, err := suite.service.FindUnusedWithdrawToken(context.Background(), withdrawLink.Token)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), token.UsedAt.IsZero())
+}
+
+func (suite *LNURLWithdrawTestSuite) TestLNURLWithdrawOfSuspendedUser() {
+	userId := getUserIdFromToken(suite.userToken)
+	invoiceResponse := suite.createAddInvoiceReq(500, "integration test lnurl withdraw suspended", suite.userToken)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil))
+	time.Sleep(10 * time.Millisecond)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+
+	withdrawLink := suite.createWithdrawLink(200)
+	_, err = suite.service.SuspendUser(context.Background(), userId, common.SuspendModeSendOnly)
+	assert.NoError(suite.T(), err)
+	defer func() {
+		_, err := suite.service.UnsuspendUser(context.Background(), userId)
+		assert.NoError(suite.T(), err)
+	}()
+
+	// the callback is not authenticated, the suspension is still checked
+	rec := suite.withdraw(withdrawLink.Token, 100)
+	assert.NotEqual(suite.T(), http.StatusOK, rec.Code)
+	statusResponse := &controllers.LNURLStatusResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(statusResponse))
+	assert.Equal(suite.T(), "ERROR", statusResponse.Status)
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balance, userBalance)
+}
+
+func (suite *LNURLWithdrawTestSuite) TestCreateWithdrawLinkInvalidAmount() {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.CreateWithdrawLinkRequestBody{
+		MaxAmount: -1,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/lnurlw", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *LNURLWithdrawTestSuite) createWithdrawLink(maxAmount int64) *v2controllers.CreateWithdrawLinkResponseBody {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.CreateWithdrawLinkRequestBody{
+		MaxAmount: maxAmount,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/lnurlw", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	withdrawLink := &v2controllers.CreateWithdrawLinkResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(withdrawLink))
+	return withdrawLink
+}
+
+// withdraw redeems the withdraw link with an invoice of an external wallet
+func (suite *LNURLWithdrawTestSuite) withdraw(token string, amount int64) *httptest.ResponseRecorder {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: lnurl withdraw",
+		Value: amount,
+	})
+	assert.NoError(suite.T(), err)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlw/%s/callback?k1=%s&pr=%s", token, token, url.QueryEscape(invoice.PaymentRequest)), nil)
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLNURLWithdrawTestSuite(t *testing.T) {
+	suite.Run(t, new(LNURLWithdrawTestSuite))
+}
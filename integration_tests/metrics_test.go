@@ -0,0 +1,106 @@
+package integration_tests
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *MetricsTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice)))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	// a separate registry, the default one is shared by all suites
+	err = svc.InitMetrics(prometheus.NewRegistry())
+	if err != nil {
+		log.Fatalf("Error initializing metrics: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *MetricsTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *MetricsTestSuite) TestPaymentMetrics() {
+	metrics := suite.service.Metrics
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test metrics", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(suite.T(), float64(1), testutil.ToFloat64(metrics.InvoicesCreated))
+	assert.Equal(suite.T(), float64(1000), testutil.ToFloat64(metrics.UserLiabilities))
+
+	externalInvoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration test metrics external",
+		Value: 300,
+	})
+	assert.NoError(suite.T(), err)
+	payResponse := suite.createPayInvoiceReq(&ExpectedPayInvoiceRequestBody{
+		Invoice: externalInvoice.PaymentRequest,
+	}, suite.userToken)
+	assert.NotEmpty(suite.T(), payResponse.PaymentPreimage)
+
+	assert.Equal(suite.T(), float64(1), testutil.ToFloat64(metrics.PaymentsAttempted))
+	assert.Equal(suite.T(), float64(1), testutil.ToFloat64(metrics.PaymentsSucceeded))
+	assert.Equal(suite.T(), 1, testutil.CollectAndCount(metrics.PaymentDuration))
+	assert.Equal(suite.T(), float64(1000-300-suite.mlnd.fee), testutil.ToFloat64(metrics.UserLiabilities))
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
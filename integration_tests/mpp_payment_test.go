@@ -0,0 +1,261 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MPPPaymentTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *MPPPaymentTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	assert.Equal(suite.T(), 1, len(users))
+	assert.Equal(suite.T(), 1, len(userTokens))
+	suite.userToken = userTokens[0]
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+	suite.echo.GET("/v2/transactions", v2controllers.NewTransactionsController(suite.service).GetTransactions)
+}
+
+func (suite *MPPPaymentTestSuite) TestMPPPayment() {
+	// fund user account
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test mpp payment", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	// pay with the default, a single part
+	suite.mlnd.LastSendPaymentRequest = nil
+	payResponse := suite.payExternalInvoice(100, 0)
+	assert.Equal(suite.T(), 1, payResponse.NumParts)
+	assert.Nil(suite.T(), suite.mlnd.LastSendPaymentRequest)
+	assert.Equal(suite.T(), int64(100), payResponse.RequestedAmount)
+	assert.Equal(suite.T(), int64(100), payResponse.SettledAmount)
+
+	// allow the payment to be split
+	payResponse = suite.payExternalInvoice(400, 4)
+	assert.NotNil(suite.T(), suite.mlnd.LastSendPaymentRequest)
+	assert.Equal(suite.T(), uint32(4), suite.mlnd.LastSendPaymentRequest.MaxParts)
+	// the amount of the invoice is used
+	assert.Equal(suite.T(), int64(0), suite.mlnd.LastSendPaymentRequest.Amt)
+	assert.Equal(suite.T(), 4, payResponse.NumParts)
+	assert.Equal(suite.T(), int64(400), payResponse.Amount)
+	assert.Equal(suite.T(), int64(400), payResponse.RequestedAmount)
+	// the sum of the 4 settled HTLCs
+	assert.Equal(suite.T(), int64(400), payResponse.SettledAmount)
+	assert.NotEmpty(suite.T(), payResponse.PaymentPreimage)
+
+	// the amount of a zero-amount invoice is set by the client
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo: "integration tests: mpp payment without amount",
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendPayInvoiceReq(&v2controllers.PayInvoiceRequestBody{
+		Invoice:  invoice.PaymentRequest,
+		Amount:   200,
+		MaxParts: 2,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Equal(suite.T(), int64(200), suite.mlnd.LastSendPaymentRequest.Amt)
+
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), getUserIdFromToken(suite.userToken))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(300), userBalance)
+}
+
+func (suite *MPPPaymentTestSuite) TestMPPPaymentClientFeeLimit() {
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test client fee limit", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+
+	// lower than the server's fee limit of 10 sats
+	payResponse := suite.payExternalInvoiceWithFeeLimit(500, 3, 0)
+	assert.Equal(suite.T(), int64(3), suite.mlnd.LastSendPaymentRequest.FeeLimitSat)
+	assert.Equal(suite.T(), int64(3), payResponse.FeeLimit)
+
+	// the client can't get more than the server allows
+	payResponse = suite.payExternalInvoiceWithFeeLimit(500, 50, 0)
+	assert.Equal(suite.T(), int64(10), suite.mlnd.LastSendPaymentRequest.FeeLimitSat)
+	assert.Equal(suite.T(), int64(10), payResponse.FeeLimit)
+
+	// 0.1% of 500 sats is less than one sat
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: client fee limit too low",
+		Value: 500,
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendPayInvoiceReq(&v2controllers.PayInvoiceRequestBody{
+		Invoice:         invoice.PaymentRequest,
+		FeeLimitPercent: 0.1,
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.BadArgumentsError.Code, errorResponse.Code)
+}
+
+func (suite *MPPPaymentTestSuite) payExternalInvoiceWithFeeLimit(amount, feeLimitSat int64, feeLimitPercent float64) *v2controllers.PayInvoiceResponseBody {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: client fee limit",
+		Value: amount,
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendPayInvoiceReq(&v2controllers.PayInvoiceRequestBody{
+		Invoice:         invoice.PaymentRequest,
+		MaxParts:        2,
+		FeeLimitSat:     feeLimitSat,
+		FeeLimitPercent: feeLimitPercent,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	payResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payResponse))
+	return payResponse
+}
+
+func (suite *MPPPaymentTestSuite) TestPaymentLabel() {
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test payment label", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: payment label",
+		Value: 100,
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendPayInvoiceReq(&v2controllers.PayInvoiceRequestBody{
+		Invoice: invoice.PaymentRequest,
+		Label:   "order-42",
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	payResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payResponse))
+	assert.Equal(suite.T(), "order-42", payResponse.Label)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/transactions?label=order-42", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	transactions := &v2controllers.GetTransactionsResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(transactions))
+	assert.Equal(suite.T(), 1, len(transactions.Transactions))
+	assert.Equal(suite.T(), payResponse.PaymentHash, transactions.Transactions[0].PaymentHash)
+	assert.Equal(suite.T(), "order-42", transactions.Transactions[0].Label)
+
+	// labels are limited to 256 characters
+	rec = suite.sendPayInvoiceReq(&v2controllers.PayInvoiceRequestBody{
+		Invoice: invoice.PaymentRequest,
+		Label:   strings.Repeat("a", 257),
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *MPPPaymentTestSuite) TestMPPPaymentInvalidMaxParts() {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: mpp payment invalid max parts",
+		Value: 10,
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendPayInvoiceReq(&v2controllers.PayInvoiceRequestBody{
+		Invoice:  invoice.PaymentRequest,
+		MaxParts: 100,
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *MPPPaymentTestSuite) payExternalInvoice(amount int64, maxParts uint32) *v2controllers.PayInvoiceResponseBody {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: mpp payment",
+		Value: amount,
+	})
+	assert.NoError(suite.T(), err)
+	rec := suite.sendPayInvoiceReq(&v2controllers.PayInvoiceRequestBody{
+		Invoice:  invoice.PaymentRequest,
+		MaxParts: maxParts,
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	payResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payResponse))
+	return payResponse
+}
+
+func (suite *MPPPaymentTestSuite) sendPayInvoiceReq(reqBody *v2controllers.PayInvoiceRequestBody) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(reqBody))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *MPPPaymentTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func TestMPPPaymentTestSuite(t *testing.T) {
+	suite.Run(t, new(MPPPaymentTestSuite))
+}
@@ -0,0 +1,182 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OfferTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *OfferTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.EnableOffers = true
+	_, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.GET("/v2/offers", v2controllers.NewOfferController(svc).Offer, tokens.Middleware([]byte(suite.service.Config.JWTSecret)), tokens.RequireScope(common.ScopeInvoice))
+	suite.echo.POST("/v2/payments/bolt12", v2controllers.NewPayInvoiceController(svc).PayOffer, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *OfferTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "offers")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *OfferTestSuite) getOffer(token string) *v2controllers.OfferResponseBody {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/offers", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	offer := &v2controllers.OfferResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(offer))
+	return offer
+}
+
+func (suite *OfferTestSuite) TestOffer() {
+	offer := suite.getOffer(suite.userTokens[0])
+	assert.NotEmpty(suite.T(), offer.OfferID)
+	assert.NotEmpty(suite.T(), offer.Bolt12)
+	// the offer is reusable, the same one is returned again
+	assert.Equal(suite.T(), offer, suite.getOffer(suite.userTokens[0]))
+	otherOffer := suite.getOffer(suite.userTokens[1])
+	assert.NotEqual(suite.T(), offer.OfferID, otherOffer.OfferID)
+
+	// every payment to the offer is credited to its user
+	userId := getUserIdFromToken(suite.userTokens[0])
+	rHash, err := suite.mlnd.mockPaidOffer(offer.OfferID, 1000)
+	assert.NoError(suite.T(), err)
+	_, err = suite.mlnd.mockPaidOffer(offer.OfferID, 500)
+	assert.NoError(suite.T(), err)
+	time.Sleep(100 * time.Millisecond)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1500), balance)
+	invoice, err := suite.service.FindInvoiceByPaymentHash(context.Background(), userId, rHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceTypeIncoming, invoice.Type)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, invoice.State)
+	assert.Equal(suite.T(), int64(1000), invoice.Amount)
+
+	otherBalance, err := suite.service.CurrentUserBalance(context.Background(), getUserIdFromToken(suite.userTokens[1]))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(0), otherBalance)
+
+	// payments to offers that were not created by us are not credited
+	_, err = suite.mlnd.mockPaidOffer("unknown", 1000)
+	assert.NoError(suite.T(), err)
+	time.Sleep(100 * time.Millisecond)
+	balance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1500), balance)
+}
+
+func (suite *OfferTestSuite) TestOfferScope() {
+	// an offer receives payments, so it needs the same scope as creating an invoice
+	for _, tc := range []struct {
+		scope  string
+		status int
+	}{
+		{common.ScopeRead, http.StatusForbidden},
+		{common.ScopeInvoice, http.StatusOK},
+	} {
+		user := &models.User{ID: getUserIdFromToken(suite.userTokens[0])}
+		token, _, err := tokens.GenerateAccessToken([]byte(suite.service.Config.JWTSecret), 3600, user, []string{tc.scope})
+		assert.NoError(suite.T(), err)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v2/offers", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		suite.echo.ServeHTTP(rec, req)
+		assert.Equal(suite.T(), tc.status, rec.Code, tc.scope)
+	}
+}
+
+func (suite *OfferTestSuite) TestPayOffer() {
+	token := suite.userTokens[1]
+	userId := getUserIdFromToken(token)
+	rHash, err := suite.mlnd.mockPaidOffer(suite.getOffer(token).OfferID, 1000)
+	assert.NoError(suite.T(), err)
+	time.Sleep(100 * time.Millisecond)
+	_, err = suite.service.FindInvoiceByPaymentHash(context.Background(), userId, rHash)
+	assert.NoError(suite.T(), err)
+
+	// the offer has no amount, so an amount is required
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt12", bytes.NewBufferString(`{"offer":"lno1issuer"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/v2/payments/bolt12", bytes.NewBufferString(`{"offer":"lno1issuer","amount":100}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	payment := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payment))
+	assert.Equal(suite.T(), "lni1mock", payment.PaymentRequest)
+	assert.Equal(suite.T(), int64(100), payment.RequestedAmount)
+	assert.Equal(suite.T(), mockOfferIssuerPubkey, payment.Destination)
+
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000-100-payment.Fee), balance)
+	invoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), invoices, 1)
+	assert.Equal(suite.T(), "lno1issuer", invoices[0].Offer)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, invoices[0].State)
+}
+
+func TestOfferTestSuite(t *testing.T) {
+	suite.Run(t, new(OfferTestSuite))
+}
@@ -0,0 +1,211 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OnchainDepositTestSuite struct {
+	TestSuite
+	service    *service.LndhubService
+	mlnd       *MockLND
+	userIds    []int64
+	userTokens []string
+}
+
+func (suite *OnchainDepositTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.EnableOnchainDeposits = true
+	svc.Config.OnchainMinConfirmations = 2
+	svc.Config.OnchainDepositFee = 100
+	svc.Config.OnchainDepositCheckInterval = 1
+	users, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	for _, login := range users {
+		user, err := svc.FindUserByLogin(context.Background(), login.Login)
+		if err != nil {
+			log.Fatalf("Error finding test user: %v", err)
+		}
+		suite.userIds = append(suite.userIds, user.ID)
+	}
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.GET("/v2/onchain/address", v2controllers.NewOnchainController(svc).Address, tokens.Middleware([]byte(suite.service.Config.JWTSecret)), tokens.RequireScope(common.ScopeInvoice))
+}
+
+func (suite *OnchainDepositTestSuite) TearDownSuite() {
+	clearTable(suite.service, "onchain_deposits")
+	clearTable(suite.service, "onchain_addresses")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *OnchainDepositTestSuite) getAddress(token string) string {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/onchain/address", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.OnchainAddressResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), int32(2), response.MinConfirmations)
+	assert.Equal(suite.T(), int64(100), response.DepositFee)
+	assert.NotEmpty(suite.T(), response.Address)
+	return response.Address
+}
+
+func depositTransaction(txHash string, confirmations, blockHeight int32, outputs ...*lnrpc.OutputDetail) *lnrpc.Transaction {
+	return &lnrpc.Transaction{
+		TxHash:           txHash,
+		NumConfirmations: confirmations,
+		BlockHeight:      blockHeight,
+		OutputDetails:    outputs,
+	}
+}
+
+func depositOutput(address string, index, amount int64) *lnrpc.OutputDetail {
+	return &lnrpc.OutputDetail{
+		Address:      address,
+		OutputIndex:  index,
+		Amount:       amount,
+		IsOurAddress: true,
+	}
+}
+
+func (suite *OnchainDepositTestSuite) TestDepositAddress() {
+	token := suite.userTokens[1]
+	address := suite.getAddress(token)
+	// the address is handed out until it receives a deposit
+	assert.Equal(suite.T(), address, suite.getAddress(token))
+	// addresses are not shared between users
+	assert.NotEqual(suite.T(), address, suite.getAddress(suite.userTokens[0]))
+
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(context.Background(), depositTransaction("addresstx", 0, 0, depositOutput(address, 0, 5000))))
+	newAddress := suite.getAddress(token)
+	assert.NotEqual(suite.T(), address, newAddress)
+}
+
+func (suite *OnchainDepositTestSuite) TestDepositAddressScope() {
+	// handing out an address needs the same scope as creating an invoice
+	for _, tc := range []struct {
+		scope  string
+		status int
+	}{
+		{common.ScopeRead, http.StatusForbidden},
+		{common.ScopeInvoice, http.StatusOK},
+	} {
+		token, _, err := tokens.GenerateAccessToken([]byte(suite.service.Config.JWTSecret), 3600, &models.User{ID: suite.userIds[0]}, []string{tc.scope})
+		assert.NoError(suite.T(), err)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v2/onchain/address", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		suite.echo.ServeHTTP(rec, req)
+		assert.Equal(suite.T(), tc.status, rec.Code, tc.scope)
+	}
+}
+
+func (suite *OnchainDepositTestSuite) TestCreditDeposit() {
+	ctx := context.Background()
+	userId := suite.userIds[0]
+	address := suite.getAddress(suite.userTokens[0])
+	startBalance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+
+	// unconfirmed and not enough confirmations
+	tx := depositTransaction("deposittx", 0, 0, depositOutput(address, 1, 10000), depositOutput("bcrt1qchange", 0, 500))
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(ctx, tx))
+	tx = depositTransaction("deposittx", 1, 100, depositOutput(address, 1, 10000), depositOutput("bcrt1qchange", 0, 500))
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(ctx, tx))
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance, balance)
+
+	// credited minus the deposit fee once it has enough confirmations, only once
+	tx = depositTransaction("deposittx", 2, 100, depositOutput(address, 1, 10000), depositOutput("bcrt1qchange", 0, 500))
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(ctx, tx))
+	tx.NumConfirmations = 3
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(ctx, tx))
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance+9900, balance)
+
+	deposit := &models.OnchainDeposit{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(deposit).Where("tx_hash = ?", "deposittx").Scan(ctx))
+	assert.Equal(suite.T(), models.OnchainDepositStateCredited, deposit.State)
+	assert.Equal(suite.T(), int64(100), deposit.Fee)
+	assert.NotZero(suite.T(), deposit.InvoiceID)
+
+	// a reused address is credited for every deposit, amounts below the fee are not credited
+	tx = depositTransaction("reusetx", 2, 101, depositOutput(address, 0, 3000), depositOutput(address, 1, 50))
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(ctx, tx))
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance+9900+2900, balance)
+	dust := &models.OnchainDeposit{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(dust).Where("tx_hash = ? AND output_index = ?", "reusetx", 1).Scan(ctx))
+	assert.Equal(suite.T(), models.OnchainDepositStateBelowFee, dust.State)
+	suite.assertLedgerMatchesInvoices(suite.service, userId)
+}
+
+func (suite *OnchainDepositTestSuite) TestDepositRoutine() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	userId := suite.userIds[1]
+	address := suite.getAddress(suite.userTokens[1])
+	startBalance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	go suite.service.StartOnchainDepositRoutine(ctx)
+
+	// the first confirmation is received from the subscription, the second one is looked up
+	suite.mlnd.mockOnchainTransaction(depositTransaction("routinetx", 1, 200, depositOutput(address, 0, 20000)))
+	time.Sleep(100 * time.Millisecond)
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance, balance)
+
+	// only GetTransactions returns the second confirmation
+	suite.mlnd.transactionsMu.Lock()
+	suite.mlnd.transactions[len(suite.mlnd.transactions)-1] = depositTransaction("routinetx", 2, 200, depositOutput(address, 0, 20000))
+	suite.mlnd.transactionsMu.Unlock()
+	time.Sleep(1500 * time.Millisecond)
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance+19900, balance)
+}
+
+func TestOnchainDepositTestSuite(t *testing.T) {
+	suite.Run(t, new(OnchainDepositTestSuite))
+}
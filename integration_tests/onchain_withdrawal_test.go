@@ -0,0 +1,191 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const withdrawalAddress = "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"
+
+type OnchainWithdrawalTestSuite struct {
+	TestSuite
+	service   *service.LndhubService
+	mlnd      *MockLND
+	userId    int64
+	userToken string
+}
+
+func (suite *OnchainWithdrawalTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.EnableOnchainWithdrawals = true
+	svc.Config.MaxOnchainWithdrawal = 50000
+	svc.Config.OnchainWithdrawalTargetConf = 6
+	svc.Config.OnchainMinConfirmations = 1
+	svc.Config.OnchainDepositFee = 0
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	user, err := svc.FindUserByLogin(context.Background(), users[0].Login)
+	if err != nil {
+		log.Fatalf("Error finding test user: %v", err)
+	}
+	suite.service = svc
+	suite.userId = user.ID
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/v2/onchain/withdraw", v2controllers.NewOnchainController(svc).Withdraw, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *OnchainWithdrawalTestSuite) TearDownSuite() {
+	clearTable(suite.service, "onchain_withdrawals")
+	clearTable(suite.service, "onchain_deposits")
+	clearTable(suite.service, "onchain_addresses")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *OnchainWithdrawalTestSuite) SetupTest() {
+	suite.mlnd.SendCoinsError = nil
+	// fund the user with an on-chain deposit
+	ctx := context.Background()
+	address, err := suite.service.OnchainAddress(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	txHash := fmt.Sprintf("fundingtx-%s", suite.T().Name())
+	assert.NoError(suite.T(), suite.service.ProcessOnchainTransaction(ctx, depositTransaction(txHash, 1, 100, depositOutput(address.Address, 0, 10000))))
+}
+
+func (suite *OnchainWithdrawalTestSuite) withdraw(body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/onchain/withdraw", bytes.NewBufferString(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *OnchainWithdrawalTestSuite) TestWithdraw() {
+	ctx := context.Background()
+	startBalance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+
+	rec := suite.withdraw(fmt.Sprintf(`{"address":"%s","amount":5000}`, withdrawalAddress))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.OnchainWithdrawResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.NotEmpty(suite.T(), response.Txid)
+	assert.Equal(suite.T(), int64(5000), response.Amount)
+	// the estimated rate of the mock
+	assert.Equal(suite.T(), uint64(10), response.SatPerVbyte)
+	assert.Equal(suite.T(), int64(10*mockOnchainTxVbytes), response.Fee)
+	assert.Equal(suite.T(), withdrawalAddress, suite.mlnd.LastSendCoinsRequest.Addr)
+	assert.Equal(suite.T(), int64(5000), suite.mlnd.LastSendCoinsRequest.Amount)
+
+	balance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance-5000-response.Fee, balance)
+
+	withdrawal := &models.OnchainWithdrawal{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(withdrawal).Where("tx_hash = ?", response.Txid).Scan(ctx))
+	assert.Equal(suite.T(), suite.userId, withdrawal.UserID)
+	assert.Equal(suite.T(), response.Fee, withdrawal.Fee)
+	invoice := &models.Invoice{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(invoice).Where("id = ?", withdrawal.InvoiceID).Scan(ctx))
+	assert.Equal(suite.T(), common.InvoiceTypeOutgoing, invoice.Type)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, invoice.State)
+	assert.Equal(suite.T(), response.Fee, invoice.Fee)
+	entry := &models.TransactionEntry{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(entry).Where("invoice_id = ? AND entry_type = ?", invoice.ID, models.EntryTypeOutgoing).Scan(ctx))
+	assert.Equal(suite.T(), response.Txid, entry.Reference)
+	suite.assertLedgerMatchesInvoices(suite.service, suite.userId)
+}
+
+func (suite *OnchainWithdrawalTestSuite) TestWithdrawFeeRate() {
+	ctx := context.Background()
+	startBalance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+
+	rec := suite.withdraw(fmt.Sprintf(`{"address":"%s","amount":2000,"sat_per_vbyte":2}`, withdrawalAddress))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.OnchainWithdrawResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.Equal(suite.T(), uint64(2), suite.mlnd.LastSendCoinsRequest.SatPerVbyte)
+	assert.Equal(suite.T(), int64(2*mockOnchainTxVbytes), response.Fee)
+	balance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance-2000-response.Fee, balance)
+}
+
+func (suite *OnchainWithdrawalTestSuite) TestWithdrawRejected() {
+	ctx := context.Background()
+	startBalance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+
+	// the fee is not covered by the balance
+	rec := suite.withdraw(fmt.Sprintf(`{"address":"%s","amount":%d}`, withdrawalAddress, startBalance))
+	assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, checkErrResponse(&suite.TestSuite, rec).Message)
+	rec = suite.withdraw(fmt.Sprintf(`{"address":"%s","amount":50001}`, withdrawalAddress))
+	assert.Equal(suite.T(), responses.OnchainWithdrawalExceededError.Message, checkErrResponse(&suite.TestSuite, rec).Message)
+
+	balance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance, balance)
+}
+
+func (suite *OnchainWithdrawalTestSuite) TestWithdrawFailed() {
+	ctx := context.Background()
+	startBalance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	suite.mlnd.SendCoinsError = errors.New("insufficient funds available to construct transaction")
+
+	rec := suite.withdraw(fmt.Sprintf(`{"address":"%s","amount":3000}`, withdrawalAddress))
+	assert.Equal(suite.T(), http.StatusInternalServerError, rec.Code)
+	// the node's error is not returned to the user
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.GeneralServerError.Code, errorResponse.Code)
+	assert.Equal(suite.T(), responses.GeneralServerError.Message, errorResponse.Message)
+
+	// the amount and the fee reserve are credited back
+	balance, err := suite.service.CurrentUserBalance(ctx, suite.userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), startBalance, balance)
+	invoices, err := invoicesFor(suite.service, suite.userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateError, invoices[0].State)
+	suite.assertLedgerMatchesInvoices(suite.service, suite.userId)
+}
+
+func TestOnchainWithdrawalTestSuite(t *testing.T) {
+	suite.Run(t, new(OnchainWithdrawalTestSuite))
+}
@@ -0,0 +1,131 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OutboundLiquidityTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *OutboundLiquidityTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.EnforceOutboundLiquidity = true
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *OutboundLiquidityTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *OutboundLiquidityTestSuite) TestInsufficientNodeLiquidity() {
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test outbound liquidity", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+	userId := getUserIdFromToken(suite.userToken)
+
+	// the user can afford the payment, the node can't send it
+	suite.mlnd.ChannelBalanceSat = 200
+	rec := suite.payInvoice(suite.externalInvoice(500, "preimage1"))
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.InsufficientNodeLiquidityError.Code, errorResponse.Code)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(outgoingInvoices))
+
+	suite.mlnd.ChannelBalanceSat = 10000
+	rec = suite.payInvoice(suite.externalInvoice(500, "preimage2"))
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	balance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(500), balance)
+}
+
+func (suite *OutboundLiquidityTestSuite) externalInvoice(amount int64, preimage string) string {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: outbound liquidity",
+		Value:     amount,
+		RPreimage: []byte(preimage),
+	})
+	assert.NoError(suite.T(), err)
+	return invoice.PaymentRequest
+}
+
+func (suite *OutboundLiquidityTestSuite) payInvoice(paymentRequest string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.PayInvoiceRequestBody{Invoice: paymentRequest}))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOutboundLiquidityTestSuite(t *testing.T) {
+	suite.Run(t, new(OutboundLiquidityTestSuite))
+}
@@ -95,6 +95,7 @@ func (suite *PaymentTestSuite) TestOutGoingPayment() {
 	assert.Equal(suite.T(), http.StatusOK, rec.Code)
 	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(&responseBody))
 	assert.Equal(suite.T(), int64(suite.mlnd.fee), (*responseBody)[0].Fee)
+	suite.assertLedgerMatchesInvoices(suite.service, userId)
 }
 
 func (suite *PaymentTestSuite) TestOutGoingPaymentWithNegativeBalance() {
@@ -0,0 +1,164 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/uptrace/bun"
+)
+
+type PayTransactionTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *PayTransactionTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *PayTransactionTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *PayTransactionTestSuite) TestNotEnoughBalanceAbortsPayment() {
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test pay transaction", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+	userId := getUserIdFromToken(suite.userToken)
+
+	rec := suite.payInvoice(suite.externalInvoice(2000, "preimage1"))
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, errorResponse.Message)
+
+	// the invoice is kept for the audit trail, nothing was debited
+	ctx := context.Background()
+	invoices := []models.Invoice{}
+	err = suite.service.DB.NewSelect().Model(&invoices).
+		Where("user_id = ? AND type = ?", userId, common.InvoiceTypeOutgoing).Scan(ctx)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(invoices))
+	assert.Equal(suite.T(), common.InvoiceStateAborted, invoices[0].State)
+	assert.Equal(suite.T(), service.ErrNotEnoughBalance.Error(), invoices[0].ErrorMessage)
+	entryCount, err := suite.service.DB.NewSelect().Model((*models.TransactionEntry)(nil)).
+		Where("user_id = ? AND entry_type = ?", userId, models.EntryTypeOutgoing).Count(ctx)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, entryCount)
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+
+	// aborted payments are left out of the history unless asked for
+	transactions, _, err := suite.service.GetTransactionsPaged(ctx, userId, service.TransactionsFilter{Type: common.InvoiceTypeOutgoing}, 10, 0)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(transactions))
+	transactions, _, err = suite.service.GetTransactionsPaged(ctx, userId, service.TransactionsFilter{Type: common.InvoiceTypeOutgoing, IncludeAborted: true}, 10, 0)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(transactions))
+	outgoingInvoices, err := suite.service.InvoicesFor(ctx, userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(outgoingInvoices))
+}
+
+func (suite *PayTransactionTestSuite) TestWithTxRollsBack() {
+	ctx := context.Background()
+	userId := getUserIdFromToken(suite.userToken)
+	memo := "integration test rolled back"
+	failure := errors.New("failed after the insert")
+	err := suite.service.WithTx(ctx, func(tx bun.Tx) error {
+		invoice := &models.Invoice{Type: common.InvoiceTypeOutgoing, UserID: userId, Memo: memo, State: common.InvoiceStateInitialized}
+		if _, err := tx.NewInsert().Model(invoice).Exec(ctx); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.ErrorIs(suite.T(), err, failure)
+	count, err := suite.service.DB.NewSelect().Model((*models.Invoice)(nil)).Where("user_id = ? AND memo = ?", userId, memo).Count(ctx)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+}
+
+func (suite *PayTransactionTestSuite) externalInvoice(amount int64, preimage string) string {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: pay transaction",
+		Value:     amount,
+		RPreimage: []byte(preimage),
+	})
+	assert.NoError(suite.T(), err)
+	return invoice.PaymentRequest
+}
+
+func (suite *PayTransactionTestSuite) payInvoice(paymentRequest string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.PayInvoiceRequestBody{Invoice: paymentRequest}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPayTransactionTestSuite(t *testing.T) {
+	suite.Run(t, new(PayTransactionTestSuite))
+}
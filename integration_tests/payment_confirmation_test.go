@@ -0,0 +1,253 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PaymentConfirmationTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *PaymentConfirmationTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.ConfirmationThresholdSats = 500
+	svc.Config.ConfirmationTimeout = 120
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	payInvoiceCtrl := v2controllers.NewPayInvoiceController(suite.service)
+	suite.echo.POST("/v2/payments/bolt11", payInvoiceCtrl.PayInvoice)
+	suite.echo.POST("/v2/payments/confirm", payInvoiceCtrl.ConfirmPayment)
+	suite.echo.POST("/v2/payments/keysend", v2controllers.NewKeySendController(suite.service).KeySend)
+}
+
+func (suite *PaymentConfirmationTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "payment_confirmations")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *PaymentConfirmationTestSuite) TestConfirmedPayment() {
+	suite.fundUser(2000)
+	userId := getUserIdFromToken(suite.userToken)
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+
+	// below the threshold the payment is sent right away
+	rec := suite.postJSON("/v2/payments/bolt11", &v2controllers.PayInvoiceRequestBody{Invoice: suite.externalInvoice(500, "preimage1")})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	paymentRequest := suite.externalInvoice(600, "preimage2")
+	rec = suite.postJSON("/v2/payments/bolt11", &v2controllers.PayInvoiceRequestBody{Invoice: paymentRequest, Label: "rent"})
+	assert.Equal(suite.T(), http.StatusAccepted, rec.Code)
+	confirmationResponse := &v2controllers.PaymentConfirmationResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(confirmationResponse))
+	assert.NotEmpty(suite.T(), confirmationResponse.ConfirmationToken)
+	assert.Equal(suite.T(), int64(600), confirmationResponse.Amount)
+	assert.Equal(suite.T(), paymentRequest, confirmationResponse.PaymentRequest)
+	assert.True(suite.T(), confirmationResponse.ExpiresAt.After(time.Now()))
+
+	// nothing is debited before the confirmation
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore-500, balance)
+
+	rec = suite.postJSON("/v2/payments/confirm", &v2controllers.ConfirmPaymentRequestBody{ConfirmationToken: confirmationResponse.ConfirmationToken})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	payResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payResponse))
+	assert.Equal(suite.T(), int64(600), payResponse.Amount)
+	assert.Equal(suite.T(), "rent", payResponse.Label)
+	balance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore-1100, balance)
+
+	// the token can only be used once
+	rec = suite.postJSON("/v2/payments/confirm", &v2controllers.ConfirmPaymentRequestBody{ConfirmationToken: confirmationResponse.ConfirmationToken})
+	suite.assertErrorResponse(rec, responses.PaymentConfirmationNotFoundError)
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, len(outgoingInvoices))
+}
+
+func (suite *PaymentConfirmationTestSuite) TestConfirmationReservesBalance() {
+	suite.fundUser(1000)
+	userId := getUserIdFromToken(suite.userToken)
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+
+	rec := suite.postJSON("/v2/payments/bolt11", &v2controllers.PayInvoiceRequestBody{Invoice: suite.externalInvoice(700, "preimage4")})
+	assert.Equal(suite.T(), http.StatusAccepted, rec.Code)
+	confirmationResponse := &v2controllers.PaymentConfirmationResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(confirmationResponse))
+	assert.GreaterOrEqual(suite.T(), confirmationResponse.ReservedAmount, int64(700))
+
+	// the reserved balance can't be spent by other payments or confirmations
+	available := balanceBefore - confirmationResponse.ReservedAmount
+	rec = suite.postJSON("/v2/payments/bolt11", &v2controllers.PayInvoiceRequestBody{Invoice: suite.externalInvoice(available+1, "preimage5")})
+	suite.assertErrorResponse(rec, responses.NotEnoughBalanceError)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore, balance)
+
+	rec = suite.postJSON("/v2/payments/confirm", &v2controllers.ConfirmPaymentRequestBody{ConfirmationToken: confirmationResponse.ConfirmationToken})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	balance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore-700, balance)
+}
+
+func (suite *PaymentConfirmationTestSuite) TestConfirmedKeysend() {
+	suite.fundUser(1000)
+	userId := getUserIdFromToken(suite.userToken)
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+
+	rec := suite.postJSON("/v2/payments/keysend", &v2controllers.KeySendRequestBody{
+		Amount:      600,
+		Destination: suite.externalLND.GetMainPubkey(),
+		Memo:        "integration test confirmed keysend",
+	})
+	assert.Equal(suite.T(), http.StatusAccepted, rec.Code)
+	confirmationResponse := &v2controllers.PaymentConfirmationResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(confirmationResponse))
+	assert.Equal(suite.T(), common.PaymentConfirmationTypeKeysend, confirmationResponse.PaymentType)
+	assert.Equal(suite.T(), int64(600), confirmationResponse.Amount)
+	assert.Equal(suite.T(), suite.externalLND.GetMainPubkey(), confirmationResponse.Destination)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore, balance)
+
+	rec = suite.postJSON("/v2/payments/confirm", &v2controllers.ConfirmPaymentRequestBody{ConfirmationToken: confirmationResponse.ConfirmationToken})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	keysendResponse := &v2controllers.KeySendResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(keysendResponse))
+	assert.Equal(suite.T(), suite.externalLND.GetMainPubkey(), keysendResponse.Destination)
+	assert.NotEmpty(suite.T(), keysendResponse.PaymentPreimage)
+	balance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore-600, balance)
+}
+
+func (suite *PaymentConfirmationTestSuite) TestExpiredConfirmation() {
+	suite.fundUser(1000)
+	userId := getUserIdFromToken(suite.userToken)
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+
+	rec := suite.postJSON("/v2/payments/bolt11", &v2controllers.PayInvoiceRequestBody{Invoice: suite.externalInvoice(700, "preimage3")})
+	assert.Equal(suite.T(), http.StatusAccepted, rec.Code)
+	confirmationResponse := &v2controllers.PaymentConfirmationResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(confirmationResponse))
+
+	_, err = suite.service.DB.NewUpdate().
+		Model((*models.PaymentConfirmation)(nil)).
+		Set("expires_at = ?", time.Now().Add(-time.Second)).
+		Where("token = ?", confirmationResponse.ConfirmationToken).
+		Exec(context.Background())
+	assert.NoError(suite.T(), err)
+
+	rec = suite.postJSON("/v2/payments/confirm", &v2controllers.ConfirmPaymentRequestBody{ConfirmationToken: confirmationResponse.ConfirmationToken})
+	suite.assertErrorResponse(rec, responses.PaymentConfirmationExpiredError)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore, balance)
+
+	// unknown tokens are rejected
+	rec = suite.postJSON("/v2/payments/confirm", &v2controllers.ConfirmPaymentRequestBody{ConfirmationToken: "unknown"})
+	suite.assertErrorResponse(rec, responses.PaymentConfirmationNotFoundError)
+}
+
+func (suite *PaymentConfirmationTestSuite) fundUser(amount int) {
+	invoiceResponse := suite.createAddInvoiceReq(amount, "integration test payment confirmation", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+}
+
+func (suite *PaymentConfirmationTestSuite) externalInvoice(amount int64, preimage string) string {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: payment confirmation",
+		Value:     amount,
+		RPreimage: []byte(preimage),
+	})
+	assert.NoError(suite.T(), err)
+	return invoice.PaymentRequest
+}
+
+func (suite *PaymentConfirmationTestSuite) postJSON(path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *PaymentConfirmationTestSuite) assertErrorResponse(rec *httptest.ResponseRecorder, expected responses.ErrorResponse) {
+	assert.Equal(suite.T(), expected.HttpStatusCode, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), expected.Message, errorResponse.Message)
+}
+
+func TestPaymentConfirmationTestSuite(t *testing.T) {
+	suite.Run(t, new(PaymentConfirmationTestSuite))
+}
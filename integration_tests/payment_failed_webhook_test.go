@@ -0,0 +1,136 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PaymentFailedWebhookTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	userToken                string
+	webhookServer            *httptest.Server
+	events                   chan service.UserWebhookEvent
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *PaymentFailedWebhookTestSuite) SetupSuite() {
+	suite.events = make(chan service.UserWebhookEvent, 10)
+	suite.webhookServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := service.UserWebhookEvent{}
+		err := json.NewDecoder(r.Body).Decode(&event)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		suite.events <- event
+	}))
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice)))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	// inject fake lnd client with failing send payment sync into service
+	lndClient, err := NewLNDMockWrapper(mlnd)
+	if err != nil {
+		log.Fatalf("Error setting up test client: %v", err)
+	}
+	suite.mlnd = mlnd
+	suite.externalLND = externalLND
+	svc, err := LndHubTestServiceInit(lndClient)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	// the webhook server is on a private address
+	svc.Config.OutboundAllowedHosts = []string{"127.0.0.1"}
+	svc.OutboundClient, err = service.NewOutboundClient(svc.Config)
+	if err != nil {
+		log.Fatalf("Error initializing outbound client: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	_, err = svc.CreateUserWebhook(context.Background(), getUserIdFromToken(userTokens[0]), suite.webhookServer.URL, []string{common.WebhookEventPaymentFailed})
+	if err != nil {
+		log.Fatalf("Error creating test webhook: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *PaymentFailedWebhookTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	suite.webhookServer.Close()
+	clearTable(suite.service, "webhooks")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *PaymentFailedWebhookTestSuite) TestPaymentFailedWebhook() {
+	//fund user account
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test payment failed webhook", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	//wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	externalInvoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: payment failed webhook",
+		Value: 500,
+	})
+	assert.NoError(suite.T(), err)
+	//pay external from user, mock will fail immediately
+	_ = suite.createPayInvoiceReqError(externalInvoice.PaymentRequest, suite.userToken)
+
+	select {
+	case event := <-suite.events:
+		assert.Equal(suite.T(), common.WebhookEventPaymentFailed, event.Event)
+		assert.NotZero(suite.T(), event.Data.ID)
+		assert.Equal(suite.T(), common.InvoiceTypeOutgoing, event.Data.Type)
+		assert.Equal(suite.T(), int64(500), event.Data.Amount)
+		assert.Equal(suite.T(), suite.externalLND.GetMainPubkey(), event.Data.DestinationPubkeyHex)
+		assert.Equal(suite.T(), SendPaymentMockError, event.Data.ErrorMessage)
+	case <-time.After(5 * time.Second):
+		suite.T().Fatal("payment failed webhook was not delivered")
+	}
+}
+
+func TestPaymentFailedWebhookTestSuite(t *testing.T) {
+	suite.Run(t, new(PaymentFailedWebhookTestSuite))
+}
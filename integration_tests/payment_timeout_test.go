@@ -0,0 +1,254 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PaymentTimeoutTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	timeoutLND               *LNDMockTimeoutWrapperAsync
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *PaymentTimeoutTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+	// inject lnd client that only returns when the payment context is done
+	lndClient, err := NewLNDMockTimeoutWrapperAsync(mlnd)
+	if err != nil {
+		log.Fatalf("Error setting up test client: %v", err)
+	}
+	suite.timeoutLND = lndClient
+
+	svc, err := LndHubTestServiceInit(lndClient)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	assert.Equal(suite.T(), 1, len(users))
+	assert.Equal(suite.T(), 1, len(userTokens))
+	suite.userToken = userTokens[0]
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+	suite.echo.GET("/v2/payments/pending", v2controllers.NewPendingPaymentsController(suite.service).PendingPayments)
+	suite.echo.GET("/v2/payments/outgoing", v2controllers.NewPendingPaymentsController(suite.service).OutgoingPayments)
+}
+
+func (suite *PaymentTimeoutTestSuite) TestPaymentTimeout() {
+	userFundingSats := int64(1000)
+	externalSatRequested := int64(500)
+	// fund user account
+	invoiceResponse := suite.createAddInvoiceReq(int(userFundingSats), "integration test payment timeout", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	// create external invoice
+	externalInvoice := lnrpc.Invoice{
+		Memo:      "integration tests: payment timeout",
+		Value:     externalSatRequested,
+		RPreimage: []byte("preimage1"),
+	}
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &externalInvoice)
+	assert.NoError(suite.T(), err)
+
+	// pay external from user, the payment will time out after 1 second
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.PayInvoiceRequestBody{
+		Invoice:        invoice.PaymentRequest,
+		TimeoutSeconds: 1,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusGatewayTimeout, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.PaymentTimeoutError.Message, errorResponse.Message)
+
+	// the payment is pending and the amount and the fee reserve are still on hold
+	userId := getUserIdFromToken(suite.userToken)
+	inv, err := suite.service.FindInvoiceByPaymentHash(context.Background(), userId, hex.EncodeToString(invoice.RHash))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStatePending, inv.State)
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	feeReserve := suite.service.CalcFeeLimit(suite.externalLND.GetMainPubkey(), externalSatRequested)
+	assert.Equal(suite.T(), userFundingSats-externalSatRequested-feeReserve, userBalance)
+
+	// the payment tracker settles the payment once it succeeds
+	suite.timeoutLND.SettlePayment(lnrpc.Payment{
+		PaymentHash:     hex.EncodeToString(invoice.RHash),
+		Value:           externalInvoice.Value,
+		PaymentPreimage: "preimage1",
+		ValueSat:        externalInvoice.Value,
+		PaymentRequest:  invoice.PaymentRequest,
+		Status:          lnrpc.Payment_SUCCEEDED,
+	})
+	// wait a bit for db update to happen
+	time.Sleep(time.Second)
+
+	inv, err = suite.service.FindInvoiceByPaymentHash(context.Background(), userId, hex.EncodeToString(invoice.RHash))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, inv.State)
+	userBalance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), userFundingSats-externalSatRequested, userBalance)
+}
+
+func (suite *PaymentTimeoutTestSuite) TestPendingPaymentFailed() {
+	userId := getUserIdFromToken(suite.userToken)
+	// fund user account
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test pending payment failed", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	balanceBefore, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	externalInvoice := lnrpc.Invoice{
+		Memo:      "integration tests: pending payment failed",
+		Value:     300,
+		RPreimage: []byte("preimage2"),
+	}
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &externalInvoice)
+	assert.NoError(suite.T(), err)
+
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.PayInvoiceRequestBody{
+		Invoice:        invoice.PaymentRequest,
+		TimeoutSeconds: 1,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(suite.T(), 1, suite.pendingPaymentsCount())
+	pending := suite.outgoingPayments("pending")
+	assert.Equal(suite.T(), 1, len(pending.Payments))
+	assert.Equal(suite.T(), hex.EncodeToString(invoice.RHash), pending.Payments[0].PaymentHash)
+	assert.Equal(suite.T(), suite.externalLND.GetMainPubkey(), pending.Payments[0].Destination)
+	assert.Equal(suite.T(), int64(300), pending.Payments[0].Amount)
+
+	// the payment is already tracked, the reconciliation does not spawn a second tracker
+	assert.NoError(suite.T(), suite.service.ReconcilePendingPayments(context.Background()))
+
+	suite.timeoutLND.SettlePayment(lnrpc.Payment{
+		PaymentHash:    hex.EncodeToString(invoice.RHash),
+		Value:          externalInvoice.Value,
+		ValueSat:       externalInvoice.Value,
+		PaymentRequest: invoice.PaymentRequest,
+		Status:         lnrpc.Payment_FAILED,
+		FailureReason:  lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE,
+	})
+	// wait a bit for db update to happen
+	time.Sleep(time.Second)
+
+	inv, err := suite.service.FindInvoiceByPaymentHash(context.Background(), userId, hex.EncodeToString(invoice.RHash))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceStateError, inv.State)
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore, userBalance)
+	assert.Equal(suite.T(), 0, suite.pendingPaymentsCount())
+	assert.Empty(suite.T(), suite.outgoingPayments("pending").Payments)
+	failed := suite.outgoingPayments("failed")
+	assert.Equal(suite.T(), hex.EncodeToString(invoice.RHash), failed.Payments[0].PaymentHash)
+	assert.Equal(suite.T(), v2controllers.InvoiceStateFailed, failed.Payments[0].State)
+
+	// a failed payment is only refunded once
+	entry, err := suite.service.GetTransactionEntryByInvoiceId(context.Background(), inv.ID)
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), suite.service.HandleFailedPayment(context.Background(), inv, entry, fmt.Errorf("failed again")))
+	userBalance, err = suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balanceBefore, userBalance)
+}
+
+func (suite *PaymentTimeoutTestSuite) pendingPaymentsCount() int {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/payments/pending", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	pendingResponse := &v2controllers.PendingPaymentsResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(pendingResponse))
+	return pendingResponse.Count
+}
+
+func (suite *PaymentTimeoutTestSuite) outgoingPayments(state string) *v2controllers.OutgoingPaymentsResponseBody {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/payments/outgoing?state="+state, nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.OutgoingPaymentsResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	return response
+}
+
+func (suite *PaymentTimeoutTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func TestPaymentTimeoutTestSuite(t *testing.T) {
+	suite.Run(t, new(PaymentTimeoutTestSuite))
+}
@@ -0,0 +1,123 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PendingInvoiceLimitTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *PendingInvoiceLimitTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.MaxPendingInvoicesPerUser = 3
+	_, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+}
+
+func (suite *PendingInvoiceLimitTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *PendingInvoiceLimitTestSuite) addInvoice(token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedAddInvoiceRequestBody{
+		Amount: 100,
+		Memo:   "integration test pending invoice limit",
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/addinvoice", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *PendingInvoiceLimitTestSuite) TestPendingInvoiceLimit() {
+	token := suite.userTokens[0]
+	userId := getUserIdFromToken(token)
+	var invoices []*ExpectedAddInvoiceResponseBody
+	for i := 0; i < suite.service.Config.MaxPendingInvoicesPerUser; i++ {
+		rec := suite.addInvoice(token)
+		assert.Equal(suite.T(), http.StatusOK, rec.Code)
+		invoice := &ExpectedAddInvoiceResponseBody{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoice))
+		invoices = append(invoices, invoice)
+	}
+	count, err := suite.service.PendingInvoiceCount(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, count)
+
+	// the next invoice is rejected at the limit
+	rec := suite.addInvoice(token)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.TooManyPendingInvoicesError.Message, errorResponse.Message)
+
+	// the limit is per user
+	assert.Equal(suite.T(), http.StatusOK, suite.addInvoice(suite.userTokens[1]).Code)
+
+	// paid invoices are not pending anymore
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoices[0], 0, false, nil))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(suite.T(), http.StatusOK, suite.addInvoice(token).Code)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, suite.addInvoice(token).Code)
+
+	// neither are expired ones
+	_, err = suite.service.DB.NewUpdate().Model((*models.Invoice)(nil)).Set("expires_at = ?", time.Now().Add(-time.Minute)).Where("r_hash = ?", invoices[1].RHash).Exec(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.addInvoice(token).Code)
+}
+
+func TestPendingInvoiceLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(PendingInvoiceLimitTestSuite))
+}
@@ -0,0 +1,103 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+)
+
+type PrivateHintsTestSuite struct {
+	TestSuite
+	service    *service.LndhubService
+	mlnd       *recordingAddInvoiceLND
+	userTokens []string
+}
+
+// recordingAddInvoiceLND keeps the last invoice request
+type recordingAddInvoiceLND struct {
+	*MockLND
+	lastInvoice *lnrpc.Invoice
+}
+
+func (mlnd *recordingAddInvoiceLND) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	mlnd.lastInvoice = req
+	return mlnd.MockLND.AddInvoice(ctx, req, options...)
+}
+
+func (suite *PrivateHintsTestSuite) SetupSuite() {
+	mlnd := &recordingAddInvoiceLND{MockLND: newDefaultMockLND()}
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/v2/invoices", v2controllers.NewInvoiceController(svc).AddInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *PrivateHintsTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *PrivateHintsTestSuite) TestIncludePrivateHints() {
+	disabled := false
+	enabled := true
+	for _, tt := range []struct {
+		includePrivateHints *bool
+		expected            bool
+	}{
+		{nil, true},
+		{&enabled, true},
+		{&disabled, false},
+	} {
+		var buf bytes.Buffer
+		assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.AddInvoiceRequestBody{
+			Amount:              100,
+			Description:         "integration test private hints",
+			IncludePrivateHints: tt.includePrivateHints,
+		}))
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v2/invoices", &buf)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userTokens[0]))
+		suite.mlnd.lastInvoice = nil
+		suite.echo.ServeHTTP(rec, req)
+		assert.Equal(suite.T(), http.StatusOK, rec.Code)
+		if assert.NotNil(suite.T(), suite.mlnd.lastInvoice) {
+			assert.Equal(suite.T(), tt.expected, suite.mlnd.lastInvoice.Private)
+		}
+	}
+}
+
+func TestPrivateHintsTestSuite(t *testing.T) {
+	suite.Run(t, new(PrivateHintsTestSuite))
+}
@@ -0,0 +1,100 @@
+package integration_tests
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/getAlby/lndhub.go/lib/transport"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RateLimitTestSuite struct {
+	TestSuite
+	service    *service.LndhubService
+	userTokens []string
+}
+
+func (suite *RateLimitTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	svc.Config.AuthRateLimit = 0.1
+	svc.Config.AuthBurstRateLimit = 2
+	svc.Config.UserRateLimit = 1
+	svc.Config.UserBurstRateLimit = 2
+	svc.Config.RateLimitOverrides = service.RateLimitOverrides{
+		"/balance": {Rate: 1, Burst: 4},
+	}
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	suite.echo = e
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+	suite.echo.POST("/auth", ok, transport.CreateAuthRateLimitMiddleware(suite.service.Config))
+	secured := suite.echo.Group("", tokens.Middleware(suite.service.Config.JWTSecret), transport.CreateUserRateLimitMiddleware(suite.service.Config))
+	secured.GET("/balance", ok)
+	secured.GET("/gettxs", ok)
+}
+
+func (suite *RateLimitTestSuite) TearDownSuite() {
+	clearTable(suite.service, "refresh_tokens")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *RateLimitTestSuite) TestAuthRateLimit() {
+	for i := 0; i < 2; i++ {
+		assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodPost, "/auth", "").Code)
+	}
+	rec := suite.request(http.MethodPost, "/auth", "")
+	assert.Equal(suite.T(), http.StatusTooManyRequests, rec.Code)
+	assert.Equal(suite.T(), "10", rec.Header().Get("Retry-After"))
+}
+
+func (suite *RateLimitTestSuite) TestUserRateLimit() {
+	for i := 0; i < 2; i++ {
+		assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/gettxs", suite.userTokens[0]).Code)
+	}
+	rec := suite.request(http.MethodGet, "/gettxs", suite.userTokens[0])
+	assert.Equal(suite.T(), http.StatusTooManyRequests, rec.Code)
+	assert.Equal(suite.T(), "1", rec.Header().Get("Retry-After"))
+	// every user has an own bucket
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/gettxs", suite.userTokens[1]).Code)
+
+	// the limit of the route is overridden
+	for i := 0; i < 4; i++ {
+		assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", suite.userTokens[0]).Code)
+	}
+	assert.Equal(suite.T(), http.StatusTooManyRequests, suite.request(http.MethodGet, "/balance", suite.userTokens[0]).Code)
+}
+
+func (suite *RateLimitTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(RateLimitTestSuite))
+}
@@ -0,0 +1,148 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReceiveFeeTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	service                  *service.LndhubService
+	userLogin                ExpectedCreateUserResponseBody
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *ReceiveFeeTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.ReceiveFeePercent = 1
+	svc.Config.MinReceiveSats = 100
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.mlnd = mlnd
+	suite.service = svc
+	suite.userLogin = users[0]
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+}
+
+func (suite *ReceiveFeeTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ReceiveFeeTestSuite) receiveKeysend(amount int64) {
+	preimage, err := makePreimageHex()
+	assert.NoError(suite.T(), err)
+	err = suite.mlnd.mockPaidInvoice(nil, amount, true, &lnrpc.InvoiceHTLC{
+		CustomRecords: map[uint64][]byte{
+			service.TLV_WALLET_ID:         []byte(suite.userLogin.Login),
+			service.KEYSEND_CUSTOM_RECORD: preimage,
+		},
+	})
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+}
+
+func (suite *ReceiveFeeTestSuite) entryAmount(userId int64, entryType string) int64 {
+	var amount int64
+	err := suite.service.DB.NewSelect().Model((*models.TransactionEntry)(nil)).
+		ColumnExpr("COALESCE(SUM(amount), 0)").
+		Where("user_id = ? AND entry_type = ?", userId, entryType).
+		Scan(context.Background(), &amount)
+	assert.NoError(suite.T(), err)
+	return amount
+}
+
+func (suite *ReceiveFeeTestSuite) TestReceiveFeeAndMinimum() {
+	ctx := context.Background()
+	userId := getUserIdFromToken(suite.userToken)
+
+	// invoices below the minimum can't be created
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedAddInvoiceRequestBody{Amount: 99, Memo: "below the minimum"}))
+	req := httptest.NewRequest(http.MethodPost, "/addinvoice", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), "invoice amount is below the minimum of 100 sats", checkErrResponse(&suite.TestSuite, rec).Message)
+
+	// the fee is deducted from the amount, 1% of 1000 sats
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test receive fee", suite.userToken)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil))
+	time.Sleep(10 * time.Millisecond)
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(990), balance)
+	invoice, err := suite.service.FindInvoiceByPaymentHash(ctx, userId, invoiceResponse.RHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), invoice.Amount)
+	assert.Equal(suite.T(), int64(10), invoice.Fee)
+	assert.Equal(suite.T(), int64(10), suite.entryAmount(userId, models.EntryTypeReceiveFee))
+
+	// the minimum applies to the amount before the fee: 100 sats are credited with 99 sats
+	suite.receiveKeysend(100)
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(990+99), balance)
+
+	// payments below the minimum are kept by the operator
+	suite.receiveKeysend(50)
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(990+99), balance)
+	assert.Equal(suite.T(), int64(50), suite.entryAmount(userId, models.EntryTypeBelowMinReceive))
+
+	// or credited without a fee
+	suite.service.Config.MinReceivePolicy = service.MinReceivePolicyCreditWithoutFee
+	defer func() { suite.service.Config.MinReceivePolicy = service.MinReceivePolicyOperator }()
+	suite.receiveKeysend(50)
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(990+99+50), balance)
+	assert.Equal(suite.T(), int64(50), suite.entryAmount(userId, models.EntryTypeBelowMinReceive))
+	suite.assertLedgerMatchesInvoices(suite.service, userId)
+}
+
+func TestReceiveFeeTestSuite(t *testing.T) {
+	suite.Run(t, new(ReceiveFeeTestSuite))
+}
@@ -0,0 +1,110 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const reconcileTestAdminToken = "admin_token"
+
+type ReconcileTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userTokens               []string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *ReconcileTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	suite.mlnd = mlnd
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.GET("/v2/admin/reconcile", v2controllers.NewReconcileController(suite.service).Reconcile, tokens.AdminTokenMiddleware(reconcileTestAdminToken))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *ReconcileTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ReconcileTestSuite) TestReconcile() {
+	for i, amount := range []int{1000, 500} {
+		invoiceResponse := suite.createAddInvoiceReq(amount, "integration test reconcile", suite.userTokens[i])
+		err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+		assert.NoError(suite.T(), err)
+	}
+	//wait a bit for the callback event to hit
+	time.Sleep(100 * time.Millisecond)
+
+	// the node holds less than it owes the users
+	suite.mlnd.ChannelBalanceSat = 1200
+	suite.mlnd.WalletBalanceSat = 0
+	response := suite.reconcile()
+	assert.Equal(suite.T(), int64(1500), response.TotalUserBalance)
+	assert.Equal(suite.T(), int64(1200), response.NodeBalance)
+	assert.Equal(suite.T(), int64(-300), response.Difference)
+	assert.True(suite.T(), response.FractionalReserve)
+
+	suite.mlnd.WalletBalanceSat = 500
+	response = suite.reconcile()
+	assert.Equal(suite.T(), int64(1200), response.ChannelBalance)
+	assert.Equal(suite.T(), int64(500), response.OnchainBalance)
+	assert.Equal(suite.T(), int64(1700), response.NodeBalance)
+	assert.Equal(suite.T(), int64(200), response.Difference)
+	assert.False(suite.T(), response.FractionalReserve)
+}
+
+func (suite *ReconcileTestSuite) reconcile() *v2controllers.ReconcileResponseBody {
+	req := httptest.NewRequest(http.MethodGet, "/v2/admin/reconcile", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", reconcileTestAdminToken))
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.ReconcileResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	return response
+}
+
+func TestReconcileTestSuite(t *testing.T) {
+	suite.Run(t, new(ReconcileTestSuite))
+}
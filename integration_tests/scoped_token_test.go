@@ -0,0 +1,129 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ScopedTokenTestSuite struct {
+	TestSuite
+	service   *service.LndhubService
+	userLogin ExpectedCreateUserResponseBody
+}
+
+func (suite *ScopedTokenTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	users, _, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userLogin = users[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.POST("/auth", controllers.NewAuthController(suite.service).Auth)
+	secured := suite.echo.Group("", tokens.Middleware(suite.service.Config.JWTSecret))
+	secured.GET("/balance", controllers.NewBalanceController(suite.service).Balance)
+	secured.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice, tokens.RequireScope(common.ScopePay))
+	secured.POST("/auth/revoke-all", controllers.NewAuthController(suite.service).RevokeAll, tokens.RequireFullAccess())
+}
+
+func (suite *ScopedTokenTestSuite) TearDownSuite() {
+	clearTable(suite.service, "refresh_tokens")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ScopedTokenTestSuite) TestReadOnlyToken() {
+	authResponse := suite.auth(&controllers.AuthRequestBody{
+		Login:    suite.userLogin.Login,
+		Password: suite.userLogin.Password,
+		Scopes:   []string{common.ScopeRead},
+	}, http.StatusOK)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", authResponse.AccessToken).Code)
+	rec := suite.request(http.MethodPost, "/payinvoice", authResponse.AccessToken)
+	assert.Equal(suite.T(), http.StatusForbidden, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), "token does not have the pay scope required for this request", errorResponse.Message)
+	// a scoped token can not change the account itself
+	assert.Equal(suite.T(), http.StatusForbidden, suite.request(http.MethodPost, "/auth/revoke-all", authResponse.AccessToken).Code)
+
+	// a refresh token never grants more scopes
+	suite.auth(&controllers.AuthRequestBody{
+		RefreshToken: authResponse.RefreshToken,
+		Scopes:       []string{common.ScopeRead, common.ScopePay},
+	}, http.StatusUnauthorized)
+	refreshedResponse := suite.auth(&controllers.AuthRequestBody{
+		RefreshToken: authResponse.RefreshToken,
+	}, http.StatusOK)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.request(http.MethodPost, "/payinvoice", refreshedResponse.AccessToken).Code)
+}
+
+func (suite *ScopedTokenTestSuite) TestFullAccessToken() {
+	authResponse := suite.auth(&controllers.AuthRequestBody{
+		Login:    suite.userLogin.Login,
+		Password: suite.userLogin.Password,
+	}, http.StatusOK)
+	// the scope check passes, the empty request is rejected by the controller
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.request(http.MethodPost, "/payinvoice", authResponse.AccessToken).Code)
+}
+
+func (suite *ScopedTokenTestSuite) TestUnknownScope() {
+	suite.auth(&controllers.AuthRequestBody{
+		Login:    suite.userLogin.Login,
+		Password: suite.userLogin.Password,
+		Scopes:   []string{"admin"},
+	}, http.StatusBadRequest)
+}
+
+func (suite *ScopedTokenTestSuite) auth(body *controllers.AuthRequestBody, expectedStatus int) *controllers.AuthResponseBody {
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	req := httptest.NewRequest(http.MethodPost, "/auth", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), expectedStatus, rec.Code)
+	authResponse := &controllers.AuthResponseBody{}
+	if rec.Code == http.StatusOK {
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(authResponse))
+	}
+	return authResponse
+}
+
+func (suite *ScopedTokenTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString("{}"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestScopedTokenTestSuite(t *testing.T) {
+	suite.Run(t, new(ScopedTokenTestSuite))
+}
@@ -0,0 +1,93 @@
+package integration_tests
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SelfPaymentTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *SelfPaymentTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.SelfPaymentPolicy = service.SelfPaymentPolicyReject
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.mlnd = mlnd
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *SelfPaymentTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *SelfPaymentTestSuite) TestPayOwnInvoice() {
+	ctx := context.Background()
+	userId := getUserIdFromToken(suite.userToken)
+	// fund account
+	invoice := suite.createAddInvoiceReq(1000, "integration test self payment funding", suite.userToken)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoice, 0, false, nil))
+	time.Sleep(10 * time.Millisecond)
+
+	// the user can't pay an own invoice
+	invoice = suite.createAddInvoiceReq(500, "integration test self payment", suite.userToken)
+	errorResponse := suite.createPayInvoiceReqError(invoice.PayReq, suite.userToken)
+	assert.Equal(suite.T(), responses.SelfPaymentError.Code, errorResponse.Code)
+	assert.Equal(suite.T(), responses.SelfPaymentError.Message, errorResponse.Message)
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+
+	// unless it is allowed, the amount goes out and comes back in
+	suite.service.Config.SelfPaymentPolicy = service.SelfPaymentPolicyAllow
+	defer func() { suite.service.Config.SelfPaymentPolicy = service.SelfPaymentPolicyReject }()
+	payResponse := suite.createPayInvoiceReq(&ExpectedPayInvoiceRequestBody{Invoice: invoice.PayReq}, suite.userToken)
+	assert.NotEmpty(suite.T(), payResponse.PaymentPreimage)
+	balance, err = suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000), balance)
+	suite.assertLedgerMatchesInvoices(suite.service, userId)
+}
+
+func TestSelfPaymentTestSuite(t *testing.T) {
+	suite.Run(t, new(SelfPaymentTestSuite))
+}
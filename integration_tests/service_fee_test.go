@@ -0,0 +1,139 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const serviceFeeTestRoutingFee = 2
+
+type ServiceFeeTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *ServiceFeeTestSuite) SetupSuite() {
+	mlnd, err := NewMockLND("1234567890abcdef", serviceFeeTestRoutingFee, make(chan (*lnrpc.Invoice)))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.mlnd = mlnd
+	suite.externalLND = externalLND
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.ServiceFeePercent = 1
+	svc.Config.ServiceFeeFixed = 1
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *ServiceFeeTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ServiceFeeTestSuite) payExternalInvoice(amount int64) *httptest.ResponseRecorder {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: service fee",
+		Value: amount,
+	})
+	assert.NoError(suite.T(), err)
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.PayInvoiceRequestBody{Invoice: invoice.PaymentRequest}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/bolt11", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *ServiceFeeTestSuite) TestServiceFee() {
+	ctx := context.Background()
+	userId := getUserIdFromToken(suite.userToken)
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test service fee", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+
+	// 1 sat + 1% of 500 sats
+	rec := suite.payExternalInvoice(500)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	payResponse := &v2controllers.PayInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(payResponse))
+	assert.Equal(suite.T(), int64(serviceFeeTestRoutingFee), payResponse.RoutingFee)
+	assert.Equal(suite.T(), int64(6), payResponse.ServiceFee)
+	assert.Equal(suite.T(), int64(serviceFeeTestRoutingFee+6), payResponse.Fee)
+
+	balance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1000-500-serviceFeeTestRoutingFee-6), balance)
+
+	invoice, err := suite.service.FindInvoiceByPaymentHash(ctx, userId, payResponse.PaymentHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(6), invoice.ServiceFee)
+	entry := &models.TransactionEntry{}
+	assert.NoError(suite.T(), suite.service.DB.NewSelect().Model(entry).Where("invoice_id = ? AND entry_type = ?", invoice.ID, models.EntryTypeServiceFee).Scan(ctx))
+	assert.Equal(suite.T(), int64(6), entry.Amount)
+	suite.assertLedgerMatchesInvoices(suite.service, userId)
+
+	// the balance covers the amount, but not the service fee
+	rec = suite.payExternalInvoice(balance - 1)
+	assert.Equal(suite.T(), responses.NotEnoughBalanceError.Message, checkErrResponse(&suite.TestSuite, rec).Message)
+	newBalance, err := suite.service.CurrentUserBalance(ctx, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balance, newBalance)
+}
+
+func TestServiceFeeTestSuite(t *testing.T) {
+	suite.Run(t, new(ServiceFeeTestSuite))
+}
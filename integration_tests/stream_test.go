@@ -0,0 +1,201 @@
+package integration_tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StreamTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	users                    []ExpectedCreateUserResponseBody
+	userTokens               []string
+	server                   *httptest.Server
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *StreamTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.WebSocketMaxConnectionsPerUser = 1
+	users, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.mlnd = mlnd
+	suite.users = users
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.GET("/v2/ws", v2controllers.NewStreamController(suite.service).StreamEvents)
+	suite.echo.GET("/v2/invoices/:payment_hash/stream", v2controllers.NewInvoiceController(suite.service).StreamInvoice)
+	suite.server = httptest.NewServer(suite.echo)
+}
+
+func (suite *StreamTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	suite.server.Close()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *StreamTestSuite) dial() (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(suite.server.URL, "http") + "/v2/ws"
+	header := http.Header{}
+	header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userTokens[0]))
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+func (suite *StreamTestSuite) TestStreamSettlement() {
+	ws, _, err := suite.dial()
+	assert.NoError(suite.T(), err)
+	defer ws.Close()
+
+	// the second connection exceeds WEBSOCKET_MAX_CONNECTIONS_PER_USER
+	_, resp, err := suite.dial()
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, resp.StatusCode)
+
+	invoice := suite.createAddInvoiceReq(1000, "integration test stream", suite.userTokens[0])
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoice, 0, false, nil))
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	event := &service.UserWebhookEvent{}
+	assert.NoError(suite.T(), ws.ReadJSON(event))
+	assert.Equal(suite.T(), common.WebhookEventInvoiceSettled, event.Event)
+	assert.Equal(suite.T(), invoice.RHash, event.Data.RHash)
+	assert.Equal(suite.T(), int64(1000), event.Data.Amount)
+	assert.Equal(suite.T(), common.InvoiceStateSettled, event.Data.State)
+
+	balanceEvent := &v2controllers.BalanceChangedEvent{}
+	assert.NoError(suite.T(), ws.ReadJSON(balanceEvent))
+	assert.Equal(suite.T(), common.EventBalanceChanged, balanceEvent.Event)
+	user, err := suite.service.FindUserByLogin(context.Background(), suite.users[0].Login)
+	assert.NoError(suite.T(), err)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balance, balanceEvent.Data.Balance)
+}
+
+func (suite *StreamTestSuite) streamInvoice(rHash, token string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, suite.server.URL+"/v2/invoices/"+rHash+"/stream", nil)
+	assert.NoError(suite.T(), err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	assert.NoError(suite.T(), err)
+	return resp
+}
+
+// readInvoiceEvent reads the next server-sent event, skipping the keep-alive comments
+func readInvoiceEvent(r *bufio.Reader) (event string, invoice *v2controllers.Invoice, err error) {
+	invoice = &v2controllers.Invoice{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, invoice, nil
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), invoice); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+}
+
+func (suite *StreamTestSuite) TestInvoiceStream() {
+	invoice := suite.createAddInvoiceReq(500, "integration test invoice stream", suite.userTokens[0])
+
+	// the invoice has to belong to the user
+	resp := suite.streamInvoice(invoice.RHash, suite.userTokens[1])
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = suite.streamInvoice(invoice.RHash, suite.userTokens[0])
+	defer resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), "text/event-stream", resp.Header.Get(echo.HeaderContentType))
+	reader := bufio.NewReader(resp.Body)
+	event, streamed, err := readInvoiceEvent(reader)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), v2controllers.InvoiceStateCreated, event)
+	assert.Equal(suite.T(), invoice.RHash, streamed.PaymentHash)
+
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoice, 0, false, nil))
+	event, streamed, err = readInvoiceEvent(reader)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), v2controllers.InvoiceStateSettled, event)
+	assert.True(suite.T(), streamed.IsPaid)
+
+	// the stream is closed once the invoice is settled
+	_, _, err = readInvoiceEvent(reader)
+	assert.ErrorIs(suite.T(), err, io.EOF)
+}
+
+func (suite *StreamTestSuite) TestInvoiceStreamExpired() {
+	invoice := suite.createAddInvoiceReq(500, "integration test expired invoice stream", suite.userTokens[0])
+	_, err := suite.service.DB.NewUpdate().Model((*models.Invoice)(nil)).
+		Set("expires_at = ?", time.Now().Add(-time.Minute)).
+		Where("r_hash = ?", invoice.RHash).
+		Exec(context.Background())
+	assert.NoError(suite.T(), err)
+
+	resp := suite.streamInvoice(invoice.RHash, suite.userTokens[0])
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	event, _, err := readInvoiceEvent(reader)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), v2controllers.InvoiceStateExpired, event)
+	_, _, err = readInvoiceEvent(reader)
+	assert.ErrorIs(suite.T(), err, io.EOF)
+}
+
+func TestStreamTestSuite(t *testing.T) {
+	suite.Run(t, new(StreamTestSuite))
+}
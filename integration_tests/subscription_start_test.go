@@ -17,6 +17,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -116,10 +117,26 @@ func (mock *lndSubscriptionStartMockClient) SendPaymentSync(ctx context.Context,
 	panic("not implemented") // TODO: Implement
 }
 
+func (mock *lndSubscriptionStartMockClient) SendPaymentV2(ctx context.Context, req *routerrpc.SendPaymentRequest, options ...grpc.CallOption) (lnd.SubscribePaymentWrapper, error) {
+	panic("not implemented") // TODO: Implement
+}
+
 func (mock *lndSubscriptionStartMockClient) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
 	panic("not implemented") // TODO: Implement
 }
 
+func (mock *lndSubscriptionStartMockClient) AddHoldInvoice(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest, options ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) SettleInvoice(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) CancelInvoice(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error) {
+	panic("not implemented") // TODO: Implement
+}
+
 func (mock *lndSubscriptionStartMockClient) SubscribeInvoices(ctx context.Context, req *lnrpc.InvoiceSubscription, options ...grpc.CallOption) (lnd.SubscribeInvoicesWrapper, error) {
 	mock.addIndexChannel <- req.AddIndex
 	return mock, nil
@@ -137,6 +154,18 @@ func (mock *lndSubscriptionStartMockClient) GetInfo(ctx context.Context, req *ln
 	panic("not implemented") // TODO: Implement
 }
 
+func (mock *lndSubscriptionStartMockClient) EstimateRouteFee(ctx context.Context, req *routerrpc.RouteFeeRequest, options ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) ChannelBalance(ctx context.Context, req *lnrpc.ChannelBalanceRequest, options ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) WalletBalance(ctx context.Context, req *lnrpc.WalletBalanceRequest, options ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
+	panic("not implemented") // TODO: Implement
+}
+
 func (mock *lndSubscriptionStartMockClient) DecodeBolt11(ctx context.Context, bolt11 string, options ...grpc.CallOption) (*lnrpc.PayReq, error) {
 	panic("not implemented") // TODO: Implement
 }
@@ -144,10 +173,42 @@ func (mock *lndSubscriptionStartMockClient) DecodeBolt11(ctx context.Context, bo
 func (mlnd *lndSubscriptionStartMockClient) TrackPayment(ctx context.Context, hash []byte, options ...grpc.CallOption) (*lnrpc.Payment, error) {
 	return nil, nil
 }
+func (mock *lndSubscriptionStartMockClient) NewAddress(ctx context.Context, req *lnrpc.NewAddressRequest, options ...grpc.CallOption) (*lnrpc.NewAddressResponse, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) GetTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (*lnrpc.TransactionDetails, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) SubscribeTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (lnd.SubscribeTransactionsWrapper, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) EstimateFee(ctx context.Context, req *lnrpc.EstimateFeeRequest, options ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) SendCoins(ctx context.Context, req *lnrpc.SendCoinsRequest, options ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) CreateOffer(ctx context.Context, req *lnd.OfferRequest) (*lnd.Offer, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) LookupInvoiceOffer(ctx context.Context, rHash []byte) (offerId string, err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+func (mock *lndSubscriptionStartMockClient) FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+	panic("not implemented") // TODO: Implement
+}
+
 func (mlnd *lndSubscriptionStartMockClient) IsIdentityPubkey(pubkey string) (isOurPubkey bool) {
 	panic("not implemented") // TODO: Implement
 }
 
 func (mlnd *lndSubscriptionStartMockClient) GetMainPubkey() (pubkey string) {
-	panic("not implemented") // TODO: Implement
+	return ""
 }
@@ -0,0 +1,171 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const suspensionTestAdminToken = "admin_token"
+
+type SuspensionTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *SuspensionTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.mlnd = mlnd
+	suite.externalLND = externalLND
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suspendUserCtrl := v2controllers.NewSuspendUserController(suite.service)
+	suite.echo.POST("/v2/admin/users/:id/suspend", suspendUserCtrl.SuspendUser, tokens.AdminTokenMiddleware(suspensionTestAdminToken))
+	suite.echo.POST("/v2/admin/users/:id/unsuspend", suspendUserCtrl.UnsuspendUser, tokens.AdminTokenMiddleware(suspensionTestAdminToken))
+	secured := suite.echo.Group("", tokens.Middleware([]byte(suite.service.Config.JWTSecret)), suite.service.SuspensionMiddleware())
+	secured.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	secured.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice)
+	secured.GET("/balance", controllers.NewBalanceController(suite.service).Balance)
+}
+
+func (suite *SuspensionTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *SuspensionTestSuite) TestSuspension() {
+	userId := getUserIdFromToken(suite.userToken)
+	//fund user account
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test suspension", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	//wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	// users suspended from sending can't pay
+	rec := suite.adminRequest(fmt.Sprintf("/v2/admin/users/%d/suspend", userId), &v2controllers.SuspendUserRequestBody{Mode: common.SuspendModeSendOnly})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	suspendResponse := &v2controllers.SuspendUserResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(suspendResponse))
+	assert.True(suite.T(), suspendResponse.Suspended)
+	assert.Equal(suite.T(), common.SuspendModeSendOnly, suspendResponse.SuspendMode)
+	rec = suite.payExternalInvoice(100)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), responses.SendingSuspendedError.Message, errorResponse.Message)
+
+	// but can still receive
+	invoiceResponse = suite.createAddInvoiceReq(500, "integration test suspension", suite.userToken)
+	err = suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	time.Sleep(10 * time.Millisecond)
+	balance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1500), balance)
+
+	// a full suspension rejects all requests
+	rec = suite.adminRequest(fmt.Sprintf("/v2/admin/users/%d/suspend", userId), &v2controllers.SuspendUserRequestBody{})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Equal(suite.T(), http.StatusForbidden, suite.balanceRequest().Code)
+
+	// invalid modes are rejected
+	rec = suite.adminRequest(fmt.Sprintf("/v2/admin/users/%d/suspend", userId), &v2controllers.SuspendUserRequestBody{Mode: "receive_only"})
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+
+	rec = suite.adminRequest(fmt.Sprintf("/v2/admin/users/%d/unsuspend", userId), nil)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.balanceRequest().Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.payExternalInvoice(100).Code)
+}
+
+func (suite *SuspensionTestSuite) adminRequest(path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suspensionTestAdminToken))
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *SuspensionTestSuite) balanceRequest() *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/balance", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	rec := httptest.NewRecorder()
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *SuspensionTestSuite) payExternalInvoice(amount int64) *httptest.ResponseRecorder {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: suspension",
+		Value: amount,
+	})
+	assert.NoError(suite.T(), err)
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&ExpectedPayInvoiceRequestBody{
+		Invoice: invoice.PaymentRequest,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/payinvoice", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSuspensionTestSuite(t *testing.T) {
+	suite.Run(t, new(SuspensionTestSuite))
+}
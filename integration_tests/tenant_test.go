@@ -0,0 +1,145 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const tenantTestAdminToken = "admin_token"
+
+type TenantTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+	// the users of brand-a, brand-b and the default tenant
+	users      []*models.User
+	userTokens []string
+	balances   []int64
+}
+
+func (suite *TenantTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.service = svc
+	suite.balances = []int64{1000, 250, 50}
+	for i, tenantID := range []string{"brand-a", "brand-b", ""} {
+		user, err := svc.RegisterUser(context.Background(), tenantID, "", "", "")
+		if err != nil {
+			log.Fatalf("Error creating test user: %v", err)
+		}
+		token, _, err := svc.GenerateToken(context.Background(), user.Login, user.Password, "")
+		if err != nil {
+			log.Fatalf("Error generating test token: %v", err)
+		}
+		if _, err := svc.AdjustBalance(context.Background(), user.ID, suite.balances[i], "integration test tenants", "admin", false); err != nil {
+			log.Fatalf("Error funding test user: %v", err)
+		}
+		suite.users = append(suite.users, user)
+		suite.userTokens = append(suite.userTokens, token)
+	}
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	jwtMw := tokens.Middleware([]byte(svc.Config.JWTSecret))
+	adminMw := tokens.AdminTokenMiddleware(tenantTestAdminToken)
+	suite.echo.GET("/v2/balance", v2controllers.NewBalanceController(svc).Balance, jwtMw)
+	suite.echo.GET("/tenant", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get("TenantID").(string))
+	}, jwtMw)
+	suite.echo.GET("/v2/admin/users", v2controllers.NewListUsersController(svc).ListUsers, adminMw)
+	suite.echo.POST("/v2/balances/batch", v2controllers.NewBalanceController(svc).BatchBalances, adminMw)
+}
+
+func (suite *TenantTestSuite) TearDownSuite() {
+	clearTable(suite.service, "balance_adjustments")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *TenantTestSuite) request(method, path, token, tenantID string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	if tenantID != "" {
+		req.Header.Set(common.TenantHeader, tenantID)
+	}
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *TenantTestSuite) TestTokenCarriesTenant() {
+	for i, user := range suite.users {
+		rec := suite.request(http.MethodGet, "/tenant", suite.userTokens[i], "", nil)
+		assert.Equal(suite.T(), http.StatusOK, rec.Code)
+		assert.Equal(suite.T(), user.TenantID, rec.Body.String())
+
+		// every user only sees their own balance
+		rec = suite.request(http.MethodGet, "/v2/balance", suite.userTokens[i], "", nil)
+		assert.Equal(suite.T(), http.StatusOK, rec.Code)
+		balance := &v2controllers.BalanceResponse{}
+		assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(balance))
+		assert.Equal(suite.T(), suite.balances[i], balance.Balance)
+	}
+}
+
+func (suite *TenantTestSuite) TestAdminScopedToTenant() {
+	rec := suite.request(http.MethodGet, "/v2/admin/users", tenantTestAdminToken, "brand-a", nil)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	users := &v2controllers.ListUsersResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(users))
+	if assert.Len(suite.T(), users.Users, 1) {
+		assert.Equal(suite.T(), suite.users[0].ID, users.Users[0].ID)
+		assert.Equal(suite.T(), "brand-a", users.Users[0].TenantID)
+		assert.Equal(suite.T(), suite.balances[0], users.Users[0].Balance)
+	}
+
+	// users of other tenants are missing in the result
+	userIds := []int64{suite.users[0].ID, suite.users[1].ID, suite.users[2].ID}
+	rec = suite.request(http.MethodPost, "/v2/balances/batch", tenantTestAdminToken, "brand-b", &v2controllers.BatchBalanceRequestBody{UserIds: userIds})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	balances := &v2controllers.BatchBalanceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(balances))
+	assert.Equal(suite.T(), map[int64]int64{suite.users[1].ID: suite.balances[1]}, balances.Balances)
+
+	// requests without a tenant cover all tenants
+	rec = suite.request(http.MethodPost, "/v2/balances/batch", tenantTestAdminToken, "", &v2controllers.BatchBalanceRequestBody{UserIds: userIds})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	balances = &v2controllers.BatchBalanceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(balances))
+	assert.Len(suite.T(), balances.Balances, 3)
+
+	rec = suite.request(http.MethodGet, "/v2/admin/users", tenantTestAdminToken, "Brand A", nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func TestTenantTestSuite(t *testing.T) {
+	suite.Run(t, new(TenantTestSuite))
+}
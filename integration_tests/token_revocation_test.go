@@ -0,0 +1,133 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenRevocationTestSuite struct {
+	TestSuite
+	service *service.LndhubService
+	logins  []ExpectedCreateUserResponseBody
+}
+
+func (suite *TokenRevocationTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	logins, _, err := createUsers(svc, 3)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.logins = logins
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	authCtrl := controllers.NewAuthController(suite.service)
+	suite.echo.POST("/auth", authCtrl.Auth)
+	secured := suite.echo.Group("", tokens.Middleware(suite.service.Config.JWTSecret), suite.service.TokenRevocationMiddleware())
+	secured.POST("/auth/revoke", authCtrl.Revoke)
+	secured.POST("/auth/revoke-all", authCtrl.RevokeAll)
+	secured.GET("/balance", controllers.NewBalanceController(suite.service).Balance)
+}
+
+func (suite *TokenRevocationTestSuite) TearDownSuite() {
+	clearTable(suite.service, "revoked_tokens")
+	clearTable(suite.service, "refresh_tokens")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *TokenRevocationTestSuite) TestRevokeToken() {
+	login := suite.logins[0]
+	accessToken, _, err := suite.service.GenerateToken(context.Background(), login.Login, login.Password, "")
+	assert.NoError(suite.T(), err)
+	otherAccessToken, _, err := suite.service.GenerateToken(context.Background(), login.Login, login.Password, "")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", accessToken).Code)
+
+	assert.Equal(suite.T(), http.StatusNoContent, suite.request(http.MethodPost, "/auth/revoke", accessToken).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", accessToken).Code)
+	// other tokens of the user are still valid
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", otherAccessToken).Code)
+}
+
+func (suite *TokenRevocationTestSuite) TestRevokeAllTokens() {
+	login := suite.logins[1]
+	accessToken, refreshToken, err := suite.service.GenerateToken(context.Background(), login.Login, login.Password, "")
+	assert.NoError(suite.T(), err)
+	otherAccessToken, _, err := suite.service.GenerateToken(context.Background(), login.Login, login.Password, "")
+	assert.NoError(suite.T(), err)
+
+	assert.Equal(suite.T(), http.StatusNoContent, suite.request(http.MethodPost, "/auth/revoke-all", accessToken).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", accessToken).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", otherAccessToken).Code)
+
+	// revoked refresh tokens can't be exchanged for new tokens
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&controllers.AuthRequestBody{
+		RefreshToken: refreshToken,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/auth", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusUnauthorized, rec.Code)
+
+	// tokens issued afterwards are valid
+	newAccessToken, _, err := suite.service.GenerateToken(context.Background(), login.Login, login.Password, "")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", newAccessToken).Code)
+}
+
+func (suite *TokenRevocationTestSuite) TestRefreshTokenAsAccessToken() {
+	login := suite.logins[2]
+	_, refreshToken, err := suite.service.GenerateToken(context.Background(), login.Login, login.Password, "")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", refreshToken).Code)
+
+	// a rotated refresh token is rejected
+	accessToken, rotatedRefreshToken, err := suite.service.GenerateToken(context.Background(), "", "", refreshToken)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/balance", accessToken).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", refreshToken).Code)
+
+	// reusing the refresh token revokes its family, the refresh tokens of the family are rejected as well
+	_, _, err = suite.service.GenerateToken(context.Background(), "", "", refreshToken)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", accessToken).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", rotatedRefreshToken).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.request(http.MethodGet, "/balance", refreshToken).Code)
+}
+
+func (suite *TokenRevocationTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTokenRevocationTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenRevocationTestSuite))
+}
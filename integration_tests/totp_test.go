@@ -0,0 +1,221 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/security"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TOTPTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userToken                string
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *TOTPTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice), 5))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	suite.externalLND = externalLND
+	suite.mlnd = mlnd
+
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	totpCtrl := v2controllers.NewTOTPController(suite.service)
+	suite.echo.POST("/v2/totp/enroll", totpCtrl.Enroll)
+	suite.echo.POST("/v2/totp/verify", totpCtrl.Verify)
+	suite.echo.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(suite.service).PayInvoice)
+}
+
+func (suite *TOTPTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "totp_backup_codes")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *TOTPTestSuite) TestPaymentsWithTOTP() {
+	userFundingSats := 1000
+	invoiceResponse := suite.createAddInvoiceReq(userFundingSats, "integration test totp", suite.userToken)
+	err := suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil)
+	assert.NoError(suite.T(), err)
+	// wait a bit for the callback event to hit
+	time.Sleep(10 * time.Millisecond)
+
+	// without two-factor authentication no code is needed
+	rec := suite.payInvoice(suite.externalInvoice(10, "preimage1"), "")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	rec = suite.postJSON("/v2/totp/enroll", nil)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	enrollResponse := &v2controllers.EnrollTOTPResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(enrollResponse))
+	assert.NotEmpty(suite.T(), enrollResponse.Secret)
+	assert.Contains(suite.T(), enrollResponse.ProvisioningURI, "otpauth://totp/")
+
+	// not enabled before the secret is verified
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage2"), "")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	rec = suite.postJSON("/v2/totp/verify", &v2controllers.VerifyTOTPRequestBody{TotpCode: "000000x"})
+	suite.assertErrorResponse(rec, responses.InvalidTOTPCodeError)
+
+	step := security.TOTPStep(time.Now())
+	verifyCode, err := security.TOTPCode(enrollResponse.Secret, step)
+	assert.NoError(suite.T(), err)
+	rec = suite.postJSON("/v2/totp/verify", &v2controllers.VerifyTOTPRequestBody{TotpCode: verifyCode})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	verifyResponse := &v2controllers.VerifyTOTPResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(verifyResponse))
+	assert.Equal(suite.T(), 10, len(verifyResponse.BackupCodes))
+
+	rec = suite.postJSON("/v2/totp/enroll", nil)
+	suite.assertErrorResponse(rec, responses.TOTPAlreadyEnabledError)
+
+	// missing code
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage3"), "")
+	suite.assertErrorResponse(rec, responses.TOTPRequiredError)
+
+	// invalid code, outside of the accepted time window
+	invalidCode, err := security.TOTPCode(enrollResponse.Secret, step+10)
+	assert.NoError(suite.T(), err)
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage3"), invalidCode)
+	suite.assertErrorResponse(rec, responses.InvalidTOTPCodeError)
+
+	// the code used for the verification was already used
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage3"), verifyCode)
+	suite.assertErrorResponse(rec, responses.InvalidTOTPCodeError)
+
+	// the code of the next step is accepted once
+	nextCode, err := security.TOTPCode(enrollResponse.Secret, step+1)
+	assert.NoError(suite.T(), err)
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage3"), nextCode)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage4"), nextCode)
+	suite.assertErrorResponse(rec, responses.InvalidTOTPCodeError)
+
+	// backup codes work once
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage4"), verifyResponse.BackupCodes[0])
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage5"), verifyResponse.BackupCodes[0])
+	suite.assertErrorResponse(rec, responses.InvalidTOTPCodeError)
+
+	// a retry with the idempotency key is answered with the payment without using up a code
+	paymentRequest := suite.externalInvoice(10, "preimage5")
+	rec = suite.payInvoiceWithKey(paymentRequest, verifyResponse.BackupCodes[1], "totp-retry")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rec = suite.payInvoiceWithKey(paymentRequest, verifyResponse.BackupCodes[1], "totp-retry")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rec = suite.payInvoiceWithKey(paymentRequest, verifyResponse.BackupCodes[2], "totp-retry")
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	rec = suite.payInvoice(suite.externalInvoice(10, "preimage6"), verifyResponse.BackupCodes[2])
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+
+	userId := getUserIdFromToken(suite.userToken)
+	outgoingInvoices, err := suite.service.InvoicesFor(context.Background(), userId, common.InvoiceTypeOutgoing)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 6, len(outgoingInvoices))
+	userBalance, err := suite.service.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(userFundingSats-60), userBalance)
+}
+
+func (suite *TOTPTestSuite) externalInvoice(amount int64, preimage string) string {
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "integration tests: totp",
+		Value:     amount,
+		RPreimage: []byte(preimage),
+	})
+	assert.NoError(suite.T(), err)
+	return invoice.PaymentRequest
+}
+
+func (suite *TOTPTestSuite) payInvoice(paymentRequest, totpCode string) *httptest.ResponseRecorder {
+	return suite.postJSON("/v2/payments/bolt11", &v2controllers.PayInvoiceRequestBody{
+		Invoice:  paymentRequest,
+		TotpCode: totpCode,
+	})
+}
+
+func (suite *TOTPTestSuite) payInvoiceWithKey(paymentRequest, totpCode, idempotencyKey string) *httptest.ResponseRecorder {
+	return suite.postJSONWithHeader("/v2/payments/bolt11", &v2controllers.PayInvoiceRequestBody{
+		Invoice:  paymentRequest,
+		TotpCode: totpCode,
+	}, v2controllers.IdempotencyKeyHeader, idempotencyKey)
+}
+
+func (suite *TOTPTestSuite) postJSON(path string, body interface{}) *httptest.ResponseRecorder {
+	return suite.postJSONWithHeader(path, body, "", "")
+}
+
+func (suite *TOTPTestSuite) postJSONWithHeader(path string, body interface{}, header, value string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *TOTPTestSuite) assertErrorResponse(rec *httptest.ResponseRecorder, expected responses.ErrorResponse) {
+	assert.Equal(suite.T(), expected.HttpStatusCode, rec.Code)
+	errorResponse := &responses.ErrorResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(errorResponse))
+	assert.Equal(suite.T(), expected.Message, errorResponse.Message)
+}
+
+func TestTOTPTestSuite(t *testing.T) {
+	suite.Run(t, new(TOTPTestSuite))
+}
@@ -0,0 +1,211 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TransactionsTestSuite struct {
+	TestSuite
+	service    *service.LndhubService
+	userTokens []string
+}
+
+func (suite *TransactionsTestSuite) SetupSuite() {
+	svc, err := LndHubTestServiceInit(newDefaultMockLND())
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	_, userTokens, err := createUsers(svc, 5)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	suite.service = svc
+	suite.userTokens = userTokens
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	transactionsCtrl := v2controllers.NewTransactionsController(suite.service)
+	suite.echo.GET("/v2/transactions", transactionsCtrl.GetTransactions)
+	suite.echo.GET("/v2/transactions/export.csv", transactionsCtrl.ExportTransactions)
+}
+
+func (suite *TransactionsTestSuite) TearDownSuite() {
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *TransactionsTestSuite) TestGetTransactionsEmpty() {
+	transactions := suite.getTransactions(suite.userTokens[0], "")
+	assert.Equal(suite.T(), 0, len(transactions.Transactions))
+	assert.Equal(suite.T(), int64(0), transactions.NextCursor)
+}
+
+func (suite *TransactionsTestSuite) TestGetTransactionsExactPageSize() {
+	for i := 0; i < 3; i++ {
+		suite.createAddInvoiceReq(100, fmt.Sprintf("integration test transactions %d", i), suite.userTokens[1])
+	}
+	transactions := suite.getTransactions(suite.userTokens[1], "?limit=3")
+	assert.Equal(suite.T(), 3, len(transactions.Transactions))
+	// there is no next page
+	assert.Equal(suite.T(), int64(0), transactions.NextCursor)
+}
+
+func (suite *TransactionsTestSuite) TestGetTransactionsCursor() {
+	invoices := []*ExpectedAddInvoiceResponseBody{}
+	for i := 0; i < 5; i++ {
+		invoices = append(invoices, suite.createAddInvoiceReq(100+i, fmt.Sprintf("integration test transactions %d", i), suite.userTokens[2]))
+	}
+	paymentHashes := []string{}
+	transactions := suite.getTransactions(suite.userTokens[2], "?limit=2")
+	for transactions.NextCursor != 0 {
+		assert.Equal(suite.T(), 2, len(transactions.Transactions))
+		for _, tx := range transactions.Transactions {
+			paymentHashes = append(paymentHashes, tx.PaymentHash)
+		}
+		transactions = suite.getTransactions(suite.userTokens[2], fmt.Sprintf("?limit=2&cursor=%d", transactions.NextCursor))
+	}
+	assert.Equal(suite.T(), 1, len(transactions.Transactions))
+	paymentHashes = append(paymentHashes, transactions.Transactions[0].PaymentHash)
+
+	// newest first, without gaps or duplicates
+	assert.Equal(suite.T(), 5, len(paymentHashes))
+	for i, invoice := range invoices {
+		assert.Equal(suite.T(), invoice.RHash, paymentHashes[len(paymentHashes)-1-i])
+	}
+}
+
+func (suite *TransactionsTestSuite) TestGetTransactionsFilter() {
+	token := suite.userTokens[3]
+	settledInvoice := suite.createAddInvoiceReq(100, "integration test transactions settled", token)
+	openInvoice := suite.createAddInvoiceReq(200, "integration test transactions open", token)
+	_, err := suite.service.DB.NewUpdate().Model(&models.Invoice{}).
+		Set("state = ?", common.InvoiceStateSettled).
+		Set("settled_at = ?", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)).
+		Where("r_hash = ?", settledInvoice.RHash).
+		Exec(context.Background())
+	assert.NoError(suite.T(), err)
+
+	assert.Equal(suite.T(), 2, len(suite.getTransactions(token, "?type=incoming").Transactions))
+	assert.Equal(suite.T(), 0, len(suite.getTransactions(token, "?type=outgoing").Transactions))
+	assert.Equal(suite.T(), 0, len(suite.getTransactions(token, "?state=failed").Transactions))
+
+	transactions := suite.getTransactions(token, "?state=settled")
+	assert.Equal(suite.T(), 1, len(transactions.Transactions))
+	assert.Equal(suite.T(), settledInvoice.RHash, transactions.Transactions[0].PaymentHash)
+	transactions = suite.getTransactions(token, "?state=pending")
+	assert.Equal(suite.T(), 1, len(transactions.Transactions))
+	assert.Equal(suite.T(), openInvoice.RHash, transactions.Transactions[0].PaymentHash)
+
+	// settled invoices are filtered by their settled date
+	transactions = suite.getTransactions(token, "?from=2021-01-01T00:00:00Z")
+	assert.Equal(suite.T(), 1, len(transactions.Transactions))
+	assert.Equal(suite.T(), openInvoice.RHash, transactions.Transactions[0].PaymentHash)
+	transactions = suite.getTransactions(token, "?from=2019-01-01T00:00:00Z&to=2020-06-01T00:00:00Z")
+	assert.Equal(suite.T(), 1, len(transactions.Transactions))
+	assert.Equal(suite.T(), settledInvoice.RHash, transactions.Transactions[0].PaymentHash)
+}
+
+func (suite *TransactionsTestSuite) TestGetTransactionsInvalidParams() {
+	for _, query := range []string{
+		"?limit=1000",
+		"?type=unknown",
+		"?state=unknown",
+		"?from=yesterday",
+		"?from=2021-01-01T00:00:00Z&to=2020-01-01T00:00:00Z",
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v2/transactions"+query, nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userTokens[0]))
+		suite.echo.ServeHTTP(rec, req)
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func (suite *TransactionsTestSuite) TestExportTransactions() {
+	token := suite.userTokens[4]
+	formulaInvoice := suite.createAddInvoiceReq(100, `=HYPERLINK("https://example.com","export")`, token)
+	invoice := suite.createAddInvoiceReq(1234, "integration test, export", token)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/transactions/export.csv?type=incoming", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	assert.Equal(suite.T(), "text/csv", rec.Header().Get(echo.HeaderContentType))
+	assert.True(suite.T(), strings.HasPrefix(rec.Header().Get(echo.HeaderContentDisposition), "attachment"))
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(records))
+	assert.Equal(suite.T(), []string{"date", "type", "amount", "fee", "memo", "payment_hash", "state"}, records[0])
+	_, err = time.Parse(time.RFC3339, records[1][0])
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), common.InvoiceTypeIncoming, records[1][1])
+	// amounts are whole satoshis
+	assert.Equal(suite.T(), "1234", records[1][2])
+	assert.Equal(suite.T(), "0", records[1][3])
+	assert.Equal(suite.T(), "integration test, export", records[1][4])
+	assert.Equal(suite.T(), invoice.RHash, records[1][5])
+	assert.Equal(suite.T(), common.InvoiceStateOpen, records[1][6])
+	// memos are not evaluated as formulas when the export is opened in a spreadsheet
+	assert.Equal(suite.T(), formulaInvoice.RHash, records[2][5])
+	assert.Equal(suite.T(), `'=HYPERLINK("https://example.com","export")`, records[2][4])
+
+	// the filters of the transactions endpoint apply
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/v2/transactions/export.csv?type=outgoing", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	records, err = csv.NewReader(rec.Body).ReadAll()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(records))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/v2/transactions/export.csv?from=2021-01-01T00:00:00Z&to=2020-01-01T00:00:00Z", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *TransactionsTestSuite) getTransactions(token, query string) *v2controllers.GetTransactionsResponseBody {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v2/transactions"+query, nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	transactions := &v2controllers.GetTransactionsResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(transactions))
+	return transactions
+}
+
+func TestTransactionsTestSuite(t *testing.T) {
+	suite.Run(t, new(TransactionsTestSuite))
+}
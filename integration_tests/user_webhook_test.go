@@ -0,0 +1,188 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type userWebhookDelivery struct {
+	signature string
+	body      []byte
+}
+
+type UserWebhookTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userToken                string
+	webhookServer            *httptest.Server
+	deliveries               chan userWebhookDelivery
+	failedDeliveries         int32
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *UserWebhookTestSuite) SetupSuite() {
+	suite.deliveries = make(chan userWebhookDelivery, 10)
+	suite.webhookServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		suite.deliveries <- userWebhookDelivery{
+			signature: r.Header.Get(service.UserWebhookSignatureHeader),
+			body:      body,
+		}
+		// fail the first delivery to test the retries
+		if atomic.AddInt32(&suite.failedDeliveries, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	// the webhook server is on a private address
+	svc.Config.OutboundAllowedHosts = []string{"127.0.0.1"}
+	svc.OutboundClient, err = service.NewOutboundClient(svc.Config)
+	if err != nil {
+		log.Fatalf("Error initializing outbound client: %v", err)
+	}
+	svc.Config.UserWebhookMaxRetries = 2
+	_, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	go svc.StartUserWebhookDeliveries(ctx)
+	suite.service = svc
+	suite.mlnd = mlnd
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	webhookCtrl := v2controllers.NewWebhookController(suite.service)
+	suite.echo.POST("/v2/webhooks", webhookCtrl.CreateWebhook)
+	suite.echo.GET("/v2/webhooks", webhookCtrl.ListWebhooks)
+	suite.echo.DELETE("/v2/webhooks/:id", webhookCtrl.DeleteWebhook)
+}
+
+func (suite *UserWebhookTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	suite.webhookServer.Close()
+	clearTable(suite.service, "webhooks")
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *UserWebhookTestSuite) TestUserWebhook() {
+	rec := suite.doRequest(http.MethodPost, "/v2/webhooks", &v2controllers.CreateWebhookRequestBody{
+		Url:    suite.webhookServer.URL,
+		Events: []string{common.WebhookEventInvoiceSettled},
+	})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	webhook := &v2controllers.Webhook{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(webhook))
+	assert.NotEmpty(suite.T(), webhook.Secret)
+
+	// the secret is only returned once
+	rec = suite.doRequest(http.MethodGet, "/v2/webhooks", nil)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	webhooks := []v2controllers.Webhook{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(&webhooks))
+	assert.Equal(suite.T(), 1, len(webhooks))
+	assert.Empty(suite.T(), webhooks[0].Secret)
+
+	invoice := suite.createAddInvoiceReq(1000, "integration test user webhook", suite.userToken)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoice, 0, false, nil))
+
+	// the first delivery fails and is retried
+	for i := 0; i < 2; i++ {
+		select {
+		case delivery := <-suite.deliveries:
+			assert.Equal(suite.T(), "sha256="+service.SignUserWebhookPayload(webhook.Secret, delivery.body), delivery.signature)
+			event := &service.UserWebhookEvent{}
+			assert.NoError(suite.T(), json.Unmarshal(delivery.body, event))
+			assert.Equal(suite.T(), common.WebhookEventInvoiceSettled, event.Event)
+			assert.Equal(suite.T(), "integration test user webhook", event.Data.Memo)
+			assert.Equal(suite.T(), invoice.RHash, event.Data.RHash)
+			assert.Equal(suite.T(), int64(1000), event.Data.Amount)
+		case <-time.After(5 * time.Second):
+			suite.T().Fatal("webhook was not delivered")
+		}
+	}
+
+	// wait a bit for the delivery status to be recorded
+	time.Sleep(100 * time.Millisecond)
+	rec = suite.doRequest(http.MethodGet, "/v2/webhooks", nil)
+	webhooks = []v2controllers.Webhook{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(&webhooks))
+	assert.Equal(suite.T(), http.StatusOK, webhooks[0].LastDeliveryStatus)
+	assert.Empty(suite.T(), webhooks[0].LastDeliveryError)
+
+	rec = suite.doRequest(http.MethodDelete, fmt.Sprintf("/v2/webhooks/%d", webhook.ID), nil)
+	assert.Equal(suite.T(), http.StatusNoContent, rec.Code)
+	rec = suite.doRequest(http.MethodDelete, fmt.Sprintf("/v2/webhooks/%d", webhook.ID), nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *UserWebhookTestSuite) TestCreateUserWebhookInvalid() {
+	for _, body := range []*v2controllers.CreateWebhookRequestBody{
+		{Url: "not a url", Events: []string{common.WebhookEventInvoiceSettled}},
+		{Url: suite.webhookServer.URL, Events: []string{}},
+		{Url: suite.webhookServer.URL, Events: []string{"invoice.unknown"}},
+		// private addresses that are not allowed
+		{Url: "http://169.254.169.254/latest/meta-data", Events: []string{common.WebhookEventInvoiceSettled}},
+		{Url: "http://10.0.0.1:8080/hook", Events: []string{common.WebhookEventInvoiceSettled}},
+	} {
+		rec := suite.doRequest(http.MethodPost, "/v2/webhooks", body)
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	}
+}
+
+func (suite *UserWebhookTestSuite) doRequest(method, path string, body interface{}) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	if body != nil {
+		assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUserWebhookTestSuite(t *testing.T) {
+	suite.Run(t, new(UserWebhookTestSuite))
+}
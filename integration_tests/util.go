@@ -57,6 +57,9 @@ func LndHubTestServiceInit(lndClientMock lnd.LightningClientWrapper) (svc *servi
 		JWTSecret:               []byte("SECRET"),
 		JWTAccessTokenExpiry:    3600,
 		JWTRefreshTokenExpiry:   3600,
+		DefaultInvoiceExpiry:    86400,
+		// many suites fund a user and pay an invoice of the same user
+		SelfPaymentPolicy: service.SelfPaymentPolicyAllow,
 	}
 
 	rabbitmqUri, ok := os.LookupEnv("RABBITMQ_URI")
@@ -97,7 +100,7 @@ func LndHubTestServiceInit(lndClientMock lnd.LightningClientWrapper) (svc *servi
 		return nil, fmt.Errorf("failed to migrate: %w", err)
 	}
 
-	logger := lib.Logger(c.LogFilePath)
+	logger := lib.Logger(c.LogFilePath, c.LogFormat)
 	svc = &service.LndhubService{
 		Config:         c,
 		DB:             dbConn,
@@ -144,6 +147,26 @@ func invoicesFor(svc *service.LndhubService, userId int64, invoiceType string) (
 	return invoices, nil
 }
 
+// invoiceBalance is the balance computed from the settled invoices like before the ledger,
+// it is compared to the ledger balance as a cross-check
+func invoiceBalance(svc *service.LndhubService, userId int64) (int64, error) {
+	var balance int64
+	err := svc.DB.NewSelect().Model((*models.Invoice)(nil)).
+		ColumnExpr("COALESCE(SUM(CASE WHEN type = ? THEN amount - COALESCE(fee, 0) ELSE -(amount + COALESCE(fee, 0) + COALESCE(service_fee, 0)) END), 0)", common.InvoiceTypeIncoming).
+		Where("user_id = ?", userId).
+		Where("state = ?", common.InvoiceStateSettled).
+		Scan(context.Background(), &balance)
+	return balance, err
+}
+
+func (suite *TestSuite) assertLedgerMatchesInvoices(svc *service.LndhubService, userId int64) {
+	ledgerBalance, err := svc.CurrentUserBalance(context.Background(), userId)
+	assert.NoError(suite.T(), err)
+	balance, err := invoiceBalance(svc, userId)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), balance, ledgerBalance, "ledger balance does not match the settled invoices of user %d", userId)
+}
+
 func createUsers(svc *service.LndhubService, usersToCreate int) (logins []ExpectedCreateUserResponseBody, tokens []string, err error) {
 	logins = []ExpectedCreateUserResponseBody{}
 	tokens = []string{}
@@ -0,0 +1,145 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type VerifyPaymentTestSuite struct {
+	TestSuite
+	mlnd                     *MockLND
+	externalLND              *MockLND
+	service                  *service.LndhubService
+	userTokens               []string
+	logins                   []ExpectedCreateUserResponseBody
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *VerifyPaymentTestSuite) SetupSuite() {
+	mlnd := newDefaultMockLND()
+	externalLND, err := NewMockLND("1234567890abcdefabcd", 0, make(chan (*lnrpc.Invoice)))
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	logins, userTokens, err := createUsers(svc, 2)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.mlnd = mlnd
+	suite.externalLND = externalLND
+	suite.service = svc
+	suite.userTokens = userTokens
+	suite.logins = logins
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	suite.echo.Use(tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+	suite.echo.POST("/addinvoice", controllers.NewAddInvoiceController(suite.service).AddInvoice)
+	suite.echo.POST("/payinvoice", controllers.NewPayInvoiceController(suite.service).PayInvoice)
+	suite.echo.POST("/v2/payments/verify", v2controllers.NewVerifyPaymentController(suite.service).VerifyPayment, tokens.RequireScope(common.ScopeRead))
+}
+
+func (suite *VerifyPaymentTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *VerifyPaymentTestSuite) verifyPayment(paymentHash, preimage, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(&v2controllers.VerifyPaymentRequestBody{
+		PaymentHash: paymentHash,
+		Preimage:    preimage,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v2/payments/verify", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *VerifyPaymentTestSuite) TestVerifyPayment() {
+	token := suite.userTokens[0]
+	invoiceResponse := suite.createAddInvoiceReq(1000, "integration test verify payment", token)
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(invoiceResponse, 0, false, nil))
+	time.Sleep(10 * time.Millisecond)
+
+	invoice, err := suite.externalLND.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:  "integration tests: verify payment",
+		Value: 500,
+	})
+	assert.NoError(suite.T(), err)
+	payResponse := suite.createPayInvoiceReq(&ExpectedPayInvoiceRequestBody{Invoice: invoice.PaymentRequest}, token)
+	assert.NotEmpty(suite.T(), payResponse.PaymentPreimage)
+	paymentHash := hex.EncodeToString(invoice.RHash)
+	payment, err := suite.service.FindInvoiceByPaymentHash(context.Background(), getUserIdFromToken(token), paymentHash)
+	assert.NoError(suite.T(), err)
+
+	rec := suite.verifyPayment(paymentHash, payment.Preimage, token)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response := &v2controllers.VerifyPaymentResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.True(suite.T(), response.Valid)
+
+	// verifying doesn't change anything, so read scoped tokens can do it
+	readToken, _, err := suite.service.GenerateScopedToken(context.Background(), suite.logins[0].Login, suite.logins[0].Password, "", []string{common.ScopeRead})
+	assert.NoError(suite.T(), err)
+	rec = suite.verifyPayment(paymentHash, payment.Preimage, readToken)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoiceToken, _, err := suite.service.GenerateScopedToken(context.Background(), suite.logins[0].Login, suite.logins[0].Password, "", []string{common.ScopeInvoice})
+	assert.NoError(suite.T(), err)
+	rec = suite.verifyPayment(paymentHash, payment.Preimage, invoiceToken)
+	assert.Equal(suite.T(), http.StatusForbidden, rec.Code)
+
+	// a wrong preimage is not a proof
+	rec = suite.verifyPayment(paymentHash, strings.Repeat("00", 32), token)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	response = &v2controllers.VerifyPaymentResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(response))
+	assert.False(suite.T(), response.Valid)
+
+	// only the payer can verify the payment
+	rec = suite.verifyPayment(paymentHash, payment.Preimage, suite.userTokens[1])
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+	// and incoming invoices are not payments
+	rec = suite.verifyPayment(invoiceResponse.RHash, strings.Repeat("00", 32), token)
+	assert.Equal(suite.T(), http.StatusNotFound, rec.Code)
+}
+
+func TestVerifyPaymentTestSuite(t *testing.T) {
+	suite.Run(t, new(VerifyPaymentTestSuite))
+}
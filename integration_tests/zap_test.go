@@ -0,0 +1,229 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/controllers"
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/nostr"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ZapTestSuite struct {
+	TestSuite
+	service                  *service.LndhubService
+	mlnd                     *MockLND
+	userLogin                ExpectedCreateUserResponseBody
+	userToken                string
+	relay                    *httptest.Server
+	receipts                 chan *nostr.Event
+	invoiceUpdateSubCancelFn context.CancelFunc
+}
+
+func (suite *ZapTestSuite) SetupSuite() {
+	// the relay accepts every event
+	suite.receipts = make(chan *nostr.Event, 10)
+	upgrader := websocket.Upgrader{}
+	suite.relay = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		event := &nostr.Event{}
+		message := []interface{}{new(string), event}
+		if err := conn.ReadJSON(&message); err != nil {
+			return
+		}
+		suite.receipts <- event
+		conn.WriteJSON([]interface{}{"OK", event.ID, true, ""})
+	}))
+	mlnd := newDefaultMockLND()
+	svc, err := LndHubTestServiceInit(mlnd)
+	if err != nil {
+		log.Fatalf("Error initializing test service: %v", err)
+	}
+	svc.Config.NostrPrivateKey = strings.Repeat("04", 32)
+	svc.Config.LNURLMinSendable = 1000
+	svc.Config.LNURLMaxSendable = 100000000
+	users, userTokens, err := createUsers(svc, 1)
+	if err != nil {
+		log.Fatalf("Error creating test users: %v", err)
+	}
+	// Subscribe to LND invoice updates in the background
+	// store cancel func to be called in tear down suite
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.invoiceUpdateSubCancelFn = cancel
+	go svc.InvoiceUpdateSubscription(ctx)
+	suite.service = svc
+	suite.mlnd = mlnd
+	suite.userLogin = users[0]
+	suite.userToken = userTokens[0]
+	e := echo.New()
+
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	suite.echo = e
+	lnurlPayCtrl := controllers.NewLNURLPayController(suite.service)
+	suite.echo.GET("/lnurlp/:user", lnurlPayCtrl.LNURLPay)
+	suite.echo.GET("/lnurlp/:user/callback", lnurlPayCtrl.LNURLPayCallback)
+	suite.echo.POST("/v2/invoices", v2controllers.NewInvoiceController(svc).AddInvoice, tokens.Middleware([]byte(suite.service.Config.JWTSecret)))
+}
+
+func (suite *ZapTestSuite) TearDownSuite() {
+	suite.invoiceUpdateSubCancelFn()
+	suite.relay.Close()
+	clearTable(suite.service, "invoices")
+	clearTable(suite.service, "transaction_entries")
+	clearTable(suite.service, "accounts")
+	clearTable(suite.service, "users")
+}
+
+func (suite *ZapTestSuite) zapRequest(amountMsat int64) string {
+	privateKey, err := nostr.ParsePrivateKey(strings.Repeat("05", 32))
+	assert.NoError(suite.T(), err)
+	event := &nostr.Event{
+		CreatedAt: time.Now().Unix(),
+		Kind:      nostr.KindZapRequest,
+		Tags: [][]string{
+			{"p", strings.Repeat("ab", 32)},
+			{"amount", fmt.Sprintf("%d", amountMsat)},
+			{"relays", "ws" + strings.TrimPrefix(suite.relay.URL, "http")},
+		},
+		Content: "zap from the integration test",
+	}
+	assert.NoError(suite.T(), event.Sign(privateKey))
+	zapRequest, err := json.Marshal(event)
+	assert.NoError(suite.T(), err)
+	return string(zapRequest)
+}
+
+func (suite *ZapTestSuite) addV2Invoice(body *v2controllers.AddInvoiceRequestBody) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	var buf bytes.Buffer
+	assert.NoError(suite.T(), json.NewEncoder(&buf).Encode(body))
+	req := httptest.NewRequest(http.MethodPost, "/v2/invoices", &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", suite.userToken))
+	suite.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func (suite *ZapTestSuite) assertZapReceipt(zapRequest, payReq string) {
+	select {
+	case receipt := <-suite.receipts:
+		assert.NoError(suite.T(), receipt.Verify())
+		nostrPubkey, err := suite.service.NostrPublicKey()
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), nostrPubkey, receipt.PubKey)
+		assert.Equal(suite.T(), nostr.KindZapReceipt, receipt.Kind)
+		assert.Equal(suite.T(), []string{"bolt11", payReq}, receipt.Tag("bolt11"))
+		assert.Equal(suite.T(), []string{"description", zapRequest}, receipt.Tag("description"))
+		assert.Equal(suite.T(), []string{"p", strings.Repeat("ab", 32)}, receipt.Tag("p"))
+	case <-time.After(5 * time.Second):
+		suite.T().Fatal("zap receipt was not published")
+	}
+}
+
+func (suite *ZapTestSuite) TestV2ZapInvoice() {
+	zapRequest := suite.zapRequest(21000)
+	rec := suite.addV2Invoice(&v2controllers.AddInvoiceRequestBody{Amount: 21, Nostr: zapRequest, ZapRequest: true})
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	invoice := &v2controllers.AddInvoiceResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(invoice))
+	// the invoice commits to the zap request
+	descriptionHash := sha256.Sum256([]byte(zapRequest))
+	assert.Equal(suite.T(), hex.EncodeToString(descriptionHash[:]), invoice.DescriptionHash)
+	stored, err := suite.service.FindInvoiceByPaymentHash(context.Background(), suite.userId(), invoice.PaymentHash)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), zapRequest, stored.ZapRequest)
+
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(&ExpectedAddInvoiceResponseBody{
+		RHash:  invoice.PaymentHash,
+		PayReq: invoice.PaymentRequest,
+	}, 0, false, nil))
+	suite.assertZapReceipt(zapRequest, invoice.PaymentRequest)
+}
+
+func (suite *ZapTestSuite) TestV2ZapInvoiceInvalid() {
+	zapRequest := suite.zapRequest(21000)
+	for _, body := range []*v2controllers.AddInvoiceRequestBody{
+		// the amount of the zap request does not match
+		{Amount: 10, Nostr: zapRequest, ZapRequest: true},
+		// the signature is invalid
+		{Amount: 21, Nostr: strings.Replace(zapRequest, "integration test", "other test", 1), ZapRequest: true},
+		{Amount: 21, ZapRequest: true},
+		{Amount: 21, Nostr: zapRequest},
+		{Amount: 21, Nostr: zapRequest, ZapRequest: true, DescriptionHash: strings.Repeat("ab", 32)},
+	} {
+		rec := suite.addV2Invoice(body)
+		assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+	}
+}
+
+func (suite *ZapTestSuite) TestLNURLPayZap() {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/lnurlp/"+suite.userLogin.Login, nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	lnurlPay := &controllers.LNURLPayResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(lnurlPay))
+	assert.True(suite.T(), lnurlPay.AllowsNostr)
+	nostrPubkey, err := suite.service.NostrPublicKey()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), nostrPubkey, lnurlPay.NostrPubkey)
+
+	zapRequest := suite.zapRequest(5000)
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlp/%s/callback?amount=5000&nostr=%s", suite.userLogin.Login, url.QueryEscape(zapRequest)), nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusOK, rec.Code)
+	callback := &controllers.LNURLPayCallbackResponseBody{}
+	assert.NoError(suite.T(), json.NewDecoder(rec.Body).Decode(callback))
+	decoded, err := suite.service.DecodePaymentRequest(context.Background(), callback.PaymentRequest)
+	assert.NoError(suite.T(), err)
+	descriptionHash := sha256.Sum256([]byte(zapRequest))
+	assert.Equal(suite.T(), hex.EncodeToString(descriptionHash[:]), decoded.DescriptionHash)
+
+	assert.NoError(suite.T(), suite.mlnd.mockPaidInvoice(&ExpectedAddInvoiceResponseBody{
+		RHash:  decoded.PaymentHash,
+		PayReq: callback.PaymentRequest,
+	}, 0, false, nil))
+	suite.assertZapReceipt(zapRequest, callback.PaymentRequest)
+
+	// a zap request with another amount is rejected
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/lnurlp/%s/callback?amount=6000&nostr=%s", suite.userLogin.Login, url.QueryEscape(zapRequest)), nil)
+	suite.echo.ServeHTTP(rec, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (suite *ZapTestSuite) userId() int64 {
+	user, err := suite.service.FindUserByLogin(context.Background(), suite.userLogin.Login)
+	assert.NoError(suite.T(), err)
+	return user.ID
+}
+
+func TestZapTestSuite(t *testing.T) {
+	suite.Run(t, new(ZapTestSuite))
+}
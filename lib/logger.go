@@ -1,27 +1,44 @@
 package lib
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/labstack/gommon/log"
+	"github.com/rs/zerolog"
 	"github.com/ziflex/lecho/v3"
 )
 
-func Logger(logFilePath string) *lecho.Logger {
-	logger := lecho.New(
-		os.Stdout, // default to STDOUT
-		lecho.WithLevel(log.DEBUG),
-		lecho.WithTimestamp(),
-	)
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Logger writes JSON logs, or human readable logs if the log format is "text"
+func Logger(logFilePath, logFormat string) *lecho.Logger {
+	var output io.Writer = os.Stdout // default to STDOUT
 	// check if a log file config is set
+	var fileErr error
 	if logFilePath != "" {
 		file, err := GetLoggingFile(logFilePath)
 		if err != nil {
-			logger.Errorf("failed to create logging file: %v", err)
+			fileErr = err
+		} else {
+			output = file
 		}
-		logger.SetOutput(file)
+	}
+	if logFormat == LogFormatText {
+		output = zerolog.ConsoleWriter{Out: output, NoColor: true, TimeFormat: time.RFC3339}
+	}
+	logger := lecho.New(
+		output,
+		lecho.WithLevel(log.DEBUG),
+		lecho.WithTimestamp(),
+	)
+	if fileErr != nil {
+		logger.Errorf("failed to create logging file: %v", fileErr)
 	}
 
 	return logger
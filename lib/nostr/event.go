@@ -0,0 +1,168 @@
+// Package nostr contains the parts of the Nostr protocol (NIP-01) that are needed for zaps:
+// signing and verifying events and publishing them to relays.
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+const (
+	KindZapRequest = 9734
+	KindZapReceipt = 9735
+)
+
+var ErrInvalidSignature = errors.New("invalid event signature")
+
+type Event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// Tag returns the first tag with the given name, e.g. ["p", <pubkey>]
+func (e *Event) Tag(name string) []string {
+	for _, tag := range e.Tags {
+		if len(tag) > 0 && tag[0] == name {
+			return tag
+		}
+	}
+	return nil
+}
+
+// TagValues returns the values of all tags with the given name
+func (e *Event) TagValues(name string) []string {
+	values := []string{}
+	for _, tag := range e.Tags {
+		if len(tag) > 1 && tag[0] == name {
+			values = append(values, tag[1])
+		}
+	}
+	return values
+}
+
+// Serialize returns the serialization of NIP-01 that is hashed to the event id
+func (e *Event) Serialize() []byte {
+	buf := []byte("[0,")
+	buf = appendString(buf, e.PubKey)
+	buf = append(buf, ',')
+	buf = strconv.AppendInt(buf, e.CreatedAt, 10)
+	buf = append(buf, ',')
+	buf = strconv.AppendInt(buf, int64(e.Kind), 10)
+	buf = append(buf, ",["...)
+	for i, tag := range e.Tags {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '[')
+		for j, value := range tag {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendString(buf, value)
+		}
+		buf = append(buf, ']')
+	}
+	buf = append(buf, "],"...)
+	buf = appendString(buf, e.Content)
+	return append(buf, ']')
+}
+
+// appendString escapes the string as required by NIP-01, all other characters are kept as they are
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			buf = append(buf, '\\', '"')
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		case '\f':
+			buf = append(buf, '\\', 'f')
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '"')
+}
+
+func (e *Event) hash() [32]byte {
+	return sha256.Sum256(e.Serialize())
+}
+
+// Sign sets the pubkey, the id and the signature of the event
+func (e *Event) Sign(privateKey *btcec.PrivateKey) error {
+	e.PubKey = PublicKey(privateKey)
+	hash := e.hash()
+	sig, err := schnorr.Sign(privateKey, hash[:])
+	if err != nil {
+		return err
+	}
+	e.ID = hex.EncodeToString(hash[:])
+	e.Sig = hex.EncodeToString(sig.Serialize())
+	return nil
+}
+
+// Verify checks that the id and the signature match the content of the event
+func (e *Event) Verify() error {
+	hash := e.hash()
+	if e.ID != hex.EncodeToString(hash[:]) {
+		return fmt.Errorf("%w: id does not match the event", ErrInvalidSignature)
+	}
+	pubkeyBytes, err := hex.DecodeString(e.PubKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	pubkey, err := schnorr.ParsePubKey(pubkeyBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	sigBytes, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !sig.Verify(hash[:], pubkey) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ParsePrivateKey parses a hex encoded private key
+func ParsePrivateKey(privateKeyHex string) (*btcec.PrivateKey, error) {
+	keyBytes, err := hex.DecodeString(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyBytes) != 32 {
+		return nil, errors.New("private key must be 32 bytes")
+	}
+	privateKey, _ := btcec.PrivKeyFromBytes(keyBytes)
+	return privateKey, nil
+}
+
+// PublicKey returns the hex encoded x-only public key that identifies the key on Nostr
+func PublicKey(privateKey *btcec.PrivateKey) string {
+	return hex.EncodeToString(schnorr.SerializePubKey(privateKey.PubKey()))
+}
@@ -0,0 +1,111 @@
+package nostr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(t *testing.T) *btcec.PrivateKey {
+	privateKey, err := ParsePrivateKey(strings.Repeat("01", 32))
+	assert.NoError(t, err)
+	return privateKey
+}
+
+func TestSerialize(t *testing.T) {
+	event := &Event{
+		PubKey:    "abcd",
+		CreatedAt: 1700000000,
+		Kind:      1,
+		Tags:      [][]string{{"p", "1234"}, {"relays", "wss://a", "wss://b"}},
+		Content:   "line\n\"quoted\" <tag> & \\",
+	}
+	// <, > and & are kept, json.Marshal would escape them
+	assert.Equal(t, `[0,"abcd",1700000000,1,[["p","1234"],["relays","wss://a","wss://b"]],"line\n\"quoted\" <tag> & \\"]`, string(event.Serialize()))
+
+	event.Tags = nil
+	assert.Equal(t, `[0,"abcd",1700000000,1,[],"line\n\"quoted\" <tag> & \\"]`, string(event.Serialize()))
+}
+
+func TestSignVerify(t *testing.T) {
+	event := &Event{
+		CreatedAt: time.Now().Unix(),
+		Kind:      KindZapRequest,
+		Tags:      [][]string{{"p", strings.Repeat("ab", 32)}},
+		Content:   "zap",
+	}
+	assert.NoError(t, event.Sign(testKey(t)))
+	assert.Equal(t, PublicKey(testKey(t)), event.PubKey)
+	assert.Len(t, event.ID, 64)
+	assert.Len(t, event.Sig, 128)
+	assert.NoError(t, event.Verify())
+
+	tampered := *event
+	tampered.Content = "other"
+	assert.ErrorIs(t, tampered.Verify(), ErrInvalidSignature)
+
+	// a matching id with the signature of another event
+	other := &Event{CreatedAt: event.CreatedAt, Kind: KindZapRequest, Content: "other"}
+	assert.NoError(t, other.Sign(testKey(t)))
+	other.Sig = event.Sig
+	assert.ErrorIs(t, other.Verify(), ErrInvalidSignature)
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	_, err := ParsePrivateKey("zz")
+	assert.Error(t, err)
+	_, err = ParsePrivateKey("0102")
+	assert.Error(t, err)
+}
+
+// newTestRelay answers every event with the result of accept
+func newTestRelay(t *testing.T, accept func(event *Event) (bool, string)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		message := []interface{}{}
+		event := &Event{}
+		message = append(message, new(string), event)
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Error(err)
+			return
+		}
+		accepted, reason := accept(event)
+		conn.WriteJSON([]interface{}{"NOTICE", "hello"})
+		conn.WriteJSON([]interface{}{"OK", event.ID, accepted, reason})
+	}))
+}
+
+func TestPublish(t *testing.T) {
+	event := &Event{CreatedAt: time.Now().Unix(), Kind: KindZapReceipt}
+	assert.NoError(t, event.Sign(testKey(t)))
+
+	received := make(chan *Event, 1)
+	relay := newTestRelay(t, func(e *Event) (bool, string) {
+		received <- e
+		return true, ""
+	})
+	defer relay.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, Publish(ctx, "ws"+strings.TrimPrefix(relay.URL, "http"), event))
+	assert.Equal(t, event, <-received)
+
+	rejecting := newTestRelay(t, func(e *Event) (bool, string) {
+		return false, "blocked: not allowed"
+	})
+	defer rejecting.Close()
+	err := Publish(ctx, "ws"+strings.TrimPrefix(rejecting.URL, "http"), event)
+	assert.ErrorContains(t, err, "blocked: not allowed")
+}
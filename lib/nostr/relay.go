@@ -0,0 +1,52 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// Publish sends the event to the relay and waits until the relay accepted it (NIP-20).
+// The context should have a deadline, it bounds the whole exchange with the relay.
+func Publish(ctx context.Context, relayUrl string, event *Event) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, relayUrl, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+		conn.SetWriteDeadline(deadline)
+	}
+	if err := conn.WriteJSON([]interface{}{"EVENT", event}); err != nil {
+		return err
+	}
+	for {
+		message := []json.RawMessage{}
+		if err := conn.ReadJSON(&message); err != nil {
+			return err
+		}
+		// relays can send other messages, e.g. a NOTICE, before they answer
+		var messageType, eventId string
+		if len(message) < 3 || json.Unmarshal(message[0], &messageType) != nil || messageType != "OK" {
+			continue
+		}
+		if json.Unmarshal(message[1], &eventId) != nil || eventId != event.ID {
+			continue
+		}
+		var accepted bool
+		if err := json.Unmarshal(message[2], &accepted); err != nil {
+			return err
+		}
+		if !accepted {
+			var reason string
+			if len(message) > 3 {
+				json.Unmarshal(message[3], &reason)
+			}
+			return fmt.Errorf("relay %s rejected the event: %s", relayUrl, reason)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const coinGeckoUrl = "https://api.coingecko.com"
+
+// CoinGecko fetches the prices from the simple price API of CoinGecko
+type CoinGecko struct {
+	BaseUrl string
+	Client  *http.Client
+}
+
+func NewCoinGecko() *CoinGecko {
+	return &CoinGecko{
+		BaseUrl: coinGeckoUrl,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (cg *CoinGecko) BTCPrice(ctx context.Context, currency string) (float64, error) {
+	currency = strings.ToLower(currency)
+	query := url.Values{"ids": {"bitcoin"}, "vs_currencies": {currency}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cg.BaseUrl+"/api/v3/simple/price?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := cg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("price request failed with status code %d", resp.StatusCode)
+	}
+	// {"bitcoin":{"usd":34512.1}}, unknown currencies are missing
+	prices := map[string]map[string]float64{}
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return 0, err
+	}
+	price, ok := prices["bitcoin"][currency]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	return price, nil
+}
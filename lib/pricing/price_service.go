@@ -0,0 +1,125 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fetchTimeout = 10 * time.Second
+
+// Rate is the price of one bitcoin in a currency
+type Rate struct {
+	Currency  string
+	Price     float64
+	FetchedAt time.Time
+	// the last refresh failed and the rate is older than the TTL
+	Stale bool
+}
+
+// Age is the time since the rate was fetched
+func (r Rate) Age() time.Duration {
+	return time.Since(r.FetchedAt)
+}
+
+// PriceService caches the rates of a provider. A currency is fetched on its first request and
+// then kept up to date by Refresh. When a refresh fails the last rate is still served and flagged as stale.
+// Unknown currencies are remembered for the TTL to not hit the rate limits of the provider.
+type PriceService struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu      sync.RWMutex
+	rates   map[string]Rate
+	unknown map[string]time.Time
+}
+
+func NewPriceService(provider Provider, ttl time.Duration) *PriceService {
+	return &PriceService{
+		provider: provider,
+		ttl:      ttl,
+		rates:    map[string]Rate{},
+		unknown:  map[string]time.Time{},
+	}
+}
+
+// TTL is the time after which a rate is stale, the rates should be refreshed more often
+func (ps *PriceService) TTL() time.Duration {
+	return ps.ttl
+}
+
+// Rate returns the current rate of the currency
+func (ps *PriceService) Rate(currency string) (Rate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	return ps.rate(ctx, currency)
+}
+
+// BTCPrice implements Provider with the cached rates
+func (ps *PriceService) BTCPrice(ctx context.Context, currency string) (float64, error) {
+	rate, err := ps.rate(ctx, currency)
+	if err != nil {
+		return 0, err
+	}
+	return rate.Price, nil
+}
+
+func (ps *PriceService) rate(ctx context.Context, currency string) (Rate, error) {
+	currency = strings.ToUpper(currency)
+	ps.mu.RLock()
+	rate, ok := ps.rates[currency]
+	unknownAt, unknown := ps.unknown[currency]
+	ps.mu.RUnlock()
+	if ok {
+		rate.Stale = rate.Age() > ps.ttl
+		return rate, nil
+	}
+	if unknown && time.Since(unknownAt) < ps.ttl {
+		return Rate{}, ErrUnknownCurrency
+	}
+	return ps.fetch(ctx, currency)
+}
+
+func (ps *PriceService) fetch(ctx context.Context, currency string) (Rate, error) {
+	price, err := ps.provider.BTCPrice(ctx, currency)
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if errors.Is(err, ErrUnknownCurrency) {
+		delete(ps.rates, currency)
+		ps.unknown[currency] = time.Now()
+		return Rate{}, err
+	}
+	if err != nil {
+		return Rate{}, err
+	}
+	delete(ps.unknown, currency)
+	rate := Rate{
+		Currency:  currency,
+		Price:     price,
+		FetchedAt: time.Now(),
+	}
+	ps.rates[currency] = rate
+	return rate, nil
+}
+
+// Refresh fetches the rates of all currencies that were requested before.
+// Failed currencies keep their last rate, the errors are returned together.
+func (ps *PriceService) Refresh(ctx context.Context) error {
+	ps.mu.RLock()
+	currencies := make([]string, 0, len(ps.rates))
+	for currency := range ps.rates {
+		currencies = append(currencies, currency)
+	}
+	ps.mu.RUnlock()
+
+	errs := []error{}
+	for _, currency := range currencies {
+		if _, err := ps.fetch(ctx, currency); err != nil {
+			errs = append(errs, fmt.Errorf("refreshing %s: %w", currency, err))
+		}
+	}
+	return errors.Join(errs...)
+}
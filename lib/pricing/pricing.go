@@ -0,0 +1,56 @@
+// Package pricing converts satoshi amounts to fiat currencies with the bitcoin price of a price source.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	ProviderCoinGecko = "coingecko"
+
+	satsPerBitcoin = 100_000_000
+)
+
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// Provider returns the price of one bitcoin, currencies are ISO 4217 codes like "USD"
+type Provider interface {
+	BTCPrice(ctx context.Context, currency string) (float64, error)
+}
+
+// NewProvider returns the provider of the given name, an empty name disables the conversion and returns nil
+func NewProvider(name string) (Provider, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case ProviderCoinGecko:
+		return NewCoinGecko(), nil
+	default:
+		return nil, fmt.Errorf("unknown price provider: %q", name)
+	}
+}
+
+// SatsToFiat converts the amount with the price of one bitcoin
+func SatsToFiat(sats int64, btcPrice float64) float64 {
+	return float64(sats) * btcPrice / satsPerBitcoin
+}
+
+// FiatToSats converts the fiat amount with the price of one bitcoin, rounded to the nearest satoshi
+func FiatToSats(fiatAmount float64, btcPrice float64) int64 {
+	return int64(math.Round(fiatAmount / btcPrice * satsPerBitcoin))
+}
+
+// Fixed returns the given prices, e.g. for tests
+type Fixed map[string]float64
+
+func (f Fixed) BTCPrice(ctx context.Context, currency string) (float64, error) {
+	price, ok := f[strings.ToUpper(currency)]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	return price, nil
+}
@@ -0,0 +1,147 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoinGecko(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/simple/price", r.URL.Path)
+		assert.Equal(t, "bitcoin", r.URL.Query().Get("ids"))
+		if r.URL.Query().Get("vs_currencies") == "usd" {
+			w.Write([]byte(`{"bitcoin":{"usd":34512.5}}`))
+			return
+		}
+		w.Write([]byte(`{"bitcoin":{}}`))
+	}))
+	defer server.Close()
+	cg := &CoinGecko{BaseUrl: server.URL, Client: server.Client()}
+
+	price, err := cg.BTCPrice(context.Background(), "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 34512.5, price)
+
+	_, err = cg.BTCPrice(context.Background(), "XYZ")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+type countingProvider struct {
+	calls atomic.Int32
+	price atomic.Int64
+	fail  atomic.Bool
+}
+
+func (p *countingProvider) BTCPrice(ctx context.Context, currency string) (float64, error) {
+	p.calls.Add(1)
+	if p.fail.Load() {
+		return 0, errors.New("rate limited")
+	}
+	if currency != "USD" {
+		return 0, ErrUnknownCurrency
+	}
+	return float64(p.price.Load()), nil
+}
+
+func TestPriceServiceCachesRates(t *testing.T) {
+	provider := &countingProvider{}
+	provider.price.Store(30000)
+	ps := NewPriceService(provider, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		rate, err := ps.Rate("usd")
+		assert.NoError(t, err)
+		assert.Equal(t, "USD", rate.Currency)
+		assert.Equal(t, 30000.0, rate.Price)
+		assert.False(t, rate.Stale)
+		_, err = ps.Rate("XYZ")
+		assert.ErrorIs(t, err, ErrUnknownCurrency)
+	}
+	assert.EqualValues(t, 2, provider.calls.Load())
+
+	price, err := ps.BTCPrice(context.Background(), "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 30000.0, price)
+	assert.EqualValues(t, 2, provider.calls.Load())
+}
+
+func TestPriceServiceRefresh(t *testing.T) {
+	provider := &countingProvider{}
+	provider.price.Store(30000)
+	ps := NewPriceService(provider, 50*time.Millisecond)
+	_, err := ps.Rate("USD")
+	assert.NoError(t, err)
+
+	// only the requested currencies are refreshed
+	provider.price.Store(31000)
+	assert.NoError(t, ps.Refresh(context.Background()))
+	assert.EqualValues(t, 2, provider.calls.Load())
+	rate, err := ps.Rate("USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 31000.0, rate.Price)
+
+	// a failed refresh keeps the last rate, which becomes stale after the TTL
+	provider.fail.Store(true)
+	assert.Error(t, ps.Refresh(context.Background()))
+	rate, err = ps.Rate("USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 31000.0, rate.Price)
+	assert.False(t, rate.Stale)
+	time.Sleep(60 * time.Millisecond)
+	rate, err = ps.Rate("USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 31000.0, rate.Price)
+	assert.True(t, rate.Stale)
+	assert.Greater(t, rate.Age(), 50*time.Millisecond)
+
+	provider.fail.Store(false)
+	assert.NoError(t, ps.Refresh(context.Background()))
+	rate, err = ps.Rate("USD")
+	assert.NoError(t, err)
+	assert.False(t, rate.Stale)
+}
+
+func TestPriceServiceFetchError(t *testing.T) {
+	provider := &countingProvider{}
+	provider.fail.Store(true)
+	ps := NewPriceService(provider, time.Minute)
+	_, err := ps.Rate("USD")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnknownCurrency)
+
+	// errors other than unknown currencies are not cached
+	provider.fail.Store(false)
+	provider.price.Store(30000)
+	rate, err := ps.Rate("USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 30000.0, rate.Price)
+}
+
+func TestSatsToFiat(t *testing.T) {
+	assert.Equal(t, 30.0, SatsToFiat(100_000, 30000))
+	assert.Equal(t, 0.0, SatsToFiat(0, 30000))
+}
+
+func TestFiatToSats(t *testing.T) {
+	assert.Equal(t, int64(100_000), FiatToSats(30, 30000))
+	assert.Equal(t, int64(33), FiatToSats(0.01, 30000))
+	assert.Equal(t, int64(0), FiatToSats(0.0001, 30000))
+}
+
+func TestNewProvider(t *testing.T) {
+	provider, err := NewProvider("")
+	assert.NoError(t, err)
+	assert.Nil(t, provider)
+	provider, err = NewProvider(ProviderCoinGecko)
+	assert.NoError(t, err)
+	assert.NotNil(t, provider)
+	_, err = NewProvider("unknown")
+	assert.Error(t, err)
+}
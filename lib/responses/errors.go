@@ -12,6 +12,8 @@ type ErrorResponse struct {
 	Error          bool   `json:"error"`
 	Code           int    `json:"code"`
 	Message        string `json:"message"`
+	RequestID      string `json:"request_id,omitempty"`
+	Retryable      *bool  `json:"retryable,omitempty"` // only set for failed payments
 	HttpStatusCode int    `json:"-"`
 }
 
@@ -50,6 +52,20 @@ var InvalidDestinationError = ErrorResponse{
 	HttpStatusCode: 400,
 }
 
+var InvalidCustomRecordError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "invalid custom record key. keys must be odd and in the custom record range",
+	HttpStatusCode: 400,
+}
+
+var InvalidCustomRecordValueError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "invalid custom record value. values must be hex encoded",
+	HttpStatusCode: 400,
+}
+
 var InvoiceExpiredError = ErrorResponse{
 	Error:          true,
 	Code:           2,
@@ -57,6 +73,20 @@ var InvoiceExpiredError = ErrorResponse{
 	HttpStatusCode: 400,
 }
 
+var InvoiceNotFoundError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "invoice not found",
+	HttpStatusCode: 404,
+}
+
+var PaymentNotFoundError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "payment not found",
+	HttpStatusCode: 404,
+}
+
 var NotEnoughBalanceError = ErrorResponse{
 	Error:          true,
 	Code:           2,
@@ -99,6 +129,160 @@ var AccountDeactivatedError = ErrorResponse{
 	HttpStatusCode: 401,
 }
 
+var AccountSuspendedError = ErrorResponse{
+	Error:          true,
+	Code:           1,
+	Message:        "account is suspended. please contact support for further assistance.",
+	HttpStatusCode: 403,
+}
+
+var SendingSuspendedError = ErrorResponse{
+	Error:          true,
+	Code:           1,
+	Message:        "sending payments is suspended for this account. please contact support for further assistance.",
+	HttpStatusCode: 403,
+}
+
+var PaymentTimeoutError = ErrorResponse{
+	Error:          true,
+	Code:           10,
+	Message:        "payment timed out. it is still pending, please check the payment status later.",
+	HttpStatusCode: 504,
+}
+
+var IdempotencyKeyConflictError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "idempotency key has already been used with a different request",
+	HttpStatusCode: 409,
+}
+
+var IdempotencyKeyInProgressError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "a payment with this idempotency key is still in progress",
+	HttpStatusCode: 409,
+}
+
+var ClientInvoiceIdConflictError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "client invoice id has already been used with a different amount or memo",
+	HttpStatusCode: 409,
+}
+
+var ClientInvoiceIdInProgressError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "an invoice with this client invoice id is still being created",
+	HttpStatusCode: 409,
+}
+
+var DailyLimitExceededError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "daily sending limit exceeded",
+	HttpStatusCode: 429,
+}
+
+var InvalidPreimageError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "preimage does not match the payment hash",
+	HttpStatusCode: 400,
+}
+
+var HoldInvoiceNotHeldError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "hold invoice is not held. it has not been paid yet or is already settled or canceled",
+	HttpStatusCode: 400,
+}
+
+var InsufficientScopeError = ErrorResponse{
+	Error:          true,
+	Code:           1,
+	Message:        "token does not have the scope required for this request",
+	HttpStatusCode: 403,
+}
+
+var RateLimitExceededError = ErrorResponse{
+	Error:          true,
+	Code:           11,
+	Message:        "too many requests, please try again later",
+	HttpStatusCode: 429,
+}
+
+var TooManyPendingInvoicesError = ErrorResponse{
+	Error:          true,
+	Code:           11,
+	Message:        "too many unpaid invoices, wait until they are paid or expired",
+	HttpStatusCode: 429,
+}
+
+var TooManyConnectionsError = ErrorResponse{
+	Error:          true,
+	Code:           11,
+	Message:        "too many open connections",
+	HttpStatusCode: 429,
+}
+
+var LightningAddressResolutionError = ErrorResponse{
+	Error:          true,
+	Code:           17,
+	Message:        "could not resolve the lightning address",
+	HttpStatusCode: 400,
+}
+
+var InvalidOnchainAddressError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "invalid on-chain address",
+	HttpStatusCode: 400,
+}
+
+var OnchainWithdrawalExceededError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "max on-chain withdrawal amount exceeded",
+	HttpStatusCode: 400,
+}
+
+var SelfPaymentError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "you can't pay your own invoice",
+	HttpStatusCode: 400,
+}
+
+var KeysendReceiveDisabledError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "keysend payments to this node are disabled",
+	HttpStatusCode: 400,
+}
+
+var KeysendAliasTakenError = ErrorResponse{
+	Error:          true,
+	Code:           2,
+	Message:        "keysend alias is already taken",
+	HttpStatusCode: 400,
+}
+
+var RequestTooLargeError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "request body is too large",
+	HttpStatusCode: 413,
+}
+
+var PriceUnavailableError = ErrorResponse{
+	Error:          true,
+	Code:           12,
+	Message:        "the bitcoin price is currently unavailable, please try again later",
+	HttpStatusCode: 503,
+}
+
 func HTTPErrorHandler(err error, c echo.Context) {
 	if c.Response().Committed {
 		return
@@ -119,3 +303,101 @@ func HTTPErrorHandler(err error, c echo.Context) {
 	}
 	// TODO: use an error matching the error code
 }
+
+var InviteCodeRequiredError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "an invite code is required to create an account",
+	HttpStatusCode: 400,
+}
+
+var InvalidInviteCodeError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "invalid invite code",
+	HttpStatusCode: 400,
+}
+
+var InviteCodeExhaustedError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "the invite code has been used up",
+	HttpStatusCode: 400,
+}
+
+var InviteCodeExpiredError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "the invite code has expired",
+	HttpStatusCode: 400,
+}
+
+var TOTPRequiredError = ErrorResponse{
+	Error:          true,
+	Code:           1,
+	Message:        "two-factor authentication is enabled, a totp_code is required",
+	HttpStatusCode: 403,
+}
+
+var InvalidTOTPCodeError = ErrorResponse{
+	Error:          true,
+	Code:           1,
+	Message:        "invalid or already used totp_code",
+	HttpStatusCode: 403,
+}
+
+var TOTPAlreadyEnabledError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "two-factor authentication is already enabled",
+	HttpStatusCode: 400,
+}
+
+var TOTPNotEnrolledError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "enroll for two-factor authentication first",
+	HttpStatusCode: 400,
+}
+
+var PaymentConfirmationNotFoundError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "confirmation_token not found or already used",
+	HttpStatusCode: 404,
+}
+
+var PaymentConfirmationExpiredError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "confirmation_token expired, send the payment again",
+	HttpStatusCode: 400,
+}
+
+var InsufficientInboundLiquidityError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "the node can't receive this amount right now, try a smaller amount",
+	HttpStatusCode: 400,
+}
+
+var InsufficientNodeLiquidityError = ErrorResponse{
+	Error:          true,
+	Code:           18,
+	Message:        "the node can't send this payment right now, please try again later",
+	HttpStatusCode: 503,
+}
+
+var InvoiceAmountTooHighError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "invoice amount exceeds the maximum invoice amount of this server",
+	HttpStatusCode: 400,
+}
+
+var AmountlessInvoiceNotAllowedError = ErrorResponse{
+	Error:          true,
+	Code:           8,
+	Message:        "invoices without an amount are not allowed on this server",
+	HttpStatusCode: 400,
+}
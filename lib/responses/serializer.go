@@ -0,0 +1,47 @@
+package responses
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// JSONSerializer adds the id of the request to the error responses,
+// so a failed request can be found in the logs
+type JSONSerializer struct {
+	echo.DefaultJSONSerializer
+}
+
+func (s JSONSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	if requestID != "" {
+		i = withRequestID(i, requestID)
+	}
+	return s.DefaultJSONSerializer.Serialize(c, i, indent)
+}
+
+func withRequestID(i interface{}, requestID string) interface{} {
+	// the error responses are shared variables, so they are copied instead of modified
+	switch v := i.(type) {
+	case ErrorResponse:
+		v.RequestID = requestID
+		return v
+	case *ErrorResponse:
+		if v == nil {
+			return i
+		}
+		resp := *v
+		resp.RequestID = requestID
+		return resp
+	case echo.Map:
+		if v["error"] != true {
+			return i
+		}
+		resp := echo.Map{"request_id": requestID}
+		for key, value := range v {
+			resp[key] = value
+		}
+		return resp
+	case map[string]interface{}:
+		return withRequestID(echo.Map(v), requestID)
+	}
+	return i
+}
@@ -0,0 +1,46 @@
+package responses
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSerializerAddsRequestID(t *testing.T) {
+	e := echo.New()
+	e.JSONSerializer = JSONSerializer{}
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		Generator: func() string { return "test-request-id" },
+	}))
+	e.GET("/error", func(c echo.Context) error {
+		return c.JSON(http.StatusBadRequest, &BadArgumentsError)
+	})
+	e.GET("/map", func(c echo.Context) error {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": true, "code": 10, "message": "failed"})
+	})
+	e.GET("/ok", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"balance": 100})
+	})
+
+	for _, path := range []string{"/error", "/map"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, "test-request-id", body["request_id"], path)
+		assert.Equal(t, true, body["error"], path)
+	}
+	// the shared error response is not modified
+	assert.Empty(t, BadArgumentsError.RequestID)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	body := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.NotContains(t, body, "request_id")
+}
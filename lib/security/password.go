@@ -4,10 +4,23 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword : Hash Password
-func HashPassword(password string) string {
-	bytes, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// HashPassword : Hash Password with the bcrypt cost, costs below bcrypt.MinCost use bcrypt.DefaultCost
+func HashPassword(password string, cost int) string {
+	bytes, _ := bcrypt.GenerateFromPassword([]byte(password), hashCost(cost))
 	password = string(bytes)
 
 	return password
 }
+
+// NeedsRehash returns if the bcrypt hash was made with another cost
+func NeedsRehash(hash string, cost int) bool {
+	hashedCost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && hashedCost != hashCost(cost)
+}
+
+func hashCost(cost int) int {
+	if cost < bcrypt.MinCost {
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
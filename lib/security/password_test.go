@@ -0,0 +1,20 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNeedsRehash(t *testing.T) {
+	hash := HashPassword("password", bcrypt.MinCost)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("password")))
+	assert.False(t, NeedsRehash(hash, bcrypt.MinCost))
+	assert.True(t, NeedsRehash(hash, bcrypt.MinCost+1))
+	// an unset cost is the default cost
+	assert.True(t, NeedsRehash(hash, 0))
+	assert.False(t, NeedsRehash(HashPassword("password", 0), bcrypt.DefaultCost))
+	// hashes that are not bcrypt hashes are left alone
+	assert.False(t, NeedsRehash("not a hash", bcrypt.MinCost))
+}
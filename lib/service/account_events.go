@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+)
+
+type streamConnections struct {
+	mu     sync.Mutex
+	byUser map[int64]int
+}
+
+// AcquireStreamConnection reserves one of the event stream connections of the user,
+// it returns false if the user already has WEBSOCKET_MAX_CONNECTIONS_PER_USER open connections
+func (svc *LndhubService) AcquireStreamConnection(userId int64) bool {
+	svc.streamConnections.mu.Lock()
+	defer svc.streamConnections.mu.Unlock()
+	if svc.streamConnections.byUser == nil {
+		svc.streamConnections.byUser = map[int64]int{}
+	}
+	if svc.streamConnections.byUser[userId] >= svc.Config.WebSocketMaxConnectionsPerUser {
+		return false
+	}
+	svc.streamConnections.byUser[userId]++
+	return true
+}
+
+func (svc *LndhubService) ReleaseStreamConnection(userId int64) {
+	svc.streamConnections.mu.Lock()
+	defer svc.streamConnections.mu.Unlock()
+	svc.streamConnections.byUser[userId]--
+	if svc.streamConnections.byUser[userId] <= 0 {
+		delete(svc.streamConnections.byUser, userId)
+	}
+}
+
+// SubscribeAccountEvents subscribes to the settled, sent and failed invoices of the user.
+// The returned function unsubscribes, the channel is closed afterwards.
+func (svc *LndhubService) SubscribeAccountEvents(userId int64) (chan models.Invoice, func(), error) {
+	topic := strconv.FormatInt(userId, 10)
+	invoices, subId, err := svc.InvoicePubSub.Subscribe(topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	unsubscribe := func() {
+		// keep receiving, a publisher waiting on a full channel would block the unsubscribe
+		go func() {
+			for range invoices {
+			}
+		}()
+		svc.InvoicePubSub.Unsubscribe(subId, topic)
+	}
+	return invoices, unsubscribe, nil
+}
+
+func (svc *LndhubService) publishAccountEvent(invoice models.Invoice) {
+	svc.InvoicePubSub.Publish(strconv.FormatInt(invoice.UserID, 10), invoice)
+}
+
+// AccountEventName returns the webhook event of an invoice published to the user topic
+func AccountEventName(invoice models.Invoice) string {
+	if invoice.Type == common.InvoiceTypeIncoming && invoice.State == common.InvoiceStateExpired {
+		return common.WebhookEventInvoiceExpired
+	}
+	if invoice.Type == common.InvoiceTypeIncoming {
+		return common.WebhookEventInvoiceSettled
+	}
+	if invoice.State == common.InvoiceStateError || invoice.State == common.InvoiceStateAborted {
+		return common.WebhookEventPaymentFailed
+	}
+	return common.WebhookEventPaymentSent
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/labstack/gommon/log"
+	"github.com/uptrace/bun"
+)
+
+// AdjustBalance credits (positive amount) or debits (negative amount) the balance of the user and stores who made the change and why.
+// The adjustment is booked on a settled invoice so that it shows up in the transactions of the user, the counterpart is the
+// adjustments account of the user, so adjustments are neither incoming payments nor fee revenue.
+// Debits that exceed the balance are rejected with ErrNotEnoughBalance unless force is set.
+func (svc *LndhubService) AdjustBalance(ctx context.Context, userId, amount int64, reason, admin string, force bool) (*models.BalanceAdjustment, error) {
+	if amount == 0 {
+		return nil, fmt.Errorf("adjustment amount must not be 0")
+	}
+	currentAccount, err := svc.AccountFor(ctx, common.AccountTypeCurrent, userId)
+	if err != nil {
+		return nil, err
+	}
+	adjustmentAccount, err := svc.AccountFor(ctx, common.AccountTypeAdjustments, userId)
+	if err != nil {
+		return nil, err
+	}
+	invoice := models.Invoice{
+		UserID:    userId,
+		Amount:    amount,
+		Memo:      fmt.Sprintf("admin adjustment: %s", reason),
+		State:     common.InvoiceStateSettled,
+		SettledAt: bun.NullTime{Time: time.Now()},
+	}
+	entry := models.TransactionEntry{
+		UserID:          userId,
+		CreditAccountID: currentAccount.ID,
+		Amount:          amount,
+		EntryType:       models.EntryTypeAdminAdjustment,
+	}
+	if amount > 0 {
+		invoice.Type = common.InvoiceTypeIncoming
+		entry.DebitAccountID = adjustmentAccount.ID
+	} else {
+		// the balance trigger doesn't check entries to the adjustments account, so forced debits can go below zero.
+		// The balance is checked below instead.
+		invoice.Type = common.InvoiceTypeOutgoing
+		invoice.Amount = -amount
+		entry.DebitAccountID = currentAccount.ID
+		entry.CreditAccountID = adjustmentAccount.ID
+		entry.Amount = -amount
+	}
+
+	tx, err := svc.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	balance, err := svc.lockedAccountBalance(ctx, tx, currentAccount.ID)
+	if err != nil {
+		return nil, err
+	}
+	if balance+amount < 0 && !force {
+		return nil, ErrNotEnoughBalance
+	}
+	if _, err := tx.NewInsert().Model(&invoice).Exec(ctx); err != nil {
+		return nil, err
+	}
+	entry.InvoiceID = invoice.ID
+	if _, err := tx.NewInsert().Model(&entry).Exec(ctx); err != nil {
+		return nil, err
+	}
+	adjustment := &models.BalanceAdjustment{
+		UserID:    userId,
+		InvoiceID: invoice.ID,
+		Amount:    amount,
+		Reason:    reason,
+		Admin:     admin,
+		Force:     force,
+	}
+	if _, err := tx.NewInsert().Model(adjustment).Exec(ctx); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	svc.Logger.Warnj(log.JSON{
+		"message":        "admin balance adjustment",
+		"lndhub_user_id": userId,
+		"amount":         amount,
+		"reason":         reason,
+		"admin":          admin,
+		"force":          force,
+		"balance":        balance + amount,
+		"adjustment_id":  adjustment.ID,
+	})
+	svc.publishAccountEvent(invoice)
+	return adjustment, nil
+}
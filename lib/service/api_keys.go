@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/tokens"
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+// apiKeyRouteScopes is the scope an API key needs for a route,
+// other GET routes need the read scope and all other routes a key without scopes
+var apiKeyRouteScopes = map[string]string{
+	"/addinvoice":                       common.ScopeInvoice,
+	"/v2/invoices":                      common.ScopeInvoice,
+	"/v2/invoices/batch":                common.ScopeInvoice,
+	"/v2/invoices/hold":                 common.ScopeInvoice,
+	"/v2/invoices/:payment_hash/settle": common.ScopeInvoice,
+	"/v2/invoices/:payment_hash/cancel": common.ScopeInvoice,
+	"/v2/onchain/address":               common.ScopeInvoice,
+	"/v2/offers":                        common.ScopeInvoice,
+	"/v2/payments/bolt11/estimate":      common.ScopeRead,
+	"/v2/payments/verify":               common.ScopeRead,
+	"/payinvoice":                       common.ScopePay,
+	"/keysend":                          common.ScopePay,
+	"/v2/payments/bolt11":               common.ScopePay,
+	"/v2/payments/bolt12":               common.ScopePay,
+	"/v2/payments/lnaddress":            common.ScopePay,
+	"/v2/payments/confirm":              common.ScopePay,
+	"/v2/payments/keysend":              common.ScopePay,
+	"/v2/payments/keysend/multi":        common.ScopePay,
+	"/v2/onchain/withdraw":              common.ScopePay,
+	"/v2/lnurlw":                        common.ScopePay,
+}
+
+// CreateApiKey creates a new API key for a user, the key itself is only returned here
+func (svc *LndhubService) CreateApiKey(ctx context.Context, userId int64, name string, scopes []string) (apiKey *models.ApiKey, key string, err error) {
+	keyBytes, err := randBytesFromStr(32, alphaNumBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	key = common.ApiKeyPrefix + string(keyBytes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	apiKey = &models.ApiKey{
+		UserID:  userId,
+		Name:    name,
+		KeyHash: hashApiKey(key),
+		Scopes:  scopes,
+	}
+	_, err = svc.DB.NewInsert().Model(apiKey).Exec(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return apiKey, key, nil
+}
+
+// FindApiKeys returns the API keys of a user that are not revoked
+func (svc *LndhubService) FindApiKeys(ctx context.Context, userId int64) ([]models.ApiKey, error) {
+	apiKeys := []models.ApiKey{}
+	err := svc.DB.NewSelect().Model(&apiKeys).Where("user_id = ?", userId).Where("revoked_at IS NULL").OrderExpr("id ASC").Scan(ctx)
+	return apiKeys, err
+}
+
+// RevokeApiKey revokes an API key of a user, sql.ErrNoRows is returned if there is no such key
+func (svc *LndhubService) RevokeApiKey(ctx context.Context, userId, id int64) error {
+	res, err := svc.DB.NewUpdate().
+		Model((*models.ApiKey)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("user_id = ?", userId).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AuthenticateApiKey looks up an API key that is not revoked and records that it was used
+// revokeAllApiKeys revokes all API keys of a user, e.g. when all tokens of the user are revoked
+func revokeAllApiKeys(ctx context.Context, db bun.IDB, userId int64) error {
+	_, err := db.NewUpdate().
+		Model((*models.ApiKey)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+func (svc *LndhubService) AuthenticateApiKey(ctx context.Context, key string) (*models.ApiKey, error) {
+	apiKey := models.ApiKey{}
+	err := svc.DB.NewSelect().Model(&apiKey).Where("key_hash = ?", hashApiKey(key)).Where("revoked_at IS NULL").Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	apiKey.LastUsedAt = bun.NullTime{Time: time.Now()}
+	_, err = svc.DB.NewUpdate().Model(&apiKey).Column("last_used_at").WherePK().Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// ApiKeyMiddleware authenticates requests with an `Authorization: Bearer tahub_...` API key.
+// It must be used before the JWT middleware, which skips the requests authenticated here.
+func (svc *LndhubService) ApiKeyMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !strings.HasPrefix(key, common.ApiKeyPrefix) {
+				return next(c)
+			}
+			apiKey, err := svc.AuthenticateApiKey(c.Request().Context(), key)
+			if err != nil {
+				c.Logger().Errorf("Invalid API key: %v", err)
+				return c.JSON(http.StatusUnauthorized, responses.BadAuthError)
+			}
+			if !tokens.HasScope(apiKey.Scopes, requiredApiKeyScope(c)) {
+				c.Logger().Errorf("API key is missing the scope for %s %s user_id:%v api_key_id:%v", c.Request().Method, c.Path(), apiKey.UserID, apiKey.ID)
+				return c.JSON(http.StatusForbidden, responses.InsufficientScopeError)
+			}
+			tenantID, err := svc.userTenant(c.Request().Context(), apiKey.UserID)
+			if err != nil {
+				c.Logger().Errorf("Failed to load the tenant user_id:%v api_key_id:%v error: %v", apiKey.UserID, apiKey.ID, err)
+				return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+			}
+			c.Set("UserID", apiKey.UserID)
+			c.Set("ApiKeyID", apiKey.ID)
+			c.Set("Scopes", apiKey.Scopes)
+			c.Set("TenantID", tenantID)
+			return next(c)
+		}
+	}
+}
+
+// requiredApiKeyScope returns the scope needed for the route of the request, an empty scope needs a key without scopes
+func requiredApiKeyScope(c echo.Context) string {
+	if scope, ok := apiKeyRouteScopes[c.Path()]; ok {
+		return scope
+	}
+	if c.Request().Method == http.MethodGet {
+		return common.ScopeRead
+	}
+	return ""
+}
+
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredApiKeyScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		scope  string
+	}{
+		{http.MethodGet, "/v2/balance", common.ScopeRead},
+		{http.MethodPost, "/v2/payments/bolt11/estimate", common.ScopeRead},
+		{http.MethodPost, "/v2/payments/verify", common.ScopeRead},
+		{http.MethodPost, "/v2/invoices", common.ScopeInvoice},
+		{http.MethodPost, "/v2/invoices/batch", common.ScopeInvoice},
+		{http.MethodGet, "/v2/onchain/address", common.ScopeInvoice},
+		{http.MethodGet, "/v2/offers", common.ScopeInvoice},
+		{http.MethodPost, "/v2/payments/bolt11", common.ScopePay},
+		{http.MethodPost, "/v2/payments/bolt12", common.ScopePay},
+		{http.MethodPost, "/v2/payments/lnaddress", common.ScopePay},
+		{http.MethodPost, "/v2/payments/confirm", common.ScopePay},
+		{http.MethodPost, "/v2/onchain/withdraw", common.ScopePay},
+		{http.MethodPost, "/v2/webhooks", ""},
+	}
+	e := echo.New()
+	for _, tt := range tests {
+		c := e.NewContext(httptest.NewRequest(tt.method, tt.path, nil), httptest.NewRecorder())
+		c.SetPath(tt.path)
+		assert.Equal(t, tt.scope, requiredApiKeyScope(c), tt.path)
+	}
+}
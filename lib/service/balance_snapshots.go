@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/gommon/log"
+)
+
+// StartBalanceSnapshotRoutine records the balances of all active users every BalanceSnapshotInterval seconds
+func (svc *LndhubService) StartBalanceSnapshotRoutine(ctx context.Context) (err error) {
+	ticker := time.NewTicker(time.Duration(svc.Config.BalanceSnapshotInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err = svc.CreateBalanceSnapshots(ctx)
+			if err != nil && ctx.Err() == nil {
+				// try again at the next tick
+				svc.Logger.Errorf("Failed to create balance snapshots: %v", err)
+				sentry.CaptureException(err)
+			}
+		}
+	}
+}
+
+// CreateBalanceSnapshots records the current balance of every user that is not deactivated
+func (svc *LndhubService) CreateBalanceSnapshots(ctx context.Context) error {
+	userIds := []int64{}
+	err := svc.DB.NewSelect().Model((*models.User)(nil)).Column("id").Where("deactivated = ?", false).Scan(ctx, &userIds)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now()
+	for _, userId := range userIds {
+		balance, err := svc.CurrentUserBalance(ctx, userId)
+		if err != nil {
+			svc.Logger.Errorj(
+				log.JSON{
+					"message":        "failed to retrieve user balance",
+					"lndhub_user_id": userId,
+					"error":          err,
+				},
+			)
+			return err
+		}
+		snapshot := models.BalanceSnapshot{
+			UserID:    userId,
+			Balance:   balance,
+			Timestamp: timestamp,
+		}
+		_, err = svc.DB.NewInsert().Model(&snapshot).Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	svc.Logger.Infof("Created %d balance snapshots", len(userIds))
+	return nil
+}
+
+// GetBalanceSnapshots returns the balance snapshots of the user between from and to, oldest first. Zero times don't limit the range.
+func (svc *LndhubService) GetBalanceSnapshots(ctx context.Context, userId int64, from, to time.Time) ([]models.BalanceSnapshot, error) {
+	snapshots := []models.BalanceSnapshot{}
+	query := svc.DB.NewSelect().Model(&snapshots).Where("user_id = ?", userId)
+	if !from.IsZero() {
+		query.Where("timestamp >= ?", from)
+	}
+	if !to.IsZero() {
+		query.Where("timestamp <= ?", to)
+	}
+	err := query.OrderExpr("timestamp ASC").Scan(ctx)
+	return snapshots, err
+}
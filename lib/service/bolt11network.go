@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrPaymentRequestWrongNetwork = errors.New("invoice not for current active network")
+
+// the networks of the currency prefixes of bolt11 invoices
+var bolt11Networks = map[string]string{
+	"bc":   "mainnet",
+	"tb":   "testnet",
+	"tbs":  "signet",
+	"bcrt": "regtest",
+	"sb":   "simnet",
+}
+
+// bolt11Network returns the network of the currency prefix of the invoice, e.g. mainnet for lnbc
+func bolt11Network(bolt11 string) (string, bool) {
+	bolt11 = strings.ToLower(bolt11)
+	separator := strings.LastIndex(bolt11, "1")
+	if separator < 2 || !strings.HasPrefix(bolt11, "ln") {
+		return "", false
+	}
+	// the currency is followed by the optional amount, which starts with a digit
+	currency := bolt11[2:separator]
+	if end := strings.IndexAny(currency, "0123456789"); end >= 0 {
+		currency = currency[:end]
+	}
+	network, ok := bolt11Networks[currency]
+	return network, ok
+}
+
+// CheckPaymentRequestNetwork makes sure that the invoice is for the network of the node.
+// Invoices with an unknown prefix and nodes that don't report their network are left to the node to decode.
+func (svc *LndhubService) CheckPaymentRequestNetwork(ctx context.Context, bolt11 string) error {
+	invoiceNetwork, ok := bolt11Network(bolt11)
+	if !ok {
+		return nil
+	}
+	nodeNetwork, err := svc.NodeNetwork(ctx)
+	if err != nil {
+		return nil
+	}
+	if invoiceNetwork != nodeNetwork {
+		return fmt.Errorf("%w: invoice is for %s, node is on %s", ErrPaymentRequestWrongNetwork, invoiceNetwork, nodeNetwork)
+	}
+	return nil
+}
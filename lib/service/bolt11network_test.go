@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBolt11Network(t *testing.T) {
+	tests := []struct {
+		bolt11  string
+		network string
+	}{
+		{"lnbc10u1pjexample", "mainnet"},
+		{"lnbc1pjexample", "mainnet"},
+		{"LNBC2500U1PJEXAMPLE", "mainnet"},
+		{"lntb1m1pjexample", "testnet"},
+		{"lntbs100n1pjexample", "signet"},
+		{"lnbcrt500u1pjexample", "regtest"},
+		{"lnbcrt1pjexample", "regtest"},
+		{"lnsb1pjexample", "simnet"},
+	}
+	for _, tt := range tests {
+		network, ok := bolt11Network(tt.bolt11)
+		assert.True(t, ok, tt.bolt11)
+		assert.Equal(t, tt.network, network, tt.bolt11)
+	}
+	for _, bolt11 := range []string{"", "lnbc", "lnxy1pjexample", "bc1qexample", "lnurl1dp68gurn"} {
+		_, ok := bolt11Network(bolt11)
+		assert.False(t, ok, bolt11)
+	}
+}
+
+func TestCheckPaymentRequestNetwork(t *testing.T) {
+	invoices := map[string]string{
+		"mainnet": "lnbc10u1pjexample",
+		"testnet": "lntb10u1pjexample",
+		"signet":  "lntbs10u1pjexample",
+		"regtest": "lnbcrt10u1pjexample",
+	}
+	for nodeNetwork := range invoices {
+		mock := &testutils.MockLightningClient{
+			GetInfoFunc: func(ctx context.Context, req *lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+				return &lnrpc.GetInfoResponse{Chains: []*lnrpc.Chain{{Chain: "bitcoin", Network: nodeNetwork}}}, nil
+			},
+		}
+		networkSvc := &LndhubService{LndClient: mock}
+		for invoiceNetwork, bolt11 := range invoices {
+			err := networkSvc.CheckPaymentRequestNetwork(context.Background(), bolt11)
+			if invoiceNetwork == nodeNetwork {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrPaymentRequestWrongNetwork, "%s invoice on a %s node", invoiceNetwork, nodeNetwork)
+			}
+		}
+		// the network is only looked up once
+		assert.Equal(t, 1, mock.Calls("GetInfo"))
+	}
+}
+
+func TestCheckPaymentRequestNetworkUnknown(t *testing.T) {
+	mock := &testutils.MockLightningClient{
+		GetInfoFunc: func(ctx context.Context, req *lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+			return nil, errors.New("node unavailable")
+		},
+	}
+	networkSvc := &LndhubService{LndClient: mock}
+	// the node decides if it can't tell its network
+	assert.NoError(t, networkSvc.CheckPaymentRequestNetwork(context.Background(), "lntb10u1pjexample"))
+	// unknown prefixes are not checked
+	assert.NoError(t, networkSvc.CheckPaymentRequestNetwork(context.Background(), "lnxy10u1pjexample"))
+	assert.Equal(t, 1, mock.Calls("GetInfo"))
+}
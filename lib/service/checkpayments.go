@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/getAlby/lndhub.go/common"
 	"github.com/getAlby/lndhub.go/db/models"
 	"github.com/getsentry/sentry-go"
 	"github.com/lightningnetwork/lnd/lnrpc"
@@ -19,7 +20,7 @@ func (svc *LndhubService) GetPendingPaymentsUntil(ctx context.Context, ts time.T
 	payments := []models.Invoice{}
 	err := svc.DB.NewSelect().
 		Model(&payments).
-		Where("state = 'initialized'").
+		Where("state IN ('initialized', 'pending')").
 		Where("type = 'outgoing'").
 		Where("r_hash != ''").
 		Where("created_at >= (now() - interval '2 weeks') ").
@@ -30,9 +31,95 @@ func (svc *LndhubService) GetPendingPaymentsUntil(ctx context.Context, ts time.T
 
 func (svc *LndhubService) GetAllPendingPayments(ctx context.Context) ([]models.Invoice, error) {
 	payments := []models.Invoice{}
-	err := svc.DB.NewSelect().Model(&payments).Where("state = 'initialized'").Where("type = 'outgoing'").Where("r_hash != ''").Where("created_at >= (now() - interval '2 weeks') ").Scan(ctx)
+	err := svc.DB.NewSelect().Model(&payments).Where("state IN ('initialized', 'pending')").Where("type = 'outgoing'").Where("r_hash != ''").Where("created_at >= (now() - interval '2 weeks') ").Scan(ctx)
 	return payments, err
 }
+
+// CountPendingPayments returns the number of outgoing payments of a user whose outcome is not known yet
+func (svc *LndhubService) CountPendingPayments(ctx context.Context, userId int64) (int, error) {
+	return svc.DB.NewSelect().
+		Model((*models.Invoice)(nil)).
+		Where("user_id = ?", userId).
+		Where("state IN (?, ?)", common.InvoiceStateInitialized, common.InvoiceStatePending).
+		Where("type = ?", common.InvoiceTypeOutgoing).
+		Count(ctx)
+}
+
+// GetOutgoingPaymentsPaged returns up to limit outgoing payments of the user in the state with an id lower than the cursor, newest first.
+// Pending payments are the initialized and pending ones, the same as for CountPendingPayments and the reconciliation.
+// An empty state returns the payments in all states. nextCursor is 0 if there are no more results.
+func (svc *LndhubService) GetOutgoingPaymentsPaged(ctx context.Context, userId int64, state string, limit int, cursor int64) (payments []models.Invoice, nextCursor int64, err error) {
+	payments = []models.Invoice{}
+
+	query := svc.DB.NewSelect().Model(&payments).
+		Where("user_id = ?", userId).
+		Where("type = ?", common.InvoiceTypeOutgoing)
+	switch state {
+	case TransactionStatePending:
+		query.Where("state IN (?, ?)", common.InvoiceStateInitialized, common.InvoiceStatePending)
+	case TransactionStateSettled:
+		query.Where("state = ?", common.InvoiceStateSettled)
+	case TransactionStateFailed:
+		query.Where("state = ?", common.InvoiceStateError)
+	}
+	if cursor > 0 {
+		query.Where("id < ?", cursor)
+	}
+	// fetch one more row to know if there is a next page
+	err = query.OrderExpr("id DESC").Limit(limit + 1).Scan(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(payments) > limit {
+		payments = payments[:limit]
+		nextCursor = payments[limit-1].ID
+	}
+	return payments, nextCursor, nil
+}
+
+// StartPendingPaymentReconciliation looks up the final state of all pending outgoing payments every PendingPaymentReconcileInterval seconds
+func (svc *LndhubService) StartPendingPaymentReconciliation(ctx context.Context) (err error) {
+	ticker := time.NewTicker(time.Duration(svc.Config.PendingPaymentReconcileInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err = svc.ReconcilePendingPayments(ctx)
+			if err != nil && ctx.Err() == nil {
+				// try again at the next tick
+				svc.Logger.Errorf("Failed to reconcile pending payments: %v", err)
+				sentry.CaptureException(err)
+			}
+		}
+	}
+}
+
+// ReconcilePendingPayments spawns a payment tracker for every pending payment that is not tracked yet.
+// The reserved amount is only credited back once LND reports the payment as failed.
+func (svc *LndhubService) ReconcilePendingPayments(ctx context.Context) error {
+	pending := []models.Invoice{}
+	err := svc.DB.NewSelect().
+		Model(&pending).
+		Where("state = ?", common.InvoiceStatePending).
+		Where("type = ?", common.InvoiceTypeOutgoing).
+		Where("r_hash != ''").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, inv := range pending {
+		inv := inv
+		if _, tracked := svc.trackedPayments.Load(inv.ID); tracked {
+			continue
+		}
+		svc.Logger.Infof("Spawning tracker for pending payment with hash %s", inv.RHash)
+		go svc.TrackOutgoingPaymentstatus(ctx, &inv)
+	}
+	return nil
+}
+
 func (svc *LndhubService) CheckPendingOutgoingPayments(ctx context.Context, pendingPayments []models.Invoice) (err error) {
 	//call trackoutgoingpaymentstatus for each one
 	var wg sync.WaitGroup
@@ -79,6 +166,12 @@ func (svc *LndhubService) GetTransactionEntryByInvoiceId(ctx context.Context, id
 
 // Should be called in a goroutine as the tracking can potentially take a long time
 func (svc *LndhubService) TrackOutgoingPaymentstatus(ctx context.Context, invoice *models.Invoice) {
+	// only one tracker per payment, the payment would otherwise be handled twice
+	if _, tracked := svc.trackedPayments.LoadOrStore(invoice.ID, true); tracked {
+		svc.Logger.Infof("Payment %s is already being tracked", invoice.RHash)
+		return
+	}
+	defer svc.trackedPayments.Delete(invoice.ID)
 	//ask lnd using TrackPaymentV2 by hash of payment
 	rawHash, err := hex.DecodeString(invoice.RHash)
 	if err != nil {
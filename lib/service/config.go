@@ -2,52 +2,240 @@ package service
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	DatabaseUri                      string  `envconfig:"DATABASE_URI" required:"true"`
-	DatabaseMaxConns                 int     `envconfig:"DATABASE_MAX_CONNS" default:"10"`
-	DatabaseMaxIdleConns             int     `envconfig:"DATABASE_MAX_IDLE_CONNS" default:"5"`
-	DatabaseConnMaxLifetime          int     `envconfig:"DATABASE_CONN_MAX_LIFETIME" default:"1800"` // 30 minutes
-	DatabaseTimeout                  int     `envconfig:"DATABASE_TIMEOUT" default:"60"`             // 60 seconds
-	SentryDSN                        string  `envconfig:"SENTRY_DSN"`
-	DatadogAgentUrl                  string  `envconfig:"DATADOG_AGENT_URL"`
-	SentryTracesSampleRate           float64 `envconfig:"SENTRY_TRACES_SAMPLE_RATE"`
-	LogFilePath                      string  `envconfig:"LOG_FILE_PATH"`
-	JWTSecret                        []byte  `envconfig:"JWT_SECRET" required:"true"`
-	AdminToken                       string  `envconfig:"ADMIN_TOKEN"`
-	JWTRefreshTokenExpiry            int     `envconfig:"JWT_REFRESH_EXPIRY" default:"604800"` // in seconds, default 7 days
-	JWTAccessTokenExpiry             int     `envconfig:"JWT_ACCESS_EXPIRY" default:"172800"`  // in seconds, default 2 days
-	CustomName                       string  `envconfig:"CUSTOM_NAME"`
-	Host                             string  `envconfig:"HOST" default:"localhost:3000"`
-	Port                             int     `envconfig:"PORT" default:"3000"`
-	EnableGRPC                       bool    `envconfig:"ENABLE_GRPC" default:"false"`
-	GRPCPort                         int     `envconfig:"GRPC_PORT" default:"10009"`
-	DefaultRateLimit                 int     `envconfig:"DEFAULT_RATE_LIMIT" default:"10"`
-	StrictRateLimit                  int     `envconfig:"STRICT_RATE_LIMIT" default:"10"`
-	BurstRateLimit                   int     `envconfig:"BURST_RATE_LIMIT" default:"1"`
-	EnablePrometheus                 bool    `envconfig:"ENABLE_PROMETHEUS" default:"false"`
-	PrometheusPort                   int     `envconfig:"PROMETHEUS_PORT" default:"9092"`
-	WebhookUrl                       string  `envconfig:"WEBHOOK_URL"`
-	FeeReserve                       bool    `envconfig:"FEE_RESERVE" default:"false"`
-	AllowAccountCreation             bool    `envconfig:"ALLOW_ACCOUNT_CREATION" default:"true"`
-	MinPasswordEntropy               int     `envconfig:"MIN_PASSWORD_ENTROPY" default:"0"`
-	MaxReceiveAmount                 int64   `envconfig:"MAX_RECEIVE_AMOUNT" default:"0"`
-	MaxSendAmount                    int64   `envconfig:"MAX_SEND_AMOUNT" default:"0"`
-	MaxAccountBalance                int64   `envconfig:"MAX_ACCOUNT_BALANCE" default:"0"`
-	MaxFeeAmount                     int64   `envconfig:"MAX_FEE_AMOUNT" default:"5000"`
-	MaxSendVolume                    int64   `envconfig:"MAX_SEND_VOLUME" default:"0"`         //0 means the volume check is disabled by default
-	MaxReceiveVolume                 int64   `envconfig:"MAX_RECEIVE_VOLUME" default:"0"`      //0 means the volume check is disabled by default
-	MaxVolumePeriod                  int64   `envconfig:"MAX_VOLUME_PERIOD" default:"2592000"` //in seconds, default 1 month
-	RabbitMQUri                      string  `envconfig:"RABBITMQ_URI"`
-	RabbitMQLndhubInvoiceExchange    string  `envconfig:"RABBITMQ_INVOICE_EXCHANGE" default:"lndhub_invoice"`
-	RabbitMQLndInvoiceExchange       string  `envconfig:"RABBITMQ_LND_INVOICE_EXCHANGE" default:"lnd_invoice"`
-	RabbitMQLndPaymentExchange       string  `envconfig:"RABBITMQ_LND_PAYMENT_EXCHANGE" default:"lnd_payment"`
-	RabbitMQInvoiceConsumerQueueName string  `envconfig:"RABBITMQ_INVOICE_CONSUMER_QUEUE_NAME" default:"lnd_invoice_consumer"`
-	RabbitMQPaymentConsumerQueueName string  `envconfig:"RABBITMQ_PAYMENT_CONSUMER_QUEUE_NAME" default:"lnd_payment_consumer"`
+	DatabaseUri                      string             `envconfig:"DATABASE_URI" required:"true"`
+	DatabaseMaxConns                 int                `envconfig:"DATABASE_MAX_CONNS" default:"10"`
+	DatabaseMaxIdleConns             int                `envconfig:"DATABASE_MAX_IDLE_CONNS" default:"5"`
+	DatabaseConnMaxLifetime          int                `envconfig:"DATABASE_CONN_MAX_LIFETIME" default:"1800"` // 30 minutes
+	DatabaseTimeout                  int                `envconfig:"DATABASE_TIMEOUT" default:"60"`             // 60 seconds
+	DatabaseRetries                  int                `envconfig:"DATABASE_RETRIES" default:"2"`
+	SentryDSN                        string             `envconfig:"SENTRY_DSN"`
+	DatadogAgentUrl                  string             `envconfig:"DATADOG_AGENT_URL"`
+	SentryTracesSampleRate           float64            `envconfig:"SENTRY_TRACES_SAMPLE_RATE"`
+	LogFilePath                      string             `envconfig:"LOG_FILE_PATH"`
+	LogFormat                        string             `envconfig:"LOG_FORMAT" default:"json"` // json or text
+	LogRedactPaymentRequests         bool               `envconfig:"LOG_REDACT_PAYMENT_REQUESTS" default:"false"`
+	JWTSecret                        []byte             `envconfig:"JWT_SECRET" required:"true"`
+	AdminToken                       string             `envconfig:"ADMIN_TOKEN"`
+	AdminTokens                      map[string]string  `envconfig:"ADMIN_TOKENS"`                        // name:token pairs of single admins
+	JWTRefreshTokenExpiry            int                `envconfig:"JWT_REFRESH_EXPIRY" default:"604800"` // in seconds, default 7 days
+	JWTAccessTokenExpiry             int                `envconfig:"JWT_ACCESS_EXPIRY" default:"172800"`  // in seconds, default 2 days
+	CustomName                       string             `envconfig:"CUSTOM_NAME"`
+	Host                             string             `envconfig:"HOST" default:"localhost:3000"`
+	Port                             int                `envconfig:"PORT" default:"3000"`
+	EnableGRPC                       bool               `envconfig:"ENABLE_GRPC" default:"false"`
+	GRPCPort                         int                `envconfig:"GRPC_PORT" default:"10009"`
+	DefaultRateLimit                 int                `envconfig:"DEFAULT_RATE_LIMIT" default:"10"`
+	StrictRateLimit                  int                `envconfig:"STRICT_RATE_LIMIT" default:"10"`
+	BurstRateLimit                   int                `envconfig:"BURST_RATE_LIMIT" default:"1"`
+	UserRateLimit                    float64            `envconfig:"USER_RATE_LIMIT" default:"10"` // requests per second of an authenticated user
+	UserBurstRateLimit               int                `envconfig:"USER_BURST_RATE_LIMIT" default:"20"`
+	AuthRateLimit                    float64            `envconfig:"AUTH_RATE_LIMIT" default:"0.2"` // requests per second of an IP to /auth
+	AuthBurstRateLimit               int                `envconfig:"AUTH_BURST_RATE_LIMIT" default:"5"`
+	RateLimitOverrides               RateLimitOverrides `envconfig:"RATE_LIMIT_OVERRIDES"`
+	EnablePrometheus                 bool               `envconfig:"ENABLE_PROMETHEUS" default:"false"`
+	PrometheusPort                   int                `envconfig:"PROMETHEUS_PORT" default:"9092"`
+	WebhookUrl                       string             `envconfig:"WEBHOOK_URL"`
+	UserWebhookMaxRetries            int                `envconfig:"USER_WEBHOOK_MAX_RETRIES" default:"5"`
+	UserWebhookRetryDelay            int64              `envconfig:"USER_WEBHOOK_RETRY_DELAY" default:"1"` //in seconds, doubled after every failed delivery
+	WebSocketMaxConnectionsPerUser   int                `envconfig:"WEBSOCKET_MAX_CONNECTIONS_PER_USER" default:"5"`
+	MaxBatchBalanceIds               int                `envconfig:"MAX_BATCH_BALANCE_IDS" default:"100"`
+	EnableOnchainDeposits            bool               `envconfig:"ENABLE_ONCHAIN_DEPOSITS" default:"false"`
+	EnableOffers                     bool               `envconfig:"ENABLE_OFFERS" default:"false"` // bolt12 offers, only supported by Core Lightning
+	OnchainMinConfirmations          int32              `envconfig:"ONCHAIN_MIN_CONFIRMATIONS" default:"3"`
+	OnchainDepositFee                int64              `envconfig:"ONCHAIN_DEPOSIT_FEE" default:"0"`
+	OnchainDepositCheckInterval      int64              `envconfig:"ONCHAIN_DEPOSIT_CHECK_INTERVAL" default:"60"`
+	EnableOnchainWithdrawals         bool               `envconfig:"ENABLE_ONCHAIN_WITHDRAWALS" default:"false"`
+	MaxOnchainWithdrawal             int64              `envconfig:"MAX_ONCHAIN_WITHDRAWAL" default:"0"`
+	OnchainWithdrawalTargetConf      int32              `envconfig:"ONCHAIN_WITHDRAWAL_TARGET_CONF" default:"6"`
+	PriceProvider                    string             `envconfig:"PRICE_PROVIDER"`
+	PriceCacheTTL                    int64              `envconfig:"PRICE_CACHE_TTL" default:"60"` //in seconds
+	MaxPriceAge                      int64              `envconfig:"MAX_PRICE_AGE" default:"300"`  //in seconds, older rates are not used for fiat invoices
+	FeeReserve                       bool               `envconfig:"FEE_RESERVE" default:"false"`
+	AllowAccountCreation             bool               `envconfig:"ALLOW_ACCOUNT_CREATION" default:"true"`
+	RequireInviteCode                bool               `envconfig:"REQUIRE_INVITE_CODE" default:"false"`
+	MinPasswordEntropy               int                `envconfig:"MIN_PASSWORD_ENTROPY" default:"0"`
+	PasswordHashCost                 PasswordHashCost   `envconfig:"PASSWORD_HASH_COST" default:"10"`
+	MaxReceiveAmount                 int64              `envconfig:"MAX_RECEIVE_AMOUNT" default:"0"`
+	MaxInvoiceAmountSats             int64              `envconfig:"MAX_INVOICE_AMOUNT_SATS" default:"0"`
+	EnforceInboundLiquidity          bool               `envconfig:"ENFORCE_INBOUND_LIQUIDITY" default:"false"` // invoices above the inbound liquidity of the node are rejected
+	MaxPendingInvoicesPerUser        int                `envconfig:"MAX_PENDING_INVOICES_PER_USER" default:"0"` //0 means unlimited
+	MaxInvoiceBatchSize              int                `envconfig:"MAX_INVOICE_BATCH_SIZE" default:"100"`
+	MaxSendAmount                    int64              `envconfig:"MAX_SEND_AMOUNT" default:"0"`
+	EnforceOutboundLiquidity         bool               `envconfig:"ENFORCE_OUTBOUND_LIQUIDITY" default:"false"` // payments above the local balance of the node are rejected
+	MaxAccountBalance                int64              `envconfig:"MAX_ACCOUNT_BALANCE" default:"0"`
+	MaxFeeAmount                     int64              `envconfig:"MAX_FEE_AMOUNT" default:"5000"`
+	FeeLimitStrategy                 FeeLimitStrategy   `envconfig:"FEE_LIMIT_STRATEGY" default:"default"`
+	FeeLimitPercent                  float64            `envconfig:"FEE_LIMIT_PERCENT" default:"1"`           // percent of the amount
+	FeeLimitFixed                    int64              `envconfig:"FEE_LIMIT_FIXED" default:"10"`            // in sats
+	ZeroFeeDestinations              []string           `envconfig:"ZERO_FEE_DESTINATIONS"`                   // comma separated pubkeys that are paid without a fee limit and fee reserve
+	ServiceFeePercent                float64            `envconfig:"SERVICE_FEE_PERCENT" default:"0"`         // percent of the amount, charged on outgoing payments
+	ServiceFeeFixed                  int64              `envconfig:"SERVICE_FEE_FIXED" default:"0"`           // in sats, charged on outgoing payments
+	ReceiveFeePercent                float64            `envconfig:"RECEIVE_FEE_PERCENT" default:"0"`         // percent of the amount, deducted from settled incoming invoices
+	MinReceiveSats                   int64              `envconfig:"MIN_RECEIVE_SATS" default:"0"`            //0 means no minimum
+	MinReceivePolicy                 MinReceivePolicy   `envconfig:"MIN_RECEIVE_POLICY" default:"operator"`   // operator or credit_without_fee
+	DisableKeysendReceive            bool               `envconfig:"DISABLE_KEYSEND_RECEIVE" default:"false"` // keysend payments to the node are not credited
+	KeysendAliasFallbackLogin        string             `envconfig:"KEYSEND_ALIAS_FALLBACK_LOGIN"`            // credited with keysend payments to unknown aliases, they are not credited without one
+	SelfPaymentPolicy                SelfPaymentPolicy  `envconfig:"SELF_PAYMENT_POLICY" default:"reject"`    // reject or allow
+	MaxSendVolume                    int64              `envconfig:"MAX_SEND_VOLUME" default:"0"`             //0 means the volume check is disabled by default
+	MaxReceiveVolume                 int64              `envconfig:"MAX_RECEIVE_VOLUME" default:"0"`          //0 means the volume check is disabled by default
+	MinPaymentSats                   int64              `envconfig:"MIN_PAYMENT_SATS" default:"0"`            //0 means no minimum
+	MaxPaymentSats                   int64              `envconfig:"MAX_PAYMENT_SATS" default:"0"`            //0 means no maximum
+	MaxDailyOutboundSats             int64              `envconfig:"MAX_DAILY_OUTBOUND_SATS" default:"0"`     //0 means unlimited
+	ConfirmationThresholdSats        int64              `envconfig:"CONFIRMATION_THRESHOLD_SATS" default:"0"` //0 means payments are sent without confirmation
+	ConfirmationTimeout              int64              `envconfig:"CONFIRMATION_TIMEOUT" default:"120"`      //in seconds, payments have to be confirmed within this time
+	MaxVolumePeriod                  int64              `envconfig:"MAX_VOLUME_PERIOD" default:"2592000"`     //in seconds, default 1 month
+	DefaultPaymentTimeout            int64              `envconfig:"DEFAULT_PAYMENT_TIMEOUT" default:"0"`     //in seconds, 0 means no timeout
+	PaymentMaxRetries                int                `envconfig:"PAYMENT_MAX_RETRIES" default:"0"`         //0 means failed payments are not retried
+	PaymentRetryDelay                int64              `envconfig:"PAYMENT_RETRY_DELAY" default:"500"`       //in milliseconds, doubled after every failed attempt
+	ShutdownGrace                    int64              `envconfig:"SHUTDOWN_GRACE" default:"30"`             //in seconds, time to wait for in-flight payments on shutdown
+	DefaultInvoiceExpiry             int64              `envconfig:"DEFAULT_INVOICE_EXPIRY" default:"86400"`  //in seconds, default 1 day
+	DefaultInvoiceMemoTemplate       string             `envconfig:"DEFAULT_INVOICE_MEMO_TEMPLATE"`           // memo of invoices without memo, {amount} and {user} are replaced
+	IdempotencyKeyTTL                int64              `envconfig:"IDEMPOTENCY_KEY_TTL" default:"86400"`     //in seconds, default 1 day
+	IdempotencyWaitTimeout           int64              `envconfig:"IDEMPOTENCY_WAIT_TIMEOUT" default:"30"`   //in seconds, how long a retry waits for the payment in progress
+	InvoiceExpiryGrace               int64              `envconfig:"INVOICE_EXPIRY_GRACE" default:"0"`        //in seconds, invoices are still paid this long after they expired
+	MaxRequestBytes                  int64              `envconfig:"MAX_REQUEST_BYTES" default:"256000"`      //0 means no limit
+	CORSAllowedOrigins               []string           `envconfig:"CORS_ALLOWED_ORIGINS"`                    // comma separated, * allows all origins, CORS is disabled without origins
+	CORSAllowedMethods               []string           `envconfig:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,DELETE"`
+	CORSAllowCredentials             bool               `envconfig:"CORS_ALLOW_CREDENTIALS" default:"false"`
+	LNURLMinSendable                 int64              `envconfig:"LNURL_MIN_SENDABLE" default:"1000"`                //in millisatoshi
+	LNURLMaxSendable                 int64              `envconfig:"LNURL_MAX_SENDABLE" default:"100000000"`           //in millisatoshi
+	OutboundProxy                    string             `envconfig:"OUTBOUND_PROXY"`                                   // http, https or socks5 proxy for requests to LNURL servers
+	OutboundTimeout                  int64              `envconfig:"OUTBOUND_TIMEOUT" default:"10"`                    //in seconds
+	OutboundAllowedHosts             []string           `envconfig:"OUTBOUND_ALLOWED_HOSTS"`                           // comma separated hosts or CIDR ranges, allowed even if they are private
+	OutboundDeniedHosts              []string           `envconfig:"OUTBOUND_DENIED_HOSTS"`                            // comma separated hosts or CIDR ranges that are never requested
+	NostrPrivateKey                  string             `envconfig:"NOSTR_PRIVATE_KEY"`                                // hex encoded, signs the zap receipts
+	NostrRelays                      []string           `envconfig:"NOSTR_RELAYS"`                                     // the zap receipts are published here too
+	PendingPaymentReconcileInterval  int64              `envconfig:"PENDING_PAYMENT_RECONCILE_INTERVAL" default:"300"` //in seconds, 0 disables the reconciliation
+	BalanceSnapshotInterval          int64              `envconfig:"BALANCE_SNAPSHOT_INTERVAL" default:"86400"`        //in seconds, 0 disables the snapshots
+	InvoiceExpirySweepInterval       int64              `envconfig:"INVOICE_EXPIRY_SWEEP_INTERVAL" default:"60"`       //in seconds, 0 disables the sweep
+	InvoiceSubscriptionRetryDelay    int64              `envconfig:"INVOICE_SUBSCRIPTION_RETRY_DELAY" default:"1"`     //in seconds, doubled after every failed reconnect up to 1 minute
+	RabbitMQUri                      string             `envconfig:"RABBITMQ_URI"`
+	RabbitMQLndhubInvoiceExchange    string             `envconfig:"RABBITMQ_INVOICE_EXCHANGE" default:"lndhub_invoice"`
+	RabbitMQLndInvoiceExchange       string             `envconfig:"RABBITMQ_LND_INVOICE_EXCHANGE" default:"lnd_invoice"`
+	RabbitMQLndPaymentExchange       string             `envconfig:"RABBITMQ_LND_PAYMENT_EXCHANGE" default:"lnd_payment"`
+	RabbitMQInvoiceConsumerQueueName string             `envconfig:"RABBITMQ_INVOICE_CONSUMER_QUEUE_NAME" default:"lnd_invoice_consumer"`
+	RabbitMQPaymentConsumerQueueName string             `envconfig:"RABBITMQ_PAYMENT_CONSUMER_QUEUE_NAME" default:"lnd_payment_consumer"`
 	Branding                         BrandingConfig
 }
+
+type FeeLimitStrategy string
+
+const (
+	// 10 sats, or 1% + 1 sat for amounts above 1000 sats
+	FeeLimitStrategyDefault FeeLimitStrategy = "default"
+	// FEE_LIMIT_PERCENT of the amount
+	FeeLimitStrategyPercent FeeLimitStrategy = "percent"
+	// FEE_LIMIT_FIXED sats
+	FeeLimitStrategyFixed FeeLimitStrategy = "fixed"
+	// the higher one of the percent and the fixed limit
+	FeeLimitStrategyMax FeeLimitStrategy = "max"
+)
+
+func (fls *FeeLimitStrategy) Decode(value string) error {
+	switch strategy := FeeLimitStrategy(value); strategy {
+	case FeeLimitStrategyDefault, FeeLimitStrategyPercent, FeeLimitStrategyFixed, FeeLimitStrategyMax:
+		*fls = strategy
+		return nil
+	default:
+		return fmt.Errorf("invalid fee limit strategy: %q", value)
+	}
+}
+
+// PasswordHashCost is the bcrypt cost of the stored passwords, every step doubles the time to hash a password
+type PasswordHashCost int
+
+func (phc *PasswordHashCost) Decode(value string) error {
+	cost, err := strconv.Atoi(value)
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("invalid password hash cost: %q, must be between %d and %d", value, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	*phc = PasswordHashCost(cost)
+	return nil
+}
+
+// MinReceivePolicy decides what happens with settled incoming payments below MIN_RECEIVE_SATS
+type MinReceivePolicy string
+
+const (
+	// the amount is not credited to the user and booked as a fee
+	MinReceivePolicyOperator MinReceivePolicy = "operator"
+	// the amount is credited to the user without a receive fee. A settled lightning payment can't be sent back to the payer,
+	// so there is no policy to refund it
+	MinReceivePolicyCreditWithoutFee MinReceivePolicy = "credit_without_fee"
+)
+
+func (mrp *MinReceivePolicy) Decode(value string) error {
+	switch policy := MinReceivePolicy(value); policy {
+	case MinReceivePolicyOperator, MinReceivePolicyCreditWithoutFee:
+		*mrp = policy
+		return nil
+	default:
+		return fmt.Errorf("invalid min receive policy: %q", value)
+	}
+}
+
+// SelfPaymentPolicy decides what happens when users pay their own invoices
+type SelfPaymentPolicy string
+
+const (
+	// the payment is rejected, it is usually a mistake
+	SelfPaymentPolicyReject SelfPaymentPolicy = "reject"
+	// the payment is settled internally, which doesn't change the balance, and a warning is logged
+	SelfPaymentPolicyAllow SelfPaymentPolicy = "allow"
+)
+
+func (spp *SelfPaymentPolicy) Decode(value string) error {
+	switch policy := SelfPaymentPolicy(value); policy {
+	case SelfPaymentPolicyReject, SelfPaymentPolicyAllow:
+		*spp = policy
+		return nil
+	default:
+		return fmt.Errorf("invalid self payment policy: %q", value)
+	}
+}
+
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitOverrides are the rate limits of single routes, e.g. "/v2/payments/bolt11=1:2;/balance=20:20"
+// the route path can contain a colon for the path parameters, so only the value is split by colon
+
+type RateLimitOverrides map[string]RateLimit
+
+func (rlo *RateLimitOverrides) Decode(value string) error {
+	m := map[string]RateLimit{}
+	for _, pair := range strings.Split(value, ";") {
+		kvpair := strings.Split(pair, "=")
+		if len(kvpair) != 2 {
+			return fmt.Errorf("invalid map item: %q", pair)
+		}
+		limit := strings.Split(kvpair[1], ":")
+		if len(limit) != 2 {
+			return fmt.Errorf("invalid rate limit: %q", kvpair[1])
+		}
+		rate, err := strconv.ParseFloat(limit[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid rate: %q", limit[0])
+		}
+		burst, err := strconv.Atoi(limit[1])
+		if err != nil {
+			return fmt.Errorf("invalid burst: %q", limit[1])
+		}
+		m[kvpair[0]] = RateLimit{Rate: rate, Burst: burst}
+	}
+	*rlo = m
+	return nil
+}
+
 type Limits struct {
 	MaxSendVolume     int64
 	MaxSendAmount     int64
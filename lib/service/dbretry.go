@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// the wait before the first retry, it doubles with every retry
+const dbRetryBackoff = 50 * time.Millisecond
+
+// withDBRetry runs op and runs it again up to DatabaseRetries times if it failed with a transient database error.
+// op must be safe to run again, e.g. a read or a transaction that was rolled back.
+func (svc *LndhubService) withDBRetry(ctx context.Context, op func() error) error {
+	backoff := dbRetryBackoff
+	for retry := 0; ; retry++ {
+		err := op()
+		if err == nil || retry >= svc.Config.DatabaseRetries || !isTransientDBError(err) {
+			return err
+		}
+		svc.Logger.Warnf("Retrying database operation after a transient error retry:%v error: %v", retry+1, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransientDBError returns true for errors after which the same query can succeed: the connection was refused or
+// lost, the server is shutting down or starting up, or the transaction was aborted for a conflict.
+func isTransientDBError(err error) bool {
+	// the transaction may have been stored
+	var commitErr *txCommitError
+	if errors.As(err, &commitErr) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) {
+		code := pgErr.Field('C')
+		switch code {
+		// serialization_failure, deadlock_detected, too_many_connections
+		case "40001", "40P01", "53300":
+			return true
+		}
+		// connection exceptions and operator interventions like admin_shutdown and cannot_connect_now
+		return strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestWithDBRetry(t *testing.T) {
+	svc := &LndhubService{
+		Config: &Config{DatabaseRetries: 2},
+		Logger: lecho.New(io.Discard),
+	}
+	ctx := context.Background()
+
+	// the connection was refused once, e.g. during a failover
+	calls := 0
+	err := svc.withDBRetry(ctx, func() error {
+		calls++
+		if calls == 1 {
+			return &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// the retries are bounded
+	calls = 0
+	err = svc.withDBRetry(ctx, func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, 3, calls)
+
+	// other errors are returned right away
+	for _, permanent := range []error{sql.ErrNoRows, ErrNotEnoughBalance, &txCommitError{err: driver.ErrBadConn}} {
+		calls = 0
+		err = svc.withDBRetry(ctx, func() error {
+			calls++
+			return permanent
+		})
+		assert.ErrorIs(t, err, permanent)
+		assert.Equal(t, 1, calls)
+	}
+
+	// no retries once the request is canceled
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	err = svc.withDBRetry(canceledCtx, func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+
+	"github.com/getAlby/lndhub.go/db/models"
+)
+
+// DryRunPaymentResponse is what a payment would cost, the routing fee is an estimate.
+// ExceedsFeeLimit is set if the estimated routing fee is above the fee limit, the payment would likely fail then.
+type DryRunPaymentResponse struct {
+	RoutingFee      int64
+	ServiceFee      int64
+	FeeLimit        int64
+	Internal        bool
+	ExceedsFeeLimit bool
+}
+
+// DryRunPayment runs the checks of PayInvoice for an outgoing invoice that is not stored, without debiting the user
+// or sending the payment: the balance has to cover the payment and its fees, and the node has to be able to send it.
+func (svc *LndhubService) DryRunPayment(ctx context.Context, invoice *models.Invoice) (*DryRunPaymentResponse, error) {
+	if err := svc.checkOutboundLiquidity(ctx, invoice); err != nil {
+		return nil, err
+	}
+	response := &DryRunPaymentResponse{
+		ServiceFee: svc.CalcServiceFee(invoice.DestinationPubkeyHex, invoice.Amount),
+		FeeLimit:   svc.invoiceFeeLimit(invoice.DestinationPubkeyHex, invoice),
+		Internal:   svc.isInternalPayment(invoice),
+	}
+	balance, err := svc.CurrentUserBalance(ctx, invoice.UserID)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := svc.reservedBalance(ctx, svc.DB, invoice.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if balance-reserved < svc.PaymentReserve(invoice.DestinationPubkeyHex, invoice.Amount, response.FeeLimit) {
+		return nil, ErrNotEnoughBalance
+	}
+	// internal payments are settled on our ledger without a routing fee
+	if !response.Internal {
+		response.RoutingFee, err = svc.estimateRouteFee(ctx, invoice.DestinationPubkeyHex, invoice.Amount)
+		if err != nil {
+			return nil, err
+		}
+		response.ExceedsFeeLimit = response.RoutingFee > response.FeeLimit
+	}
+	return response, nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+const (
+	DependencyDatabase  = "database"
+	DependencyLightning = "lightning"
+
+	// the readiness checks are cached to not call the node on every probe
+	readinessCacheDuration = 2 * time.Second
+	readinessCheckTimeout  = 5 * time.Second
+)
+
+type readinessCache struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	failed    []string
+}
+
+// CheckReadiness pings the database and calls GetInfo on the lightning node,
+// it returns the dependencies that are not available
+func (svc *LndhubService) CheckReadiness(ctx context.Context) []string {
+	svc.readiness.mu.Lock()
+	defer svc.readiness.mu.Unlock()
+	if !svc.readiness.checkedAt.IsZero() && time.Since(svc.readiness.checkedAt) < readinessCacheDuration {
+		return svc.readiness.failed
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	failed := []string{}
+	if err := svc.DB.PingContext(ctx); err != nil {
+		svc.Logger.Errorf("Readiness check of the database failed: %v", err)
+		failed = append(failed, DependencyDatabase)
+	}
+	if _, err := svc.LndClient.GetInfo(ctx, &lnrpc.GetInfoRequest{}); err != nil {
+		svc.Logger.Errorf("Readiness check of the lightning node failed: %v", err)
+		failed = append(failed, DependencyLightning)
+	}
+	svc.readiness.checkedAt = time.Now()
+	svc.readiness.failed = failed
+	return failed
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"github.com/uptrace/bun"
+)
+
+// AddHoldInvoice creates an invoice for a payment hash the caller controls.
+// A payment of the invoice is held until it is settled with the preimage or canceled,
+// the amount is only credited to the user once the invoice is settled.
+func (svc *LndhubService) AddHoldInvoice(ctx context.Context, userID int64, amount int64, memo, rHashStr string) (*models.Invoice, *responses.ErrorResponse) {
+	rHash, err := hex.DecodeString(rHashStr)
+	if err != nil || len(rHash) != sha256.Size {
+		return nil, &responses.BadArgumentsError
+	}
+	if errResp := ValidateMemo(memo); errResp != nil {
+		return nil, errResp
+	}
+	if errResp := svc.checkMaxInvoiceAmount(amount); errResp != nil {
+		return nil, errResp
+	}
+	if errResp := svc.checkPendingInvoiceLimit(ctx, userID); errResp != nil {
+		return nil, errResp
+	}
+	if errResp := svc.checkInboundLiquidity(ctx, amount); errResp != nil {
+		return nil, errResp
+	}
+	expiry := time.Duration(svc.Config.DefaultInvoiceExpiry) * time.Second
+	// Initialize new DB invoice
+	invoice := models.Invoice{
+		Type:      common.InvoiceTypeIncoming,
+		UserID:    userID,
+		Amount:    amount,
+		Memo:      memo,
+		RHash:     rHashStr,
+		IsHold:    true,
+		State:     common.InvoiceStateInitialized,
+		Expiry:    svc.Config.DefaultInvoiceExpiry,
+		ExpiresAt: bun.NullTime{Time: time.Now().Add(expiry)},
+	}
+
+	// Save invoice - we save the invoice early to have a record in case the LN call fails
+	_, err = svc.DB.NewInsert().Model(&invoice).Exec(ctx)
+	if err != nil {
+		return nil, &responses.GeneralServerError
+	}
+
+	lnInvoiceResult, err := svc.LndClient.AddHoldInvoice(ctx, &invoicesrpc.AddHoldInvoiceRequest{
+		Memo:   memo,
+		Hash:   rHash,
+		Value:  amount,
+		Expiry: int64(expiry.Seconds()),
+	})
+	if err != nil {
+		svc.Logger.Errorf("Error creating hold invoice: user_id:%v error: %v", userID, err)
+		return nil, &responses.GeneralServerError
+	}
+
+	// Update the DB invoice with the data from the LND gRPC call
+	invoice.PaymentRequest = lnInvoiceResult.PaymentRequest
+	invoice.AddIndex = lnInvoiceResult.AddIndex
+	invoice.DestinationPubkeyHex = svc.LndClient.GetMainPubkey() // Our node pubkey for incoming invoices
+	invoice.State = common.InvoiceStateOpen
+
+	_, err = svc.DB.NewUpdate().Model(&invoice).WherePK().Exec(ctx)
+	if err != nil {
+		return nil, &responses.GeneralServerError
+	}
+
+	return &invoice, nil
+}
+
+func (svc *LndhubService) FindHoldInvoiceByPaymentHash(ctx context.Context, userId int64, rHash string) (*models.Invoice, error) {
+	var invoice models.Invoice
+
+	err := svc.DB.NewSelect().Model(&invoice).Where("invoice.user_id = ? AND invoice.r_hash = ? AND invoice.type = ? AND invoice.is_hold = true", userId, rHash, common.InvoiceTypeIncoming).Limit(1).Scan(ctx)
+	if err != nil {
+		return &invoice, err
+	}
+	return &invoice, nil
+}
+
+// SettleHoldInvoice releases the preimage of a held invoice.
+// The user's balance is credited once LND reports the invoice as settled in the invoice subscription.
+func (svc *LndhubService) SettleHoldInvoice(ctx context.Context, invoice *models.Invoice, preimageStr string) *responses.ErrorResponse {
+	preimage, err := hex.DecodeString(preimageStr)
+	if err != nil {
+		return &responses.BadArgumentsError
+	}
+	hash := sha256.Sum256(preimage)
+	if hex.EncodeToString(hash[:]) != invoice.RHash {
+		return &responses.InvalidPreimageError
+	}
+	if invoice.State != common.InvoiceStateHeld {
+		return &responses.HoldInvoiceNotHeldError
+	}
+	_, err = svc.LndClient.SettleInvoice(ctx, &invoicesrpc.SettleInvoiceMsg{
+		Preimage: preimage,
+	})
+	if err != nil {
+		svc.Logger.Errorf("Error settling hold invoice: invoice_id:%v error: %v", invoice.ID, err)
+		return &responses.GeneralServerError
+	}
+	invoice.Preimage = preimageStr
+	_, err = svc.DB.NewUpdate().Model(invoice).Column("preimage", "updated_at").WherePK().Exec(ctx)
+	if err != nil {
+		return &responses.GeneralServerError
+	}
+	return nil
+}
+
+// CancelHoldInvoice cancels an open or held invoice, a held payment is returned to the payer
+func (svc *LndhubService) CancelHoldInvoice(ctx context.Context, invoice *models.Invoice) *responses.ErrorResponse {
+	if invoice.State != common.InvoiceStateOpen && invoice.State != common.InvoiceStateHeld {
+		return &responses.HoldInvoiceNotHeldError
+	}
+	rHash, err := hex.DecodeString(invoice.RHash)
+	if err != nil {
+		return &responses.GeneralServerError
+	}
+	_, err = svc.LndClient.CancelInvoice(ctx, &invoicesrpc.CancelInvoiceMsg{
+		PaymentHash: rHash,
+	})
+	if err != nil {
+		svc.Logger.Errorf("Error canceling hold invoice: invoice_id:%v error: %v", invoice.ID, err)
+		return &responses.GeneralServerError
+	}
+	invoice.State = common.InvoiceStateCanceled
+	_, err = svc.DB.NewUpdate().Model(invoice).Column("state", "updated_at").WherePK().Exec(ctx)
+	if err != nil {
+		return &responses.GeneralServerError
+	}
+	return nil
+}
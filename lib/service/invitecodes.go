@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrInviteCodeRequired  = errors.New("an invite code is required")
+	ErrInvalidInviteCode   = errors.New("invite code does not exist")
+	ErrInviteCodeExhausted = errors.New("invite code has no uses left")
+	ErrInviteCodeExpired   = errors.New("invite code has expired")
+)
+
+// CreateInviteCode creates a random invite code that can be used maxUses times, a zero expiresAt never expires
+func (svc *LndhubService) CreateInviteCode(ctx context.Context, maxUses int64, expiresAt time.Time) (*models.InviteCode, error) {
+	codeBytes, err := randBytesFromStr(16, alphaNumBytes)
+	if err != nil {
+		return nil, err
+	}
+	inviteCode := &models.InviteCode{
+		Code:      string(codeBytes),
+		MaxUses:   maxUses,
+		ExpiresAt: bun.NullTime{Time: expiresAt},
+	}
+	_, err = svc.DB.NewInsert().Model(inviteCode).Returning("*").Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return inviteCode, nil
+}
+
+// useInviteCode counts a use of the invite code. The update only succeeds while the code has uses left and
+// did not expire, so concurrent sign ups can't use it more often than allowed.
+func useInviteCode(ctx context.Context, db bun.IDB, code string) error {
+	result, err := db.NewUpdate().Model((*models.InviteCode)(nil)).
+		Set("uses = uses + 1").
+		Where("code = ?", code).
+		Where("uses < max_uses").
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+	// find out why the code can't be used
+	var inviteCode models.InviteCode
+	err = db.NewSelect().Model(&inviteCode).Where("code = ?", code).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidInviteCode
+	}
+	if err != nil {
+		return err
+	}
+	if inviteCode.Uses >= inviteCode.MaxUses {
+		return ErrInviteCodeExhausted
+	}
+	return ErrInviteCodeExpired
+}
+
+// InviteCodeError returns the error response for an invite code that can't be used, nil for other errors
+func InviteCodeError(err error) *responses.ErrorResponse {
+	switch {
+	case errors.Is(err, ErrInviteCodeRequired):
+		return &responses.InviteCodeRequiredError
+	case errors.Is(err, ErrInvalidInviteCode):
+		return &responses.InvalidInviteCodeError
+	case errors.Is(err, ErrInviteCodeExhausted):
+		return &responses.InviteCodeExhaustedError
+	case errors.Is(err, ErrInviteCodeExpired):
+		return &responses.InviteCodeExpiredError
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/uptrace/bun"
+)
+
+// the number of invoices of a batch that are created on the node at the same time
+const invoiceBatchWorkers = 8
+
+// InvoiceBatchResult is the outcome of one invoice of a batch, either the created invoice or the error
+type InvoiceBatchResult struct {
+	Invoice *models.Invoice
+	Error   *responses.ErrorResponse
+}
+
+// CheckInvoiceBatchSize rejects batches with more than MAX_INVOICE_BATCH_SIZE invoices
+func (svc *LndhubService) CheckInvoiceBatchSize(size int) *responses.ErrorResponse {
+	if size <= svc.Config.MaxInvoiceBatchSize {
+		return nil
+	}
+	return &responses.ErrorResponse{
+		Error:          true,
+		Code:           responses.BadArgumentsError.Code,
+		Message:        fmt.Sprintf("a batch can have at most %d invoices", svc.Config.MaxInvoiceBatchSize),
+		HttpStatusCode: responses.BadArgumentsError.HttpStatusCode,
+	}
+}
+
+// AddIncomingInvoiceBatch creates the incoming invoices with the amount, memo and expiry of the given invoices.
+// The invoices are created on the node with up to invoiceBatchWorkers concurrent calls and the created ones are
+// stored in a single transaction. An invoice that is rejected or can't be created on the node is reported in its
+// result, the other invoices are still created. The batch fails as a whole if it can't be stored.
+func (svc *LndhubService) AddIncomingInvoiceBatch(ctx context.Context, userID int64, invoices []models.Invoice) ([]InvoiceBatchResult, *responses.ErrorResponse) {
+	if errResp := svc.CheckInvoiceBatchSize(len(invoices)); errResp != nil {
+		return nil, errResp
+	}
+	// the whole batch counts towards the limit of pending invoices
+	if svc.Config.MaxPendingInvoicesPerUser > 0 {
+		count, err := svc.PendingInvoiceCount(ctx, userID)
+		if err != nil {
+			svc.Logger.Errorf("Could not count pending invoices user_id:%v error: %v", userID, err)
+			return nil, &responses.GeneralServerError
+		}
+		if count+len(invoices) > svc.Config.MaxPendingInvoicesPerUser {
+			return nil, &responses.TooManyPendingInvoicesError
+		}
+	}
+
+	results := make([]InvoiceBatchResult, len(invoices))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < invoiceBatchWorkers && w < len(invoices); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = svc.createBatchInvoice(ctx, userID, invoices[i])
+			}
+		}()
+	}
+	for i := range invoices {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	created := []*models.Invoice{}
+	for _, result := range results {
+		if result.Invoice != nil {
+			created = append(created, result.Invoice)
+		}
+	}
+	if len(created) == 0 {
+		return results, nil
+	}
+	// the invoices are only handed out once they are stored, so they can't be paid before
+	if err := svc.storeInvoiceBatch(ctx, created); err != nil {
+		svc.Logger.Errorf("Could not store invoice batch user_id:%v count:%v error: %v", userID, len(created), err)
+		return nil, &responses.GeneralServerError
+	}
+	for range created {
+		svc.Metrics.invoiceCreated()
+	}
+	return results, nil
+}
+
+func (svc *LndhubService) storeInvoiceBatch(ctx context.Context, invoices []*models.Invoice) error {
+	tx, err := svc.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.NewInsert().Model(&invoices).Exec(ctx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createBatchInvoice creates the invoice on the node, it is not stored yet
+func (svc *LndhubService) createBatchInvoice(ctx context.Context, userID int64, invoice models.Invoice) InvoiceBatchResult {
+	if invoice.Memo == "" {
+		invoice.Memo = svc.defaultMemo(ctx, userID, invoice.Amount)
+	}
+	if errResp := ValidateMemo(invoice.Memo); errResp != nil {
+		return InvoiceBatchResult{Error: errResp}
+	}
+	if errResp := svc.checkMaxInvoiceAmount(invoice.Amount); errResp != nil {
+		return InvoiceBatchResult{Error: errResp}
+	}
+	preimage, err := makePreimageHex()
+	if err != nil {
+		return InvoiceBatchResult{Error: &responses.GeneralServerError}
+	}
+	if invoice.Expiry == 0 {
+		invoice.Expiry = svc.Config.DefaultInvoiceExpiry
+	}
+	invoice.UserID = userID
+	lnInvoice, err := nodeInvoiceRequest(&invoice, preimage)
+	if err != nil {
+		return InvoiceBatchResult{Error: &responses.GeneralServerError}
+	}
+	lnInvoiceResult, err := svc.LndClient.AddInvoice(ctx, lnInvoice)
+	if err != nil {
+		svc.Logger.Errorf("Error creating invoice of batch: user_id:%v error: %v", userID, err)
+		return InvoiceBatchResult{Error: &responses.GeneralServerError}
+	}
+	invoice.Type = common.InvoiceTypeIncoming
+	invoice.State = common.InvoiceStateOpen
+	invoice.ExpiresAt = bun.NullTime{Time: time.Now().Add(time.Duration(invoice.Expiry) * time.Second)}
+	invoice.PaymentRequest = lnInvoiceResult.PaymentRequest
+	invoice.RHash = hex.EncodeToString(lnInvoiceResult.RHash)
+	invoice.Preimage = hex.EncodeToString(preimage)
+	invoice.AddIndex = lnInvoiceResult.AddIndex
+	invoice.DestinationPubkeyHex = svc.LndClient.GetMainPubkey() // Our node pubkey for incoming invoices
+	return InvoiceBatchResult{Invoice: &invoice}
+}
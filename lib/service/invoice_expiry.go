@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getsentry/sentry-go"
+)
+
+// payments that are accepted right before the expiry can be settled by the node a little later
+const invoiceExpirySweepGrace = time.Minute
+
+// StartInvoiceExpiryRoutine marks the expired incoming invoices every InvoiceExpirySweepInterval seconds
+func (svc *LndhubService) StartInvoiceExpiryRoutine(ctx context.Context) error {
+	ticker := time.NewTicker(time.Duration(svc.Config.InvoiceExpirySweepInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := svc.ExpireInvoices(ctx); err != nil && ctx.Err() == nil {
+				// try again at the next tick
+				svc.Logger.Errorf("Failed to expire invoices: %v", err)
+				sentry.CaptureException(err)
+			}
+		}
+	}
+}
+
+// ExpireInvoices marks the open incoming invoices that expired without being paid as expired and notifies their users.
+// Only open invoices are updated in a single statement, so an invoice that is settled at the same time stays settled.
+// A settlement that is received after the invoice was marked still credits it, see ProcessInvoiceUpdate.
+func (svc *LndhubService) ExpireInvoices(ctx context.Context) ([]models.Invoice, error) {
+	invoices := []models.Invoice{}
+	now := time.Now()
+	_, err := svc.DB.NewUpdate().Model((*models.Invoice)(nil)).
+		Set("state = ?", common.InvoiceStateExpired).
+		Set("updated_at = ?", now).
+		Where("type = ?", common.InvoiceTypeIncoming).
+		Where("state = ?", common.InvoiceStateOpen).
+		Where("expires_at < ?", now.Add(-invoiceExpirySweepGrace)).
+		Returning("*").
+		Exec(ctx, &invoices)
+	if err != nil {
+		return nil, err
+	}
+	for _, invoice := range invoices {
+		svc.Logger.Infof("Invoice expired user_id:%v invoice_id:%v r_hash:%s", invoice.UserID, invoice.ID, invoice.RHash)
+		svc.publishAccountEvent(invoice)
+		go svc.deliverUserWebhooks(context.Background(), common.WebhookEventInvoiceExpired, invoice)
+	}
+	return invoices, nil
+}
@@ -9,7 +9,10 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/getAlby/lndhub.go/common"
 	"github.com/getAlby/lndhub.go/db/models"
@@ -17,10 +20,31 @@ import (
 	"github.com/getAlby/lndhub.go/lnd"
 	"github.com/getsentry/sentry-go"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/schema"
 )
 
+var PaymentTimeoutError = errors.New("payment timed out")
+
+var ErrNotEnoughBalance = errors.New("not enough balance")
+
+var ErrDailyLimitExceeded = errors.New("daily sending limit exceeded")
+
+var ErrInvoiceAlreadyPaid = errors.New("invoice is already paid")
+
+var ErrPaymentRequestTooLong = errors.New("payment request is too long")
+
+// MaxPaymentRequestLength is the length of the longest payment request we decode,
+// it is the capacity of a QR code which is far above the length of real invoices
+const MaxPaymentRequestLength = 7089
+
+// MaxMemoLength is the length in bytes of the longest description of a bolt11 invoice
+const MaxMemoLength = 639
+
+// timeout in seconds for router payments when the caller did not set a deadline
+const DefaultRouterPaymentTimeout = 60
+
 type Route struct {
 	TotalAmt  int64 `json:"total_amt"`
 	TotalFees int64 `json:"total_fees"`
@@ -33,8 +57,13 @@ type SendPaymentResponse struct {
 	PaymentHash        []byte `json:"payment_hash,omitempty"`
 	PaymentHashStr     string
 	PaymentRoute       *Route
-	TransactionEntry   *models.TransactionEntry
-	Invoice            *models.Invoice
+	NumParts           int
+	// SettledAmount is the amount the destination received, without the fee
+	SettledAmount    int64
+	TransactionEntry *models.TransactionEntry
+	Invoice          *models.Invoice
+	// Internal is set if the payment was settled on our ledger without a lightning payment
+	Internal bool
 }
 
 func (svc *LndhubService) FindInvoiceByPaymentHash(ctx context.Context, userId int64, rHash string) (*models.Invoice, error) {
@@ -47,6 +76,24 @@ func (svc *LndhubService) FindInvoiceByPaymentHash(ctx context.Context, userId i
 	return &invoice, nil
 }
 
+// FindOpenIncomingInvoiceByPaymentHash looks up an unpaid invoice of any user of this instance. Hold invoices are
+// left out, they are only settled by their user.
+func (svc *LndhubService) FindOpenIncomingInvoiceByPaymentHash(ctx context.Context, rHash string) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := svc.DB.NewSelect().Model(&invoice).Where("type = ? AND r_hash = ? AND state = ? AND is_hold IS NOT TRUE", common.InvoiceTypeIncoming, rHash, common.InvoiceStateOpen).Limit(1).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// isInternalPayment checks if the invoice is paid to one of our users because it is issued by our node.
+// The payment hash alone doesn't make a payment internal: the hash of an invoice of another node can be
+// registered with a hold invoice, the payment has to go to the node that knows the preimage.
+func (svc *LndhubService) isInternalPayment(invoice *models.Invoice) bool {
+	return svc.LndClient.IsIdentityPubkey(invoice.DestinationPubkeyHex)
+}
+
 func (svc *LndhubService) SendInternalPayment(ctx context.Context, invoice *models.Invoice) (sendPaymentResponse SendPaymentResponse, err error) {
 	//Check if it's a keysend payment
 	//If it is, an invoice will be created on-the-fly
@@ -59,12 +106,13 @@ func (svc *LndhubService) SendInternalPayment(ctx context.Context, invoice *mode
 		incomingInvoice = *keysendInvoice
 	} else {
 		// find invoice
-		err := svc.DB.NewSelect().Model(&incomingInvoice).Where("type = ? AND r_hash = ? AND state = ? ", common.InvoiceTypeIncoming, invoice.RHash, common.InvoiceStateOpen).Limit(1).Scan(ctx)
+		openInvoice, err := svc.FindOpenIncomingInvoiceByPaymentHash(ctx, invoice.RHash)
 		if err != nil {
 			// invoice not found or already settled
 			// TODO: logging
 			return sendPaymentResponse, err
 		}
+		incomingInvoice = *openInvoice
 	}
 
 	// Get the user's current and incoming account for the transaction entry
@@ -76,16 +124,34 @@ func (svc *LndhubService) SendInternalPayment(ctx context.Context, invoice *mode
 	if err != nil {
 		return sendPaymentResponse, err
 	}
-	// create recipient entry
-	recipientEntry := models.TransactionEntry{
-		UserID:          incomingInvoice.UserID,
-		InvoiceID:       incomingInvoice.ID,
-		CreditAccountID: recipientCreditAccount.ID,
-		DebitAccountID:  recipientDebitAccount.ID,
-		Amount:          invoice.Amount,
-		EntryType:       models.EntryTypeIncoming,
-	}
-	_, err = svc.DB.NewInsert().Model(&recipientEntry).Exec(ctx)
+	unpaidState := incomingInvoice.State
+	incomingInvoice.Amount = invoice.Amount // set just in case of 0 amount invoice
+	incomingInvoice.Fee = svc.CalcReceiveFee(invoice.Amount)
+	incomingInvoice.Internal = true // mark incoming invoice as internal, just for documentation/debugging
+	incomingInvoice.State = common.InvoiceStateSettled
+	incomingInvoice.SettledAt = schema.NullTime{Time: time.Now()}
+	// the invoice is claimed and credited at once, so concurrent payments can't both credit it
+	err = svc.WithTx(ctx, func(tx bun.Tx) error {
+		result, err := tx.NewUpdate().Model(&incomingInvoice).WherePK().Where("state = ?", unpaidState).Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows != 1 {
+			return ErrInvoiceAlreadyPaid
+		}
+		recipientEntry := models.TransactionEntry{
+			UserID:          incomingInvoice.UserID,
+			InvoiceID:       incomingInvoice.ID,
+			CreditAccountID: recipientCreditAccount.ID,
+			DebitAccountID:  recipientDebitAccount.ID,
+			Amount:          invoice.Amount,
+			EntryType:       models.EntryTypeIncoming,
+		}
+		if _, err := tx.NewInsert().Model(&recipientEntry).Exec(ctx); err != nil {
+			return err
+		}
+		return svc.insertReceiveFeeEntry(ctx, tx, &incomingInvoice, recipientEntry)
+	})
 	if err != nil {
 		return sendPaymentResponse, err
 	}
@@ -100,18 +166,11 @@ func (svc *LndhubService) SendInternalPayment(ctx context.Context, invoice *mode
 	sendPaymentResponse.PaymentHashStr = incomingInvoice.RHash
 	sendPaymentResponse.PaymentHash = paymentHash
 	sendPaymentResponse.PaymentRoute = &Route{TotalAmt: incomingInvoice.Amount, TotalFees: 0}
-
-	incomingInvoice.Internal = true // mark incoming invoice as internal, just for documentation/debugging
-	incomingInvoice.State = common.InvoiceStateSettled
-	incomingInvoice.SettledAt = schema.NullTime{Time: time.Now()}
-	incomingInvoice.Amount = invoice.Amount // set just in case of 0 amount invoice
-	_, err = svc.DB.NewUpdate().Model(&incomingInvoice).WherePK().Exec(ctx)
-	if err != nil {
-		// could not save the invoice of the recipient
-		return sendPaymentResponse, err
-	}
+	sendPaymentResponse.SettledAmount = invoice.Amount
+	sendPaymentResponse.Internal = true
 	svc.InvoicePubSub.Publish(strconv.FormatInt(incomingInvoice.UserID, 10), incomingInvoice)
 	svc.InvoicePubSub.Publish(common.InvoiceTypeIncoming, incomingInvoice)
+	svc.PublishZapReceipt(incomingInvoice)
 
 	return sendPaymentResponse, nil
 }
@@ -142,14 +201,99 @@ func (svc *LndhubService) SendPaymentSync(ctx context.Context, invoice *models.I
 	sendPaymentResponse.PaymentHash = paymentHash
 	sendPaymentResponse.PaymentHashStr = hex.EncodeToString(paymentHash[:])
 	sendPaymentResponse.PaymentRoute = &Route{TotalAmt: sendPaymentResult.PaymentRoute.TotalAmt, TotalFees: sendPaymentResult.PaymentRoute.TotalFees}
+	sendPaymentResponse.SettledAmount = sendPaymentResult.PaymentRoute.TotalAmt - sendPaymentResult.PaymentRoute.TotalFees
+	sendPaymentResponse.NumParts = 1
 	return sendPaymentResponse, nil
 }
 
+// SendPaymentV2 sends the payment using the router, which allows it to be split into multiple parts.
+func (svc *LndhubService) SendPaymentV2(ctx context.Context, invoice *models.Invoice) (SendPaymentResponse, error) {
+	sendPaymentResponse := SendPaymentResponse{}
+
+	sendPaymentRequest, err := svc.createRouterSendRequest(ctx, invoice)
+	if err != nil {
+		return sendPaymentResponse, err
+	}
+
+	// Execute the payment
+	paymentStream, err := svc.LndClient.SendPaymentV2(ctx, sendPaymentRequest)
+	if err != nil {
+		return sendPaymentResponse, err
+	}
+
+	// wait for the payment to reach a final state
+	for {
+		payment, err := paymentStream.Recv()
+		if err != nil {
+			return sendPaymentResponse, err
+		}
+		if payment.Status == lnrpc.Payment_FAILED {
+			return sendPaymentResponse, errors.New(payment.FailureReason.String())
+		}
+		if payment.Status != lnrpc.Payment_SUCCEEDED {
+			continue
+		}
+		preimage, err := hex.DecodeString(payment.PaymentPreimage)
+		if err != nil {
+			return sendPaymentResponse, err
+		}
+		sendPaymentResponse.PaymentPreimage = preimage
+		sendPaymentResponse.PaymentPreimageStr = payment.PaymentPreimage
+		paymentHash, err := hex.DecodeString(payment.PaymentHash)
+		if err != nil {
+			return sendPaymentResponse, err
+		}
+		sendPaymentResponse.PaymentHash = paymentHash
+		sendPaymentResponse.PaymentHashStr = payment.PaymentHash
+		sendPaymentResponse.PaymentRoute = &Route{TotalAmt: payment.ValueSat + payment.FeeSat, TotalFees: payment.FeeSat}
+		routed := false
+		for _, htlc := range payment.Htlcs {
+			if htlc.Status == lnrpc.HTLCAttempt_SUCCEEDED {
+				sendPaymentResponse.NumParts++
+				if htlc.Route != nil {
+					routed = true
+					sendPaymentResponse.SettledAmount += htlc.Route.TotalAmt - htlc.Route.TotalFees
+				}
+			}
+		}
+		// not every backend reports the routes of the HTLCs
+		if !routed {
+			sendPaymentResponse.SettledAmount = payment.ValueSat
+		}
+		return sendPaymentResponse, nil
+	}
+}
+
+func (svc *LndhubService) createRouterSendRequest(ctx context.Context, invoice *models.Invoice) (*routerrpc.SendPaymentRequest, error) {
+	if invoice.Keysend {
+		return nil, errors.New("multi-part payments are not supported for keysend")
+	}
+	// the router requires a timeout, use the deadline of the caller if there is one
+	timeoutSeconds := int32(DefaultRouterPaymentTimeout)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutSeconds = int32(time.Until(deadline).Seconds()) + 1
+	}
+	sendPaymentRequest := &routerrpc.SendPaymentRequest{
+		PaymentRequest: invoice.PaymentRequest,
+		FeeLimitSat:    svc.invoiceFeeLimit(invoice.DestinationPubkeyHex, invoice),
+		MaxParts:       invoice.MaxParts,
+		TimeoutSeconds: timeoutSeconds,
+	}
+	// the router rejects an amount for invoices that have one
+	payReq, err := svc.LndClient.DecodeBolt11(ctx, invoice.PaymentRequest)
+	if err != nil {
+		return nil, err
+	}
+	if payReq.NumMsat == 0 {
+		sendPaymentRequest.Amt = invoice.Amount
+	}
+	return sendPaymentRequest, nil
+}
+
 func (svc *LndhubService) createLnRpcSendRequest(invoice *models.Invoice) (*lnrpc.SendRequest, error) {
 	feeLimit := lnrpc.FeeLimit{
 		Limit: &lnrpc.FeeLimit_Fixed{
-			//if we get here, the destination is never ourselves, so we can use a dummy
-			Fixed: svc.CalcFeeLimit("dummy", invoice.Amount),
+			Fixed: svc.invoiceFeeLimit(invoice.DestinationPubkeyHex, invoice),
 		},
 	}
 
@@ -186,7 +330,19 @@ func (svc *LndhubService) createLnRpcSendRequest(invoice *models.Invoice) (*lnrp
 	}, nil
 }
 
+// PayInvoice debits the user and sends the payment of the outgoing invoice. An invoice that was not stored yet, see
+// NewOutgoingInvoice, is stored together with the debit, or in the aborted state if the payment is rejected.
 func (svc *LndhubService) PayInvoice(ctx context.Context, invoice *models.Invoice) (*SendPaymentResponse, error) {
+	svc.inFlightPayments.start()
+	defer svc.inFlightPayments.done()
+	start := time.Now()
+	svc.Metrics.paymentAttempted()
+	paymentResponse, err := svc.payInvoice(ctx, invoice)
+	svc.Metrics.paymentDone(time.Since(start), err)
+	return paymentResponse, err
+}
+
+func (svc *LndhubService) payInvoice(ctx context.Context, invoice *models.Invoice) (*SendPaymentResponse, error) {
 	userId := invoice.UserID
 
 	// Get the user's current and outgoing account for the transaction entry
@@ -206,25 +362,43 @@ func (svc *LndhubService) PayInvoice(ctx context.Context, invoice *models.Invoic
 		return nil, err
 	}
 
+	if err := svc.checkOutboundLiquidity(ctx, invoice); err != nil {
+		svc.rejectPayment(ctx, invoice, err)
+		return nil, err
+	}
+
 	entry, err := svc.InsertTransactionEntry(ctx, invoice, creditAccount, debitAccount, feeAccount)
+	if errors.Is(err, ErrNotEnoughBalance) || errors.Is(err, ErrDailyLimitExceeded) {
+		svc.rejectPayment(ctx, invoice, err)
+		return nil, err
+	}
 	if err != nil {
 		svc.Logger.Errorf("Could not insert transaction entries: %v", err)
 		return nil, err
 	}
 
 	var paymentResponse SendPaymentResponse
-	// Check the destination pubkey if it is an internal invoice and going to our node
+	// Check if it is an internal invoice paid to one of our users, this is settled on our ledger with zero fee
 	// Here we start using context.Background because we want to complete these calls
 	// regardless of if the request's context is canceled or not.
-	if svc.LndClient.IsIdentityPubkey(invoice.DestinationPubkeyHex) {
+	if svc.isInternalPayment(invoice) {
 		paymentResponse, err = svc.SendInternalPayment(context.Background(), invoice)
 		if err != nil {
 			svc.HandleFailedPayment(context.Background(), invoice, entry, err)
 			return nil, err
 		}
+		invoice.Internal = true
 	} else {
-		paymentResponse, err = svc.SendPaymentSync(context.Background(), invoice)
+		// a deadline set by the caller (e.g. a payment timeout) is carried over
+		sendCtx, cancel := detachedContext(ctx)
+		defer cancel()
+		paymentResponse, err = svc.sendPaymentWithRetries(sendCtx, invoice)
 		if err != nil {
+			if sendCtx.Err() == context.DeadlineExceeded {
+				// we don't know the outcome of the payment yet so we must not revert anything
+				svc.HandlePendingPayment(context.Background(), invoice)
+				return nil, PaymentTimeoutError
+			}
 			svc.HandleFailedPayment(context.Background(), invoice, entry, err)
 			return nil, err
 		}
@@ -241,6 +415,77 @@ func (svc *LndhubService) PayInvoice(ctx context.Context, invoice *models.Invoic
 	return &paymentResponse, err
 }
 
+// rejectPayment keeps the invoice of a payment that was rejected before anything was debited in the aborted state,
+// so it doesn't count as a pending payment and support can still find the attempt. Invoices that were not stored yet
+// are stored in that state.
+func (svc *LndhubService) rejectPayment(ctx context.Context, invoice *models.Invoice, err error) {
+	invoice.State = common.InvoiceStateAborted
+	invoice.ErrorMessage = err.Error()
+	if invoice.ID == 0 {
+		if _, insertErr := svc.DB.NewInsert().Model(invoice).Exec(ctx); insertErr != nil {
+			svc.Logger.Errorf("Could not store rejected payment invoice user_id:%v error %v", invoice.UserID, insertErr)
+		}
+		return
+	}
+	if _, updateErr := svc.DB.NewUpdate().Model(invoice).Column("state", "error_message").WherePK().Exec(ctx); updateErr != nil {
+		svc.Logger.Errorf("Could not update rejected payment invoice user_id:%v invoice_id:%v error %v", invoice.UserID, invoice.ID, updateErr)
+	}
+}
+
+// sendPaymentWithRetries sends the payment and sends it again up to PaymentMaxRetries times when it failed on the way,
+// e.g. with a temporary channel failure. The mission control of the node remembers the failed channels, so a retry takes
+// another route, and the retries wait PaymentRetryDelay, doubled after every attempt, for the channels to recover.
+// Every attempt is limited to the fee limit of the invoice and only the successful attempt pays a fee,
+// so the fee limit holds across the retries.
+func (svc *LndhubService) sendPaymentWithRetries(ctx context.Context, invoice *models.Invoice) (paymentResponse SendPaymentResponse, err error) {
+	delay := time.Duration(svc.Config.PaymentRetryDelay) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return paymentResponse, err
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		invoice.PaymentAttempts = attempt
+		if invoice.MaxParts > 1 {
+			paymentResponse, err = svc.SendPaymentV2(ctx, invoice)
+		} else {
+			paymentResponse, err = svc.SendPaymentSync(ctx, invoice)
+		}
+		if err == nil || attempt > svc.Config.PaymentMaxRetries || ctx.Err() != nil || !retryablePaymentError(err) {
+			return paymentResponse, err
+		}
+		svc.Logger.Infof("Payment attempt failed, retrying: user_id:%v invoice_id:%v attempt:%v error: %v", invoice.UserID, invoice.ID, attempt, err)
+	}
+}
+
+// retryablePaymentError reports if a failed payment can succeed on another route.
+// Payments that were rejected by the destination, e.g. for incorrect payment details, are not retried. Neither are
+// payments without a route, the node has already tried all routes it knows then.
+func retryablePaymentError(err error) bool {
+	switch paymentFailureReason(err) {
+	case "temporary_failure":
+		return true
+	default:
+		return false
+	}
+}
+
+// HandlePendingPayment marks an outgoing payment whose outcome is not known yet as pending.
+// The transaction entry and the fee reserve are kept, the final state is set by the payment tracker.
+func (svc *LndhubService) HandlePendingPayment(ctx context.Context, invoice *models.Invoice) {
+	invoice.State = common.InvoiceStatePending
+	_, err := svc.DB.NewUpdate().Model(invoice).WherePK().Exec(ctx)
+	if err != nil {
+		sentry.CaptureException(err)
+		svc.Logger.Errorf("Could not update pending payment invoice user_id:%v invoice_id:%v error %s", invoice.UserID, invoice.ID, err.Error())
+	}
+	svc.Logger.Infof("Payment timed out, tracking pending payment: user_id:%v invoice_id:%v r_hash:%s", invoice.UserID, invoice.ID, invoice.RHash)
+	go svc.TrackOutgoingPaymentstatus(context.Background(), invoice)
+}
+
 func (svc *LndhubService) HandleFailedPayment(ctx context.Context, invoice *models.Invoice, entryToRevert models.TransactionEntry, failedPaymentError error) error {
 	// Process the tx insertion and invoice update in a DB transaction
 	// analogous with the incoming invoice update
@@ -251,6 +496,22 @@ func (svc *LndhubService) HandleFailedPayment(ctx context.Context, invoice *mode
 		return err
 	}
 
+	// the payment might already have been handled, e.g. by another payment tracker
+	// lock the invoice to make sure the amount is only credited back once
+	var currentState string
+	err = tx.NewSelect().Model((*models.Invoice)(nil)).Column("state").Where("id = ?", invoice.ID).For("UPDATE").Scan(ctx, &currentState)
+	if err != nil {
+		tx.Rollback()
+		sentry.CaptureException(err)
+		svc.Logger.Errorf("Could not lock failed payment invoice user_id:%v invoice_id:%v error %s", invoice.UserID, invoice.ID, err.Error())
+		return err
+	}
+	if currentState == common.InvoiceStateError || currentState == common.InvoiceStateSettled {
+		tx.Rollback()
+		svc.Logger.Infof("Failed payment was already handled: user_id:%v invoice_id:%v state:%s", invoice.UserID, invoice.ID, currentState)
+		return nil
+	}
+
 	//revert the fee reserve if necessary
 	err = svc.RevertFeeReserve(ctx, &entryToRevert, invoice, tx)
 	if err != nil {
@@ -293,53 +554,116 @@ func (svc *LndhubService) HandleFailedPayment(ctx context.Context, invoice *mode
 		svc.Logger.Errorf("Failed to commit DB transaction user_id:%v invoice_id:%v  %v", invoice.UserID, invoice.ID, err)
 		return err
 	}
+	// the amount was credited back, so the payment can't succeed anymore
+	svc.sendPaymentFailedWebhooks(*invoice)
 	return err
 }
 
+// InsertTransactionEntry debits the amount, the service fee and the fee reserve of the payment from the user's balance.
+// An invoice that is not stored yet is stored in the same transaction, so it is never stored without its debit.
 func (svc *LndhubService) InsertTransactionEntry(ctx context.Context, invoice *models.Invoice, creditAccount, debitAccount, feeAccount models.Account) (entry models.TransactionEntry, err error) {
-	entry = models.TransactionEntry{
-		UserID:          invoice.UserID,
-		InvoiceID:       invoice.ID,
-		CreditAccountID: creditAccount.ID,
-		DebitAccountID:  debitAccount.ID,
-		Amount:          invoice.Amount,
-		EntryType:       models.EntryTypeOutgoing,
-	}
+	newInvoice := invoice.ID == 0
+	// a failed transaction was rolled back, so it can be run again
+	err = svc.withDBRetry(ctx, func() error {
+		return svc.WithTx(ctx, func(tx bun.Tx) error {
+			if newInvoice {
+				// not the id of a rolled back attempt
+				invoice.ID = 0
+				if _, err := tx.NewInsert().Model(invoice).Exec(ctx); err != nil {
+					return err
+				}
+			}
+			entry = models.TransactionEntry{
+				UserID:          invoice.UserID,
+				InvoiceID:       invoice.ID,
+				CreditAccountID: creditAccount.ID,
+				DebitAccountID:  debitAccount.ID,
+				Amount:          invoice.Amount,
+				EntryType:       models.EntryTypeOutgoing,
+			}
 
-	tx, err := svc.DB.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return entry, err
-	}
+			// concurrent payments of the user wait here until this transaction is done,
+			// so they can't pass the balance check with the same balance
+			feeLimit := svc.invoiceFeeLimit(invoice.DestinationPubkeyHex, invoice)
+			balance, err := svc.lockedAccountBalance(ctx, tx, debitAccount.ID)
+			if err != nil {
+				return err
+			}
+			// payments waiting for their confirmation keep their part of the balance
+			reserved, err := svc.reservedBalance(ctx, tx, invoice.UserID)
+			if err != nil {
+				return err
+			}
+			balance -= reserved
+			invoice.ServiceFee = svc.CalcServiceFee(invoice.DestinationPubkeyHex, invoice.Amount)
+			minimumBalance := svc.PaymentReserve(invoice.DestinationPubkeyHex, invoice.Amount, feeLimit)
+			if balance < minimumBalance {
+				svc.Logger.Errorf("Not enough balance for payment user_id:%v invoice_id:%v balance:%v amount:%v", invoice.UserID, invoice.ID, balance, invoice.Amount)
+				return ErrNotEnoughBalance
+			}
+			exceeded, err := svc.dailyOutboundLimitExceeded(ctx, tx, invoice.Amount, invoice.UserID)
+			if err != nil {
+				return err
+			}
+			if exceeded {
+				return ErrDailyLimitExceeded
+			}
 
-	// The DB constraints make sure the user actually has enough balance for the transaction
-	// If the user does not have enough balance this call fails
-	_, err = tx.NewInsert().Model(&entry).Exec(ctx)
-	if err != nil {
-		return entry, err
-	}
+			// The DB constraints make sure the user actually has enough balance for the transaction
+			// If the user does not have enough balance this call fails
+			_, err = tx.NewInsert().Model(&entry).Exec(ctx)
+			if err != nil {
+				return err
+			}
 
-	//if external payment: add fee reserve to entry
-	feeLimit := svc.CalcFeeLimit(invoice.DestinationPubkeyHex, invoice.Amount)
-	if feeLimit != 0 {
-		feeReserveEntry := models.TransactionEntry{
-			UserID:          invoice.UserID,
-			InvoiceID:       invoice.ID,
-			CreditAccountID: feeAccount.ID,
-			DebitAccountID:  debitAccount.ID,
-			Amount:          feeLimit,
-			EntryType:       models.EntryTypeFeeReserve,
-		}
-		_, err = tx.NewInsert().Model(&feeReserveEntry).Exec(ctx)
-		if err != nil {
-			return entry, err
-		}
-		entry.FeeReserve = &feeReserveEntry
+			if invoice.ServiceFee > 0 {
+				// stored right away so that a payment that is finished by the payment tracker is charged as well
+				_, err = tx.NewUpdate().Model(invoice).Column("service_fee").WherePK().Exec(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			//if external payment: add fee reserve to entry
+			//the service fee is reserved with the routing fee and booked when the payment succeeded
+			if feeLimit+invoice.ServiceFee != 0 {
+				feeReserveEntry := models.TransactionEntry{
+					UserID:          invoice.UserID,
+					InvoiceID:       invoice.ID,
+					CreditAccountID: feeAccount.ID,
+					DebitAccountID:  debitAccount.ID,
+					Amount:          feeLimit + invoice.ServiceFee,
+					EntryType:       models.EntryTypeFeeReserve,
+				}
+				_, err = tx.NewInsert().Model(&feeReserveEntry).Exec(ctx)
+				if err != nil {
+					return err
+				}
+				entry.FeeReserve = &feeReserveEntry
+			}
+			if feeLimit == 0 && !svc.LndClient.IsIdentityPubkey(invoice.DestinationPubkeyHex) && svc.IsZeroFeeDestination(invoice.DestinationPubkeyHex) {
+				svc.Logger.Infof("Paying zero fee destination without a fee reserve invoice_id:%v destination:%s", invoice.ID, invoice.DestinationPubkeyHex)
+			}
+			return nil
+		})
+	})
+	if err != nil && newInvoice {
+		// the invoice was rolled back
+		invoice.ID = 0
 	}
-	err = tx.Commit()
+	return entry, err
+}
+
+// lockedAccountBalance locks the account until the end of the transaction and returns its balance
+func (svc *LndhubService) lockedAccountBalance(ctx context.Context, tx bun.Tx, accountId int64) (int64, error) {
+	var lockedId int64
+	err := tx.NewSelect().Model((*models.Account)(nil)).Column("id").Where("id = ?", accountId).For("UPDATE").Scan(ctx, &lockedId)
 	if err != nil {
-		return entry, err
+		return 0, err
 	}
-	return entry, err
+	var balance int64
+	err = tx.NewSelect().Table("account_ledgers").ColumnExpr("COALESCE(SUM(account_ledgers.amount), 0)").Where("account_ledgers.account_id = ?", accountId).Scan(ctx, &balance)
+	return balance, err
 }
 
 func (svc *LndhubService) RevertFeeReserve(ctx context.Context, entry *models.TransactionEntry, invoice *models.Invoice, tx bun.Tx) (err error) {
@@ -375,6 +699,19 @@ func (svc *LndhubService) AddFeeEntry(ctx context.Context, entry *models.Transac
 			EntryType:       models.EntryTypeFee,
 		}
 		_, err = tx.NewInsert().Model(&entry).Exec(ctx)
+		if err != nil || invoice.ServiceFee == 0 {
+			return err
+		}
+		serviceFeeEntry := models.TransactionEntry{
+			UserID:          invoice.UserID,
+			InvoiceID:       invoice.ID,
+			CreditAccountID: entry.CreditAccountID,
+			DebitAccountID:  entry.DebitAccountID,
+			Amount:          invoice.ServiceFee,
+			ParentID:        entry.ParentID,
+			EntryType:       models.EntryTypeServiceFee,
+		}
+		_, err = tx.NewInsert().Model(&serviceFeeEntry).Exec(ctx)
 		return err
 	}
 	return nil
@@ -435,13 +772,19 @@ func (svc *LndhubService) HandleSuccessfulPayment(ctx context.Context, invoice *
 		svc.Logger.Info(amountMsg)
 		sentry.CaptureMessage(amountMsg)
 	}
+	svc.publishAccountEvent(*invoice)
 	svc.InvoicePubSub.Publish(common.InvoiceTypeOutgoing, *invoice)
 
 	return nil
 }
 
 func (svc *LndhubService) AddOutgoingInvoice(ctx context.Context, userID int64, paymentRequest string, lnPayReq *lnd.LNPayReq) (*models.Invoice, *responses.ErrorResponse) {
-	// Initialize new DB invoice
+	return svc.AddIdempotentOutgoingInvoice(ctx, userID, paymentRequest, lnPayReq, "", "", "")
+}
+
+// NewOutgoingInvoice returns the outgoing invoice of the payment without storing it, PayInvoice stores it in the
+// transaction that debits the user. The label is only stored for the user and not sent with the payment.
+func (svc *LndhubService) NewOutgoingInvoice(userID int64, paymentRequest string, lnPayReq *lnd.LNPayReq, label string) (*models.Invoice, error) {
 	invoice := models.Invoice{
 		Type:                 common.InvoiceTypeOutgoing,
 		UserID:               userID,
@@ -453,70 +796,303 @@ func (svc *LndhubService) AddOutgoingInvoice(ctx context.Context, userID int64,
 		DescriptionHash:      lnPayReq.PayReq.DescriptionHash,
 		Memo:                 lnPayReq.PayReq.Description,
 		Keysend:              lnPayReq.Keysend,
+		Offer:                lnPayReq.Offer,
 		ExpiresAt:            bun.NullTime{Time: time.Unix(lnPayReq.PayReq.Timestamp, 0).Add(time.Duration(lnPayReq.PayReq.Expiry) * time.Second)},
+		Label:                label,
 	}
 
 	if lnPayReq.Keysend {
 		preImage, err := makePreimageHex()
 		if err != nil {
-			svc.Logger.Errorf("Error adding invoice: user_id:%v error: %v", userID, err)
-			return nil, &responses.GeneralServerError
+			return nil, err
 		}
 		pHash := sha256.New()
 		pHash.Write(preImage)
-	
+
 		invoice.RHash = hex.EncodeToString(pHash.Sum(nil))
 		invoice.Preimage = hex.EncodeToString(preImage)
 	}
+	return &invoice, nil
+}
+
+// AddIdempotentOutgoingInvoice stores the idempotency key and the hash of the request together with the outgoing invoice.
+// An empty key creates a regular outgoing invoice. The label is only stored for the user and not sent with the payment.
+func (svc *LndhubService) AddIdempotentOutgoingInvoice(ctx context.Context, userID int64, paymentRequest string, lnPayReq *lnd.LNPayReq, idempotencyKey, requestHash, label string) (*models.Invoice, *responses.ErrorResponse) {
+	invoice, err := svc.NewOutgoingInvoice(userID, paymentRequest, lnPayReq, label)
+	if err != nil {
+		svc.Logger.Errorf("Error adding invoice: user_id:%v error: %v", userID, err)
+		return nil, &responses.GeneralServerError
+	}
+	invoice.IdempotencyKey = idempotencyKey
+	invoice.IdempotencyHash = requestHash
 
 	// Save invoice
-	_, err := svc.DB.NewInsert().Model(&invoice).Exec(ctx)
+	_, err = svc.DB.NewInsert().Model(invoice).Exec(ctx)
 	if err != nil {
 		svc.Logger.Errorf("Error adding invoice: user_id:%v error: %v", userID, err)
+		// the key was taken by a concurrent request
+		if idempotencyKey != "" {
+			existing, findErr := svc.FindInvoiceByIdempotencyKey(ctx, userID, idempotencyKey)
+			if findErr == nil && existing != nil {
+				return nil, &responses.IdempotencyKeyConflictError
+			}
+		}
 		return nil, &responses.GeneralServerError
 	}
+	return invoice, nil
+}
+
+// FindInvoiceByIdempotencyKey returns the outgoing invoice that was created with the idempotency key, or nil if there is none.
+// Keys older than the configured TTL are released so that they can be used again.
+func (svc *LndhubService) FindInvoiceByIdempotencyKey(ctx context.Context, userId int64, idempotencyKey string) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := svc.DB.NewSelect().Model(&invoice).Where("invoice.user_id = ? AND invoice.idempotency_key = ?", userId, idempotencyKey).Limit(1).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ttl := time.Duration(svc.Config.IdempotencyKeyTTL) * time.Second
+	if time.Since(invoice.CreatedAt) > ttl {
+		_, err = svc.DB.NewUpdate().Model(&invoice).Set("idempotency_key = NULL").WherePK().Exec(ctx)
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// idempotencyPollInterval is how often WaitForIdempotentPayment looks up the invoice
+const idempotencyPollInterval = 200 * time.Millisecond
+
+// WaitForIdempotentPayment waits until the payment of an invoice that was created with an idempotency key is settled or
+// failed. The invoice is returned in the state it has when the wait timeout passes or the context is canceled.
+func (svc *LndhubService) WaitForIdempotentPayment(ctx context.Context, invoice *models.Invoice) (*models.Invoice, error) {
+	deadline := time.Now().Add(time.Duration(svc.Config.IdempotencyWaitTimeout) * time.Second)
+	for !idempotentPaymentDone(invoice) && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return invoice, nil
+		case <-time.After(idempotencyPollInterval):
+		}
+		var updated models.Invoice
+		err := svc.DB.NewSelect().Model(&updated).Where("id = ?", invoice.ID).Limit(1).Scan(ctx)
+		if err != nil {
+			return invoice, err
+		}
+		invoice = &updated
+	}
+	return invoice, nil
+}
+
+func idempotentPaymentDone(invoice *models.Invoice) bool {
+	switch invoice.State {
+	case common.InvoiceStateSettled, common.InvoiceStateError, common.InvoiceStateAborted:
+		return true
+	}
+	return false
+}
+
+// FindInvoiceByClientInvoiceID returns the incoming invoice that was created with the client invoice id, or nil if there is none
+func (svc *LndhubService) FindInvoiceByClientInvoiceID(ctx context.Context, userId int64, clientInvoiceID string) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := svc.DB.NewSelect().Model(&invoice).Where("invoice.user_id = ? AND invoice.client_invoice_id = ?", userId, clientInvoiceID).Limit(1).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
 	return &invoice, nil
 }
 
-func (svc *LndhubService) AddIncomingInvoice(ctx context.Context, userID int64, amount int64, memo, descriptionHashStr string) (*models.Invoice, *responses.ErrorResponse) {
+// repeatedIncomingInvoice returns the invoice that was already created with the client invoice id of the new invoice,
+// or nil if the id was not used yet. Using the id for a different invoice is a conflict.
+func (svc *LndhubService) repeatedIncomingInvoice(ctx context.Context, invoice *models.Invoice) (*models.Invoice, *responses.ErrorResponse) {
+	existing, err := svc.FindInvoiceByClientInvoiceID(ctx, invoice.UserID, invoice.ClientInvoiceID)
+	if err != nil {
+		svc.Logger.Errorf("Failed to look up client invoice id user_id:%v error: %v", invoice.UserID, err)
+		return nil, &responses.GeneralServerError
+	}
+	if existing == nil {
+		return nil, nil
+	}
+	expected := *invoice
+	if expected.Memo == "" && expected.DescriptionHash == "" {
+		// the default memo of the first request was rendered with its amount
+		expected.Memo = svc.defaultMemo(ctx, existing.UserID, existing.Amount)
+	}
+	if !sameIncomingInvoice(existing, &expected) {
+		svc.Logger.Errorf("Client invoice id reused with a different invoice invoice_id:%v user_id:%v", existing.ID, invoice.UserID)
+		return nil, &responses.ClientInvoiceIdConflictError
+	}
+	// the first request did not get the invoice from the node yet
+	if existing.State == common.InvoiceStateInitialized {
+		return nil, &responses.ClientInvoiceIdInProgressError
+	}
+	return existing, nil
+}
+
+// sameIncomingInvoice checks if the new invoice was requested like the existing one, the amount of fiat invoices
+// depends on the price when they were created so their fiat amount is compared instead
+func sameIncomingInvoice(existing, invoice *models.Invoice) bool {
+	if existing.Memo != invoice.Memo || existing.DescriptionHash != invoice.DescriptionHash || existing.ZapRequest != invoice.ZapRequest {
+		return false
+	}
+	if invoice.FiatAmount > 0 || existing.FiatAmount > 0 {
+		return existing.FiatCurrency == invoice.FiatCurrency && existing.FiatAmount == invoice.FiatAmount
+	}
+	return existing.Amount == invoice.Amount
+}
+
+// AddIncomingInvoice creates an invoice which expires after expirySeconds, 0 uses the configured default expiry.
+// A repeated request with the same non-empty client invoice id returns the invoice of the first request.
+// With includePrivateHints the payment request has route hints for the private channels of the node, which
+// is needed to receive through private channels but reveals them to the payer.
+func (svc *LndhubService) AddIncomingInvoice(ctx context.Context, userID int64, amount int64, memo, descriptionHashStr string, expirySeconds int64, clientInvoiceID string, includePrivateHints bool) (*models.Invoice, *responses.ErrorResponse) {
+	return svc.addIncomingInvoice(ctx, models.Invoice{
+		UserID:            userID,
+		Amount:            amount,
+		Memo:              memo,
+		DescriptionHash:   descriptionHashStr,
+		Expiry:            expirySeconds,
+		ClientInvoiceID:   clientInvoiceID,
+		PrivateRouteHints: includePrivateHints,
+	})
+}
+
+// PendingInvoiceCount returns the number of incoming invoices of the user that are neither paid nor expired
+func (svc *LndhubService) PendingInvoiceCount(ctx context.Context, userId int64) (int, error) {
+	return svc.DB.NewSelect().Model((*models.Invoice)(nil)).
+		Where("user_id = ? AND type = ?", userId, common.InvoiceTypeIncoming).
+		Where("state IN (?)", bun.In([]string{common.InvoiceStateInitialized, common.InvoiceStateOpen})).
+		Where("expires_at > ?", time.Now()).
+		Count(ctx)
+}
+
+// checkPendingInvoiceLimit rejects a new invoice when the user already has MAX_PENDING_INVOICES_PER_USER pending invoices.
+// Concurrent requests can exceed the limit by a few invoices, it is meant to stop flooding the node, not as an exact quota.
+func (svc *LndhubService) checkPendingInvoiceLimit(ctx context.Context, userId int64) *responses.ErrorResponse {
+	if svc.Config.MaxPendingInvoicesPerUser <= 0 {
+		return nil
+	}
+	count, err := svc.PendingInvoiceCount(ctx, userId)
+	if err != nil {
+		svc.Logger.Errorf("Could not count pending invoices user_id:%v error: %v", userId, err)
+		return &responses.GeneralServerError
+	}
+	if count >= svc.Config.MaxPendingInvoicesPerUser {
+		svc.Logger.Errorf("Too many pending invoices user_id:%v count:%v", userId, count)
+		return &responses.TooManyPendingInvoicesError
+	}
+	return nil
+}
+
+// ValidateMemo checks that the memo fits into the description of an invoice and has no control characters
+func ValidateMemo(memo string) *responses.ErrorResponse {
+	if len(memo) > MaxMemoLength {
+		return &responses.ErrorResponse{
+			Error:          true,
+			Code:           responses.BadArgumentsError.Code,
+			Message:        fmt.Sprintf("memo is longer than %d bytes, use a description_hash for longer descriptions", MaxMemoLength),
+			HttpStatusCode: responses.BadArgumentsError.HttpStatusCode,
+		}
+	}
+	if !utf8.ValidString(memo) || strings.IndexFunc(memo, unicode.IsControl) >= 0 {
+		return &responses.ErrorResponse{
+			Error:          true,
+			Code:           responses.BadArgumentsError.Code,
+			Message:        "memo must be valid UTF-8 without control characters",
+			HttpStatusCode: responses.BadArgumentsError.HttpStatusCode,
+		}
+	}
+	return nil
+}
+
+// checkMaxInvoiceAmount rejects invoices above MaxInvoiceAmountSats. Unlike the max receive amount of the user
+// limits it applies to all users, zero means unlimited. With a maximum invoices without an amount are rejected too,
+// as the payer could pay any amount.
+func (svc *LndhubService) checkMaxInvoiceAmount(amount int64) *responses.ErrorResponse {
+	if svc.Config.MaxInvoiceAmountSats > 0 && amount == 0 {
+		return &responses.AmountlessInvoiceNotAllowedError
+	}
+	if svc.exceedsMaxInvoiceAmount(amount) {
+		svc.Logger.Errorf("Invoice amount exceeds the maximum amount:%v max_invoice_amount:%v", amount, svc.Config.MaxInvoiceAmountSats)
+		return &responses.InvoiceAmountTooHighError
+	}
+	return nil
+}
+
+// exceedsMaxInvoiceAmount reports if a received amount is above MaxInvoiceAmountSats
+func (svc *LndhubService) exceedsMaxInvoiceAmount(amount int64) bool {
+	return svc.Config.MaxInvoiceAmountSats > 0 && amount > svc.Config.MaxInvoiceAmountSats
+}
+
+// addIncomingInvoice creates the invoice with the user, amount, memo, description hash, expiry, route hints
+// and the optional zap request, fiat amount and client invoice id of the given invoice
+func (svc *LndhubService) addIncomingInvoice(ctx context.Context, invoice models.Invoice) (*models.Invoice, *responses.ErrorResponse) {
+	if errResp := ValidateMemo(invoice.Memo); errResp != nil {
+		return nil, errResp
+	}
+	if errResp := svc.checkMaxInvoiceAmount(invoice.Amount); errResp != nil {
+		return nil, errResp
+	}
+	// a retried request neither counts towards the pending invoices nor creates a new invoice
+	if invoice.ClientInvoiceID != "" {
+		existing, errResp := svc.repeatedIncomingInvoice(ctx, &invoice)
+		if errResp != nil || existing != nil {
+			return existing, errResp
+		}
+	}
+	if invoice.Memo == "" && invoice.DescriptionHash == "" {
+		invoice.Memo = svc.defaultMemo(ctx, invoice.UserID, invoice.Amount)
+	}
+	if errResp := svc.checkPendingInvoiceLimit(ctx, invoice.UserID); errResp != nil {
+		return nil, errResp
+	}
+	if errResp := svc.checkInboundLiquidity(ctx, invoice.Amount); errResp != nil {
+		return nil, errResp
+	}
+	userID := invoice.UserID
 	preimage, err := makePreimageHex()
 	if err != nil {
 		return nil, &responses.GeneralServerError
 	}
-	expiry := time.Hour * 24 // invoice expires in 24h
-	// Initialize new DB invoice
-	invoice := models.Invoice{
-		Type:            common.InvoiceTypeIncoming,
-		UserID:          userID,
-		Amount:          amount,
-		Memo:            memo,
-		DescriptionHash: descriptionHashStr,
-		State:           common.InvoiceStateInitialized,
-		ExpiresAt:       bun.NullTime{Time: time.Now().Add(expiry)},
+	if invoice.Expiry == 0 {
+		invoice.Expiry = svc.Config.DefaultInvoiceExpiry
 	}
+	expiry := time.Duration(invoice.Expiry) * time.Second
+	// Initialize new DB invoice
+	invoice.Type = common.InvoiceTypeIncoming
+	invoice.State = common.InvoiceStateInitialized
+	invoice.ExpiresAt = bun.NullTime{Time: time.Now().Add(expiry)}
 
 	// Save invoice - we save the invoice early to have a record in case the LN call fails
 	_, err = svc.DB.NewInsert().Model(&invoice).Exec(ctx)
 	if err != nil {
+		// the client invoice id was taken by a concurrent request
+		if invoice.ClientInvoiceID != "" {
+			existing, errResp := svc.repeatedIncomingInvoice(ctx, &invoice)
+			if errResp != nil || existing != nil {
+				return existing, errResp
+			}
+		}
 		return nil, &responses.GeneralServerError
 	}
 
-	descriptionHash, err := hex.DecodeString(descriptionHashStr)
+	lnInvoice, err := nodeInvoiceRequest(&invoice, preimage)
 	if err != nil {
 		return nil, &responses.GeneralServerError
 	}
-	// Initialize lnrpc invoice
-	lnInvoice := lnrpc.Invoice{
-		Memo:            memo,
-		DescriptionHash: descriptionHash,
-		Value:           amount,
-		RPreimage:       preimage,
-		Expiry:          int64(expiry.Seconds()),
-	}
 	// Call LND
-	lnInvoiceResult, err := svc.LndClient.AddInvoice(ctx, &lnInvoice)
+	lnInvoiceResult, err := svc.LndClient.AddInvoice(ctx, lnInvoice)
 	if err != nil {
 		svc.Logger.Errorf("Error creating invoice: user_id:%v error: %v", userID, err)
+		// the client can retry with the same id
+		if invoice.ClientInvoiceID != "" {
+			if _, err := svc.DB.NewUpdate().Model(&invoice).Set("client_invoice_id = NULL").WherePK().Exec(ctx); err != nil {
+				svc.Logger.Errorf("Failed to release client invoice id invoice_id:%v error: %v", invoice.ID, err)
+			}
+		}
 		return nil, &responses.GeneralServerError
 	}
 
@@ -532,14 +1108,58 @@ func (svc *LndhubService) AddIncomingInvoice(ctx context.Context, userID int64,
 	if err != nil {
 		return nil, &responses.GeneralServerError
 	}
+	svc.Metrics.invoiceCreated()
 
 	return &invoice, nil
 }
 
+// nodeInvoiceRequest is the request to create the incoming invoice with the preimage on the node
+func nodeInvoiceRequest(invoice *models.Invoice, preimage []byte) (*lnrpc.Invoice, error) {
+	descriptionHash, err := hex.DecodeString(invoice.DescriptionHash)
+	if err != nil {
+		return nil, err
+	}
+	lnInvoice := &lnrpc.Invoice{
+		Memo:            invoice.Memo,
+		DescriptionHash: descriptionHash,
+		ValueMsat:       invoice.Amount * 1000,
+		RPreimage:       preimage,
+		Expiry:          invoice.Expiry,
+		Private:         invoice.PrivateRouteHints,
+	}
+	// the invoice commits to the hash of the external metadata (e.g. LNURL-pay) instead of the memo,
+	// the memo is only kept in our database
+	if len(descriptionHash) > 0 {
+		lnInvoice.Memo = ""
+	}
+	return lnInvoice, nil
+}
+
 func (svc *LndhubService) DecodePaymentRequest(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+	// fail fast without asking the node to decode something that can't be an invoice
+	if len(bolt11) > MaxPaymentRequestLength {
+		return nil, ErrPaymentRequestTooLong
+	}
+	if err := svc.CheckPaymentRequestNetwork(ctx, bolt11); err != nil {
+		return nil, err
+	}
 	return svc.LndClient.DecodeBolt11(ctx, bolt11)
 }
 
+// PaymentRequestExpired checks the expiry of a decoded invoice, allowing INVOICE_EXPIRY_GRACE seconds of clock skew
+func (svc *LndhubService) PaymentRequestExpired(payReq *lnrpc.PayReq) bool {
+	return payReq.Timestamp+payReq.Expiry+svc.Config.InvoiceExpiryGrace < time.Now().Unix()
+}
+
+// detachedContext returns a context that is not canceled together with the parent
+// but does inherit the parent's deadline, if any
+func detachedContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := parent.Deadline(); ok {
+		return context.WithDeadline(context.Background(), deadline)
+	}
+	return context.WithCancel(context.Background())
+}
+
 func makePreimageHex() ([]byte, error) {
 	bytes := make([]byte, 32) // 32 bytes * 8 bits/byte = 256 bits
 	_, err := rand.Read(bytes)
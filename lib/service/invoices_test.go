@@ -1,11 +1,18 @@
 package service
 
 import (
+	"context"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
 )
 
 var svc = &LndhubService{
@@ -56,3 +63,185 @@ func TestCalcFeeWithMaxGlobalFee(t *testing.T) {
 	expectedFee := svc.Config.MaxFeeAmount
 	assert.Equal(t, expectedFee, feeLimit)
 }
+
+func TestCalcFeeLimitStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy FeeLimitStrategy
+		amount   int64
+		expected int64
+	}{
+		// 2% of 1000 and the fixed limit of 20 are equal
+		{name: "percent at the boundary", strategy: FeeLimitStrategyPercent, amount: 1000, expected: 20},
+		{name: "fixed at the boundary", strategy: FeeLimitStrategyFixed, amount: 1000, expected: 20},
+		{name: "max at the boundary", strategy: FeeLimitStrategyMax, amount: 1000, expected: 20},
+		// below the boundary the fixed limit is higher
+		{name: "percent below the boundary", strategy: FeeLimitStrategyPercent, amount: 500, expected: 10},
+		{name: "fixed below the boundary", strategy: FeeLimitStrategyFixed, amount: 500, expected: 20},
+		{name: "max below the boundary", strategy: FeeLimitStrategyMax, amount: 500, expected: 20},
+		// above the boundary the percent limit is higher, partial sats are rounded up
+		{name: "percent above the boundary", strategy: FeeLimitStrategyPercent, amount: 1001, expected: 21},
+		{name: "fixed above the boundary", strategy: FeeLimitStrategyFixed, amount: 1001, expected: 20},
+		{name: "max above the boundary", strategy: FeeLimitStrategyMax, amount: 1001, expected: 21},
+		{name: "default", strategy: FeeLimitStrategyDefault, amount: 1500, expected: 16},
+		// capped by the max fee amount
+		{name: "percent capped", strategy: FeeLimitStrategyPercent, amount: 100000, expected: 1000},
+		{name: "max capped", strategy: FeeLimitStrategyMax, amount: 100000, expected: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategySvc := &LndhubService{
+				LndClient: &lnd.LNDWrapper{IdentityPubkey: "123pubkey"},
+				Config: &Config{
+					MaxFeeAmount:     1000,
+					FeeLimitStrategy: tt.strategy,
+					FeeLimitPercent:  2,
+					FeeLimitFixed:    20,
+				},
+			}
+			assert.Equal(t, tt.expected, strategySvc.CalcFeeLimit("dummy", tt.amount))
+			// payments to our own node don't need a fee
+			assert.Equal(t, int64(0), strategySvc.CalcFeeLimit("123pubkey", tt.amount))
+		})
+	}
+}
+
+func TestCalcFeeLimitZeroFeeDestinations(t *testing.T) {
+	zeroFeeSvc := &LndhubService{
+		LndClient: &lnd.LNDWrapper{IdentityPubkey: "123pubkey"},
+		Config: &Config{
+			MaxFeeAmount:        1000,
+			ZeroFeeDestinations: []string{"02abcdef", "03FEDCBA"},
+		},
+	}
+	assert.Equal(t, int64(0), zeroFeeSvc.CalcFeeLimit("02abcdef", 10000))
+	// pubkeys are compared case insensitive
+	assert.Equal(t, int64(0), zeroFeeSvc.CalcFeeLimit("03fedcba", 10000))
+	assert.Equal(t, int64(101), zeroFeeSvc.CalcFeeLimit("02other", 10000))
+	// the client can't request a fee for these destinations
+	assert.Equal(t, int64(0), zeroFeeSvc.CalcClientFeeLimit("02abcdef", 10000, 50, 0))
+	assert.True(t, zeroFeeSvc.IsZeroFeeDestination("123pubkey"))
+	assert.False(t, zeroFeeSvc.IsZeroFeeDestination("02other"))
+}
+
+func TestCalcServiceFee(t *testing.T) {
+	serviceFeeSvc := &LndhubService{
+		LndClient: &lnd.LNDWrapper{IdentityPubkey: "123pubkey"},
+		Config:    &Config{},
+	}
+	// no fee is configured by default
+	assert.Equal(t, int64(0), serviceFeeSvc.CalcServiceFee("02other", 10000))
+	serviceFeeSvc.Config.ServiceFeePercent = 0.5
+	serviceFeeSvc.Config.ServiceFeeFixed = 2
+	assert.Equal(t, int64(52), serviceFeeSvc.CalcServiceFee("02other", 10000))
+	// the percentage is rounded up
+	assert.Equal(t, int64(3), serviceFeeSvc.CalcServiceFee("02other", 10))
+	// payments to our own node are not charged
+	assert.Equal(t, int64(0), serviceFeeSvc.CalcServiceFee("123pubkey", 10000))
+}
+
+func TestCalcReceiveFee(t *testing.T) {
+	receiveFeeSvc := &LndhubService{
+		Config: &Config{ReceiveFeePercent: 1, MinReceiveSats: 100, MinReceivePolicy: MinReceivePolicyOperator},
+	}
+	assert.Equal(t, int64(10), receiveFeeSvc.CalcReceiveFee(1000))
+	// the percentage is rounded up
+	assert.Equal(t, int64(2), receiveFeeSvc.CalcReceiveFee(101))
+	// the minimum is compared to the amount before the fee
+	assert.Equal(t, int64(1), receiveFeeSvc.CalcReceiveFee(100))
+	assert.Equal(t, int64(99), receiveFeeSvc.CalcReceiveFee(99))
+	receiveFeeSvc.Config.MinReceivePolicy = MinReceivePolicyCreditWithoutFee
+	assert.Equal(t, int64(0), receiveFeeSvc.CalcReceiveFee(99))
+	// no fee and no minimum by default
+	assert.Equal(t, int64(0), (&LndhubService{Config: &Config{}}).CalcReceiveFee(1))
+}
+
+func TestCheckMaxInvoiceAmount(t *testing.T) {
+	maxInvoiceSvc := &LndhubService{
+		Config: &Config{MaxInvoiceAmountSats: 1000, LNURLMaxSendable: 1e8},
+		Logger: lecho.New(io.Discard),
+	}
+	assert.Nil(t, maxInvoiceSvc.checkMaxInvoiceAmount(1000))
+	assert.Equal(t, &responses.InvoiceAmountTooHighError, maxInvoiceSvc.checkMaxInvoiceAmount(1001))
+	// invoices without an amount could be paid with any amount
+	assert.Equal(t, &responses.AmountlessInvoiceNotAllowedError, maxInvoiceSvc.checkMaxInvoiceAmount(0))
+	invoice, errResp := maxInvoiceSvc.AddIncomingInvoice(context.Background(), 1, 0, "", "", 0, "", false)
+	assert.Nil(t, invoice)
+	assert.Equal(t, &responses.AmountlessInvoiceNotAllowedError, errResp)
+	// keysend and offer payments are received without an invoice of ours
+	assert.False(t, maxInvoiceSvc.exceedsMaxInvoiceAmount(1000))
+	assert.True(t, maxInvoiceSvc.exceedsMaxInvoiceAmount(1001))
+	// rejected before the node or the database is used
+	invoice, errResp = maxInvoiceSvc.AddIncomingInvoice(context.Background(), 1, 1001, "", "", 0, "", false)
+	assert.Nil(t, invoice)
+	assert.Equal(t, &responses.InvoiceAmountTooHighError, errResp)
+	// lnurl-pay doesn't offer more than can be invoiced
+	assert.Equal(t, int64(1000000), maxInvoiceSvc.LNURLPayMaxSendable(&Limits{}))
+
+	// unlimited by default
+	assert.Nil(t, (&LndhubService{Config: &Config{}}).checkMaxInvoiceAmount(1e8))
+	assert.Nil(t, (&LndhubService{Config: &Config{}}).checkMaxInvoiceAmount(0))
+}
+
+func TestMinReceivePolicyDecode(t *testing.T) {
+	var policy MinReceivePolicy
+	assert.NoError(t, policy.Decode("credit_without_fee"))
+	assert.Equal(t, MinReceivePolicyCreditWithoutFee, policy)
+	// settled payments can't be refunded
+	assert.Error(t, policy.Decode("refund"))
+}
+
+func TestPaymentRequestExpired(t *testing.T) {
+	expirySvc := &LndhubService{Config: &Config{}}
+	now := time.Now().Unix()
+	assert.False(t, expirySvc.PaymentRequestExpired(&lnrpc.PayReq{Timestamp: now - 100, Expiry: 3600}))
+	assert.True(t, expirySvc.PaymentRequestExpired(&lnrpc.PayReq{Timestamp: now - 3630, Expiry: 3600}))
+	// the clock of the payee might be behind
+	expirySvc.Config.InvoiceExpiryGrace = 60
+	assert.False(t, expirySvc.PaymentRequestExpired(&lnrpc.PayReq{Timestamp: now - 3630, Expiry: 3600}))
+	assert.True(t, expirySvc.PaymentRequestExpired(&lnrpc.PayReq{Timestamp: now - 3700, Expiry: 3600}))
+}
+
+func TestFeeLimitStrategyDecode(t *testing.T) {
+	var strategy FeeLimitStrategy
+	assert.NoError(t, strategy.Decode("max"))
+	assert.Equal(t, FeeLimitStrategyMax, strategy)
+	assert.Error(t, strategy.Decode("maximum"))
+}
+
+func TestSelfPaymentPolicyDecode(t *testing.T) {
+	var policy SelfPaymentPolicy
+	assert.NoError(t, policy.Decode("allow"))
+	assert.Equal(t, SelfPaymentPolicyAllow, policy)
+	assert.Error(t, policy.Decode("warn"))
+}
+
+func TestValidateMemo(t *testing.T) {
+	assert.Nil(t, ValidateMemo(""))
+	assert.Nil(t, ValidateMemo("coffee ☕"))
+	assert.Nil(t, ValidateMemo(strings.Repeat("a", MaxMemoLength)))
+	errResp := ValidateMemo(strings.Repeat("a", MaxMemoLength+1))
+	assert.Equal(t, responses.BadArgumentsError.Code, errResp.Code)
+	assert.Contains(t, errResp.Message, "description_hash")
+	// the limit is in bytes, not characters
+	assert.NotNil(t, ValidateMemo(strings.Repeat("☕", MaxMemoLength/3+1)))
+	errResp = ValidateMemo("coffee\x00")
+	assert.Equal(t, responses.BadArgumentsError.Code, errResp.Code)
+	assert.Equal(t, "memo must be valid UTF-8 without control characters", errResp.Message)
+	assert.NotNil(t, ValidateMemo("line\nbreak"))
+	assert.NotNil(t, ValidateMemo("\xff"))
+}
+
+func TestSameIncomingInvoice(t *testing.T) {
+	existing := &models.Invoice{Amount: 100, Memo: "coffee", DescriptionHash: "abcd"}
+	assert.True(t, sameIncomingInvoice(existing, &models.Invoice{Amount: 100, Memo: "coffee", DescriptionHash: "abcd"}))
+	assert.False(t, sameIncomingInvoice(existing, &models.Invoice{Amount: 101, Memo: "coffee", DescriptionHash: "abcd"}))
+	assert.False(t, sameIncomingInvoice(existing, &models.Invoice{Amount: 100, Memo: "tea", DescriptionHash: "abcd"}))
+	assert.False(t, sameIncomingInvoice(existing, &models.Invoice{Amount: 100, Memo: "coffee"}))
+
+	// the amount of a retried fiat invoice is converted with the current price
+	fiat := &models.Invoice{Amount: 2500, Memo: "coffee", FiatCurrency: "USD", FiatAmount: 1.5}
+	assert.True(t, sameIncomingInvoice(fiat, &models.Invoice{Amount: 2480, Memo: "coffee", FiatCurrency: "USD", FiatAmount: 1.5}))
+	assert.False(t, sameIncomingInvoice(fiat, &models.Invoice{Amount: 2500, Memo: "coffee", FiatCurrency: "EUR", FiatAmount: 1.5}))
+	assert.False(t, sameIncomingInvoice(fiat, &models.Invoice{Amount: 2500, Memo: "coffee"}))
+}
@@ -20,12 +20,19 @@ import (
 
 var AlreadyProcessedKeysendError = errors.New("already processed keysend payment")
 
+// ErrInvoiceAmountTooHigh is returned for keysend and offer payments above MaxInvoiceAmountSats, which can't be capped
+// by an invoice
+var ErrInvoiceAmountTooHigh = errors.New("amount exceeds the maximum invoice amount")
+
 func (svc *LndhubService) HandleInternalKeysendPayment(ctx context.Context, invoice *models.Invoice) (result *models.Invoice, err error) {
 	//Find the payee user
-	user, err := svc.FindUserByLogin(ctx, string(invoice.DestinationCustomRecords[TLV_WALLET_ID]))
+	user, err := svc.keysendPayee(ctx, invoice.DestinationCustomRecords)
 	if err != nil {
 		return nil, err
 	}
+	if svc.exceedsMaxInvoiceAmount(invoice.Amount) {
+		return nil, ErrInvoiceAmountTooHigh
+	}
 	expiry := time.Hour * 24
 	incomingInvoice := models.Invoice{
 		Type:                     common.InvoiceTypeIncoming,
@@ -61,6 +68,9 @@ func (svc *LndhubService) HandleKeysendPayment(ctx context.Context, rawInvoice *
 	if count != 0 {
 		return AlreadyProcessedKeysendError
 	}
+	if svc.exceedsMaxInvoiceAmount(rawInvoice.AmtPaidSat) {
+		return ErrInvoiceAmountTooHigh
+	}
 
 	//construct the invoice
 	invoice, err = svc.createKeysendInvoice(ctx, rawInvoice)
@@ -83,12 +93,27 @@ func (svc *LndhubService) ProcessInvoiceUpdate(ctx context.Context, rawInvoice *
 
 	//Check if it's a keysend payment
 	//If it is, an invoice will be created on-the-fly
+	if rawInvoice.IsKeysend && svc.Config.DisableKeysendReceive {
+		// the node has already settled the payment, it can only be rejected by disabling accept-keysend in lnd
+		svc.Logger.Warnf("Keysend receiving is disabled, not crediting keysend payment r_hash:%s amount:%v", rHashStr, rawInvoice.AmtPaidSat)
+		return nil
+	}
 	if rawInvoice.IsKeysend {
 		err := svc.HandleKeysendPayment(ctx, rawInvoice)
 		if err != nil {
 			if err == AlreadyProcessedKeysendError {
 				return nil
 			}
+			if errors.Is(err, ErrUnknownKeysendAlias) {
+				// the payment is settled, so the amount stays with the node
+				svc.Logger.Warnf("Keysend payment to unknown alias not credited r_hash:%s amount:%v alias:%s", rHashStr, rawInvoice.AmtPaidSat, string(rawInvoice.Htlcs[0].CustomRecords[TLV_KEYSEND_ALIAS]))
+				return nil
+			}
+			if errors.Is(err, ErrInvoiceAmountTooHigh) {
+				// like with disabled keysend receiving the node has already settled the payment
+				svc.Logger.Warnf("Keysend payment above the maximum invoice amount not credited r_hash:%s amount:%v", rHashStr, rawInvoice.AmtPaidSat)
+				return nil
+			}
 			return err
 		}
 	}
@@ -97,6 +122,19 @@ func (svc *LndhubService) ProcessInvoiceUpdate(ctx context.Context, rawInvoice *
 		common.InvoiceTypeIncoming,
 		rHashStr,
 		common.InvoiceStateSettled).Limit(1).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) && svc.Config.EnableOffers && rawInvoice.Settled {
+		// the invoices of offer payments are created by the node
+		err = svc.createOfferInvoice(ctx, rawInvoice, &invoice)
+		if errors.Is(err, ErrInvoiceAmountTooHigh) {
+			// the node has already settled the payment
+			svc.Logger.Warnf("Offer payment above the maximum invoice amount not credited r_hash:%s amount:%v", rHashStr, rawInvoice.AmtPaidSat)
+			return nil
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			svc.Logger.Errorf("Could not store offer payment r_hash:%s error: %v", rHashStr, err)
+			return err
+		}
+	}
 	if err != nil {
 		svc.Logger.Infof("Invoice not found. Ignoring. r_hash:%s", rHashStr)
 		return nil
@@ -136,18 +174,44 @@ func (svc *LndhubService) ProcessInvoiceUpdate(ctx context.Context, rawInvoice *
 	if !rawInvoice.Settled {
 		svc.Logger.Infof("Invoice not settled invoice_id:%v state: %s", invoice.ID, rawInvoice.State.String())
 		invoice.State = strings.ToLower(rawInvoice.State.String())
+		// the payment of a hold invoice is held until the user settles or cancels it
+		// we store the state so that the user can see it is held, the amount is only credited once it is settled
+		if invoice.IsHold {
+			if rawInvoice.State == lnrpc.Invoice_ACCEPTED {
+				invoice.State = common.InvoiceStateHeld
+			}
+			_, err = tx.NewUpdate().Model(&invoice).WherePK().Exec(ctx)
+			if err != nil {
+				tx.Rollback()
+				svc.Logger.Errorf("Could not update hold invoice invoice_id:%v", invoice.ID)
+				return err
+			}
+		}
 
 	} else {
 		// if the invoice is settled we update the state and create an transaction entry to the current account
 		invoice.SettledAt = bun.NullTime{Time: time.Unix(rawInvoice.SettleDate, 0)}
 		invoice.State = common.InvoiceStateSettled
 		invoice.Amount = rawInvoice.AmtPaidSat
-		_, err = tx.NewUpdate().Model(&invoice).WherePK().Exec(ctx)
+		invoice.Fee = svc.CalcReceiveFee(invoice.Amount)
+		// the same settlement can be delivered twice, e.g. when the subscription is replayed after a reconnect.
+		// Only the update that settles the invoice credits the user
+		res, err := tx.NewUpdate().Model(&invoice).WherePK().Where("state <> ?", common.InvoiceStateSettled).Returning("id").Exec(ctx)
 		if err != nil {
 			tx.Rollback()
 			svc.Logger.Errorf("Could not update invoice invoice_id:%v", invoice.ID)
 			return err
 		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if rowsAffected == 0 {
+			tx.Rollback()
+			svc.Logger.Infof("Invoice already settled. Ignoring. invoice_id:%v r_hash:%s", invoice.ID, rHashStr)
+			return nil
+		}
 
 		// Transfer the amount from the user's incoming account to the user's current account
 		entry := models.TransactionEntry{
@@ -165,6 +229,12 @@ func (svc *LndhubService) ProcessInvoiceUpdate(ctx context.Context, rawInvoice *
 			svc.Logger.Errorf("Could not create incoming->current transaction user_id:%v invoice_id:%v  %v", invoice.UserID, invoice.ID, err)
 			return err
 		}
+		err = svc.insertReceiveFeeEntry(ctx, tx, &invoice, entry)
+		if err != nil {
+			tx.Rollback()
+			svc.Logger.Errorf("Could not create receive fee transaction user_id:%v invoice_id:%v  %v", invoice.UserID, invoice.ID, err)
+			return err
+		}
 	}
 	// Commit the DB transaction. Done, everything worked
 	err = tx.Commit()
@@ -174,6 +244,7 @@ func (svc *LndhubService) ProcessInvoiceUpdate(ctx context.Context, rawInvoice *
 	}
 	svc.InvoicePubSub.Publish(strconv.FormatInt(invoice.UserID, 10), invoice)
 	svc.InvoicePubSub.Publish(common.InvoiceTypeIncoming, invoice)
+	svc.PublishZapReceipt(invoice)
 
 	return nil
 }
@@ -185,11 +256,10 @@ func (svc *LndhubService) createKeysendInvoice(ctx context.Context, rawInvoice *
 	if len(rawInvoice.Htlcs) == 0 {
 		return result, fmt.Errorf("Invoice's HTLC array has length 0")
 	}
-	userLoginCustomRecord := rawInvoice.Htlcs[0].CustomRecords[TLV_WALLET_ID]
 	//Find user. Our convention here is that the TLV
-	//record should contain the user's login string
+	//record should contain the user's login string or keysend alias
 	//(LND already returns the decoded string so there is no need to hex-decode it)
-	user, err := svc.FindUserByLogin(ctx, string(userLoginCustomRecord))
+	user, err := svc.keysendPayee(ctx, rawInvoice.Htlcs[0].CustomRecords)
 	if err != nil {
 		return result, err
 	}
@@ -229,30 +299,96 @@ func (svc *LndhubService) ConnectInvoiceSubscription(ctx context.Context) (lnd.S
 	}
 	// subtract 1 (read invoiceSubscriptionOptions.Addindex docs)
 	invoiceSubscriptionOptions.AddIndex = invoice.AddIndex - 1
-	svc.Logger.Infof("Starting invoice subscription from index: %v", invoiceSubscriptionOptions.AddIndex)
+	// replay the invoices that were settled while we were not subscribed
+	settleIndex, err := svc.InvoiceSettleIndex(ctx)
+	if err != nil {
+		sentry.CaptureException(err)
+		return nil, err
+	}
+	invoiceSubscriptionOptions.SettleIndex = settleIndex
+	svc.Logger.Infof("Starting invoice subscription from index: %v settle index: %v", invoiceSubscriptionOptions.AddIndex, invoiceSubscriptionOptions.SettleIndex)
 	return svc.LndClient.SubscribeInvoices(ctx, &invoiceSubscriptionOptions)
 }
 
+// InvoiceSettleIndex returns the settle index of the last settled invoice of our node that was processed, 0 if there is none
+func (svc *LndhubService) InvoiceSettleIndex(ctx context.Context) (uint64, error) {
+	state := models.InvoiceSubscriptionState{}
+	err := svc.DB.NewSelect().Model(&state).Where("pubkey = ?", svc.LndClient.GetMainPubkey()).Limit(1).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return state.SettleIndex, err
+}
+
+// saveInvoiceSettleIndex stores the settle index of a processed invoice, the index never goes back
+func (svc *LndhubService) saveInvoiceSettleIndex(ctx context.Context, settleIndex uint64) error {
+	state := models.InvoiceSubscriptionState{
+		Pubkey:      svc.LndClient.GetMainPubkey(),
+		SettleIndex: settleIndex,
+		UpdatedAt:   time.Now(),
+	}
+	_, err := svc.DB.NewInsert().Model(&state).
+		On("CONFLICT (pubkey) DO UPDATE").
+		Set("settle_index = GREATEST(invoice_subscription_state.settle_index, EXCLUDED.settle_index)").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	return err
+}
+
+const maxInvoiceSubscriptionRetryDelay = time.Minute
+
+// InvoiceUpdateSubscription processes the invoice updates of the node until the context is canceled.
+// The subscription is reconnected if the stream fails, e.g. because the node restarts.
 func (svc *LndhubService) InvoiceUpdateSubscription(ctx context.Context) error {
+	minDelay := time.Duration(svc.Config.InvoiceSubscriptionRetryDelay) * time.Second
+	if minDelay <= 0 {
+		minDelay = time.Second
+	}
+	delay := minDelay
+	for {
+		received, err := svc.processInvoiceSubscription(ctx)
+		if ctx.Err() != nil {
+			return context.Canceled
+		}
+		// the stream worked for a while, start over with the shortest delay
+		if received {
+			delay = minDelay
+		}
+		svc.Logger.Errorf("Invoice update subscription failed, reconnecting in %v: %v", delay, err)
+		sentry.CaptureException(err)
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxInvoiceSubscriptionRetryDelay {
+			delay = maxInvoiceSubscriptionRetryDelay
+		}
+	}
+}
+
+// processInvoiceSubscription connects the subscription and processes the updates until the stream fails.
+// received is true if at least one update was received.
+func (svc *LndhubService) processInvoiceSubscription(ctx context.Context) (received bool, err error) {
 	invoiceSubscriptionStream, err := svc.ConnectInvoiceSubscription(ctx)
 	if err != nil {
-		sentry.CaptureException(err)
-		return err
+		return false, err
 	}
+	// after a failed update the settle index is not moved forward anymore,
+	// so that the update is replayed when the subscription is reconnected
+	failed := false
 	for {
 		select {
 		case <-ctx.Done():
-			return context.Canceled
+			return received, context.Canceled
 		default:
 			// receive the next invoice update
 			rawInvoice, err := invoiceSubscriptionStream.Recv()
-			// in case of an error, we want to return and restart LNDhub
-			// in order to try and reconnect the gRPC subscription
 			if err != nil {
-				svc.Logger.Errorf("Error processing invoice update subscription: %v", err)
-				sentry.CaptureException(err)
-				return err
+				return received, err
 			}
+			received = true
 
 			// Ignore updates for open invoices
 			// We store the invoice details in the AddInvoice call
@@ -267,6 +403,15 @@ func (svc *LndhubService) InvoiceUpdateSubscription(ctx context.Context) error {
 			if processingError != nil && processingError != AlreadyProcessedKeysendError {
 				svc.Logger.Error(fmt.Errorf("Error %s, invoice hash %s", processingError.Error(), hex.EncodeToString(rawInvoice.RHash)))
 				sentry.CaptureException(fmt.Errorf("Error %s, invoice hash %s", processingError.Error(), hex.EncodeToString(rawInvoice.RHash)))
+				failed = true
+				continue
+			}
+			if rawInvoice.SettleIndex > 0 && !failed {
+				err = svc.saveInvoiceSettleIndex(ctx, rawInvoice.SettleIndex)
+				if err != nil {
+					svc.Logger.Errorf("Could not save the invoice settle index settle_index:%v error: %v", rawInvoice.SettleIndex, err)
+					sentry.CaptureException(err)
+				}
 			}
 		}
 	}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/db/models"
+)
+
+// TLV_KEYSEND_ALIAS is the custom record of keysend payments to the node with the keysend alias of the payee
+const TLV_KEYSEND_ALIAS = 696971
+
+var keysendAliasRegex = regexp.MustCompile(`^[a-z0-9-_.]{1,32}$`)
+
+var (
+	ErrInvalidKeysendAlias = errors.New("invalid keysend alias")
+	ErrKeysendAliasTaken   = errors.New("keysend alias is already taken")
+	ErrUnknownKeysendAlias = errors.New("unknown keysend alias")
+)
+
+// SetKeysendAlias changes the keysend alias of the user, aliases are case-insensitive and an empty alias removes it
+func (svc *LndhubService) SetKeysendAlias(ctx context.Context, userId int64, alias string) (*models.User, error) {
+	alias = strings.ToLower(alias)
+	if alias != "" && !keysendAliasRegex.MatchString(alias) {
+		return nil, ErrInvalidKeysendAlias
+	}
+	if alias != "" {
+		taken, err := svc.DB.NewSelect().Model((*models.User)(nil)).
+			Where("keysend_alias = ? AND id <> ?", alias, userId).
+			Exists(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, ErrKeysendAliasTaken
+		}
+	}
+	user, err := svc.FindUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	user.KeysendAlias = sql.NullString{String: alias, Valid: alias != ""}
+	// the unique constraint rejects an alias that was taken in the meantime
+	if _, err := svc.DB.NewUpdate().Model(user).Column("keysend_alias").WherePK().Exec(ctx); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByKeysendAlias looks up a user by the keysend alias
+func (svc *LndhubService) GetUserByKeysendAlias(ctx context.Context, alias string) (*models.User, error) {
+	var user models.User
+
+	err := svc.DB.NewSelect().Model(&user).Where("keysend_alias = ?", strings.ToLower(alias)).Limit(1).Scan(ctx)
+	if err != nil {
+		return &user, err
+	}
+	return &user, nil
+}
+
+// keysendPayee finds the user that is paid by a keysend payment to the node. The login in TLV_WALLET_ID
+// takes precedence over the alias in TLV_KEYSEND_ALIAS. Payments to an unknown alias go to the user with
+// the KeysendAliasFallbackLogin, without one ErrUnknownKeysendAlias is returned.
+func (svc *LndhubService) keysendPayee(ctx context.Context, customRecords map[uint64][]byte) (*models.User, error) {
+	alias, ok := customRecords[TLV_KEYSEND_ALIAS]
+	if _, hasLogin := customRecords[TLV_WALLET_ID]; hasLogin || !ok {
+		return svc.FindUserByLogin(ctx, string(customRecords[TLV_WALLET_ID]))
+	}
+	user, err := svc.GetUserByKeysendAlias(ctx, string(alias))
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if svc.Config.KeysendAliasFallbackLogin == "" {
+		return nil, ErrUnknownKeysendAlias
+	}
+	svc.Logger.Infof("Crediting keysend payment to unknown alias %s to the fallback user", string(alias))
+	return svc.FindUserByLogin(ctx, svc.Config.KeysendAliasFallbackLogin)
+}
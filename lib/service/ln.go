@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
+	"encoding/hex"
+	"math"
 
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 )
 
 //https://github.com/hsjoberg/blixt-wallet/blob/9fcc56a7dc25237bc14b85e6490adb9e044c009c/src/utils/constants.ts#L5
@@ -18,3 +21,38 @@ const (
 func (svc *LndhubService) GetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error) {
 	return svc.LndClient.GetInfo(ctx, &lnrpc.GetInfoRequest{})
 }
+
+// EstimateFee probes the route to the destination and returns the expected routing fee in sats.
+// The estimate never exceeds the fee limit that is used when the payment is sent.
+func (svc *LndhubService) EstimateFee(ctx context.Context, destination string, amount int64) (int64, error) {
+	feeLimit := svc.CalcFeeLimit(destination, amount)
+	if feeLimit == 0 {
+		// internal payments don't have routing fees
+		return 0, nil
+	}
+	fee, err := svc.estimateRouteFee(ctx, destination, amount)
+	if err != nil {
+		return 0, err
+	}
+	if fee > feeLimit {
+		fee = feeLimit
+	}
+	return fee, nil
+}
+
+// estimateRouteFee returns the routing fee in sats the node expects for the route to the destination, it is not limited
+// by any fee limit
+func (svc *LndhubService) estimateRouteFee(ctx context.Context, destination string, amount int64) (int64, error) {
+	dest, err := hex.DecodeString(destination)
+	if err != nil {
+		return 0, err
+	}
+	routeFee, err := svc.LndClient.EstimateRouteFee(ctx, &routerrpc.RouteFeeRequest{
+		Dest:   dest,
+		AmtSat: amount,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Ceil(float64(routeFee.RoutingFeeMsat) / 1000)), nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// ErrLightningAddressResolution is wrapped by all errors of resolving a lightning address to an invoice
+var ErrLightningAddressResolution = errors.New("could not resolve the lightning address")
+
+// the responses of LNURL servers are small, larger ones are not read
+const maxLNURLResponseBytes = 100000
+
+// lnurlPayParams is the response of the LNURL-pay endpoint of a lightning address, see LUD-06 and LUD-12
+type lnurlPayParams struct {
+	Tag            string `json:"tag"`
+	Callback       string `json:"callback"`
+	MinSendable    int64  `json:"minSendable"`
+	MaxSendable    int64  `json:"maxSendable"`
+	CommentAllowed int    `json:"commentAllowed"`
+}
+
+// lnurlStatus is set when an LNURL server returns an error
+type lnurlStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// ResolveLightningAddress requests an invoice for the amount from the LNURL-pay endpoint of the lightning address, see LUD-16.
+// The comment is sent to the recipient if the endpoint allows comments of its length. The returned invoice is decoded and
+// its amount is checked, so it can be paid like an invoice given by the user.
+func (svc *LndhubService) ResolveLightningAddress(ctx context.Context, address string, amountMsat int64, comment string) (paymentRequest string, payReq *lnrpc.PayReq, err error) {
+	username, domain, found := strings.Cut(strings.ToLower(address), "@")
+	if !found || !lightningAddressRegex.MatchString(username) || domain == "" || strings.ContainsAny(domain, "/?#@") {
+		return "", nil, fmt.Errorf("%w: invalid lightning address %s", ErrLightningAddressResolution, address)
+	}
+	scheme := "https"
+	// onion services are reached without TLS, see LUD-16
+	if strings.HasSuffix(domain, ".onion") {
+		scheme = "http"
+	}
+	params := &lnurlPayParams{}
+	if err := getLNURLResponse(ctx, svc.outboundClient(), fmt.Sprintf("%s://%s/.well-known/lnurlp/%s", scheme, domain, username), params); err != nil {
+		return "", nil, err
+	}
+	if params.Tag != LNURLPayTag {
+		return "", nil, fmt.Errorf("%w: unexpected tag %s", ErrLightningAddressResolution, params.Tag)
+	}
+	if amountMsat < params.MinSendable || amountMsat > params.MaxSendable {
+		return "", nil, fmt.Errorf("%w: the amount must be between %d and %d msat", ErrLightningAddressResolution, params.MinSendable, params.MaxSendable)
+	}
+	if utf8.RuneCountInString(comment) > params.CommentAllowed {
+		return "", nil, fmt.Errorf("%w: the comment can have at most %d characters", ErrLightningAddressResolution, params.CommentAllowed)
+	}
+
+	callback, err := url.Parse(params.Callback)
+	if err != nil || (callback.Scheme != "https" && callback.Scheme != scheme) {
+		return "", nil, fmt.Errorf("%w: invalid callback %s", ErrLightningAddressResolution, params.Callback)
+	}
+	query := callback.Query()
+	query.Set("amount", strconv.FormatInt(amountMsat, 10))
+	if comment != "" {
+		query.Set("comment", comment)
+	}
+	callback.RawQuery = query.Encode()
+	var invoice struct {
+		PR string `json:"pr"`
+	}
+	if err := getLNURLResponse(ctx, svc.outboundClient(), callback.String(), &invoice); err != nil {
+		return "", nil, err
+	}
+
+	paymentRequest = strings.ToLower(invoice.PR)
+	payReq, err = svc.DecodePaymentRequest(ctx, paymentRequest)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: invalid invoice: %w", ErrLightningAddressResolution, err)
+	}
+	if payReq.NumMsat != amountMsat {
+		return "", nil, fmt.Errorf("%w: the invoice is for %d msat instead of %d msat", ErrLightningAddressResolution, payReq.NumMsat, amountMsat)
+	}
+	return paymentRequest, payReq, nil
+}
+
+// getLNURLResponse fetches the endpoint and decodes the response into result, LNURL errors are returned as an error
+func getLNURLResponse(ctx context.Context, client *http.Client, endpoint string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLightningAddressResolution, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLightningAddressResolution, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLNURLResponseBytes))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLightningAddressResolution, err)
+	}
+	status := &lnurlStatus{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return fmt.Errorf("%w: invalid response with status %d", ErrLightningAddressResolution, resp.StatusCode)
+	}
+	if strings.EqualFold(status.Status, "ERROR") {
+		return fmt.Errorf("%w: %s", ErrLightningAddressResolution, status.Reason)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: response with status %d", ErrLightningAddressResolution, resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("%w: invalid response: %v", ErrLightningAddressResolution, err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// lnurlTestServer serves the LNURL-pay endpoint of alice, its callback returns an invoice for invoiceAmountMsat
+// or for the requested amount if it is zero
+func lnurlTestServer(t *testing.T, invoiceAmountMsat int64) *httptest.Server {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/lnurlp/alice", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"tag":            LNURLPayTag,
+			"callback":       server.URL + "/callback",
+			"minSendable":    1000,
+			"maxSendable":    1000000,
+			"commentAllowed": 10,
+		}))
+	})
+	mux.HandleFunc("/.well-known/lnurlp/bob", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"status":"ERROR","reason":"unknown user"}`)
+	})
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		amount := invoiceAmountMsat
+		if amount == 0 {
+			amount, _ = strconv.ParseInt(r.URL.Query().Get("amount"), 10, 64)
+		}
+		fmt.Fprintf(w, `{"pr":"LNBCRT%dN1PJTEST%s"}`, amount/100, r.URL.Query().Get("comment"))
+	})
+	server = httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// the client of the test server trusts its certificate and is allowed to reach it on localhost
+func lnaddressTestService(server *httptest.Server) *LndhubService {
+	return &LndhubService{
+		Config:         &Config{},
+		OutboundClient: server.Client(),
+		LndClient: &testutils.MockLightningClient{
+			DecodeBolt11Func: func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error) {
+				var amount int64
+				fmt.Sscanf(bolt11, "lnbcrt%dn1", &amount)
+				return &lnrpc.PayReq{NumMsat: amount * 100, NumSatoshis: amount / 10}, nil
+			},
+		},
+	}
+}
+
+func TestResolveLightningAddress(t *testing.T) {
+	server := lnurlTestServer(t, 0)
+	host := strings.TrimPrefix(server.URL, "https://")
+	svc := lnaddressTestService(server)
+
+	paymentRequest, payReq, err := svc.ResolveLightningAddress(context.Background(), "Alice@"+host, 21000, "thanks")
+	assert.NoError(t, err)
+	assert.Equal(t, "lnbcrt210n1pjtestthanks", paymentRequest)
+	assert.Equal(t, int64(21000), payReq.NumMsat)
+
+	for _, tt := range []struct {
+		address    string
+		amountMsat int64
+		comment    string
+		message    string
+	}{
+		{"alice", 21000, "", "invalid lightning address"},
+		{"alice@" + host, 100, "", "the amount must be between 1000 and 1000000 msat"},
+		{"alice@" + host, 21000, "a comment that is too long", "the comment can have at most 10 characters"},
+		{"bob@" + host, 21000, "", "unknown user"},
+	} {
+		_, _, err := svc.ResolveLightningAddress(context.Background(), tt.address, tt.amountMsat, tt.comment)
+		assert.ErrorIs(t, err, ErrLightningAddressResolution, tt.address)
+		assert.ErrorContains(t, err, tt.message, tt.address)
+	}
+}
+
+func TestResolveLightningAddressPrivateHost(t *testing.T) {
+	server := lnurlTestServer(t, 0)
+	host := strings.TrimPrefix(server.URL, "https://")
+	svc := lnaddressTestService(server)
+	// the default outbound client doesn't reach the test server on localhost
+	svc.OutboundClient = nil
+
+	_, _, err := svc.ResolveLightningAddress(context.Background(), "alice@"+host, 21000, "")
+	assert.ErrorIs(t, err, ErrLightningAddressResolution)
+	assert.ErrorIs(t, err, ErrOutboundHostBlocked)
+}
+
+func TestResolveLightningAddressAmountMismatch(t *testing.T) {
+	server := lnurlTestServer(t, 50000)
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	_, _, err := lnaddressTestService(server).ResolveLightningAddress(context.Background(), "alice@"+host, 21000, "")
+	assert.ErrorIs(t, err, ErrLightningAddressResolution)
+	assert.ErrorContains(t, err, "the invoice is for 50000 msat instead of 21000 msat")
+}
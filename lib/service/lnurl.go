@@ -0,0 +1,57 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/getAlby/lndhub.go/db/models"
+)
+
+const LNURLPayTag = "payRequest"
+
+// allowed characters of a lightning address username, see LUD-16
+var lightningAddressRegex = regexp.MustCompile(`^[a-z0-9-_.]+$`)
+
+// LNURLPayMetadata returns the metadata of a user's LNURL-pay endpoint.
+// The exact same string has to be served and hashed into the invoice description hash.
+// Users with a lightning address get their address on the domain as identifier.
+func (svc *LndhubService) LNURLPayMetadata(user *models.User, domain string) string {
+	entries := [][]string{
+		{"text/plain", fmt.Sprintf("Payment to %s", user.Login)},
+	}
+	if user.LightningAddress.Valid {
+		entries[0][1] = fmt.Sprintf("Payment to %s@%s", user.LightningAddress.String, domain)
+		entries = append(entries, []string{"text/identifier", fmt.Sprintf("%s@%s", user.LightningAddress.String, domain)})
+	}
+	metadata, _ := json.Marshal(entries)
+	return string(metadata)
+}
+
+func LNURLPayDescriptionHash(metadata string) string {
+	hash := sha256.Sum256([]byte(metadata))
+	return hex.EncodeToString(hash[:])
+}
+
+// LNURLPayMinSendable is the configured min sendable which is raised to the min receive amount
+func (svc *LndhubService) LNURLPayMinSendable() int64 {
+	minSendable := svc.Config.LNURLMinSendable
+	if svc.Config.MinReceiveSats*1000 > minSendable {
+		minSendable = svc.Config.MinReceiveSats * 1000
+	}
+	return minSendable
+}
+
+// LNURLPayMaxSendable is the configured max sendable which is capped by the max receive amount and the max invoice amount
+func (svc *LndhubService) LNURLPayMaxSendable(limits *Limits) int64 {
+	maxSendable := svc.Config.LNURLMaxSendable
+	if limits.MaxReceiveAmount > 0 && limits.MaxReceiveAmount*1000 < maxSendable {
+		maxSendable = limits.MaxReceiveAmount * 1000
+	}
+	if svc.Config.MaxInvoiceAmountSats > 0 && svc.Config.MaxInvoiceAmountSats*1000 < maxSendable {
+		maxSendable = svc.Config.MaxInvoiceAmountSats * 1000
+	}
+	return maxSendable
+}
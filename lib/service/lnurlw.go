@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/uptrace/bun"
+)
+
+const LNURLWithdrawTag = "withdrawRequest"
+
+// min withdrawable in millisatoshi, invoices can't be smaller than 1 sat
+const LNURLMinWithdrawable = 1000
+
+var WithdrawTokenUsedError = errors.New("withdraw link has already been used")
+
+func (svc *LndhubService) CreateWithdrawToken(ctx context.Context, userId, maxAmount int64) (*models.WithdrawToken, error) {
+	token, err := randBytesFromStr(32, alphaNumBytes)
+	if err != nil {
+		return nil, err
+	}
+	withdrawToken := models.WithdrawToken{
+		UserID:    userId,
+		Token:     string(token),
+		MaxAmount: maxAmount,
+	}
+	_, err = svc.DB.NewInsert().Model(&withdrawToken).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &withdrawToken, nil
+}
+
+func (svc *LndhubService) FindUnusedWithdrawToken(ctx context.Context, token string) (*models.WithdrawToken, error) {
+	var withdrawToken models.WithdrawToken
+
+	err := svc.DB.NewSelect().Model(&withdrawToken).Where("token = ? AND used_at IS NULL", token).Limit(1).Scan(ctx)
+	if err != nil {
+		return &withdrawToken, err
+	}
+	return &withdrawToken, nil
+}
+
+// ClaimWithdrawToken marks the token as used, only one caller can claim a token
+func (svc *LndhubService) ClaimWithdrawToken(ctx context.Context, withdrawToken *models.WithdrawToken) error {
+	withdrawToken.UsedAt = bun.NullTime{Time: time.Now()}
+	res, err := svc.DB.NewUpdate().Model(withdrawToken).Column("used_at").Where("id = ? AND used_at IS NULL", withdrawToken.ID).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return WithdrawTokenUsedError
+	}
+	return nil
+}
+
+// ReleaseWithdrawToken makes the token usable again, e.g. if the payment failed
+func (svc *LndhubService) ReleaseWithdrawToken(ctx context.Context, withdrawToken *models.WithdrawToken) error {
+	withdrawToken.UsedAt = bun.NullTime{}
+	_, err := svc.DB.NewUpdate().Model(withdrawToken).Column("used_at").WherePK().Exec(ctx)
+	return err
+}
+
+// EncodeLNURL encodes the url as bech32 string, see LUD-01
+func EncodeLNURL(url string) (string, error) {
+	data, err := bech32.ConvertBits([]byte(url), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	lnurl, err := bech32.Encode("lnurl", data)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(lnurl), nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// renderMemoTemplate replaces {amount} with the amount in sats and {user} with the user in the template. Control characters
+// are removed and the memo is cut to MaxMemoLength bytes, so it is a valid memo whatever the template and the user are.
+func renderMemoTemplate(template string, amount int64, user string) string {
+	memo := strings.NewReplacer("{amount}", strconv.FormatInt(amount, 10), "{user}", user).Replace(template)
+	memo = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, memo)
+	memo = strings.TrimSpace(memo)
+	for len(memo) > MaxMemoLength {
+		_, size := utf8.DecodeLastRuneInString(memo)
+		memo = memo[:len(memo)-size]
+	}
+	return memo
+}
+
+// defaultMemo renders DEFAULT_INVOICE_MEMO_TEMPLATE for an invoice of the user, it is empty without a template.
+// The user is the username of the lightning address of the user or the id if there is none, the login is a credential
+// and never shown in invoices.
+func (svc *LndhubService) defaultMemo(ctx context.Context, userID, amount int64) string {
+	template := svc.Config.DefaultInvoiceMemoTemplate
+	if template == "" {
+		return ""
+	}
+	user := ""
+	if strings.Contains(template, "{user}") {
+		dbUser, err := svc.FindUser(ctx, userID)
+		if err != nil {
+			svc.Logger.Errorf("Could not load user for the default memo user_id:%v error: %v", userID, err)
+		} else if dbUser.LightningAddress.Valid {
+			user = dbUser.LightningAddress.String
+		} else {
+			user = strconv.FormatInt(dbUser.ID, 10)
+		}
+	}
+	return renderMemoTemplate(template, amount, user)
+}
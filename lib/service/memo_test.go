@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMemoTemplate(t *testing.T) {
+	assert.Equal(t, "Payment of 2100 sats to alice", renderMemoTemplate("Payment of {amount} sats to {user}", 2100, "alice"))
+	assert.Equal(t, "alice: 21 sats, thanks alice", renderMemoTemplate("{user}: {amount} sats, thanks {user}", 21, "alice"))
+	assert.Equal(t, "Example Hub", renderMemoTemplate("Example Hub", 21, "alice"))
+	// control characters of the template and the user are removed
+	assert.Equal(t, "Payment to alicebob", renderMemoTemplate("Payment to {user}\n", 21, "alice\x07bob"))
+
+	memo := renderMemoTemplate("{user}", 21, strings.Repeat("ä", MaxMemoLength))
+	assert.LessOrEqual(t, len(memo), MaxMemoLength)
+	assert.Nil(t, ValidateMemo(memo))
+}
+
+// invoices without memo don't get a default memo without a template, templates without {user} don't need the database
+func TestDefaultMemo(t *testing.T) {
+	svc := &LndhubService{Config: &Config{}}
+	assert.Equal(t, "", svc.defaultMemo(context.Background(), 1, 2100))
+
+	svc.Config.DefaultInvoiceMemoTemplate = "{amount} sats at Example Hub"
+	assert.Equal(t, "2100 sats at Example Hub", svc.defaultMemo(context.Background(), 1, 2100))
+}
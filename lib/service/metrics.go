@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "lndhub"
+
+// Metrics are the prometheus metrics of the payments and invoices.
+// The methods can be called on a nil Metrics, which doesn't record anything.
+type Metrics struct {
+	PaymentsAttempted prometheus.Counter
+	PaymentsSucceeded prometheus.Counter
+	PaymentsFailed    *prometheus.CounterVec
+	PaymentDuration   prometheus.Histogram
+	InvoicesCreated   prometheus.Counter
+	UserLiabilities   prometheus.GaugeFunc
+}
+
+// InitMetrics registers the metrics in the given registry, e.g. prometheus.DefaultRegisterer
+func (svc *LndhubService) InitMetrics(reg prometheus.Registerer) error {
+	metrics := &Metrics{
+		PaymentsAttempted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "payments_attempted_total",
+			Help:      "Number of outgoing payments that were attempted.",
+		}),
+		PaymentsSucceeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "payments_succeeded_total",
+			Help:      "Number of outgoing payments that succeeded.",
+		}),
+		PaymentsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "payments_failed_total",
+			Help:      "Number of outgoing payments that failed by failure reason.",
+		}, []string{"reason"}),
+		PaymentDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "payment_duration_seconds",
+			Help:      "Duration of outgoing payments.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}),
+		InvoicesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "invoices_created_total",
+			Help:      "Number of incoming invoices that were created.",
+		}),
+	}
+	// the liabilities are read from the ledger on every scrape
+	metrics.UserLiabilities = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "user_liabilities_sats",
+		Help:      "Sum of the balances of all users in sats.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		balance, err := svc.TotalUserBalance(ctx)
+		if err != nil {
+			svc.Logger.Errorf("Could not get the total user balance for the metrics: %v", err)
+			return 0
+		}
+		return float64(balance)
+	})
+	collectors := []prometheus.Collector{
+		metrics.PaymentsAttempted,
+		metrics.PaymentsSucceeded,
+		metrics.PaymentsFailed,
+		metrics.PaymentDuration,
+		metrics.InvoicesCreated,
+		metrics.UserLiabilities,
+	}
+	for _, collector := range collectors {
+		if err := reg.Register(collector); err != nil {
+			return err
+		}
+	}
+	svc.Metrics = metrics
+	return nil
+}
+
+func (m *Metrics) paymentAttempted() {
+	if m == nil {
+		return
+	}
+	m.PaymentsAttempted.Inc()
+}
+
+func (m *Metrics) paymentDone(duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.PaymentDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.PaymentsFailed.WithLabelValues(paymentFailureReason(err)).Inc()
+		return
+	}
+	m.PaymentsSucceeded.Inc()
+}
+
+func (m *Metrics) invoiceCreated() {
+	if m == nil {
+		return
+	}
+	m.InvoicesCreated.Inc()
+}
+
+// paymentFailureReason maps the payment errors of the node to a small set of labels
+func paymentFailureReason(err error) string {
+	if errors.Is(err, PaymentTimeoutError) {
+		return "timeout"
+	}
+	if errors.Is(err, ErrNotEnoughBalance) {
+		return "insufficient_balance"
+	}
+	if errors.Is(err, ErrDailyLimitExceeded) {
+		return "daily_limit_exceeded"
+	}
+	if errors.Is(err, ErrInsufficientNodeLiquidity) {
+		return "insufficient_node_liquidity"
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "no_route"), strings.Contains(msg, "unable to find a path"):
+		return "no_route"
+	case strings.Contains(msg, "timeout"):
+		return "timeout"
+	case strings.Contains(msg, "incorrect_payment_details"), strings.Contains(msg, "incorrect_or_unknown_payment_details"):
+		return "incorrect_payment_details"
+	case strings.Contains(msg, "insufficient"):
+		return "insufficient_balance"
+	case strings.Contains(msg, "already paid"):
+		return "already_paid"
+	case strings.Contains(msg, "temporary"):
+		return "temporary_failure"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentFailureReason(t *testing.T) {
+	assert.Equal(t, "timeout", paymentFailureReason(PaymentTimeoutError))
+	assert.Equal(t, "timeout", paymentFailureReason(errors.New("FAILURE_REASON_TIMEOUT")))
+	assert.Equal(t, "no_route", paymentFailureReason(errors.New("FAILURE_REASON_NO_ROUTE")))
+	assert.Equal(t, "no_route", paymentFailureReason(errors.New("unable to find a path to destination")))
+	assert.Equal(t, "incorrect_payment_details", paymentFailureReason(errors.New("FAILURE_REASON_INCORRECT_PAYMENT_DETAILS")))
+	assert.Equal(t, "insufficient_balance", paymentFailureReason(errors.New("FAILURE_REASON_INSUFFICIENT_BALANCE")))
+	assert.Equal(t, "already_paid", paymentFailureReason(errors.New("invoice is already paid")))
+	assert.Equal(t, "temporary_failure", paymentFailureReason(errors.New("TemporaryChannelFailure")))
+	assert.Equal(t, "error", paymentFailureReason(errors.New("something else")))
+}
+
+func TestPaymentMetrics(t *testing.T) {
+	metricsSvc := &LndhubService{}
+	// a service without metrics doesn't record anything
+	metricsSvc.Metrics.paymentAttempted()
+	metricsSvc.Metrics.paymentDone(time.Second, nil)
+
+	reg := prometheus.NewRegistry()
+	assert.NoError(t, metricsSvc.InitMetrics(reg))
+	metricsSvc.Metrics.paymentAttempted()
+	metricsSvc.Metrics.paymentDone(time.Second, nil)
+	metricsSvc.Metrics.paymentAttempted()
+	metricsSvc.Metrics.paymentDone(time.Second, errors.New("FAILURE_REASON_NO_ROUTE"))
+	metricsSvc.Metrics.invoiceCreated()
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(metricsSvc.Metrics.PaymentsAttempted))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsSvc.Metrics.PaymentsSucceeded))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsSvc.Metrics.PaymentsFailed.WithLabelValues("no_route")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metricsSvc.Metrics.PaymentsFailed.WithLabelValues("timeout")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metricsSvc.Metrics.InvoicesCreated))
+	assert.Equal(t, 1, testutil.CollectAndCount(metricsSvc.Metrics.PaymentDuration))
+
+	// the metrics can only be registered once per registry
+	assert.Error(t, metricsSvc.InitMetrics(reg))
+}
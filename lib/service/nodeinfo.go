@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// the node info barely changes, it is cached to not call the node on every request
+const nodeInfoCacheDuration = 5 * time.Second
+
+type nodeInfoCache struct {
+	mu        sync.Mutex
+	fetchedAt time.Time
+	info      *lnrpc.GetInfoResponse
+	// the network never changes, it is kept once it is known
+	network string
+}
+
+// CachedGetInfo returns the GetInfo response of the node, it is cached for a few seconds
+func (svc *LndhubService) CachedGetInfo(ctx context.Context) (*lnrpc.GetInfoResponse, error) {
+	svc.nodeInfo.mu.Lock()
+	defer svc.nodeInfo.mu.Unlock()
+	if svc.nodeInfo.info != nil && time.Since(svc.nodeInfo.fetchedAt) < nodeInfoCacheDuration {
+		return svc.nodeInfo.info, nil
+	}
+	info, err := svc.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	svc.nodeInfo.info = info
+	svc.nodeInfo.fetchedAt = time.Now()
+	return info, nil
+}
+
+// NodeNetwork returns the network of the node, e.g. mainnet
+func (svc *LndhubService) NodeNetwork(ctx context.Context) (string, error) {
+	svc.nodeInfo.mu.Lock()
+	network := svc.nodeInfo.network
+	svc.nodeInfo.mu.Unlock()
+	if network != "" {
+		return network, nil
+	}
+	info, err := svc.CachedGetInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(info.Chains) == 0 || info.Chains[0].Network == "" {
+		return "", errors.New("node did not report its network")
+	}
+	svc.nodeInfo.mu.Lock()
+	svc.nodeInfo.network = info.Chains[0].Network
+	svc.nodeInfo.mu.Unlock()
+	return info.Chains[0].Network, nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/uptrace/bun"
+)
+
+// the description of the offers is shown to the payers, CUSTOM_NAME is used if it is set
+const defaultOfferDescription = "lndhub"
+
+var ErrInvalidOffer = errors.New("invalid bolt12 offer")
+
+// FetchOfferInvoice requests an invoice for the amount from the issuer of the offer.
+// The amount can be 0 for offers with an amount, otherwise it has to match the amount of the offer.
+func (svc *LndhubService) FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+	// fail fast without asking the node about something that can't be an offer
+	if len(offer) > MaxPaymentRequestLength || !strings.HasPrefix(offer, "lno1") {
+		return nil, ErrInvalidOffer
+	}
+	return svc.LndClient.FetchOfferInvoice(ctx, offer, amountMsat)
+}
+
+// UserOffer returns the reusable bolt12 offer of the user, it is created on the first call.
+// An offer can be paid any number of times with any amount.
+func (svc *LndhubService) UserOffer(ctx context.Context, userId int64) (*models.Offer, error) {
+	offer := &models.Offer{}
+	err := svc.DB.NewSelect().Model(offer).Where("user_id = ?", userId).OrderExpr("id DESC").Limit(1).Scan(ctx)
+	if err == nil {
+		return offer, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	description := svc.Config.CustomName
+	if description == "" {
+		description = defaultOfferDescription
+	}
+	created, err := svc.LndClient.CreateOffer(ctx, &lnd.OfferRequest{Description: description})
+	if err != nil {
+		return nil, err
+	}
+	offer = &models.Offer{
+		UserID:  userId,
+		OfferID: created.OfferID,
+		Bolt12:  created.Bolt12,
+	}
+	if _, err := svc.DB.NewInsert().Model(offer).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// createOfferInvoice stores the incoming invoice of a settled payment to an offer of a user. The node creates
+// a new invoice for every invoice request of a payer, so these invoices are only known once they are paid.
+// sql.ErrNoRows is returned if the invoice does not belong to one of the offers or if it is already stored.
+func (svc *LndhubService) createOfferInvoice(ctx context.Context, rawInvoice *lnrpc.Invoice, invoice *models.Invoice) error {
+	rHashStr := hex.EncodeToString(rawInvoice.RHash)
+	// the settlement can be delivered twice, the invoice is settled by the first one
+	exists, err := svc.DB.NewSelect().Model((*models.Invoice)(nil)).Where("type = ? AND r_hash = ?", common.InvoiceTypeIncoming, rHashStr).Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return sql.ErrNoRows
+	}
+	offerId, err := svc.LndClient.LookupInvoiceOffer(ctx, rawInvoice.RHash)
+	if err != nil {
+		return err
+	}
+	if offerId == "" {
+		return sql.ErrNoRows
+	}
+	offer := &models.Offer{}
+	// offers that were not created by us are not found
+	if err := svc.DB.NewSelect().Model(offer).Where("offer_id = ?", offerId).Limit(1).Scan(ctx); err != nil {
+		return err
+	}
+	if svc.exceedsMaxInvoiceAmount(rawInvoice.AmtPaidSat) {
+		return ErrInvoiceAmountTooHigh
+	}
+
+	*invoice = models.Invoice{
+		Type:                 common.InvoiceTypeIncoming,
+		UserID:               offer.UserID,
+		Amount:               rawInvoice.AmtPaidSat,
+		Memo:                 rawInvoice.Memo,
+		PaymentRequest:       rawInvoice.PaymentRequest,
+		State:                common.InvoiceStateInitialized,
+		ExpiresAt:            bun.NullTime{Time: time.Now()}, // already paid
+		RHash:                rHashStr,
+		Preimage:             hex.EncodeToString(rawInvoice.RPreimage),
+		DestinationPubkeyHex: svc.LndClient.GetMainPubkey(),
+		AddIndex:             rawInvoice.AddIndex,
+	}
+	svc.Logger.Infof("Storing payment to offer user_id:%v offer_id:%s r_hash:%s amount:%v", offer.UserID, offerId, rHashStr, rawInvoice.AmtPaidSat)
+	_, err = svc.DB.NewInsert().Model(invoice).Exec(ctx)
+	return err
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getsentry/sentry-go"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/uptrace/bun"
+)
+
+const onchainResubscribeDelay = 10 * time.Second
+
+var ErrOnchainAddressInUse = errors.New("on-chain address belongs to another user")
+
+// OnchainAddress returns the deposit address of the user. The same address is returned until it
+// received a deposit, then a new one is created. Deposits to older addresses are still credited.
+func (svc *LndhubService) OnchainAddress(ctx context.Context, userId int64) (*models.OnchainAddress, error) {
+	address := &models.OnchainAddress{}
+	err := svc.DB.NewSelect().Model(address).
+		Where("user_id = ?", userId).
+		Where("NOT EXISTS (SELECT 1 FROM onchain_deposits WHERE onchain_deposits.address = ?TableAlias.address)").
+		OrderExpr("id DESC").
+		Limit(1).
+		Scan(ctx)
+	if err == nil {
+		return address, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	resp, err := svc.LndClient.NewAddress(ctx, &lnrpc.NewAddressRequest{Type: lnrpc.AddressType_WITNESS_PUBKEY_HASH})
+	if err != nil {
+		return nil, err
+	}
+	address = &models.OnchainAddress{
+		UserID:  userId,
+		Address: resp.Address,
+	}
+	res, err := svc.DB.NewInsert().Model(address).On("CONFLICT (address) DO NOTHING").Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected > 0 {
+		return address, nil
+	}
+	// the node handed out an address that is already stored, it can only be used by the same user
+	existing := &models.OnchainAddress{}
+	err = svc.DB.NewSelect().Model(existing).Where("address = ?", resp.Address).Limit(1).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if existing.UserID != userId {
+		svc.Logger.Errorf("On-chain address of the node is already used address:%s user_id:%v owner_id:%v", resp.Address, userId, existing.UserID)
+		return nil, ErrOnchainAddressInUse
+	}
+	return existing, nil
+}
+
+// StartOnchainDepositRoutine credits the deposits to the on-chain addresses of the users.
+// The wallet transactions are received from the transaction subscription of the node, deposits
+// without enough confirmations are checked again every OnchainDepositCheckInterval seconds.
+func (svc *LndhubService) StartOnchainDepositRoutine(ctx context.Context) error {
+	// catch up with the deposits that were received while we were not running
+	details, err := svc.LndClient.GetTransactions(ctx, &lnrpc.GetTransactionsRequest{EndHeight: -1})
+	if err != nil {
+		return err
+	}
+	for _, tx := range details.Transactions {
+		if err := svc.ProcessOnchainTransaction(ctx, tx); err != nil {
+			svc.Logger.Errorf("Failed to process on-chain transaction tx_hash:%s error: %v", tx.TxHash, err)
+		}
+	}
+
+	transactions := make(chan *lnrpc.Transaction)
+	go svc.subscribeTransactions(ctx, transactions)
+
+	ticker := time.NewTicker(time.Duration(svc.Config.OnchainDepositCheckInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case tx := <-transactions:
+			if err := svc.ProcessOnchainTransaction(ctx, tx); err != nil && ctx.Err() == nil {
+				svc.Logger.Errorf("Failed to process on-chain transaction tx_hash:%s error: %v", tx.TxHash, err)
+				sentry.CaptureException(err)
+			}
+		case <-ticker.C:
+			if err := svc.CheckPendingOnchainDeposits(ctx); err != nil && ctx.Err() == nil {
+				// try again at the next tick
+				svc.Logger.Errorf("Failed to check the pending on-chain deposits: %v", err)
+				sentry.CaptureException(err)
+			}
+		}
+	}
+}
+
+// subscribeTransactions forwards the wallet transactions of the node and subscribes again when the stream fails
+func (svc *LndhubService) subscribeTransactions(ctx context.Context, transactions chan<- *lnrpc.Transaction) {
+	for ctx.Err() == nil {
+		stream, err := svc.LndClient.SubscribeTransactions(ctx, &lnrpc.GetTransactionsRequest{})
+		for err == nil {
+			var tx *lnrpc.Transaction
+			tx, err = stream.Recv()
+			if err == nil {
+				select {
+				case transactions <- tx:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		svc.Logger.Errorf("On-chain transaction subscription failed, subscribing again in %v: %v", onchainResubscribeDelay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(onchainResubscribeDelay):
+		}
+	}
+}
+
+// CheckPendingOnchainDeposits looks up the confirmations of the deposits that are not credited yet.
+// Unconfirmed deposits are not looked up, the subscription reports their first confirmation.
+func (svc *LndhubService) CheckPendingOnchainDeposits(ctx context.Context) error {
+	var startHeight int32
+	err := svc.DB.NewSelect().Model((*models.OnchainDeposit)(nil)).
+		ColumnExpr("COALESCE(MIN(block_height), 0)").
+		Where("state = ?", models.OnchainDepositStatePending).
+		Where("block_height > 0").
+		Scan(ctx, &startHeight)
+	if err != nil {
+		return err
+	}
+	if startHeight == 0 {
+		return nil
+	}
+	details, err := svc.LndClient.GetTransactions(ctx, &lnrpc.GetTransactionsRequest{StartHeight: startHeight, EndHeight: -1})
+	if err != nil {
+		return err
+	}
+	for _, tx := range details.Transactions {
+		if err := svc.ProcessOnchainTransaction(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessOnchainTransaction records the outputs of the transaction that pay to a deposit address
+// and credits them once they have OnchainMinConfirmations confirmations.
+// Every output is credited once, also when an address is paid more than once.
+func (svc *LndhubService) ProcessOnchainTransaction(ctx context.Context, tx *lnrpc.Transaction) error {
+	for _, output := range tx.OutputDetails {
+		if !output.IsOurAddress || output.Address == "" {
+			continue
+		}
+		address := &models.OnchainAddress{}
+		err := svc.DB.NewSelect().Model(address).Where("address = ?", output.Address).Limit(1).Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			// e.g. change outputs of our own transactions
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := svc.processOnchainDeposit(ctx, tx, output, address.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (svc *LndhubService) processOnchainDeposit(ctx context.Context, tx *lnrpc.Transaction, output *lnrpc.OutputDetail, userId int64) error {
+	deposit := &models.OnchainDeposit{
+		UserID:        userId,
+		Address:       output.Address,
+		TxHash:        tx.TxHash,
+		OutputIndex:   output.OutputIndex,
+		Amount:        output.Amount,
+		Fee:           svc.Config.OnchainDepositFee,
+		Confirmations: tx.NumConfirmations,
+		BlockHeight:   tx.BlockHeight,
+		State:         models.OnchainDepositStatePending,
+	}
+	_, err := svc.DB.NewInsert().Model(deposit).
+		On("CONFLICT (tx_hash, output_index) DO UPDATE").
+		Set("confirmations = EXCLUDED.confirmations").
+		Set("block_height = EXCLUDED.block_height").
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if deposit.State != models.OnchainDepositStatePending || deposit.Confirmations < svc.Config.OnchainMinConfirmations {
+		return nil
+	}
+	return svc.creditOnchainDeposit(ctx, deposit)
+}
+
+func (svc *LndhubService) creditOnchainDeposit(ctx context.Context, deposit *models.OnchainDeposit) error {
+	creditAccount, err := svc.AccountFor(ctx, common.AccountTypeCurrent, deposit.UserID)
+	if err != nil {
+		return err
+	}
+	debitAccount, err := svc.AccountFor(ctx, common.AccountTypeIncoming, deposit.UserID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := svc.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// the deposit can be processed by the subscription and the pending check at the same time
+	err = tx.NewSelect().Model(deposit).WherePK().Where("state = ?", models.OnchainDepositStatePending).For("UPDATE").Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	amount := deposit.Amount - deposit.Fee
+	if amount <= 0 {
+		svc.Logger.Infof("On-chain deposit does not cover the deposit fee user_id:%v tx_hash:%s output_index:%v amount:%v fee:%v", deposit.UserID, deposit.TxHash, deposit.OutputIndex, deposit.Amount, deposit.Fee)
+		deposit.State = models.OnchainDepositStateBelowFee
+		if _, err := tx.NewUpdate().Model(deposit).Column("state").WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// the deposit is booked like a settled incoming invoice so that it shows up in the transactions
+	invoice := models.Invoice{
+		Type:                 common.InvoiceTypeIncoming,
+		UserID:               deposit.UserID,
+		Amount:               amount,
+		Memo:                 fmt.Sprintf("on-chain deposit %s:%d", deposit.TxHash, deposit.OutputIndex),
+		State:                common.InvoiceStateSettled,
+		DestinationPubkeyHex: svc.LndClient.GetMainPubkey(),
+		SettledAt:            bun.NullTime{Time: time.Now()},
+	}
+	if _, err := tx.NewInsert().Model(&invoice).Exec(ctx); err != nil {
+		return err
+	}
+	entry := models.TransactionEntry{
+		UserID:          deposit.UserID,
+		InvoiceID:       invoice.ID,
+		CreditAccountID: creditAccount.ID,
+		DebitAccountID:  debitAccount.ID,
+		Amount:          amount,
+		EntryType:       models.EntryTypeIncoming,
+		Reference:       fmt.Sprintf("%s:%d", deposit.TxHash, deposit.OutputIndex),
+	}
+	if _, err := tx.NewInsert().Model(&entry).Exec(ctx); err != nil {
+		return err
+	}
+	deposit.State = models.OnchainDepositStateCredited
+	deposit.InvoiceID = invoice.ID
+	deposit.CreditedAt = bun.NullTime{Time: time.Now()}
+	if _, err := tx.NewUpdate().Model(deposit).Column("state", "invoice_id", "credited_at").WherePK().Exec(ctx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	svc.Logger.Infof("Credited on-chain deposit user_id:%v tx_hash:%s output_index:%v amount:%v fee:%v", deposit.UserID, deposit.TxHash, deposit.OutputIndex, amount, deposit.Fee)
+	svc.InvoicePubSub.Publish(strconv.FormatInt(invoice.UserID, 10), invoice)
+	svc.InvoicePubSub.Publish(common.InvoiceTypeIncoming, invoice)
+	return nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getsentry/sentry-go"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+var (
+	ErrInvalidOnchainAddress      = errors.New("invalid on-chain address")
+	ErrOnchainAddressWrongNetwork = errors.New("on-chain address is not for the network of the node")
+)
+
+// the network names reported by the node
+var onchainNetworks = map[string]*chaincfg.Params{
+	"mainnet": &chaincfg.MainNetParams,
+	"testnet": &chaincfg.TestNet3Params,
+	"signet":  &chaincfg.SigNetParams,
+	"regtest": &chaincfg.RegressionNetParams,
+	"simnet":  &chaincfg.SimNetParams,
+}
+
+// ValidateOnchainAddress checks that the address can be paid on the network of the node
+func (svc *LndhubService) ValidateOnchainAddress(ctx context.Context, address string) error {
+	network, err := svc.NodeNetwork(ctx)
+	if err != nil {
+		return err
+	}
+	params, ok := onchainNetworks[network]
+	if !ok {
+		return fmt.Errorf("unknown network %s", network)
+	}
+	decoded, err := btcutil.DecodeAddress(address, params)
+	if err == nil && decoded.IsForNet(params) {
+		return nil
+	}
+	// tell the user when the address is valid, but for another network
+	for _, other := range onchainNetworks {
+		if other == params {
+			continue
+		}
+		decoded, err := btcutil.DecodeAddress(address, other)
+		if err == nil && decoded.IsForNet(other) {
+			return ErrOnchainAddressWrongNetwork
+		}
+	}
+	return ErrInvalidOnchainAddress
+}
+
+// EstimateOnchainWithdrawalFee estimates the fee of sending the amount to the address and returns it with the fee rate in sat/vbyte.
+// Without a satPerVbyte the rate is estimated for OnchainWithdrawalTargetConf blocks, otherwise the estimated size is paid with the given rate.
+func (svc *LndhubService) EstimateOnchainWithdrawalFee(ctx context.Context, address string, amount int64, satPerVbyte uint64) (fee int64, feeRate uint64, err error) {
+	estimate, err := svc.LndClient.EstimateFee(ctx, &lnrpc.EstimateFeeRequest{
+		AddrToAmount: map[string]int64{address: amount},
+		TargetConf:   svc.Config.OnchainWithdrawalTargetConf,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if satPerVbyte == 0 {
+		return estimate.FeeSat, estimate.SatPerVbyte, nil
+	}
+	if estimate.SatPerVbyte == 0 {
+		return 0, 0, errors.New("fee estimate without a fee rate")
+	}
+	vbytes := (estimate.FeeSat + int64(estimate.SatPerVbyte) - 1) / int64(estimate.SatPerVbyte)
+	return vbytes * int64(satPerVbyte), satPerVbyte, nil
+}
+
+// WithdrawOnchain sends the amount to the address with the given fee rate. The amount and the estimated fee are
+// reserved like for a lightning payment, the fee reserve is replaced with the fee of the published transaction.
+func (svc *LndhubService) WithdrawOnchain(ctx context.Context, userId int64, address string, amount, estimatedFee int64, satPerVbyte uint64) (*models.OnchainWithdrawal, error) {
+	svc.inFlightPayments.start()
+	defer svc.inFlightPayments.done()
+
+	debitAccount, err := svc.AccountFor(ctx, common.AccountTypeCurrent, userId)
+	if err != nil {
+		svc.Logger.Errorf("Could not find current account user_id:%v", userId)
+		return nil, err
+	}
+	creditAccount, err := svc.AccountFor(ctx, common.AccountTypeOutgoing, userId)
+	if err != nil {
+		svc.Logger.Errorf("Could not find outgoing account user_id:%v", userId)
+		return nil, err
+	}
+	feeAccount, err := svc.AccountFor(ctx, common.AccountTypeFees, userId)
+	if err != nil {
+		svc.Logger.Errorf("Could not find fees account user_id:%v", userId)
+		return nil, err
+	}
+
+	invoice := models.Invoice{
+		Type:   common.InvoiceTypeOutgoing,
+		UserID: userId,
+		Amount: amount,
+		Memo:   fmt.Sprintf("on-chain withdrawal to %s", address),
+		State:  common.InvoiceStateInitialized,
+	}
+	entry, err := svc.insertOnchainWithdrawalEntries(ctx, &invoice, estimatedFee, creditAccount, debitAccount, feeAccount)
+	if err != nil {
+		svc.Logger.Errorf("Could not insert on-chain withdrawal entries user_id:%v error: %v", userId, err)
+		return nil, err
+	}
+
+	// the coins are sent regardless of if the request's context is canceled or not
+	resp, err := svc.LndClient.SendCoins(context.Background(), &lnrpc.SendCoinsRequest{
+		Addr:        address,
+		Amount:      amount,
+		SatPerVbyte: satPerVbyte,
+		Label:       fmt.Sprintf("lndhub withdrawal %d", invoice.ID),
+	})
+	if err != nil {
+		svc.HandleFailedPayment(context.Background(), &invoice, entry, err)
+		return nil, err
+	}
+	invoice.Fee = svc.onchainTransactionFee(context.Background(), resp.Txid, estimatedFee)
+
+	withdrawal := &models.OnchainWithdrawal{
+		UserID:      userId,
+		InvoiceID:   invoice.ID,
+		Address:     address,
+		Amount:      amount,
+		Fee:         invoice.Fee,
+		SatPerVbyte: int64(satPerVbyte),
+		TxHash:      resp.Txid,
+	}
+	// the transaction is published, so the withdrawal is booked even if it can't be stored
+	if _, err := svc.DB.NewInsert().Model(withdrawal).Exec(context.Background()); err != nil {
+		sentry.CaptureException(err)
+		svc.Logger.Errorf("Could not store on-chain withdrawal user_id:%v invoice_id:%v tx_hash:%s error: %v", userId, invoice.ID, resp.Txid, err)
+	}
+	entry.Reference = resp.Txid
+	if _, err := svc.DB.NewUpdate().Model(&entry).Column("reference").WherePK().Exec(context.Background()); err != nil {
+		svc.Logger.Errorf("Could not store the txid of the on-chain withdrawal entry user_id:%v invoice_id:%v tx_hash:%s error: %v", userId, invoice.ID, resp.Txid, err)
+	}
+	svc.Logger.Infof("Sent on-chain withdrawal user_id:%v invoice_id:%v tx_hash:%s amount:%v fee:%v", userId, invoice.ID, resp.Txid, amount, invoice.Fee)
+	err = svc.HandleSuccessfulPayment(context.Background(), &invoice, entry)
+	return withdrawal, err
+}
+
+// insertOnchainWithdrawalEntries stores the invoice of the withdrawal with the outgoing entry and the fee reserve
+func (svc *LndhubService) insertOnchainWithdrawalEntries(ctx context.Context, invoice *models.Invoice, feeReserve int64, creditAccount, debitAccount, feeAccount models.Account) (entry models.TransactionEntry, err error) {
+	tx, err := svc.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return entry, err
+	}
+	defer tx.Rollback()
+	balance, err := svc.lockedAccountBalance(ctx, tx, debitAccount.ID)
+	if err != nil {
+		return entry, err
+	}
+	// payments waiting for their confirmation keep their part of the balance
+	reserved, err := svc.reservedBalance(ctx, tx, invoice.UserID)
+	if err != nil {
+		return entry, err
+	}
+	if balance-reserved < invoice.Amount+feeReserve {
+		return entry, ErrNotEnoughBalance
+	}
+	exceeded, err := svc.dailyOutboundLimitExceeded(ctx, tx, invoice.Amount+feeReserve, invoice.UserID)
+	if err != nil {
+		return entry, err
+	}
+	if exceeded {
+		return entry, ErrDailyLimitExceeded
+	}
+	if _, err = tx.NewInsert().Model(invoice).Exec(ctx); err != nil {
+		return entry, err
+	}
+
+	entry = models.TransactionEntry{
+		UserID:          invoice.UserID,
+		InvoiceID:       invoice.ID,
+		CreditAccountID: creditAccount.ID,
+		DebitAccountID:  debitAccount.ID,
+		Amount:          invoice.Amount,
+		EntryType:       models.EntryTypeOutgoing,
+	}
+	if _, err = tx.NewInsert().Model(&entry).Exec(ctx); err != nil {
+		return entry, err
+	}
+	feeReserveEntry := models.TransactionEntry{
+		UserID:          invoice.UserID,
+		InvoiceID:       invoice.ID,
+		CreditAccountID: feeAccount.ID,
+		DebitAccountID:  debitAccount.ID,
+		Amount:          feeReserve,
+		EntryType:       models.EntryTypeFeeReserve,
+	}
+	if _, err = tx.NewInsert().Model(&feeReserveEntry).Exec(ctx); err != nil {
+		return entry, err
+	}
+	entry.FeeReserve = &feeReserveEntry
+	return entry, tx.Commit()
+}
+
+// onchainTransactionFee looks up the fee of a published wallet transaction, the estimated fee is returned if it is not found
+func (svc *LndhubService) onchainTransactionFee(ctx context.Context, txHash string, estimatedFee int64) int64 {
+	info, err := svc.LndClient.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		svc.Logger.Errorf("Could not look up the fee of on-chain transaction tx_hash:%s error: %v", txHash, err)
+		return estimatedFee
+	}
+	// unconfirmed transactions are included with an end height of -1
+	details, err := svc.LndClient.GetTransactions(ctx, &lnrpc.GetTransactionsRequest{StartHeight: int32(info.BlockHeight), EndHeight: -1})
+	if err != nil {
+		svc.Logger.Errorf("Could not look up the fee of on-chain transaction tx_hash:%s error: %v", txHash, err)
+		return estimatedFee
+	}
+	for _, tx := range details.Transactions {
+		if tx.TxHash == txHash {
+			return tx.TotalFees
+		}
+	}
+	svc.Logger.Errorf("On-chain transaction not found in the wallet, booking the estimated fee tx_hash:%s", txHash)
+	return estimatedFee
+}
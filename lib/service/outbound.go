@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrOutboundHostBlocked is returned for outbound requests to denied hosts and to private addresses that are not allowed
+var ErrOutboundHostBlocked = errors.New("outbound requests to this host are not allowed")
+
+// ErrInvalidOutboundURL is returned by CheckOutboundURL for URLs that can't be requested
+var ErrInvalidOutboundURL = errors.New("invalid outbound url")
+
+// ranges that are not covered by the checks of net.IP
+var blockedNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // this network
+	mustParseCIDR("100.64.0.0/10"), // carrier-grade NAT
+	mustParseCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustParseCIDR("198.18.0.0/15"), // benchmarking
+}
+
+// defaultOutboundClient is used by services without an OutboundClient, private addresses are blocked
+var defaultOutboundClient, _ = NewOutboundClient(&Config{OutboundTimeout: 10})
+
+// outboundPolicy decides which hosts outbound requests may reach, entries are host names (including their subdomains),
+// IP addresses or CIDR ranges
+type outboundPolicy struct {
+	allowed []string
+	denied  []string
+}
+
+// NewOutboundClient returns the client for requests to hosts given by users, e.g. the LNURL servers of lightning addresses.
+// Requests go through OUTBOUND_PROXY if it is set. Denied hosts are never reached, private and loopback addresses only
+// if they are allowed. The addresses of host names are checked when connecting, so a host can't resolve to an internal
+// address. With a proxy the host names are resolved by the proxy, only IP addresses given in the URL are checked then.
+func NewOutboundClient(c *Config) (*http.Client, error) {
+	policy := newOutboundPolicy(c)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c.OutboundProxy != "" {
+		proxyUrl, err := url.Parse(c.OutboundProxy)
+		if err != nil || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid outbound proxy %q", c.OutboundProxy)
+		}
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported outbound proxy scheme %q", proxyUrl.Scheme)
+		}
+		// the proxy is usually on a private address, the connection to it is not checked
+		transport.Proxy = http.ProxyURL(proxyUrl)
+		transport.DialContext = dialer.DialContext
+	} else {
+		transport.Proxy = nil
+		transport.DialContext = policy.dialContext(dialer)
+	}
+	return &http.Client{
+		Transport: &outboundTransport{policy: policy, next: transport},
+		Timeout:   time.Duration(c.OutboundTimeout) * time.Second,
+	}, nil
+}
+
+func newOutboundPolicy(c *Config) *outboundPolicy {
+	return &outboundPolicy{
+		allowed: normalizeHosts(c.OutboundAllowedHosts),
+		denied:  normalizeHosts(c.OutboundDeniedHosts),
+	}
+}
+
+// CheckOutboundURL rejects URLs given by users that the outbound client would not request, it is used before such a URL
+// is stored. Host names are resolved to check their addresses, unless a proxy resolves them.
+func (svc *LndhubService) CheckOutboundURL(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidOutboundURL, rawUrl)
+	}
+	policy := newOutboundPolicy(svc.Config)
+	host := strings.ToLower(u.Hostname())
+	if policy.matches(policy.denied, host, nil) {
+		return fmt.Errorf("%w: %s", ErrOutboundHostBlocked, host)
+	}
+	ips := []net.IP{}
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else if svc.Config.OutboundProxy == "" {
+		addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("%w: %s can't be resolved", ErrInvalidOutboundURL, host)
+		}
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+	for _, ip := range ips {
+		if policy.matches(policy.denied, host, ip) {
+			return fmt.Errorf("%w: %s (%s)", ErrOutboundHostBlocked, host, ip)
+		}
+		if isPrivateAddress(ip) && !policy.matches(policy.allowed, host, ip) {
+			return fmt.Errorf("%w: %s resolves to the private address %s", ErrOutboundHostBlocked, host, ip)
+		}
+	}
+	return nil
+}
+
+// outboundTransport checks the host of every request, including redirects, before it is sent
+type outboundTransport struct {
+	policy *outboundPolicy
+	next   http.RoundTripper
+}
+
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	if t.policy.matches(t.policy.denied, host, nil) {
+		return nil, fmt.Errorf("%w: %s", ErrOutboundHostBlocked, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivateAddress(ip) && !t.policy.matches(t.policy.allowed, host, ip) {
+		return nil, fmt.Errorf("%w: %s", ErrOutboundHostBlocked, host)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// dialContext checks the resolved addresses of the host, the connection fails before anything is sent to a blocked address
+func (p *outboundPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		host = strings.ToLower(host)
+		hostDialer := *dialer
+		hostDialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ipString, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipString)
+			if ip == nil {
+				return fmt.Errorf("%w: %s", ErrOutboundHostBlocked, address)
+			}
+			if p.matches(p.denied, host, ip) {
+				return fmt.Errorf("%w: %s (%s)", ErrOutboundHostBlocked, host, ip)
+			}
+			if isPrivateAddress(ip) && !p.matches(p.allowed, host, ip) {
+				return fmt.Errorf("%w: %s resolves to the private address %s", ErrOutboundHostBlocked, host, ip)
+			}
+			return nil
+		}
+		return hostDialer.DialContext(ctx, network, address)
+	}
+}
+
+// matches checks if the host or the ip is one of the entries, ip can be nil if it is not known yet
+func (p *outboundPolicy) matches(entries []string, host string, ip net.IP) bool {
+	if ip == nil {
+		ip = net.ParseIP(host)
+	}
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrivateAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHosts(hosts []string) []string {
+	result := []string{}
+	for _, host := range hosts {
+		host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+		if host != "" {
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// outboundClient is the client for requests to hosts given by users
+func (svc *LndhubService) outboundClient() *http.Client {
+	if svc.OutboundClient != nil {
+		return svc.OutboundClient
+	}
+	return defaultOutboundClient
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPrivateAddress(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00::1", "fe80::1", "::ffff:127.0.0.1"} {
+		assert.True(t, isPrivateAddress(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{"1.1.1.1", "8.8.8.8", "2606:4700:4700::1111"} {
+		assert.False(t, isPrivateAddress(net.ParseIP(address)), address)
+	}
+}
+
+func outboundTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func outboundGet(client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestOutboundClientBlocksPrivateAddresses(t *testing.T) {
+	server := outboundTestServer(t)
+	client, err := NewOutboundClient(&Config{OutboundTimeout: 5})
+	assert.NoError(t, err)
+
+	err = outboundGet(client, server.URL)
+	assert.ErrorIs(t, err, ErrOutboundHostBlocked)
+	// the address is checked after the host name is resolved
+	err = outboundGet(client, strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	assert.ErrorIs(t, err, ErrOutboundHostBlocked)
+	err = outboundGet(client, "http://169.254.169.254/latest/meta-data")
+	assert.ErrorIs(t, err, ErrOutboundHostBlocked)
+
+	// redirects to private addresses are blocked too
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+	allowRedirect, err := NewOutboundClient(&Config{OutboundTimeout: 5, OutboundAllowedHosts: []string{redirect.Listener.Addr().String()}})
+	assert.NoError(t, err)
+	err = outboundGet(allowRedirect, redirect.URL)
+	assert.ErrorIs(t, err, ErrOutboundHostBlocked)
+}
+
+func TestOutboundClientAllowedAndDeniedHosts(t *testing.T) {
+	server := outboundTestServer(t)
+	client, err := NewOutboundClient(&Config{OutboundTimeout: 5, OutboundAllowedHosts: []string{"127.0.0.0/8", "localhost"}})
+	assert.NoError(t, err)
+	assert.NoError(t, outboundGet(client, server.URL))
+	assert.NoError(t, outboundGet(client, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)))
+
+	client, err = NewOutboundClient(&Config{
+		OutboundTimeout:      5,
+		OutboundAllowedHosts: []string{"127.0.0.1"},
+		OutboundDeniedHosts:  []string{"Example.com", "127.0.0.1"},
+	})
+	assert.NoError(t, err)
+	// denied entries win over allowed ones
+	assert.ErrorIs(t, outboundGet(client, server.URL), ErrOutboundHostBlocked)
+	assert.ErrorIs(t, outboundGet(client, "https://pay.example.com/.well-known/lnurlp/alice"), ErrOutboundHostBlocked)
+}
+
+func TestNewOutboundClientProxy(t *testing.T) {
+	_, err := NewOutboundClient(&Config{OutboundProxy: "socks5://127.0.0.1:9050"})
+	assert.NoError(t, err)
+	_, err = NewOutboundClient(&Config{OutboundProxy: "ftp://127.0.0.1:21"})
+	assert.Error(t, err)
+	_, err = NewOutboundClient(&Config{OutboundProxy: "127.0.0.1:9050"})
+	assert.Error(t, err)
+
+	// requests go to the proxy, private addresses in the URL are still blocked
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "proxied "+r.URL.Host)
+	}))
+	defer proxy.Close()
+	client, err := NewOutboundClient(&Config{OutboundTimeout: 5, OutboundProxy: proxy.URL})
+	assert.NoError(t, err)
+	assert.NoError(t, outboundGet(client, "http://lnurl.example.com/.well-known/lnurlp/alice"))
+	assert.ErrorIs(t, outboundGet(client, "http://10.0.0.1/"), ErrOutboundHostBlocked)
+}
+
+func TestCheckOutboundURL(t *testing.T) {
+	svc := &LndhubService{Config: &Config{}}
+	ctx := context.Background()
+	assert.NoError(t, svc.CheckOutboundURL(ctx, "https://1.1.1.1/hook"))
+	assert.ErrorIs(t, svc.CheckOutboundURL(ctx, "http://169.254.169.254/latest/meta-data"), ErrOutboundHostBlocked)
+	assert.ErrorIs(t, svc.CheckOutboundURL(ctx, "http://localhost:8080/hook"), ErrOutboundHostBlocked)
+	assert.ErrorIs(t, svc.CheckOutboundURL(ctx, "ftp://1.1.1.1/hook"), ErrInvalidOutboundURL)
+	assert.ErrorIs(t, svc.CheckOutboundURL(ctx, "not a url"), ErrInvalidOutboundURL)
+
+	svc.Config = &Config{OutboundAllowedHosts: []string{"localhost"}, OutboundDeniedHosts: []string{"1.1.1.1"}}
+	assert.NoError(t, svc.CheckOutboundURL(ctx, "http://localhost:8080/hook"))
+	assert.ErrorIs(t, svc.CheckOutboundURL(ctx, "https://1.1.1.1/hook"), ErrOutboundHostBlocked)
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// ErrInsufficientNodeLiquidity is returned for payments the node can't send, the user's balance is not debited
+var ErrInsufficientNodeLiquidity = errors.New("the node does not have enough outbound liquidity for this payment")
+
+// checkOutboundLiquidity rejects payments above the local balance of the channels of the node if EnforceOutboundLiquidity
+// is set, they would fail with no route. Internal payments don't need liquidity, and failures to get the balance
+// don't reject the payment.
+func (svc *LndhubService) checkOutboundLiquidity(ctx context.Context, invoice *models.Invoice) error {
+	if !svc.Config.EnforceOutboundLiquidity || svc.isInternalPayment(invoice) {
+		return nil
+	}
+	channelBalance, err := svc.LndClient.ChannelBalance(ctx, &lnrpc.ChannelBalanceRequest{})
+	if err != nil {
+		svc.Logger.Errorf("Could not get the channel balance user_id:%v invoice_id:%v error: %v", invoice.UserID, invoice.ID, err)
+		return nil
+	}
+	localBalance := channelBalance.Balance
+	if channelBalance.LocalBalance != nil {
+		localBalance = int64(channelBalance.LocalBalance.Sat)
+	}
+	if invoice.Amount > localBalance {
+		svc.Logger.Errorf("Payment exceeds the outbound liquidity user_id:%v invoice_id:%v amount:%v local_balance:%v", invoice.UserID, invoice.ID, invoice.Amount, localBalance)
+		return ErrInsufficientNodeLiquidity
+	}
+	return nil
+}
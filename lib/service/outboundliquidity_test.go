@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestCheckOutboundLiquidity(t *testing.T) {
+	var channelBalanceErr error
+	client := &testutils.MockLightningClient{
+		Pubkey: "02ournode",
+		ChannelBalanceFunc: func(ctx context.Context, req *lnrpc.ChannelBalanceRequest) (*lnrpc.ChannelBalanceResponse, error) {
+			if channelBalanceErr != nil {
+				return nil, channelBalanceErr
+			}
+			return &lnrpc.ChannelBalanceResponse{LocalBalance: &lnrpc.Amount{Sat: 1000, Msat: 1000000}}, nil
+		},
+	}
+	svc := &LndhubService{
+		Config:    &Config{EnforceOutboundLiquidity: true},
+		LndClient: client,
+		Logger:    lecho.New(io.Discard),
+	}
+	// keysend payments to other nodes are never internal, no database is needed
+	invoice := &models.Invoice{Amount: 1000, Keysend: true, DestinationPubkeyHex: "03othernode"}
+	assert.NoError(t, svc.checkOutboundLiquidity(context.Background(), invoice))
+	invoice.Amount = 1001
+	assert.ErrorIs(t, svc.checkOutboundLiquidity(context.Background(), invoice), ErrInsufficientNodeLiquidity)
+
+	// payments to our own node are settled on the ledger
+	assert.NoError(t, svc.checkOutboundLiquidity(context.Background(), &models.Invoice{Amount: 5000, DestinationPubkeyHex: "02ournode"}))
+
+	channelBalanceErr = errors.New("node is offline")
+	assert.NoError(t, svc.checkOutboundLiquidity(context.Background(), invoice))
+
+	svc.Config.EnforceOutboundLiquidity = false
+	calls := client.Calls("ChannelBalance")
+	assert.NoError(t, svc.checkOutboundLiquidity(context.Background(), invoice))
+	assert.Equal(t, calls, client.Calls("ChannelBalance"))
+
+	errResp := PaymentFailedError(ErrInsufficientNodeLiquidity)
+	assert.Equal(t, http.StatusServiceUnavailable, errResp.HttpStatusCode)
+	if assert.NotNil(t, errResp.Retryable) {
+		assert.True(t, *errResp.Retryable)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrPaymentConfirmationNotFound = errors.New("payment confirmation not found or already used")
+	ErrPaymentConfirmationExpired  = errors.New("payment confirmation expired")
+)
+
+// NeedsPaymentConfirmation reports if a payment of the amount has to be confirmed before it is sent
+func (svc *LndhubService) NeedsPaymentConfirmation(amount int64) bool {
+	return svc.Config.ConfirmationThresholdSats > 0 && amount > svc.Config.ConfirmationThresholdSats
+}
+
+// PaymentReserve returns the balance a lightning payment needs: the amount, the service fee and the fee limit if the fee is reserved
+func (svc *LndhubService) PaymentReserve(destination string, amount, feeLimit int64) int64 {
+	reserve := amount + svc.CalcServiceFee(destination, amount)
+	if svc.Config.FeeReserve {
+		reserve += feeLimit
+	}
+	return reserve
+}
+
+// CreatePaymentConfirmation stores the payment with a new token that is valid for ConfirmationTimeout seconds.
+// confirmation.Amount is reserved from the balance until the payment is confirmed or the token expired, so other payments
+// can't spend it in the meantime. The payment is only debited when it is confirmed, the limits are checked again then.
+// ErrNotEnoughBalance is returned if the balance that is not reserved yet doesn't cover the amount.
+func (svc *LndhubService) CreatePaymentConfirmation(ctx context.Context, confirmation *models.PaymentConfirmation, lnPayReq *lnd.LNPayReq) error {
+	token, err := randBytesFromStr(32, alphaNumBytes)
+	if err != nil {
+		return err
+	}
+	payReq, err := json.Marshal(lnPayReq.PayReq)
+	if err != nil {
+		return err
+	}
+	if confirmation.PaymentType == "" {
+		confirmation.PaymentType = common.PaymentConfirmationTypeBolt11
+	}
+	confirmation.Token = string(token)
+	confirmation.Offer = lnPayReq.Offer
+	confirmation.PayReq = payReq
+	confirmation.ExpiresAt = time.Now().Add(time.Duration(svc.Config.ConfirmationTimeout) * time.Second)
+	currentAccount, err := svc.AccountFor(ctx, common.AccountTypeCurrent, confirmation.UserID)
+	if err != nil {
+		return err
+	}
+	return svc.WithTx(ctx, func(tx bun.Tx) error {
+		// locked like for a payment, so that concurrent payments and confirmations see the reservation
+		balance, err := svc.lockedAccountBalance(ctx, tx, currentAccount.ID)
+		if err != nil {
+			return err
+		}
+		reserved, err := svc.reservedBalance(ctx, tx, confirmation.UserID)
+		if err != nil {
+			return err
+		}
+		if balance-reserved < confirmation.Amount {
+			svc.Logger.Errorf("Not enough balance for payment confirmation user_id:%v balance:%v reserved:%v amount:%v", confirmation.UserID, balance, reserved, confirmation.Amount)
+			return ErrNotEnoughBalance
+		}
+		// the expired confirmations of the user are not needed anymore
+		_, err = tx.NewDelete().
+			Model((*models.PaymentConfirmation)(nil)).
+			Where("user_id = ?", confirmation.UserID).
+			Where("expires_at < ?", time.Now()).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewInsert().Model(confirmation).Exec(ctx)
+		return err
+	})
+}
+
+// reservedBalance returns the part of the balance of the user that is reserved for payments waiting for their confirmation
+func (svc *LndhubService) reservedBalance(ctx context.Context, db bun.IDB, userId int64) (int64, error) {
+	var reserved int64
+	err := db.NewSelect().
+		Model((*models.PaymentConfirmation)(nil)).
+		ColumnExpr("COALESCE(SUM(amount), 0)").
+		Where("user_id = ?", userId).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Scan(ctx, &reserved)
+	return reserved, err
+}
+
+// ClaimPaymentConfirmation marks the confirmation of the user as used and returns it with the payment to send,
+// only one caller can claim a confirmation. Its balance is not reserved anymore then, it is debited by the payment.
+func (svc *LndhubService) ClaimPaymentConfirmation(ctx context.Context, userId int64, token string) (*models.PaymentConfirmation, *lnd.LNPayReq, error) {
+	confirmation := models.PaymentConfirmation{}
+	_, err := svc.DB.NewUpdate().
+		Model(&confirmation).
+		Set("used_at = ?", time.Now()).
+		Where("token = ?", token).
+		Where("user_id = ?", userId).
+		Where("used_at IS NULL").
+		Returning("*").
+		Exec(ctx)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && confirmation.ID == 0) {
+		return nil, nil, ErrPaymentConfirmationNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(confirmation.ExpiresAt) {
+		return nil, nil, ErrPaymentConfirmationExpired
+	}
+	payReq := &lnrpc.PayReq{}
+	if err := json.Unmarshal(confirmation.PayReq, payReq); err != nil {
+		return nil, nil, err
+	}
+	return &confirmation, &lnd.LNPayReq{PayReq: payReq, Offer: confirmation.Offer}, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+)
+
+// the error codes of failed payments, clients can rely on them not to change
+const (
+	PaymentFailedCode              = 10
+	PaymentNoRouteCode             = 11
+	PaymentInsufficientBalanceCode = 12
+	PaymentIncorrectDetailsCode    = 13
+	PaymentRouteTimeoutCode        = 14
+	PaymentAlreadyPaidCode         = 15
+	PaymentTemporaryFailureCode    = 16
+)
+
+type paymentFailure struct {
+	code      int
+	retryable bool
+}
+
+// the failure reasons of paymentFailureReason with the error code and if sending the payment again can succeed
+var paymentFailures = map[string]paymentFailure{
+	"no_route":                  {PaymentNoRouteCode, true},
+	"insufficient_balance":      {PaymentInsufficientBalanceCode, true},
+	"incorrect_payment_details": {PaymentIncorrectDetailsCode, false},
+	"timeout":                   {PaymentRouteTimeoutCode, true},
+	"already_paid":              {PaymentAlreadyPaidCode, false},
+	"temporary_failure":         {PaymentTemporaryFailureCode, true},
+}
+
+// PaymentRejected reports if a PayInvoice error rejected the payment before it was sent, nothing was paid then.
+// Other errors, e.g. timeouts or database errors, can happen after the payment went out.
+func PaymentRejected(err error) bool {
+	return errors.Is(err, ErrNotEnoughBalance) || errors.Is(err, ErrDailyLimitExceeded) || errors.Is(err, ErrInsufficientNodeLiquidity)
+}
+
+// StoredPaymentError restores the error of a failed payment from the error message of its invoice, so that a replayed
+// request gets the same response. Rejections get their sentinel error back, other failures are mapped by their message.
+func StoredPaymentError(errorMessage string) error {
+	for _, err := range []error{ErrNotEnoughBalance, ErrDailyLimitExceeded, ErrInsufficientNodeLiquidity} {
+		if errorMessage == err.Error() {
+			return err
+		}
+	}
+	return errors.New(errorMessage)
+}
+
+// PaymentFailedError maps the error of a failed payment to the error response of the API.
+// Unknown failures get the generic code 10 and are not retryable.
+func PaymentFailedError(err error) *responses.ErrorResponse {
+	if errors.Is(err, ErrDailyLimitExceeded) {
+		return &responses.DailyLimitExceededError
+	}
+	if errors.Is(err, ErrInsufficientNodeLiquidity) {
+		// the node can send again once its channels have been rebalanced
+		retryable := true
+		errResp := responses.InsufficientNodeLiquidityError
+		errResp.Retryable = &retryable
+		return &errResp
+	}
+	failure, ok := paymentFailures[paymentFailureReason(err)]
+	if !ok {
+		failure = paymentFailure{PaymentFailedCode, false}
+	}
+	retryable := failure.retryable
+	return &responses.ErrorResponse{
+		Error:          true,
+		Code:           failure.code,
+		Message:        err.Error(),
+		Retryable:      &retryable,
+		HttpStatusCode: http.StatusInternalServerError,
+	}
+}
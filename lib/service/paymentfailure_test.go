@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentFailedError(t *testing.T) {
+	tests := []struct {
+		err       error
+		code      int
+		retryable bool
+	}{
+		{errors.New(lnrpc.PaymentFailureReason_FAILURE_REASON_NONE.String()), PaymentFailedCode, false},
+		{errors.New(lnrpc.PaymentFailureReason_FAILURE_REASON_TIMEOUT.String()), PaymentRouteTimeoutCode, true},
+		{errors.New(lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE.String()), PaymentNoRouteCode, true},
+		{errors.New(lnrpc.PaymentFailureReason_FAILURE_REASON_ERROR.String()), PaymentFailedCode, false},
+		{errors.New(lnrpc.PaymentFailureReason_FAILURE_REASON_INCORRECT_PAYMENT_DETAILS.String()), PaymentIncorrectDetailsCode, false},
+		{errors.New(lnrpc.PaymentFailureReason_FAILURE_REASON_INSUFFICIENT_BALANCE.String()), PaymentInsufficientBalanceCode, true},
+		// the payment errors of SendPaymentSync
+		{errors.New("unable to find a path to destination"), PaymentNoRouteCode, true},
+		{errors.New("incorrect_or_unknown_payment_details"), PaymentIncorrectDetailsCode, false},
+		{errors.New("invoice is already paid"), PaymentAlreadyPaidCode, false},
+		{errors.New("TemporaryChannelFailure"), PaymentTemporaryFailureCode, true},
+		{errors.New("something else"), PaymentFailedCode, false},
+	}
+	// every failure reason of the node is covered
+	for _, reason := range lnrpc.PaymentFailureReason_name {
+		covered := false
+		for _, tt := range tests {
+			covered = covered || tt.err.Error() == reason
+		}
+		assert.True(t, covered, reason)
+	}
+	for _, tt := range tests {
+		errResp := PaymentFailedError(tt.err)
+		assert.True(t, errResp.Error, tt.err.Error())
+		assert.Equal(t, tt.code, errResp.Code, tt.err.Error())
+		assert.Equal(t, tt.err.Error(), errResp.Message)
+		assert.Equal(t, http.StatusInternalServerError, errResp.HttpStatusCode)
+		if assert.NotNil(t, errResp.Retryable, tt.err.Error()) {
+			assert.Equal(t, tt.retryable, *errResp.Retryable, tt.err.Error())
+		}
+	}
+}
+
+func TestStoredPaymentError(t *testing.T) {
+	assert.ErrorIs(t, StoredPaymentError(ErrNotEnoughBalance.Error()), ErrNotEnoughBalance)
+	assert.ErrorIs(t, StoredPaymentError(ErrDailyLimitExceeded.Error()), ErrDailyLimitExceeded)
+	assert.ErrorIs(t, StoredPaymentError(ErrInsufficientNodeLiquidity.Error()), ErrInsufficientNodeLiquidity)
+	noRoute := lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE.String()
+	assert.Equal(t, PaymentFailedError(errors.New(noRoute)), PaymentFailedError(StoredPaymentError(noRoute)))
+}
+
+func TestPaymentRejected(t *testing.T) {
+	assert.True(t, PaymentRejected(ErrNotEnoughBalance))
+	assert.True(t, PaymentRejected(ErrDailyLimitExceeded))
+	assert.True(t, PaymentRejected(ErrInsufficientNodeLiquidity))
+	assert.False(t, PaymentRejected(errors.New(lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE.String())))
+	assert.False(t, PaymentRejected(errors.New("context deadline exceeded")))
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+)
+
+// VerifyPaymentPreimage checks that the preimage proves a settled outgoing payment of the user.
+// sql.ErrNoRows is returned if the payment hash is not one of the user's outgoing payments.
+func (svc *LndhubService) VerifyPaymentPreimage(ctx context.Context, userId int64, paymentHash, preimage string) (bool, error) {
+	paymentHash = strings.ToLower(paymentHash)
+	var payment models.Invoice
+	// a failed payment can be retried with the same hash, the settled one is the one that counts
+	err := svc.DB.NewSelect().Model(&payment).
+		Where("user_id = ? AND type = ? AND r_hash = ?", userId, common.InvoiceTypeOutgoing, paymentHash).
+		OrderExpr("CASE WHEN state = ? THEN 0 ELSE 1 END", common.InvoiceStateSettled).
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		return false, err
+	}
+	if payment.State != common.InvoiceStateSettled {
+		return false, nil
+	}
+	return PreimageMatchesHash(preimage, paymentHash), nil
+}
+
+// PreimageMatchesHash reports if the sha256 of the hex encoded preimage is the hex encoded payment hash.
+// The hashes are compared in constant time.
+func PreimageMatchesHash(preimageHex, paymentHashHex string) bool {
+	preimage, err := hex.DecodeString(preimageHex)
+	if err != nil {
+		return false
+	}
+	paymentHash, err := hex.DecodeString(paymentHashHex)
+	if err != nil || len(paymentHash) != sha256.Size {
+		return false
+	}
+	hash := sha256.Sum256(preimage)
+	return subtle.ConstantTimeCompare(hash[:], paymentHash) == 1
+}
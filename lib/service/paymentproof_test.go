@@ -0,0 +1,25 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreimageMatchesHash(t *testing.T) {
+	preimage := strings.Repeat("ab", 32)
+	preimageBytes, _ := hex.DecodeString(preimage)
+	hash := sha256.Sum256(preimageBytes)
+	paymentHash := hex.EncodeToString(hash[:])
+
+	assert.True(t, PreimageMatchesHash(preimage, paymentHash))
+	assert.True(t, PreimageMatchesHash(strings.ToUpper(preimage), paymentHash))
+	assert.False(t, PreimageMatchesHash(strings.Repeat("cd", 32), paymentHash))
+	assert.False(t, PreimageMatchesHash("not hex", paymentHash))
+	assert.False(t, PreimageMatchesHash(preimage, paymentHash[:62]))
+	// the preimage is not its own hash
+	assert.False(t, PreimageMatchesHash(paymentHash, paymentHash))
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestSendPaymentWithRetries(t *testing.T) {
+	succeeded := &lnrpc.SendResponse{
+		PaymentPreimage: []byte{1, 2, 3},
+		PaymentHash:     []byte{4, 5, 6},
+		PaymentRoute:    &lnrpc.Route{TotalAmt: 101, TotalFees: 1},
+	}
+	tests := []struct {
+		name             string
+		maxRetries       int
+		failures         []string
+		expectedAttempts int
+		expectError      bool
+	}{
+		{
+			name:             "retries disabled",
+			failures:         []string{"TemporaryChannelFailure"},
+			expectedAttempts: 1,
+			expectError:      true,
+		},
+		{
+			name:             "temporary failure then success",
+			maxRetries:       2,
+			failures:         []string{"TemporaryChannelFailure"},
+			expectedAttempts: 2,
+		},
+		{
+			// the node has already tried all the routes it knows
+			name:             "no route",
+			maxRetries:       2,
+			failures:         []string{"unable to find a path to destination"},
+			expectedAttempts: 1,
+			expectError:      true,
+		},
+		{
+			name:             "retries exhausted",
+			maxRetries:       2,
+			failures:         []string{"TemporaryChannelFailure", "TemporaryChannelFailure", "TemporaryChannelFailure"},
+			expectedAttempts: 3,
+			expectError:      true,
+		},
+		{
+			// the destination rejected the payment, another route doesn't help
+			name:             "terminal failure",
+			maxRetries:       2,
+			failures:         []string{"incorrect_or_unknown_payment_details"},
+			expectedAttempts: 1,
+			expectError:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &testutils.MockLightningClient{}
+			mock.SendPaymentSyncFunc = func(ctx context.Context, req *lnrpc.SendRequest) (*lnrpc.SendResponse, error) {
+				if call := mock.Calls("SendPaymentSync"); call <= len(tt.failures) {
+					return &lnrpc.SendResponse{PaymentError: tt.failures[call-1]}, nil
+				}
+				return succeeded, nil
+			}
+			retrySvc := &LndhubService{
+				Config:    &Config{MaxFeeAmount: 1e6, PaymentMaxRetries: tt.maxRetries, PaymentRetryDelay: 1},
+				LndClient: mock,
+				Logger:    lecho.New(io.Discard),
+			}
+			invoice := &models.Invoice{ID: 1, UserID: 1, Amount: 100, PaymentRequest: "lnbc1"}
+
+			start := time.Now()
+			_, err := retrySvc.sendPaymentWithRetries(context.Background(), invoice)
+			// the retries wait 1ms, 2ms, ...
+			assert.GreaterOrEqual(t, time.Since(start), time.Duration(1<<(tt.expectedAttempts-1)-1)*time.Millisecond)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedAttempts, mock.Calls("SendPaymentSync"))
+			assert.Equal(t, tt.expectedAttempts, invoice.PaymentAttempts)
+		})
+	}
+}
+
+func TestRetryablePaymentError(t *testing.T) {
+	assert.True(t, retryablePaymentError(errors.New("TemporaryChannelFailure")))
+	assert.False(t, retryablePaymentError(errors.New("FAILURE_REASON_NO_ROUTE")))
+	assert.False(t, retryablePaymentError(errors.New("FAILURE_REASON_INCORRECT_PAYMENT_DETAILS")))
+	assert.False(t, retryablePaymentError(errors.New("invoice is already paid")))
+	assert.False(t, retryablePaymentError(PaymentTimeoutError))
+}
+
+func TestSendPaymentWithRetriesCanceled(t *testing.T) {
+	mock := &testutils.MockLightningClient{}
+	mock.SendPaymentSyncFunc = func(ctx context.Context, req *lnrpc.SendRequest) (*lnrpc.SendResponse, error) {
+		return &lnrpc.SendResponse{PaymentError: "TemporaryChannelFailure"}, nil
+	}
+	retrySvc := &LndhubService{
+		Config:    &Config{MaxFeeAmount: 1e6, PaymentMaxRetries: 2, PaymentRetryDelay: 60000},
+		LndClient: mock,
+		Logger:    lecho.New(io.Discard),
+	}
+	invoice := &models.Invoice{ID: 1, UserID: 1, Amount: 100, PaymentRequest: "lnbc1"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	// the retry is not sent once the payment timed out
+	_, err := retrySvc.sendPaymentWithRetries(ctx, invoice)
+	assert.Error(t, err)
+	assert.Equal(t, 1, mock.Calls("SendPaymentSync"))
+}
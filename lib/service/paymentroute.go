@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrPaymentRouteNotFound is returned for payments without an attempted route, e.g. internal payments
+// and payments for which the node found no route
+var ErrPaymentRouteNotFound = errors.New("no route information available for this payment")
+
+// the current state of the payment is returned right away, the timeout is for backends that wait for in-flight payments
+const paymentRouteLookupTimeout = 10 * time.Second
+
+// PaymentRoutes returns the routes that were attempted for an outgoing payment of the user. They are not stored,
+// the payment record of the node is looked up. Returns sql.ErrNoRows if the user has no such payment.
+func (svc *LndhubService) PaymentRoutes(ctx context.Context, userID int64, rHash string) (*lnrpc.Payment, []*lnrpc.HTLCAttempt, error) {
+	invoice, err := svc.FindInvoiceByPaymentHash(ctx, userID, rHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if invoice.Type != common.InvoiceTypeOutgoing {
+		return nil, nil, sql.ErrNoRows
+	}
+	// internal payments are settled on our ledger and were never sent by the node
+	if invoice.Internal {
+		return nil, nil, ErrPaymentRouteNotFound
+	}
+	paymentHash, err := hex.DecodeString(invoice.RHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return svc.nodePaymentRoutes(ctx, paymentHash)
+}
+
+// nodePaymentRoutes looks up the payment on the node and returns its attempts that have a route
+func (svc *LndhubService) nodePaymentRoutes(ctx context.Context, paymentHash []byte) (*lnrpc.Payment, []*lnrpc.HTLCAttempt, error) {
+	ctx, cancel := context.WithTimeout(ctx, paymentRouteLookupTimeout)
+	defer cancel()
+	paymentTracker, err := svc.LndClient.SubscribePayment(ctx, &routerrpc.TrackPaymentRequest{PaymentHash: paymentHash})
+	if err != nil {
+		return nil, nil, err
+	}
+	payment, err := paymentTracker.Recv()
+	if status.Code(err) == codes.NotFound {
+		return nil, nil, ErrPaymentRouteNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	attempts := []*lnrpc.HTLCAttempt{}
+	for _, htlc := range payment.Htlcs {
+		if htlc.Route != nil && len(htlc.Route.Hops) > 0 {
+			attempts = append(attempts, htlc)
+		}
+	}
+	// no route was found or the backend doesn't report the routes
+	if len(attempts) == 0 {
+		return nil, nil, ErrPaymentRouteNotFound
+	}
+	return payment, attempts, nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func paymentRouteTestService(t *testing.T, stream *testutils.MockPaymentStream) *LndhubService {
+	return &LndhubService{
+		LndClient: &testutils.MockLightningClient{
+			SubscribePaymentFunc: func(ctx context.Context, req *routerrpc.TrackPaymentRequest) (lnd.SubscribePaymentWrapper, error) {
+				// the current state is needed, not the final one
+				assert.False(t, req.NoInflightUpdates)
+				return stream, nil
+			},
+		},
+	}
+}
+
+func TestNodePaymentRoutes(t *testing.T) {
+	route := &lnrpc.Route{TotalAmtMsat: 101000, TotalFeesMsat: 1000, Hops: []*lnrpc.Hop{
+		{PubKey: "02aa", ChanId: 123, AmtToForwardMsat: 100000, FeeMsat: 1000},
+		{PubKey: "03bb", ChanId: 456, AmtToForwardMsat: 100000},
+	}}
+	svc := paymentRouteTestService(t, &testutils.MockPaymentStream{Payments: []*lnrpc.Payment{{
+		Status: lnrpc.Payment_FAILED,
+		Htlcs: []*lnrpc.HTLCAttempt{
+			{Status: lnrpc.HTLCAttempt_FAILED, Route: route, Failure: &lnrpc.Failure{Code: lnrpc.Failure_TEMPORARY_CHANNEL_FAILURE, FailureSourceIndex: 1}},
+			// an attempt without a route is skipped
+			{Status: lnrpc.HTLCAttempt_FAILED},
+		},
+	}}})
+	payment, attempts, err := svc.nodePaymentRoutes(context.Background(), []byte{1})
+	assert.NoError(t, err)
+	assert.Equal(t, lnrpc.Payment_FAILED, payment.Status)
+	assert.Len(t, attempts, 1)
+	assert.Equal(t, route, attempts[0].Route)
+}
+
+func TestNodePaymentRoutesNotFound(t *testing.T) {
+	// the node found no route
+	svc := paymentRouteTestService(t, &testutils.MockPaymentStream{Payments: []*lnrpc.Payment{{
+		Status:        lnrpc.Payment_FAILED,
+		FailureReason: lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE,
+	}}})
+	_, _, err := svc.nodePaymentRoutes(context.Background(), []byte{1})
+	assert.ErrorIs(t, err, ErrPaymentRouteNotFound)
+
+	// the node doesn't know the payment
+	svc = paymentRouteTestService(t, &testutils.MockPaymentStream{Err: status.Error(codes.NotFound, "payment isn't initiated")})
+	_, _, err = svc.nodePaymentRoutes(context.Background(), []byte{1})
+	assert.ErrorIs(t, err, ErrPaymentRouteNotFound)
+
+	// other errors are not hidden
+	svc = paymentRouteTestService(t, &testutils.MockPaymentStream{Err: status.Error(codes.Unavailable, "node is offline")})
+	_, _, err = svc.nodePaymentRoutes(context.Background(), []byte{1})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrPaymentRouteNotFound)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/pricing"
+	"github.com/getAlby/lndhub.go/lib/responses"
+)
+
+// StartPriceRefreshRoutine refreshes the cached bitcoin prices twice per PriceCacheTTL,
+// so the rates only become stale when the provider is unavailable for a while
+func (svc *LndhubService) StartPriceRefreshRoutine(ctx context.Context) {
+	interval := svc.PriceService.TTL() / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := svc.PriceService.Refresh(ctx)
+			if err != nil && ctx.Err() == nil {
+				// the last rates are served until the next refresh succeeds
+				svc.Logger.Errorf("Failed to refresh the bitcoin prices: %v", err)
+			}
+		}
+	}
+}
+
+// ConvertFiatAmount converts the fiat amount to sats with the current rate of the price service.
+// Rates older than MaxPriceAge are not used, the invoice would not be worth the requested amount.
+func (svc *LndhubService) ConvertFiatAmount(currency string, fiatAmount float64) (int64, pricing.Rate, *responses.ErrorResponse) {
+	if svc.PriceService == nil {
+		return 0, pricing.Rate{}, &responses.BadArgumentsError
+	}
+	rate, err := svc.PriceService.Rate(currency)
+	if errors.Is(err, pricing.ErrUnknownCurrency) {
+		return 0, pricing.Rate{}, &responses.BadArgumentsError
+	}
+	if err != nil {
+		svc.Logger.Errorf("Failed to fetch the bitcoin price currency:%v error: %v", currency, err)
+		return 0, pricing.Rate{}, &responses.PriceUnavailableError
+	}
+	if rate.Age() > time.Duration(svc.Config.MaxPriceAge)*time.Second {
+		svc.Logger.Errorf("Bitcoin price is outdated currency:%v fetched_at:%v", rate.Currency, rate.FetchedAt)
+		return 0, pricing.Rate{}, &responses.PriceUnavailableError
+	}
+	amount := pricing.FiatToSats(fiatAmount, rate.Price)
+	if amount < 1 {
+		return 0, pricing.Rate{}, &responses.BadArgumentsError
+	}
+	return amount, rate, nil
+}
+
+// AddFiatInvoice creates an invoice of the converted amount, the fiat amount and the rate are stored with the invoice
+func (svc *LndhubService) AddFiatInvoice(ctx context.Context, userID int64, amount int64, fiatAmount float64, rate pricing.Rate, memo, descriptionHashStr string, expirySeconds int64, clientInvoiceID string, includePrivateHints bool) (*models.Invoice, *responses.ErrorResponse) {
+	return svc.addIncomingInvoice(ctx, models.Invoice{
+		UserID:            userID,
+		Amount:            amount,
+		Memo:              memo,
+		DescriptionHash:   descriptionHashStr,
+		Expiry:            expirySeconds,
+		FiatCurrency:      rate.Currency,
+		FiatAmount:        fiatAmount,
+		FiatRate:          rate.Price,
+		ClientInvoiceID:   clientInvoiceID,
+		PrivateRouteHints: includePrivateHints,
+	})
+}
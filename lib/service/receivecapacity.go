@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// the channels are listed at most this often, the capacity is only a hint for the clients
+const receiveCapacityCacheDuration = 10 * time.Second
+
+type ReceiveCapacity struct {
+	// sum of the remote balances of the active channels
+	InboundSat int64
+	// the largest remote balance of a single channel, the limit for payers without multi-part payments
+	LargestChannelInboundSat int64
+	ActiveChannels           int
+}
+
+type receiveCapacityCache struct {
+	mu        sync.Mutex
+	fetchedAt time.Time
+	capacity  *ReceiveCapacity
+}
+
+// ReceiveCapacity returns the inbound liquidity of the node, it is cached for a few seconds
+func (svc *LndhubService) ReceiveCapacity(ctx context.Context) (*ReceiveCapacity, error) {
+	svc.receiveCapacity.mu.Lock()
+	defer svc.receiveCapacity.mu.Unlock()
+	if svc.receiveCapacity.capacity != nil && time.Since(svc.receiveCapacity.fetchedAt) < receiveCapacityCacheDuration {
+		return svc.receiveCapacity.capacity, nil
+	}
+	// inactive channels can't receive
+	channels, err := svc.LndClient.ListChannels(ctx, &lnrpc.ListChannelsRequest{ActiveOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	capacity := &ReceiveCapacity{}
+	for _, channel := range channels.Channels {
+		if !channel.Active {
+			continue
+		}
+		capacity.ActiveChannels++
+		capacity.InboundSat += channel.RemoteBalance
+		if channel.RemoteBalance > capacity.LargestChannelInboundSat {
+			capacity.LargestChannelInboundSat = channel.RemoteBalance
+		}
+	}
+	svc.receiveCapacity.capacity = capacity
+	svc.receiveCapacity.fetchedAt = time.Now()
+	return capacity, nil
+}
+
+// checkInboundLiquidity rejects invoices that can't be paid through the channels of the node if EnforceInboundLiquidity
+// is set. Invoices without amount and failures to list the channels are not rejected.
+func (svc *LndhubService) checkInboundLiquidity(ctx context.Context, amount int64) *responses.ErrorResponse {
+	if !svc.Config.EnforceInboundLiquidity || amount <= 0 {
+		return nil
+	}
+	capacity, err := svc.ReceiveCapacity(ctx)
+	if err != nil {
+		svc.Logger.Errorf("Could not get the receive capacity: %v", err)
+		return nil
+	}
+	if amount > capacity.InboundSat {
+		svc.Logger.Errorf("Invoice amount exceeds the inbound liquidity amount:%v inbound:%v", amount, capacity.InboundSat)
+		return &responses.InsufficientInboundLiquidityError
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lnd/testutils"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+)
+
+func receiveCapacityTestService(channels []*lnrpc.Channel, err error) (*LndhubService, *testutils.MockLightningClient) {
+	client := &testutils.MockLightningClient{
+		ListChannelsFunc: func(ctx context.Context, req *lnrpc.ListChannelsRequest) (*lnrpc.ListChannelsResponse, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &lnrpc.ListChannelsResponse{Channels: channels}, nil
+		},
+	}
+	return &LndhubService{
+		Config:    &Config{EnforceInboundLiquidity: true},
+		LndClient: client,
+		Logger:    lecho.New(io.Discard),
+	}, client
+}
+
+func TestReceiveCapacity(t *testing.T) {
+	svc, client := receiveCapacityTestService([]*lnrpc.Channel{
+		{Active: true, RemoteBalance: 3000, LocalBalance: 1000},
+		{Active: true, RemoteBalance: 5000},
+		// not returned by every backend for active_only
+		{Active: false, RemoteBalance: 100000},
+	}, nil)
+	capacity, err := svc.ReceiveCapacity(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &ReceiveCapacity{InboundSat: 8000, LargestChannelInboundSat: 5000, ActiveChannels: 2}, capacity)
+
+	// the capacity is cached
+	_, err = svc.ReceiveCapacity(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.Calls("ListChannels"))
+
+	assert.Nil(t, svc.checkInboundLiquidity(context.Background(), 8000))
+	assert.Equal(t, &responses.InsufficientInboundLiquidityError, svc.checkInboundLiquidity(context.Background(), 8001))
+	// invoices without amount can't be checked
+	assert.Nil(t, svc.checkInboundLiquidity(context.Background(), 0))
+
+	svc.Config.EnforceInboundLiquidity = false
+	assert.Nil(t, svc.checkInboundLiquidity(context.Background(), 100000))
+}
+
+func TestCheckInboundLiquidityNodeError(t *testing.T) {
+	svc, _ := receiveCapacityTestService(nil, errors.New("node is offline"))
+	_, err := svc.ReceiveCapacity(context.Background())
+	assert.Error(t, err)
+	// invoices are not rejected because the channels couldn't be listed
+	assert.Nil(t, svc.checkInboundLiquidity(context.Background(), 1000))
+}
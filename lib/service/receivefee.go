@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"math"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/uptrace/bun"
+)
+
+// CalcReceiveFee returns the part of a settled incoming amount that is not credited to the user.
+// The minimum is compared to the paid amount before the fee is deducted: amounts below MIN_RECEIVE_SATS are
+// kept completely (policy operator) or credited without a fee (policy credit_without_fee), all others pay RECEIVE_FEE_PERCENT.
+func (svc *LndhubService) CalcReceiveFee(amount int64) int64 {
+	if svc.belowMinReceive(amount) {
+		if svc.Config.MinReceivePolicy == MinReceivePolicyCreditWithoutFee {
+			return 0
+		}
+		return amount
+	}
+	return int64(math.Ceil(float64(amount) * svc.Config.ReceiveFeePercent / 100))
+}
+
+func (svc *LndhubService) belowMinReceive(amount int64) bool {
+	return svc.Config.MinReceiveSats > 0 && amount < svc.Config.MinReceiveSats
+}
+
+// insertReceiveFeeEntry books the receive fee of a settled incoming invoice, stored in invoice.Fee,
+// from the current account to the fees account of the user
+func (svc *LndhubService) insertReceiveFeeEntry(ctx context.Context, db bun.IDB, invoice *models.Invoice, incomingEntry models.TransactionEntry) error {
+	if invoice.Fee == 0 {
+		return nil
+	}
+	feeAccount, err := svc.AccountFor(ctx, common.AccountTypeFees, invoice.UserID)
+	if err != nil {
+		return err
+	}
+	entryType := models.EntryTypeReceiveFee
+	if svc.belowMinReceive(invoice.Amount) {
+		entryType = models.EntryTypeBelowMinReceive
+		svc.Logger.Infof("Incoming payment below the minimum is not credited user_id:%v invoice_id:%v amount:%v", invoice.UserID, invoice.ID, invoice.Amount)
+	}
+	entry := models.TransactionEntry{
+		UserID:          invoice.UserID,
+		InvoiceID:       invoice.ID,
+		CreditAccountID: feeAccount.ID,
+		DebitAccountID:  incomingEntry.CreditAccountID,
+		Amount:          invoice.Fee,
+		ParentID:        incomingEntry.ID,
+		EntryType:       entryType,
+	}
+	_, err = db.NewInsert().Model(&entry).Exec(ctx)
+	return err
+}
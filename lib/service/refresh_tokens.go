@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+)
+
+// rotateRefreshToken marks a refresh token as used and returns its family, the new refresh token is added to the same family.
+// A refresh token that is used a second time was probably stolen, the whole family is revoked in this case.
+func (svc *LndhubService) rotateRefreshToken(ctx context.Context, userId int64, jti string) (familyId string, err error) {
+	// refresh tokens issued before the rotation was introduced start a new family
+	if jti == "" {
+		return "", nil
+	}
+	refreshToken := models.RefreshToken{}
+	err = svc.DB.NewSelect().Model(&refreshToken).Where("jti = ?", jti).Where("user_id = ?", userId).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !refreshToken.RevokedAt.IsZero() {
+		return "", errors.New("refresh token was revoked")
+	}
+	res, err := svc.DB.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("jti = ?", jti).
+		Where("used_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rowsAffected == 0 {
+		svc.Logger.Warnf("Refresh token reuse detected, revoking token family user_id:%v family_id:%s", userId, refreshToken.FamilyID)
+		err = svc.RevokeRefreshTokenFamily(ctx, userId, refreshToken.FamilyID)
+		if err != nil {
+			return "", err
+		}
+		return "", errors.New("refresh token was already used")
+	}
+	return refreshToken.FamilyID, nil
+}
+
+// storeRefreshToken adds an issued refresh token and the access token issued with it to a token family,
+// an empty family id starts a new family
+func (svc *LndhubService) storeRefreshToken(ctx context.Context, userId int64, familyId, jti, accessTokenJti string) error {
+	if familyId == "" {
+		familyIdBytes, err := randBytesFromStr(32, alphaNumBytes)
+		if err != nil {
+			return err
+		}
+		familyId = string(familyIdBytes)
+	}
+	now := time.Now()
+	refreshToken := models.RefreshToken{
+		JTI:                  jti,
+		UserID:               userId,
+		FamilyID:             familyId,
+		AccessTokenJTI:       accessTokenJti,
+		AccessTokenExpiresAt: now.Add(time.Duration(svc.Config.JWTAccessTokenExpiry) * time.Second),
+		ExpiresAt:            now.Add(time.Duration(svc.Config.JWTRefreshTokenExpiry) * time.Second),
+	}
+	_, err := svc.DB.NewInsert().Model(&refreshToken).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	// expired refresh tokens can't be used anyway and don't need to be kept
+	_, err = svc.DB.NewDelete().Model((*models.RefreshToken)(nil)).Where("user_id = ?", userId).Where("expires_at < ?", now).Exec(ctx)
+	return err
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens of a family and the access tokens issued with them
+func (svc *LndhubService) RevokeRefreshTokenFamily(ctx context.Context, userId int64, familyId string) error {
+	refreshTokens := []models.RefreshToken{}
+	err := svc.DB.NewSelect().
+		Model(&refreshTokens).
+		Where("user_id = ?", userId).
+		Where("family_id = ?", familyId).
+		Where("revoked_at IS NULL").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, refreshToken := range refreshTokens {
+		if refreshToken.AccessTokenExpiresAt.Before(time.Now()) {
+			continue
+		}
+		err = svc.RevokeToken(ctx, userId, refreshToken.AccessTokenJTI, refreshToken.AccessTokenExpiresAt.Unix())
+		if err != nil {
+			return err
+		}
+	}
+	_, err = svc.DB.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("family_id = ?", familyId).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
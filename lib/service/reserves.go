@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+type Reserves struct {
+	// sum of the balances of all users, which is what the node owes them
+	TotalUserBalance int64
+	ChannelBalance   int64
+	OnchainBalance   int64
+	NodeBalance      int64
+	// node balance minus user balances, negative if the users are not fully backed
+	Difference        int64
+	FractionalReserve bool
+}
+
+// TotalUserBalance sums up the ledger of the current accounts of all users in a single query
+func (svc *LndhubService) TotalUserBalance(ctx context.Context) (int64, error) {
+	var balance int64
+	err := svc.DB.NewSelect().
+		TableExpr("account_ledgers").
+		ColumnExpr("COALESCE(SUM(account_ledgers.amount), 0) AS balance").
+		Join("JOIN accounts ON accounts.id = account_ledgers.account_id").
+		Where("accounts.type = ?", common.AccountTypeCurrent).
+		Scan(ctx, &balance)
+	return balance, err
+}
+
+// GetReserves compares the user balances to the local channel balance and the confirmed on-chain balance of the node
+func (svc *LndhubService) GetReserves(ctx context.Context) (*Reserves, error) {
+	totalUserBalance, err := svc.TotalUserBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	channelBalance, err := svc.LndClient.ChannelBalance(ctx, &lnrpc.ChannelBalanceRequest{})
+	if err != nil {
+		return nil, err
+	}
+	walletBalance, err := svc.LndClient.WalletBalance(ctx, &lnrpc.WalletBalanceRequest{})
+	if err != nil {
+		return nil, err
+	}
+	reserves := &Reserves{
+		TotalUserBalance: totalUserBalance,
+		ChannelBalance:   int64(channelBalance.GetLocalBalance().GetSat()),
+		OnchainBalance:   walletBalance.ConfirmedBalance,
+	}
+	reserves.NodeBalance = reserves.ChannelBalance + reserves.OnchainBalance
+	reserves.Difference = reserves.NodeBalance - reserves.TotalUserBalance
+	reserves.FractionalReserve = reserves.Difference < 0
+	if reserves.FractionalReserve {
+		svc.Logger.Errorf("Node balance of %d sats is below the user balances of %d sats", reserves.NodeBalance, reserves.TotalUserBalance)
+	}
+	return reserves, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+// RevokeToken adds a token to the revocation list until it expires
+func (svc *LndhubService) RevokeToken(ctx context.Context, userId int64, jti string, expiresAt int64) error {
+	revokedToken := models.RevokedToken{
+		JTI:       jti,
+		UserID:    userId,
+		ExpiresAt: time.Unix(expiresAt, 0),
+	}
+	_, err := svc.DB.NewInsert().Model(&revokedToken).On("CONFLICT (jti) DO NOTHING").Exec(ctx)
+	if err != nil {
+		return err
+	}
+	// expired tokens are rejected anyway and don't need to be kept
+	_, err = svc.DB.NewDelete().Model((*models.RevokedToken)(nil)).Where("expires_at < ?", time.Now()).Exec(ctx)
+	return err
+}
+
+// RevokeAllTokens increases the token epoch of a user, all tokens issued before are rejected.
+// The API keys of the user are revoked as well, they don't have an epoch.
+func (svc *LndhubService) RevokeAllTokens(ctx context.Context, userId int64) error {
+	return svc.WithTx(ctx, func(tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("token_epoch = token_epoch + 1").
+			Where("id = ?", userId).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return revokeAllApiKeys(ctx, tx, userId)
+	})
+}
+
+// IsTokenRevoked checks if a token issued with the given id and epoch was revoked
+func (svc *LndhubService) IsTokenRevoked(ctx context.Context, userId int64, jti string, epoch int64) (bool, error) {
+	var tokenEpoch int64
+	err := svc.DB.NewSelect().Model((*models.User)(nil)).Column("token_epoch").Where("id = ?", userId).Scan(ctx, &tokenEpoch)
+	if err != nil {
+		return false, err
+	}
+	if epoch < tokenEpoch {
+		return true, nil
+	}
+	// tokens issued before the revocation list was introduced don't have an id
+	if jti == "" {
+		return false, nil
+	}
+	return svc.DB.NewSelect().Model((*models.RevokedToken)(nil)).Where("jti = ?", jti).Exists(ctx)
+}
+
+// TokenRevocationMiddleware rejects revoked tokens, it must be used after the JWT middleware
+func (svc *LndhubService) TokenRevocationMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// API keys are revoked individually
+			if _, ok := c.Get("ApiKeyID").(int64); ok {
+				return next(c)
+			}
+			userId, ok := c.Get("UserID").(int64)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, responses.BadAuthError)
+			}
+			jti, _ := c.Get("TokenID").(string)
+			epoch, _ := c.Get("TokenEpoch").(int64)
+			revoked, err := svc.IsTokenRevoked(c.Request().Context(), userId, jti, epoch)
+			if err != nil {
+				c.Logger().Errorf("Failed to check token revocation user_id:%v error: %v", userId, err)
+				return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+			}
+			if revoked {
+				c.Logger().Errorf("Revoked token used user_id:%v", userId)
+				return c.JSON(http.StatusUnauthorized, responses.BadAuthError)
+			}
+			return next(c)
+		}
+	}
+}
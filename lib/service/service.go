@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync"
 
 	"github.com/getAlby/lndhub.go/rabbitmq"
 
 	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/pricing"
 	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getAlby/lndhub.go/lib/tokens"
 	"github.com/getAlby/lndhub.go/lnd"
@@ -28,10 +30,35 @@ type LndhubService struct {
 	RabbitMQClient rabbitmq.Client
 	Logger         *lecho.Logger
 	InvoicePubSub  *Pubsub
+	Metrics        *Metrics
+	PriceService   *pricing.PriceService
+	// requests to hosts given by users, see NewOutboundClient
+	OutboundClient *http.Client
+
+	// ids of the outgoing invoices that are currently tracked by a payment tracker
+	trackedPayments sync.Map
+	// result of the last readiness check
+	readiness readinessCache
+	// last GetInfo response of the node
+	nodeInfo nodeInfoCache
+	// inbound liquidity of the channels of the node
+	receiveCapacity receiveCapacityCache
+	// PayInvoice calls that did not return yet
+	inFlightPayments inFlightPayments
+	// open event stream connections per user
+	streamConnections streamConnections
 }
 
 func (svc *LndhubService) GenerateToken(ctx context.Context, login, password, inRefreshToken string) (accessToken, refreshToken string, err error) {
+	return svc.GenerateScopedToken(ctx, login, password, inRefreshToken, nil)
+}
+
+// GenerateScopedToken issues tokens limited to the requested scopes, no scopes means full access.
+// Tokens issued with a refresh token never get more scopes than the refresh token.
+func (svc *LndhubService) GenerateScopedToken(ctx context.Context, login, password, inRefreshToken string, scopes []string) (accessToken, refreshToken string, err error) {
 	var user models.User
+	// the family of the new refresh token, empty for a new login
+	var refreshTokenFamily string
 
 	switch {
 	case login != "" || password != "":
@@ -42,6 +69,7 @@ func (svc *LndhubService) GenerateToken(ctx context.Context, login, password, in
 			if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
 				return "", "", fmt.Errorf("bad auth")
 			}
+			svc.rehashPassword(ctx, &user, password)
 		}
 	case inRefreshToken != "":
 		{
@@ -53,6 +81,34 @@ func (svc *LndhubService) GenerateToken(ctx context.Context, login, password, in
 			if err := svc.DB.NewSelect().Model(&user).Where("id = ?", userId).Scan(ctx); err != nil {
 				return "", "", fmt.Errorf("bad auth")
 			}
+			jti, epoch, err := tokens.ParseRevocationClaims(svc.Config.JWTSecret, inRefreshToken)
+			if err != nil {
+				return "", "", fmt.Errorf("bad auth")
+			}
+			revoked, err := svc.IsTokenRevoked(ctx, user.ID, jti, epoch)
+			if err != nil || revoked {
+				return "", "", fmt.Errorf("bad auth")
+			}
+			refreshTokenScopes, err := tokens.ParseScopes(svc.Config.JWTSecret, inRefreshToken)
+			if err != nil {
+				return "", "", fmt.Errorf("bad auth")
+			}
+			if len(refreshTokenScopes) > 0 {
+				if len(scopes) == 0 {
+					scopes = refreshTokenScopes
+				}
+				for _, scope := range scopes {
+					if !tokens.HasScope(refreshTokenScopes, scope) {
+						return "", "", fmt.Errorf("bad auth")
+					}
+				}
+			}
+			// every refresh token can only be used once
+			refreshTokenFamily, err = svc.rotateRefreshToken(ctx, user.ID, jti)
+			if err != nil {
+				svc.Logger.Errorf("Refresh token rejected user_id:%v: %v", user.ID, err)
+				return "", "", fmt.Errorf("bad auth")
+			}
 		}
 	default:
 		{
@@ -64,12 +120,16 @@ func (svc *LndhubService) GenerateToken(ctx context.Context, login, password, in
 		return "", "", fmt.Errorf(responses.AccountDeactivatedError.Message)
 	}
 
-	accessToken, err = tokens.GenerateAccessToken(svc.Config.JWTSecret, svc.Config.JWTAccessTokenExpiry, &user)
+	accessToken, accessTokenJti, err := tokens.GenerateAccessToken(svc.Config.JWTSecret, svc.Config.JWTAccessTokenExpiry, &user, scopes)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken, err = tokens.GenerateRefreshToken(svc.Config.JWTSecret, svc.Config.JWTRefreshTokenExpiry, &user)
+	refreshToken, refreshTokenJti, err := tokens.GenerateRefreshToken(svc.Config.JWTSecret, svc.Config.JWTRefreshTokenExpiry, &user, scopes)
+	if err != nil {
+		return "", "", err
+	}
+	err = svc.storeRefreshToken(ctx, user.ID, refreshTokenFamily, refreshTokenJti, accessTokenJti)
 	if err != nil {
 		return "", "", err
 	}
@@ -80,6 +140,8 @@ func (svc *LndhubService) ParseInt(value interface{}) (int64, error) {
 	switch v := value.(type) {
 	case float64:
 		return int64(v), nil
+	case int64:
+		return v, nil
 	case string:
 		c, err := strconv.ParseInt(v, 10, 64)
 		if err != nil {
@@ -91,6 +153,19 @@ func (svc *LndhubService) ParseInt(value interface{}) (int64, error) {
 	}
 }
 
+// ParseMsatAmount parses an amount in millisatoshi and returns it in satoshi.
+// Balances are kept in satoshi, amounts that are not whole satoshis are rejected.
+func (svc *LndhubService) ParseMsatAmount(value interface{}) (int64, error) {
+	msat, err := svc.ParseInt(value)
+	if err != nil {
+		return 0, err
+	}
+	if msat%1000 != 0 {
+		return 0, fmt.Errorf("amount of %d msat is not a whole number of satoshis", msat)
+	}
+	return msat / 1000, nil
+}
+
 
 
 func (svc *LndhubService) ValidateNosTREventPayload() echo.MiddlewareFunc {
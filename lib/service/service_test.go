@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMsatAmount(t *testing.T) {
+	amount, err := svc.ParseMsatAmount(float64(21000))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(21), amount)
+
+	amount, err = svc.ParseMsatAmount("1000")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), amount)
+
+	amount, err = svc.ParseMsatAmount(int64(0))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), amount)
+}
+
+func TestParseMsatAmountFractionalSats(t *testing.T) {
+	_, err := svc.ParseMsatAmount(int64(1500))
+	assert.Error(t, err)
+	_, err = svc.ParseMsatAmount("999")
+	assert.Error(t, err)
+	_, err = svc.ParseMsatAmount("not a number")
+	assert.Error(t, err)
+}
+
+func TestRateLimitOverridesDecode(t *testing.T) {
+	overrides := RateLimitOverrides{}
+	err := overrides.Decode("/v2/payments/bolt11=1:2;/v2/invoices/:payment_hash=0.5:10")
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimit{Rate: 1, Burst: 2}, overrides["/v2/payments/bolt11"])
+	assert.Equal(t, RateLimit{Rate: 0.5, Burst: 10}, overrides["/v2/invoices/:payment_hash"])
+
+	assert.Error(t, overrides.Decode("/balance=1"))
+	assert.Error(t, overrides.Decode("/balance=fast:1"))
+}
+
+func TestPasswordHashCostDecode(t *testing.T) {
+	var cost PasswordHashCost
+	assert.NoError(t, cost.Decode("12"))
+	assert.Equal(t, PasswordHashCost(12), cost)
+
+	assert.Error(t, cost.Decode("3"))
+	assert.Error(t, cost.Decode("32"))
+	assert.Error(t, cost.Decode("high"))
+}
+
+func TestRedactPaymentRequest(t *testing.T) {
+	paymentRequest := "lnbcrt10u1p38p4ehpp5xp07pda02vk40wxd9gyrene8qzheucz7ast435u9jwxejs6f0v5s"
+	redactSvc := &LndhubService{Config: &Config{}}
+	assert.Equal(t, paymentRequest, redactSvc.RedactPaymentRequest(paymentRequest))
+	redactSvc.Config.LogRedactPaymentRequests = true
+	assert.Equal(t, "lnbcrt10u1p38p4ehpp5...[redacted]", redactSvc.RedactPaymentRequest(paymentRequest))
+	assert.Equal(t, "", redactSvc.RedactPaymentRequest(""))
+}
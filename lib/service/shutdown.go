@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// inFlightPayments tracks the PayInvoice calls, so the shutdown can wait for them
+type inFlightPayments struct {
+	wg     sync.WaitGroup
+	active atomic.Int64
+}
+
+func (p *inFlightPayments) start() {
+	p.wg.Add(1)
+	p.active.Add(1)
+}
+
+func (p *inFlightPayments) done() {
+	p.active.Add(-1)
+	p.wg.Done()
+}
+
+// InFlightPayments returns the number of payments that are currently being sent
+func (svc *LndhubService) InFlightPayments() int64 {
+	return svc.inFlightPayments.active.Load()
+}
+
+// WaitForInFlightPayments blocks until all payments reached a terminal state or the context is done,
+// it returns the number of payments that are still in flight
+func (svc *LndhubService) WaitForInFlightPayments(ctx context.Context) int64 {
+	done := make(chan struct{})
+	go func() {
+		svc.inFlightPayments.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+		return svc.InFlightPayments()
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForInFlightPayments(t *testing.T) {
+	shutdownSvc := &LndhubService{}
+	assert.Equal(t, int64(0), shutdownSvc.WaitForInFlightPayments(context.Background()))
+
+	shutdownSvc.inFlightPayments.start()
+	shutdownSvc.inFlightPayments.start()
+	assert.Equal(t, int64(2), shutdownSvc.InFlightPayments())
+
+	// the grace period expires before the payments are done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, int64(2), shutdownSvc.WaitForInFlightPayments(ctx))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		shutdownSvc.inFlightPayments.done()
+		shutdownSvc.inFlightPayments.done()
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Equal(t, int64(0), shutdownSvc.WaitForInFlightPayments(ctx))
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/labstack/echo/v4"
+)
+
+// SuspendUser suspends a user, in send_only mode the user can still use the API and receive payments
+func (svc *LndhubService) SuspendUser(ctx context.Context, userId int64, mode string) (*models.User, error) {
+	user, err := svc.FindUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	user.Suspended = true
+	user.SuspendMode = mode
+	_, err = svc.DB.NewUpdate().Model(user).Column("suspended", "suspend_mode", "updated_at").WherePK().Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UnsuspendUser lifts the suspension of a user
+func (svc *LndhubService) UnsuspendUser(ctx context.Context, userId int64) (*models.User, error) {
+	user, err := svc.FindUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	user.Suspended = false
+	user.SuspendMode = ""
+	_, err = svc.DB.NewUpdate().Model(user).Column("suspended", "suspend_mode", "updated_at").WherePK().Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// isSuspended is checked for every payment, also for payments without the authentication and the SuspensionMiddleware,
+// e.g. LNURL-withdraw callbacks
+func (svc *LndhubService) isSuspended(ctx context.Context, userId int64) (bool, error) {
+	var user models.User
+	err := svc.DB.NewSelect().Model(&user).Column("suspended").Where("id = ?", userId).Scan(ctx)
+	if err != nil {
+		return false, err
+	}
+	return user.Suspended, nil
+}
+
+// SuspensionMiddleware rejects the requests of suspended users, it must be used after the authentication middleware.
+// Users suspended in send_only mode pass, their payments are rejected by CheckOutgoingPaymentAllowed.
+func (svc *LndhubService) SuspensionMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userId, ok := c.Get("UserID").(int64)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, responses.BadAuthError)
+			}
+			var user models.User
+			err := svc.DB.NewSelect().Model(&user).Column("suspended", "suspend_mode").Where("id = ?", userId).Scan(c.Request().Context())
+			if err != nil {
+				c.Logger().Errorf("Failed to check suspension user_id:%v error: %v", userId, err)
+				return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+			}
+			if !user.Suspended {
+				return next(c)
+			}
+			if user.SuspendMode == common.SuspendModeSendOnly {
+				return next(c)
+			}
+			c.Logger().Errorf("Request of suspended user rejected user_id:%v", userId)
+			return c.JSON(http.StatusForbidden, responses.AccountSuspendedError)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/labstack/echo/v4"
+)
+
+var tenantIDRegex = regexp.MustCompile("^[a-z0-9][a-z0-9_-]{0,62}$")
+
+var ErrInvalidTenantID = errors.New("tenant id must be 1 to 63 lowercase letters, digits, - or _")
+
+// ValidateTenantID checks the id of a tenant, the empty id is the default tenant
+func ValidateTenantID(tenantID string) error {
+	if tenantID != "" && !tenantIDRegex.MatchString(tenantID) {
+		return ErrInvalidTenantID
+	}
+	return nil
+}
+
+// AdminTenant returns the tenant an admin request is scoped to, given in the X-Tenant-ID header.
+// Without the header the request is not scoped and covers the users of all tenants.
+func AdminTenant(c echo.Context) (string, error) {
+	tenantID := c.Request().Header.Get(common.TenantHeader)
+	if err := ValidateTenantID(tenantID); err != nil {
+		return "", err
+	}
+	return tenantID, nil
+}
+
+// userTenant returns the tenant of the user, for requests that are not authenticated with a token carrying it
+func (svc *LndhubService) userTenant(ctx context.Context, userId int64) (string, error) {
+	var user models.User
+	err := svc.DB.NewSelect().Model(&user).Column("tenant_id").Where("id = ?", userId).Scan(ctx)
+	return user.TenantID, err
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTenantID(t *testing.T) {
+	for _, tenantID := range []string{"", "brand-a", "brand_b", "7", strings.Repeat("a", 63)} {
+		assert.NoError(t, ValidateTenantID(tenantID), tenantID)
+	}
+	for _, tenantID := range []string{"Brand", "brand a", "-brand", "brand.a", strings.Repeat("a", 64)} {
+		assert.ErrorIs(t, ValidateTenantID(tenantID), ErrInvalidTenantID, tenantID)
+	}
+}
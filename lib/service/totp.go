@@ -0,0 +1,221 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/security"
+	"github.com/labstack/echo/v4"
+	"github.com/uptrace/bun"
+)
+
+const (
+	totpBackupCodeCount  = 10
+	totpBackupCodeLength = 10
+	totpBackupCodeChars  = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	ErrTOTPRequired       = errors.New("a totp code is required")
+	ErrInvalidTOTPCode    = errors.New("invalid or already used totp code")
+	ErrTOTPAlreadyEnabled = errors.New("totp is already enabled")
+	ErrTOTPNotEnrolled    = errors.New("no totp secret to verify")
+)
+
+// EnrollTOTP creates a new TOTP secret for the user. Two-factor authentication is only enabled once a code
+// of the secret is verified with VerifyTOTP, enrolling again before replaces the secret.
+func (svc *LndhubService) EnrollTOTP(ctx context.Context, userId int64) (secret, provisioningURI string, err error) {
+	user, err := svc.FindUser(ctx, userId)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TotpEnabled {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+	secret, err = security.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	_, err = svc.DB.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("totp_secret = ?", secret).
+		Where("id = ?", userId).
+		Where("totp_enabled = false").
+		Exec(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	// the login is part of the credentials, it must not show up in the authenticator app
+	account := fmt.Sprintf("account %d", user.ID)
+	if user.LightningAddress.Valid {
+		account = user.LightningAddress.String
+	}
+	return secret, security.TOTPProvisioningURI(secret, svc.Config.Branding.Title, account), nil
+}
+
+// VerifyTOTP enables two-factor authentication with a code of the enrolled secret and returns new backup codes,
+// they are only returned here
+func (svc *LndhubService) VerifyTOTP(ctx context.Context, userId int64, code string) ([]string, error) {
+	user, err := svc.FindUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TotpSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	step, ok := security.ValidateTOTP(user.TotpSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+	backupCodes := make([]string, totpBackupCodeCount)
+	rows := make([]models.TotpBackupCode, totpBackupCodeCount)
+	for i := range backupCodes {
+		codeBytes, err := randBytesFromStr(totpBackupCodeLength, totpBackupCodeChars)
+		if err != nil {
+			return nil, err
+		}
+		backupCodes[i] = string(codeBytes)
+		rows[i] = models.TotpBackupCode{UserID: userId, CodeHash: hashTOTPBackupCode(backupCodes[i])}
+	}
+	err = svc.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		// the verification code can't be used for a payment
+		result, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("totp_enabled = true").
+			Set("totp_last_step = ?", step).
+			Where("id = ?", userId).
+			Where("totp_secret = ?", user.TotpSecret).
+			Where("totp_enabled = false").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return ErrInvalidTOTPCode
+		}
+		if _, err := tx.NewDelete().Model((*models.TotpBackupCode)(nil)).Where("user_id = ?", userId).Exec(ctx); err != nil {
+			return err
+		}
+		_, err = tx.NewInsert().Model(&rows).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backupCodes, nil
+}
+
+// CheckTOTP accepts a TOTP code or an unused backup code of a user with two-factor authentication, every code
+// is only accepted once. Users without two-factor authentication pass without a code.
+func (svc *LndhubService) CheckTOTP(ctx context.Context, userId int64, code string) error {
+	var user models.User
+	err := svc.DB.NewSelect().Model(&user).Column("totp_secret", "totp_enabled").Where("id = ?", userId).Scan(ctx)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return nil
+	}
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if code == "" {
+		return ErrTOTPRequired
+	}
+	if step, ok := security.ValidateTOTP(user.TotpSecret, code, time.Now()); ok {
+		// codes of the same or an earlier step were already used, concurrent requests can't both pass
+		result, err := svc.DB.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("totp_last_step = ?", step).
+			Where("id = ?", userId).
+			Where("totp_last_step < ?", step).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return ErrInvalidTOTPCode
+		}
+		return nil
+	}
+	result, err := svc.DB.NewUpdate().
+		Model((*models.TotpBackupCode)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("code_hash = ?", hashTOTPBackupCode(code)).
+		Where("used_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// TOTPCheckedKey is set in the context of requests whose totp code was checked by the TOTPMiddleware
+const TOTPCheckedKey = "TOTPChecked"
+
+// TOTPMiddleware requires a valid totp_code in the JSON body of the requests of users with two-factor authentication,
+// it is used for the payment endpoints after the authentication middleware. The body is still available to the handler.
+func (svc *LndhubService) TOTPMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userId, ok := c.Get("UserID").(int64)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, responses.BadAuthError)
+			}
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+			var payload struct {
+				TotpCode string `json:"totp_code"`
+			}
+			// bodies that are not JSON have no code, they only pass for users without two-factor authentication
+			_ = json.Unmarshal(body, &payload)
+
+			err = svc.CheckTOTP(c.Request().Context(), userId, payload.TotpCode)
+			if err != nil {
+				return RespondTOTPError(c, userId, err)
+			}
+			c.Set(TOTPCheckedKey, true)
+			return next(c)
+		}
+	}
+}
+
+// RespondTOTPError answers a payment request whose totp code was rejected by CheckTOTP
+func RespondTOTPError(c echo.Context, userId int64, err error) error {
+	switch {
+	case errors.Is(err, ErrTOTPRequired):
+		c.Logger().Errorf("Payment without totp code rejected user_id:%v", userId)
+		return c.JSON(responses.TOTPRequiredError.HttpStatusCode, responses.TOTPRequiredError)
+	case errors.Is(err, ErrInvalidTOTPCode):
+		c.Logger().Errorf("Payment with invalid totp code rejected user_id:%v", userId)
+		return c.JSON(responses.InvalidTOTPCodeError.HttpStatusCode, responses.InvalidTOTPCodeError)
+	default:
+		c.Logger().Errorf("Failed to check totp code user_id:%v error: %v", userId, err)
+		return c.JSON(http.StatusInternalServerError, responses.GeneralServerError)
+	}
+}
+
+func hashTOTPBackupCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
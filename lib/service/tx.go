@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/uptrace/bun"
+)
+
+// txCommitError is returned by WithTx if the commit failed, the transaction may have been stored anyway
+type txCommitError struct {
+	err error
+}
+
+func (e *txCommitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *txCommitError) Unwrap() error {
+	return e.err
+}
+
+// WithTx runs fn in a database transaction. The transaction is committed if fn returns nil and rolled back
+// if it returns an error or panics, so the writes of fn are either all stored or none of them.
+func (svc *LndhubService) WithTx(ctx context.Context, fn func(tx bun.Tx) error) (err error) {
+	tx, err := svc.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			svc.Logger.Errorf("Could not roll back DB transaction: %v", rollbackErr)
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return &txCommitError{err: err}
+	}
+	return nil
+}
@@ -3,8 +3,10 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/getAlby/lndhub.go/common"
@@ -17,11 +19,28 @@ import (
 	"github.com/labstack/gommon/log"
 	"github.com/uptrace/bun"
 	passwordvalidator "github.com/wagslane/go-password-validator"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func (svc *LndhubService) CreateUser(ctx context.Context, login string, password string) (user *models.User, err error) {
+	return svc.createUser(ctx, "", login, password, "")
+}
+
+// RegisterUser creates an account of the tenant for the account creation endpoints, see CreateUser.
+// The invite code is required if REQUIRE_INVITE_CODE is set, a given code is always checked and counts as used.
+func (svc *LndhubService) RegisterUser(ctx context.Context, tenantID, login, password, inviteCode string) (*models.User, error) {
+	if err := ValidateTenantID(tenantID); err != nil {
+		return nil, err
+	}
+	if inviteCode == "" && svc.Config.RequireInviteCode {
+		return nil, ErrInviteCodeRequired
+	}
+	return svc.createUser(ctx, tenantID, login, password, inviteCode)
+}
 
-	user = &models.User{}
+func (svc *LndhubService) createUser(ctx context.Context, tenantID, login, password, inviteCode string) (user *models.User, err error) {
+
+	user = &models.User{TenantID: tenantID}
 
 	// generate user login/password if not provided
 	user.Login = login
@@ -49,13 +68,19 @@ func (svc *LndhubService) CreateUser(ctx context.Context, login string, password
 	}
 
 	// we only store the hashed password but return the initial plain text password in the HTTP response
-	hashedPassword := security.HashPassword(password)
+	hashedPassword := security.HashPassword(password, int(svc.Config.PasswordHashCost))
 	user.Password = hashedPassword
 
 	// Create user and the user's accounts
 	// We use double-entry bookkeeping so we use 4 accounts: incoming, current, outgoing and fees
 	// Wrapping this in a transaction in case something fails
 	err = svc.DB.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		// the code is only used up if the account is created
+		if inviteCode != "" {
+			if err := useInviteCode(ctx, tx, inviteCode); err != nil {
+				return err
+			}
+		}
 		if _, err := tx.NewInsert().Model(user).Exec(ctx); err != nil {
 			return err
 		}
@@ -64,6 +89,7 @@ func (svc *LndhubService) CreateUser(ctx context.Context, login string, password
 			common.AccountTypeCurrent,
 			common.AccountTypeOutgoing,
 			common.AccountTypeFees,
+			common.AccountTypeAdjustments,
 		}
 		for _, accountType := range accountTypes {
 			account := models.Account{UserID: user.ID, Type: accountType}
@@ -78,7 +104,7 @@ func (svc *LndhubService) CreateUser(ctx context.Context, login string, password
 	return user, err
 }
 
-func (svc *LndhubService) UpdateUser(ctx context.Context, userId int64, login *string, password *string, deactivated *bool) (user *models.User, err error) {
+func (svc *LndhubService) UpdateUser(ctx context.Context, userId int64, login *string, password *string, deactivated *bool, lightningAddress *string, maxDailyOutboundSats *int64) (user *models.User, err error) {
 	user, err = svc.FindUser(ctx, userId)
 	if err != nil {
 		return nil, err
@@ -93,19 +119,111 @@ func (svc *LndhubService) UpdateUser(ctx context.Context, userId int64, login *s
 				return nil, fmt.Errorf("password entropy is too low (%f), required is %d", entropy, svc.Config.MinPasswordEntropy)
 			}
 		}
-		hashedPassword := security.HashPassword(*password)
+		hashedPassword := security.HashPassword(*password, int(svc.Config.PasswordHashCost))
 		user.Password = hashedPassword
 	}
 	if deactivated != nil {
 		user.Deactivated = *deactivated
 	}
-	_, err = svc.DB.NewUpdate().Model(user).WherePK().Exec(ctx)
+	if lightningAddress != nil {
+		// an empty lightning address removes it
+		username := strings.ToLower(*lightningAddress)
+		if username != "" && !lightningAddressRegex.MatchString(username) {
+			return nil, fmt.Errorf("invalid lightning address username %s", *lightningAddress)
+		}
+		user.LightningAddress = sql.NullString{String: username, Valid: username != ""}
+	}
+	if maxDailyOutboundSats != nil {
+		// a negative limit removes the override
+		user.MaxDailyOutboundSats = sql.NullInt64{Int64: *maxDailyOutboundSats, Valid: *maxDailyOutboundSats >= 0}
+	}
+	// the token epoch is only changed when the tokens of the user are revoked, the keysend alias is set by the user
+	_, err = svc.DB.NewUpdate().Model(user).ExcludeColumn("token_epoch", "suspended", "suspend_mode", "keysend_alias", "tenant_id", "totp_secret", "totp_enabled", "totp_last_step").WherePK().Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
+var (
+	ErrBadCredentials     = errors.New("bad auth")
+	ErrAccountDeactivated = errors.New(responses.AccountDeactivatedError.Message)
+)
+
+// RotateCredentials replaces the login and password of the user with new random ones and revokes all tokens issued so far
+// and all API keys.
+// The old login and password stop working right away, the new password is only returned here.
+func (svc *LndhubService) RotateCredentials(ctx context.Context, login, password string) (newLogin, newPassword string, err error) {
+	var user models.User
+	if err := svc.DB.NewSelect().Model(&user).Where("login = ?", login).Scan(ctx); err != nil {
+		return "", "", ErrBadCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return "", "", ErrBadCredentials
+	}
+	if user.Deactivated {
+		return "", "", ErrAccountDeactivated
+	}
+	loginBytes, err := randBytesFromStr(20, alphaNumBytes)
+	if err != nil {
+		return "", "", err
+	}
+	passwordBytes, err := randBytesFromStr(20, alphaNumBytes)
+	if err != nil {
+		return "", "", err
+	}
+	err = svc.WithTx(ctx, func(tx bun.Tx) error {
+		// only the first of concurrent rotations with the same credentials succeeds
+		result, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("login = ?", string(loginBytes)).
+			Set("password = ?", security.HashPassword(string(passwordBytes), int(svc.Config.PasswordHashCost))).
+			Set("token_epoch = token_epoch + 1").
+			Set("updated_at = ?", time.Now()).
+			Where("id = ?", user.ID).
+			Where("password = ?", user.Password).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrBadCredentials
+		}
+		// the credentials are rotated when they may be compromised, so the API keys are not trusted either
+		return revokeAllApiKeys(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return string(loginBytes), string(passwordBytes), nil
+}
+
+// rehashPassword hashes the password again if the stored hash was made with another PASSWORD_HASH_COST, it is called
+// after a successful login with the plain text password. Failures are only logged, the old hash still works.
+func (svc *LndhubService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	cost := int(svc.Config.PasswordHashCost)
+	if !security.NeedsRehash(user.Password, cost) {
+		return
+	}
+	hash := security.HashPassword(password, cost)
+	// the password may have been changed since the login
+	_, err := svc.DB.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("password = ?", hash).
+		Where("id = ?", user.ID).
+		Where("password = ?", user.Password).
+		Exec(ctx)
+	if err != nil {
+		svc.Logger.Errorf("Failed to rehash password user_id:%v error: %v", user.ID, err)
+		return
+	}
+	user.Password = hash
+}
+
 func (svc *LndhubService) FindUser(ctx context.Context, userId int64) (*models.User, error) {
 	var user models.User
 
@@ -126,7 +244,39 @@ func (svc *LndhubService) FindUserByLogin(ctx context.Context, login string) (*m
 	return &user, nil
 }
 
+// GetUserByLightningAddress looks up a user by the username of a lightning address, usernames are case-insensitive
+func (svc *LndhubService) GetUserByLightningAddress(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+
+	err := svc.DB.NewSelect().Model(&user).Where("lightning_address = ?", strings.ToLower(username)).Limit(1).Scan(ctx)
+	if err != nil {
+		return &user, err
+	}
+	return &user, nil
+}
+
 func (svc *LndhubService) CheckOutgoingPaymentAllowed(c echo.Context, lnpayReq *lnd.LNPayReq, userId int64) (result *responses.ErrorResponse, err error) {
+	suspended, err := svc.isSuspended(c.Request().Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+	if suspended {
+		svc.Logger.Errorf("Payment of suspended user rejected user_id:%v", userId)
+		return &responses.SendingSuspendedError, nil
+	}
+	if !lnpayReq.Keysend {
+		ownInvoice, err := svc.isOwnInvoice(c.Request().Context(), userId, lnpayReq.PayReq.PaymentHash)
+		if err != nil {
+			return nil, err
+		}
+		if ownInvoice {
+			if svc.Config.SelfPaymentPolicy != SelfPaymentPolicyAllow {
+				svc.Logger.Errorf("Payment of own invoice rejected user_id:%v payment_hash:%s", userId, lnpayReq.PayReq.PaymentHash)
+				return &responses.SelfPaymentError, nil
+			}
+			svc.Logger.Warnf("User is paying own invoice user_id:%v payment_hash:%s", userId, lnpayReq.PayReq.PaymentHash)
+		}
+	}
 	limits := svc.GetLimits(c)
 	if limits.MaxSendAmount > 0 {
 		if lnpayReq.PayReq.NumSatoshis > limits.MaxSendAmount {
@@ -170,6 +320,7 @@ func (svc *LndhubService) CheckOutgoingPaymentAllowed(c echo.Context, lnpayReq *
 	if svc.Config.FeeReserve {
 		minimumBalance += svc.CalcFeeLimit(lnpayReq.PayReq.Destination, lnpayReq.PayReq.NumSatoshis)
 	}
+	minimumBalance += svc.CalcServiceFee(lnpayReq.PayReq.Destination, lnpayReq.PayReq.NumSatoshis)
 	if currentBalance < minimumBalance {
 		return &responses.NotEnoughBalanceError, nil
 	}
@@ -177,7 +328,93 @@ func (svc *LndhubService) CheckOutgoingPaymentAllowed(c echo.Context, lnpayReq *
 	return nil, nil
 }
 
+// isOwnInvoice checks if the payment hash belongs to an incoming invoice of the user
+func (svc *LndhubService) isOwnInvoice(ctx context.Context, userId int64, paymentHash string) (bool, error) {
+	if paymentHash == "" {
+		return false, nil
+	}
+	return svc.DB.NewSelect().Model((*models.Invoice)(nil)).
+		Where("type = ? AND user_id = ? AND r_hash = ?", common.InvoiceTypeIncoming, userId, paymentHash).
+		Exists(ctx)
+}
+
+// CheckPaymentAmount checks the amount of a payment against the configured minimum and maximum
+func (svc *LndhubService) CheckPaymentAmount(amount int64) *responses.ErrorResponse {
+	if svc.Config.MinPaymentSats > 0 && amount < svc.Config.MinPaymentSats {
+		return &responses.ErrorResponse{
+			Error:          true,
+			Code:           responses.BadArgumentsError.Code,
+			Message:        fmt.Sprintf("payment amount is below the minimum of %d sats", svc.Config.MinPaymentSats),
+			HttpStatusCode: responses.BadArgumentsError.HttpStatusCode,
+		}
+	}
+	if svc.Config.MaxPaymentSats > 0 && amount > svc.Config.MaxPaymentSats {
+		return &responses.ErrorResponse{
+			Error:          true,
+			Code:           responses.BadArgumentsError.Code,
+			Message:        fmt.Sprintf("payment amount is above the maximum of %d sats", svc.Config.MaxPaymentSats),
+			HttpStatusCode: responses.BadArgumentsError.HttpStatusCode,
+		}
+	}
+	return nil
+}
+
+// CheckDailyOutboundLimit checks if the payment fits into the daily sending limit of the user.
+// It is checked again when the payment is debited, see dailyOutboundLimitExceeded.
+func (svc *LndhubService) CheckDailyOutboundLimit(ctx context.Context, amount, userId int64) (result *responses.ErrorResponse, err error) {
+	exceeded, err := svc.dailyOutboundLimitExceeded(ctx, svc.DB, amount, userId)
+	if err != nil {
+		return nil, err
+	}
+	if exceeded {
+		return &responses.DailyLimitExceededError, nil
+	}
+	return nil, nil
+}
+
+// dailyOutboundLimitExceeded checks the daily sending limit with db, which is the transaction that debits the payment
+// while the account of the user is locked, so that concurrent payments can't pass the check together
+func (svc *LndhubService) dailyOutboundLimitExceeded(ctx context.Context, db bun.IDB, amount, userId int64) (bool, error) {
+	var user models.User
+	err := db.NewSelect().Model(&user).Column("max_daily_outbound_sats").Where("id = ?", userId).Scan(ctx)
+	if err != nil {
+		return false, err
+	}
+	limit := svc.Config.MaxDailyOutboundSats
+	if user.MaxDailyOutboundSats.Valid {
+		limit = user.MaxDailyOutboundSats.Int64
+	}
+	if limit <= 0 {
+		return false, nil
+	}
+	volume, err := outboundVolumeSince(ctx, db, userId, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		svc.Logger.Errorj(
+			log.JSON{
+				"message":        "error fetching outbound volume",
+				"error":          err,
+				"lndhub_user_id": userId,
+			},
+		)
+		return false, err
+	}
+	if volume+amount > limit {
+		svc.Logger.Errorf("Daily sending limit exceeded for user_id %v (volume:%v amount:%v limit:%v)", userId, volume, amount, limit)
+		return true, nil
+	}
+	return false, nil
+}
+
 func (svc *LndhubService) CheckIncomingPaymentAllowed(c echo.Context, amount, userId int64) (result *responses.ErrorResponse, err error) {
+	// zero amount invoices are checked when they are settled
+	if amount > 0 && svc.belowMinReceive(amount) {
+		return &responses.ErrorResponse{
+			Error:          true,
+			Code:           responses.BadArgumentsError.Code,
+			Message:        fmt.Sprintf("invoice amount is below the minimum of %d sats", svc.Config.MinReceiveSats),
+			HttpStatusCode: responses.BadArgumentsError.HttpStatusCode,
+		}, nil
+	}
 	limits := svc.GetLimits(c)
 	if limits.MaxReceiveAmount > 0 {
 		if amount > limits.MaxReceiveAmount {
@@ -226,13 +463,42 @@ func (svc *LndhubService) CheckIncomingPaymentAllowed(c echo.Context, amount, us
 	return nil, nil
 }
 
-func (svc *LndhubService) CalcFeeLimit(destination string, amount int64) int64 {
+// IsZeroFeeDestination returns true for our own node and the destinations in ZERO_FEE_DESTINATIONS
+func (svc *LndhubService) IsZeroFeeDestination(destination string) bool {
 	if svc.LndClient.IsIdentityPubkey(destination) {
+		return true
+	}
+	for _, pubkey := range svc.Config.ZeroFeeDestinations {
+		if strings.EqualFold(pubkey, destination) {
+			return true
+		}
+	}
+	return false
+}
+
+// CalcFeeLimit returns the maximum routing fee of a payment according to the configured FEE_LIMIT_STRATEGY,
+// the limit is always capped by MAX_FEE_AMOUNT
+func (svc *LndhubService) CalcFeeLimit(destination string, amount int64) int64 {
+	if svc.IsZeroFeeDestination(destination) {
 		return 0
 	}
-	limit := int64(10)
-	if amount > 1000 {
-		limit = int64(math.Ceil(float64(amount)*float64(0.01)) + 1)
+	percentLimit := int64(math.Ceil(float64(amount) * svc.Config.FeeLimitPercent / 100))
+	var limit int64
+	switch svc.Config.FeeLimitStrategy {
+	case FeeLimitStrategyPercent:
+		limit = percentLimit
+	case FeeLimitStrategyFixed:
+		limit = svc.Config.FeeLimitFixed
+	case FeeLimitStrategyMax:
+		limit = svc.Config.FeeLimitFixed
+		if percentLimit > limit {
+			limit = percentLimit
+		}
+	default:
+		limit = int64(10)
+		if amount > 1000 {
+			limit = int64(math.Ceil(float64(amount)*float64(0.01)) + 1)
+		}
 	}
 	if limit > svc.Config.MaxFeeAmount {
 		limit = svc.Config.MaxFeeAmount
@@ -240,6 +506,41 @@ func (svc *LndhubService) CalcFeeLimit(destination string, amount int64) int64 {
 	return limit
 }
 
+// CalcServiceFee returns the service fee of the operator for a payment, which is charged on top of the routing fee.
+// Payments to our own node don't leave the ledger and are not charged.
+func (svc *LndhubService) CalcServiceFee(destination string, amount int64) int64 {
+	if svc.LndClient.IsIdentityPubkey(destination) {
+		return 0
+	}
+	return svc.Config.ServiceFeeFixed + int64(math.Ceil(float64(amount)*svc.Config.ServiceFeePercent/100))
+}
+
+// CalcClientFeeLimit caps the fee limit of the server with the limit requested by a client,
+// the client can never get a higher limit than the server allows
+func (svc *LndhubService) CalcClientFeeLimit(destination string, amount, feeLimitSat int64, feeLimitPercent float64) int64 {
+	limit := svc.CalcFeeLimit(destination, amount)
+	if feeLimitSat > 0 && feeLimitSat < limit {
+		limit = feeLimitSat
+	}
+	if feeLimitPercent > 0 {
+		// rounded down, the client is not willing to pay more
+		percentLimit := int64(math.Floor(float64(amount) * feeLimitPercent / 100))
+		if percentLimit < limit {
+			limit = percentLimit
+		}
+	}
+	return limit
+}
+
+// invoiceFeeLimit is the fee limit used to send the payment of an outgoing invoice
+func (svc *LndhubService) invoiceFeeLimit(destination string, invoice *models.Invoice) int64 {
+	limit := svc.CalcFeeLimit(destination, invoice.Amount)
+	if invoice.FeeLimit > 0 && invoice.FeeLimit < limit {
+		return invoice.FeeLimit
+	}
+	return limit
+}
+
 func (svc *LndhubService) CurrentUserBalance(ctx context.Context, userId int64) (int64, error) {
 	var balance int64
 
@@ -247,13 +548,86 @@ func (svc *LndhubService) CurrentUserBalance(ctx context.Context, userId int64)
 	if err != nil {
 		return balance, err
 	}
-	err = svc.DB.NewSelect().Table("account_ledgers").ColumnExpr("sum(account_ledgers.amount) as balance").Where("account_ledgers.account_id = ?", account.ID).Scan(ctx, &balance)
+	err = svc.withDBRetry(ctx, func() error {
+		return svc.DB.NewSelect().Table("account_ledgers").ColumnExpr("sum(account_ledgers.amount) as balance").Where("account_ledgers.account_id = ?", account.ID).Scan(ctx, &balance)
+	})
 	return balance, err
 }
 
+type UserBalance struct {
+	ID        int64     `bun:"id"`
+	Login     string    `bun:"login"`
+	TenantID  string    `bun:"tenant_id"`
+	CreatedAt time.Time `bun:"created_at"`
+	Balance   int64     `bun:"balance"`
+}
+
+// GetUsersWithBalances returns up to limit users with an id lower than the cursor and the balance of their current account, newest first.
+// The balances of the whole page are summed up in a single query. nextCursor is 0 if there are no more results.
+// A non-empty tenant id only returns the users of the tenant.
+func (svc *LndhubService) GetUsersWithBalances(ctx context.Context, tenantID string, limit int, cursor int64) (users []UserBalance, nextCursor int64, err error) {
+	users = []UserBalance{}
+
+	query := svc.DB.NewSelect().
+		TableExpr("users").
+		ColumnExpr("users.id, users.login, COALESCE(users.tenant_id, '') AS tenant_id, users.created_at").
+		ColumnExpr("COALESCE(SUM(account_ledgers.amount), 0) AS balance").
+		Join("LEFT JOIN accounts ON accounts.user_id = users.id AND accounts.type = ?", common.AccountTypeCurrent).
+		Join("LEFT JOIN account_ledgers ON account_ledgers.account_id = accounts.id").
+		GroupExpr("users.id")
+	if cursor > 0 {
+		query.Where("users.id < ?", cursor)
+	}
+	if tenantID != "" {
+		query.Where("users.tenant_id = ?", tenantID)
+	}
+	// fetch one more row to know if there is a next page
+	query.OrderExpr("users.id DESC").Limit(limit + 1)
+	err = query.Scan(ctx, &users)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = users[limit-1].ID
+	}
+	return users, nextCursor, nil
+}
+
+// UserBalances returns the balances of the current accounts of the users, summed up in a single query.
+// Ids of users that don't exist or don't belong to the non-empty tenant id are missing in the result.
+func (svc *LndhubService) UserBalances(ctx context.Context, tenantID string, userIds []int64) (map[int64]int64, error) {
+	rows := []struct {
+		ID      int64 `bun:"id"`
+		Balance int64 `bun:"balance"`
+	}{}
+	query := svc.DB.NewSelect().
+		TableExpr("users").
+		ColumnExpr("users.id").
+		ColumnExpr("COALESCE(SUM(account_ledgers.amount), 0) AS balance").
+		Join("LEFT JOIN accounts ON accounts.user_id = users.id AND accounts.type = ?", common.AccountTypeCurrent).
+		Join("LEFT JOIN account_ledgers ON account_ledgers.account_id = accounts.id").
+		Where("users.id IN (?)", bun.In(userIds)).
+		GroupExpr("users.id")
+	if tenantID != "" {
+		query.Where("users.tenant_id = ?", tenantID)
+	}
+	err := query.Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		balances[row.ID] = row.Balance
+	}
+	return balances, nil
+}
+
 func (svc *LndhubService) AccountFor(ctx context.Context, accountType string, userId int64) (models.Account, error) {
 	account := models.Account{}
-	err := svc.DB.NewSelect().Model(&account).Where("user_id = ? AND type= ?", userId, accountType).Limit(1).Scan(ctx)
+	err := svc.withDBRetry(ctx, func() error {
+		return svc.DB.NewSelect().Model(&account).Where("user_id = ? AND type= ?", userId, accountType).Limit(1).Scan(ctx)
+	})
 	return account, err
 }
 
@@ -268,7 +642,7 @@ func (svc *LndhubService) InvoicesFor(ctx context.Context, userId int64, invoice
 
 	query := svc.DB.NewSelect().Model(&invoices).Where("user_id = ?", userId)
 	if invoiceType != "" {
-		query.Where("type = ? AND state NOT IN(?, ?)", invoiceType, common.InvoiceStateInitialized, common.InvoiceStateError)
+		query.Where("type = ? AND state NOT IN(?, ?, ?)", invoiceType, common.InvoiceStateInitialized, common.InvoiceStateError, common.InvoiceStateAborted)
 	}
 	query.OrderExpr("id DESC").Limit(100)
 	err := query.Scan(ctx)
@@ -278,6 +652,109 @@ func (svc *LndhubService) InvoicesFor(ctx context.Context, userId int64, invoice
 	return invoices, nil
 }
 
+// TransactionsFilter narrows down the transactions of a user, zero values don't filter
+type TransactionsFilter struct {
+	// common.InvoiceTypeIncoming or common.InvoiceTypeOutgoing
+	Type string
+	// one of TransactionStateSettled, TransactionStatePending or TransactionStateFailed
+	State string
+	From  time.Time
+	To    time.Time
+	// the label set by the client when paying
+	Label string
+	// also return the aborted payments, they are left out by default
+	IncludeAborted bool
+}
+
+const (
+	TransactionStateSettled = "settled"
+	TransactionStatePending = "pending"
+	TransactionStateFailed  = "failed"
+)
+
+// applyTransactionsFilter adds the filter to a query on the invoices of a user.
+// Without a state filter initialized and failed invoices are left out. Aborted payments are only returned with
+// IncludeAborted, without a state filter and with the failed state.
+func applyTransactionsFilter(query *bun.SelectQuery, filter TransactionsFilter) *bun.SelectQuery {
+	if filter.Type != "" {
+		query.Where("type = ?", filter.Type)
+	}
+	switch filter.State {
+	case TransactionStateSettled:
+		query.Where("state = ?", common.InvoiceStateSettled)
+	case TransactionStatePending:
+		query.Where("state IN(?, ?, ?)", common.InvoiceStateOpen, common.InvoiceStatePending, common.InvoiceStateHeld)
+	case TransactionStateFailed:
+		if filter.IncludeAborted {
+			query.Where("state IN(?, ?)", common.InvoiceStateError, common.InvoiceStateAborted)
+		} else {
+			query.Where("state = ?", common.InvoiceStateError)
+		}
+	default:
+		if filter.IncludeAborted {
+			query.Where("state NOT IN(?, ?)", common.InvoiceStateInitialized, common.InvoiceStateError)
+		} else {
+			query.Where("state NOT IN(?, ?, ?)", common.InvoiceStateInitialized, common.InvoiceStateError, common.InvoiceStateAborted)
+		}
+	}
+	if !filter.From.IsZero() {
+		query.Where("(CASE WHEN state = ? THEN settled_at ELSE created_at END) >= ?", common.InvoiceStateSettled, filter.From)
+	}
+	if !filter.To.IsZero() {
+		query.Where("(CASE WHEN state = ? THEN settled_at ELSE created_at END) <= ?", common.InvoiceStateSettled, filter.To)
+	}
+	if filter.Label != "" {
+		query.Where("label = ?", filter.Label)
+	}
+	return query
+}
+
+// GetTransactionsPaged returns up to limit invoices of the user matching the filter with an id lower than the cursor, newest first.
+// A cursor of 0 starts at the newest invoice. nextCursor is 0 if there are no more results.
+// The date range of the filter is compared to settled_at for settled invoices and to created_at otherwise.
+func (svc *LndhubService) GetTransactionsPaged(ctx context.Context, userId int64, filter TransactionsFilter, limit int, cursor int64) (invoices []models.Invoice, nextCursor int64, err error) {
+	invoices = []models.Invoice{}
+
+	query := svc.DB.NewSelect().Model(&invoices).Where("user_id = ?", userId)
+	applyTransactionsFilter(query, filter)
+	if cursor > 0 {
+		query.Where("id < ?", cursor)
+	}
+	// fetch one more row to know if there is a next page
+	query.OrderExpr("id DESC").Limit(limit + 1)
+	err = query.Scan(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(invoices) > limit {
+		invoices = invoices[:limit]
+		nextCursor = invoices[limit-1].ID
+	}
+	return invoices, nextCursor, nil
+}
+
+// StreamTransactions calls fn for every invoice of the user matching the filter, newest first.
+// The invoices are read from a database cursor so they are never all loaded into memory.
+func (svc *LndhubService) StreamTransactions(ctx context.Context, userId int64, filter TransactionsFilter, fn func(invoice *models.Invoice) error) error {
+	query := svc.DB.NewSelect().Model((*models.Invoice)(nil)).Where("user_id = ?", userId)
+	applyTransactionsFilter(query, filter)
+	rows, err := query.OrderExpr("id DESC").Rows(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		invoice := models.Invoice{}
+		if err := svc.DB.ScanRow(ctx, rows, &invoice); err != nil {
+			return err
+		}
+		if err := fn(&invoice); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func (svc *LndhubService) GetVolumeOverPeriod(ctx context.Context, userId int64, invoiceType string, period time.Duration) (result int64, err error) {
 
 	err = svc.DB.NewSelect().Table("invoices").
@@ -292,6 +769,36 @@ func (svc *LndhubService) GetVolumeOverPeriod(ctx context.Context, userId int64,
 	return result, nil
 }
 
+// OutboundVolumeSince returns the sum of the outgoing payments of the user since the given time, payments that are
+// debited but not settled yet are included
+func (svc *LndhubService) OutboundVolumeSince(ctx context.Context, userId int64, since time.Time) (result int64, err error) {
+	return outboundVolumeSince(ctx, svc.DB, userId, since)
+}
+
+func outboundVolumeSince(ctx context.Context, db bun.IDB, userId int64, since time.Time) (result int64, err error) {
+	err = db.NewSelect().Table("invoices").
+		ColumnExpr("coalesce(sum(invoices.amount), 0) as result").
+		Where("invoices.user_id = ?", userId).
+		Where("invoices.type = ?", common.InvoiceTypeOutgoing).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					return q.Where("invoices.state = ?", common.InvoiceStateSettled).Where("invoices.settled_at >= ?", since)
+				}).
+				WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					// in flight, the debit entry tells them apart from invoices that were never paid
+					return q.Where("invoices.state IN (?)", bun.In([]string{common.InvoiceStateInitialized, common.InvoiceStateOpen})).
+						Where("invoices.created_at >= ?", since).
+						Where("EXISTS (SELECT 1 FROM transaction_entries WHERE transaction_entries.invoice_id = invoices.id AND transaction_entries.entry_type = ?)", models.EntryTypeOutgoing)
+				})
+		}).
+		Scan(ctx, &result)
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
 func (svc *LndhubService) GetLimits(c echo.Context) (limits *Limits) {
 	limits = &Limits{
 		MaxSendVolume:     svc.Config.MaxSendVolume,
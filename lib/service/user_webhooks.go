@@ -0,0 +1,192 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/getAlby/lndhub.go/common"
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getsentry/sentry-go"
+	"github.com/uptrace/bun"
+)
+
+const UserWebhookSignatureHeader = "X-Lndhub-Signature"
+
+type UserWebhookEvent struct {
+	Event     string                `json:"event"`
+	CreatedAt time.Time             `json:"created_at"`
+	Data      WebhookInvoicePayload `json:"data"`
+}
+
+// CreateUserWebhook subscribes a webhook, URLs that the outbound client would not request are rejected with
+// ErrInvalidOutboundURL or ErrOutboundHostBlocked
+func (svc *LndhubService) CreateUserWebhook(ctx context.Context, userId int64, url string, events []string) (*models.Webhook, error) {
+	if err := svc.CheckOutboundURL(ctx, url); err != nil {
+		return nil, err
+	}
+	secret, err := randBytesFromStr(32, alphaNumBytes)
+	if err != nil {
+		return nil, err
+	}
+	webhook := models.Webhook{
+		UserID: userId,
+		Url:    url,
+		Secret: string(secret),
+		Events: events,
+	}
+	_, err = svc.DB.NewInsert().Model(&webhook).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (svc *LndhubService) FindUserWebhooks(ctx context.Context, userId int64) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	err := svc.DB.NewSelect().Model(&webhooks).Where("user_id = ?", userId).OrderExpr("id ASC").Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteUserWebhook returns sql.ErrNoRows if the user has no webhook with this id
+func (svc *LndhubService) DeleteUserWebhook(ctx context.Context, userId, id int64) error {
+	result, err := svc.DB.NewDelete().Model((*models.Webhook)(nil)).Where("id = ? AND user_id = ?", id, userId).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// StartUserWebhookDeliveries sends settled incoming and outgoing payments to the webhooks of their users
+func (svc *LndhubService) StartUserWebhookDeliveries(ctx context.Context) error {
+	incomingInvoices, outgoingInvoices, err := svc.SubscribeIncomingOutgoingInvoices()
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case incoming := <-incomingInvoices:
+			go svc.deliverUserWebhooks(ctx, common.WebhookEventInvoiceSettled, incoming)
+		case outgoing := <-outgoingInvoices:
+			go svc.deliverUserWebhooks(ctx, common.WebhookEventPaymentSent, outgoing)
+		}
+	}
+}
+
+// sendPaymentFailedWebhooks notifies the webhooks and the event streams of the user about a payment that definitively failed
+func (svc *LndhubService) sendPaymentFailedWebhooks(failedInvoice models.Invoice) {
+	svc.publishAccountEvent(failedInvoice)
+	// the request context is canceled once the response is sent
+	go svc.deliverUserWebhooks(context.Background(), common.WebhookEventPaymentFailed, failedInvoice)
+}
+
+func (svc *LndhubService) deliverUserWebhooks(ctx context.Context, event string, invoice models.Invoice) {
+	webhooks := []models.Webhook{}
+	err := svc.DB.NewSelect().Model(&webhooks).Where("user_id = ? AND ? = ANY(events)", invoice.UserID, event).Scan(ctx)
+	if err != nil {
+		svc.Logger.Errorf("Failed to load webhooks user_id:%v invoice_id:%v error: %v", invoice.UserID, invoice.ID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	user, err := svc.FindUser(ctx, invoice.UserID)
+	if err != nil {
+		svc.Logger.Errorf("Failed to load user user_id:%v invoice_id:%v error: %v", invoice.UserID, invoice.ID, err)
+		return
+	}
+	payload, err := json.Marshal(UserWebhookEvent{
+		Event:     event,
+		CreatedAt: time.Now(),
+		Data:      ConvertPayload(invoice, user),
+	})
+	if err != nil {
+		svc.Logger.Error(err)
+		return
+	}
+	for i := range webhooks {
+		svc.deliverUserWebhook(ctx, &webhooks[i], payload)
+	}
+}
+
+// deliverUserWebhook posts the payload and retries failed deliveries with exponential backoff
+func (svc *LndhubService) deliverUserWebhook(ctx context.Context, webhook *models.Webhook, payload []byte) {
+	delay := time.Duration(svc.Config.UserWebhookRetryDelay) * time.Second
+	var status int
+	var err error
+	for attempt := 0; attempt <= svc.Config.UserWebhookMaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		status, err = svc.postUserWebhook(ctx, webhook, payload)
+		if err == nil {
+			break
+		}
+		svc.Logger.Errorf("Webhook delivery failed webhook_id:%v user_id:%v attempt:%v error: %v", webhook.ID, webhook.UserID, attempt+1, err)
+	}
+	webhook.LastDeliveryStatus = status
+	webhook.LastDeliveryError = ""
+	if err != nil {
+		webhook.LastDeliveryError = err.Error()
+		// why a connection failed is only logged, it would tell the user about hosts and ports they can't reach otherwise
+		if status == 0 {
+			webhook.LastDeliveryError = "webhook could not be reached"
+		}
+	}
+	webhook.LastDeliveryAt = bun.NullTime{Time: time.Now()}
+	_, dbErr := svc.DB.NewUpdate().Model(webhook).Column("last_delivery_status", "last_delivery_error", "last_delivery_at").WherePK().Exec(context.Background())
+	if dbErr != nil {
+		sentry.CaptureException(dbErr)
+		svc.Logger.Errorf("Failed to record webhook delivery webhook_id:%v error: %v", webhook.ID, dbErr)
+	}
+}
+
+func (svc *LndhubService) postUserWebhook(ctx context.Context, webhook *models.Webhook, payload []byte) (status int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(UserWebhookSignatureHeader, "sha256="+SignUserWebhookPayload(webhook.Secret, payload))
+	// the URLs are given by users, private addresses must not be reached
+	resp, err := svc.outboundClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook status code was %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignUserWebhookPayload returns the hex encoded HMAC-SHA256 of the payload
+func SignUserWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -17,3 +17,13 @@ func randBytesFromStr(length int, from string) ([]byte, error) {
 	}
 	return b, nil
 }
+
+// RedactPaymentRequest shortens a payment request for the logs if LOG_REDACT_PAYMENT_REQUESTS is set,
+// the prefix with the network and the amount is kept
+func (svc *LndhubService) RedactPaymentRequest(paymentRequest string) string {
+	const keep = 20
+	if !svc.Config.LogRedactPaymentRequests || len(paymentRequest) <= keep {
+		return paymentRequest
+	}
+	return paymentRequest[:keep] + "...[redacted]"
+}
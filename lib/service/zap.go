@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/nostr"
+	"github.com/getAlby/lndhub.go/lib/responses"
+)
+
+const zapReceiptPublishTimeout = 10 * time.Second
+
+var ErrZapsNotEnabled = errors.New("zaps are not enabled, NOSTR_PRIVATE_KEY is not set")
+
+// ZapsEnabled returns true if a key to sign the zap receipts is configured
+func (svc *LndhubService) ZapsEnabled() bool {
+	return svc.Config.NostrPrivateKey != ""
+}
+
+// NostrPublicKey returns the public key the zap receipts are signed with
+func (svc *LndhubService) NostrPublicKey() (string, error) {
+	if !svc.ZapsEnabled() {
+		return "", ErrZapsNotEnabled
+	}
+	privateKey, err := nostr.ParsePrivateKey(svc.Config.NostrPrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return nostr.PublicKey(privateKey), nil
+}
+
+// ParseZapRequest checks the zap request event as described in NIP-57,
+// amountMsat is the amount of the invoice that is created for the zap
+func ParseZapRequest(zapRequest string, amountMsat int64) (*nostr.Event, error) {
+	event := &nostr.Event{}
+	if err := json.Unmarshal([]byte(zapRequest), event); err != nil {
+		return nil, err
+	}
+	if event.Kind != nostr.KindZapRequest {
+		return nil, fmt.Errorf("zap request must be of kind %d", nostr.KindZapRequest)
+	}
+	if err := event.Verify(); err != nil {
+		return nil, err
+	}
+	recipients := event.TagValues("p")
+	if len(recipients) != 1 {
+		return nil, errors.New("zap request must have exactly one p tag")
+	}
+	if recipient, err := hex.DecodeString(recipients[0]); err != nil || len(recipient) != 32 {
+		return nil, errors.New("zap request p tag must be a hex encoded public key")
+	}
+	if len(event.TagValues("e")) > 1 {
+		return nil, errors.New("zap request must have at most one e tag")
+	}
+	if relays := event.Tag("relays"); len(relays) < 2 {
+		return nil, errors.New("zap request must have a relays tag")
+	}
+	if amount := event.Tag("amount"); len(amount) > 1 && amount[1] != strconv.FormatInt(amountMsat, 10) {
+		return nil, errors.New("zap request amount does not match the invoice amount")
+	}
+	return event, nil
+}
+
+// AddZapInvoice creates an invoice that commits to the zap request, a zap receipt is published once it is settled
+func (svc *LndhubService) AddZapInvoice(ctx context.Context, userID int64, amount int64, memo, zapRequest string, expirySeconds int64, clientInvoiceID string, includePrivateHints bool) (*models.Invoice, *responses.ErrorResponse) {
+	return svc.addIncomingInvoice(ctx, models.Invoice{
+		UserID:            userID,
+		Amount:            amount,
+		Memo:              memo,
+		DescriptionHash:   LNURLPayDescriptionHash(zapRequest),
+		ZapRequest:        zapRequest,
+		Expiry:            expirySeconds,
+		ClientInvoiceID:   clientInvoiceID,
+		PrivateRouteHints: includePrivateHints,
+	})
+}
+
+// PublishZapReceipt publishes the zap receipt of a settled zap invoice in the background,
+// publishing is best-effort and failures are only logged
+func (svc *LndhubService) PublishZapReceipt(invoice models.Invoice) {
+	if invoice.ZapRequest == "" || !svc.ZapsEnabled() {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), zapReceiptPublishTimeout)
+		defer cancel()
+		err := svc.publishZapReceipt(ctx, &invoice)
+		if err != nil {
+			svc.Logger.Errorf("Failed to publish zap receipt invoice_id:%v error: %v", invoice.ID, err)
+		}
+	}()
+}
+
+// publishZapReceipt signs the zap receipt and sends it to the relays of the zap request and NOSTR_RELAYS
+func (svc *LndhubService) publishZapReceipt(ctx context.Context, invoice *models.Invoice) error {
+	receipt, relays, err := svc.zapReceipt(invoice)
+	if err != nil {
+		return err
+	}
+	wg := sync.WaitGroup{}
+	errs := make([]error, len(relays))
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay string) {
+			defer wg.Done()
+			errs[i] = nostr.Publish(ctx, relay, receipt)
+		}(i, relay)
+	}
+	wg.Wait()
+	published := 0
+	for i, err := range errs {
+		if err != nil {
+			svc.Logger.Errorf("Failed to publish zap receipt invoice_id:%v relay:%v error: %v", invoice.ID, relays[i], err)
+			continue
+		}
+		published++
+	}
+	if published == 0 {
+		return errors.New("zap receipt was not accepted by any relay")
+	}
+	svc.Logger.Infof("Published zap receipt invoice_id:%v event_id:%v relays:%v", invoice.ID, receipt.ID, published)
+	return nil
+}
+
+func (svc *LndhubService) zapReceipt(invoice *models.Invoice) (receipt *nostr.Event, relays []string, err error) {
+	if !svc.ZapsEnabled() {
+		return nil, nil, ErrZapsNotEnabled
+	}
+	privateKey, err := nostr.ParsePrivateKey(svc.Config.NostrPrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	zapRequest := &nostr.Event{}
+	if err := json.Unmarshal([]byte(invoice.ZapRequest), zapRequest); err != nil {
+		return nil, nil, err
+	}
+	receipt = &nostr.Event{
+		CreatedAt: invoice.SettledAt.Time.Unix(),
+		Kind:      nostr.KindZapReceipt,
+		Tags:      [][]string{},
+	}
+	for _, name := range []string{"p", "e", "a"} {
+		if tag := zapRequest.Tag(name); len(tag) > 1 {
+			receipt.Tags = append(receipt.Tags, []string{name, tag[1]})
+		}
+	}
+	receipt.Tags = append(receipt.Tags,
+		[]string{"P", zapRequest.PubKey},
+		[]string{"bolt11", invoice.PaymentRequest},
+		[]string{"description", invoice.ZapRequest},
+		[]string{"preimage", invoice.Preimage},
+	)
+	if err := receipt.Sign(privateKey); err != nil {
+		return nil, nil, err
+	}
+	candidates := []string{}
+	if tag := zapRequest.Tag("relays"); len(tag) > 1 {
+		candidates = append(candidates, tag[1:]...)
+	}
+	// the relays of the zap request come first, duplicates are only published to once
+	seen := map[string]bool{}
+	for _, relay := range append(candidates, svc.Config.NostrRelays...) {
+		if !seen[relay] {
+			seen[relay] = true
+			relays = append(relays, relay)
+		}
+	}
+	return receipt, relays, nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/nostr"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/ziflex/lecho/v3"
+)
+
+var zapRecipient = strings.Repeat("ab", 32)
+
+func signedZapRequest(t *testing.T, kind int, tags [][]string) string {
+	privateKey, err := nostr.ParsePrivateKey(strings.Repeat("02", 32))
+	assert.NoError(t, err)
+	event := &nostr.Event{CreatedAt: time.Now().Unix(), Kind: kind, Tags: tags, Content: "great post"}
+	assert.NoError(t, event.Sign(privateKey))
+	zapRequest, err := json.Marshal(event)
+	assert.NoError(t, err)
+	return string(zapRequest)
+}
+
+func TestParseZapRequest(t *testing.T) {
+	relays := []string{"relays", "wss://relay.example.com"}
+	valid := signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}, {"amount", "21000"}, relays})
+	tampered := strings.Replace(valid, "great post", "other post", 1)
+	tests := []struct {
+		name       string
+		zapRequest string
+		valid      bool
+	}{
+		{"valid", valid, true},
+		{"without amount", signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}, relays}), true},
+		{"not json", "zap", false},
+		{"wrong kind", signedZapRequest(t, 1, [][]string{{"p", zapRecipient}, relays}), false},
+		{"invalid signature", tampered, false},
+		{"without p tag", signedZapRequest(t, nostr.KindZapRequest, [][]string{relays}), false},
+		{"two p tags", signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}, {"p", zapRecipient}, relays}), false},
+		{"invalid p tag", signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", "npub"}, relays}), false},
+		{"two e tags", signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}, {"e", "1"}, {"e", "2"}, relays}), false},
+		{"without relays", signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}}), false},
+		{"other amount", signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}, {"amount", "1000"}, relays}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseZapRequest(tt.zapRequest, 21000)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestZapReceipt(t *testing.T) {
+	zapRequest := signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}, {"e", "note"}, {"relays", "wss://a", "wss://b"}})
+	zapSvc := &LndhubService{Config: &Config{NostrPrivateKey: strings.Repeat("03", 32), NostrRelays: []string{"wss://b", "wss://c"}}}
+	settledAt := time.Unix(1700000000, 0)
+	invoice := &models.Invoice{
+		PaymentRequest: "lnbc1",
+		Preimage:       "preimage",
+		ZapRequest:     zapRequest,
+		SettledAt:      bun.NullTime{Time: settledAt},
+	}
+	receipt, relays, err := zapSvc.zapReceipt(invoice)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"wss://a", "wss://b", "wss://c"}, relays)
+	assert.NoError(t, receipt.Verify())
+	pubkey, err := zapSvc.NostrPublicKey()
+	assert.NoError(t, err)
+	assert.Equal(t, pubkey, receipt.PubKey)
+	assert.Equal(t, nostr.KindZapReceipt, receipt.Kind)
+	assert.Equal(t, settledAt.Unix(), receipt.CreatedAt)
+	assert.Equal(t, []string{"p", zapRecipient}, receipt.Tag("p"))
+	assert.Equal(t, []string{"e", "note"}, receipt.Tag("e"))
+	assert.Nil(t, receipt.Tag("a"))
+	sender := &nostr.Event{}
+	assert.NoError(t, json.Unmarshal([]byte(zapRequest), sender))
+	assert.Equal(t, []string{"P", sender.PubKey}, receipt.Tag("P"))
+	assert.Equal(t, []string{"bolt11", "lnbc1"}, receipt.Tag("bolt11"))
+	assert.Equal(t, []string{"description", zapRequest}, receipt.Tag("description"))
+	assert.Equal(t, []string{"preimage", "preimage"}, receipt.Tag("preimage"))
+
+	_, _, err = (&LndhubService{Config: &Config{}}).zapReceipt(invoice)
+	assert.ErrorIs(t, err, ErrZapsNotEnabled)
+}
+
+func TestPublishZapReceipt(t *testing.T) {
+	received := make(chan *nostr.Event, 1)
+	upgrader := websocket.Upgrader{}
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		event := &nostr.Event{}
+		message := []interface{}{new(string), event}
+		if err := conn.ReadJSON(&message); err != nil {
+			return
+		}
+		received <- event
+		conn.WriteJSON([]interface{}{"OK", event.ID, true, ""})
+	}))
+	defer relay.Close()
+
+	// the relay of the zap request is not reachable, the receipt is still published to NOSTR_RELAYS
+	zapRequest := signedZapRequest(t, nostr.KindZapRequest, [][]string{{"p", zapRecipient}, {"relays", "ws://127.0.0.1:1"}})
+	zapSvc := &LndhubService{
+		Config: &Config{
+			NostrPrivateKey: strings.Repeat("03", 32),
+			NostrRelays:     []string{"ws" + strings.TrimPrefix(relay.URL, "http")},
+		},
+		Logger: lecho.New(io.Discard),
+	}
+	invoice := models.Invoice{
+		ID:             1,
+		PaymentRequest: "lnbc210n1",
+		Preimage:       "0102",
+		ZapRequest:     zapRequest,
+		SettledAt:      bun.NullTime{Time: time.Now()},
+	}
+	zapSvc.PublishZapReceipt(invoice)
+	select {
+	case receipt := <-received:
+		assert.NoError(t, receipt.Verify())
+		assert.Equal(t, nostr.KindZapReceipt, receipt.Kind)
+		assert.Equal(t, []string{"bolt11", "lnbc210n1"}, receipt.Tag("bolt11"))
+		assert.Equal(t, []string{"preimage", "0102"}, receipt.Tag("preimage"))
+		assert.Equal(t, []string{"description", zapRequest}, receipt.Tag("description"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("zap receipt was not published")
+	}
+
+	// without any relay the receipt can't be published
+	zapSvc.Config.NostrRelays = nil
+	assert.Error(t, zapSvc.publishZapReceipt(context.Background(), &models.Invoice{ZapRequest: "{}"}))
+}
@@ -5,13 +5,35 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// AdminNameKey is the context key of the name of the admin who made the request, admin actions are attributed to it
+const AdminNameKey = "AdminName"
+
+// DefaultAdminName is the name of requests made with the shared admin token
+const DefaultAdminName = "admin"
+
 func AdminTokenMiddleware(token string) echo.MiddlewareFunc {
+	return NamedAdminTokenMiddleware(token, nil)
+}
+
+// NamedAdminTokenMiddleware accepts the shared admin token and the tokens of single admins by name.
+// The name of the admin is stored in the context with AdminNameKey.
+func NamedAdminTokenMiddleware(token string, namedTokens map[string]string) echo.MiddlewareFunc {
 	if token == "" {
 		return func(next echo.HandlerFunc) echo.HandlerFunc {
 			return next
 		}
 	}
 	return middleware.KeyAuth(func(auth string, c echo.Context) (bool, error) {
-		return auth == token, nil
+		if auth == token {
+			c.Set(AdminNameKey, DefaultAdminName)
+			return true, nil
+		}
+		for name, namedToken := range namedTokens {
+			if namedToken != "" && auth == namedToken {
+				c.Set(AdminNameKey, name)
+				return true, nil
+			}
+		}
+		return false, nil
 	})
 }
@@ -1,12 +1,16 @@
 package tokens
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/getAlby/lndhub.go/db/models"
+	"github.com/getAlby/lndhub.go/lib/responses"
 	"github.com/getsentry/sentry-go"
 	sentryecho "github.com/getsentry/sentry-go/echo"
 	"github.com/golang-jwt/jwt"
@@ -15,13 +19,16 @@ import (
 )
 
 type jwtCustomClaims struct {
-	ID                 int64 `json:"id"`
-	IsRefresh          bool  `json:"isRefresh"`
-	MaxSendVolume      int64 `json:"maxSendVolume"`
-	MaxSendAmount      int64 `json:"maxSendAmount"`
-	MaxReceiveVolume   int64 `json:"maxReceiveVolume"`
-	MaxReceiveAmount   int64 `json:"maxReceiveAmount"`
-	MaxAccountBalance  int64 `json:"maxAccountBalance"`
+	ID                int64    `json:"id"`
+	IsRefresh         bool     `json:"isRefresh"`
+	MaxSendVolume     int64    `json:"maxSendVolume"`
+	MaxSendAmount     int64    `json:"maxSendAmount"`
+	MaxReceiveVolume  int64    `json:"maxReceiveVolume"`
+	MaxReceiveAmount  int64    `json:"maxReceiveAmount"`
+	MaxAccountBalance int64    `json:"maxAccountBalance"`
+	Epoch             int64    `json:"epoch"`
+	Scopes            []string `json:"scopes,omitempty"`
+	TenantID          string   `json:"tenant,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -31,6 +38,11 @@ func Middleware(secret []byte) echo.MiddlewareFunc {
 	config.Claims = &jwtCustomClaims{}
 	config.ContextKey = "UserJwt"
 	config.SigningKey = secret
+	// requests authenticated with an API key don't have a JWT
+	config.Skipper = func(c echo.Context) bool {
+		_, ok := c.Get("ApiKeyID").(int64)
+		return ok
+	}
 	config.ErrorHandlerWithContext = func(err error, c echo.Context) error {
 		c.Logger().Error(err)
 		return echo.NewHTTPError(http.StatusUnauthorized, echo.Map{
@@ -48,23 +60,53 @@ func Middleware(secret []byte) echo.MiddlewareFunc {
 		c.Set("MaxReceiveVolume", claims.MaxReceiveVolume)
 		c.Set("MaxReceiveAmount", claims.MaxReceiveAmount)
 		c.Set("MaxAccountBalance", claims.MaxAccountBalance)
+		// used to check if the token was revoked
+		c.Set("TokenID", claims.Id)
+		c.Set("TokenEpoch", claims.Epoch)
+		c.Set("TokenExpiresAt", claims.ExpiresAt)
+		c.Set("Scopes", claims.Scopes)
+		c.Set("TenantID", claims.TenantID)
+		c.Set("TokenIsRefresh", claims.IsRefresh)
 		// pass UserID to sentry for exception notifications
 		if hub := sentryecho.GetHubFromContext(c); hub != nil {
 			hub.Scope().SetUser(sentry.User{ID: strconv.FormatInt(claims.ID, 10)})
 		}
 	}
 
-	return middleware.JWTWithConfig(config)
+	jwtMiddleware := middleware.JWTWithConfig(config)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return jwtMiddleware(func(c echo.Context) error {
+			// refresh tokens are only accepted to issue new tokens, used and revoked ones are not on the revocation list
+			if isRefresh, _ := c.Get("TokenIsRefresh").(bool); isRefresh {
+				c.Logger().Errorf("Refresh token used as access token user_id:%v", c.Get("UserID"))
+				return echo.NewHTTPError(http.StatusUnauthorized, echo.Map{
+					"error":   true,
+					"code":    1,
+					"message": "bad auth",
+				})
+			}
+			return next(c)
+		})
+	}
 }
 
-// GenerateAccessToken : Generate Access Token
-func GenerateAccessToken(secret []byte, expiryInSeconds int, u *models.User) (string, error) {
+// GenerateAccessToken : Generate Access Token, returns the signed token and its id
+func GenerateAccessToken(secret []byte, expiryInSeconds int, u *models.User, scopes []string) (string, string, error) {
+	jti, err := generateTokenId()
+	if err != nil {
+		return "", "", err
+	}
 	claims := &jwtCustomClaims{
 		ID:        u.ID,
 		IsRefresh: false,
+		Epoch:     u.TokenEpoch,
+		Scopes:    scopes,
+		TenantID:  u.TenantID,
 		StandardClaims: jwt.StandardClaims{
 			// one week expiration
 			ExpiresAt: time.Now().Add(time.Second * time.Duration(expiryInSeconds)).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Id:        jti,
 		},
 	}
 
@@ -72,20 +114,29 @@ func GenerateAccessToken(secret []byte, expiryInSeconds int, u *models.User) (st
 
 	t, err := token.SignedString(secret)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return t, nil
+	return t, jti, nil
 }
 
-// GenerateRefreshToken : Generate Refresh Token
-func GenerateRefreshToken(secret []byte, expiryInSeconds int, u *models.User) (string, error) {
+// GenerateRefreshToken : Generate Refresh Token, returns the signed token and its id
+func GenerateRefreshToken(secret []byte, expiryInSeconds int, u *models.User, scopes []string) (string, string, error) {
+	jti, err := generateTokenId()
+	if err != nil {
+		return "", "", err
+	}
 	claims := &jwtCustomClaims{
 		ID:        u.ID,
 		IsRefresh: true,
+		Epoch:     u.TokenEpoch,
+		Scopes:    scopes,
+		TenantID:  u.TenantID,
 		StandardClaims: jwt.StandardClaims{
 			// one week expiration
 			ExpiresAt: time.Now().Add(time.Second * time.Duration(expiryInSeconds)).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Id:        jti,
 		},
 	}
 
@@ -93,10 +144,10 @@ func GenerateRefreshToken(secret []byte, expiryInSeconds int, u *models.User) (s
 
 	t, err := token.SignedString(secret)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return t, nil
+	return t, jti, nil
 }
 func ParseToken(secret []byte, token string, mustBeRefresh bool) (int64, error) {
 	userIdClaim := "id"
@@ -131,6 +182,90 @@ func ParseToken(secret []byte, token string, mustBeRefresh bool) (int64, error)
 	return int64(userId.(float64)), nil
 }
 
+// ParseRevocationClaims returns the id and the epoch of a token to check if it was revoked
+func ParseRevocationClaims(secret []byte, token string) (jti string, epoch int64, err error) {
+	claims := &jwtCustomClaims{}
+	parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if !parsedToken.Valid {
+		return "", 0, errors.New("Token is invalid")
+	}
+	return claims.Id, claims.Epoch, nil
+}
+
+// ParseScopes returns the scopes of a token, a token without scopes has full access
+func ParseScopes(secret []byte, token string) ([]string, error) {
+	claims := &jwtCustomClaims{}
+	parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !parsedToken.Valid {
+		return nil, errors.New("Token is invalid")
+	}
+	return claims.Scopes, nil
+}
+
+// RequireScope rejects requests whose token is limited to other scopes, it must be used after the authentication middleware
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scopes, _ := c.Get("Scopes").([]string)
+			if !HasScope(scopes, scope) {
+				c.Logger().Errorf("Token is missing the scope %s for %s %s user_id:%v", scope, c.Request().Method, c.Path(), c.Get("UserID"))
+				resp := responses.InsufficientScopeError
+				resp.Message = fmt.Sprintf("token does not have the %s scope required for this request", scope)
+				return c.JSON(http.StatusForbidden, &resp)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireFullAccess rejects requests whose token is limited to scopes, it guards routes that change the account itself.
+// It must be used after the authentication middleware
+func RequireFullAccess() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scopes, _ := c.Get("Scopes").([]string)
+			if len(scopes) > 0 {
+				c.Logger().Errorf("Token with scopes %v is not allowed for %s %s user_id:%v", scopes, c.Request().Method, c.Path(), c.Get("UserID"))
+				resp := responses.InsufficientScopeError
+				resp.Message = "token with full access required for this request"
+				return c.JSON(http.StatusForbidden, &resp)
+			}
+			return next(c)
+		}
+	}
+}
+
+// HasScope checks if a scope is granted, no scopes means full access
+func HasScope(scopes []string, scope string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func generateTokenId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func GetUserIdFromToken(secret []byte, token string) (int64, error) {
 	return ParseToken(secret, token, true)
 }
@@ -0,0 +1,28 @@
+package transport
+
+import (
+	"net/http"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+)
+
+// CreateBodyLimitMiddleware rejects requests with a body larger than MAX_REQUEST_BYTES.
+// Bodies without a content length are cut off at the limit, so binding them fails instead of reading them into memory.
+func CreateBodyLimitMiddleware(c *service.Config) echo.MiddlewareFunc {
+	limit := c.MaxRequestBytes
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			if limit <= 0 || req.Body == nil {
+				return next(ctx)
+			}
+			if req.ContentLength > limit {
+				return ctx.JSON(responses.RequestTooLargeError.HttpStatusCode, responses.RequestTooLargeError)
+			}
+			req.Body = http.MaxBytesReader(ctx.Response(), req.Body, limit)
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib"
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = responses.HTTPErrorHandler
+	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	e.Use(CreateBodyLimitMiddleware(&service.Config{MaxRequestBytes: 100}))
+	// binds the body like the controllers do
+	e.POST("/test", func(c echo.Context) error {
+		var body struct {
+			Invoice string `json:"invoice" validate:"required"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		if err := c.Validate(&body); err != nil {
+			return c.JSON(http.StatusBadRequest, responses.BadArgumentsError)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	oversized := `{"invoice":"` + strings.Repeat("a", 200) + `"}`
+
+	tests := []struct {
+		name           string
+		body           io.Reader
+		contentLength  int64
+		expectedStatus int
+		expectedError  *responses.ErrorResponse
+	}{
+		{
+			name:           "valid body",
+			body:           strings.NewReader(`{"invoice":"lnbc1"}`),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "oversized body",
+			body:           strings.NewReader(oversized),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  &responses.RequestTooLargeError,
+		},
+		{
+			// the content length is only known when the body is read
+			name:           "oversized body without content length",
+			body:           io.MultiReader(strings.NewReader(oversized)),
+			contentLength:  -1,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+		{
+			name:           "truncated body",
+			body:           strings.NewReader(`{"invoice":"lnbc1`),
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  &responses.BadArgumentsError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/test", tt.body)
+			if tt.contentLength != 0 {
+				req.ContentLength = tt.contentLength
+			}
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedError != nil {
+				errorResponse := &responses.ErrorResponse{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(errorResponse))
+				assert.Equal(t, tt.expectedError.Message, errorResponse.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package transport
+
+import (
+	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CreateCORSMiddleware allows browsers on the CORS_ALLOWED_ORIGINS to call the API and answers their preflight requests.
+// It is only used when origins are configured, other origins don't get any Access-Control headers.
+func CreateCORSMiddleware(c *service.Config) echo.MiddlewareFunc {
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     c.CORSAllowedOrigins,
+		AllowMethods:     c.CORSAllowedMethods,
+		AllowHeaders:     []string{echo.HeaderAuthorization, echo.HeaderContentType, v2controllers.IdempotencyKeyHeader},
+		ExposeHeaders:    []string{echo.HeaderXRequestID},
+		AllowCredentials: c.CORSAllowCredentials,
+		MaxAge:           86400,
+	})
+}
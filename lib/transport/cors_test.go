@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(CreateCORSMiddleware(&service.Config{
+		CORSAllowedOrigins: []string{"https://wallet.example.com"},
+		CORSAllowedMethods: []string{http.MethodGet, http.MethodPost},
+	}))
+	e.POST("/v2/payments/bolt11", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		origin        string
+		expectedCode  int
+		expectAllowed bool
+	}{
+		{"allowed origin", http.MethodPost, "https://wallet.example.com", http.StatusOK, true},
+		{"preflight of an allowed origin", http.MethodOptions, "https://wallet.example.com", http.StatusNoContent, true},
+		{"disallowed origin", http.MethodPost, "https://evil.example.com", http.StatusOK, false},
+		{"preflight of a disallowed origin", http.MethodOptions, "https://evil.example.com", http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v2/payments/bolt11", nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+				req.Header.Set(echo.HeaderAccessControlRequestHeaders, echo.HeaderAuthorization)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if !tt.expectAllowed {
+				assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+				assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowMethods))
+				return
+			}
+			assert.Equal(t, tt.origin, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			if tt.method == http.MethodOptions {
+				assert.Equal(t, "GET,POST", rec.Header().Get(echo.HeaderAccessControlAllowMethods))
+				assert.Contains(t, rec.Header().Get(echo.HeaderAccessControlAllowHeaders), echo.HeaderAuthorization)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"embed"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
 	cache "github.com/SporkHubr/echo-http-cache"
@@ -19,7 +18,6 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog"
 	"github.com/ziflex/lecho/v3"
-	"golang.org/x/time/rate"
 )
 
 //go:embed templates/index.html
@@ -36,14 +34,20 @@ func InitEcho(c *service.Config, logger *lecho.Logger) (e *echo.Echo) {
 
 	e.HTTPErrorHandler = responses.HTTPErrorHandler
 	e.Validator = &lib.CustomValidator{Validator: validator.New()}
+	e.JSONSerializer = responses.JSONSerializer{}
 
 	e.Use(middleware.Recover())
-	e.Use(middleware.BodyLimit("250K"))
-	// set the default rate limit defining the overal max requests/second
-	e.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(rate.Limit(c.DefaultRateLimit))))
+	// the request id is set first so every response carries it, including rejected requests
+	e.Use(middleware.RequestID())
+	// preflight requests are answered before they are limited
+	if len(c.CORSAllowedOrigins) > 0 {
+		e.Use(CreateCORSMiddleware(c))
+	}
+	e.Use(CreateBodyLimitMiddleware(c))
+	// set the default rate limit defining the overal max requests/second of an IP
+	e.Use(CreateIpRateLimitMiddleware(c))
 
 	e.Logger = logger
-	e.Use(middleware.RequestID())
 
 	// Setup exception tracking with Sentry if configured
 	// sentry init needs to happen before the echo middlewares are added
@@ -55,31 +59,16 @@ func InitEcho(c *service.Config, logger *lecho.Logger) (e *echo.Echo) {
 
 func CreateLoggingMiddleware(logger *lecho.Logger) echo.MiddlewareFunc {
 	return lecho.Middleware(lecho.Config{
-		Logger: logger,
+		Logger:       logger,
+		RequestIDKey: "request_id",
 		Enricher: func(c echo.Context, logger zerolog.Context) zerolog.Context {
-			return logger.Interface("UserID", c.Get("UserID"))
+			return logger.Interface("user_id", c.Get("UserID"))
 		},
 	})
 }
 
 func CreateRateLimitMiddleware(requestsPerSecond int, burst int) echo.MiddlewareFunc {
-	config := middleware.RateLimiterConfig{
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
-			middleware.RateLimiterMemoryStoreConfig{Rate: rate.Limit(requestsPerSecond), Burst: burst},
-		),
-		IdentifierExtractor: func(ctx echo.Context) (string, error) {
-			userId := ctx.Get("UserID")
-			id := ctx.RealIP()
-			if userId != nil {
-				userIdAsInt64 := ctx.Get("UserID").(int64)
-				id = strconv.FormatInt(userIdAsInt64, 10)
-			}
-
-			return id, nil
-		},
-	}
-
-	return middleware.RateLimiterWithConfig(config)
+	return createRateLimitMiddleware(service.RateLimit{Rate: float64(requestsPerSecond), Burst: burst}, userOrIpIdentifier)
 }
 
 func createCacheClient() *cache.Client {
@@ -3,8 +3,10 @@ package transport
 import (
 	"net/http"
 
+	"github.com/getAlby/lndhub.go/common"
 	"github.com/getAlby/lndhub.go/controllers"
 	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"golang.org/x/time/rate"
@@ -12,27 +14,48 @@ import (
 
 func RegisterLegacyEndpoints(svc *service.LndhubService, e *echo.Echo, secured *echo.Group, securedWithStrictRateLimit *echo.Group, strictRateLimitMiddleware echo.MiddlewareFunc, adminMw echo.MiddlewareFunc, logMw echo.MiddlewareFunc) {
 	// Public endpoints for account creation and authentication
-	e.POST("/auth", controllers.NewAuthController(svc).Auth, logMw)
+	authRateLimitMiddleware := CreateAuthRateLimitMiddleware(svc.Config)
+	e.POST("/auth", controllers.NewAuthController(svc).Auth, authRateLimitMiddleware, logMw)
+	e.POST("/auth/rotate", controllers.NewAuthController(svc).RotateCredentials, authRateLimitMiddleware, logMw)
 	if svc.Config.AllowAccountCreation {
 		e.POST("/create", controllers.NewCreateUserController(svc).CreateUser, strictRateLimitMiddleware, adminMw, logMw)
 	}
 	e.POST("/invoice/:user_login", controllers.NewInvoiceController(svc).Invoice, middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(rate.Limit(svc.Config.DefaultRateLimit))), logMw)
+	lnurlPayCtrl := controllers.NewLNURLPayController(svc)
+	lnurlRateLimiter := middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(rate.Limit(svc.Config.DefaultRateLimit)))
+	e.GET("/lnurlp/:user", lnurlPayCtrl.LNURLPay, lnurlRateLimiter, logMw)
+	e.GET("/lnurlp/:user/callback", lnurlPayCtrl.LNURLPayCallback, lnurlRateLimiter, logMw)
+	e.GET("/.well-known/lnurlpay/:username", lnurlPayCtrl.LightningAddress, lnurlRateLimiter, logMw)
+	// path used by wallets to resolve lightning addresses, see LUD-16
+	e.GET("/.well-known/lnurlp/:username", lnurlPayCtrl.LightningAddress, lnurlRateLimiter, logMw)
+	e.GET("/.well-known/lnurlp/:username/callback", lnurlPayCtrl.LightningAddressCallback, lnurlRateLimiter, logMw)
+	lnurlWithdrawCtrl := controllers.NewLNURLWithdrawController(svc)
+	e.GET("/lnurlw/:token", lnurlWithdrawCtrl.LNURLWithdraw, lnurlRateLimiter, logMw)
+	e.GET("/lnurlw/:token/callback", lnurlWithdrawCtrl.LNURLWithdrawCallback, lnurlRateLimiter, logMw)
 
 	// Secured endpoints which require a Authorization token (JWT)
-	secured.POST("/addinvoice", controllers.NewAddInvoiceController(svc).AddInvoice)
-	securedWithStrictRateLimit.POST("/payinvoice", controllers.NewPayInvoiceController(svc).PayInvoice)
+	secured.POST("/addinvoice", controllers.NewAddInvoiceController(svc).AddInvoice, tokens.RequireScope(common.ScopeInvoice))
+	securedWithStrictRateLimit.POST("/payinvoice", controllers.NewPayInvoiceController(svc).PayInvoice, tokens.RequireScope(common.ScopePay), svc.TOTPMiddleware())
 	secured.GET("/gettxs", controllers.NewGetTXSController(svc).GetTXS)
 	secured.GET("/getuserinvoices", controllers.NewGetTXSController(svc).GetUserInvoices)
 	secured.GET("/checkpayment/:payment_hash", controllers.NewCheckPaymentController(svc).CheckPayment)
 	secured.GET("/balance", controllers.NewBalanceController(svc).Balance)
 	secured.GET("/getinfo", controllers.NewGetInfoController(svc).GetInfo, createCacheClient().Middleware())
-	securedWithStrictRateLimit.POST("/keysend", controllers.NewKeySendController(svc).KeySend)
+	securedWithStrictRateLimit.POST("/keysend", controllers.NewKeySendController(svc).KeySend, tokens.RequireScope(common.ScopePay), svc.TOTPMiddleware())
+	authCtrl := controllers.NewAuthController(svc)
+	secured.POST("/auth/revoke", authCtrl.Revoke)
+	secured.POST("/auth/revoke-all", authCtrl.RevokeAll, tokens.RequireFullAccess())
 
 	// These endpoints are currently not supported and we return a blank response for backwards compatibility
 	blankController := controllers.NewBlankController(svc)
 	secured.GET("/getbtc", blankController.GetBtc)
 	secured.GET("/getpending", blankController.GetPending)
 
+	// probes for container orchestration, no Authorization required
+	healthCtrl := controllers.NewHealthController(svc)
+	e.GET("/healthz", healthCtrl.Healthz)
+	e.GET("/readyz", healthCtrl.Readyz)
+
 	//Index page endpoints, no Authorization required
 	homeController := controllers.NewHomeController(svc, indexHtml)
 	e.GET("/", homeController.Home, createCacheClient().Middleware())
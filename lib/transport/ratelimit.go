@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/getAlby/lndhub.go/lib/responses"
+	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// CreateUserRateLimitMiddleware limits the requests of authenticated users, it must be used after the authentication middleware
+func CreateUserRateLimitMiddleware(c *service.Config) echo.MiddlewareFunc {
+	return createRouteRateLimitMiddleware(service.RateLimit{Rate: c.UserRateLimit, Burst: c.UserBurstRateLimit}, c.RateLimitOverrides, userOrIpIdentifier)
+}
+
+// CreateIpRateLimitMiddleware limits the requests of every IP
+func CreateIpRateLimitMiddleware(c *service.Config) echo.MiddlewareFunc {
+	burst := int(math.Max(1, math.Ceil(float64(c.DefaultRateLimit))))
+	return createRouteRateLimitMiddleware(service.RateLimit{Rate: float64(c.DefaultRateLimit), Burst: burst}, c.RateLimitOverrides, ipIdentifier)
+}
+
+// CreateAuthRateLimitMiddleware limits the requests of every IP to the authentication endpoint, the limit is strict to slow down credential stuffing
+func CreateAuthRateLimitMiddleware(c *service.Config) echo.MiddlewareFunc {
+	return createRateLimitMiddleware(service.RateLimit{Rate: c.AuthRateLimit, Burst: c.AuthBurstRateLimit}, ipIdentifier)
+}
+
+// createRouteRateLimitMiddleware uses the overridden limit for the routes that have one and the default limit for all other routes
+func createRouteRateLimitMiddleware(defaultLimit service.RateLimit, overrides service.RateLimitOverrides, identifierExtractor middleware.Extractor) echo.MiddlewareFunc {
+	defaultMiddleware := createRateLimitMiddleware(defaultLimit, identifierExtractor)
+	routeMiddlewares := map[string]echo.MiddlewareFunc{}
+	for path, limit := range overrides {
+		routeMiddlewares[path] = createRateLimitMiddleware(limit, identifierExtractor)
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		defaultHandler := defaultMiddleware(next)
+		routeHandlers := map[string]echo.HandlerFunc{}
+		for path, routeMiddleware := range routeMiddlewares {
+			routeHandlers[path] = routeMiddleware(next)
+		}
+		return func(c echo.Context) error {
+			if handler, ok := routeHandlers[c.Path()]; ok {
+				return handler(c)
+			}
+			return defaultHandler(c)
+		}
+	}
+}
+
+// createRateLimitMiddleware limits the requests with a token bucket per identifier
+func createRateLimitMiddleware(limit service.RateLimit, identifierExtractor middleware.Extractor) echo.MiddlewareFunc {
+	// a token is added every 1/rate seconds
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(1/limit.Rate))))
+	config := middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
+			middleware.RateLimiterMemoryStoreConfig{Rate: rate.Limit(limit.Rate), Burst: limit.Burst},
+		),
+		IdentifierExtractor: identifierExtractor,
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			c.Response().Header().Set("Retry-After", retryAfter)
+			return c.JSON(http.StatusTooManyRequests, responses.RateLimitExceededError)
+		},
+	}
+	return middleware.RateLimiterWithConfig(config)
+}
+
+func userOrIpIdentifier(c echo.Context) (string, error) {
+	if userId, ok := c.Get("UserID").(int64); ok {
+		return strconv.FormatInt(userId, 10), nil
+	}
+	return c.RealIP(), nil
+}
+
+func ipIdentifier(c echo.Context) (string, error) {
+	return c.RealIP(), nil
+}
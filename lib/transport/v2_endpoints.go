@@ -1,8 +1,10 @@
 package transport
 
 import (
+	"github.com/getAlby/lndhub.go/common"
 	v2controllers "github.com/getAlby/lndhub.go/controllers_v2"
 	"github.com/getAlby/lndhub.go/lib/service"
+	"github.com/getAlby/lndhub.go/lib/tokens"
 	"github.com/labstack/echo/v4"
 )
 
@@ -15,21 +17,82 @@ func RegisterV2Endpoints(svc *service.LndhubService, e *echo.Echo, secured *echo
 	//require admin token for update user endpoint
 	if svc.Config.AdminToken != "" {
 		e.PUT("/v2/admin/users", v2controllers.NewUpdateUserController(svc).UpdateUser, strictRateLimitMiddleware, adminMw)
+		e.GET("/v2/admin/users", v2controllers.NewListUsersController(svc).ListUsers, adminMw)
+		e.GET("/v2/admin/reconcile", v2controllers.NewReconcileController(svc).Reconcile, adminMw)
+		e.POST("/v2/balances/batch", v2controllers.NewBalanceController(svc).BatchBalances, adminMw)
+		suspendUserCtrl := v2controllers.NewSuspendUserController(svc)
+		e.POST("/v2/admin/users/:id/suspend", suspendUserCtrl.SuspendUser, strictRateLimitMiddleware, adminMw)
+		e.POST("/v2/admin/users/:id/unsuspend", suspendUserCtrl.UnsuspendUser, strictRateLimitMiddleware, adminMw)
+		e.POST("/v2/admin/users/:id/adjust", v2controllers.NewAdjustBalanceController(svc).AdjustBalance, strictRateLimitMiddleware, adminMw, logMw)
+		e.POST("/v2/admin/invitecodes", v2controllers.NewInviteCodeController(svc).CreateInviteCode, strictRateLimitMiddleware, adminMw)
 	}
 	invoiceCtrl := v2controllers.NewInvoiceController(svc)
 	keysendCtrl := v2controllers.NewKeySendController(svc)
 	nostrEventCtrl := v2controllers.NewNoStrController(svc)
+	// payments of users with two-factor authentication require a totp_code
+	totpMw := svc.TOTPMiddleware()
+	// routes that change the account itself are not available to tokens limited to scopes
+	fullAccessMw := tokens.RequireFullAccess()
 
 	// add the endpoint to the group 
 	// NOSTR EVENT Request
 	validateNostrPayload.POST("/v2/event", nostrEventCtrl.AddNoStrEvent)
 
-	secured.POST("/v2/invoices", invoiceCtrl.AddInvoice)
+	secured.POST("/v2/invoices", invoiceCtrl.AddInvoice, tokens.RequireScope(common.ScopeInvoice))
+	secured.POST("/v2/invoices/batch", invoiceCtrl.AddInvoiceBatch, tokens.RequireScope(common.ScopeInvoice))
 	secured.GET("/v2/invoices/incoming", invoiceCtrl.GetIncomingInvoices)
 	secured.GET("/v2/invoices/outgoing", invoiceCtrl.GetOutgoingInvoices)
 	secured.GET("/v2/invoices/:payment_hash", invoiceCtrl.GetInvoice)
-	securedWithStrictRateLimit.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(svc).PayInvoice)
-	securedWithStrictRateLimit.POST("/v2/payments/keysend", keysendCtrl.KeySend)
-	securedWithStrictRateLimit.POST("/v2/payments/keysend/multi", keysendCtrl.MultiKeySend)
-	secured.GET("/v2/balance", v2controllers.NewBalanceController(svc).Balance)
+	secured.GET("/v2/invoices/:payment_hash/stream", invoiceCtrl.StreamInvoice)
+	secured.GET("/v2/invoices/:payment_hash/qr.png", invoiceCtrl.GetInvoiceQR)
+	secured.POST("/v2/invoices/hold", invoiceCtrl.AddHoldInvoice, tokens.RequireScope(common.ScopeInvoice))
+	secured.POST("/v2/invoices/:payment_hash/settle", invoiceCtrl.SettleHoldInvoice, tokens.RequireScope(common.ScopeInvoice))
+	secured.POST("/v2/invoices/:payment_hash/cancel", invoiceCtrl.CancelHoldInvoice, tokens.RequireScope(common.ScopeInvoice))
+	// the totp_code is checked by the handler after the idempotency key is looked up
+	securedWithStrictRateLimit.POST("/v2/payments/bolt11", v2controllers.NewPayInvoiceController(svc).PayInvoice, tokens.RequireScope(common.ScopePay))
+	securedWithStrictRateLimit.POST("/v2/payments/lnaddress", v2controllers.NewPayInvoiceController(svc).PayLightningAddress, tokens.RequireScope(common.ScopePay), totpMw)
+	// the totp_code was checked when the payment was requested
+	securedWithStrictRateLimit.POST("/v2/payments/confirm", v2controllers.NewPayInvoiceController(svc).ConfirmPayment, tokens.RequireScope(common.ScopePay))
+	secured.POST("/v2/payments/bolt11/estimate", v2controllers.NewEstimateFeeController(svc).EstimateFee)
+	secured.GET("/v2/payments/decode", v2controllers.NewDecodeInvoiceController(svc).DecodeInvoice)
+	pendingPaymentsCtrl := v2controllers.NewPendingPaymentsController(svc)
+	secured.GET("/v2/payments/pending", pendingPaymentsCtrl.PendingPayments)
+	secured.GET("/v2/payments/outgoing", pendingPaymentsCtrl.OutgoingPayments)
+	secured.POST("/v2/payments/verify", v2controllers.NewVerifyPaymentController(svc).VerifyPayment, tokens.RequireScope(common.ScopeRead))
+	secured.GET("/v2/payments/:payment_hash/route", v2controllers.NewPaymentRouteController(svc).PaymentRoute)
+	secured.POST("/v2/lnurlw", v2controllers.NewLNURLWithdrawController(svc).CreateWithdrawLink, tokens.RequireScope(common.ScopePay), totpMw)
+	securedWithStrictRateLimit.POST("/v2/payments/keysend", keysendCtrl.KeySend, tokens.RequireScope(common.ScopePay), totpMw)
+	securedWithStrictRateLimit.POST("/v2/payments/keysend/multi", keysendCtrl.MultiKeySend, tokens.RequireScope(common.ScopePay), totpMw)
+	balanceCtrl := v2controllers.NewBalanceController(svc)
+	secured.GET("/v2/balance", balanceCtrl.Balance)
+	secured.GET("/v2/getinfo", v2controllers.NewGetInfoController(svc).GetInfo)
+	secured.GET("/v2/receive-capacity", v2controllers.NewReceiveCapacityController(svc).ReceiveCapacity)
+	secured.GET("/v2/balance/history", balanceCtrl.BalanceHistory)
+	secured.GET("/v2/prices", v2controllers.NewPriceController(svc).Price)
+	secured.PUT("/v2/keysend/alias", v2controllers.NewKeysendAliasController(svc).SetKeysendAlias, fullAccessMw)
+	if svc.Config.EnableOffers {
+		secured.GET("/v2/offers", v2controllers.NewOfferController(svc).Offer, tokens.RequireScope(common.ScopeInvoice))
+		securedWithStrictRateLimit.POST("/v2/payments/bolt12", v2controllers.NewPayInvoiceController(svc).PayOffer, tokens.RequireScope(common.ScopePay), totpMw)
+	}
+	if svc.Config.EnableOnchainDeposits {
+		secured.GET("/v2/onchain/address", v2controllers.NewOnchainController(svc).Address, tokens.RequireScope(common.ScopeInvoice))
+	}
+	if svc.Config.EnableOnchainWithdrawals {
+		securedWithStrictRateLimit.POST("/v2/onchain/withdraw", v2controllers.NewOnchainController(svc).Withdraw, tokens.RequireScope(common.ScopePay), totpMw)
+	}
+	transactionsCtrl := v2controllers.NewTransactionsController(svc)
+	secured.GET("/v2/transactions", transactionsCtrl.GetTransactions)
+	secured.GET("/v2/transactions/export.csv", transactionsCtrl.ExportTransactions)
+	webhookCtrl := v2controllers.NewWebhookController(svc)
+	secured.POST("/v2/webhooks", webhookCtrl.CreateWebhook, fullAccessMw)
+	secured.GET("/v2/webhooks", webhookCtrl.ListWebhooks)
+	secured.DELETE("/v2/webhooks/:id", webhookCtrl.DeleteWebhook, fullAccessMw)
+	secured.GET("/v2/ws", v2controllers.NewStreamController(svc).StreamEvents)
+	apiKeyCtrl := v2controllers.NewApiKeyController(svc)
+	secured.POST("/v2/apikeys", apiKeyCtrl.CreateApiKey, fullAccessMw)
+	secured.GET("/v2/apikeys", apiKeyCtrl.ListApiKeys)
+	secured.DELETE("/v2/apikeys/:id", apiKeyCtrl.RevokeApiKey, fullAccessMw)
+	totpCtrl := v2controllers.NewTOTPController(svc)
+	securedWithStrictRateLimit.POST("/v2/totp/enroll", totpCtrl.Enroll, fullAccessMw)
+	securedWithStrictRateLimit.POST("/v2/totp/verify", totpCtrl.Verify, fullAccessMw)
 }
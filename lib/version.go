@@ -0,0 +1,5 @@
+package lib
+
+// Version of lndhub, it is set when building:
+// go build -ldflags "-X github.com/getAlby/lndhub.go/lib.Version=1.0.0"
+var Version = "dev"
@@ -0,0 +1,961 @@
+package lnd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"google.golang.org/grpc"
+)
+
+// the record of a keysend payment which contains the preimage, Core Lightning adds it itself
+const keysendPreimageRecord = 5482373484
+
+// error codes of the pay and keysend commands, see lightning-pay(7)
+const (
+	clnPayDestinationPermFail = 203
+	clnPayRouteNotFound       = 205
+	clnPayRouteTooExpensive   = 206
+	clnPayStoppedRetrying     = 210
+)
+
+const defaultCLNPaymentPollInterval = 5 * time.Second
+
+var errCLNHoldInvoicesNotSupported = errors.New("hold invoices are not supported by Core Lightning")
+
+var errCLNOnchainNotSupported = errors.New("on-chain deposits and withdrawals are not supported by Core Lightning")
+
+// CLNoptions are the options for the connection to the REST interface (clnrest) of a Core Lightning node.
+type CLNoptions struct {
+	// e.g. https://localhost:3010
+	Address  string
+	Rune     string
+	CertFile string
+	CertHex  string
+}
+
+// CLNWrapper talks to a Core Lightning node through clnrest and translates the calls to the lnrpc types used by the service.
+// Hold invoices, invoices with only a description hash, incoming keysend payments and on-chain deposits are not supported.
+// Bolt12 offers require the node to run with experimental-offers.
+type CLNWrapper struct {
+	client         *http.Client
+	address        string
+	rune           string
+	IdentityPubkey string
+	// interval at which the payment is looked up when tracking a pending payment
+	PaymentPollInterval time.Duration
+}
+
+func NewCLNClient(clnOptions CLNoptions) (result *CLNWrapper, err error) {
+	if clnOptions.Rune == "" {
+		return nil, errors.New("CLN rune is missing")
+	}
+	tlsConfig := &tls.Config{}
+	// the certificate of the node is either provided as a hex string, a file or in the system's certificate store
+	var cert []byte
+	if clnOptions.CertHex != "" {
+		cert, err = hex.DecodeString(clnOptions.CertHex)
+		if err != nil {
+			return nil, err
+		}
+	} else if clnOptions.CertFile != "" {
+		cert, err = os.ReadFile(clnOptions.CertFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cert != nil {
+		cp := x509.NewCertPool()
+		cp.AppendCertsFromPEM(cert)
+		tlsConfig.RootCAs = cp
+	}
+	return &CLNWrapper{
+		// no timeout, waiting for invoice payments blocks until one is paid
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		address:             strings.TrimSuffix(clnOptions.Address, "/"),
+		rune:                clnOptions.Rune,
+		PaymentPollInterval: defaultCLNPaymentPollInterval,
+	}, nil
+}
+
+// clnError is an error returned by a command of the node
+type clnError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *clnError) Error() string {
+	return fmt.Sprintf("cln error %d: %s", e.Code, e.Message)
+}
+
+// clnMsat is an amount in millisatoshi, older versions of Core Lightning encode it as a string with a msat suffix
+type clnMsat int64
+
+func (m *clnMsat) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSuffix(strings.Trim(string(data), `"`), "msat")
+	if s == "null" || s == "any" {
+		*m = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid msat amount %s", data)
+	}
+	*m = clnMsat(v)
+	return nil
+}
+
+func (wrapper *CLNWrapper) call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v1/%s", wrapper.address, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Rune", wrapper.rune)
+	resp, err := wrapper.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		rpcErr := &clnError{}
+		if err := json.NewDecoder(resp.Body).Decode(rpcErr); err != nil || rpcErr.Message == "" {
+			return fmt.Errorf("cln %s returned status %d", method, resp.StatusCode)
+		}
+		return rpcErr
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+type clnChannel struct {
+	PeerID         string  `json:"peer_id"`
+	PeerConnected  bool    `json:"peer_connected"`
+	State          string  `json:"state"`
+	ShortChannelID string  `json:"short_channel_id"`
+	FundingTxID    string  `json:"funding_txid"`
+	FundingOutnum  uint32  `json:"funding_outnum"`
+	Private        bool    `json:"private"`
+	TotalMsat      clnMsat `json:"total_msat"`
+	ToUsMsat       clnMsat `json:"to_us_msat"`
+}
+
+func (wrapper *CLNWrapper) ListChannels(ctx context.Context, req *lnrpc.ListChannelsRequest, options ...grpc.CallOption) (*lnrpc.ListChannelsResponse, error) {
+	var result struct {
+		Channels []clnChannel `json:"channels"`
+	}
+	if err := wrapper.call(ctx, "listpeerchannels", nil, &result); err != nil {
+		return nil, err
+	}
+	channels := []*lnrpc.Channel{}
+	for _, ch := range result.Channels {
+		active := ch.State == "CHANNELD_NORMAL" && ch.PeerConnected
+		if (req.ActiveOnly && !active) || (req.InactiveOnly && active) ||
+			(req.PublicOnly && ch.Private) || (req.PrivateOnly && !ch.Private) {
+			continue
+		}
+		channels = append(channels, &lnrpc.Channel{
+			Active:        active,
+			RemotePubkey:  ch.PeerID,
+			ChannelPoint:  fmt.Sprintf("%s:%d", ch.FundingTxID, ch.FundingOutnum),
+			ChanId:        parseShortChannelID(ch.ShortChannelID),
+			Capacity:      int64(ch.TotalMsat) / 1000,
+			LocalBalance:  int64(ch.ToUsMsat) / 1000,
+			RemoteBalance: int64(ch.TotalMsat-ch.ToUsMsat) / 1000,
+			Private:       ch.Private,
+		})
+	}
+	return &lnrpc.ListChannelsResponse{Channels: channels}, nil
+}
+
+// parseShortChannelID converts a short channel id like 103x1x0 to the integer used by lnd, 0 if it is not valid
+func parseShortChannelID(scid string) uint64 {
+	parts := strings.Split(scid, "x")
+	if len(parts) != 3 {
+		return 0
+	}
+	block, err := strconv.ParseUint(parts[0], 10, 24)
+	if err != nil {
+		return 0
+	}
+	tx, err := strconv.ParseUint(parts[1], 10, 24)
+	if err != nil {
+		return 0
+	}
+	output, err := strconv.ParseUint(parts[2], 10, 16)
+	if err != nil {
+		return 0
+	}
+	return block<<40 | tx<<16 | output
+}
+
+type clnPayResponse struct {
+	PaymentPreimage string  `json:"payment_preimage"`
+	PaymentHash     string  `json:"payment_hash"`
+	AmountMsat      clnMsat `json:"amount_msat"`
+	AmountSentMsat  clnMsat `json:"amount_sent_msat"`
+	Parts           int     `json:"parts"`
+	Status          string  `json:"status"`
+}
+
+// pay pays a bolt11 or a bolt12 invoice, the amount is only passed to the node for bolt11 invoices without an amount
+func (wrapper *CLNWrapper) pay(ctx context.Context, bolt11 string, amountSat, maxFeeMsat int64, retryFor int32) (*clnPayResponse, error) {
+	params := map[string]interface{}{
+		"bolt11": bolt11,
+	}
+	// bolt12 invoices always have an amount
+	if amountSat > 0 && !strings.HasPrefix(bolt11, "lni") {
+		payReq, err := wrapper.DecodeBolt11(ctx, bolt11)
+		if err != nil {
+			return nil, err
+		}
+		if payReq.NumMsat == 0 {
+			params["amount_msat"] = amountSat * 1000
+		}
+	}
+	if maxFeeMsat > 0 {
+		params["maxfee"] = maxFeeMsat
+	}
+	if retryFor > 0 {
+		params["retry_for"] = retryFor
+	}
+	result := &clnPayResponse{}
+	if err := wrapper.call(ctx, "pay", params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (wrapper *CLNWrapper) keysend(ctx context.Context, req *lnrpc.SendRequest) (*clnPayResponse, error) {
+	params := map[string]interface{}{
+		"destination": hex.EncodeToString(req.Dest),
+		"amount_msat": sendRequestAmountMsat(req),
+	}
+	if maxFeeMsat := sendRequestFeeLimitMsat(req.FeeLimit); maxFeeMsat > 0 {
+		params["maxfee"] = maxFeeMsat
+	}
+	extraTlvs := map[string]string{}
+	for record, value := range req.DestCustomRecords {
+		// the node uses its own preimage
+		if record == keysendPreimageRecord {
+			continue
+		}
+		extraTlvs[strconv.FormatUint(record, 10)] = hex.EncodeToString(value)
+	}
+	if len(extraTlvs) > 0 {
+		params["extratlvs"] = extraTlvs
+	}
+	result := &clnPayResponse{}
+	if err := wrapper.call(ctx, "keysend", params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func sendRequestAmountMsat(req *lnrpc.SendRequest) int64 {
+	if req.AmtMsat > 0 {
+		return req.AmtMsat
+	}
+	return req.Amt * 1000
+}
+
+func sendRequestFeeLimitMsat(feeLimit *lnrpc.FeeLimit) int64 {
+	if feeLimit.GetFixedMsat() > 0 {
+		return feeLimit.GetFixedMsat()
+	}
+	return feeLimit.GetFixed() * 1000
+}
+
+func (wrapper *CLNWrapper) SendPaymentSync(ctx context.Context, req *lnrpc.SendRequest, options ...grpc.CallOption) (*lnrpc.SendResponse, error) {
+	var result *clnPayResponse
+	var err error
+	if len(req.Dest) > 0 {
+		result, err = wrapper.keysend(ctx, req)
+	} else {
+		result, err = wrapper.pay(ctx, req.PaymentRequest, req.Amt, sendRequestFeeLimitMsat(req.FeeLimit), 0)
+	}
+	// like lnd, failed payments are reported in the response and not as an error
+	var rpcErr *clnError
+	if errors.As(err, &rpcErr) {
+		return &lnrpc.SendResponse{PaymentError: rpcErr.Message}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != "complete" {
+		return &lnrpc.SendResponse{PaymentError: fmt.Sprintf("payment status is %s", result.Status)}, nil
+	}
+	preimage, err := hex.DecodeString(result.PaymentPreimage)
+	if err != nil {
+		return nil, err
+	}
+	paymentHash, err := hex.DecodeString(result.PaymentHash)
+	if err != nil {
+		return nil, err
+	}
+	feeMsat := int64(result.AmountSentMsat - result.AmountMsat)
+	return &lnrpc.SendResponse{
+		PaymentPreimage: preimage,
+		PaymentHash:     paymentHash,
+		PaymentRoute: &lnrpc.Route{
+			TotalAmt:      int64(result.AmountSentMsat) / 1000,
+			TotalAmtMsat:  int64(result.AmountSentMsat),
+			TotalFees:     feeMsat / 1000,
+			TotalFeesMsat: feeMsat,
+		},
+	}, nil
+}
+
+// clnPaymentStream returns the final state of a payment, the node doesn't stream in-flight updates
+type clnPaymentStream struct {
+	next func() (*lnrpc.Payment, error)
+	done bool
+}
+
+func (stream *clnPaymentStream) Recv() (*lnrpc.Payment, error) {
+	if stream.done {
+		return nil, io.EOF
+	}
+	payment, err := stream.next()
+	if err != nil {
+		return nil, err
+	}
+	stream.done = true
+	return payment, nil
+}
+
+func (wrapper *CLNWrapper) SendPaymentV2(ctx context.Context, req *routerrpc.SendPaymentRequest, options ...grpc.CallOption) (SubscribePaymentWrapper, error) {
+	// the node splits payments into multiple parts on its own
+	maxFeeMsat := req.FeeLimitMsat
+	if maxFeeMsat == 0 {
+		maxFeeMsat = req.FeeLimitSat * 1000
+	}
+	return &clnPaymentStream{next: func() (*lnrpc.Payment, error) {
+		result, err := wrapper.pay(ctx, req.PaymentRequest, req.Amt, maxFeeMsat, req.TimeoutSeconds)
+		var rpcErr *clnError
+		if errors.As(err, &rpcErr) {
+			return &lnrpc.Payment{
+				Status:        lnrpc.Payment_FAILED,
+				FailureReason: clnPaymentFailureReason(rpcErr.Code),
+			}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return clnPayment(result.PaymentHash, result.PaymentPreimage, result.AmountMsat, result.AmountSentMsat, result.Parts), nil
+	}}, nil
+}
+
+func clnPaymentFailureReason(code int) lnrpc.PaymentFailureReason {
+	switch code {
+	case clnPayDestinationPermFail:
+		return lnrpc.PaymentFailureReason_FAILURE_REASON_INCORRECT_PAYMENT_DETAILS
+	case clnPayRouteNotFound, clnPayRouteTooExpensive:
+		return lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE
+	case clnPayStoppedRetrying:
+		return lnrpc.PaymentFailureReason_FAILURE_REASON_TIMEOUT
+	default:
+		return lnrpc.PaymentFailureReason_FAILURE_REASON_ERROR
+	}
+}
+
+func clnPayment(paymentHash, preimage string, amountMsat, amountSentMsat clnMsat, parts int) *lnrpc.Payment {
+	feeMsat := int64(amountSentMsat - amountMsat)
+	if parts == 0 {
+		parts = 1
+	}
+	htlcs := make([]*lnrpc.HTLCAttempt, parts)
+	for i := range htlcs {
+		htlcs[i] = &lnrpc.HTLCAttempt{Status: lnrpc.HTLCAttempt_SUCCEEDED}
+	}
+	return &lnrpc.Payment{
+		PaymentHash:     paymentHash,
+		PaymentPreimage: preimage,
+		Status:          lnrpc.Payment_SUCCEEDED,
+		ValueSat:        int64(amountMsat) / 1000,
+		ValueMsat:       int64(amountMsat),
+		FeeSat:          feeMsat / 1000,
+		FeeMsat:         feeMsat,
+		Htlcs:           htlcs,
+	}
+}
+
+type clnInvoice struct {
+	Label              string  `json:"label"`
+	Bolt11             string  `json:"bolt11"`
+	Bolt12             string  `json:"bolt12"`
+	PaymentHash        string  `json:"payment_hash"`
+	Status             string  `json:"status"`
+	Description        string  `json:"description"`
+	AmountMsat         clnMsat `json:"amount_msat"`
+	AmountReceivedMsat clnMsat `json:"amount_received_msat"`
+	PaidAt             int64   `json:"paid_at"`
+	PaymentPreimage    string  `json:"payment_preimage"`
+	ExpiresAt          int64   `json:"expires_at"`
+	CreatedIndex       uint64  `json:"created_index"`
+	PayIndex           uint64  `json:"pay_index"`
+	// set for the invoices the node created for the invoice requests of our offers
+	LocalOfferID string `json:"local_offer_id"`
+}
+
+func (inv *clnInvoice) toLnrpcInvoice() (*lnrpc.Invoice, error) {
+	rHash, err := hex.DecodeString(inv.PaymentHash)
+	if err != nil {
+		return nil, err
+	}
+	preimage, err := hex.DecodeString(inv.PaymentPreimage)
+	if err != nil {
+		return nil, err
+	}
+	paymentRequest := inv.Bolt11
+	if paymentRequest == "" {
+		paymentRequest = inv.Bolt12
+	}
+	state := lnrpc.Invoice_OPEN
+	switch inv.Status {
+	case "paid":
+		state = lnrpc.Invoice_SETTLED
+	case "expired":
+		state = lnrpc.Invoice_CANCELED
+	}
+	return &lnrpc.Invoice{
+		Memo:           inv.Description,
+		RPreimage:      preimage,
+		RHash:          rHash,
+		Value:          int64(inv.AmountMsat) / 1000,
+		ValueMsat:      int64(inv.AmountMsat),
+		Settled:        state == lnrpc.Invoice_SETTLED,
+		SettleDate:     inv.PaidAt,
+		PaymentRequest: paymentRequest,
+		AddIndex:       inv.CreatedIndex,
+		SettleIndex:    inv.PayIndex,
+		AmtPaidSat:     int64(inv.AmountReceivedMsat) / 1000,
+		AmtPaidMsat:    int64(inv.AmountReceivedMsat),
+		State:          state,
+	}, nil
+}
+
+func (wrapper *CLNWrapper) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	// the node needs the full description to commit to its hash
+	if len(req.DescriptionHash) > 0 {
+		return nil, errors.New("invoices with a description hash are not supported by Core Lightning")
+	}
+	// labels must be unique, the payment hash is unique as well
+	label, err := clnInvoiceLabel(req.RPreimage)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{
+		"amount_msat": "any",
+		"label":       label,
+		"description": req.Memo,
+	}
+	if req.ValueMsat > 0 {
+		params["amount_msat"] = req.ValueMsat
+	} else if req.Value > 0 {
+		params["amount_msat"] = req.Value * 1000
+	}
+	if req.Expiry > 0 {
+		params["expiry"] = req.Expiry
+	}
+	if len(req.RPreimage) > 0 {
+		params["preimage"] = hex.EncodeToString(req.RPreimage)
+	}
+	// without it Core Lightning only adds hints for private channels if the node has no public channels
+	params["exposeprivatechannels"] = req.Private
+	var result struct {
+		PaymentHash   string `json:"payment_hash"`
+		PaymentSecret string `json:"payment_secret"`
+		Bolt11        string `json:"bolt11"`
+		CreatedIndex  uint64 `json:"created_index"`
+	}
+	if err := wrapper.call(ctx, "invoice", params, &result); err != nil {
+		return nil, err
+	}
+	rHash, err := hex.DecodeString(result.PaymentHash)
+	if err != nil {
+		return nil, err
+	}
+	paymentAddr, err := hex.DecodeString(result.PaymentSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &lnrpc.AddInvoiceResponse{
+		RHash:          rHash,
+		PaymentRequest: result.Bolt11,
+		AddIndex:       result.CreatedIndex,
+		PaymentAddr:    paymentAddr,
+	}, nil
+}
+
+func clnInvoiceLabel(preimage []byte) (string, error) {
+	if len(preimage) > 0 {
+		hash := sha256.Sum256(preimage)
+		return "lndhub-" + hex.EncodeToString(hash[:]), nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "lndhub-" + hex.EncodeToString(b), nil
+}
+
+func (wrapper *CLNWrapper) AddHoldInvoice(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest, options ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	return nil, errCLNHoldInvoicesNotSupported
+}
+
+func (wrapper *CLNWrapper) SettleInvoice(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error) {
+	return nil, errCLNHoldInvoicesNotSupported
+}
+
+func (wrapper *CLNWrapper) CancelInvoice(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error) {
+	return nil, errCLNHoldInvoicesNotSupported
+}
+
+// clnInvoiceSubscription first returns the paid invoices created after the add index of the subscription
+// and then waits for the next paid invoices.
+type clnInvoiceSubscription struct {
+	ctx          context.Context
+	wrapper      *CLNWrapper
+	addIndex     uint64
+	started      bool
+	pending      []*lnrpc.Invoice
+	lastPayIndex uint64
+}
+
+func (wrapper *CLNWrapper) SubscribeInvoices(ctx context.Context, req *lnrpc.InvoiceSubscription, options ...grpc.CallOption) (SubscribeInvoicesWrapper, error) {
+	return &clnInvoiceSubscription{
+		ctx:      ctx,
+		wrapper:  wrapper,
+		addIndex: req.AddIndex,
+	}, nil
+}
+
+func (sub *clnInvoiceSubscription) Recv() (*lnrpc.Invoice, error) {
+	if !sub.started {
+		if err := sub.catchUp(); err != nil {
+			return nil, err
+		}
+		sub.started = true
+	}
+	if len(sub.pending) > 0 {
+		invoice := sub.pending[0]
+		sub.pending = sub.pending[1:]
+		return invoice, nil
+	}
+	var result clnInvoice
+	err := sub.wrapper.call(sub.ctx, "waitanyinvoice", map[string]interface{}{"lastpay_index": sub.lastPayIndex}, &result)
+	if err != nil {
+		return nil, err
+	}
+	sub.lastPayIndex = result.PayIndex
+	return result.toLnrpcInvoice()
+}
+
+// catchUp collects the invoices which were paid while the subscription was not running
+func (sub *clnInvoiceSubscription) catchUp() error {
+	var result struct {
+		Invoices []clnInvoice `json:"invoices"`
+	}
+	if err := sub.wrapper.call(sub.ctx, "listinvoices", nil, &result); err != nil {
+		return err
+	}
+	paid := []clnInvoice{}
+	for _, inv := range result.Invoices {
+		if inv.PayIndex > sub.lastPayIndex {
+			sub.lastPayIndex = inv.PayIndex
+		}
+		if inv.Status == "paid" && inv.CreatedIndex > sub.addIndex {
+			paid = append(paid, inv)
+		}
+	}
+	sort.Slice(paid, func(i, j int) bool { return paid[i].PayIndex < paid[j].PayIndex })
+	for _, inv := range paid {
+		invoice, err := inv.toLnrpcInvoice()
+		if err != nil {
+			return err
+		}
+		sub.pending = append(sub.pending, invoice)
+	}
+	return nil
+}
+
+// CreateOffer creates a reusable bolt12 offer, every invoice request of a payer gets its own invoice
+func (wrapper *CLNWrapper) CreateOffer(ctx context.Context, req *OfferRequest) (*Offer, error) {
+	params := map[string]interface{}{
+		"amount":      "any",
+		"description": req.Description,
+	}
+	if req.AmountMsat > 0 {
+		params["amount"] = fmt.Sprintf("%dmsat", req.AmountMsat)
+	}
+	var result struct {
+		OfferID string `json:"offer_id"`
+		Bolt12  string `json:"bolt12"`
+	}
+	if err := wrapper.call(ctx, "offer", params, &result); err != nil {
+		return nil, err
+	}
+	return &Offer{OfferID: result.OfferID, Bolt12: result.Bolt12}, nil
+}
+
+// LookupInvoiceOffer returns the id of the offer the invoice was created for, it is empty for other invoices
+func (wrapper *CLNWrapper) LookupInvoiceOffer(ctx context.Context, rHash []byte) (offerId string, err error) {
+	var result struct {
+		Invoices []clnInvoice `json:"invoices"`
+	}
+	if err := wrapper.call(ctx, "listinvoices", map[string]interface{}{"payment_hash": hex.EncodeToString(rHash)}, &result); err != nil {
+		return "", err
+	}
+	if len(result.Invoices) == 0 {
+		return "", fmt.Errorf("invoice %x not found", rHash)
+	}
+	return result.Invoices[0].LocalOfferID, nil
+}
+
+// the expiry of bolt12 invoices without an explicit expiry, see BOLT 12
+const defaultBolt12InvoiceExpiry = 7200
+
+// FetchOfferInvoice requests an invoice from the issuer of the offer. Offers with an amount are paid with that amount,
+// for offers without an amount the amount has to be given.
+func (wrapper *CLNWrapper) FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*OfferInvoice, error) {
+	var decodedOffer struct {
+		Type            string   `json:"type"`
+		Valid           bool     `json:"valid"`
+		OfferAmountMsat *clnMsat `json:"offer_amount_msat"`
+	}
+	if err := wrapper.call(ctx, "decode", map[string]interface{}{"string": offer}, &decodedOffer); err != nil {
+		return nil, err
+	}
+	if !decodedOffer.Valid || decodedOffer.Type != "bolt12 offer" {
+		return nil, fmt.Errorf("invalid bolt12 offer")
+	}
+	params := map[string]interface{}{
+		"offer": offer,
+	}
+	if decodedOffer.OfferAmountMsat != nil {
+		if amountMsat > 0 && amountMsat != int64(*decodedOffer.OfferAmountMsat) {
+			return nil, ErrOfferAmountMismatch
+		}
+	} else {
+		if amountMsat <= 0 {
+			return nil, ErrOfferAmountRequired
+		}
+		params["amount_msat"] = amountMsat
+	}
+	var fetched struct {
+		Invoice string `json:"invoice"`
+	}
+	if err := wrapper.call(ctx, "fetchinvoice", params, &fetched); err != nil {
+		return nil, err
+	}
+
+	var decodedInvoice struct {
+		Type             string  `json:"type"`
+		Valid            bool    `json:"valid"`
+		NodeID           string  `json:"invoice_node_id"`
+		PaymentHash      string  `json:"invoice_payment_hash"`
+		AmountMsat       clnMsat `json:"invoice_amount_msat"`
+		CreatedAt        int64   `json:"invoice_created_at"`
+		RelativeExpiry   int64   `json:"invoice_relative_expiry"`
+		OfferDescription string  `json:"offer_description"`
+	}
+	if err := wrapper.call(ctx, "decode", map[string]interface{}{"string": fetched.Invoice}, &decodedInvoice); err != nil {
+		return nil, err
+	}
+	if !decodedInvoice.Valid || decodedInvoice.Type != "bolt12 invoice" {
+		return nil, fmt.Errorf("invalid bolt12 invoice")
+	}
+	expiry := decodedInvoice.RelativeExpiry
+	if expiry == 0 {
+		expiry = defaultBolt12InvoiceExpiry
+	}
+	return &OfferInvoice{
+		PaymentRequest: fetched.Invoice,
+		PayReq: &lnrpc.PayReq{
+			Destination: decodedInvoice.NodeID,
+			PaymentHash: decodedInvoice.PaymentHash,
+			NumSatoshis: int64(decodedInvoice.AmountMsat) / 1000,
+			NumMsat:     int64(decodedInvoice.AmountMsat),
+			Timestamp:   decodedInvoice.CreatedAt,
+			Expiry:      expiry,
+			Description: decodedInvoice.OfferDescription,
+		},
+	}, nil
+}
+
+type clnPay struct {
+	PaymentHash    string  `json:"payment_hash"`
+	Status         string  `json:"status"`
+	Preimage       string  `json:"preimage"`
+	AmountMsat     clnMsat `json:"amount_msat"`
+	AmountSentMsat clnMsat `json:"amount_sent_msat"`
+	NumberOfParts  int     `json:"number_of_parts"`
+}
+
+// SubscribePayment polls the payment until it reached a final state, in-flight updates are never returned
+func (wrapper *CLNWrapper) SubscribePayment(ctx context.Context, req *routerrpc.TrackPaymentRequest, options ...grpc.CallOption) (SubscribePaymentWrapper, error) {
+	paymentHash := hex.EncodeToString(req.PaymentHash)
+	return &clnPaymentStream{next: func() (*lnrpc.Payment, error) {
+		for {
+			var result struct {
+				Pays []clnPay `json:"pays"`
+			}
+			if err := wrapper.call(ctx, "listpays", map[string]interface{}{"payment_hash": paymentHash}, &result); err != nil {
+				return nil, err
+			}
+			if len(result.Pays) == 0 {
+				return nil, fmt.Errorf("payment %s not found", paymentHash)
+			}
+			// failed attempts might have been retried
+			pending := false
+			for _, pay := range result.Pays {
+				if pay.Status == "complete" {
+					return clnPayment(pay.PaymentHash, pay.Preimage, pay.AmountMsat, pay.AmountSentMsat, pay.NumberOfParts), nil
+				}
+				if pay.Status == "pending" {
+					pending = true
+				}
+			}
+			if !pending {
+				return &lnrpc.Payment{
+					PaymentHash:   paymentHash,
+					Status:        lnrpc.Payment_FAILED,
+					FailureReason: lnrpc.PaymentFailureReason_FAILURE_REASON_ERROR,
+				}, nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wrapper.PaymentPollInterval):
+			}
+		}
+	}}, nil
+}
+
+func (wrapper *CLNWrapper) GetInfo(ctx context.Context, req *lnrpc.GetInfoRequest, options ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	var result struct {
+		ID                   string `json:"id"`
+		Alias                string `json:"alias"`
+		Color                string `json:"color"`
+		NumPeers             uint32 `json:"num_peers"`
+		NumPendingChannels   uint32 `json:"num_pending_channels"`
+		NumActiveChannels    uint32 `json:"num_active_channels"`
+		NumInactiveChannels  uint32 `json:"num_inactive_channels"`
+		Version              string `json:"version"`
+		Blockheight          uint32 `json:"blockheight"`
+		Network              string `json:"network"`
+		WarningBitcoindSync  string `json:"warning_bitcoind_sync"`
+		WarningLightningSync string `json:"warning_lightningd_sync"`
+		Address              []struct {
+			Type    string `json:"type"`
+			Address string `json:"address"`
+			Port    int    `json:"port"`
+		} `json:"address"`
+	}
+	if err := wrapper.call(ctx, "getinfo", nil, &result); err != nil {
+		return nil, err
+	}
+	network := result.Network
+	// lnd calls the main network mainnet
+	if network == "bitcoin" {
+		network = "mainnet"
+	}
+	uris := []string{}
+	for _, address := range result.Address {
+		uris = append(uris, fmt.Sprintf("%s@%s:%d", result.ID, address.Address, address.Port))
+	}
+	return &lnrpc.GetInfoResponse{
+		Version:             result.Version,
+		IdentityPubkey:      result.ID,
+		Alias:               result.Alias,
+		Color:               "#" + result.Color,
+		NumPendingChannels:  result.NumPendingChannels,
+		NumActiveChannels:   result.NumActiveChannels,
+		NumInactiveChannels: result.NumInactiveChannels,
+		NumPeers:            result.NumPeers,
+		BlockHeight:         result.Blockheight,
+		SyncedToChain:       result.WarningBitcoindSync == "",
+		SyncedToGraph:       result.WarningLightningSync == "",
+		Testnet:             network == "testnet",
+		Chains: []*lnrpc.Chain{{
+			Chain:   "bitcoin",
+			Network: network,
+		}},
+		Uris: uris,
+	}, nil
+}
+
+func (wrapper *CLNWrapper) ChannelBalance(ctx context.Context, req *lnrpc.ChannelBalanceRequest, options ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error) {
+	var result struct {
+		Channels []struct {
+			State         string  `json:"state"`
+			OurAmountMsat clnMsat `json:"our_amount_msat"`
+		} `json:"channels"`
+	}
+	if err := wrapper.call(ctx, "listfunds", nil, &result); err != nil {
+		return nil, err
+	}
+	var localMsat, pendingOpenMsat int64
+	for _, ch := range result.Channels {
+		switch ch.State {
+		case "CHANNELD_NORMAL":
+			localMsat += int64(ch.OurAmountMsat)
+		case "CHANNELD_AWAITING_LOCKIN", "DUALOPEND_AWAITING_LOCKIN":
+			pendingOpenMsat += int64(ch.OurAmountMsat)
+		}
+	}
+	return &lnrpc.ChannelBalanceResponse{
+		Balance:                 localMsat / 1000,
+		PendingOpenBalance:      pendingOpenMsat / 1000,
+		LocalBalance:            &lnrpc.Amount{Sat: uint64(localMsat / 1000), Msat: uint64(localMsat)},
+		PendingOpenLocalBalance: &lnrpc.Amount{Sat: uint64(pendingOpenMsat / 1000), Msat: uint64(pendingOpenMsat)},
+	}, nil
+}
+
+func (wrapper *CLNWrapper) WalletBalance(ctx context.Context, req *lnrpc.WalletBalanceRequest, options ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
+	var result struct {
+		Outputs []struct {
+			AmountMsat clnMsat `json:"amount_msat"`
+			Status     string  `json:"status"`
+			Reserved   bool    `json:"reserved"`
+		} `json:"outputs"`
+	}
+	if err := wrapper.call(ctx, "listfunds", nil, &result); err != nil {
+		return nil, err
+	}
+	resp := &lnrpc.WalletBalanceResponse{}
+	for _, output := range result.Outputs {
+		amount := int64(output.AmountMsat) / 1000
+		switch output.Status {
+		case "confirmed":
+			resp.ConfirmedBalance += amount
+		case "unconfirmed":
+			resp.UnconfirmedBalance += amount
+		default:
+			continue
+		}
+		if output.Reserved {
+			resp.LockedBalance += amount
+		}
+	}
+	resp.TotalBalance = resp.ConfirmedBalance + resp.UnconfirmedBalance
+	return resp, nil
+}
+
+func (wrapper *CLNWrapper) EstimateRouteFee(ctx context.Context, req *routerrpc.RouteFeeRequest, options ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	amountMsat := req.AmtSat * 1000
+	var result struct {
+		Route []struct {
+			AmountMsat clnMsat `json:"amount_msat"`
+			Delay      int64   `json:"delay"`
+		} `json:"route"`
+	}
+	err := wrapper.call(ctx, "getroute", map[string]interface{}{
+		"id":          hex.EncodeToString(req.Dest),
+		"amount_msat": amountMsat,
+		"riskfactor":  1,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Route) == 0 {
+		return nil, fmt.Errorf("no route found to %x", req.Dest)
+	}
+	// the amount of the first hop includes the fees of all hops
+	return &routerrpc.RouteFeeResponse{
+		RoutingFeeMsat: int64(result.Route[0].AmountMsat) - amountMsat,
+		TimeLockDelay:  result.Route[0].Delay,
+	}, nil
+}
+
+func (wrapper *CLNWrapper) DecodeBolt11(ctx context.Context, bolt11 string, options ...grpc.CallOption) (*lnrpc.PayReq, error) {
+	var result struct {
+		Type               string  `json:"type"`
+		Valid              bool    `json:"valid"`
+		Payee              string  `json:"payee"`
+		PaymentHash        string  `json:"payment_hash"`
+		AmountMsat         clnMsat `json:"amount_msat"`
+		CreatedAt          int64   `json:"created_at"`
+		Expiry             int64   `json:"expiry"`
+		Description        string  `json:"description"`
+		DescriptionHash    string  `json:"description_hash"`
+		MinFinalCltvExpiry int64   `json:"min_final_cltv_expiry"`
+		PaymentSecret      string  `json:"payment_secret"`
+	}
+	if err := wrapper.call(ctx, "decode", map[string]interface{}{"string": bolt11}, &result); err != nil {
+		return nil, err
+	}
+	if !result.Valid || !strings.HasPrefix(result.Type, "bolt11") {
+		return nil, fmt.Errorf("invalid bolt11 invoice")
+	}
+	paymentAddr, err := hex.DecodeString(result.PaymentSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &lnrpc.PayReq{
+		Destination:     result.Payee,
+		PaymentHash:     result.PaymentHash,
+		NumSatoshis:     int64(result.AmountMsat) / 1000,
+		NumMsat:         int64(result.AmountMsat),
+		Timestamp:       result.CreatedAt,
+		Expiry:          result.Expiry,
+		Description:     result.Description,
+		DescriptionHash: result.DescriptionHash,
+		CltvExpiry:      result.MinFinalCltvExpiry,
+		PaymentAddr:     paymentAddr,
+	}, nil
+}
+
+func (wrapper *CLNWrapper) NewAddress(ctx context.Context, req *lnrpc.NewAddressRequest, options ...grpc.CallOption) (*lnrpc.NewAddressResponse, error) {
+	return nil, errCLNOnchainNotSupported
+}
+
+func (wrapper *CLNWrapper) GetTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (*lnrpc.TransactionDetails, error) {
+	return nil, errCLNOnchainNotSupported
+}
+
+func (wrapper *CLNWrapper) SubscribeTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (SubscribeTransactionsWrapper, error) {
+	return nil, errCLNOnchainNotSupported
+}
+
+func (wrapper *CLNWrapper) EstimateFee(ctx context.Context, req *lnrpc.EstimateFeeRequest, options ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
+	return nil, errCLNOnchainNotSupported
+}
+
+func (wrapper *CLNWrapper) SendCoins(ctx context.Context, req *lnrpc.SendCoinsRequest, options ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
+	return nil, errCLNOnchainNotSupported
+}
+
+func (wrapper *CLNWrapper) IsIdentityPubkey(pubkey string) (isOurPubkey bool) {
+	return pubkey == wrapper.IdentityPubkey
+}
+
+func (wrapper *CLNWrapper) GetMainPubkey() (pubkey string) {
+	return wrapper.IdentityPubkey
+}
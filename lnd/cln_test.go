@@ -0,0 +1,362 @@
+package lnd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ LightningClientWrapper = (*CLNWrapper)(nil)
+
+const testRune = "test-rune"
+
+// mockCLN answers the clnrest calls with the handler of the called method
+type mockCLN struct {
+	t        *testing.T
+	handlers map[string]func(params map[string]interface{}) (int, interface{})
+	calls    map[string][]map[string]interface{}
+}
+
+func newMockCLN(t *testing.T) (*mockCLN, *CLNWrapper) {
+	mock := &mockCLN{
+		t:        t,
+		handlers: map[string]func(params map[string]interface{}) (int, interface{}){},
+		calls:    map[string][]map[string]interface{}{},
+	}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	client, err := NewCLNClient(CLNoptions{Address: server.URL, Rune: testRune})
+	assert.NoError(t, err)
+	client.PaymentPollInterval = time.Millisecond
+	return mock, client
+}
+
+func (mock *mockCLN) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(mock.t, testRune, r.Header.Get("Rune"))
+	method := strings.TrimPrefix(r.URL.Path, "/v1/")
+	params := map[string]interface{}{}
+	assert.NoError(mock.t, json.NewDecoder(r.Body).Decode(&params))
+	mock.calls[method] = append(mock.calls[method], params)
+	handler, ok := mock.handlers[method]
+	if !ok {
+		mock.t.Errorf("unexpected call of %s", method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	status, response := handler(params)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (mock *mockCLN) handle(method string, status int, response interface{}) {
+	mock.handlers[method] = func(params map[string]interface{}) (int, interface{}) {
+		return status, response
+	}
+}
+
+func TestCLNAddInvoice(t *testing.T) {
+	mock, client := newMockCLN(t)
+	preimage := make([]byte, 32)
+	paymentHash := sha256.Sum256(preimage)
+	mock.handle("invoice", http.StatusCreated, map[string]interface{}{
+		"payment_hash":   hex.EncodeToString(paymentHash[:]),
+		"payment_secret": "aa",
+		"bolt11":         "lnbcrt10u1test",
+		"created_index":  7,
+	})
+	resp, err := client.AddInvoice(context.Background(), &lnrpc.Invoice{
+		Memo:      "test",
+		ValueMsat: 1000000,
+		RPreimage: preimage,
+		Expiry:    3600,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, paymentHash[:], resp.RHash)
+	assert.Equal(t, "lnbcrt10u1test", resp.PaymentRequest)
+	assert.Equal(t, uint64(7), resp.AddIndex)
+
+	params := mock.calls["invoice"][0]
+	assert.Equal(t, float64(1000000), params["amount_msat"])
+	assert.Equal(t, hex.EncodeToString(preimage), params["preimage"])
+	assert.Equal(t, "lndhub-"+hex.EncodeToString(paymentHash[:]), params["label"])
+	assert.Equal(t, float64(3600), params["expiry"])
+	assert.Equal(t, false, params["exposeprivatechannels"])
+
+	_, err = client.AddInvoice(context.Background(), &lnrpc.Invoice{RPreimage: preimage, Private: true})
+	assert.NoError(t, err)
+	assert.Equal(t, true, mock.calls["invoice"][1]["exposeprivatechannels"])
+
+	// the node can't create an invoice for a description it doesn't know
+	_, err = client.AddInvoice(context.Background(), &lnrpc.Invoice{DescriptionHash: paymentHash[:]})
+	assert.Error(t, err)
+}
+
+func TestCLNSendPaymentSync(t *testing.T) {
+	mock, client := newMockCLN(t)
+	mock.handle("decode", http.StatusCreated, map[string]interface{}{
+		"type":         "bolt11 invoice",
+		"valid":        true,
+		"payee":        "02abc",
+		"payment_hash": "00",
+		// older versions encode amounts as strings
+		"amount_msat": "5000000msat",
+	})
+	mock.handle("pay", http.StatusCreated, map[string]interface{}{
+		"payment_preimage": "01",
+		"payment_hash":     "02",
+		"amount_msat":      5000000,
+		"amount_sent_msat": 5003000,
+		"parts":            1,
+		"status":           "complete",
+	})
+	resp, err := client.SendPaymentSync(context.Background(), &lnrpc.SendRequest{
+		PaymentRequest: "lnbcrt50u1test",
+		Amt:            5000,
+		FeeLimit:       &lnrpc.FeeLimit{Limit: &lnrpc.FeeLimit_Fixed{Fixed: 10}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, resp.PaymentError)
+	assert.Equal(t, []byte{1}, resp.PaymentPreimage)
+	assert.Equal(t, []byte{2}, resp.PaymentHash)
+	assert.Equal(t, int64(5003), resp.PaymentRoute.TotalAmt)
+	assert.Equal(t, int64(3), resp.PaymentRoute.TotalFees)
+
+	params := mock.calls["pay"][0]
+	assert.Equal(t, "lnbcrt50u1test", params["bolt11"])
+	assert.Equal(t, float64(10000), params["maxfee"])
+	// the invoice has an amount, so it must not be passed
+	assert.NotContains(t, params, "amount_msat")
+
+	// failed payments are reported in the response
+	mock.handle("pay", http.StatusInternalServerError, map[string]interface{}{
+		"code":    205,
+		"message": "Ran out of routes to try",
+	})
+	resp, err = client.SendPaymentSync(context.Background(), &lnrpc.SendRequest{PaymentRequest: "lnbcrt50u1test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Ran out of routes to try", resp.PaymentError)
+}
+
+func TestCLNKeysend(t *testing.T) {
+	mock, client := newMockCLN(t)
+	mock.handle("keysend", http.StatusCreated, map[string]interface{}{
+		"payment_preimage": "01",
+		"payment_hash":     "02",
+		"amount_msat":      1000,
+		"amount_sent_msat": 1000,
+		"status":           "complete",
+	})
+	_, err := client.SendPaymentSync(context.Background(), &lnrpc.SendRequest{
+		Dest: []byte{3},
+		Amt:  1,
+		DestCustomRecords: map[uint64][]byte{
+			keysendPreimageRecord: {1},
+			696969:                []byte("login"),
+		},
+	})
+	assert.NoError(t, err)
+	params := mock.calls["keysend"][0]
+	assert.Equal(t, "03", params["destination"])
+	assert.Equal(t, float64(1000), params["amount_msat"])
+	// the node adds its own preimage
+	assert.Equal(t, map[string]interface{}{"696969": hex.EncodeToString([]byte("login"))}, params["extratlvs"])
+}
+
+func TestCLNSendPaymentV2Failure(t *testing.T) {
+	mock, client := newMockCLN(t)
+	mock.handle("pay", http.StatusInternalServerError, map[string]interface{}{
+		"code":    205,
+		"message": "Ran out of routes to try",
+	})
+	stream, err := client.SendPaymentV2(context.Background(), &routerrpc.SendPaymentRequest{
+		PaymentRequest: "lnbcrt50u1test",
+		FeeLimitSat:    10,
+		TimeoutSeconds: 60,
+	})
+	assert.NoError(t, err)
+	payment, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, lnrpc.Payment_FAILED, payment.Status)
+	assert.Equal(t, lnrpc.PaymentFailureReason_FAILURE_REASON_NO_ROUTE, payment.FailureReason)
+	assert.Equal(t, float64(60), mock.calls["pay"][0]["retry_for"])
+}
+
+func TestCLNSubscribeInvoices(t *testing.T) {
+	mock, client := newMockCLN(t)
+	mock.handle("listinvoices", http.StatusCreated, map[string]interface{}{
+		"invoices": []map[string]interface{}{
+			// paid before the invoice the subscription starts at
+			{"payment_hash": "01", "status": "paid", "created_index": 1, "pay_index": 1, "amount_received_msat": 1000},
+			{"payment_hash": "04", "status": "paid", "created_index": 4, "pay_index": 3, "amount_received_msat": 4000},
+			{"payment_hash": "03", "status": "paid", "created_index": 3, "pay_index": 2, "amount_received_msat": 3000},
+			{"payment_hash": "05", "status": "unpaid", "created_index": 5},
+		},
+	})
+	mock.handle("waitanyinvoice", http.StatusCreated, map[string]interface{}{
+		"payment_hash": "05", "status": "paid", "created_index": 5, "pay_index": 4, "amount_received_msat": 5000, "paid_at": 1700000000,
+	})
+	sub, err := client.SubscribeInvoices(context.Background(), &lnrpc.InvoiceSubscription{AddIndex: 2})
+	assert.NoError(t, err)
+
+	// the invoices paid while the subscription was not running come first, in the order they were paid
+	for _, expected := range []struct {
+		hash   byte
+		amount int64
+	}{{3, 3}, {4, 4}, {5, 5}} {
+		invoice, err := sub.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{expected.hash}, invoice.RHash)
+		assert.Equal(t, expected.amount, invoice.AmtPaidSat)
+		assert.True(t, invoice.Settled)
+		assert.Equal(t, lnrpc.Invoice_SETTLED, invoice.State)
+	}
+	assert.Equal(t, float64(3), mock.calls["waitanyinvoice"][0]["lastpay_index"])
+
+	_, err = sub.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), mock.calls["waitanyinvoice"][1]["lastpay_index"])
+}
+
+func TestCLNCreateOffer(t *testing.T) {
+	mock, client := newMockCLN(t)
+	mock.handle("offer", http.StatusCreated, map[string]interface{}{
+		"offer_id": "aa", "active": true, "single_use": false, "bolt12": "lno1test", "used": false, "created": true,
+	})
+	offer, err := client.CreateOffer(context.Background(), &OfferRequest{Description: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "aa", offer.OfferID)
+	assert.Equal(t, "lno1test", offer.Bolt12)
+	assert.Equal(t, "any", mock.calls["offer"][0]["amount"])
+	assert.Equal(t, "test", mock.calls["offer"][0]["description"])
+
+	_, err = client.CreateOffer(context.Background(), &OfferRequest{AmountMsat: 21000, Description: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "21000msat", mock.calls["offer"][1]["amount"])
+}
+
+func TestCLNLookupInvoiceOffer(t *testing.T) {
+	mock, client := newMockCLN(t)
+	mock.handle("listinvoices", http.StatusCreated, map[string]interface{}{
+		"invoices": []map[string]interface{}{
+			{"payment_hash": "0102", "status": "paid", "bolt12": "lni1test", "local_offer_id": "aa"},
+		},
+	})
+	offerId, err := client.LookupInvoiceOffer(context.Background(), []byte{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "aa", offerId)
+	assert.Equal(t, "0102", mock.calls["listinvoices"][0]["payment_hash"])
+
+	mock.handle("listinvoices", http.StatusCreated, map[string]interface{}{"invoices": []map[string]interface{}{}})
+	_, err = client.LookupInvoiceOffer(context.Background(), []byte{1, 2})
+	assert.Error(t, err)
+}
+
+func TestCLNFetchOfferInvoice(t *testing.T) {
+	decoded := map[string]interface{}{
+		"lni1invoice": map[string]interface{}{
+			"type": "bolt12 invoice", "valid": true, "invoice_node_id": "02node", "invoice_payment_hash": "0102",
+			"invoice_amount_msat": 21000, "invoice_created_at": 1700000000, "offer_description": "coffee",
+		},
+		"lno1fixed": map[string]interface{}{"type": "bolt12 offer", "valid": true, "offer_amount_msat": 21000},
+		"lno1any":   map[string]interface{}{"type": "bolt12 offer", "valid": true},
+	}
+	mock, client := newMockCLN(t)
+	mock.handlers["decode"] = func(params map[string]interface{}) (int, interface{}) {
+		return http.StatusCreated, decoded[params["string"].(string)]
+	}
+	mock.handle("fetchinvoice", http.StatusCreated, map[string]interface{}{"invoice": "lni1invoice"})
+
+	invoice, err := client.FetchOfferInvoice(context.Background(), "lno1fixed", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "lni1invoice", invoice.PaymentRequest)
+	assert.Equal(t, "02node", invoice.PayReq.Destination)
+	assert.Equal(t, "0102", invoice.PayReq.PaymentHash)
+	assert.Equal(t, int64(21), invoice.PayReq.NumSatoshis)
+	assert.Equal(t, int64(defaultBolt12InvoiceExpiry), invoice.PayReq.Expiry)
+	assert.Equal(t, "coffee", invoice.PayReq.Description)
+	// the amount of the offer is used
+	assert.NotContains(t, mock.calls["fetchinvoice"][0], "amount_msat")
+
+	_, err = client.FetchOfferInvoice(context.Background(), "lno1fixed", 1000)
+	assert.ErrorIs(t, err, ErrOfferAmountMismatch)
+
+	_, err = client.FetchOfferInvoice(context.Background(), "lno1any", 0)
+	assert.ErrorIs(t, err, ErrOfferAmountRequired)
+
+	_, err = client.FetchOfferInvoice(context.Background(), "lno1any", 21000)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(21000), mock.calls["fetchinvoice"][1]["amount_msat"])
+	assert.Len(t, mock.calls["fetchinvoice"], 2)
+}
+
+func TestCLNSubscribePayment(t *testing.T) {
+	mock, client := newMockCLN(t)
+	polls := 0
+	mock.handlers["listpays"] = func(params map[string]interface{}) (int, interface{}) {
+		assert.Equal(t, "0102", params["payment_hash"])
+		polls++
+		status := "pending"
+		if polls > 2 {
+			status = "complete"
+		}
+		return http.StatusCreated, map[string]interface{}{
+			"pays": []map[string]interface{}{
+				{"payment_hash": "0102", "status": "failed"},
+				{"payment_hash": "0102", "status": status, "preimage": "03", "amount_msat": 10000, "amount_sent_msat": 12000, "number_of_parts": 2},
+			},
+		}
+	}
+	stream, err := client.SubscribePayment(context.Background(), &routerrpc.TrackPaymentRequest{
+		PaymentHash:       []byte{1, 2},
+		NoInflightUpdates: true,
+	})
+	assert.NoError(t, err)
+	payment, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, polls)
+	assert.Equal(t, lnrpc.Payment_SUCCEEDED, payment.Status)
+	assert.Equal(t, "03", payment.PaymentPreimage)
+	assert.Equal(t, int64(10), payment.ValueSat)
+	assert.Equal(t, int64(2), payment.FeeSat)
+	assert.Equal(t, 2, len(payment.Htlcs))
+}
+
+func TestCLNBalances(t *testing.T) {
+	mock, client := newMockCLN(t)
+	mock.handle("listfunds", http.StatusCreated, map[string]interface{}{
+		"outputs": []map[string]interface{}{
+			{"amount_msat": 100000, "status": "confirmed"},
+			{"amount_msat": 20000, "status": "unconfirmed"},
+			{"amount_msat": 50000, "status": "spent"},
+		},
+		"channels": []map[string]interface{}{
+			{"state": "CHANNELD_NORMAL", "our_amount_msat": 300000},
+			{"state": "CHANNELD_AWAITING_LOCKIN", "our_amount_msat": 40000},
+			{"state": "ONCHAIN", "our_amount_msat": 70000},
+		},
+	})
+	channelBalance, err := client.ChannelBalance(context.Background(), &lnrpc.ChannelBalanceRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(300), channelBalance.LocalBalance.Sat)
+	assert.Equal(t, int64(40), channelBalance.PendingOpenBalance)
+	walletBalance, err := client.WalletBalance(context.Background(), &lnrpc.WalletBalanceRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), walletBalance.ConfirmedBalance)
+	assert.Equal(t, int64(120), walletBalance.TotalBalance)
+}
+
+func TestParseShortChannelID(t *testing.T) {
+	assert.Equal(t, uint64(103<<40|1<<16), parseShortChannelID("103x1x0"))
+	assert.Equal(t, uint64(0), parseShortChannelID("invalid"))
+}
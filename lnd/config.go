@@ -8,11 +8,12 @@ const (
 	LND_CLIENT_TYPE         = "lnd"
 	LND_CLUSTER_CLIENT_TYPE = "lnd_cluster"
 	ECLAIR_CLIENT_TYPE      = "eclair"
+	CLN_CLIENT_TYPE         = "cln"
 )
 
 type Config struct {
-	LNClientType                 string  `envconfig:"LN_CLIENT_TYPE" default:"lnd"` //lnd, lnd_cluster, eclair
-	LNDAddress                   string  `envconfig:"LND_ADDRESS" required:"true"`
+	LNClientType                 string  `envconfig:"LN_CLIENT_TYPE" default:"lnd"` //lnd, lnd_cluster, eclair, cln
+	LNDAddress                   string  `envconfig:"LND_ADDRESS"`
 	LNDMacaroonFile              string  `envconfig:"LND_MACAROON_FILE"`
 	LNDCertFile                  string  `envconfig:"LND_CERT_FILE"`
 	LNDMacaroonHex               string  `envconfig:"LND_MACAROON_HEX"`
@@ -20,6 +21,10 @@ type Config struct {
 	LNDClusterLivenessPeriod     int     `envconfig:"LND_CLUSTER_LIVENESS_PERIOD" default:"10"`
 	LNDClusterActiveChannelRatio float64 `envconfig:"LND_CLUSTER_ACTIVE_CHANNEL_RATIO" default:"0.5"`
 	LNDClusterPubkeys            string  `envconfig:"LND_CLUSTER_PUBKEYS"` //comma-seperated list of public keys of the cluster
+	CLNAddress                   string  `envconfig:"CLN_ADDRESS"`         //url of the clnrest plugin, e.g. https://localhost:3010
+	CLNRune                      string  `envconfig:"CLN_RUNE"`
+	CLNCertFile                  string  `envconfig:"CLN_CERT_FILE"`
+	CLNCertHex                   string  `envconfig:"CLN_CERT_HEX"`
 }
 
 func LoadConfig() (c *Config, err error) {
@@ -2,10 +2,12 @@ package lnd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/ziflex/lecho/v3"
 	"google.golang.org/grpc"
@@ -14,21 +16,63 @@ import (
 type LightningClientWrapper interface {
 	ListChannels(ctx context.Context, req *lnrpc.ListChannelsRequest, options ...grpc.CallOption) (*lnrpc.ListChannelsResponse, error)
 	SendPaymentSync(ctx context.Context, req *lnrpc.SendRequest, options ...grpc.CallOption) (*lnrpc.SendResponse, error)
+	SendPaymentV2(ctx context.Context, req *routerrpc.SendPaymentRequest, options ...grpc.CallOption) (SubscribePaymentWrapper, error)
 	AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error)
+	AddHoldInvoice(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest, options ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error)
+	SettleInvoice(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error)
+	CancelInvoice(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error)
 	SubscribeInvoices(ctx context.Context, req *lnrpc.InvoiceSubscription, options ...grpc.CallOption) (SubscribeInvoicesWrapper, error)
 	SubscribePayment(ctx context.Context, req *routerrpc.TrackPaymentRequest, options ...grpc.CallOption) (SubscribePaymentWrapper, error)
 	GetInfo(ctx context.Context, req *lnrpc.GetInfoRequest, options ...grpc.CallOption) (*lnrpc.GetInfoResponse, error)
+	ChannelBalance(ctx context.Context, req *lnrpc.ChannelBalanceRequest, options ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error)
+	WalletBalance(ctx context.Context, req *lnrpc.WalletBalanceRequest, options ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error)
+	EstimateRouteFee(ctx context.Context, req *routerrpc.RouteFeeRequest, options ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error)
 	DecodeBolt11(ctx context.Context, bolt11 string, options ...grpc.CallOption) (*lnrpc.PayReq, error)
+	NewAddress(ctx context.Context, req *lnrpc.NewAddressRequest, options ...grpc.CallOption) (*lnrpc.NewAddressResponse, error)
+	GetTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (*lnrpc.TransactionDetails, error)
+	SubscribeTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (SubscribeTransactionsWrapper, error)
+	EstimateFee(ctx context.Context, req *lnrpc.EstimateFeeRequest, options ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error)
+	SendCoins(ctx context.Context, req *lnrpc.SendCoinsRequest, options ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error)
+	CreateOffer(ctx context.Context, req *OfferRequest) (*Offer, error)
+	LookupInvoiceOffer(ctx context.Context, rHash []byte) (offerId string, err error)
+	FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*OfferInvoice, error)
 	IsIdentityPubkey(pubkey string) (isOurPubkey bool)
 	GetMainPubkey() (pubkey string)
 }
 
+var ErrOffersNotSupported = errors.New("bolt12 offers are not supported by the node")
+
+var (
+	ErrOfferAmountRequired = errors.New("the offer has no amount, an amount is required")
+	ErrOfferAmountMismatch = errors.New("the amount does not match the amount of the offer")
+)
+
+// OfferRequest describes a reusable bolt12 offer, an amount of 0 lets the payer choose the amount
+type OfferRequest struct {
+	AmountMsat  int64
+	Description string
+}
+
+type Offer struct {
+	OfferID string
+	Bolt12  string
+}
+
+// OfferInvoice is the bolt12 invoice that was requested from the issuer of an offer
+type OfferInvoice struct {
+	PaymentRequest string
+	PayReq         *lnrpc.PayReq
+}
+
 type SubscribeInvoicesWrapper interface {
 	Recv() (*lnrpc.Invoice, error)
 }
 type SubscribePaymentWrapper interface {
 	Recv() (*lnrpc.Payment, error)
 }
+type SubscribeTransactionsWrapper interface {
+	Recv() (*lnrpc.Transaction, error)
+}
 
 func InitLNClient(c *Config, logger *lecho.Logger, ctx context.Context) (result LightningClientWrapper, err error) {
 	switch c.LNClientType {
@@ -36,12 +80,17 @@ func InitLNClient(c *Config, logger *lecho.Logger, ctx context.Context) (result
 		return InitSingleLNDClient(c, ctx)
 	case LND_CLUSTER_CLIENT_TYPE:
 		return InitLNDCluster(c, logger, ctx)
+	case CLN_CLIENT_TYPE:
+		return InitCLNClient(c, ctx)
 	default:
 		return nil, fmt.Errorf("Did not recognize LN client type %s", c.LNClientType)
 	}
 }
 
 func InitSingleLNDClient(c *Config, ctx context.Context) (result LightningClientWrapper, err error) {
+	if c.LNDAddress == "" {
+		return nil, fmt.Errorf("LND_ADDRESS is required")
+	}
 	client, err := NewLNDclient(LNDoptions{
 		Address:      c.LNDAddress,
 		MacaroonFile: c.LNDMacaroonFile,
@@ -60,6 +109,9 @@ func InitSingleLNDClient(c *Config, ctx context.Context) (result LightningClient
 	return client, nil
 }
 func InitLNDCluster(c *Config, logger *lecho.Logger, ctx context.Context) (result LightningClientWrapper, err error) {
+	if c.LNDAddress == "" {
+		return nil, fmt.Errorf("LND_ADDRESS is required")
+	}
 	nodes := []LightningClientWrapper{}
 	//interpret lnd address, macaroon file, cert file, pubkeys as comma seperated values
 	addresses := strings.Split(c.LNDAddress, ",")
@@ -96,3 +148,24 @@ func InitLNDCluster(c *Config, logger *lecho.Logger, ctx context.Context) (resul
 	go cluster.StartLivenessLoop(ctx)
 	return cluster, nil
 }
+
+func InitCLNClient(c *Config, ctx context.Context) (result LightningClientWrapper, err error) {
+	if c.CLNAddress == "" {
+		return nil, fmt.Errorf("CLN_ADDRESS is required")
+	}
+	client, err := NewCLNClient(CLNoptions{
+		Address:  c.CLNAddress,
+		Rune:     c.CLNRune,
+		CertFile: c.CLNCertFile,
+		CertHex:  c.CLNCertHex,
+	})
+	if err != nil {
+		return nil, err
+	}
+	getInfo, err := client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return nil, err
+	}
+	client.IdentityPubkey = getInfo.IdentityPubkey
+	return client, nil
+}
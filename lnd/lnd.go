@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/lightningnetwork/lnd/macaroons"
 	"google.golang.org/grpc"
@@ -19,6 +20,8 @@ import (
 type LNPayReq struct {
 	PayReq  *lnrpc.PayReq
 	Keysend bool
+	// the bolt12 offer the invoice was fetched from
+	Offer string
 }
 
 // LNDoptions are the options for the connection to the lnd node.
@@ -33,6 +36,7 @@ type LNDoptions struct {
 type LNDWrapper struct {
 	client         lnrpc.LightningClient
 	routerClient   routerrpc.RouterClient
+	invoicesClient invoicesrpc.InvoicesClient
 	IdentityPubkey string
 }
 
@@ -95,8 +99,9 @@ func NewLNDclient(lndOptions LNDoptions, ctx context.Context) (result *LNDWrappe
 	}
 	lnClient := lnrpc.NewLightningClient(conn)
 	return &LNDWrapper{
-		client:       lnClient,
-		routerClient: routerrpc.NewRouterClient(conn),
+		client:         lnClient,
+		routerClient:   routerrpc.NewRouterClient(conn),
+		invoicesClient: invoicesrpc.NewInvoicesClient(conn),
 	}, nil
 }
 
@@ -108,10 +113,26 @@ func (wrapper *LNDWrapper) SendPaymentSync(ctx context.Context, req *lnrpc.SendR
 	return wrapper.client.SendPaymentSync(ctx, req, options...)
 }
 
+func (wrapper *LNDWrapper) SendPaymentV2(ctx context.Context, req *routerrpc.SendPaymentRequest, options ...grpc.CallOption) (SubscribePaymentWrapper, error) {
+	return wrapper.routerClient.SendPaymentV2(ctx, req, options...)
+}
+
 func (wrapper *LNDWrapper) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
 	return wrapper.client.AddInvoice(ctx, req, options...)
 }
 
+func (wrapper *LNDWrapper) AddHoldInvoice(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest, options ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	return wrapper.invoicesClient.AddHoldInvoice(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) SettleInvoice(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error) {
+	return wrapper.invoicesClient.SettleInvoice(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) CancelInvoice(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error) {
+	return wrapper.invoicesClient.CancelInvoice(ctx, req, options...)
+}
+
 func (wrapper *LNDWrapper) SubscribeInvoices(ctx context.Context, req *lnrpc.InvoiceSubscription, options ...grpc.CallOption) (SubscribeInvoicesWrapper, error) {
 	return wrapper.client.SubscribeInvoices(ctx, req, options...)
 }
@@ -120,12 +141,56 @@ func (wrapper *LNDWrapper) GetInfo(ctx context.Context, req *lnrpc.GetInfoReques
 	return wrapper.client.GetInfo(ctx, req, options...)
 }
 
+func (wrapper *LNDWrapper) ChannelBalance(ctx context.Context, req *lnrpc.ChannelBalanceRequest, options ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error) {
+	return wrapper.client.ChannelBalance(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) WalletBalance(ctx context.Context, req *lnrpc.WalletBalanceRequest, options ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
+	return wrapper.client.WalletBalance(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) EstimateRouteFee(ctx context.Context, req *routerrpc.RouteFeeRequest, options ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	return wrapper.routerClient.EstimateRouteFee(ctx, req, options...)
+}
+
 func (wrapper *LNDWrapper) DecodeBolt11(ctx context.Context, bolt11 string, options ...grpc.CallOption) (*lnrpc.PayReq, error) {
 	return wrapper.client.DecodePayReq(ctx, &lnrpc.PayReqString{
 		PayReq: bolt11,
 	})
 }
 
+func (wrapper *LNDWrapper) NewAddress(ctx context.Context, req *lnrpc.NewAddressRequest, options ...grpc.CallOption) (*lnrpc.NewAddressResponse, error) {
+	return wrapper.client.NewAddress(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) GetTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (*lnrpc.TransactionDetails, error) {
+	return wrapper.client.GetTransactions(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) SubscribeTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (SubscribeTransactionsWrapper, error) {
+	return wrapper.client.SubscribeTransactions(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) EstimateFee(ctx context.Context, req *lnrpc.EstimateFeeRequest, options ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
+	return wrapper.client.EstimateFee(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) SendCoins(ctx context.Context, req *lnrpc.SendCoinsRequest, options ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
+	return wrapper.client.SendCoins(ctx, req, options...)
+}
+
+func (wrapper *LNDWrapper) CreateOffer(ctx context.Context, req *OfferRequest) (*Offer, error) {
+	return nil, ErrOffersNotSupported
+}
+
+func (wrapper *LNDWrapper) LookupInvoiceOffer(ctx context.Context, rHash []byte) (offerId string, err error) {
+	return "", ErrOffersNotSupported
+}
+
+func (wrapper *LNDWrapper) FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*OfferInvoice, error) {
+	return nil, ErrOffersNotSupported
+}
+
 func (wrapper *LNDWrapper) SubscribePayment(ctx context.Context, req *routerrpc.TrackPaymentRequest, options ...grpc.CallOption) (SubscribePaymentWrapper, error) {
 	return wrapper.routerClient.TrackPaymentV2(ctx, req, options...)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/ziflex/lecho/v3"
 	"google.golang.org/grpc"
@@ -84,10 +85,27 @@ func (cluster *LNDCluster) SendPaymentSync(ctx context.Context, req *lnrpc.SendR
 	return cluster.ActiveNode.SendPaymentSync(ctx, req, options...)
 }
 
+func (cluster *LNDCluster) SendPaymentV2(ctx context.Context, req *routerrpc.SendPaymentRequest, options ...grpc.CallOption) (SubscribePaymentWrapper, error) {
+	return cluster.ActiveNode.SendPaymentV2(ctx, req, options...)
+}
+
 func (cluster *LNDCluster) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
 	return cluster.ActiveNode.AddInvoice(ctx, req, options...)
 }
 
+// hold invoices are settled and canceled on the active node, which has to be the node the invoice was created on
+func (cluster *LNDCluster) AddHoldInvoice(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest, options ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	return cluster.ActiveNode.AddHoldInvoice(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) SettleInvoice(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error) {
+	return cluster.ActiveNode.SettleInvoice(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) CancelInvoice(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error) {
+	return cluster.ActiveNode.CancelInvoice(ctx, req, options...)
+}
+
 func (cluster *LNDCluster) SubscribeInvoices(ctx context.Context, req *lnrpc.InvoiceSubscription, options ...grpc.CallOption) (SubscribeInvoicesWrapper, error) {
 	return nil, fmt.Errorf("not implemented")
 }
@@ -100,10 +118,55 @@ func (cluster *LNDCluster) GetInfo(ctx context.Context, req *lnrpc.GetInfoReques
 	return cluster.ActiveNode.GetInfo(ctx, req, options...)
 }
 
+func (cluster *LNDCluster) ChannelBalance(ctx context.Context, req *lnrpc.ChannelBalanceRequest, options ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error) {
+	return cluster.ActiveNode.ChannelBalance(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) WalletBalance(ctx context.Context, req *lnrpc.WalletBalanceRequest, options ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
+	return cluster.ActiveNode.WalletBalance(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) EstimateRouteFee(ctx context.Context, req *routerrpc.RouteFeeRequest, options ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	return cluster.ActiveNode.EstimateRouteFee(ctx, req, options...)
+}
+
 func (cluster *LNDCluster) DecodeBolt11(ctx context.Context, bolt11 string, options ...grpc.CallOption) (*lnrpc.PayReq, error) {
 	return cluster.ActiveNode.DecodeBolt11(ctx, bolt11, options...)
 }
 
+// the deposit addresses are created and watched on the primary node
+func (cluster *LNDCluster) NewAddress(ctx context.Context, req *lnrpc.NewAddressRequest, options ...grpc.CallOption) (*lnrpc.NewAddressResponse, error) {
+	return cluster.Nodes[0].NewAddress(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) GetTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (*lnrpc.TransactionDetails, error) {
+	return cluster.Nodes[0].GetTransactions(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) SubscribeTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (SubscribeTransactionsWrapper, error) {
+	return cluster.Nodes[0].SubscribeTransactions(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) EstimateFee(ctx context.Context, req *lnrpc.EstimateFeeRequest, options ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
+	return cluster.Nodes[0].EstimateFee(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) SendCoins(ctx context.Context, req *lnrpc.SendCoinsRequest, options ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
+	return cluster.Nodes[0].SendCoins(ctx, req, options...)
+}
+
+func (cluster *LNDCluster) CreateOffer(ctx context.Context, req *OfferRequest) (*Offer, error) {
+	return nil, ErrOffersNotSupported
+}
+
+func (cluster *LNDCluster) LookupInvoiceOffer(ctx context.Context, rHash []byte) (offerId string, err error) {
+	return "", ErrOffersNotSupported
+}
+
+func (cluster *LNDCluster) FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*OfferInvoice, error) {
+	return nil, ErrOffersNotSupported
+}
+
 func (cluster *LNDCluster) IsIdentityPubkey(pubkey string) (isOurPubkey bool) {
 	for _, node := range cluster.Nodes {
 		if node.GetMainPubkey() == pubkey {
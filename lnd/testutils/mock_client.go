@@ -0,0 +1,305 @@
+// Package testutils contains a lightning client that can be used to test
+// the services and the controllers without a running node.
+package testutils
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/getAlby/lndhub.go/lnd"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"google.golang.org/grpc"
+)
+
+var ErrNotMocked = errors.New("method is not mocked")
+
+var _ lnd.LightningClientWrapper = (*MockLightningClient)(nil)
+
+// MockLightningClient implements lnd.LightningClientWrapper, every call is forwarded to the
+// matching function field. Calls of methods without a function return ErrNotMocked.
+type MockLightningClient struct {
+	Pubkey string
+
+	ListChannelsFunc          func(ctx context.Context, req *lnrpc.ListChannelsRequest) (*lnrpc.ListChannelsResponse, error)
+	SendPaymentSyncFunc       func(ctx context.Context, req *lnrpc.SendRequest) (*lnrpc.SendResponse, error)
+	SendPaymentV2Func         func(ctx context.Context, req *routerrpc.SendPaymentRequest) (lnd.SubscribePaymentWrapper, error)
+	AddInvoiceFunc            func(ctx context.Context, req *lnrpc.Invoice) (*lnrpc.AddInvoiceResponse, error)
+	AddHoldInvoiceFunc        func(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest) (*invoicesrpc.AddHoldInvoiceResp, error)
+	SettleInvoiceFunc         func(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg) (*invoicesrpc.SettleInvoiceResp, error)
+	CancelInvoiceFunc         func(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg) (*invoicesrpc.CancelInvoiceResp, error)
+	SubscribeInvoicesFunc     func(ctx context.Context, req *lnrpc.InvoiceSubscription) (lnd.SubscribeInvoicesWrapper, error)
+	SubscribePaymentFunc      func(ctx context.Context, req *routerrpc.TrackPaymentRequest) (lnd.SubscribePaymentWrapper, error)
+	GetInfoFunc               func(ctx context.Context, req *lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error)
+	ChannelBalanceFunc        func(ctx context.Context, req *lnrpc.ChannelBalanceRequest) (*lnrpc.ChannelBalanceResponse, error)
+	WalletBalanceFunc         func(ctx context.Context, req *lnrpc.WalletBalanceRequest) (*lnrpc.WalletBalanceResponse, error)
+	EstimateRouteFeeFunc      func(ctx context.Context, req *routerrpc.RouteFeeRequest) (*routerrpc.RouteFeeResponse, error)
+	DecodeBolt11Func          func(ctx context.Context, bolt11 string) (*lnrpc.PayReq, error)
+	NewAddressFunc            func(ctx context.Context, req *lnrpc.NewAddressRequest) (*lnrpc.NewAddressResponse, error)
+	GetTransactionsFunc       func(ctx context.Context, req *lnrpc.GetTransactionsRequest) (*lnrpc.TransactionDetails, error)
+	SubscribeTransactionsFunc func(ctx context.Context, req *lnrpc.GetTransactionsRequest) (lnd.SubscribeTransactionsWrapper, error)
+	EstimateFeeFunc           func(ctx context.Context, req *lnrpc.EstimateFeeRequest) (*lnrpc.EstimateFeeResponse, error)
+	SendCoinsFunc             func(ctx context.Context, req *lnrpc.SendCoinsRequest) (*lnrpc.SendCoinsResponse, error)
+	CreateOfferFunc           func(ctx context.Context, req *lnd.OfferRequest) (*lnd.Offer, error)
+	LookupInvoiceOfferFunc    func(ctx context.Context, rHash []byte) (string, error)
+	FetchOfferInvoiceFunc     func(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error)
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// Calls returns how often a method was called, e.g. Calls("SendPaymentSync")
+func (m *MockLightningClient) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+func (m *MockLightningClient) record(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = map[string]int{}
+	}
+	m.calls[method]++
+}
+
+func (m *MockLightningClient) ListChannels(ctx context.Context, req *lnrpc.ListChannelsRequest, options ...grpc.CallOption) (*lnrpc.ListChannelsResponse, error) {
+	m.record("ListChannels")
+	if m.ListChannelsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ListChannelsFunc(ctx, req)
+}
+
+func (m *MockLightningClient) SendPaymentSync(ctx context.Context, req *lnrpc.SendRequest, options ...grpc.CallOption) (*lnrpc.SendResponse, error) {
+	m.record("SendPaymentSync")
+	if m.SendPaymentSyncFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SendPaymentSyncFunc(ctx, req)
+}
+
+func (m *MockLightningClient) SendPaymentV2(ctx context.Context, req *routerrpc.SendPaymentRequest, options ...grpc.CallOption) (lnd.SubscribePaymentWrapper, error) {
+	m.record("SendPaymentV2")
+	if m.SendPaymentV2Func == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SendPaymentV2Func(ctx, req)
+}
+
+func (m *MockLightningClient) AddInvoice(ctx context.Context, req *lnrpc.Invoice, options ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	m.record("AddInvoice")
+	if m.AddInvoiceFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.AddInvoiceFunc(ctx, req)
+}
+
+func (m *MockLightningClient) AddHoldInvoice(ctx context.Context, req *invoicesrpc.AddHoldInvoiceRequest, options ...grpc.CallOption) (*invoicesrpc.AddHoldInvoiceResp, error) {
+	m.record("AddHoldInvoice")
+	if m.AddHoldInvoiceFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.AddHoldInvoiceFunc(ctx, req)
+}
+
+func (m *MockLightningClient) SettleInvoice(ctx context.Context, req *invoicesrpc.SettleInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.SettleInvoiceResp, error) {
+	m.record("SettleInvoice")
+	if m.SettleInvoiceFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SettleInvoiceFunc(ctx, req)
+}
+
+func (m *MockLightningClient) CancelInvoice(ctx context.Context, req *invoicesrpc.CancelInvoiceMsg, options ...grpc.CallOption) (*invoicesrpc.CancelInvoiceResp, error) {
+	m.record("CancelInvoice")
+	if m.CancelInvoiceFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.CancelInvoiceFunc(ctx, req)
+}
+
+func (m *MockLightningClient) SubscribeInvoices(ctx context.Context, req *lnrpc.InvoiceSubscription, options ...grpc.CallOption) (lnd.SubscribeInvoicesWrapper, error) {
+	m.record("SubscribeInvoices")
+	if m.SubscribeInvoicesFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SubscribeInvoicesFunc(ctx, req)
+}
+
+func (m *MockLightningClient) SubscribePayment(ctx context.Context, req *routerrpc.TrackPaymentRequest, options ...grpc.CallOption) (lnd.SubscribePaymentWrapper, error) {
+	m.record("SubscribePayment")
+	if m.SubscribePaymentFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SubscribePaymentFunc(ctx, req)
+}
+
+func (m *MockLightningClient) GetInfo(ctx context.Context, req *lnrpc.GetInfoRequest, options ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	m.record("GetInfo")
+	if m.GetInfoFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetInfoFunc(ctx, req)
+}
+
+func (m *MockLightningClient) ChannelBalance(ctx context.Context, req *lnrpc.ChannelBalanceRequest, options ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error) {
+	m.record("ChannelBalance")
+	if m.ChannelBalanceFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ChannelBalanceFunc(ctx, req)
+}
+
+func (m *MockLightningClient) WalletBalance(ctx context.Context, req *lnrpc.WalletBalanceRequest, options ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
+	m.record("WalletBalance")
+	if m.WalletBalanceFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.WalletBalanceFunc(ctx, req)
+}
+
+func (m *MockLightningClient) EstimateRouteFee(ctx context.Context, req *routerrpc.RouteFeeRequest, options ...grpc.CallOption) (*routerrpc.RouteFeeResponse, error) {
+	m.record("EstimateRouteFee")
+	if m.EstimateRouteFeeFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.EstimateRouteFeeFunc(ctx, req)
+}
+
+func (m *MockLightningClient) DecodeBolt11(ctx context.Context, bolt11 string, options ...grpc.CallOption) (*lnrpc.PayReq, error) {
+	m.record("DecodeBolt11")
+	if m.DecodeBolt11Func == nil {
+		return nil, ErrNotMocked
+	}
+	return m.DecodeBolt11Func(ctx, bolt11)
+}
+
+func (m *MockLightningClient) NewAddress(ctx context.Context, req *lnrpc.NewAddressRequest, options ...grpc.CallOption) (*lnrpc.NewAddressResponse, error) {
+	m.record("NewAddress")
+	if m.NewAddressFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.NewAddressFunc(ctx, req)
+}
+
+func (m *MockLightningClient) GetTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (*lnrpc.TransactionDetails, error) {
+	m.record("GetTransactions")
+	if m.GetTransactionsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.GetTransactionsFunc(ctx, req)
+}
+
+func (m *MockLightningClient) SubscribeTransactions(ctx context.Context, req *lnrpc.GetTransactionsRequest, options ...grpc.CallOption) (lnd.SubscribeTransactionsWrapper, error) {
+	m.record("SubscribeTransactions")
+	if m.SubscribeTransactionsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SubscribeTransactionsFunc(ctx, req)
+}
+
+func (m *MockLightningClient) EstimateFee(ctx context.Context, req *lnrpc.EstimateFeeRequest, options ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
+	m.record("EstimateFee")
+	if m.EstimateFeeFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.EstimateFeeFunc(ctx, req)
+}
+
+func (m *MockLightningClient) SendCoins(ctx context.Context, req *lnrpc.SendCoinsRequest, options ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
+	m.record("SendCoins")
+	if m.SendCoinsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SendCoinsFunc(ctx, req)
+}
+
+func (m *MockLightningClient) CreateOffer(ctx context.Context, req *lnd.OfferRequest) (*lnd.Offer, error) {
+	m.record("CreateOffer")
+	if m.CreateOfferFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.CreateOfferFunc(ctx, req)
+}
+
+func (m *MockLightningClient) LookupInvoiceOffer(ctx context.Context, rHash []byte) (string, error) {
+	m.record("LookupInvoiceOffer")
+	if m.LookupInvoiceOfferFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.LookupInvoiceOfferFunc(ctx, rHash)
+}
+
+func (m *MockLightningClient) FetchOfferInvoice(ctx context.Context, offer string, amountMsat int64) (*lnd.OfferInvoice, error) {
+	m.record("FetchOfferInvoice")
+	if m.FetchOfferInvoiceFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.FetchOfferInvoiceFunc(ctx, offer, amountMsat)
+}
+
+func (m *MockLightningClient) IsIdentityPubkey(pubkey string) (isOurPubkey bool) {
+	return pubkey == m.Pubkey
+}
+
+func (m *MockLightningClient) GetMainPubkey() (pubkey string) {
+	return m.Pubkey
+}
+
+// MockPaymentStream is a payment stream that returns the given updates and then the error
+type MockPaymentStream struct {
+	Payments []*lnrpc.Payment
+	Err      error
+}
+
+func (s *MockPaymentStream) Recv() (*lnrpc.Payment, error) {
+	if len(s.Payments) == 0 {
+		if s.Err == nil {
+			return nil, errors.New("payment stream closed")
+		}
+		return nil, s.Err
+	}
+	payment := s.Payments[0]
+	s.Payments = s.Payments[1:]
+	return payment, nil
+}
+
+// MockInvoiceStream is an invoice stream that returns the given updates and then the error
+type MockInvoiceStream struct {
+	Invoices []*lnrpc.Invoice
+	Err      error
+}
+
+func (s *MockInvoiceStream) Recv() (*lnrpc.Invoice, error) {
+	if len(s.Invoices) == 0 {
+		if s.Err == nil {
+			return nil, errors.New("invoice stream closed")
+		}
+		return nil, s.Err
+	}
+	invoice := s.Invoices[0]
+	s.Invoices = s.Invoices[1:]
+	return invoice, nil
+}
+
+// MockTransactionStream is a transaction stream that returns the given updates and then the error
+type MockTransactionStream struct {
+	Transactions []*lnrpc.Transaction
+	Err          error
+}
+
+func (s *MockTransactionStream) Recv() (*lnrpc.Transaction, error) {
+	if len(s.Transactions) == 0 {
+		if s.Err == nil {
+			return nil, errors.New("transaction stream closed")
+		}
+		return nil, s.Err
+	}
+	transaction := s.Transactions[0]
+	s.Transactions = s.Transactions[1:]
+	return transaction, nil
+}